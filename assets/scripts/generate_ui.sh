@@ -13,11 +13,13 @@ _PAGES[${#_PAGES[@]}]="login"
 _PAGES[${#_PAGES[@]}]="portal"
 _PAGES[${#_PAGES[@]}]="whoami"
 _PAGES[${#_PAGES[@]}]="register"
+_PAGES[${#_PAGES[@]}]="recover"
 _PAGES[${#_PAGES[@]}]="generic"
 _PAGES[${#_PAGES[@]}]="settings"
 _PAGES[${#_PAGES[@]}]="sandbox"
 _PAGES[${#_PAGES[@]}]="apps_sso"
 _PAGES[${#_PAGES[@]}]="apps_mobile_access"
+_PAGES[${#_PAGES[@]}]="consent"
 
 printf "package ui\n\n" > ${UI_FILE}
 printf "// PageTemplates stores UI templates.\n" >> ${UI_FILE}
@@ -101,6 +101,17 @@ func init() {
 			Usage:       "list database objects",
 			Subcommands: listSubcmd,
 		},
+		{
+			Name:   "migrate",
+			Usage:  "import JSON user database into another database storage",
+			Flags:  migrateFlags,
+			Action: migrate,
+		},
+		{
+			Name:        "test",
+			Usage:       "run tests",
+			Subcommands: testSubcmd,
+		},
 	}
 }
 
@@ -0,0 +1,67 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/greenpau/go-authcrunch/pkg/identity"
+	"github.com/urfave/cli/v2"
+)
+
+var (
+	migrateFlags = []cli.Flag{
+		&cli.StringFlag{
+			Name:     "source",
+			Usage:    "read JSON database from `FILE`",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:     "target",
+			Usage:    "write database to `FILE`",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:  "storage",
+			Usage: "Sets `NAME` of the target database storage, i.e. json or bolt",
+			Value: identity.StorageKindBolt,
+		},
+	}
+)
+
+func migrate(c *cli.Context) error {
+	// The source database is left as is, i.e. it is neither created when
+	// missing nor updated to the default policy.
+	src, err := identity.OpenDatabaseReadOnly(c.String("source"))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := identity.NewDatabaseWithStorage(c.String("target"), c.String("storage"))
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	if err := dst.Import(src); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stdout, "migrated %d users from %s to %s (%s)\n",
+		dst.GetUserCount(), c.String("source"), c.String("target"), dst.GetStorageKind(),
+	)
+	return nil
+}
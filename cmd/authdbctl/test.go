@@ -0,0 +1,93 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/greenpau/go-authcrunch/pkg/authz"
+	fileutil "github.com/greenpau/go-authcrunch/pkg/util/file"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	testSubcmd = []*cli.Command{
+		{
+			Name:  "policy",
+			Usage: "evaluate authorization policy against policy tests",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     "policy",
+					Usage:    "read YAML or JSON authorization policy from `FILE`",
+					Required: true,
+				},
+				&cli.StringFlag{
+					Name:     "tests",
+					Usage:    "read YAML or JSON policy tests from `FILE`",
+					Required: true,
+				},
+				&cli.BoolFlag{
+					Name:  "explain",
+					Usage: "print the rule evaluations of the failed tests",
+				},
+			},
+			Action: testPolicy,
+		},
+	}
+)
+
+func testPolicy(c *cli.Context) error {
+	b, err := fileutil.ReadFileBytes(c.String("policy"))
+	if err != nil {
+		return err
+	}
+	policy := &authz.PolicyConfig{}
+	if err := yaml.Unmarshal(b, policy); err != nil {
+		return fmt.Errorf("failed parsing %q policy: %v", c.String("policy"), err)
+	}
+
+	suite, err := authz.LoadPolicyTestSuite(c.String("tests"))
+	if err != nil {
+		return err
+	}
+	results, err := policy.RunPolicyTests(context.Background(), suite)
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	for _, result := range results {
+		if result.Passed {
+			fmt.Fprintf(os.Stdout, "PASS %s\n", result.Name)
+			continue
+		}
+		failed++
+		fmt.Fprintf(os.Stdout, "FAIL %s: expected %s, got %s (%s)\n",
+			result.Name, result.Expected, result.Actual, result.Explanation.Reason,
+		)
+		if c.Bool("explain") {
+			b, _ := json.MarshalIndent(result.Explanation, "", "  ")
+			fmt.Fprintf(os.Stdout, "%s\n", b)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d policy tests failed", failed, len(results))
+	}
+	return nil
+}
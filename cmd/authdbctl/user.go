@@ -61,11 +61,10 @@ func listUsers(c *cli.Context) error {
 	wr.logger.Debug("listing users")
 
 	var reqData = []byte(`{
-		"name": "",
-		"job": "leader"
+		"kind": "fetch_users"
 	}`)
 
-	req, _ := http.NewRequest(http.MethodPost, wr.config.BaseURL+"/api/users", bytes.NewBuffer(reqData))
+	req, _ := http.NewRequest(http.MethodPost, wr.config.BaseURL+"/api/manager", bytes.NewBuffer(reqData))
 	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
 	req.Header.Set("Authorization", "access_token="+wr.config.token)
 	respBody, _, err := wr.browser.Do(req)
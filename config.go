@@ -22,8 +22,10 @@ import (
 	"github.com/greenpau/go-authcrunch/pkg/errors"
 	"github.com/greenpau/go-authcrunch/pkg/idp"
 	"github.com/greenpau/go-authcrunch/pkg/ids"
+	"github.com/greenpau/go-authcrunch/pkg/kvstore"
 	"github.com/greenpau/go-authcrunch/pkg/messaging"
 	"github.com/greenpau/go-authcrunch/pkg/registry"
+	"github.com/greenpau/go-authcrunch/pkg/revocation"
 	"github.com/greenpau/go-authcrunch/pkg/sso"
 )
 
@@ -39,6 +41,8 @@ type Config struct {
 	disabledIdentityStores    map[string]interface{}
 	disabledIdentityProviders map[string]interface{}
 	UserRegistries            []*registry.UserRegistryConfig `json:"user_registries,omitempty" xml:"user_registries,omitempty" yaml:"user_registries,omitempty"`
+	TokenRevocation           *revocation.Config             `json:"token_revocation,omitempty" xml:"token_revocation,omitempty" yaml:"token_revocation,omitempty"`
+	Cache                     *kvstore.Config                `json:"cache,omitempty" xml:"cache,omitempty" yaml:"cache,omitempty"`
 }
 
 // NewConfig returns an instance of Config.
@@ -110,6 +114,26 @@ func (cfg *Config) AddAuthorizationPolicy(p *authz.PolicyConfig) error {
 	return nil
 }
 
+// SetTokenRevocation sets the configuration of the token revocation deny
+// list shared by portals and gatekeepers.
+func (cfg *Config) SetTokenRevocation(c *revocation.Config) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	cfg.TokenRevocation = c
+	return nil
+}
+
+// SetCache sets the configuration of the key/value store shared by the
+// caches of portals, identity providers, and user registries.
+func (cfg *Config) SetCache(c *kvstore.Config) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	cfg.Cache = c
+	return nil
+}
+
 // Validate validates Config.
 func (cfg *Config) Validate() error {
 	if cfg == nil {
@@ -145,6 +169,14 @@ func (cfg *Config) Validate() error {
 
 	// Validate auth portal configurations.
 	for _, portalCfg := range cfg.AuthenticationPortals {
+		if portalCfg.Recovery != nil {
+			portalCfg.Recovery.SetCredentials(cfg.Credentials)
+			portalCfg.Recovery.SetMessaging(cfg.Messaging)
+			if err := portalCfg.Recovery.ValidateMessaging(portalCfg.Name); err != nil {
+				return err
+			}
+		}
+
 		// If there are no excplicitly specified identity stores and providers in a portal, add all of them.
 		if len(portalCfg.IdentityStores) == 0 && len(portalCfg.IdentityProviders) == 0 {
 			for _, entry := range cfg.IdentityStores {
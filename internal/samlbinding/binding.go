@@ -0,0 +1,219 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package samlbinding decodes the SAML messages received via HTTP-Redirect
+// and HTTP-POST bindings and verifies their signatures. The identity
+// providers and the single sign-on providers share it.
+package samlbinding
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+	xrv "github.com/mattermost/xml-roundtrip-validator"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// MaxMessageSize is the maximum size of a decoded message.
+const MaxMessageSize = 128 * 1024
+
+var redirectSignatureHashes = map[string]crypto.Hash{
+	dsig.RSASHA1SignatureMethod:     crypto.SHA1,
+	dsig.RSASHA256SignatureMethod:   crypto.SHA256,
+	dsig.RSASHA512SignatureMethod:   crypto.SHA512,
+	dsig.ECDSASHA256SignatureMethod: crypto.SHA256,
+	dsig.ECDSASHA512SignatureMethod: crypto.SHA512,
+}
+
+// Message is a SAML message received via HTTP-Redirect or HTTP-POST
+// binding. The contents of the message are not trusted until its signature
+// is verified.
+type Message struct {
+	// Data is the XML document of the message.
+	Data []byte `json:"data,omitempty" xml:"data,omitempty" yaml:"data,omitempty"`
+	// Root is the root element of the message.
+	Root *etree.Element `json:"root,omitempty" xml:"root,omitempty" yaml:"root,omitempty"`
+	// RelayState is the relay state received along with the message.
+	RelayState string `json:"relay_state,omitempty" xml:"relay_state,omitempty" yaml:"relay_state,omitempty"`
+
+	param          string
+	rawQuery       string
+	redirectSigned bool
+}
+
+// Decode returns the message found in the parameter of the request, e.g.
+// SAMLRequest or SAMLResponse.
+func Decode(r *http.Request, param string) (*Message, error) {
+	m := &Message{param: param}
+
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		compressed, err := base64.StdEncoding.DecodeString(q.Get(param))
+		if err != nil {
+			return nil, err
+		}
+		m.Data, err = io.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(compressed)), MaxMessageSize))
+		if err != nil {
+			return nil, err
+		}
+		m.RelayState = q.Get("RelayState")
+		m.rawQuery = r.URL.RawQuery
+		m.redirectSigned = q.Get("Signature") != ""
+	case http.MethodPost:
+		r.Body = http.MaxBytesReader(nil, r.Body, 2*MaxMessageSize)
+		if err := r.ParseForm(); err != nil {
+			return nil, err
+		}
+		var err error
+		m.Data, err = base64.StdEncoding.DecodeString(r.PostForm.Get(param))
+		if err != nil {
+			return nil, err
+		}
+		m.RelayState = r.PostForm.Get("RelayState")
+	default:
+		return nil, fmt.Errorf("unsupported method %s", r.Method)
+	}
+
+	if len(m.Data) == 0 {
+		return nil, fmt.Errorf("empty %s", param)
+	}
+	if err := xrv.Validate(bytes.NewReader(m.Data)); err != nil {
+		return nil, err
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(m.Data); err != nil {
+		return nil, err
+	}
+	if doc.Root() == nil {
+		return nil, fmt.Errorf("empty %s", param)
+	}
+	m.Root = doc.Root()
+	return m, nil
+}
+
+// IsSigned returns true when the message has a signature, either in the
+// query of HTTP-Redirect binding or enveloped in the message.
+func (m *Message) IsSigned() bool {
+	return m.redirectSigned || m.Root.FindElement("./Signature") != nil
+}
+
+// Verify verifies the signature of the message with one of the certificates
+// and returns the signed element. Only the signed element is trusted, i.e.
+// the contents outside of an enveloped signature are dropped.
+func (m *Message) Verify(certs []*x509.Certificate, now time.Time) (*etree.Element, error) {
+	switch {
+	case m.redirectSigned:
+		if err := verifyRedirectSignature(m.rawQuery, m.param, certs); err != nil {
+			return nil, err
+		}
+		return m.Root, nil
+	case m.Root.FindElement("./Signature") != nil:
+		return verifyEmbeddedSignature(m.Root, certs, now)
+	}
+	return nil, fmt.Errorf("unsigned %s", m.param)
+}
+
+// verifyRedirectSignature verifies the signature of the message received
+// via HTTP-Redirect binding. The signature covers the query parameters as
+// they were encoded by the sender.
+func verifyRedirectSignature(rawQuery, param string, certs []*x509.Certificate) error {
+	params := make(map[string]string)
+	for _, kv := range strings.Split(rawQuery, "&") {
+		arr := strings.SplitN(kv, "=", 2)
+		if len(arr) != 2 {
+			continue
+		}
+		if _, exists := params[arr[0]]; exists {
+			return fmt.Errorf("duplicate %q parameter", arr[0])
+		}
+		params[arr[0]] = arr[1]
+	}
+
+	signed := param + "=" + params[param]
+	if v, exists := params["RelayState"]; exists {
+		signed += "&RelayState=" + v
+	}
+	signed += "&SigAlg=" + params["SigAlg"]
+
+	sigAlg, err := url.QueryUnescape(params["SigAlg"])
+	if err != nil {
+		return err
+	}
+	hash, exists := redirectSignatureHashes[sigAlg]
+	if !exists {
+		return fmt.Errorf("unsupported signature algorithm %q", sigAlg)
+	}
+	s, err := url.QueryUnescape(params["Signature"])
+	if err != nil {
+		return err
+	}
+	sig, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	for _, cert := range certs {
+		switch pub := cert.PublicKey.(type) {
+		case *rsa.PublicKey:
+			if rsa.VerifyPKCS1v15(pub, hash, digest, sig) == nil {
+				return nil
+			}
+		case *ecdsa.PublicKey:
+			// The signature is the concatenation of r and s.
+			if len(sig)%2 != 0 {
+				continue
+			}
+			r := new(big.Int).SetBytes(sig[:len(sig)/2])
+			s := new(big.Int).SetBytes(sig[len(sig)/2:])
+			if ecdsa.Verify(pub, digest, r, s) {
+				return nil
+			}
+		}
+	}
+	if len(certs) == 0 {
+		return fmt.Errorf("sender has no signing certificate")
+	}
+	return fmt.Errorf("signature verification failed")
+}
+
+// verifyEmbeddedSignature verifies the enveloped signature of the message
+// and returns the signed element.
+func verifyEmbeddedSignature(el *etree.Element, certs []*x509.Certificate, now time.Time) (*etree.Element, error) {
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("sender has no signing certificate")
+	}
+	validator := dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{
+		Roots: certs,
+	})
+	validator.Clock = dsig.NewFakeClockAt(now)
+	return validator.Validate(el)
+}
@@ -21,6 +21,7 @@ import (
 	"unicode"
 
 	"github.com/greenpau/go-authcrunch"
+	"github.com/greenpau/go-authcrunch/internal/samlbinding"
 	"github.com/greenpau/go-authcrunch/internal/tests"
 	"github.com/greenpau/go-authcrunch/internal/testutils"
 	"github.com/greenpau/go-authcrunch/pkg/acl"
@@ -47,10 +48,12 @@ import (
 	"github.com/greenpau/go-authcrunch/pkg/ids/ldap"
 	"github.com/greenpau/go-authcrunch/pkg/ids/local"
 	"github.com/greenpau/go-authcrunch/pkg/kms"
+	"github.com/greenpau/go-authcrunch/pkg/kvstore"
 	"github.com/greenpau/go-authcrunch/pkg/messaging"
 	"github.com/greenpau/go-authcrunch/pkg/redirects"
 	"github.com/greenpau/go-authcrunch/pkg/registry"
 	"github.com/greenpau/go-authcrunch/pkg/requests"
+	"github.com/greenpau/go-authcrunch/pkg/revocation"
 	"github.com/greenpau/go-authcrunch/pkg/sso"
 	"github.com/greenpau/go-authcrunch/pkg/tagging"
 	"github.com/greenpau/go-authcrunch/pkg/user"
@@ -136,11 +139,31 @@ func TestTagCompliance(t *testing.T) {
 			entry: &sso.SingleSignOnProviderConfig{},
 			opts:  &Options{},
 		},
+		{
+			name:  "test samlbinding.Message struct",
+			entry: &samlbinding.Message{},
+			opts:  &Options{},
+		},
 		{
 			name:  "test sso.Request struct",
 			entry: &sso.Request{},
 			opts:  &Options{},
 		},
+		{
+			name:  "test sso.AssumeRoleParams struct",
+			entry: &sso.AssumeRoleParams{},
+			opts:  &Options{},
+		},
+		{
+			name:  "test sso.ServiceProviderConfig struct",
+			entry: &sso.ServiceProviderConfig{},
+			opts:  &Options{},
+		},
+		{
+			name:  "test sso.AuthnRequest struct",
+			entry: &sso.AuthnRequest{},
+			opts:  &Options{},
+		},
 		{
 			name:  "test ui.NavigationItem struct",
 			entry: &ui.NavigationItem{},
@@ -151,6 +174,11 @@ func TestTagCompliance(t *testing.T) {
 			entry: &requests.IdentityTokenCookie{},
 			opts:  &Options{},
 		},
+		{
+			name:  "test requests.IdentityProviderSession struct",
+			entry: &requests.IdentityProviderSession{},
+			opts:  &Options{},
+		},
 		{
 			name:  "test icons.LoginIcon struct",
 			entry: &icons.LoginIcon{},
@@ -360,6 +388,10 @@ func TestTagCompliance(t *testing.T) {
 			name:  "test LockoutState struct",
 			entry: &identity.LockoutState{},
 		},
+		{
+			name:  "test LockoutPolicy struct",
+			entry: &identity.LockoutPolicy{},
+		},
 		{
 			name:  "test MfaDevice struct",
 			entry: &identity.MfaDevice{},
@@ -426,6 +458,10 @@ func TestTagCompliance(t *testing.T) {
 				DisableTagOnEmpty: true,
 			},
 		},
+		{
+			name:  "test PasswordPolicyError struct",
+			entry: &identity.PasswordPolicyError{},
+		},
 		{
 			name:  "test WebAuthnRegisterRequest struct",
 			entry: &identity.WebAuthnRegisterRequest{},
@@ -473,6 +509,36 @@ func TestTagCompliance(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:  "test authn.RecoveryConfig struct",
+			entry: &authn.RecoveryConfig{},
+			opts:  &Options{},
+		},
+		{
+			name:  "test authn.TokenRefreshConfig struct",
+			entry: &authn.TokenRefreshConfig{},
+			opts:  &Options{},
+		},
+		{
+			name:  "test authn.OpenIDConnectConfig struct",
+			entry: &authn.OpenIDConnectConfig{},
+			opts:  &Options{},
+		},
+		{
+			name:  "test authn.OpenIDConnectClientConfig struct",
+			entry: &authn.OpenIDConnectClientConfig{},
+			opts:  &Options{},
+		},
+		{
+			name:  "test authn.OpenIDConnectTokenResponse struct",
+			entry: &authn.OpenIDConnectTokenResponse{},
+			opts:  &Options{},
+		},
+		{
+			name:  "test authn.RefreshRequest struct",
+			entry: &authn.RefreshRequest{},
+			opts:  &Options{},
+		},
 		{
 			name:  "test requests.AuthorizationRequest struct",
 			entry: &requests.AuthorizationRequest{},
@@ -743,6 +809,64 @@ func TestTagCompliance(t *testing.T) {
 				DisableTagMismatch: true,
 			},
 		},
+		{
+			name:  "test kms.JwksKey struct",
+			entry: &kms.JwksKey{},
+			opts: &Options{
+				DisableTagMismatch: true,
+				DisableTagOnEmpty:  true,
+			},
+		},
+		{
+			name:  "test kms.JwksKeySet struct",
+			entry: &kms.JwksKeySet{},
+			opts: &Options{
+				DisableTagOnEmpty: true,
+			},
+		},
+		{
+			name:  "test authn.OpenIDConfiguration struct",
+			entry: &authn.OpenIDConfiguration{},
+			opts: &Options{
+				DisableTagMismatch: true,
+				DisableTagOnEmpty:  true,
+			},
+		},
+		{
+			name:  "test kms.KeyRotationStatus struct",
+			entry: &kms.KeyRotationStatus{},
+			opts:  &Options{},
+		},
+		{
+			name:  "test revocation.Config struct",
+			entry: &revocation.Config{},
+			opts:  &Options{},
+		},
+		{
+			name:  "test revocation.List struct",
+			entry: &revocation.List{},
+			opts:  &Options{},
+		},
+		{
+			name:  "test kvstore.Config struct",
+			entry: &kvstore.Config{},
+			opts:  &Options{},
+		},
+		{
+			name:  "test kvstore.MemoryStore struct",
+			entry: &kvstore.MemoryStore{},
+			opts:  &Options{},
+		},
+		{
+			name:  "test kvstore.BoltStore struct",
+			entry: &kvstore.BoltStore{},
+			opts:  &Options{},
+		},
+		{
+			name:  "test kvstore.RedisStore struct",
+			entry: &kvstore.RedisStore{},
+			opts:  &Options{},
+		},
 		{
 			name:  "test authproxy.Request struct",
 			entry: &authproxy.Request{},
@@ -813,6 +937,21 @@ func TestTagCompliance(t *testing.T) {
 			entry: &acl.AccessList{},
 			opts:  &Options{},
 		},
+		{
+			name:  "test acl.Explanation struct",
+			entry: &acl.Explanation{},
+			opts:  &Options{},
+		},
+		{
+			name:  "test acl.RuleEvaluation struct",
+			entry: &acl.RuleEvaluation{},
+			opts:  &Options{},
+		},
+		{
+			name:  "test acl.ConditionEvaluation struct",
+			entry: &acl.ConditionEvaluation{},
+			opts:  &Options{},
+		},
 		{
 			name:  "test authz.PolicyConfig struct",
 			entry: &authz.PolicyConfig{},
@@ -865,6 +1004,26 @@ func TestTagCompliance(t *testing.T) {
 			entry: &requests.RedirectResponse{},
 			opts:  &Options{},
 		},
+		{
+			name:  "test authz.PolicyTestSuite struct",
+			entry: &authz.PolicyTestSuite{},
+			opts:  &Options{},
+		},
+		{
+			name:  "test authz.PolicyTest struct",
+			entry: &authz.PolicyTest{},
+			opts:  &Options{},
+		},
+		{
+			name:  "test authz.PolicyTestRequest struct",
+			entry: &authz.PolicyTestRequest{},
+			opts:  &Options{},
+		},
+		{
+			name:  "test authz.PolicyTestResult struct",
+			entry: &authz.PolicyTestResult{},
+			opts:  &Options{},
+		},
 		{
 			name:  "test authz.Gatekeeper struct",
 			entry: &authz.Gatekeeper{},
@@ -25,6 +25,14 @@ type AccessList struct {
 	rules        []aclRule
 	logger       *zap.Logger
 	defaultAllow bool
+	// clock is set when a rule refers to the time of the evaluation.
+	clock bool
+	// requestFields are the attributes of the HTTP request referenced by
+	// the rules.
+	requestFields map[string]bool
+	// conditions are the parsed conditions of the rules, shared with the
+	// rules and used to explain the decisions.
+	conditions [][]aclRuleCondition
 }
 
 // NewAccessList returns an instance of AccessList.
@@ -62,12 +70,28 @@ func (acl *AccessList) AddRules(ctx context.Context, cfgs []*RuleConfiguration)
 
 // AddRule adds a rule to AccessList.
 func (acl *AccessList) AddRule(ctx context.Context, cfg *RuleConfiguration) error {
-	rule, err := newACLRule(ctx, len(acl.rules), cfg, acl.logger)
+	conditions, err := parseACLRuleConditions(ctx, cfg)
 	if err != nil {
 		return err
 	}
+	rule, err := newACLRuleWithConditions(ctx, len(acl.rules), cfg, conditions, acl.logger)
+	if err != nil {
+		return err
+	}
+	for _, fieldName := range rule.getConfig(ctx).fields {
+		switch {
+		case fieldName == clockField:
+			acl.clock = true
+		case isRequestField(fieldName):
+			if acl.requestFields == nil {
+				acl.requestFields = make(map[string]bool)
+			}
+			acl.requestFields[fieldName] = true
+		}
+	}
 	acl.config = append(acl.config, cfg)
 	acl.rules = append(acl.rules, rule)
+	acl.conditions = append(acl.conditions, conditions)
 	return nil
 }
 
@@ -90,6 +114,9 @@ func (acl *AccessList) AsMap() map[string]interface{} {
 // denied access.
 func (acl *AccessList) Allow(ctx context.Context, data map[string]interface{}) bool {
 	var grantAccess bool
+	if acl.clock {
+		data = withClock(data)
+	}
 	for _, rule := range acl.rules {
 		v := rule.eval(ctx, data)
 		switch v {
@@ -109,6 +136,18 @@ func (acl *AccessList) Allow(ctx context.Context, data map[string]interface{}) b
 	return false
 }
 
+// withClock returns a copy of the input data with the time of the
+// evaluation. The time replaces the field of the input with the same name,
+// e.g. a custom claim of the token, so that the input cannot set the time.
+func withClock(data map[string]interface{}) map[string]interface{} {
+	m := make(map[string]interface{}, len(data)+1)
+	for k, v := range data {
+		m[k] = v
+	}
+	m[clockField] = timeNow()
+	return m
+}
+
 // GetFieldDataType return data type for a particular data field.
 func GetFieldDataType(s string) (string, string) {
 	k := s
@@ -43,6 +43,11 @@ var (
 		"addr":   dataTypeStr,
 		"method": dataTypeStr,
 		"path":   dataTypeStr,
+		// The attributes of the HTTP request.
+		"request.method": dataTypeStr,
+		"request.path":   dataTypeStr,
+		"request.host":   dataTypeStr,
+		"request.addr":   dataTypeStr,
 	}
 
 	inputDataAliases = map[string]string{
@@ -63,6 +68,7 @@ var (
 		"ipv4":         "addr",
 		"http_method":  "method",
 		"http_path":    "path",
+		"request.ip":   "request.addr",
 	}
 )
 
@@ -71,6 +77,11 @@ const (
 	dataTypeListStr dataType = 1
 	dataTypeStr     dataType = 2
 	dataTypeAny     dataType = 3
+	// The data types of the typed conditions.
+	dataTypeNetwork    dataType = 4
+	dataTypeTimeWindow dataType = 5
+	dataTypeDuration   dataType = 6
+	dataTypeNumber     dataType = 7
 
 	fieldMatchUnknown  fieldMatchStrategy = 0
 	fieldMatchReserved fieldMatchStrategy = 1
@@ -82,6 +93,16 @@ const (
 	fieldFound         fieldMatchStrategy = 7
 	fieldNotFound      fieldMatchStrategy = 8
 	fieldMatchAlways   fieldMatchStrategy = 9
+	// The match strategies of the typed conditions.
+	fieldMatchCIDR           fieldMatchStrategy = 10
+	fieldMatchTimeWindow     fieldMatchStrategy = 11
+	fieldMatchNewer          fieldMatchStrategy = 12
+	fieldMatchOlder          fieldMatchStrategy = 13
+	fieldMatchGreater        fieldMatchStrategy = 14
+	fieldMatchGreaterOrEqual fieldMatchStrategy = 15
+	fieldMatchLess           fieldMatchStrategy = 16
+	fieldMatchLessOrEqual    fieldMatchStrategy = 17
+	fieldMatchEqual          fieldMatchStrategy = 18
 )
 
 type field struct {
@@ -500,8 +521,12 @@ type ruleStrCondRegexMatchStrInput struct {
 }
 
 func (c *ruleListStrCondExactNegativeMatchListStrInput) match(ctx context.Context, values interface{}) bool {
+	arr, ok := values.([]string)
+	if !ok {
+		return false
+	}
 	for _, exp := range c.exprs {
-		for _, v := range values.([]string) {
+		for _, v := range arr {
 			if v == exp.value {
 				return false
 			}
@@ -511,8 +536,12 @@ func (c *ruleListStrCondExactNegativeMatchListStrInput) match(ctx context.Contex
 }
 
 func (c *ruleListStrCondPartialNegativeMatchListStrInput) match(ctx context.Context, values interface{}) bool {
+	arr, ok := values.([]string)
+	if !ok {
+		return false
+	}
 	for _, exp := range c.exprs {
-		for _, v := range values.([]string) {
+		for _, v := range arr {
 			if strings.Contains(v, exp.value) {
 				return false
 			}
@@ -522,8 +551,12 @@ func (c *ruleListStrCondPartialNegativeMatchListStrInput) match(ctx context.Cont
 }
 
 func (c *ruleListStrCondPrefixNegativeMatchListStrInput) match(ctx context.Context, values interface{}) bool {
+	arr, ok := values.([]string)
+	if !ok {
+		return false
+	}
 	for _, exp := range c.exprs {
-		for _, v := range values.([]string) {
+		for _, v := range arr {
 			if strings.HasPrefix(v, exp.value) {
 				return false
 			}
@@ -533,8 +566,12 @@ func (c *ruleListStrCondPrefixNegativeMatchListStrInput) match(ctx context.Conte
 }
 
 func (c *ruleListStrCondSuffixNegativeMatchListStrInput) match(ctx context.Context, values interface{}) bool {
+	arr, ok := values.([]string)
+	if !ok {
+		return false
+	}
 	for _, exp := range c.exprs {
-		for _, v := range values.([]string) {
+		for _, v := range arr {
 			if strings.HasSuffix(v, exp.value) {
 				return false
 			}
@@ -544,9 +581,13 @@ func (c *ruleListStrCondSuffixNegativeMatchListStrInput) match(ctx context.Conte
 }
 
 func (c *ruleListStrCondRegexNegativeMatchListStrInput) match(ctx context.Context, values interface{}) bool {
+	arr, ok := values.([]string)
+	if !ok {
+		return false
+	}
 	if c.config.matchAny {
 		for _, exp := range c.exprs {
-			for _, v := range values.([]string) {
+			for _, v := range arr {
 				if !exp.MatchString(v) {
 					return true
 				}
@@ -555,7 +596,7 @@ func (c *ruleListStrCondRegexNegativeMatchListStrInput) match(ctx context.Contex
 		return false
 	}
 	for _, exp := range c.exprs {
-		for _, v := range values.([]string) {
+		for _, v := range arr {
 			if exp.MatchString(v) {
 				return false
 			}
@@ -565,7 +606,11 @@ func (c *ruleListStrCondRegexNegativeMatchListStrInput) match(ctx context.Contex
 }
 
 func (c *ruleStrCondExactNegativeMatchListStrInput) match(ctx context.Context, values interface{}) bool {
-	for _, v := range values.([]string) {
+	arr, ok := values.([]string)
+	if !ok {
+		return false
+	}
+	for _, v := range arr {
 		if v == c.expr.value {
 			return false
 		}
@@ -574,7 +619,11 @@ func (c *ruleStrCondExactNegativeMatchListStrInput) match(ctx context.Context, v
 }
 
 func (c *ruleStrCondPartialNegativeMatchListStrInput) match(ctx context.Context, values interface{}) bool {
-	for _, v := range values.([]string) {
+	arr, ok := values.([]string)
+	if !ok {
+		return false
+	}
+	for _, v := range arr {
 		if strings.Contains(v, c.expr.value) {
 			return false
 		}
@@ -583,7 +632,11 @@ func (c *ruleStrCondPartialNegativeMatchListStrInput) match(ctx context.Context,
 }
 
 func (c *ruleStrCondPrefixNegativeMatchListStrInput) match(ctx context.Context, values interface{}) bool {
-	for _, v := range values.([]string) {
+	arr, ok := values.([]string)
+	if !ok {
+		return false
+	}
+	for _, v := range arr {
 		if strings.HasPrefix(v, c.expr.value) {
 			return false
 		}
@@ -592,7 +645,11 @@ func (c *ruleStrCondPrefixNegativeMatchListStrInput) match(ctx context.Context,
 }
 
 func (c *ruleStrCondSuffixNegativeMatchListStrInput) match(ctx context.Context, values interface{}) bool {
-	for _, v := range values.([]string) {
+	arr, ok := values.([]string)
+	if !ok {
+		return false
+	}
+	for _, v := range arr {
 		if strings.HasSuffix(v, c.expr.value) {
 			return false
 		}
@@ -601,15 +658,19 @@ func (c *ruleStrCondSuffixNegativeMatchListStrInput) match(ctx context.Context,
 }
 
 func (c *ruleStrCondRegexNegativeMatchListStrInput) match(ctx context.Context, values interface{}) bool {
+	arr, ok := values.([]string)
+	if !ok {
+		return false
+	}
 	if c.config.matchAny {
-		for _, v := range values.([]string) {
+		for _, v := range arr {
 			if !c.expr.MatchString(v) {
 				return true
 			}
 		}
 		return false
 	}
-	for _, v := range values.([]string) {
+	for _, v := range arr {
 		if c.expr.MatchString(v) {
 			return false
 		}
@@ -618,8 +679,12 @@ func (c *ruleStrCondRegexNegativeMatchListStrInput) match(ctx context.Context, v
 }
 
 func (c *ruleListStrCondExactNegativeMatchStrInput) match(ctx context.Context, v interface{}) bool {
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
 	for _, exp := range c.exprs {
-		if v.(string) == exp.value {
+		if s == exp.value {
 			return false
 		}
 	}
@@ -627,8 +692,12 @@ func (c *ruleListStrCondExactNegativeMatchStrInput) match(ctx context.Context, v
 }
 
 func (c *ruleListStrCondPartialNegativeMatchStrInput) match(ctx context.Context, v interface{}) bool {
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
 	for _, exp := range c.exprs {
-		if strings.Contains(v.(string), exp.value) {
+		if strings.Contains(s, exp.value) {
 			return false
 		}
 	}
@@ -636,8 +705,12 @@ func (c *ruleListStrCondPartialNegativeMatchStrInput) match(ctx context.Context,
 }
 
 func (c *ruleListStrCondPrefixNegativeMatchStrInput) match(ctx context.Context, v interface{}) bool {
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
 	for _, exp := range c.exprs {
-		if strings.HasPrefix(v.(string), exp.value) {
+		if strings.HasPrefix(s, exp.value) {
 			return false
 		}
 	}
@@ -645,8 +718,12 @@ func (c *ruleListStrCondPrefixNegativeMatchStrInput) match(ctx context.Context,
 }
 
 func (c *ruleListStrCondSuffixNegativeMatchStrInput) match(ctx context.Context, v interface{}) bool {
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
 	for _, exp := range c.exprs {
-		if strings.HasSuffix(v.(string), exp.value) {
+		if strings.HasSuffix(s, exp.value) {
 			return false
 		}
 	}
@@ -654,16 +731,20 @@ func (c *ruleListStrCondSuffixNegativeMatchStrInput) match(ctx context.Context,
 }
 
 func (c *ruleListStrCondRegexNegativeMatchStrInput) match(ctx context.Context, v interface{}) bool {
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
 	if c.config.matchAny {
 		for _, exp := range c.exprs {
-			if !exp.MatchString(v.(string)) {
+			if !exp.MatchString(s) {
 				return true
 			}
 		}
 		return false
 	}
 	for _, exp := range c.exprs {
-		if exp.MatchString(v.(string)) {
+		if exp.MatchString(s) {
 			return false
 		}
 	}
@@ -671,43 +752,67 @@ func (c *ruleListStrCondRegexNegativeMatchStrInput) match(ctx context.Context, v
 }
 
 func (c *ruleStrCondExactNegativeMatchStrInput) match(ctx context.Context, v interface{}) bool {
-	if v.(string) == c.expr.value {
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
+	if s == c.expr.value {
 		return false
 	}
 	return true
 }
 
 func (c *ruleStrCondPartialNegativeMatchStrInput) match(ctx context.Context, v interface{}) bool {
-	if strings.Contains(v.(string), c.expr.value) {
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
+	if strings.Contains(s, c.expr.value) {
 		return false
 	}
 	return true
 }
 
 func (c *ruleStrCondPrefixNegativeMatchStrInput) match(ctx context.Context, v interface{}) bool {
-	if strings.HasPrefix(v.(string), c.expr.value) {
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
+	if strings.HasPrefix(s, c.expr.value) {
 		return false
 	}
 	return true
 }
 
 func (c *ruleStrCondSuffixNegativeMatchStrInput) match(ctx context.Context, v interface{}) bool {
-	if strings.HasSuffix(v.(string), c.expr.value) {
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
+	if strings.HasSuffix(s, c.expr.value) {
 		return false
 	}
 	return true
 }
 
 func (c *ruleStrCondRegexNegativeMatchStrInput) match(ctx context.Context, v interface{}) bool {
-	if c.expr.MatchString(v.(string)) {
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
+	if c.expr.MatchString(s) {
 		return false
 	}
 	return true
 }
 
 func (c *ruleListStrCondExactMatchListStrInput) match(ctx context.Context, values interface{}) bool {
+	arr, ok := values.([]string)
+	if !ok {
+		return false
+	}
 	for _, exp := range c.exprs {
-		for _, v := range values.([]string) {
+		for _, v := range arr {
 			if v == exp.value {
 				return true
 			}
@@ -717,8 +822,12 @@ func (c *ruleListStrCondExactMatchListStrInput) match(ctx context.Context, value
 }
 
 func (c *ruleListStrCondPartialMatchListStrInput) match(ctx context.Context, values interface{}) bool {
+	arr, ok := values.([]string)
+	if !ok {
+		return false
+	}
 	for _, exp := range c.exprs {
-		for _, v := range values.([]string) {
+		for _, v := range arr {
 			if strings.Contains(v, exp.value) {
 				return true
 			}
@@ -728,8 +837,12 @@ func (c *ruleListStrCondPartialMatchListStrInput) match(ctx context.Context, val
 }
 
 func (c *ruleListStrCondPrefixMatchListStrInput) match(ctx context.Context, values interface{}) bool {
+	arr, ok := values.([]string)
+	if !ok {
+		return false
+	}
 	for _, exp := range c.exprs {
-		for _, v := range values.([]string) {
+		for _, v := range arr {
 			if strings.HasPrefix(v, exp.value) {
 				return true
 			}
@@ -739,8 +852,12 @@ func (c *ruleListStrCondPrefixMatchListStrInput) match(ctx context.Context, valu
 }
 
 func (c *ruleListStrCondSuffixMatchListStrInput) match(ctx context.Context, values interface{}) bool {
+	arr, ok := values.([]string)
+	if !ok {
+		return false
+	}
 	for _, exp := range c.exprs {
-		for _, v := range values.([]string) {
+		for _, v := range arr {
 			if strings.HasSuffix(v, exp.value) {
 				return true
 			}
@@ -750,8 +867,12 @@ func (c *ruleListStrCondSuffixMatchListStrInput) match(ctx context.Context, valu
 }
 
 func (c *ruleListStrCondRegexMatchListStrInput) match(ctx context.Context, values interface{}) bool {
+	arr, ok := values.([]string)
+	if !ok {
+		return false
+	}
 	for _, exp := range c.exprs {
-		for _, v := range values.([]string) {
+		for _, v := range arr {
 			if exp.MatchString(v) {
 				return true
 			}
@@ -761,7 +882,11 @@ func (c *ruleListStrCondRegexMatchListStrInput) match(ctx context.Context, value
 }
 
 func (c *ruleStrCondExactMatchListStrInput) match(ctx context.Context, values interface{}) bool {
-	for _, v := range values.([]string) {
+	arr, ok := values.([]string)
+	if !ok {
+		return false
+	}
+	for _, v := range arr {
 		if v == c.expr.value {
 			return true
 		}
@@ -770,7 +895,11 @@ func (c *ruleStrCondExactMatchListStrInput) match(ctx context.Context, values in
 }
 
 func (c *ruleStrCondPartialMatchListStrInput) match(ctx context.Context, values interface{}) bool {
-	for _, v := range values.([]string) {
+	arr, ok := values.([]string)
+	if !ok {
+		return false
+	}
+	for _, v := range arr {
 		if strings.Contains(v, c.expr.value) {
 			return true
 		}
@@ -779,7 +908,11 @@ func (c *ruleStrCondPartialMatchListStrInput) match(ctx context.Context, values
 }
 
 func (c *ruleStrCondPrefixMatchListStrInput) match(ctx context.Context, values interface{}) bool {
-	for _, v := range values.([]string) {
+	arr, ok := values.([]string)
+	if !ok {
+		return false
+	}
+	for _, v := range arr {
 		if strings.HasPrefix(v, c.expr.value) {
 			return true
 		}
@@ -788,7 +921,11 @@ func (c *ruleStrCondPrefixMatchListStrInput) match(ctx context.Context, values i
 }
 
 func (c *ruleStrCondSuffixMatchListStrInput) match(ctx context.Context, values interface{}) bool {
-	for _, v := range values.([]string) {
+	arr, ok := values.([]string)
+	if !ok {
+		return false
+	}
+	for _, v := range arr {
 		if strings.HasSuffix(v, c.expr.value) {
 			return true
 		}
@@ -797,7 +934,11 @@ func (c *ruleStrCondSuffixMatchListStrInput) match(ctx context.Context, values i
 }
 
 func (c *ruleStrCondRegexMatchListStrInput) match(ctx context.Context, values interface{}) bool {
-	for _, v := range values.([]string) {
+	arr, ok := values.([]string)
+	if !ok {
+		return false
+	}
+	for _, v := range arr {
 		if c.expr.MatchString(v) {
 			return true
 		}
@@ -806,8 +947,12 @@ func (c *ruleStrCondRegexMatchListStrInput) match(ctx context.Context, values in
 }
 
 func (c *ruleListStrCondExactMatchStrInput) match(ctx context.Context, v interface{}) bool {
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
 	for _, exp := range c.exprs {
-		if v.(string) == exp.value {
+		if s == exp.value {
 			return true
 		}
 	}
@@ -815,8 +960,12 @@ func (c *ruleListStrCondExactMatchStrInput) match(ctx context.Context, v interfa
 }
 
 func (c *ruleListStrCondPartialMatchStrInput) match(ctx context.Context, v interface{}) bool {
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
 	for _, exp := range c.exprs {
-		if strings.Contains(v.(string), exp.value) {
+		if strings.Contains(s, exp.value) {
 			return true
 		}
 	}
@@ -824,8 +973,12 @@ func (c *ruleListStrCondPartialMatchStrInput) match(ctx context.Context, v inter
 }
 
 func (c *ruleListStrCondPrefixMatchStrInput) match(ctx context.Context, v interface{}) bool {
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
 	for _, exp := range c.exprs {
-		if strings.HasPrefix(v.(string), exp.value) {
+		if strings.HasPrefix(s, exp.value) {
 			return true
 		}
 	}
@@ -833,8 +986,12 @@ func (c *ruleListStrCondPrefixMatchStrInput) match(ctx context.Context, v interf
 }
 
 func (c *ruleListStrCondSuffixMatchStrInput) match(ctx context.Context, v interface{}) bool {
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
 	for _, exp := range c.exprs {
-		if strings.HasSuffix(v.(string), exp.value) {
+		if strings.HasSuffix(s, exp.value) {
 			return true
 		}
 	}
@@ -842,8 +999,12 @@ func (c *ruleListStrCondSuffixMatchStrInput) match(ctx context.Context, v interf
 }
 
 func (c *ruleListStrCondRegexMatchStrInput) match(ctx context.Context, v interface{}) bool {
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
 	for _, exp := range c.exprs {
-		if exp.MatchString(v.(string)) {
+		if exp.MatchString(s) {
 			return true
 		}
 	}
@@ -851,35 +1012,55 @@ func (c *ruleListStrCondRegexMatchStrInput) match(ctx context.Context, v interfa
 }
 
 func (c *ruleStrCondExactMatchStrInput) match(ctx context.Context, v interface{}) bool {
-	if v.(string) == c.expr.value {
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
+	if s == c.expr.value {
 		return true
 	}
 	return false
 }
 
 func (c *ruleStrCondPartialMatchStrInput) match(ctx context.Context, v interface{}) bool {
-	if strings.Contains(v.(string), c.expr.value) {
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
+	if strings.Contains(s, c.expr.value) {
 		return true
 	}
 	return false
 }
 
 func (c *ruleStrCondPrefixMatchStrInput) match(ctx context.Context, v interface{}) bool {
-	if strings.HasPrefix(v.(string), c.expr.value) {
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
+	if strings.HasPrefix(s, c.expr.value) {
 		return true
 	}
 	return false
 }
 
 func (c *ruleStrCondSuffixMatchStrInput) match(ctx context.Context, v interface{}) bool {
-	if strings.HasSuffix(v.(string), c.expr.value) {
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
+	if strings.HasSuffix(s, c.expr.value) {
 		return true
 	}
 	return false
 }
 
 func (c *ruleStrCondRegexMatchStrInput) match(ctx context.Context, v interface{}) bool {
-	if c.expr.MatchString(v.(string)) {
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
+	if c.expr.MatchString(s) {
 		return true
 	}
 	return false
@@ -1046,7 +1227,7 @@ func (c *ruleStrCondRegexMatchStrInput) getConfig(ctx context.Context) *config {
 }
 
 func init() {
-	matchWithStrategyRgx = regexp.MustCompile(`^\s*((?P<negative_match>no)\s)?((?P<match_strategy>exact|partial|prefix|suffix|regex)\s)?match\s*((?P<match_any>any)\s)?`)
+	matchWithStrategyRgx = regexp.MustCompile(`^\s*((?P<negative_match>no)\s)?((?P<match_strategy>exact|partial|prefix|suffix|regex|cidr|time|newer|older|gt|ge|lt|le|eq)\s)?match\s*((?P<match_any>any)\s)?`)
 	matchFieldRgx = regexp.MustCompile(`^\s*field\s+(?P<field_name>\S+)\s+(?P<field_exists>exists|not\s+exists)\s*$`)
 }
 
@@ -1082,6 +1263,24 @@ func extractMatchStrategy(s string) fieldMatchStrategy {
 		return fieldFound
 	case "not exists":
 		return fieldNotFound
+	case "cidr":
+		return fieldMatchCIDR
+	case "time":
+		return fieldMatchTimeWindow
+	case "newer":
+		return fieldMatchNewer
+	case "older":
+		return fieldMatchOlder
+	case "gt":
+		return fieldMatchGreater
+	case "ge":
+		return fieldMatchGreaterOrEqual
+	case "lt":
+		return fieldMatchLess
+	case "le":
+		return fieldMatchLessOrEqual
+	case "eq":
+		return fieldMatchEqual
 	}
 	return fieldMatchUnknown
 }
@@ -1112,6 +1311,9 @@ func extractFieldNameValues(arr []string) (string, []string) {
 		if alias, exists := inputDataAliases[k]; exists {
 			k = alias
 		}
+		if isRequestField(k) {
+			k = normalizeRequestField(k)
+		}
 	}
 	return k, v
 }
@@ -1149,6 +1351,9 @@ func extractInputDataType(fieldName string) dataType {
 	if tp, exists := inputDataTypes[fieldName]; exists {
 		return tp
 	}
+	if strings.HasPrefix(fieldName, requestHeaderFieldPrefix) || strings.HasPrefix(fieldName, requestQueryFieldPrefix) {
+		return dataTypeListStr
+	}
 	return dataTypeAny
 }
 
@@ -1180,6 +1385,9 @@ func newACLRuleCondition(ctx context.Context, tokens []string) (aclRuleCondition
 					if alias, exists := inputDataAliases[fieldName]; exists {
 						fieldName = alias
 					}
+					if isRequestField(fieldName) {
+						fieldName = normalizeRequestField(fieldName)
+					}
 				}
 			}
 		}
@@ -1215,6 +1423,13 @@ func newACLRuleCondition(ctx context.Context, tokens []string) (aclRuleCondition
 		return nil, errors.ErrACLRuleConditionSyntaxStrategyNotFound.WithArgs(line)
 	}
 
+	if isTypedMatchStrategy(matchStrategy) {
+		if err := validateFieldNameValues(line, fieldName, values); err != nil {
+			return nil, err
+		}
+		return newTypedACLRuleCondition(line, fieldName, values, matchStrategy, negativeMatch, matchAny)
+	}
+
 	switch matchStrategy {
 	case fieldMatchAlways, fieldFound, fieldNotFound:
 	default:
@@ -2314,6 +2529,24 @@ func getMatchStrategyName(s fieldMatchStrategy) string {
 		return "fieldMatchAlways"
 	case fieldMatchReserved:
 		return "fieldMatchReserved"
+	case fieldMatchCIDR:
+		return "fieldMatchCIDR"
+	case fieldMatchTimeWindow:
+		return "fieldMatchTimeWindow"
+	case fieldMatchNewer:
+		return "fieldMatchNewer"
+	case fieldMatchOlder:
+		return "fieldMatchOlder"
+	case fieldMatchGreater:
+		return "fieldMatchGreater"
+	case fieldMatchGreaterOrEqual:
+		return "fieldMatchGreaterOrEqual"
+	case fieldMatchLess:
+		return "fieldMatchLess"
+	case fieldMatchLessOrEqual:
+		return "fieldMatchLessOrEqual"
+	case fieldMatchEqual:
+		return "fieldMatchEqual"
 	}
 	return "fieldMatchUnknown"
 }
@@ -2325,6 +2558,14 @@ func getDataTypeName(s dataType) string {
 		return "dataTypeStr"
 	case dataTypeAny:
 		return "dataTypeAny"
+	case dataTypeNetwork:
+		return "dataTypeNetwork"
+	case dataTypeTimeWindow:
+		return "dataTypeTimeWindow"
+	case dataTypeDuration:
+		return "dataTypeDuration"
+	case dataTypeNumber:
+		return "dataTypeNumber"
 	}
 	return "dataTypeUnknown"
 }
@@ -0,0 +1,566 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+)
+
+// clockField is the input field holding the time of the evaluation. The
+// access list adds it to the input when a rule refers to it.
+const clockField = "now"
+
+var (
+	timeNow = time.Now
+
+	timeRangeRgx = regexp.MustCompile(`^([01]?[0-9]|2[0-3]):([0-5][0-9])-([01]?[0-9]|2[0-4]):([0-5][0-9])$`)
+	durationRgx  = regexp.MustCompile(`^([0-9]+)d$`)
+
+	weekdays = map[string]time.Weekday{
+		"sun": time.Sunday,
+		"mon": time.Monday,
+		"tue": time.Tuesday,
+		"wed": time.Wednesday,
+		"thu": time.Thursday,
+		"fri": time.Friday,
+		"sat": time.Saturday,
+	}
+)
+
+// timeWindow is a recurring window of time, e.g. from 08:00 to 18:00 on
+// weekdays in a particular time zone.
+type timeWindow struct {
+	days     map[time.Weekday]bool
+	ranges   [][2]int
+	location *time.Location
+}
+
+// ruleNetworkCondCIDRMatchAnyInput matches an input IP address, or a list of
+// them, against a list of networks where any of the input addresses belongs
+// to at least one of the networks.
+type ruleNetworkCondCIDRMatchAnyInput struct {
+	field  *field
+	exprs  []*net.IPNet
+	config *config
+}
+
+// ruleNetworkCondCIDRNegativeMatchAnyInput not matches an input IP address, or
+// a list of them, against a list of networks where none of the input
+// addresses belongs to any of the networks.
+type ruleNetworkCondCIDRNegativeMatchAnyInput struct {
+	field  *field
+	exprs  []*net.IPNet
+	config *config
+}
+
+// ruleTimeWindowCondMatchAnyInput matches an input time against a time
+// window.
+type ruleTimeWindowCondMatchAnyInput struct {
+	field  *field
+	expr   *timeWindow
+	config *config
+}
+
+// ruleTimeWindowCondNegativeMatchAnyInput not matches an input time against a
+// time window.
+type ruleTimeWindowCondNegativeMatchAnyInput struct {
+	field  *field
+	expr   *timeWindow
+	config *config
+}
+
+// ruleDurationCondNewerMatchAnyInput matches an input timestamp that is
+// newer than the duration condition.
+type ruleDurationCondNewerMatchAnyInput struct {
+	field  *field
+	expr   time.Duration
+	config *config
+}
+
+// ruleDurationCondNewerNegativeMatchAnyInput not matches an input timestamp
+// that is newer than the duration condition.
+type ruleDurationCondNewerNegativeMatchAnyInput struct {
+	field  *field
+	expr   time.Duration
+	config *config
+}
+
+// ruleDurationCondOlderMatchAnyInput matches an input timestamp that is
+// older than the duration condition.
+type ruleDurationCondOlderMatchAnyInput struct {
+	field  *field
+	expr   time.Duration
+	config *config
+}
+
+// ruleDurationCondOlderNegativeMatchAnyInput not matches an input timestamp
+// that is older than the duration condition.
+type ruleDurationCondOlderNegativeMatchAnyInput struct {
+	field  *field
+	expr   time.Duration
+	config *config
+}
+
+// ruleNumberCondCompareMatchAnyInput compares an input number against a
+// number condition.
+type ruleNumberCondCompareMatchAnyInput struct {
+	field  *field
+	expr   float64
+	config *config
+}
+
+// ruleNumberCondCompareNegativeMatchAnyInput not compares an input number
+// against a number condition.
+type ruleNumberCondCompareNegativeMatchAnyInput struct {
+	field  *field
+	expr   float64
+	config *config
+}
+
+func (c *ruleNetworkCondCIDRMatchAnyInput) match(ctx context.Context, v interface{}) bool {
+	return matchNetworks(c.exprs, v)
+}
+
+func (c *ruleNetworkCondCIDRNegativeMatchAnyInput) match(ctx context.Context, v interface{}) bool {
+	return !matchNetworks(c.exprs, v)
+}
+
+func (c *ruleTimeWindowCondMatchAnyInput) match(ctx context.Context, v interface{}) bool {
+	return matchTimeWindow(c.expr, v)
+}
+
+func (c *ruleTimeWindowCondNegativeMatchAnyInput) match(ctx context.Context, v interface{}) bool {
+	return !matchTimeWindow(c.expr, v)
+}
+
+func (c *ruleDurationCondNewerMatchAnyInput) match(ctx context.Context, v interface{}) bool {
+	return matchNewer(c.expr, v)
+}
+
+func (c *ruleDurationCondNewerNegativeMatchAnyInput) match(ctx context.Context, v interface{}) bool {
+	return !matchNewer(c.expr, v)
+}
+
+func (c *ruleDurationCondOlderMatchAnyInput) match(ctx context.Context, v interface{}) bool {
+	return matchOlder(c.expr, v)
+}
+
+func (c *ruleDurationCondOlderNegativeMatchAnyInput) match(ctx context.Context, v interface{}) bool {
+	return !matchOlder(c.expr, v)
+}
+
+func (c *ruleNumberCondCompareMatchAnyInput) match(ctx context.Context, v interface{}) bool {
+	return compareNumber(c.config.matchStrategy, c.expr, v)
+}
+
+func (c *ruleNumberCondCompareNegativeMatchAnyInput) match(ctx context.Context, v interface{}) bool {
+	return !compareNumber(c.config.matchStrategy, c.expr, v)
+}
+
+func (c *ruleNetworkCondCIDRMatchAnyInput) getConfig(ctx context.Context) *config {
+	return c.config
+}
+
+func (c *ruleNetworkCondCIDRNegativeMatchAnyInput) getConfig(ctx context.Context) *config {
+	return c.config
+}
+
+func (c *ruleTimeWindowCondMatchAnyInput) getConfig(ctx context.Context) *config {
+	return c.config
+}
+
+func (c *ruleTimeWindowCondNegativeMatchAnyInput) getConfig(ctx context.Context) *config {
+	return c.config
+}
+
+func (c *ruleDurationCondNewerMatchAnyInput) getConfig(ctx context.Context) *config {
+	return c.config
+}
+
+func (c *ruleDurationCondNewerNegativeMatchAnyInput) getConfig(ctx context.Context) *config {
+	return c.config
+}
+
+func (c *ruleDurationCondOlderMatchAnyInput) getConfig(ctx context.Context) *config {
+	return c.config
+}
+
+func (c *ruleDurationCondOlderNegativeMatchAnyInput) getConfig(ctx context.Context) *config {
+	return c.config
+}
+
+func (c *ruleNumberCondCompareMatchAnyInput) getConfig(ctx context.Context) *config {
+	return c.config
+}
+
+func (c *ruleNumberCondCompareNegativeMatchAnyInput) getConfig(ctx context.Context) *config {
+	return c.config
+}
+
+func isTypedMatchStrategy(s fieldMatchStrategy) bool {
+	switch s {
+	case fieldMatchCIDR, fieldMatchTimeWindow, fieldMatchNewer, fieldMatchOlder,
+		fieldMatchGreater, fieldMatchGreaterOrEqual, fieldMatchLess, fieldMatchLessOrEqual, fieldMatchEqual:
+		return true
+	}
+	return false
+}
+
+// newTypedACLRuleCondition returns the conditions matching IP addresses,
+// times, timestamps, and numbers. The conditions accept input of any type,
+// e.g. the numeric claims, and do not match the input they fail to parse.
+func newTypedACLRuleCondition(line, fieldName string, values []string, matchStrategy fieldMatchStrategy, negativeMatch, matchAny bool) (aclRuleCondition, error) {
+	cfg := &config{
+		field:         fieldName,
+		matchStrategy: matchStrategy,
+		values:        values,
+		inputDataType: dataTypeAny,
+		matchAny:      matchAny,
+	}
+	fld := &field{
+		name:   fieldName,
+		length: len(fieldName),
+	}
+
+	switch matchStrategy {
+	case fieldMatchCIDR:
+		cfg.exprDataType = dataTypeNetwork
+		var exprs []*net.IPNet
+		for _, value := range values {
+			network, err := parseNetwork(value)
+			if err != nil {
+				return nil, errors.ErrACLRuleConditionSyntaxInvalidNetwork.WithArgs(value, line)
+			}
+			exprs = append(exprs, network)
+		}
+		if negativeMatch {
+			cfg.conditionType = `ruleNetworkCondCIDRNegativeMatchAnyInput`
+			return &ruleNetworkCondCIDRNegativeMatchAnyInput{field: fld, exprs: exprs, config: cfg}, nil
+		}
+		cfg.conditionType = `ruleNetworkCondCIDRMatchAnyInput`
+		return &ruleNetworkCondCIDRMatchAnyInput{field: fld, exprs: exprs, config: cfg}, nil
+	case fieldMatchTimeWindow:
+		cfg.exprDataType = dataTypeTimeWindow
+		window, err := parseTimeWindow(values)
+		if err != nil {
+			return nil, errors.ErrACLRuleConditionSyntaxInvalidTimeWindow.WithArgs(strings.Join(values, " "), err)
+		}
+		if negativeMatch {
+			cfg.conditionType = `ruleTimeWindowCondNegativeMatchAnyInput`
+			return &ruleTimeWindowCondNegativeMatchAnyInput{field: fld, expr: window, config: cfg}, nil
+		}
+		cfg.conditionType = `ruleTimeWindowCondMatchAnyInput`
+		return &ruleTimeWindowCondMatchAnyInput{field: fld, expr: window, config: cfg}, nil
+	}
+
+	if len(values) != 1 {
+		return nil, errors.ErrACLRuleConditionSyntaxSingleValue.WithArgs(line)
+	}
+
+	switch matchStrategy {
+	case fieldMatchNewer, fieldMatchOlder:
+		cfg.exprDataType = dataTypeDuration
+		d, err := parseDuration(values[0])
+		if err != nil {
+			return nil, errors.ErrACLRuleConditionSyntaxInvalidDuration.WithArgs(values[0], err)
+		}
+		switch {
+		case matchStrategy == fieldMatchNewer && negativeMatch:
+			cfg.conditionType = `ruleDurationCondNewerNegativeMatchAnyInput`
+			return &ruleDurationCondNewerNegativeMatchAnyInput{field: fld, expr: d, config: cfg}, nil
+		case matchStrategy == fieldMatchNewer:
+			cfg.conditionType = `ruleDurationCondNewerMatchAnyInput`
+			return &ruleDurationCondNewerMatchAnyInput{field: fld, expr: d, config: cfg}, nil
+		case negativeMatch:
+			cfg.conditionType = `ruleDurationCondOlderNegativeMatchAnyInput`
+			return &ruleDurationCondOlderNegativeMatchAnyInput{field: fld, expr: d, config: cfg}, nil
+		}
+		cfg.conditionType = `ruleDurationCondOlderMatchAnyInput`
+		return &ruleDurationCondOlderMatchAnyInput{field: fld, expr: d, config: cfg}, nil
+	}
+
+	cfg.exprDataType = dataTypeNumber
+	n, err := strconv.ParseFloat(values[0], 64)
+	if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+		return nil, errors.ErrACLRuleConditionSyntaxInvalidNumber.WithArgs(values[0], line)
+	}
+	if negativeMatch {
+		cfg.conditionType = `ruleNumberCondCompareNegativeMatchAnyInput`
+		return &ruleNumberCondCompareNegativeMatchAnyInput{field: fld, expr: n, config: cfg}, nil
+	}
+	cfg.conditionType = `ruleNumberCondCompareMatchAnyInput`
+	return &ruleNumberCondCompareMatchAnyInput{field: fld, expr: n, config: cfg}, nil
+}
+
+// parseNetwork parses a network in CIDR notation, or a single IP address.
+func parseNetwork(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, network, err := net.ParseCIDR(s)
+		return network, err
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address")
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// parseTimeWindow parses the days of the week, e.g. mon-fri or sat,sun, the
+// time ranges, e.g. 08:00-18:00, and the time zone, e.g. Europe/Berlin. The
+// default time zone is UTC.
+func parseTimeWindow(values []string) (*timeWindow, error) {
+	window := &timeWindow{
+		location: time.UTC,
+	}
+	var locationFound bool
+	for _, value := range values {
+		s := strings.ToLower(value)
+		switch {
+		case timeRangeRgx.MatchString(s):
+			m := timeRangeRgx.FindStringSubmatch(s)
+			start, _ := strconv.Atoi(m[1])
+			startMin, _ := strconv.Atoi(m[2])
+			end, _ := strconv.Atoi(m[3])
+			endMin, _ := strconv.Atoi(m[4])
+			r := [2]int{start*60 + startMin, end*60 + endMin}
+			if r[1] > 24*60 {
+				return nil, fmt.Errorf("time range %q ends after 24:00", value)
+			}
+			window.ranges = append(window.ranges, r)
+		case isWeekdaySpec(s):
+			if window.days == nil {
+				window.days = make(map[time.Weekday]bool)
+			}
+			if err := addWeekdays(window.days, s); err != nil {
+				return nil, err
+			}
+		default:
+			if locationFound {
+				return nil, fmt.Errorf("unsupported value %q", value)
+			}
+			loc, err := time.LoadLocation(value)
+			if err != nil {
+				return nil, err
+			}
+			window.location = loc
+			locationFound = true
+		}
+	}
+	if window.days == nil && window.ranges == nil {
+		return nil, fmt.Errorf("no days or time ranges found")
+	}
+	return window, nil
+}
+
+func isWeekdaySpec(s string) bool {
+	for _, day := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '-' }) {
+		if _, exists := weekdays[day]; !exists {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// addWeekdays adds the days of the week, e.g. mon-fri, or sat,sun. The
+// ranges may wrap around the end of the week, e.g. fri-mon.
+func addWeekdays(days map[time.Weekday]bool, s string) error {
+	for _, spec := range strings.Split(s, ",") {
+		arr := strings.Split(spec, "-")
+		switch len(arr) {
+		case 1:
+			days[weekdays[arr[0]]] = true
+		case 2:
+			for d := weekdays[arr[0]]; ; d = (d + 1) % 7 {
+				days[d] = true
+				if d == weekdays[arr[1]] {
+					break
+				}
+			}
+		default:
+			return fmt.Errorf("invalid days of the week %q", spec)
+		}
+	}
+	return nil
+}
+
+// parseDuration parses a Go duration, e.g. 90m, or a number of days, e.g.
+// 30d.
+func parseDuration(s string) (time.Duration, error) {
+	if m := durationRgx.FindStringSubmatch(s); m != nil {
+		days, err := strconv.Atoi(m[1])
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("negative duration")
+	}
+	return d, nil
+}
+
+func matchNetworks(networks []*net.IPNet, v interface{}) bool {
+	var addrs []string
+	switch val := v.(type) {
+	case string:
+		addrs = append(addrs, val)
+	case []string:
+		addrs = val
+	case []interface{}:
+		for _, entry := range val {
+			if s, ok := entry.(string); ok {
+				addrs = append(addrs, s)
+			}
+		}
+	}
+	for _, addr := range addrs {
+		ip := net.ParseIP(strings.TrimSpace(addr))
+		if ip == nil {
+			continue
+		}
+		for _, network := range networks {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchTimeWindow(window *timeWindow, v interface{}) bool {
+	t, ok := toTime(v)
+	if !ok {
+		return false
+	}
+	t = t.In(window.location)
+	if window.days != nil && !window.days[t.Weekday()] {
+		return false
+	}
+	if window.ranges == nil {
+		return true
+	}
+	minutes := t.Hour()*60 + t.Minute()
+	for _, r := range window.ranges {
+		if r[0] <= r[1] {
+			if minutes >= r[0] && minutes < r[1] {
+				return true
+			}
+			continue
+		}
+		// The range spans midnight, e.g. 22:00-06:00.
+		if minutes >= r[0] || minutes < r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+func matchNewer(d time.Duration, v interface{}) bool {
+	t, ok := toTime(v)
+	if !ok {
+		return false
+	}
+	return t.After(timeNow().Add(-d))
+}
+
+func matchOlder(d time.Duration, v interface{}) bool {
+	t, ok := toTime(v)
+	if !ok {
+		return false
+	}
+	return t.Before(timeNow().Add(-d))
+}
+
+func compareNumber(s fieldMatchStrategy, expr float64, v interface{}) bool {
+	n, ok := toNumber(v)
+	if !ok {
+		return false
+	}
+	switch s {
+	case fieldMatchGreater:
+		return n > expr
+	case fieldMatchGreaterOrEqual:
+		return n >= expr
+	case fieldMatchLess:
+		return n < expr
+	case fieldMatchLessOrEqual:
+		return n <= expr
+	case fieldMatchEqual:
+		return n == expr
+	}
+	return false
+}
+
+// toTime converts the input to time. The numbers are the seconds since
+// Unix epoch, as in the exp, iat, and nbf claims.
+func toTime(v interface{}) (time.Time, bool) {
+	if t, ok := v.(time.Time); ok {
+		return t, true
+	}
+	n, ok := toNumber(v)
+	if !ok {
+		return time.Time{}, false
+	}
+	sec, frac := math.Modf(n)
+	return time.Unix(int64(sec), int64(frac*1e9)), true
+}
+
+func toNumber(v interface{}) (float64, bool) {
+	switch val := v.(type) {
+	case float64:
+		return val, true
+	case float32:
+		return float64(val), true
+	case int:
+		return float64(val), true
+	case int32:
+		return float64(val), true
+	case int64:
+		return float64(val), true
+	case uint:
+		return float64(val), true
+	case uint32:
+		return float64(val), true
+	case uint64:
+		return float64(val), true
+	case json.Number:
+		n, err := val.Float64()
+		return n, err == nil
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+		if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+			return 0, false
+		}
+		return n, true
+	}
+	return 0, false
+}
@@ -0,0 +1,343 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/greenpau/go-authcrunch/internal/tests"
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+)
+
+func TestNewTypedAclRuleCondition(t *testing.T) {
+	var testcases = []struct {
+		name      string
+		condition string
+		want      map[string]interface{}
+		shouldErr bool
+		err       error
+	}{
+		{
+			name:      "cidr match ip address in addr field",
+			condition: `cidr match addr 10.0.0.0/8 192.168.1.1 2001:db8::/32`,
+			want: map[string]interface{}{
+				"condition_type":  "*acl.ruleNetworkCondCIDRMatchAnyInput",
+				"field_name":      "addr",
+				"match_strategy":  "fieldMatchCIDR",
+				"expr_data_type":  "dataTypeNetwork",
+				"input_data_type": "dataTypeAny",
+				"values":          []string{`10.0.0.0/8`, `192.168.1.1`, `2001:db8::/32`},
+			},
+		},
+		{
+			name:      "negative cidr match ip address in addr field",
+			condition: `no cidr match addr 10.0.0.0/8`,
+			want: map[string]interface{}{
+				"condition_type":  "*acl.ruleNetworkCondCIDRNegativeMatchAnyInput",
+				"field_name":      "addr",
+				"match_strategy":  "fieldMatchCIDR",
+				"expr_data_type":  "dataTypeNetwork",
+				"input_data_type": "dataTypeAny",
+				"values":          []string{`10.0.0.0/8`},
+			},
+		},
+		{
+			name:      "time window match current time",
+			condition: `time match now mon-fri 08:00-18:00 Europe/Berlin`,
+			want: map[string]interface{}{
+				"condition_type":  "*acl.ruleTimeWindowCondMatchAnyInput",
+				"field_name":      "now",
+				"match_strategy":  "fieldMatchTimeWindow",
+				"expr_data_type":  "dataTypeTimeWindow",
+				"input_data_type": "dataTypeAny",
+				"values":          []string{`mon-fri`, `08:00-18:00`, `Europe/Berlin`},
+			},
+		},
+		{
+			name:      "negative time window match current time",
+			condition: `no time match now 08:00-18:00`,
+			want: map[string]interface{}{
+				"condition_type":  "*acl.ruleTimeWindowCondNegativeMatchAnyInput",
+				"field_name":      "now",
+				"match_strategy":  "fieldMatchTimeWindow",
+				"expr_data_type":  "dataTypeTimeWindow",
+				"input_data_type": "dataTypeAny",
+				"values":          []string{`08:00-18:00`},
+			},
+		},
+		{
+			name:      "newer match iat field",
+			condition: `newer match iat 1h`,
+			want: map[string]interface{}{
+				"condition_type":  "*acl.ruleDurationCondNewerMatchAnyInput",
+				"field_name":      "iat",
+				"match_strategy":  "fieldMatchNewer",
+				"expr_data_type":  "dataTypeDuration",
+				"input_data_type": "dataTypeAny",
+				"values":          []string{`1h`},
+			},
+		},
+		{
+			name:      "negative older match iat field",
+			condition: `no older match iat 30d`,
+			want: map[string]interface{}{
+				"condition_type":  "*acl.ruleDurationCondOlderNegativeMatchAnyInput",
+				"field_name":      "iat",
+				"match_strategy":  "fieldMatchOlder",
+				"expr_data_type":  "dataTypeDuration",
+				"input_data_type": "dataTypeAny",
+				"values":          []string{`30d`},
+			},
+		},
+		{
+			name:      "greater or equal match custom numeric field",
+			condition: `ge match level 3`,
+			want: map[string]interface{}{
+				"condition_type":  "*acl.ruleNumberCondCompareMatchAnyInput",
+				"field_name":      "level",
+				"match_strategy":  "fieldMatchGreaterOrEqual",
+				"expr_data_type":  "dataTypeNumber",
+				"input_data_type": "dataTypeAny",
+				"values":          []string{`3`},
+			},
+		},
+		{
+			name:      "negative equal match custom numeric field",
+			condition: `no eq match level 0.5`,
+			want: map[string]interface{}{
+				"condition_type":  "*acl.ruleNumberCondCompareNegativeMatchAnyInput",
+				"field_name":      "level",
+				"match_strategy":  "fieldMatchEqual",
+				"expr_data_type":  "dataTypeNumber",
+				"input_data_type": "dataTypeAny",
+				"values":          []string{`0.5`},
+			},
+		},
+		{
+			name:      "invalid network",
+			condition: `cidr match addr 10.0.0.0/33`,
+			shouldErr: true,
+			err:       errors.ErrACLRuleConditionSyntaxInvalidNetwork.WithArgs("10.0.0.0/33", "cidr match addr 10.0.0.0/33"),
+		},
+		{
+			name:      "invalid time window",
+			condition: `time match now 08:00-25:00`,
+			shouldErr: true,
+			err:       errors.ErrACLRuleConditionSyntaxInvalidTimeWindow.WithArgs("08:00-25:00", fmt.Errorf("unknown time zone 08:00-25:00")),
+		},
+		{
+			name:      "time window with two time zones",
+			condition: `time match now 08:00-18:00 UTC Europe/Berlin`,
+			shouldErr: true,
+			err:       errors.ErrACLRuleConditionSyntaxInvalidTimeWindow.WithArgs("08:00-18:00 UTC Europe/Berlin", fmt.Errorf("unsupported value \"Europe/Berlin\"")),
+		},
+		{
+			name:      "invalid duration",
+			condition: `newer match iat foo`,
+			shouldErr: true,
+			err:       errors.ErrACLRuleConditionSyntaxInvalidDuration.WithArgs("foo", fmt.Errorf("time: invalid duration \"foo\"")),
+		},
+		{
+			name:      "invalid number",
+			condition: `gt match level foo`,
+			shouldErr: true,
+			err:       errors.ErrACLRuleConditionSyntaxInvalidNumber.WithArgs("foo", "gt match level foo"),
+		},
+		{
+			name:      "number comparison with multiple values",
+			condition: `lt match level 1 2`,
+			shouldErr: true,
+			err:       errors.ErrACLRuleConditionSyntaxSingleValue.WithArgs("lt match level 1 2"),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			cond, err := newACLRuleCondition(context.Background(), strings.Split(tc.condition, " "))
+			if tests.EvalErrWithLog(t, err, tc.condition, tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			condConfig := cond.getConfig(context.Background())
+			got := make(map[string]interface{})
+			got["field_name"] = condConfig.field
+			got["condition_type"] = reflect.TypeOf(cond).String()
+			got["match_strategy"] = getMatchStrategyName(condConfig.matchStrategy)
+			got["expr_data_type"] = getDataTypeName(condConfig.exprDataType)
+			got["input_data_type"] = getDataTypeName(condConfig.inputDataType)
+			got["values"] = condConfig.values
+			tests.EvalObjectsWithLog(t, "output", tc.want, got, msgs)
+		})
+	}
+}
+
+func TestMatchTypedAclRuleCondition(t *testing.T) {
+	// Wednesday, 12:30 in Europe/Berlin.
+	now := time.Date(2022, time.March, 2, 11, 30, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	var testcases = []struct {
+		name      string
+		condition string
+		data      interface{}
+		want      bool
+	}{
+		{name: "ip address in network", condition: `cidr match addr 10.0.0.0/8`, data: "10.1.2.3", want: true},
+		{name: "ip address not in network", condition: `cidr match addr 10.0.0.0/8`, data: "192.168.1.1", want: false},
+		{name: "ip address matches single address", condition: `cidr match addr 10.0.0.0/8 192.168.1.1`, data: "192.168.1.1", want: true},
+		{name: "ipv6 address in network", condition: `cidr match addr 2001:db8::/32`, data: "2001:db8::1", want: true},
+		{name: "list of ip addresses in network", condition: `cidr match addr 10.0.0.0/8`, data: []interface{}{"192.168.1.1", "10.1.2.3"}, want: true},
+		{name: "invalid ip address", condition: `cidr match addr 10.0.0.0/8`, data: "foo", want: false},
+		{name: "negative match ip address not in network", condition: `no cidr match addr 10.0.0.0/8`, data: "192.168.1.1", want: true},
+		{name: "time in window", condition: `time match now mon-fri 08:00-18:00 Europe/Berlin`, data: now, want: true},
+		{name: "time outside of window in time zone", condition: `time match now 08:00-12:00 Europe/Berlin`, data: now, want: false},
+		{name: "time outside of days", condition: `time match now sat,sun`, data: now, want: false},
+		{name: "time in wrapped days", condition: `time match now sun-wed`, data: now, want: true},
+		{name: "time in overnight window", condition: `time match now 22:00-12:00`, data: now, want: true},
+		{name: "time in second window", condition: `time match now 06:00-08:00 11:00-12:00`, data: now, want: true},
+		{name: "unix timestamp in window", condition: `time match now 11:00-12:00`, data: float64(now.Unix()), want: true},
+		{name: "negative match time outside of window", condition: `no time match now mon-fri 08:00-18:00 Europe/Berlin`, data: now, want: false},
+		{name: "timestamp newer than duration", condition: `newer match iat 1h`, data: float64(now.Add(-30 * time.Minute).Unix()), want: true},
+		{name: "timestamp not newer than duration", condition: `newer match iat 1h`, data: int64(now.Add(-2 * time.Hour).Unix()), want: false},
+		{name: "timestamp older than days", condition: `older match iat 1d`, data: now.Add(-25 * time.Hour).Unix(), want: true},
+		{name: "negative match timestamp newer than duration", condition: `no newer match iat 1h`, data: float64(now.Add(-2 * time.Hour).Unix()), want: true},
+		{name: "invalid timestamp", condition: `newer match iat 1h`, data: "foo", want: false},
+		{name: "number greater or equal", condition: `ge match level 3`, data: float64(3), want: true},
+		{name: "number not greater", condition: `gt match level 3`, data: 3, want: false},
+		{name: "json number less", condition: `lt match level 3`, data: json.Number("2.5"), want: true},
+		{name: "string number less or equal", condition: `le match level 3`, data: "3", want: true},
+		{name: "number equal", condition: `eq match level 3`, data: int64(3), want: true},
+		{name: "negative match number equal", condition: `no eq match level 3`, data: 4, want: true},
+		{name: "invalid number", condition: `ge match level 3`, data: []string{"foo"}, want: false},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			cond, err := newACLRuleCondition(context.Background(), strings.Split(tc.condition, " "))
+			if tests.EvalErrWithLog(t, err, tc.condition, false, nil, msgs) {
+				return
+			}
+			got := map[string]interface{}{"match": cond.match(context.Background(), tc.data)}
+			want := map[string]interface{}{"match": tc.want}
+			tests.EvalObjectsWithLog(t, "match result", want, got, msgs)
+		})
+	}
+}
+
+func TestTypedAccessList(t *testing.T) {
+	now := time.Date(2022, time.March, 2, 11, 30, 0, 0, time.UTC)
+	defer func() { timeNow = time.Now }()
+
+	cfgs := []*RuleConfiguration{
+		{
+			Comment:    "deny outside of business hours",
+			Conditions: []string{"no time match now mon-fri 08:00-18:00 Europe/Berlin"},
+			Action:     `deny stop`,
+		},
+		{
+			Comment: "allow recent sessions from internal network",
+			Conditions: []string{
+				"cidr match addr 10.0.0.0/8",
+				"newer match iat 1h",
+				"ge match level 3",
+			},
+			Action: `allow stop`,
+		},
+	}
+
+	var testcases = []struct {
+		name  string
+		clock time.Time
+		input map[string]interface{}
+		want  bool
+	}{
+		{
+			name: "allow during business hours",
+			input: map[string]interface{}{
+				"addr":  "10.1.2.3",
+				"iat":   now.Add(-10 * time.Minute).Unix(),
+				"level": float64(3),
+			},
+			want: true,
+		},
+		{
+			name:  "deny outside of business hours",
+			clock: now.Add(10 * time.Hour),
+			input: map[string]interface{}{
+				"addr":  "10.1.2.3",
+				"iat":   now.Add(-10 * time.Minute).Unix(),
+				"level": float64(3),
+			},
+			want: false,
+		},
+		{
+			name:  "deny outside of business hours with time in input",
+			clock: now.Add(10 * time.Hour),
+			input: map[string]interface{}{
+				"addr":  "10.1.2.3",
+				"iat":   now.Add(-10 * time.Minute).Unix(),
+				"level": float64(3),
+				"now":   now,
+			},
+			want: false,
+		},
+		{
+			name: "deny old session",
+			input: map[string]interface{}{
+				"addr":  "10.1.2.3",
+				"iat":   now.Add(-2 * time.Hour).Unix(),
+				"level": float64(3),
+			},
+			want: false,
+		},
+		{
+			name: "deny external network",
+			input: map[string]interface{}{
+				"addr":  "192.168.1.1",
+				"iat":   now.Add(-10 * time.Minute).Unix(),
+				"level": float64(3),
+			},
+			want: false,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			clock := now
+			if !tc.clock.IsZero() {
+				clock = tc.clock
+			}
+			timeNow = func() time.Time { return clock }
+			ctx := context.Background()
+			accessList := NewAccessList()
+			if err := accessList.AddRules(ctx, cfgs); err != nil {
+				t.Fatalf("failed adding rules: %v", err)
+			}
+			inputSize := len(tc.input)
+			got := map[string]interface{}{"allow": accessList.Allow(ctx, tc.input)}
+			want := map[string]interface{}{"allow": tc.want}
+			tests.EvalObjectsWithLog(t, "access list", want, got, msgs)
+			if len(tc.input) != inputSize {
+				t.Fatalf("access list modified input: %v", tc.input)
+			}
+		})
+	}
+}
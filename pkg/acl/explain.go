@@ -0,0 +1,139 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acl
+
+import (
+	"context"
+	"fmt"
+
+	cfgutil "github.com/greenpau/go-authcrunch/pkg/util/cfg"
+)
+
+// Explanation is the explanation of the access list decision.
+type Explanation struct {
+	Allow bool `json:"allow,omitempty" xml:"allow,omitempty" yaml:"allow,omitempty"`
+	// Reason is the rule deciding the access, or the default action when no
+	// rule decided it.
+	Reason string            `json:"reason,omitempty" xml:"reason,omitempty" yaml:"reason,omitempty"`
+	Rules  []*RuleEvaluation `json:"rules,omitempty" xml:"rules,omitempty" yaml:"rules,omitempty"`
+}
+
+// RuleEvaluation is the evaluation of a rule of the access list.
+type RuleEvaluation struct {
+	Tag        string                 `json:"tag,omitempty" xml:"tag,omitempty" yaml:"tag,omitempty"`
+	Comment    string                 `json:"comment,omitempty" xml:"comment,omitempty" yaml:"comment,omitempty"`
+	Verdict    string                 `json:"verdict,omitempty" xml:"verdict,omitempty" yaml:"verdict,omitempty"`
+	Conditions []*ConditionEvaluation `json:"conditions,omitempty" xml:"conditions,omitempty" yaml:"conditions,omitempty"`
+}
+
+// ConditionEvaluation is the evaluation of a rule condition.
+type ConditionEvaluation struct {
+	Condition string `json:"condition,omitempty" xml:"condition,omitempty" yaml:"condition,omitempty"`
+	Field     string `json:"field,omitempty" xml:"field,omitempty" yaml:"field,omitempty"`
+	// FieldFound indicates whether the input has the field of the condition.
+	// The rules skip the conditions whose fields are not found.
+	FieldFound bool `json:"field_found,omitempty" xml:"field_found,omitempty" yaml:"field_found,omitempty"`
+	Match      bool `json:"match,omitempty" xml:"match,omitempty" yaml:"match,omitempty"`
+}
+
+// getRuleTag returns the tag of a rule, as set by newACLRule.
+func getRuleTag(cfg *RuleConfiguration, ruleID int) string {
+	tokens, _ := cfgutil.DecodeArgs(cfg.Action)
+	for i, token := range tokens {
+		if token == "tag" && i+1 < len(tokens) {
+			return tokens[i+1]
+		}
+	}
+	return fmt.Sprintf("rule%d", ruleID)
+}
+
+// Explain evaluates the input data as Allow does and returns the ordered
+// rule evaluations, the conditions matched by each evaluated rule, and the
+// final verdict.
+func (acl *AccessList) Explain(ctx context.Context, data map[string]interface{}) *Explanation {
+	e := &Explanation{}
+	if acl.clock {
+		data = withClock(data)
+	}
+	var grantedBy string
+	for i, rule := range acl.rules {
+		re := &RuleEvaluation{
+			Tag:     getRuleTag(acl.config[i], i),
+			Comment: acl.config[i].Comment,
+		}
+		for j, cond := range acl.conditions[i] {
+			condCfg := cond.getConfig(ctx)
+			ce := &ConditionEvaluation{
+				Condition: acl.config[i].Conditions[j],
+				Field:     condCfg.field,
+			}
+			v, found := data[condCfg.field]
+			ce.FieldFound = found
+			switch condCfg.matchStrategy {
+			case fieldFound:
+				ce.Match = found
+			case fieldNotFound:
+				ce.Match = !found
+			default:
+				ce.Match = found && cond.match(ctx, v)
+			}
+			re.Conditions = append(re.Conditions, ce)
+		}
+
+		v := rule.eval(ctx, data)
+		re.Verdict = getRuleVerdictDescription(v)
+		e.Rules = append(e.Rules, re)
+		switch v {
+		case ruleVerdictAllowStop:
+			e.Allow = true
+			e.Reason = fmt.Sprintf("allowed by %s", re.Tag)
+			return e
+		case ruleVerdictAllow:
+			if grantedBy == "" {
+				grantedBy = re.Tag
+			}
+		case ruleVerdictDenyStop, ruleVerdictDeny:
+			e.Reason = fmt.Sprintf("denied by %s", re.Tag)
+			return e
+		}
+	}
+	switch {
+	case grantedBy != "":
+		e.Allow = true
+		e.Reason = fmt.Sprintf("allowed by %s", grantedBy)
+	case acl.defaultAllow:
+		e.Allow = true
+		e.Reason = "default allow"
+	default:
+		e.Reason = "default deny"
+	}
+	return e
+}
+
+func getRuleVerdictDescription(s ruleVerdict) string {
+	switch s {
+	case ruleVerdictDeny:
+		return "deny"
+	case ruleVerdictDenyStop:
+		return "deny stop"
+	case ruleVerdictContinue:
+		return "continue"
+	case ruleVerdictAllow:
+		return "allow"
+	case ruleVerdictAllowStop:
+		return "allow stop"
+	}
+	return "unknown"
+}
@@ -0,0 +1,209 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acl
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/greenpau/go-authcrunch/internal/tests"
+)
+
+func TestExplainAccessList(t *testing.T) {
+	var testcases = []struct {
+		name         string
+		config       []*RuleConfiguration
+		defaultAllow bool
+		input        map[string]interface{}
+		want         *Explanation
+	}{
+		{
+			name: "allow by rule with stop",
+			config: []*RuleConfiguration{
+				{
+					Comment:    "deny contractors",
+					Conditions: []string{"match role contractor"},
+					Action:     `deny stop`,
+				},
+				{
+					Comment:    "allow editors",
+					Conditions: []string{"match role editor", "suffix match email @bar.foo"},
+					Action:     `allow stop`,
+				},
+			},
+			input: map[string]interface{}{
+				"email": "jsmith@bar.foo",
+				"roles": []string{"editor"},
+			},
+			want: &Explanation{
+				Allow:  true,
+				Reason: "allowed by rule1",
+				Rules: []*RuleEvaluation{
+					{
+						Tag:     "rule0",
+						Comment: "deny contractors",
+						Verdict: "continue",
+						Conditions: []*ConditionEvaluation{
+							{Condition: "match role contractor", Field: "roles", FieldFound: true},
+						},
+					},
+					{
+						Tag:     "rule1",
+						Comment: "allow editors",
+						Verdict: "allow stop",
+						Conditions: []*ConditionEvaluation{
+							{Condition: "match role editor", Field: "roles", FieldFound: true, Match: true},
+							{Condition: "suffix match email @bar.foo", Field: "email", FieldFound: true, Match: true},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "deny by tagged rule",
+			config: []*RuleConfiguration{
+				{
+					Conditions: []string{"match role contractor"},
+					Action:     `deny stop tag no-contractors`,
+				},
+				{
+					Conditions: []string{"match role editor"},
+					Action:     `allow stop`,
+				},
+			},
+			input: map[string]interface{}{
+				"roles": []string{"editor", "contractor"},
+			},
+			want: &Explanation{
+				Reason: "denied by no-contractors",
+				Rules: []*RuleEvaluation{
+					{
+						Tag:     "no-contractors",
+						Verdict: "deny stop",
+						Conditions: []*ConditionEvaluation{
+							{Condition: "match role contractor", Field: "roles", FieldFound: true, Match: true},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "allow by rule without stop",
+			config: []*RuleConfiguration{
+				{
+					Conditions: []string{"match role editor"},
+					Action:     `allow`,
+				},
+				{
+					Conditions: []string{"match role viewer"},
+					Action:     `allow`,
+				},
+			},
+			input: map[string]interface{}{
+				"roles": []string{"editor"},
+			},
+			want: &Explanation{
+				Allow:  true,
+				Reason: "allowed by rule0",
+				Rules: []*RuleEvaluation{
+					{
+						Tag:     "rule0",
+						Verdict: "allow",
+						Conditions: []*ConditionEvaluation{
+							{Condition: "match role editor", Field: "roles", FieldFound: true, Match: true},
+						},
+					},
+					{
+						Tag:     "rule1",
+						Verdict: "continue",
+						Conditions: []*ConditionEvaluation{
+							{Condition: "match role viewer", Field: "roles", FieldFound: true},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "default deny with missing field",
+			config: []*RuleConfiguration{
+				{
+					Conditions: []string{"match role editor", "match org contoso"},
+					Action:     `allow stop`,
+				},
+			},
+			input: map[string]interface{}{
+				"roles": []string{"editor"},
+			},
+			want: &Explanation{
+				Reason: "default deny",
+				Rules: []*RuleEvaluation{
+					{
+						Tag:     "rule0",
+						Verdict: "continue",
+						Conditions: []*ConditionEvaluation{
+							{Condition: "match role editor", Field: "roles", FieldFound: true, Match: true},
+							{Condition: "match org contoso", Field: "org"},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "default allow",
+			config: []*RuleConfiguration{
+				{
+					Conditions: []string{"field org not exists"},
+					Action:     `deny stop`,
+				},
+			},
+			defaultAllow: true,
+			input: map[string]interface{}{
+				"org": []string{"contoso"},
+			},
+			want: &Explanation{
+				Allow:  true,
+				Reason: "default allow",
+				Rules: []*RuleEvaluation{
+					{
+						Tag:     "rule0",
+						Verdict: "continue",
+						Conditions: []*ConditionEvaluation{
+							{Condition: "field org not exists", Field: "org", FieldFound: true},
+						},
+					},
+				},
+			},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			accessList := NewAccessList()
+			if tc.defaultAllow {
+				accessList.SetDefaultAllowAction()
+			}
+			if err := accessList.AddRules(ctx, tc.config); err != nil {
+				t.Fatal(err)
+			}
+			got := accessList.Explain(ctx, tc.input)
+			tests.EvalObjectsWithLog(t, "explanation", tc.want, got, msgs)
+			if got.Allow != accessList.Allow(ctx, tc.input) {
+				t.Fatalf("explanation verdict differs from access list verdict")
+			}
+		})
+	}
+}
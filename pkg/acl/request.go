@@ -0,0 +1,115 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acl
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	addrutil "github.com/greenpau/go-authcrunch/pkg/util/addr"
+)
+
+// The input fields holding the attributes of the HTTP request, e.g.
+// request.method, request.header.x-api-version, or request.query.page.
+const (
+	requestFieldPrefix       = "request."
+	requestHeaderFieldPrefix = "request.header."
+	requestQueryFieldPrefix  = "request.query."
+)
+
+func isRequestField(s string) bool {
+	return strings.HasPrefix(s, requestFieldPrefix)
+}
+
+// normalizeRequestField returns the request field with lowercase header
+// name, because the header names are case-insensitive.
+func normalizeRequestField(s string) string {
+	if strings.HasPrefix(s, "request.headers.") {
+		s = requestHeaderFieldPrefix + strings.TrimPrefix(s, "request.headers.")
+	}
+	if strings.HasPrefix(s, requestHeaderFieldPrefix) {
+		return strings.ToLower(s)
+	}
+	return s
+}
+
+// WithRequestData returns a copy of the input data with the attributes of
+// the HTTP request referenced by the rules of the AccessList. The request
+// fields of the input data, e.g. the custom claims of a token named after
+// them, are removed, so that only the request sets them. The input data is
+// returned as is when it has no request fields and the rules do not refer
+// to the request.
+func (acl *AccessList) WithRequestData(data map[string]interface{}, r *http.Request) map[string]interface{} {
+	if len(acl.requestFields) == 0 || r == nil {
+		if !hasRequestFields(data) {
+			return data
+		}
+	}
+	m := make(map[string]interface{}, len(data)+len(acl.requestFields))
+	for k, v := range data {
+		if isRequestField(k) {
+			continue
+		}
+		m[k] = v
+	}
+	if r == nil {
+		return m
+	}
+	for k := range acl.requestFields {
+		if v := getRequestFieldValue(k, r); v != nil {
+			m[k] = v
+		}
+	}
+	return m
+}
+
+func hasRequestFields(data map[string]interface{}) bool {
+	for k := range data {
+		if isRequestField(k) {
+			return true
+		}
+	}
+	return false
+}
+
+func getRequestFieldValue(k string, r *http.Request) interface{} {
+	switch {
+	case k == "request.method":
+		return r.Method
+	case k == "request.path":
+		return r.URL.Path
+	case k == "request.host":
+		// The X-Forwarded-Host header is set by the client, unless a proxy
+		// overwrites it, hence the host is taken from the request.
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			return h
+		}
+		return r.Host
+	case k == "request.addr":
+		// Likewise, the X-Real-Ip and X-Forwarded-For headers are not
+		// trusted, and the address is the one of the connection.
+		return addrutil.GetSourceConnAddress(r)
+	case strings.HasPrefix(k, requestHeaderFieldPrefix):
+		if values := r.Header.Values(strings.TrimPrefix(k, requestHeaderFieldPrefix)); len(values) > 0 {
+			return values
+		}
+	case strings.HasPrefix(k, requestQueryFieldPrefix):
+		if values, exists := r.URL.Query()[strings.TrimPrefix(k, requestQueryFieldPrefix)]; exists {
+			return values
+		}
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acl
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/greenpau/go-authcrunch/internal/tests"
+)
+
+func TestWithRequestData(t *testing.T) {
+	var testcases = []struct {
+		name       string
+		conditions []string
+		url        string
+		remoteAddr string
+		headers    map[string]string
+		want       map[string]interface{}
+	}{
+		{
+			name:       "rules without request fields",
+			conditions: []string{"match role editor"},
+			url:        "https://docs.example.com:8443/api/docs?page=1",
+			want: map[string]interface{}{
+				"roles": []string{"editor"},
+			},
+		},
+		{
+			name: "rules with request fields",
+			conditions: []string{
+				"match request.method GET",
+				"match request.path /api/docs",
+				"match request.host docs.example.com",
+				"match request.ip 10.1.2.3",
+				"match request.headers.X-Api-Version 2",
+				"match request.query.page 1",
+			},
+			url:        "https://docs.example.com:8443/api/docs?page=1&page=2",
+			remoteAddr: "10.1.2.3:52044",
+			headers: map[string]string{
+				"X-Api-Version": "2",
+			},
+			want: map[string]interface{}{
+				"roles":                        []string{"editor"},
+				"request.method":               "GET",
+				"request.path":                 "/api/docs",
+				"request.host":                 "docs.example.com",
+				"request.addr":                 "10.1.2.3",
+				"request.header.x-api-version": []string{"2"},
+				"request.query.page":           []string{"1", "2"},
+			},
+		},
+		{
+			name: "rules with request fields and forwarded headers",
+			conditions: []string{
+				"match request.host docs.example.com",
+				"match request.addr 10.1.2.3",
+			},
+			url:        "https://docs.example.com/api/docs",
+			remoteAddr: "192.168.1.1:52044",
+			headers: map[string]string{
+				"X-Real-Ip":        "10.1.2.3",
+				"X-Forwarded-For":  "10.1.2.3",
+				"X-Forwarded-Host": "admin.example.com",
+			},
+			want: map[string]interface{}{
+				"roles":        []string{"editor"},
+				"request.host": "docs.example.com",
+				"request.addr": "192.168.1.1",
+			},
+		},
+		{
+			name: "rules with missing request fields",
+			conditions: []string{
+				"match request.header.x-api-version 2",
+				"match request.query.page 1",
+			},
+			url: "https://docs.example.com/api/docs",
+			want: map[string]interface{}{
+				"roles": []string{"editor"},
+			},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			accessList := NewAccessList()
+			for _, condition := range tc.conditions {
+				cfg := &RuleConfiguration{Conditions: []string{condition}, Action: `allow`}
+				if err := accessList.AddRule(ctx, cfg); err != nil {
+					t.Fatal(err)
+				}
+			}
+			req, err := http.NewRequest("GET", tc.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.remoteAddr != "" {
+				req.RemoteAddr = tc.remoteAddr
+			}
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			// The request fields of the input data, e.g. the custom claims
+			// of a token, are removed.
+			data := map[string]interface{}{
+				"roles":                        []string{"editor"},
+				"request.method":               "POST",
+				"request.header.x-api-version": "2",
+			}
+			got := accessList.WithRequestData(data, req)
+			tests.EvalObjectsWithLog(t, "request data", tc.want, got, msgs)
+			if len(data) != 3 {
+				t.Fatalf("input data modified: %v", data)
+			}
+		})
+	}
+}
+
+func TestAllowWithUnexpectedInputTypes(t *testing.T) {
+	ctx := context.Background()
+	accessList := NewAccessList()
+	cfgs := []*RuleConfiguration{
+		{Conditions: []string{"match request.header.x-api-version 2"}, Action: `allow`},
+		{Conditions: []string{"no match roles admin"}, Action: `allow`},
+		{Conditions: []string{"match email jsmith@contoso.com"}, Action: `allow`},
+	}
+	if err := accessList.AddRules(ctx, cfgs); err != nil {
+		t.Fatal(err)
+	}
+	data := map[string]interface{}{
+		"request.header.x-api-version": "2",
+		"roles":                        "admin",
+		"email":                        []string{"jsmith@contoso.com"},
+	}
+	got := map[string]interface{}{"allow": accessList.Allow(ctx, data)}
+	want := map[string]interface{}{"allow": false}
+	tests.EvalObjectsWithLog(t, "access list", want, got, []string{})
+}
@@ -4213,17 +4213,17 @@ func (rule *aclRuleFieldCheckDenyWithErrorLoggerCounter) emptyFields(ctx context
 }
 
 func newACLRule(ctx context.Context, ruleID int, cfg *RuleConfiguration, logger *zap.Logger) (aclRule, error) {
-	var action, logLevel, tag string
-	var fieldCondFound bool
-	var stopEnabled, logEnabled, counterEnabled, matchAny bool
-	var skipNext, lastToken bool
-	var conditions []aclRuleCondition
-	var condConfigs []*config
-	var fields []string
-	fieldIndex := make(map[string]int)
-	checkFields := make(map[string]bool)
+	conditions, err := parseACLRuleConditions(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return newACLRuleWithConditions(ctx, ruleID, cfg, conditions, logger)
+}
 
-	for i, c := range cfg.Conditions {
+// parseACLRuleConditions returns the parsed conditions of a rule.
+func parseACLRuleConditions(ctx context.Context, cfg *RuleConfiguration) ([]aclRuleCondition, error) {
+	var conditions []aclRuleCondition
+	for _, c := range cfg.Conditions {
 		tokens, err := cfgutil.DecodeArgs(c)
 		if err != nil {
 			return nil, errors.ErrACLRuleSyntaxExtractCondToken.WithArgs(err)
@@ -4233,6 +4233,23 @@ func newACLRule(ctx context.Context, ruleID int, cfg *RuleConfiguration, logger
 			return nil, errors.ErrACLRuleSyntax.WithArgs(err)
 		}
 		conditions = append(conditions, parsedACLRuleCondition)
+	}
+	return conditions, nil
+}
+
+// newACLRuleWithConditions returns the rule with the conditions parsed by
+// parseACLRuleConditions.
+func newACLRuleWithConditions(ctx context.Context, ruleID int, cfg *RuleConfiguration, conditions []aclRuleCondition, logger *zap.Logger) (aclRule, error) {
+	var action, logLevel, tag string
+	var fieldCondFound bool
+	var stopEnabled, logEnabled, counterEnabled, matchAny bool
+	var skipNext, lastToken bool
+	var condConfigs []*config
+	var fields []string
+	fieldIndex := make(map[string]int)
+	checkFields := make(map[string]bool)
+
+	for i, parsedACLRuleCondition := range conditions {
 		condConfig := parsedACLRuleCondition.getConfig(ctx)
 		condConfigs = append(condConfigs, condConfig)
 		if _, exists := fieldIndex[condConfig.field]; exists {
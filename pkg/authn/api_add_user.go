@@ -0,0 +1,103 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/greenpau/go-authcrunch/pkg/authn/enums/operator"
+	"github.com/greenpau/go-authcrunch/pkg/identity"
+	"github.com/greenpau/go-authcrunch/pkg/ids"
+	"github.com/greenpau/go-authcrunch/pkg/requests"
+	"github.com/greenpau/go-authcrunch/pkg/user"
+)
+
+// addUser adds a user to identity store.
+func (p *Portal) addUser(
+	ctx context.Context,
+	w http.ResponseWriter,
+	r *http.Request,
+	rr *requests.Request,
+	resp map[string]interface{},
+	usr *user.User,
+	backend ids.IdentityStore,
+	bodyData map[string]interface{}) error {
+
+	rr.User = requests.User{}
+	for _, k := range []string{"username", "password", "email"} {
+		v, exists := bodyData[k]
+		if !exists {
+			resp["message"] = fmt.Sprintf("Manager API did not find key %s in the request payload", k)
+			return handleAPIProfileResponse(w, rr, http.StatusBadRequest, resp)
+		}
+		s, ok := v.(string)
+		if !ok {
+			resp["message"] = fmt.Sprintf("Manager API did find key %s in the request payload, but it is malformed", k)
+			return handleAPIProfileResponse(w, rr, http.StatusBadRequest, resp)
+		}
+		switch k {
+		case "username":
+			rr.User.Username = strings.TrimSpace(s)
+		case "password":
+			rr.User.Password = s
+		case "email":
+			rr.User.Email = strings.TrimSpace(s)
+		}
+	}
+
+	if v, exists := bodyData["name"]; exists {
+		s, ok := v.(string)
+		if !ok {
+			resp["message"] = "Manager API did find key name in the request payload, but it is malformed"
+			return handleAPIProfileResponse(w, rr, http.StatusBadRequest, resp)
+		}
+		rr.User.FullName = strings.TrimSpace(s)
+	}
+
+	roles, err := extractManagedUserRoles(bodyData)
+	if err != nil {
+		resp["message"] = fmt.Sprintf("Manager API %v", err)
+		return handleAPIProfileResponse(w, rr, http.StatusBadRequest, resp)
+	}
+	rr.User.Roles = roles
+
+	if err := backend.Request(operator.AddUser, rr); err != nil {
+		resp["message"] = fmt.Sprintf("Manager API failed to add user: %v", err)
+		var policyErr *identity.PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			resp["password_policy_violations"] = policyErr.Rules
+		}
+		return handleAPIProfileResponse(w, rr, http.StatusBadRequest, resp)
+	}
+
+	// Fetch the newly created user to return its metadata.
+	rr.Query.ID = ""
+	rr.User.Password = ""
+	if err := backend.Request(operator.GetUser, rr); err != nil {
+		resp["message"] = "Manager API failed to get user"
+		return handleAPIProfileResponse(w, rr, http.StatusInternalServerError, resp)
+	}
+	entry, ok := rr.Response.Payload.(*identity.User)
+	if !ok {
+		resp["message"] = "Manager API received malformed user"
+		return handleAPIProfileResponse(w, rr, http.StatusInternalServerError, resp)
+	}
+	resp["entry"] = entry.GetMetadata()
+	return handleAPIProfileResponse(w, rr, http.StatusOK, resp)
+}
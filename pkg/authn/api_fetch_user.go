@@ -0,0 +1,56 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authn
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/greenpau/go-authcrunch/pkg/authn/enums/operator"
+	"github.com/greenpau/go-authcrunch/pkg/identity"
+	"github.com/greenpau/go-authcrunch/pkg/ids"
+	"github.com/greenpau/go-authcrunch/pkg/requests"
+	"github.com/greenpau/go-authcrunch/pkg/user"
+)
+
+// fetchUser fetches a user from identity store.
+func (p *Portal) fetchUser(
+	ctx context.Context,
+	w http.ResponseWriter,
+	r *http.Request,
+	rr *requests.Request,
+	resp map[string]interface{},
+	usr *user.User,
+	backend ids.IdentityStore,
+	bodyData map[string]interface{}) error {
+
+	if err := extractManagedUserID(rr, bodyData); err != nil {
+		resp["message"] = fmt.Sprintf("Manager API %v", err)
+		return handleAPIProfileResponse(w, rr, http.StatusBadRequest, resp)
+	}
+
+	if err := backend.Request(operator.GetUser, rr); err != nil {
+		resp["message"] = "Manager API failed to get user"
+		return handleAPIProfileResponse(w, rr, http.StatusNotFound, resp)
+	}
+	entry, ok := rr.Response.Payload.(*identity.User)
+	if !ok {
+		resp["message"] = "Manager API received malformed user"
+		return handleAPIProfileResponse(w, rr, http.StatusInternalServerError, resp)
+	}
+	resp["entry"] = entry.GetMetadata()
+	return handleAPIProfileResponse(w, rr, http.StatusOK, resp)
+}
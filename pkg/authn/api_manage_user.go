@@ -0,0 +1,114 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authn
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/greenpau/go-authcrunch/pkg/authn/enums/operator"
+	"github.com/greenpau/go-authcrunch/pkg/identity"
+	"github.com/greenpau/go-authcrunch/pkg/ids"
+	"github.com/greenpau/go-authcrunch/pkg/requests"
+	"github.com/greenpau/go-authcrunch/pkg/user"
+	"go.uber.org/zap"
+)
+
+// manageUser deletes, disables, enables, unlocks, or updates the roles of a
+// user in identity store.
+func (p *Portal) manageUser(
+	ctx context.Context,
+	w http.ResponseWriter,
+	r *http.Request,
+	rr *requests.Request,
+	resp map[string]interface{},
+	usr *user.User,
+	backend ids.IdentityStore,
+	bodyData map[string]interface{},
+	op operator.Type) error {
+
+	if err := extractManagedUserID(rr, bodyData); err != nil {
+		resp["message"] = fmt.Sprintf("Manager API %v", err)
+		return handleAPIProfileResponse(w, rr, http.StatusBadRequest, resp)
+	}
+
+	if err := backend.Request(operator.GetUser, rr); err != nil {
+		resp["message"] = "Manager API failed to get user"
+		return handleAPIProfileResponse(w, rr, http.StatusNotFound, resp)
+	}
+	entry, ok := rr.Response.Payload.(*identity.User)
+	if !ok {
+		resp["message"] = "Manager API received malformed user"
+		return handleAPIProfileResponse(w, rr, http.StatusInternalServerError, resp)
+	}
+
+	switch op {
+	case operator.DeleteUser, operator.DisableUser:
+		if strings.EqualFold(entry.Username, usr.Claims.Subject) {
+			resp["message"] = "Manager API does not allow administrators to delete or disable their own account"
+			return handleAPIProfileResponse(w, rr, http.StatusBadRequest, resp)
+		}
+	case operator.UpdateUserRoles:
+		roles, err := extractManagedUserRoles(bodyData)
+		if err != nil {
+			resp["message"] = fmt.Sprintf("Manager API %v", err)
+			return handleAPIProfileResponse(w, rr, http.StatusBadRequest, resp)
+		}
+		if len(roles) == 0 {
+			resp["message"] = "Manager API did not find key roles in the request payload"
+			return handleAPIProfileResponse(w, rr, http.StatusBadRequest, resp)
+		}
+		rr.User.Roles = roles
+	}
+
+	if err := backend.Request(op, rr); err != nil {
+		resp["message"] = fmt.Sprintf("Manager API failed to perform %s operation: %v", op, err)
+		return handleAPIProfileResponse(w, rr, http.StatusBadRequest, resp)
+	}
+
+	p.logger.Info(
+		"manager api changed user",
+		zap.String("session_id", rr.Upstream.SessionID),
+		zap.String("request_id", rr.ID),
+		zap.String("admin", usr.Claims.Subject),
+		zap.String("operation", op.String()),
+		zap.String("user_id", entry.ID),
+		zap.String("username", entry.Username),
+	)
+
+	// The tokens of a deleted or disabled user, and the tokens with the
+	// previous roles are no longer valid.
+	switch op {
+	case operator.DeleteUser, operator.DisableUser, operator.UpdateUserRoles:
+		if err := p.revokeSubject(entry.Username); err != nil {
+			p.logger.Warn(
+				"failed revoking user tokens",
+				zap.String("session_id", rr.Upstream.SessionID),
+				zap.String("request_id", rr.ID),
+				zap.String("username", entry.Username),
+				zap.Error(err),
+			)
+		}
+	}
+
+	if op == operator.DeleteUser {
+		resp["entry"] = "Deleted"
+		return handleAPIProfileResponse(w, rr, http.StatusOK, resp)
+	}
+	resp["entry"] = entry.GetMetadata()
+	return handleAPIProfileResponse(w, rr, http.StatusOK, resp)
+}
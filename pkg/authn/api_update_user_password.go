@@ -16,14 +16,17 @@ package authn
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 
 	"github.com/greenpau/go-authcrunch/pkg/authn/enums/operator"
+	"github.com/greenpau/go-authcrunch/pkg/identity"
 	"github.com/greenpau/go-authcrunch/pkg/ids"
 	"github.com/greenpau/go-authcrunch/pkg/requests"
 	"github.com/greenpau/go-authcrunch/pkg/user"
+	"go.uber.org/zap"
 )
 
 // UpdateUserPassword updates user password.
@@ -67,9 +70,25 @@ func (p *Portal) UpdateUserPassword(
 	if err := backend.Request(operator.ChangePassword, rr); err != nil {
 		var errMsg string = fmt.Sprintf("the Profile API failed to change user password in identity store: %v", err)
 		resp["message"] = errMsg
+		var policyErr *identity.PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			resp["password_policy_violations"] = policyErr.Rules
+		}
 		return handleAPIProfileResponse(w, rr, http.StatusBadRequest, resp)
 	}
 
+	// The tokens issued with the old password, including the token of this
+	// request, are no longer valid.
+	if err := p.revokeSubject(usr.Claims.Subject); err != nil {
+		p.logger.Warn(
+			"failed revoking user tokens after password change",
+			zap.String("session_id", rr.Upstream.SessionID),
+			zap.String("request_id", rr.ID),
+			zap.String("sub", usr.Claims.Subject),
+			zap.Error(err),
+		)
+	}
+
 	resp["entry"] = "Updated"
 	return handleAPIProfileResponse(w, rr, http.StatusOK, resp)
 }
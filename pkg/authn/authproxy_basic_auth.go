@@ -90,6 +90,17 @@ func (p *Portal) BasicAuth(r *authproxy.Request) error {
 		return errors.ErrBasicAuthFailed
 	}
 
+	if hasPendingPasswordChange(rr.User.Challenges) {
+		p.logger.Warn(
+			"user authentication failed",
+			zap.String("source_address", r.Address),
+			zap.String("custom_auth", "basicauth"),
+			zap.String("realm", r.Realm),
+			zap.Error(errors.ErrUserPasswordExpired),
+		)
+		return errors.ErrBasicAuthFailed
+	}
+
 	if len(rr.User.Challenges) != 1 {
 		p.logger.Warn(
 			"user lookup failed",
@@ -0,0 +1,93 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/greenpau/go-authcrunch/pkg/user"
+)
+
+// cacheEntry is the serialized form of the session and sandbox cache
+// entries kept in a key/value store.
+type cacheEntry struct {
+	ID        string      `json:"id"`
+	CreatedAt time.Time   `json:"created_at"`
+	Expired   bool        `json:"expired,omitempty"`
+	User      *cachedUser `json:"user,omitempty"`
+}
+
+// cachedUser is the serialized form of user.User. The claims are kept as
+// a map, because the user is rebuilt from them.
+type cachedUser struct {
+	Claims        map[string]interface{} `json:"claims,omitempty"`
+	Token         string                 `json:"token,omitempty"`
+	TokenName     string                 `json:"token_name,omitempty"`
+	TokenSource   string                 `json:"token_source,omitempty"`
+	Authenticator user.Authenticator     `json:"authenticator,omitempty"`
+	Checkpoints   []*user.Checkpoint     `json:"checkpoints,omitempty"`
+	Authorized    bool                   `json:"authorized,omitempty"`
+	FrontendLinks []string               `json:"frontend_links,omitempty"`
+	Locked        bool                   `json:"locked,omitempty"`
+	Cached        bool                   `json:"cached,omitempty"`
+}
+
+func encodeCacheEntry(id string, createdAt time.Time, expired bool, u *user.User) ([]byte, error) {
+	entry := &cacheEntry{
+		ID:        id,
+		CreatedAt: createdAt,
+		Expired:   expired,
+	}
+	if u != nil {
+		entry.User = &cachedUser{
+			Claims:        u.AsMap(),
+			Token:         u.Token,
+			TokenName:     u.TokenName,
+			TokenSource:   u.TokenSource,
+			Authenticator: u.Authenticator,
+			Checkpoints:   u.Checkpoints,
+			Authorized:    u.Authorized,
+			FrontendLinks: u.FrontendLinks,
+			Locked:        u.Locked,
+			Cached:        u.Cached,
+		}
+	}
+	return json.Marshal(entry)
+}
+
+func decodeCacheEntry(b []byte) (*cacheEntry, *user.User, error) {
+	entry := &cacheEntry{}
+	if err := json.Unmarshal(b, entry); err != nil {
+		return nil, nil, err
+	}
+	if entry.User == nil {
+		return entry, nil, nil
+	}
+	u, err := user.NewUser(entry.User.Claims)
+	if err != nil {
+		return nil, nil, err
+	}
+	u.Token = entry.User.Token
+	u.TokenName = entry.User.TokenName
+	u.TokenSource = entry.User.TokenSource
+	u.Authenticator = entry.User.Authenticator
+	u.Checkpoints = entry.User.Checkpoints
+	u.Authorized = entry.User.Authorized
+	u.FrontendLinks = entry.User.FrontendLinks
+	u.Locked = entry.User.Locked
+	u.Cached = entry.User.Cached
+	return entry, u, nil
+}
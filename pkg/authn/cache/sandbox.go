@@ -20,6 +20,8 @@ import (
 	"sync"
 	"time"
 
+	autherrors "github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/kvstore"
 	"github.com/greenpau/go-authcrunch/pkg/user"
 )
 
@@ -27,6 +29,7 @@ const defaultSandboxCleanupInternal int = 60
 const minSandboxCleanupInternal int = 0
 const defaultSandboxMaxEntryLifetime int = 300
 const minSandboxMaxEntryLifetime int = 60
+const sandboxKeyPrefix = "sandbox/"
 
 // SandboxCacheEntry is an entry in SandboxCache.
 type SandboxCacheEntry struct {
@@ -37,7 +40,8 @@ type SandboxCacheEntry struct {
 	expired bool
 }
 
-// SandboxCache contains cached tokens
+// SandboxCache contains cached tokens. The entries are kept in a key/value
+// store, which is in memory unless set with SetStore.
 type SandboxCache struct {
 	mu sync.RWMutex
 	// The interval (in seconds) at which cache maintenance task are being triggered.
@@ -47,9 +51,7 @@ type SandboxCache struct {
 	maxEntryLifetime int
 	// If set to true, then the cache is being managed.
 	managed bool
-	// exit channel
-	exit    chan bool
-	Entries map[string]*SandboxCacheEntry `json:"entries,omitempty" xml:"entries,omitempty" yaml:"entries,omitempty"`
+	store   kvstore.Store
 }
 
 // NewSandboxCache returns SandboxCache instance.
@@ -57,11 +59,23 @@ func NewSandboxCache() *SandboxCache {
 	return &SandboxCache{
 		cleanupInternal:  defaultSandboxCleanupInternal,
 		maxEntryLifetime: defaultSandboxMaxEntryLifetime,
-		Entries:          make(map[string]*SandboxCacheEntry),
-		exit:             make(chan bool),
+		store:            kvstore.NewMemoryStore(),
 	}
 }
 
+// SetStore sets the key/value store holding the cache entries.
+func (c *SandboxCache) SetStore(store kvstore.Store) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.store = store
+}
+
+func (c *SandboxCache) getStore() kvstore.Store {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.store
+}
+
 // SetCleanupInterval sets cache management interval.
 func (c *SandboxCache) SetCleanupInterval(i int) error {
 	if i < 1 {
@@ -80,51 +94,31 @@ func (c *SandboxCache) SetMaxEntryLifetime(i int) error {
 	return nil
 }
 
+// manageSandboxCache purges expired entries from the stores that do not
+// expire entries on their own.
 func manageSandboxCache(c *SandboxCache) {
-	c.managed = true
 	intervals := time.NewTicker(time.Second * time.Duration(c.cleanupInternal))
+	defer intervals.Stop()
 	for range intervals.C {
-		if c == nil {
-			continue
-		}
-		c.mu.Lock()
-		select {
-		case <-c.exit:
-			c.managed = false
-			break
-		default:
-			break
-		}
-		if !c.managed {
-			c.mu.Unlock()
-			break
-		}
-		if c.Entries == nil {
-			c.mu.Unlock()
-			continue
+		c.mu.RLock()
+		managed := c.managed
+		store := c.store
+		c.mu.RUnlock()
+		if !managed {
+			return
 		}
-		deleteList := []string{}
-		for sandboxID, entry := range c.Entries {
-			if err := entry.Valid(c.maxEntryLifetime); err != nil {
-				deleteList = append(deleteList, sandboxID)
-				continue
-			}
-		}
-		if len(deleteList) > 0 {
-			for _, sandboxID := range deleteList {
-				delete(c.Entries, sandboxID)
-			}
-		}
-		c.mu.Unlock()
+		kvstore.Purge(store)
 	}
-	return
 }
 
 // Run starts management of SandboxCache instance.
 func (c *SandboxCache) Run() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if c.managed {
 		return
 	}
+	c.managed = true
 	go manageSandboxCache(c)
 }
 
@@ -147,32 +141,59 @@ func (c *SandboxCache) GetMaxEntryLifetime() int {
 
 // Add adds user to the cache.
 func (c *SandboxCache) Add(sandboxID string, u *user.User) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.Entries == nil {
-		return errors.New("sandbox cache is not available")
+	b, err := encodeCacheEntry(sandboxID, time.Now().UTC(), false, u)
+	if err != nil {
+		return fmt.Errorf("failed encoding cached sandbox: %v", err)
 	}
-	c.Entries[sandboxID] = &SandboxCacheEntry{
-		sandboxID: sandboxID,
-		createdAt: time.Now().UTC(),
-		user:      u,
+	return c.getStore().Set(sandboxKeyPrefix+sandboxID, b, time.Duration(c.maxEntryLifetime)*time.Second)
+}
+
+// Update replaces the user of the existing entry, e.g. after the user
+// passes a checkpoint. The entry keeps its expiry time.
+func (c *SandboxCache) Update(sandboxID string, u *user.User) error {
+	entry, err := c.getEntry(sandboxID)
+	if err != nil {
+		return err
 	}
-	return nil
+	return c.putEntry(entry.sandboxID, entry.createdAt, entry.expired, u)
 }
 
 // Delete removes cached user entry.
 func (c *SandboxCache) Delete(sandboxID string) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.Entries == nil {
-		return errors.New("sandbox cache is not available")
+	return c.getStore().Delete(sandboxKeyPrefix + sandboxID)
+}
+
+func (c *SandboxCache) getEntry(sandboxID string) (*SandboxCacheEntry, error) {
+	b, err := c.getStore().Get(sandboxKeyPrefix + sandboxID)
+	if err != nil {
+		if err == autherrors.ErrKVStoreKeyNotFound {
+			return nil, errors.New("cached sandbox id not found")
+		}
+		return nil, err
 	}
-	_, exists := c.Entries[sandboxID]
-	if !exists {
-		return errors.New("cached sandbox id not found")
+	data, u, err := decodeCacheEntry(b)
+	if err != nil {
+		return nil, fmt.Errorf("cached sandbox id error: %s", err)
 	}
-	delete(c.Entries, sandboxID)
-	return nil
+	return &SandboxCacheEntry{
+		sandboxID: data.ID,
+		createdAt: data.CreatedAt,
+		user:      u,
+		expired:   data.Expired,
+	}, nil
+}
+
+// putEntry stores the entry for the remainder of its lifetime.
+func (c *SandboxCache) putEntry(sandboxID string, createdAt time.Time, expired bool, u *user.User) error {
+	ttl := time.Until(createdAt.Add(time.Duration(c.maxEntryLifetime) * time.Second))
+	if ttl <= 0 {
+		return errors.New("sandbox cached entry expired")
+	}
+	b, err := encodeCacheEntry(sandboxID, createdAt, expired, u)
+	if err != nil {
+		return fmt.Errorf("failed encoding cached sandbox: %v", err)
+	}
+	return c.getStore().Set(sandboxKeyPrefix+sandboxID, b, ttl)
 }
 
 // Get returns cached user entry.
@@ -180,25 +201,26 @@ func (c *SandboxCache) Get(sandboxID string) (*user.User, error) {
 	if err := parseCacheID(sandboxID); err != nil {
 		return nil, err
 	}
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	if entry, exists := c.Entries[sandboxID]; exists {
-		if err := entry.Valid(c.maxEntryLifetime); err != nil {
-			return nil, err
-		}
-		return entry.user, nil
+	entry, err := c.getEntry(sandboxID)
+	if err != nil {
+		return nil, err
 	}
-	return nil, errors.New("cached sandbox id not found")
+	if err := entry.Valid(c.maxEntryLifetime); err != nil {
+		return nil, err
+	}
+	if entry.user == nil {
+		return nil, fmt.Errorf("cached sandbox id %s has nil user", sandboxID)
+	}
+	return entry.user, nil
 }
 
 // Expire expires a particular sandbox entry.
 func (c *SandboxCache) Expire(sandboxID string) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	if entry, exists := c.Entries[sandboxID]; exists {
-		entry.expired = true
+	entry, err := c.getEntry(sandboxID)
+	if err != nil {
+		return
 	}
-	return
+	c.putEntry(entry.sandboxID, entry.createdAt, true, entry.user)
 }
 
 // Valid checks whether SandboxCacheEntry is non-expired.
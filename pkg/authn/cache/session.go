@@ -20,11 +20,14 @@ import (
 	"sync"
 	"time"
 
+	autherrors "github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/kvstore"
 	"github.com/greenpau/go-authcrunch/pkg/user"
 )
 
 const defaultSessionCleanupInternal int = 60
 const minSessionCleanupInternal int = 0
+const sessionKeyPrefix = "session/"
 
 // SessionCacheEntry is an entry in SessionCache.
 type SessionCacheEntry struct {
@@ -33,7 +36,8 @@ type SessionCacheEntry struct {
 	user      *user.User
 }
 
-// SessionCache contains cached tokens
+// SessionCache contains cached tokens. The entries are kept in a key/value
+// store, which is in memory unless set with SetStore.
 type SessionCache struct {
 	mu sync.RWMutex
 	// The interval (in seconds) at which cache maintenance task are being triggered.
@@ -43,21 +47,31 @@ type SessionCache struct {
 	maxEntryLifetime int64
 	// If set to true, then the cache is being managed.
 	managed bool
-	// exit channel
-	exit    chan bool
-	Entries map[string]*SessionCacheEntry `json:"entries,omitempty" xml:"entries,omitempty" yaml:"entries,omitempty"`
+	store   kvstore.Store
 }
 
 // NewSessionCache returns SessionCache instance.
 func NewSessionCache() *SessionCache {
 	c := &SessionCache{
 		cleanupInternal: defaultSessionCleanupInternal,
-		Entries:         make(map[string]*SessionCacheEntry),
-		exit:            make(chan bool),
+		store:           kvstore.NewMemoryStore(),
 	}
 	return c
 }
 
+// SetStore sets the key/value store holding the cache entries.
+func (c *SessionCache) SetStore(store kvstore.Store) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.store = store
+}
+
+func (c *SessionCache) getStore() kvstore.Store {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.store
+}
+
 // SetCleanupInterval sets cache management interval.
 func (c *SessionCache) SetCleanupInterval(i int) error {
 	if i < 1 {
@@ -68,50 +82,31 @@ func (c *SessionCache) SetCleanupInterval(i int) error {
 
 }
 
+// manageSessionCache purges expired entries from the stores that do not
+// expire entries on their own.
 func manageSessionCache(c *SessionCache) {
-	c.managed = true
 	intervals := time.NewTicker(time.Second * time.Duration(c.cleanupInternal))
+	defer intervals.Stop()
 	for range intervals.C {
-		if c == nil {
-			continue
-		}
-		c.mu.Lock()
-		select {
-		case <-c.exit:
-			c.managed = false
-			break
-		default:
-			break
+		c.mu.RLock()
+		managed := c.managed
+		store := c.store
+		c.mu.RUnlock()
+		if !managed {
+			return
 		}
-		if !c.managed {
-			c.mu.Unlock()
-			break
-		}
-		if c.Entries == nil {
-			c.mu.Unlock()
-			continue
-		}
-		deleteList := []string{}
-		for sessionID, entry := range c.Entries {
-			if err := entry.Valid(); err != nil {
-				deleteList = append(deleteList, sessionID)
-				continue
-			}
-		}
-		if len(deleteList) > 0 {
-			for _, sessionID := range deleteList {
-				delete(c.Entries, sessionID)
-			}
-		}
-		c.mu.Unlock()
+		kvstore.Purge(store)
 	}
 }
 
 // Run starts management of SessionCache instance.
 func (c *SessionCache) Run() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if c.managed {
 		return
 	}
+	c.managed = true
 	go manageSessionCache(c)
 }
 
@@ -127,34 +122,29 @@ func (c *SessionCache) GetCleanupInterval() int {
 	return c.cleanupInternal
 }
 
-// Add adds user to the cache.
+// Add adds user to the cache. The entry expires together with the user
+// claims.
 func (c *SessionCache) Add(sessionID string, u *user.User) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.Entries == nil {
-		return errors.New("session cache is not available")
+	if u == nil || u.Claims == nil {
+		return fmt.Errorf("cached session id %s has nil user", sessionID)
 	}
-	c.Entries[sessionID] = &SessionCacheEntry{
-		sessionID: sessionID,
-		createdAt: time.Now().UTC(),
-		user:      u,
+	var ttl time.Duration
+	if u.Claims.ExpiresAt > 0 {
+		ttl = time.Until(time.Unix(u.Claims.ExpiresAt, 0))
+		if ttl <= 0 {
+			return errors.New("cached session expired")
+		}
 	}
-	return nil
+	b, err := encodeCacheEntry(sessionID, time.Now().UTC(), false, u)
+	if err != nil {
+		return fmt.Errorf("failed encoding cached session: %v", err)
+	}
+	return c.getStore().Set(sessionKeyPrefix+sessionID, b, ttl)
 }
 
 // Delete removes cached user entry.
 func (c *SessionCache) Delete(sessionID string) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.Entries == nil {
-		return errors.New("session cache is not available")
-	}
-	_, exists := c.Entries[sessionID]
-	if !exists {
-		return errors.New("cached session id not found")
-	}
-	delete(c.Entries, sessionID)
-	return nil
+	return c.getStore().Delete(sessionKeyPrefix + sessionID)
 }
 
 // Get returns cached user entry.
@@ -162,20 +152,33 @@ func (c *SessionCache) Get(sessionID string) (*user.User, error) {
 	if err := parseCacheID(sessionID); err != nil {
 		return nil, err
 	}
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	if entry, exists := c.Entries[sessionID]; exists {
-		if err := entry.Valid(); err != nil {
-			delete(c.Entries, sessionID)
-			return nil, fmt.Errorf("cached session id error: %s", err)
-		}
-		if entry.user == nil {
-			delete(c.Entries, sessionID)
-			return nil, fmt.Errorf("cached session id %s has nil user", sessionID)
+	store := c.getStore()
+	b, err := store.Get(sessionKeyPrefix + sessionID)
+	if err != nil {
+		if err == autherrors.ErrKVStoreKeyNotFound {
+			return nil, errors.New("cached session id not found")
 		}
-		return entry.user, nil
+		return nil, err
+	}
+	data, u, err := decodeCacheEntry(b)
+	if err != nil {
+		store.Delete(sessionKeyPrefix + sessionID)
+		return nil, fmt.Errorf("cached session id error: %s", err)
+	}
+	if u == nil {
+		store.Delete(sessionKeyPrefix + sessionID)
+		return nil, fmt.Errorf("cached session id %s has nil user", sessionID)
+	}
+	entry := &SessionCacheEntry{
+		sessionID: data.ID,
+		createdAt: data.CreatedAt,
+		user:      u,
+	}
+	if err := entry.Valid(); err != nil {
+		store.Delete(sessionKeyPrefix + sessionID)
+		return nil, fmt.Errorf("cached session id error: %s", err)
 	}
-	return nil, errors.New("cached session id not found")
+	return entry.user, nil
 }
 
 // Valid checks whether SessionCacheEntry is not expired.
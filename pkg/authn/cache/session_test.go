@@ -0,0 +1,117 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/greenpau/go-authcrunch/internal/tests"
+	"github.com/greenpau/go-authcrunch/pkg/kvstore"
+	"github.com/greenpau/go-authcrunch/pkg/user"
+	"github.com/greenpau/go-authcrunch/pkg/util"
+)
+
+func newTestCacheUser(t *testing.T, exp time.Time) *user.User {
+	usr, err := user.NewUser(map[string]interface{}{
+		"sub":   "jsmith",
+		"email": "jsmith@localhost.localdomain",
+		"roles": []string{"authp/user"},
+		"exp":   float64(exp.Unix()),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	usr.Token = "foobar"
+	usr.Authenticator.Realm = "local"
+	return usr
+}
+
+func TestSessionCacheSharedStore(t *testing.T) {
+	store, err := kvstore.NewBoltStore(filepath.Join(t.TempDir(), "cache.db"), time.Second)
+	if err != nil {
+		t.Fatalf("failed creating store: %v", err)
+	}
+
+	// The sessions added by one instance are available to another one.
+	c1 := NewSessionCache()
+	c1.SetStore(store)
+	c2 := NewSessionCache()
+	c2.SetStore(store)
+
+	sessionID := util.GetRandomStringFromRange(32, 96)
+	if err := c1.Add(sessionID, newTestCacheUser(t, time.Now().Add(time.Hour))); err != nil {
+		t.Fatalf("failed adding session: %v", err)
+	}
+	usr, err := c2.Get(sessionID)
+	if err != nil {
+		t.Fatalf("failed getting session: %v", err)
+	}
+	got := map[string]interface{}{
+		"subject": usr.Claims.Subject,
+		"roles":   usr.Claims.Roles,
+		"token":   usr.Token,
+		"realm":   usr.Authenticator.Realm,
+	}
+	want := map[string]interface{}{
+		"subject": "jsmith",
+		"roles":   []string{"authp/user"},
+		"token":   "foobar",
+		"realm":   "local",
+	}
+	tests.EvalObjectsWithLog(t, "shared session", want, got, []string{})
+
+	c2.Delete(sessionID)
+	_, err = c1.Get(sessionID)
+	tests.EvalErrWithLog(t, err, "deleted session", true, errors.New("cached session id not found"), []string{})
+
+	err = c1.Add(sessionID, newTestCacheUser(t, time.Now().Add(-time.Minute)))
+	tests.EvalErrWithLog(t, err, "expired session", true, errors.New("cached session expired"), []string{})
+}
+
+func TestSandboxCacheUpdate(t *testing.T) {
+	c := NewSandboxCache()
+	sandboxID := util.GetRandomStringFromRange(32, 96)
+	usr := newTestCacheUser(t, time.Now().Add(time.Hour))
+	usr.Checkpoints = []*user.Checkpoint{{ID: 0, Type: "password"}}
+	if err := c.Add(sandboxID, usr); err != nil {
+		t.Fatalf("failed adding sandbox: %v", err)
+	}
+
+	// The cache holds a copy of the user, so the changes are written back.
+	usr, _ = c.Get(sandboxID)
+	usr.Checkpoints[0].Passed = true
+	if err := c.Update(sandboxID, usr); err != nil {
+		t.Fatalf("failed updating sandbox: %v", err)
+	}
+	usr, _ = c.Get(sandboxID)
+	got := map[string]interface{}{
+		"passed": usr.Checkpoints[0].Passed,
+	}
+	want := map[string]interface{}{
+		"passed": true,
+	}
+	tests.EvalObjectsWithLog(t, "updated sandbox", want, got, []string{})
+
+	c.Expire(sandboxID)
+	_, err := c.Get(sandboxID)
+	tests.EvalErrWithLog(t, err, "expired sandbox", true, errors.New("sandbox cached entry is no longer in use"), []string{})
+
+	c.Delete(sandboxID)
+	err = c.Update(sandboxID, usr)
+	tests.EvalErrWithLog(t, err, "deleted sandbox", true, errors.New("cached sandbox id not found"), []string{})
+}
@@ -15,6 +15,7 @@
 package authn
 
 import (
+	"net/url"
 	"regexp"
 	"slices"
 	"strings"
@@ -39,6 +40,11 @@ const (
 // PortalConfig represents Portal configuration.
 type PortalConfig struct {
 	Name string `json:"name,omitempty" xml:"name,omitempty" yaml:"name,omitempty"`
+	// BaseURL is the external URL of the portal, e.g.
+	// https://auth.example.com/auth. It is used for the links leaving
+	// the context of a request, e.g. in recovery emails, instead of the
+	// Host header of the request.
+	BaseURL string `json:"base_url,omitempty" xml:"base_url,omitempty" yaml:"base_url,omitempty"`
 	// UI holds the configuration for the user interface.
 	UI *ui.Parameters `json:"ui,omitempty" xml:"ui,omitempty" yaml:"ui,omitempty"`
 	// UserTransformerConfig holds the configuration for the user transformer.
@@ -86,6 +92,14 @@ type PortalConfig struct {
 	guestPortalRoles        []string
 	// API holds the configuration for API endpoints.
 	API *APIConfig `json:"api,omitempty" xml:"api,omitempty" yaml:"api,omitempty"`
+	// Recovery holds the configuration for password and username recovery.
+	Recovery *RecoveryConfig `json:"recovery,omitempty" xml:"recovery,omitempty" yaml:"recovery,omitempty"`
+	// TokenRefresh holds the configuration for refresh tokens and the
+	// sliding renewal of access tokens.
+	TokenRefresh *TokenRefreshConfig `json:"token_refresh,omitempty" xml:"token_refresh,omitempty" yaml:"token_refresh,omitempty"`
+	// OpenIDConnect holds the configuration of the OpenID Connect provider,
+	// i.e. the registered clients the portal issues ID tokens to.
+	OpenIDConnect *OpenIDConnectConfig `json:"open_id_connect,omitempty" xml:"open_id_connect,omitempty" yaml:"open_id_connect,omitempty"`
 
 	// Holds raw crypto configuration.
 	cryptoRawConfigs []string
@@ -252,6 +266,39 @@ func (cfg *PortalConfig) Validate() error {
 		}
 	}
 
+	if cfg.BaseURL != "" {
+		u, err := url.Parse(cfg.BaseURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+			return errors.ErrPortalConfigBaseURLInvalid.WithArgs(cfg.Name, cfg.BaseURL)
+		}
+		cfg.BaseURL = strings.TrimSuffix(cfg.BaseURL, "/")
+	}
+
+	if cfg.Recovery != nil {
+		if cfg.BaseURL == "" {
+			return errors.ErrRecoveryConfigBaseURLEmpty.WithArgs(cfg.Name)
+		}
+		if err := cfg.Recovery.Validate(cfg.Name); err != nil {
+			return err
+		}
+	}
+
+	if cfg.TokenRefresh != nil {
+		if err := cfg.TokenRefresh.Validate(cfg.Name); err != nil {
+			return err
+		}
+	}
+
+	if cfg.OpenIDConnect != nil {
+		// The issuer of ID tokens must not depend on the Host header.
+		if cfg.BaseURL == "" {
+			return errors.ErrOpenIDConnectConfigBaseURLEmpty.WithArgs(cfg.Name)
+		}
+		if err := cfg.OpenIDConnect.Validate(cfg.Name); err != nil {
+			return err
+		}
+	}
+
 	// Inialize user interface settings
 	if cfg.UI == nil {
 		cfg.UI = &ui.Parameters{}
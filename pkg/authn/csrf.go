@@ -0,0 +1,46 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authn
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+
+	"github.com/greenpau/go-authcrunch/pkg/user"
+)
+
+const csrfTokenPrefix = "authp-csrf:"
+
+// getCSRFToken returns the anti-forgery token bound to the access token of
+// the user. The access token is held in a cookie not readable by scripts,
+// so a cross-site request cannot produce a matching value.
+func getCSRFToken(usr *user.User) string {
+	if usr == nil || usr.Token == "" {
+		return ""
+	}
+	h := sha256.Sum256([]byte(csrfTokenPrefix + usr.Token))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
+
+// validCSRFToken checks whether the provided anti-forgery token matches the
+// access token of the user.
+func validCSRFToken(usr *user.User, s string) bool {
+	expected := getCSRFToken(usr)
+	if expected == "" || s == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(s)) == 1
+}
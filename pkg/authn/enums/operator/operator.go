@@ -68,6 +68,24 @@ const (
 	// LookupAPIKey operator signals the retrieval of user identity associated
 	// with an API key
 	LookupAPIKey
+	// DisableUser operator signals the disabling of a user.
+	DisableUser
+	// EnableUser operator signals the enabling of a previously disabled user.
+	EnableUser
+	// UpdateUserRoles operator signals the replacement of user roles.
+	UpdateUserRoles
+	// UnlockUser operator signals the removal of a user lockout.
+	UnlockUser
+	// LookupUser operator signals the lookup of a user by email address.
+	LookupUser
+	// ResetPassword operator signals the reset of a forgotten password.
+	ResetPassword
+	// RefreshSession operator signals the renewal of a user session with
+	// an identity provider.
+	RefreshSession
+	// Logout operator signals the termination of a user session with an
+	// identity provider.
+	Logout
 )
 
 // String returns string representation of an operator.
@@ -117,6 +135,22 @@ func (e Type) String() string {
 		return "IdentifyUser"
 	case LookupAPIKey:
 		return "LookupAPIKey"
+	case DisableUser:
+		return "DisableUser"
+	case EnableUser:
+		return "EnableUser"
+	case UpdateUserRoles:
+		return "UpdateUserRoles"
+	case UnlockUser:
+		return "UnlockUser"
+	case LookupUser:
+		return "LookupUser"
+	case ResetPassword:
+		return "ResetPassword"
+	case RefreshSession:
+		return "RefreshSession"
+	case Logout:
+		return "Logout"
 	}
 	return fmt.Sprintf("Type(%d)", int(e))
 }
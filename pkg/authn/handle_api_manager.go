@@ -0,0 +1,174 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authn
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/greenpau/go-authcrunch/pkg/authn/enums/operator"
+	"github.com/greenpau/go-authcrunch/pkg/requests"
+	"github.com/greenpau/go-authcrunch/pkg/user"
+	addrutil "github.com/greenpau/go-authcrunch/pkg/util/addr"
+	"go.uber.org/zap"
+)
+
+// handleAPIManager handles the user management requests of portal
+// administrators. The requests operate on the identity store the
+// administrator authenticated with. The admin role of the administrator is
+// checked by handleAPI.
+func (p *Portal) handleAPIManager(ctx context.Context, w http.ResponseWriter, r *http.Request, rr *requests.Request, parsedUser *user.User) error {
+	resp := make(map[string]interface{})
+	resp["timestamp"] = time.Now().UTC().Format(time.RFC3339Nano)
+
+	if parsedUser == nil {
+		resp["message"] = "Manager API received nil user"
+		return handleAPIProfileResponse(w, rr, http.StatusBadRequest, resp)
+	}
+
+	usr, err := p.sessions.Get(parsedUser.Claims.ID)
+	if err != nil {
+		p.logger.Warn(
+			"jti session not found",
+			zap.String("session_id", rr.Upstream.SessionID),
+			zap.String("request_id", rr.ID),
+			zap.String("jti", parsedUser.Claims.ID),
+			zap.Any("error", err),
+			zap.String("source_address", addrutil.GetSourceAddress(r)),
+		)
+		resp["message"] = "Manager API failed to locate JTI session"
+		return handleAPIProfileResponse(w, rr, http.StatusUnauthorized, resp)
+	}
+
+	defer r.Body.Close()
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		resp["message"] = "Manager API failed to parse request body"
+		return handleAPIProfileResponse(w, rr, http.StatusBadRequest, resp)
+	}
+	var bodyData map[string]interface{}
+	if err := json.Unmarshal(body, &bodyData); err != nil {
+		resp["message"] = "Manager API failed to parse request JSON body"
+		return handleAPIProfileResponse(w, rr, http.StatusBadRequest, resp)
+	}
+
+	var reqKind = "unknown"
+	if v, exists := bodyData["kind"]; exists {
+		if s, ok := v.(string); ok {
+			reqKind = s
+		}
+	}
+
+	switch reqKind {
+	case "fetch_users":
+	case "fetch_user":
+	case "add_user":
+	case "delete_user":
+	case "disable_user":
+	case "enable_user":
+	case "unlock_user":
+	case "update_user_roles":
+	default:
+		resp["message"] = "Manager API received unsupported request type"
+		return handleAPIProfileResponse(w, rr, http.StatusBadRequest, resp)
+	}
+
+	switch usr.Authenticator.Method {
+	case "local":
+	default:
+		resp["message"] = fmt.Sprintf("%s is not supported with manager API", usr.Authenticator.Method)
+		return handleAPIProfileResponse(w, rr, http.StatusNotImplemented, resp)
+	}
+
+	backend := p.getIdentityStoreByRealm(usr.Authenticator.Realm)
+	if backend == nil {
+		resp["message"] = fmt.Sprintf("backend for %s realm not found", usr.Authenticator.Realm)
+		return handleAPIProfileResponse(w, rr, http.StatusBadRequest, resp)
+	}
+
+	p.logger.Info(
+		"handling manager api request",
+		zap.String("session_id", rr.Upstream.SessionID),
+		zap.String("request_id", rr.ID),
+		zap.String("realm", usr.Authenticator.Realm),
+		zap.String("admin", usr.Claims.Subject),
+		zap.String("request_kind", reqKind),
+		zap.String("source_address", addrutil.GetSourceAddress(r)),
+	)
+
+	// Populate username (sub) and email address (email) of the administrator.
+	rr.User.Username = usr.Claims.Subject
+	rr.User.Email = usr.Claims.Email
+
+	switch reqKind {
+	case "fetch_users":
+		return p.fetchUsers(ctx, w, r, rr, resp, usr, backend)
+	case "fetch_user":
+		return p.fetchUser(ctx, w, r, rr, resp, usr, backend, bodyData)
+	case "add_user":
+		return p.addUser(ctx, w, r, rr, resp, usr, backend, bodyData)
+	case "delete_user":
+		return p.manageUser(ctx, w, r, rr, resp, usr, backend, bodyData, operator.DeleteUser)
+	case "disable_user":
+		return p.manageUser(ctx, w, r, rr, resp, usr, backend, bodyData, operator.DisableUser)
+	case "enable_user":
+		return p.manageUser(ctx, w, r, rr, resp, usr, backend, bodyData, operator.EnableUser)
+	case "unlock_user":
+		return p.manageUser(ctx, w, r, rr, resp, usr, backend, bodyData, operator.UnlockUser)
+	case "update_user_roles":
+		return p.manageUser(ctx, w, r, rr, resp, usr, backend, bodyData, operator.UpdateUserRoles)
+	}
+
+	resp["message"] = fmt.Sprintf("unsupported %s request kind with manager API", reqKind)
+	return handleAPIProfileResponse(w, rr, http.StatusNotImplemented, resp)
+}
+
+func extractManagedUserID(rr *requests.Request, bodyData map[string]interface{}) error {
+	v, exists := bodyData["id"]
+	if !exists {
+		return fmt.Errorf("did not find id in the request payload")
+	}
+	s, ok := v.(string)
+	if !ok || s == "" {
+		return fmt.Errorf("did find id in the request payload, but it is malformed")
+	}
+	rr.Query.ID = s
+	return nil
+}
+
+func extractManagedUserRoles(bodyData map[string]interface{}) ([]string, error) {
+	var roles []string
+	v, exists := bodyData["roles"]
+	if !exists {
+		return roles, nil
+	}
+	entries, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("did find key roles in the request payload, but it is malformed")
+	}
+	for _, entry := range entries {
+		s, ok := entry.(string)
+		if !ok || strings.TrimSpace(s) == "" {
+			return nil, fmt.Errorf("did find key roles in the request payload, but it is malformed")
+		}
+		roles = append(roles, strings.TrimSpace(s))
+	}
+	return roles, nil
+}
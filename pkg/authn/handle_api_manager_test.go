@@ -0,0 +1,270 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/greenpau/go-authcrunch/internal/tests"
+	"github.com/greenpau/go-authcrunch/internal/testutils"
+	"github.com/greenpau/go-authcrunch/pkg/ids"
+	"github.com/greenpau/go-authcrunch/pkg/requests"
+	logutil "github.com/greenpau/go-authcrunch/pkg/util/log"
+)
+
+func newTestAPIClient(t *testing.T, baseURL, username, password string) *http.Client {
+	cj, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Jar: cj}
+	b, _ := json.Marshal(&AuthRequest{Username: username, Password: password, Realm: "local"})
+	req, _ := http.NewRequest(http.MethodPost, baseURL+"/auth/login", bytes.NewReader(b))
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("failed authentication request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("failed authentication request: %d", resp.StatusCode)
+	}
+	return client
+}
+
+func TestHandleAPIManager(t *testing.T) {
+	db, err := testutils.CreateTestDatabase("TestHandleAPIManager")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	logger := logutil.NewLogger()
+	store, err := ids.NewIdentityStore(&ids.IdentityStoreConfig{
+		Name: "local_backend",
+		Kind: "local",
+		Params: map[string]interface{}{
+			"path":  db.GetPath(),
+			"realm": "local",
+		},
+	}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Configure(); err != nil {
+		t.Fatal(err)
+	}
+	portal, err := NewPortal(PortalParameters{
+		Config: &PortalConfig{
+			Name:           "myportal",
+			IdentityStores: []string{"local_backend"},
+			API: &APIConfig{
+				AdminEnabled: true,
+			},
+		},
+		Logger:         logger,
+		IdentityStores: []ids.IdentityStore{store},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := portal.ServeHTTP(context.Background(), w, r, requests.NewRequest()); err != nil {
+			t.Logf("failed serving request: %v", err)
+		}
+	}))
+	defer ts.Close()
+
+	adminClient := newTestAPIClient(t, ts.URL, tests.TestUser1, tests.TestPwd1)
+	userClient := newTestAPIClient(t, ts.URL, tests.TestUser2, tests.TestPwd2)
+
+	// The id of the user added by the test is substituted for the id
+	// placeholder in the subsequent requests.
+	var userID string
+
+	testcases := []struct {
+		name      string
+		nonAdmin  bool
+		data      map[string]interface{}
+		want      map[string]interface{}
+		checkUser bool
+	}{
+		{
+			name:     "test user without admin role",
+			nonAdmin: true,
+			data:     map[string]interface{}{"kind": "fetch_users"},
+			want: map[string]interface{}{
+				"status_code": http.StatusUnauthorized,
+			},
+		},
+		{
+			name: "test unsupported request kind",
+			data: map[string]interface{}{"kind": "foobar"},
+			want: map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Manager API received unsupported request type",
+			},
+		},
+		{
+			name: "test fetch users",
+			data: map[string]interface{}{"kind": "fetch_users"},
+			want: map[string]interface{}{
+				"status_code": http.StatusOK,
+				"entries":     2,
+			},
+		},
+		{
+			name: "test add user with password violating policy",
+			data: map[string]interface{}{
+				"kind":     "add_user",
+				"username": "amiller",
+				"password": "foo",
+				"email":    "amiller@contoso.com",
+			},
+			want: map[string]interface{}{
+				"status_code":                http.StatusBadRequest,
+				"password_policy_violations": []interface{}{"min_length"},
+			},
+		},
+		{
+			name: "test add user",
+			data: map[string]interface{}{
+				"kind":     "add_user",
+				"username": "amiller",
+				"password": "Qwerty!23456",
+				"email":    "amiller@contoso.com",
+				"roles":    []string{"authp/user"},
+			},
+			checkUser: true,
+			want: map[string]interface{}{
+				"status_code": http.StatusOK,
+				"username":    "amiller",
+				"roles":       []interface{}{"authp/user"},
+			},
+		},
+		{
+			name: "test update user roles",
+			data: map[string]interface{}{
+				"kind":  "update_user_roles",
+				"id":    "id",
+				"roles": []string{"authp/user", "viewer"},
+			},
+			want: map[string]interface{}{
+				"status_code": http.StatusOK,
+				"username":    "amiller",
+				"roles":       []interface{}{"authp/user", "viewer"},
+			},
+		},
+		{
+			name: "test disable user",
+			data: map[string]interface{}{
+				"kind": "disable_user",
+				"id":   "id",
+			},
+			want: map[string]interface{}{
+				"status_code": http.StatusOK,
+				"username":    "amiller",
+				"roles":       []interface{}{"authp/user", "viewer"},
+				"disabled":    true,
+			},
+		},
+		{
+			name: "test delete user",
+			data: map[string]interface{}{
+				"kind": "delete_user",
+				"id":   "id",
+			},
+			want: map[string]interface{}{
+				"status_code": http.StatusOK,
+				"entry":       "Deleted",
+			},
+		},
+		{
+			name: "test fetch deleted user",
+			data: map[string]interface{}{
+				"kind": "fetch_user",
+				"id":   "id",
+			},
+			want: map[string]interface{}{
+				"status_code": http.StatusNotFound,
+				"message":     "Manager API failed to get user",
+			},
+		},
+		{
+			name: "test fetch user without id",
+			data: map[string]interface{}{
+				"kind": "fetch_user",
+			},
+			want: map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"message":     "Manager API did not find id in the request payload",
+			},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			if tc.data["id"] == "id" {
+				tc.data["id"] = userID
+			}
+			client := adminClient
+			if tc.nonAdmin {
+				client = userClient
+			}
+			b, _ := json.Marshal(tc.data)
+			req, _ := http.NewRequest(http.MethodPost, ts.URL+"/auth/api/manager", bytes.NewReader(b))
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("failed manager api request: %v", err)
+			}
+			defer resp.Body.Close()
+			m := make(map[string]interface{})
+			json.NewDecoder(resp.Body).Decode(&m)
+			msgs = append(msgs, fmt.Sprintf("response: %v", m))
+
+			got := map[string]interface{}{
+				"status_code": resp.StatusCode,
+			}
+			for _, k := range []string{"message", "password_policy_violations"} {
+				if _, exists := tc.want[k]; exists {
+					got[k] = m[k]
+				}
+			}
+			if entries, ok := m["entries"].([]interface{}); ok {
+				got["entries"] = len(entries)
+			}
+			switch entry := m["entry"].(type) {
+			case string:
+				got["entry"] = entry
+			case map[string]interface{}:
+				got["username"] = entry["username"]
+				got["roles"] = entry["roles"]
+				if v, exists := entry["disabled"]; exists {
+					got["disabled"] = v
+				}
+				if tc.checkUser {
+					userID = entry["id"].(string)
+				}
+			}
+			tests.EvalObjectsWithLog(t, "response", tc.want, got, msgs)
+		})
+	}
+}
@@ -134,7 +134,7 @@ func (p *Portal) handleAPIProfile(ctx context.Context, w http.ResponseWriter, r
 	// Determine supported authentication methods.
 
 	switch usr.Authenticator.Method {
-	case "local":
+	case "local", "ldap":
 	default:
 		resp["message"] = fmt.Sprintf("%s is not supported with profile API", usr.Authenticator.Method)
 		return handleAPIProfileResponse(w, rr, http.StatusNotImplemented, resp)
@@ -18,8 +18,10 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
 
+	"github.com/greenpau/go-authcrunch/pkg/errors"
 	"github.com/greenpau/go-authcrunch/pkg/requests"
 	"github.com/greenpau/go-authcrunch/pkg/sso"
 	"github.com/greenpau/go-authcrunch/pkg/user"
@@ -32,15 +34,17 @@ type assumeRoleEntry struct {
 	ProviderName string
 }
 
+type serviceProviderEntry struct {
+	Name         string
+	ProviderName string
+}
+
 func (p *Portal) handleHTTPAppsSingleSignOn(ctx context.Context, w http.ResponseWriter, r *http.Request, rr *requests.Request, parsedUser *user.User) error {
 	p.disableClientCache(w)
 	p.injectRedirectURL(ctx, w, r, rr)
 
 	if parsedUser == nil {
-		if rr.Response.RedirectURL == "" {
-			return p.handleHTTPRedirect(ctx, w, r, rr, "/login?redirect_url="+r.RequestURI)
-		}
-		return p.handleHTTPRedirect(ctx, w, r, rr, "/login")
+		return p.handleHTTPAppsSingleSignOnRedirectLogin(ctx, w, r, rr)
 	}
 
 	usr, err := p.sessions.Get(parsedUser.Claims.ID)
@@ -53,10 +57,7 @@ func (p *Portal) handleHTTPAppsSingleSignOn(ctx context.Context, w http.Response
 			zap.Any("user", parsedUser.Claims),
 			zap.Error(err),
 		)
-		if rr.Response.RedirectURL == "" {
-			return p.handleHTTPRedirect(ctx, w, r, rr, "/login?redirect_url="+r.RequestURI)
-		}
-		return p.handleHTTPRedirect(ctx, w, r, rr, "/login")
+		return p.handleHTTPAppsSingleSignOnRedirectLogin(ctx, w, r, rr)
 	}
 
 	// Parse SSO provider name from URL.
@@ -77,13 +78,105 @@ func (p *Portal) handleHTTPAppsSingleSignOn(ctx context.Context, w http.Response
 	case sso.MetadataRequest:
 		return p.handleHTTPAppsSingleSignOnMetadata(ctx, w, r, rr, provider, roles)
 	case sso.AssumeRoleRequest:
-		return p.handleHTTPAppsSingleSignOnAssumeRole(ctx, w, r, rr, provider, roles, usr)
+		return p.handleHTTPAppsSingleSignOnAssumeRole(ctx, w, r, rr, provider, req, roles, usr)
+	case sso.SignOnRequest:
+		return p.handleHTTPAppsSingleSignOnAuthnRequest(ctx, w, r, rr, provider, usr)
+	case sso.LoginRequest:
+		return p.handleHTTPAppsSingleSignOnServiceProviderLogin(ctx, w, r, rr, provider, req, usr)
 	case sso.MenuRequest:
 		return p.handleHTTPAppsSingleSignOnMenu(ctx, w, r, rr, provider, roles, usr)
 	}
 	return p.handleHTTPAppsSingleSignOnMenu(ctx, w, r, rr, provider, roles, usr)
 }
 
+// handleHTTPAppsSingleSignOnRedirectLogin redirects unauthenticated users to
+// login. The authentication request of a service provider is saved, and the
+// users return to it after the login.
+func (p *Portal) handleHTTPAppsSingleSignOnRedirectLogin(ctx context.Context, w http.ResponseWriter, r *http.Request, rr *requests.Request) error {
+	req, err := sso.ParseRequestURL(r)
+	if err != nil || req.Kind != sso.SignOnRequest {
+		if rr.Response.RedirectURL == "" {
+			return p.handleHTTPRedirect(ctx, w, r, rr, "/login?redirect_url="+r.RequestURI)
+		}
+		return p.handleHTTPRedirect(ctx, w, r, rr, "/login")
+	}
+
+	provider, err := p.fetchSingleSignOnProvider(req.ProviderName)
+	if err != nil {
+		return p.handleHTTPRenderError(ctx, w, r, rr, err)
+	}
+
+	authnRequest, err := p.fetchSingleSignOnAuthnRequest(r, provider)
+	if err != nil {
+		p.logger.Warn(
+			"SSO request failed",
+			zap.String("session_id", rr.Upstream.SessionID),
+			zap.String("request_id", rr.ID),
+			zap.Error(err),
+		)
+		return p.handleHTTPRenderError(ctx, w, r, rr, err)
+	}
+
+	k, err := provider.SaveAuthnRequest(authnRequest)
+	if err != nil {
+		return p.handleHTTPRenderError(ctx, w, r, rr, err)
+	}
+	redirectURL := r.URL.Path + "?request_id=" + k
+	return p.handleHTTPRedirect(ctx, w, r, rr, "/login?redirect_url="+url.QueryEscape(redirectURL))
+}
+
+// handleHTTPAppsSingleSignOnAuthnRequest responds to the authentication
+// request of a service provider.
+func (p *Portal) handleHTTPAppsSingleSignOnAuthnRequest(ctx context.Context, w http.ResponseWriter, r *http.Request, rr *requests.Request,
+	provider sso.SingleSignOnProvider, usr *user.User) error {
+	authnRequest, err := p.fetchSingleSignOnAuthnRequest(r, provider)
+	if err != nil {
+		p.logger.Warn(
+			"SSO request failed",
+			zap.String("session_id", rr.Upstream.SessionID),
+			zap.String("request_id", rr.ID),
+			zap.Error(err),
+		)
+		return p.handleHTTPRenderError(ctx, w, r, rr, err)
+	}
+	return p.handleHTTPAppsSingleSignOnResponse(ctx, w, r, rr, provider, authnRequest, usr)
+}
+
+// handleHTTPAppsSingleSignOnServiceProviderLogin logs the user in to the
+// service provider selected in the portal.
+func (p *Portal) handleHTTPAppsSingleSignOnServiceProviderLogin(ctx context.Context, w http.ResponseWriter, r *http.Request, rr *requests.Request,
+	provider sso.SingleSignOnProvider, req *sso.Request, usr *user.User) error {
+	authnRequest, err := provider.NewAuthnRequest(req.Params, r.URL.Query().Get("RelayState"))
+	if err != nil {
+		return p.handleHTTPRenderError(ctx, w, r, rr, err)
+	}
+	return p.handleHTTPAppsSingleSignOnResponse(ctx, w, r, rr, provider, authnRequest, usr)
+}
+
+func (p *Portal) handleHTTPAppsSingleSignOnResponse(ctx context.Context, w http.ResponseWriter, r *http.Request, rr *requests.Request,
+	provider sso.SingleSignOnProvider, authnRequest *sso.AuthnRequest, usr *user.User) error {
+	body, err := provider.SignOn(authnRequest, usr.AsMap())
+	if err != nil {
+		p.logger.Warn(
+			"SSO request failed",
+			zap.String("session_id", rr.Upstream.SessionID),
+			zap.String("request_id", rr.ID),
+			zap.String("service_provider", authnRequest.ServiceProviderName),
+			zap.Error(err),
+		)
+		return p.handleHTTPRenderError(ctx, w, r, rr, err)
+	}
+
+	p.logger.Debug(
+		"SSO response served",
+		zap.String("session_id", rr.Upstream.SessionID),
+		zap.String("request_id", rr.ID),
+		zap.String("service_provider", authnRequest.ServiceProviderName),
+		zap.String("acs_url", authnRequest.AcsURL),
+	)
+	return p.handleHTTPRenderHTML(ctx, w, http.StatusOK, body)
+}
+
 // handleHTTPAppsSingleSignOnMetadata renders metadata.xml content. It is only available to admin users.
 func (p *Portal) handleHTTPAppsSingleSignOnMetadata(ctx context.Context, w http.ResponseWriter, r *http.Request, rr *requests.Request,
 	provider sso.SingleSignOnProvider, roles []*assumeRoleEntry) error {
@@ -97,68 +190,72 @@ func (p *Portal) handleHTTPAppsSingleSignOnMetadata(ctx context.Context, w http.
 	return nil
 }
 
+// handleHTTPAppsSingleSignOnAssumeRole submits a signed SAML response for the
+// requested role to the SSO provider.
 func (p *Portal) handleHTTPAppsSingleSignOnAssumeRole(ctx context.Context, w http.ResponseWriter, r *http.Request, rr *requests.Request,
-	provider sso.SingleSignOnProvider, roles []*assumeRoleEntry, usr *user.User) error {
+	provider sso.SingleSignOnProvider, req *sso.Request, roles []*assumeRoleEntry, usr *user.User) error {
 
-	/*
-		if strings.Contains(r.URL.Path, "/apps/sso/assume") {
-			accountRole, err := getEndpoint(r.URL.Path, "/apps/sso/assume/")
-			if err != nil {
-				p.logger.Warn(
-					"SSO request failed",
-					zap.String("session_id", rr.Upstream.SessionID),
-					zap.String("request_id", rr.ID),
-					zap.String("error", "malformed SSO request"),
-				)
-			} else {
-				assumedRole = true
-				arr := strings.SplitN(accountRole, "/", 2)
-				if len(arr) != 2 {
-					return p.handleHTTPRenderError(ctx, w, r, rr, fmt.Errorf("Malformed SSO request"))
-				}
-				accountID = arr[0]
-				roleName = arr[1]
-			}
-		}
-	*/
-
-	/*
-			if assumedRole {
-			if (role.Name == roleName) && (role.AccountID == accountID) {
-				authorizedRole = true
-				p.logger.Debug(
-					"SSO assume role request received",
-					zap.String("session_id", rr.Upstream.SessionID),
-					zap.String("request_id", rr.ID),
-					zap.String("role_name", roleName),
-					zap.String("account_id", accountID),
-				)
-			}
-		}
-	*/
-
-	/*
-			if assumedRole {
-			if !authorizedRole {
-				p.logger.Debug(
-					"Unauthorized SSO assume role request",
-					zap.String("session_id", rr.Upstream.SessionID),
-					zap.String("request_id", rr.ID),
-					zap.String("role_name", roleName),
-					zap.String("account_id", accountID),
-				)
-				return p.handleHTTPRenderError(ctx, w, r, rr, fmt.Errorf("Unauthorized SSO assume role request"))
-			}
-			p.logger.Debug("Redirecting to SAML endpoint")
+	arr := strings.SplitN(req.Params, "/", 2)
+	if len(arr) != 2 || arr[0] == "" || arr[1] == "" {
+		p.logger.Warn(
+			"SSO request failed",
+			zap.String("session_id", rr.Upstream.SessionID),
+			zap.String("request_id", rr.ID),
+			zap.String("error", "malformed SSO request"),
+		)
+		return p.handleHTTPRenderError(ctx, w, r, rr, errors.ErrSingleSignOnProviderRequestMalformed)
+	}
+	accountID := arr[0]
+	roleName := arr[1]
+
+	var authorizedRole bool
+	for _, role := range roles {
+		if (role.Name == roleName) && (role.AccountID == accountID) {
+			authorizedRole = true
+			break
 		}
+	}
 
-	*/
+	if !authorizedRole {
+		p.logger.Debug(
+			"Unauthorized SSO assume role request",
+			zap.String("session_id", rr.Upstream.SessionID),
+			zap.String("request_id", rr.ID),
+			zap.String("role_name", roleName),
+			zap.String("account_id", accountID),
+		)
+		return p.handleHTTPRenderError(ctx, w, r, rr, errors.ErrSingleSignOnProviderRoleUnauthorized.WithArgs(roleName, accountID))
+	}
 
-	body := []byte("ASSUME ROLE")
-	w.Header().Set("Content-Type", "text/html")
-	w.WriteHeader(http.StatusOK)
-	w.Write(body)
-	return nil
+	p.logger.Debug(
+		"SSO assume role request received",
+		zap.String("session_id", rr.Upstream.SessionID),
+		zap.String("request_id", rr.ID),
+		zap.String("role_name", roleName),
+		zap.String("account_id", accountID),
+	)
+
+	sessionName := usr.Claims.Email
+	if sessionName == "" {
+		sessionName = usr.Claims.Subject
+	}
+
+	body, err := provider.AssumeRole(&sso.AssumeRoleParams{
+		AccountID:   accountID,
+		RoleName:    roleName,
+		SessionName: sessionName,
+	})
+	if err != nil {
+		p.logger.Warn(
+			"SSO request failed",
+			zap.String("session_id", rr.Upstream.SessionID),
+			zap.String("request_id", rr.ID),
+			zap.Error(err),
+		)
+		return p.handleHTTPRenderError(ctx, w, r, rr, err)
+	}
+
+	return p.handleHTTPRenderHTML(ctx, w, http.StatusOK, body)
 }
 
 // handleHTTPAppsSingleSignOnMenu renders SSO provider role selection page.
@@ -170,6 +267,17 @@ func (p *Portal) handleHTTPAppsSingleSignOnMenu(ctx context.Context, w http.Resp
 	resp.BaseURL(rr.Upstream.BasePath)
 	resp.Data["role_count"] = len(roles)
 	resp.Data["roles"] = roles
+	if provider.GetDriver() == "generic" {
+		var entries []*serviceProviderEntry
+		for _, name := range provider.GetServiceProviders() {
+			entries = append(entries, &serviceProviderEntry{
+				Name:         name,
+				ProviderName: provider.GetName(),
+			})
+		}
+		resp.PageTitle = "Single Sign-On"
+		resp.Data["service_providers"] = entries
+	}
 
 	content, err := p.ui.Render("apps_sso", resp)
 	if err != nil {
@@ -187,6 +295,17 @@ func (p *Portal) fetchSingleSignOnProvider(providerName string) (sso.SingleSignO
 	return nil, fmt.Errorf("provider name not found")
 }
 
+// fetchSingleSignOnAuthnRequest returns the authentication request saved
+// before the login or the one in the request.
+func (p *Portal) fetchSingleSignOnAuthnRequest(r *http.Request, provider sso.SingleSignOnProvider) (*sso.AuthnRequest, error) {
+	if r.Method == http.MethodGet {
+		if k := r.URL.Query().Get("request_id"); k != "" {
+			return provider.LoadAuthnRequest(k)
+		}
+	}
+	return provider.ParseAuthnRequest(r)
+}
+
 func (p *Portal) parseSingleSignOnProviderName() (string, string, error) {
 	return "aws", "metadata", nil
 }
@@ -24,6 +24,7 @@ import (
 	"time"
 
 	"github.com/greenpau/go-authcrunch/pkg/authn/enums/operator"
+	"github.com/greenpau/go-authcrunch/pkg/errors"
 	"github.com/greenpau/go-authcrunch/pkg/idp"
 	"github.com/greenpau/go-authcrunch/pkg/ids"
 	"github.com/greenpau/go-authcrunch/pkg/requests"
@@ -272,6 +273,11 @@ func (p *Portal) authenticateLoginRequest(ctx context.Context, w http.ResponseWr
 		return err
 	}
 
+	// The expired password is changed in the browser only.
+	if hasPendingPasswordChange(rr.User.Challenges) {
+		rr.Response.Code = http.StatusUnauthorized
+		return errors.ErrUserPasswordExpired
+	}
 	if len(rr.User.Challenges) != 1 {
 		return fmt.Errorf("detected too many auth challenges")
 	}
@@ -402,6 +408,26 @@ func (p *Portal) grantAccess(ctx context.Context, w http.ResponseWriter, r *http
 	rr.Response.Authenticated = true
 	usr.Authorized = true
 	p.sessions.Add(rr.Upstream.SessionID, usr)
+	if p.upstreamSessions != nil && rr.Session.RefreshToken != "" {
+		if err := p.upstreamSessions.add(rr.Upstream.SessionID, rr.Upstream.Realm, rr.Session.RefreshToken); err != nil {
+			p.logger.Warn(
+				"failed storing upstream session",
+				zap.String("session_id", rr.Upstream.SessionID),
+				zap.String("request_id", rr.ID),
+				zap.Error(err),
+			)
+		}
+	}
+	if p.samlSessions != nil && rr.Upstream.Method == "saml" && rr.Session.NameID != "" {
+		if err := p.samlSessions.add(rr.Upstream.SessionID, rr.Upstream.Realm, rr.Session); err != nil {
+			p.logger.Warn(
+				"failed storing saml session",
+				zap.String("session_id", rr.Upstream.SessionID),
+				zap.String("request_id", rr.ID),
+				zap.Error(err),
+			)
+		}
+	}
 
 	w.Header().Set("Authorization", "Bearer "+usr.Token)
 	w.Header().Set("Set-Cookie", p.cookie.GetCookie(h, usr.TokenName, usr.Token))
@@ -563,3 +589,15 @@ func (p *Portal) transformUser(ctx context.Context, rr *requests.Request, m map[
 	)
 	return nil
 }
+
+// hasPendingPasswordChange returns true when the challenges of the user
+// include the change of the expired password. No tokens are issued to the
+// user until the password is changed.
+func hasPendingPasswordChange(challenges []string) bool {
+	for _, challenge := range challenges {
+		if challenge == "password_change" {
+			return true
+		}
+	}
+	return false
+}
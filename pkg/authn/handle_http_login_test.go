@@ -0,0 +1,115 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authn
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/greenpau/go-authcrunch/internal/tests"
+	"github.com/greenpau/go-authcrunch/internal/testutils"
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/ids"
+	"github.com/greenpau/go-authcrunch/pkg/requests"
+	"github.com/greenpau/go-authcrunch/pkg/user"
+	logutil "github.com/greenpau/go-authcrunch/pkg/util/log"
+)
+
+func TestExpiredPasswordBlocksTokens(t *testing.T) {
+	db, err := testutils.CreateTestDatabase("TestExpiredPasswordBlocksTokens")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+
+	// Expire the password of the user.
+	b, err := os.ReadFile(db.GetPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	m["policy"].(map[string]interface{})["password"].(map[string]interface{})["max_age_days"] = 90
+	for _, entry := range m["users"].([]interface{}) {
+		u := entry.(map[string]interface{})
+		if u["username"] != tests.TestUser1 {
+			continue
+		}
+		for _, p := range u["passwords"].([]interface{}) {
+			p.(map[string]interface{})["created_at"] = time.Now().Add(-91 * 24 * time.Hour).UTC()
+		}
+	}
+	if b, err = json.Marshal(m); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(db.GetPath(), b, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	logger := logutil.NewLogger()
+	store, err := ids.NewIdentityStore(&ids.IdentityStoreConfig{
+		Name: "local_backend",
+		Kind: "local",
+		Params: map[string]interface{}{
+			"path":  db.GetPath(),
+			"realm": "local",
+		},
+	}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Configure(); err != nil {
+		t.Fatal(err)
+	}
+	portal, err := NewPortal(PortalParameters{
+		Config: &PortalConfig{
+			Name:           "myportal",
+			IdentityStores: []string{"local_backend"},
+		},
+		Logger:         logger,
+		IdentityStores: []ids.IdentityStore{store},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The expired password is changed in the browser only.
+	rr := requests.NewRequest()
+	err = portal.authenticateLoginRequest(context.Background(), httptest.NewRecorder(), httptest.NewRequest("POST", "/login", nil), rr, map[string]string{
+		"username": tests.TestUser1,
+		"password": tests.TestPwd1,
+		"realm":    "local",
+	})
+	tests.EvalErrWithLog(t, err, "login", true, errors.ErrUserPasswordExpired, []string{})
+
+	// The tokens issued prior to the expiry are not renewed.
+	usr, err := user.NewUser(map[string]interface{}{
+		"jti": "a1b2c3",
+		"sub": tests.TestUser1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	usr.Authenticator.Name = "local_backend"
+	usr.Authenticator.Realm = "local"
+	usr.Authenticator.Method = "local"
+	_, err = portal.refreshUser(context.Background(), requests.NewRequest(), usr)
+	tests.EvalErrWithLog(t, err, "refresh user", true, errors.ErrUserPasswordExpired, []string{})
+}
@@ -49,9 +49,15 @@ func (p *Portal) handleHTTPLogout(ctx context.Context, w http.ResponseWriter, r
 			zap.String("request_id", rr.ID),
 			zap.Any("user", parsedUser.Claims),
 		)
+		samlLogoutURL := p.requestSamlLogout(r, rr, parsedUser)
+		p.revokeLogoutTokens(r, rr, parsedUser)
 		if strings.Contains(parsedUser.Claims.Issuer, "/oauth2/") {
 			return p.handleHTTPRedirect(ctx, w, r, rr, extractRealmLogout(parsedUser.Claims.Issuer, "oauth2"))
 		}
+		if samlLogoutURL != "" {
+			// The identity provider redirects the user back to the portal.
+			return p.handleHTTPRedirectExternal(ctx, w, r, rr, samlLogoutURL)
+		}
 		// The user is authenticated. Find whether there is redirect_uri present in Query.
 		if redirects.HasRedirectURI(r.URL) && (len(p.config.TrustedLogoutRedirectURIConfigs) > 0) {
 			p.logger.Debug(
@@ -114,6 +120,58 @@ func (p *Portal) handleHTTPLogoutWithLocalRedirect(ctx context.Context, w http.R
 	return p.handleHTTPRedirect(ctx, w, r, rr, "/login")
 }
 
+// revokeLogoutTokens revokes the token of the user logging out, so that
+// the token is no longer accepted by gatekeepers. All the tokens issued to
+// the user are revoked only when the request is a POST carrying the
+// everywhere form field set to true and a valid anti-forgery token.
+func (p *Portal) revokeLogoutTokens(r *http.Request, rr *requests.Request, parsedUser *user.User) {
+	p.sessions.Delete(parsedUser.Claims.ID)
+	if p.refreshTokens != nil {
+		p.refreshTokens.revokeSession(parsedUser.Claims.ID)
+		p.upstreamSessions.delete(parsedUser.Claims.ID)
+	}
+	if p.samlSessions != nil {
+		p.samlSessions.delete(parsedUser.Claims.ID)
+	}
+	if err := p.revokeToken(parsedUser); err != nil {
+		p.logger.Warn(
+			"failed revoking token on logout",
+			zap.String("session_id", rr.Upstream.SessionID),
+			zap.String("request_id", rr.ID),
+			zap.String("jti", parsedUser.Claims.ID),
+			zap.Error(err),
+		)
+	}
+	if r.Method != http.MethodPost || r.PostFormValue("everywhere") != "true" || parsedUser.Claims.Subject == "" {
+		return
+	}
+	if !validCSRFToken(parsedUser, r.PostFormValue("csrf_token")) {
+		p.logger.Warn(
+			"rejected logout everywhere with invalid csrf token",
+			zap.String("session_id", rr.Upstream.SessionID),
+			zap.String("request_id", rr.ID),
+			zap.String("sub", parsedUser.Claims.Subject),
+		)
+		return
+	}
+	if err := p.revokeSubject(parsedUser.Claims.Subject); err != nil {
+		p.logger.Warn(
+			"failed revoking user tokens on logout",
+			zap.String("session_id", rr.Upstream.SessionID),
+			zap.String("request_id", rr.ID),
+			zap.String("sub", parsedUser.Claims.Subject),
+			zap.Error(err),
+		)
+		return
+	}
+	p.logger.Info(
+		"user logged out everywhere",
+		zap.String("session_id", rr.Upstream.SessionID),
+		zap.String("request_id", rr.ID),
+		zap.String("sub", parsedUser.Claims.Subject),
+	)
+}
+
 func extractRealmLogout(s, sp string) string {
 	var ready bool
 	for _, k := range strings.Split(s, "/") {
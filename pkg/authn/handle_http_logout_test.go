@@ -0,0 +1,159 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authn
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/greenpau/go-authcrunch/internal/tests"
+	"github.com/greenpau/go-authcrunch/internal/testutils"
+	"github.com/greenpau/go-authcrunch/pkg/ids"
+	"github.com/greenpau/go-authcrunch/pkg/requests"
+	"github.com/greenpau/go-authcrunch/pkg/revocation"
+	"github.com/greenpau/go-authcrunch/pkg/user"
+	logutil "github.com/greenpau/go-authcrunch/pkg/util/log"
+)
+
+func TestLogoutEverywhere(t *testing.T) {
+	db, err := testutils.CreateTestDatabase("TestLogoutEverywhere")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	logger := logutil.NewLogger()
+	store, err := ids.NewIdentityStore(&ids.IdentityStoreConfig{
+		Name: "local_backend",
+		Kind: "local",
+		Params: map[string]interface{}{
+			"path":  db.GetPath(),
+			"realm": "local",
+		},
+	}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Configure(); err != nil {
+		t.Fatal(err)
+	}
+
+	newUser := func() *user.User {
+		return &user.User{
+			Claims: &user.Claims{
+				ID:        "a1b2c3",
+				Subject:   "jsmith",
+				ExpiresAt: time.Now().Add(time.Hour).Unix(),
+			},
+			Token: "eyJhbGciOiJIUzI1NiJ9.e30.foobar",
+		}
+	}
+
+	testcases := []struct {
+		name   string
+		method string
+		form   url.Values
+		want   map[string]interface{}
+	}{
+		{
+			name:   "test logout everywhere with valid csrf token",
+			method: http.MethodPost,
+			form: url.Values{
+				"everywhere": []string{"true"},
+				"csrf_token": []string{getCSRFToken(newUser())},
+			},
+			want: map[string]interface{}{
+				"token_revoked":   true,
+				"subject_revoked": true,
+			},
+		},
+		{
+			name:   "test logout everywhere without csrf token",
+			method: http.MethodPost,
+			form: url.Values{
+				"everywhere": []string{"true"},
+			},
+			want: map[string]interface{}{
+				"token_revoked":   true,
+				"subject_revoked": false,
+			},
+		},
+		{
+			name:   "test logout everywhere with csrf token of another user",
+			method: http.MethodPost,
+			form: url.Values{
+				"everywhere": []string{"true"},
+				"csrf_token": []string{getCSRFToken(&user.User{Token: "foobar"})},
+			},
+			want: map[string]interface{}{
+				"token_revoked":   true,
+				"subject_revoked": false,
+			},
+		},
+		{
+			name:   "test logout everywhere with get request",
+			method: http.MethodGet,
+			form: url.Values{
+				"everywhere": []string{"true"},
+				"csrf_token": []string{getCSRFToken(newUser())},
+			},
+			want: map[string]interface{}{
+				"token_revoked":   true,
+				"subject_revoked": false,
+			},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			portal, err := NewPortal(PortalParameters{
+				Config: &PortalConfig{
+					Name:           "myportal",
+					IdentityStores: []string{"local_backend"},
+				},
+				Logger:         logger,
+				IdentityStores: []ids.IdentityStore{store},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			l, err := revocation.NewList(&revocation.Config{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			portal.SetRevocationList(l)
+
+			var r *http.Request
+			if tc.method == http.MethodPost {
+				r = httptest.NewRequest(tc.method, "/auth/logout", strings.NewReader(tc.form.Encode()))
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			} else {
+				r = httptest.NewRequest(tc.method, "/auth/logout?"+tc.form.Encode(), nil)
+			}
+			usr := newUser()
+			portal.revokeLogoutTokens(r, requests.NewRequest(), usr)
+
+			issuedAt := time.Now().Add(-1 * time.Minute).Unix()
+			got := map[string]interface{}{
+				"token_revoked":   l.IsRevoked(usr.Claims.ID, "", issuedAt),
+				"subject_revoked": l.IsRevoked("d4e5f6", usr.Claims.Subject, issuedAt),
+			}
+			tests.EvalObjectsWithLog(t, "revocation", tc.want, got, msgs)
+		})
+	}
+}
@@ -65,10 +65,10 @@ func (p *Portal) handleHTTPPortal(ctx context.Context, w http.ResponseWriter, r
 		)
 		return p.handleHTTPRedirect(ctx, w, r, rr, "/login")
 	}
-	return p.handleHTTPPortalScreen(ctx, w, r, rr, usr)
+	return p.handleHTTPPortalScreen(ctx, w, r, rr, usr, getCSRFToken(parsedUser))
 }
 
-func (p *Portal) handleHTTPPortalScreen(ctx context.Context, w http.ResponseWriter, r *http.Request, rr *requests.Request, usr *user.User) error {
+func (p *Portal) handleHTTPPortalScreen(ctx context.Context, w http.ResponseWriter, r *http.Request, rr *requests.Request, usr *user.User, csrfToken string) error {
 	if cookie, err := r.Cookie(p.cookie.Referer); err == nil {
 		redirectURL, err := url.Parse(cookie.Value)
 		if err == nil {
@@ -87,6 +87,7 @@ func (p *Portal) handleHTTPPortalScreen(ctx context.Context, w http.ResponseWrit
 	resp := p.ui.GetArgs()
 	resp.BaseURL(rr.Upstream.BasePath)
 	resp.PageTitle = "Applications"
+	resp.Data["csrf_token"] = csrfToken
 	if len(usr.FrontendLinks) > 0 {
 		// Add additional frontend links.
 		resp.AddFrontendLinks(usr.FrontendLinks)
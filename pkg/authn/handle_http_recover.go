@@ -16,12 +16,414 @@ package authn
 
 import (
 	"context"
-	"github.com/greenpau/go-authcrunch/pkg/requests"
+	"errors"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/greenpau/go-authcrunch/pkg/authn/enums/operator"
+	"github.com/greenpau/go-authcrunch/pkg/authn/validators"
+	autherrors "github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/identity"
+	"github.com/greenpau/go-authcrunch/pkg/ids"
+	"github.com/greenpau/go-authcrunch/pkg/requests"
+	addrutil "github.com/greenpau/go-authcrunch/pkg/util/addr"
+	"go.uber.org/zap"
 )
 
+type recoverRequest struct {
+	view       string
+	realm      string
+	token      string
+	message    string
+	violations []string
+}
+
 func (p *Portal) handleHTTPRecover(ctx context.Context, w http.ResponseWriter, r *http.Request, rr *requests.Request) error {
 	p.disableClientCache(w)
-	// TODO(greenpau): implement
-	return p.handleHTTPError(ctx, w, r, rr, http.StatusNotImplemented)
+	if rr.Response.Authenticated {
+		// Authenticated users do not need recovery.
+		return p.handleHTTPRedirect(ctx, w, r, rr, "/portal")
+	}
+	if p.config.Recovery == nil || p.recovery == nil {
+		return p.handleHTTPError(ctx, w, r, rr, http.StatusServiceUnavailable)
+	}
+
+	kind := "password"
+	endpoint := "/recover"
+	if strings.Contains(r.URL.Path, "/forgot") {
+		kind = "username"
+		endpoint = "/forgot"
+	}
+
+	req := &recoverRequest{view: kind}
+	if s, err := getEndpoint(r.URL.Path, endpoint+"/"); err == nil {
+		req.realm = strings.Split(s, "/")[0]
+	}
+
+	if r.Method != "POST" {
+		if kind == "password" && r.URL.Query().Get("token") != "" {
+			// Handle password reset landing page.
+			req.token = r.URL.Query().Get("token")
+			req.view = "reset"
+			if _, err := p.recovery.parse(req.token); err != nil {
+				p.logger.Warn(
+					"invalid password reset token",
+					zap.String("session_id", rr.Upstream.SessionID),
+					zap.String("request_id", rr.ID),
+					zap.String("src_ip", addrutil.GetSourceAddress(r)),
+					zap.String("src_conn_ip", addrutil.GetSourceConnAddress(r)),
+					zap.Error(err),
+				)
+				req.view = "resetfail"
+			}
+		}
+		return p.handleHTTPRecoverScreenWithMessage(ctx, w, r, rr, req)
+	}
+
+	if err := validateRecoverForm(r); err != nil {
+		p.logger.Warn(
+			"recovery request is non compliant",
+			zap.String("session_id", rr.Upstream.SessionID),
+			zap.String("request_id", rr.ID),
+			zap.String("src_ip", addrutil.GetSourceAddress(r)),
+			zap.String("src_conn_ip", addrutil.GetSourceConnAddress(r)),
+			zap.Error(err),
+		)
+		req.message = "Recovery request is non compliant"
+		return p.handleHTTPRecoverScreenWithMessage(ctx, w, r, rr, req)
+	}
+
+	if kind == "password" && r.PostFormValue("token") != "" {
+		// Handle password reset.
+		req.token = r.PostFormValue("token")
+		return p.handleHTTPRecoverReset(ctx, w, r, rr, req)
+	}
+
+	if v := r.PostFormValue("realm"); v != "" {
+		req.realm = v
+	}
+	email := strings.TrimSpace(r.PostFormValue("email"))
+	if err := validators.ValidateUserInput("email", email, make(map[string]interface{})); err != nil {
+		req.message = "Failed processing the recovery form due " + err.Error()
+		return p.handleHTTPRecoverScreenWithMessage(ctx, w, r, rr, req)
+	}
+
+	p.requestRecovery(r, rr, kind, req.realm, email, "")
+
+	// The response does not reveal whether the account exists.
+	req.view = "sent"
+	return p.handleHTTPRecoverScreenWithMessage(ctx, w, r, rr, req)
+}
+
+func (p *Portal) handleHTTPRecoverReset(ctx context.Context, w http.ResponseWriter, r *http.Request, rr *requests.Request, req *recoverRequest) error {
+	req.view = "reset"
+
+	claims, err := p.recovery.parse(req.token)
+	if err != nil {
+		p.logger.Warn(
+			"invalid password reset token",
+			zap.String("session_id", rr.Upstream.SessionID),
+			zap.String("request_id", rr.ID),
+			zap.String("src_ip", addrutil.GetSourceAddress(r)),
+			zap.String("src_conn_ip", addrutil.GetSourceConnAddress(r)),
+			zap.Error(err),
+		)
+		req.view = "resetfail"
+		return p.handleHTTPRecoverScreenWithMessage(ctx, w, r, rr, req)
+	}
+
+	if r.PostFormValue("secret1") == "" {
+		req.message = "New password is empty"
+		return p.handleHTTPRecoverScreenWithMessage(ctx, w, r, rr, req)
+	}
+	if r.PostFormValue("secret1") != r.PostFormValue("secret2") {
+		req.message = "New password mismatch"
+		return p.handleHTTPRecoverScreenWithMessage(ctx, w, r, rr, req)
+	}
+
+	backend := p.getRecoveryIdentityStore(claims.Realm, "password")
+	if backend == nil {
+		req.view = "resetfail"
+		return p.handleHTTPRecoverScreenWithMessage(ctx, w, r, rr, req)
+	}
+
+	// Redeem the token prior to the reset to prevent concurrent reuse.
+	if err := p.recovery.redeem(claims); err != nil {
+		req.view = "resetfail"
+		return p.handleHTTPRecoverScreenWithMessage(ctx, w, r, rr, req)
+	}
+
+	rr.User.Username = claims.Username
+	rr.User.Email = claims.Email
+	rr.User.Password = r.PostFormValue("secret1")
+	rr.User.PasswordFingerprint = claims.Fingerprint
+	if err := backend.Request(operator.ResetPassword, rr); err != nil {
+		p.recovery.release(claims)
+		p.logger.Warn(
+			"password reset failed",
+			zap.String("session_id", rr.Upstream.SessionID),
+			zap.String("request_id", rr.ID),
+			zap.String("username", claims.Username),
+			zap.String("realm", claims.Realm),
+			zap.String("src_ip", addrutil.GetSourceAddress(r)),
+			zap.String("src_conn_ip", addrutil.GetSourceConnAddress(r)),
+			zap.Error(err),
+		)
+		var policyErr *identity.PasswordPolicyError
+		switch {
+		case errors.Is(err, autherrors.ErrUserPasswordChanged):
+			req.view = "resetfail"
+		case errors.As(err, &policyErr):
+			req.message = "The new password does not meet password policy requirements"
+			req.violations = policyErr.Rules
+		default:
+			req.message = "Failed resetting the password"
+		}
+		return p.handleHTTPRecoverScreenWithMessage(ctx, w, r, rr, req)
+	}
+
+	// The tokens issued with the old password, e.g. to whoever compromised
+	// the account, are no longer valid.
+	if err := p.revokeSubject(claims.Username); err != nil {
+		p.logger.Warn(
+			"failed revoking user tokens after password reset",
+			zap.String("session_id", rr.Upstream.SessionID),
+			zap.String("request_id", rr.ID),
+			zap.String("username", claims.Username),
+			zap.Error(err),
+		)
+	}
+
+	p.logger.Info(
+		"Successful password reset",
+		zap.String("session_id", rr.Upstream.SessionID),
+		zap.String("request_id", rr.ID),
+		zap.String("username", claims.Username),
+		zap.String("realm", claims.Realm),
+		zap.String("src_ip", addrutil.GetSourceAddress(r)),
+		zap.String("src_conn_ip", addrutil.GetSourceConnAddress(r)),
+	)
+	req.view = "resetdone"
+	return p.handleHTTPRecoverScreenWithMessage(ctx, w, r, rr, req)
+}
+
+func (p *Portal) handleHTTPRecoverScreenWithMessage(ctx context.Context, w http.ResponseWriter, r *http.Request, rr *requests.Request, req *recoverRequest) error {
+	resp := p.ui.GetArgs()
+	resp.BaseURL(rr.Upstream.BasePath)
+	resp.Data["view"] = req.view
+	resp.Data["realm"] = req.realm
+
+	switch req.view {
+	case "password":
+		resp.PageTitle = "Password Recovery"
+	case "username":
+		resp.PageTitle = "Username Recovery"
+	case "sent":
+		resp.PageTitle = "Recovery"
+	case "reset":
+		resp.PageTitle = "Password Reset"
+		resp.Data["token"] = req.token
+		if len(req.violations) > 0 {
+			resp.Data["password_policy_violations"] = req.violations
+		}
+	case "resetfail":
+		resp.PageTitle = "Password Reset"
+		resp.Data["message"] = "The password reset link is invalid or has expired"
+	case "resetdone":
+		resp.PageTitle = "Password Reset"
+	}
+
+	if req.message != "" {
+		resp.Message = req.message
+	}
+
+	content, err := p.ui.Render("recover", resp)
+	if err != nil {
+		return p.handleHTTPRenderError(ctx, w, r, rr, err)
+	}
+	return p.handleHTTPRenderHTML(ctx, w, http.StatusOK, content.Bytes())
+}
+
+// recoveryRequest holds the data of a recovery request processed in the
+// background.
+type recoveryRequest struct {
+	sessionID string
+	requestID string
+	srcIP     string
+	srcConnIP string
+	kind      string
+	realm     string
+	email     string
+	username  string
+}
+
+// requestRecovery sends password reset or username reminder to the user
+// having the provided email address. The request is processed in the
+// background and its outcome is logged, but it is not returned to prevent
+// the disclosure of whether the account exists, be it by the response or
+// by its timing. When the username is not empty, the email address must
+// belong to the user. The requests exceeding the limits of the recovery
+// queue are dropped.
+func (p *Portal) requestRecovery(r *http.Request, rr *requests.Request, kind, realm, email, username string) {
+	req := &recoveryRequest{
+		sessionID: rr.Upstream.SessionID,
+		requestID: rr.ID,
+		srcIP:     addrutil.GetSourceAddress(r),
+		srcConnIP: addrutil.GetSourceConnAddress(r),
+		kind:      kind,
+		realm:     realm,
+		email:     email,
+		username:  username,
+	}
+	if p.recoveryQueue == nil {
+		p.logger.Warn(
+			"recovery request failed",
+			zap.String("session_id", req.sessionID),
+			zap.String("request_id", req.requestID),
+			zap.String("recovery_type", req.kind),
+			zap.String("error", "recovery is not enabled"),
+		)
+		return
+	}
+	if err := p.recoveryQueue.enqueue(req); err != nil {
+		p.logger.Warn(
+			"recovery request dropped",
+			zap.String("session_id", req.sessionID),
+			zap.String("request_id", req.requestID),
+			zap.String("recovery_type", req.kind),
+			zap.String("src_ip", req.srcIP),
+			zap.String("src_conn_ip", req.srcConnIP),
+			zap.Error(err),
+		)
+	}
+}
+
+func (p *Portal) processRecovery(req *recoveryRequest) {
+	backend := p.getRecoveryIdentityStore(req.realm, req.kind)
+	if backend == nil {
+		p.logger.Warn(
+			"recovery request failed",
+			zap.String("session_id", req.sessionID),
+			zap.String("request_id", req.requestID),
+			zap.String("realm", req.realm),
+			zap.String("recovery_type", req.kind),
+			zap.String("error", "recovery is not enabled for the realm"),
+		)
+		return
+	}
+
+	lookupReq := &requests.Request{
+		User: requests.User{
+			Email: req.email,
+		},
+	}
+	if err := backend.Request(operator.LookupUser, lookupReq); err != nil {
+		p.logger.Info(
+			"recovery request for unknown email address",
+			zap.String("session_id", req.sessionID),
+			zap.String("request_id", req.requestID),
+			zap.String("realm", backend.GetRealm()),
+			zap.String("recovery_type", req.kind),
+			zap.String("src_ip", req.srcIP),
+			zap.String("src_conn_ip", req.srcConnIP),
+			zap.Error(err),
+		)
+		return
+	}
+
+	if req.username != "" && !strings.EqualFold(req.username, lookupReq.User.Username) {
+		p.logger.Info(
+			"recovery request email address mismatch",
+			zap.String("session_id", req.sessionID),
+			zap.String("request_id", req.requestID),
+			zap.String("realm", backend.GetRealm()),
+			zap.String("username", req.username),
+			zap.String("src_ip", req.srcIP),
+			zap.String("src_conn_ip", req.srcConnIP),
+		)
+		return
+	}
+
+	data := map[string]string{
+		"template":   req.kind + "_recovery",
+		"session_id": req.sessionID,
+		"request_id": req.requestID,
+		"username":   lookupReq.User.Username,
+		"email":      req.email,
+		"src_ip":     req.srcIP,
+		"timestamp":  time.Now().UTC().Format(time.UnixDate),
+	}
+
+	if req.kind == "password" {
+		token, err := p.recovery.issue(backend.GetRealm(), lookupReq.User.Username, req.email, lookupReq.User.PasswordFingerprint)
+		if err != nil {
+			p.logger.Warn(
+				"failed issuing password reset token",
+				zap.String("session_id", req.sessionID),
+				zap.String("request_id", req.requestID),
+				zap.Error(err),
+			)
+			return
+		}
+		data["recovery_url"] = p.config.BaseURL + "/recover/" + url.PathEscape(backend.GetRealm()) +
+			"?token=" + url.QueryEscape(token)
+		data["recovery_lifetime"] = p.recovery.lifetime.String()
+	}
+
+	if err := p.notifyRecovery(data); err != nil {
+		p.logger.Warn(
+			"Failed to send notification",
+			zap.String("session_id", req.sessionID),
+			zap.String("request_id", req.requestID),
+			zap.String("recovery_type", req.kind),
+			zap.Error(err),
+		)
+		return
+	}
+
+	p.logger.Info(
+		"Sent recovery notification",
+		zap.String("session_id", req.sessionID),
+		zap.String("request_id", req.requestID),
+		zap.String("realm", backend.GetRealm()),
+		zap.String("recovery_type", req.kind),
+		zap.String("username", lookupReq.User.Username),
+		zap.String("src_ip", req.srcIP),
+		zap.String("src_conn_ip", req.srcConnIP),
+	)
+}
+
+// getRecoveryIdentityStore returns the identity store having the requested
+// type of recovery enabled. When the realm is empty, it returns the first
+// such store.
+func (p *Portal) getRecoveryIdentityStore(realm, kind string) ids.IdentityStore {
+	if p.config.Recovery == nil || p.recovery == nil {
+		return nil
+	}
+	for _, store := range p.identityStores {
+		if realm != "" && store.GetRealm() != realm {
+			continue
+		}
+		icon := store.GetLoginIcon()
+		switch {
+		case kind == "password" && icon.PasswordRecoveryEnabled:
+			return store
+		case kind == "username" && icon.UsernameRecoveryEnabled:
+			return store
+		}
+	}
+	return nil
+}
+
+func validateRecoverForm(r *http.Request) error {
+	var maxBytesLimit int64 = 4096
+	if r.ContentLength > maxBytesLimit {
+		return errors.New("payload size")
+	}
+	if r.Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
+		return errors.New("content type")
+	}
+	return r.ParseForm()
 }
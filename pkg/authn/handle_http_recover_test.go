@@ -0,0 +1,118 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authn
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/greenpau/go-authcrunch/internal/tests"
+	"github.com/greenpau/go-authcrunch/internal/testutils"
+	"github.com/greenpau/go-authcrunch/pkg/authn/enums/operator"
+	"github.com/greenpau/go-authcrunch/pkg/ids"
+	"github.com/greenpau/go-authcrunch/pkg/requests"
+	"github.com/greenpau/go-authcrunch/pkg/revocation"
+	logutil "github.com/greenpau/go-authcrunch/pkg/util/log"
+)
+
+func TestRecoverResetRevokesTokens(t *testing.T) {
+	db, err := testutils.CreateTestDatabase("TestRecoverResetRevokesTokens")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	logger := logutil.NewLogger()
+	store, err := ids.NewIdentityStore(&ids.IdentityStoreConfig{
+		Name: "local_backend",
+		Kind: "local",
+		Params: map[string]interface{}{
+			"path":                      db.GetPath(),
+			"realm":                     "local",
+			"password_recovery_enabled": true,
+		},
+	}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Configure(); err != nil {
+		t.Fatal(err)
+	}
+	portal, err := NewPortal(PortalParameters{
+		Config: &PortalConfig{
+			Name:           "myportal",
+			BaseURL:        "https://localhost/auth",
+			IdentityStores: []string{"local_backend"},
+			Recovery: &RecoveryConfig{
+				EmailProvider: "localhost-smtp-server",
+				TokenSecret:   "foobar",
+			},
+		},
+		Logger:         logger,
+		IdentityStores: []ids.IdentityStore{store},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := revocation.NewList(&revocation.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	portal.SetRevocationList(l)
+
+	lookupReq := &requests.Request{User: requests.User{Email: tests.TestEmail1}}
+	if err := store.Request(operator.LookupUser, lookupReq); err != nil {
+		t.Fatal(err)
+	}
+	token, err := portal.recovery.issue("local", lookupReq.User.Username, tests.TestEmail1, lookupReq.User.PasswordFingerprint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The token issued prior to the reset, e.g. to whoever compromised the
+	// account, is revoked by the reset.
+	issuedAt := time.Now().Add(-1 * time.Minute).Unix()
+	form := url.Values{
+		"token":   []string{token},
+		"secret1": []string{"N3w-Passw0rd!Recovered"},
+		"secret2": []string{"N3w-Passw0rd!Recovered"},
+	}
+	r := httptest.NewRequest(http.MethodPost, "/recover/local", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	rr := requests.NewRequest()
+	if err := portal.handleHTTPRecoverReset(context.Background(), w, r, rr, &recoverRequest{token: token}); err != nil {
+		t.Fatal(err)
+	}
+
+	checkReq := &requests.Request{User: requests.User{Email: tests.TestEmail1}}
+	if err := store.Request(operator.LookupUser, checkReq); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]interface{}{
+		"status":          w.Code,
+		"reset":           checkReq.User.PasswordFingerprint != lookupReq.User.PasswordFingerprint,
+		"subject_revoked": l.IsRevoked("", tests.TestUser1, issuedAt),
+	}
+	want := map[string]interface{}{
+		"status":          http.StatusOK,
+		"reset":           true,
+		"subject_revoked": true,
+	}
+	tests.EvalObjectsWithLog(t, "password reset", want, got, []string{})
+}
@@ -16,6 +16,7 @@ package authn
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -150,6 +151,22 @@ func (p *Portal) handleHTTPSandbox(ctx context.Context, w http.ResponseWriter, r
 		)
 	}
 
+	// The cache holds a copy of the user, so the progress through the
+	// checkpoints is written back. The sandbox is terminated when the
+	// progress cannot be recorded.
+	if err := p.sandboxes.Update(sandboxID, usr); err != nil {
+		p.logger.Warn(
+			"failed updating sandbox",
+			zap.String("session_id", rr.Upstream.SessionID),
+			zap.String("request_id", rr.ID),
+			zap.String("sandbox_id", sandboxID),
+			zap.Error(err),
+		)
+		p.sandboxes.Delete(sandboxID)
+		rr.Response.RedirectURL = rr.Upstream.BasePath
+		return p.handleHTTPError(ctx, w, r, rr, http.StatusInternalServerError)
+	}
+
 	if _, exists := data["view"]; exists {
 		switch data["view"] {
 		case "terminate":
@@ -212,7 +229,7 @@ func (p *Portal) nextSandboxCheckpoint(r *http.Request, rr *requests.Request, us
 			continue
 		}
 		switch checkpoint.Type {
-		case "password", "mfa":
+		case "password", "mfa", "password_change":
 			verifiedCount++
 		}
 	}
@@ -239,16 +256,27 @@ func (p *Portal) nextSandboxCheckpoint(r *http.Request, rr *requests.Request, us
 					m["title"] = "Authentication"
 					m["view"] = "password_auth"
 					m["action"] = "auth"
+					if p.getRecoveryIdentityStore(backend.GetRealm(), "password") != nil {
+						m["password_recovery_enabled"] = true
+					}
 				}
 				return m, nil
 			}
 			switch action {
 			case "password-recovery":
-				rr.Response.Code = http.StatusNotImplemented
-				// User recovers a password
-				m["title"] = "Password Recovery Failed"
-				m["view"] = "terminate"
-				return m, fmt.Errorf("Password recovery failed. Please retry")
+				// User recovers a password. The response does not reveal
+				// whether the email address belongs to the user.
+				if err := validateRecoverForm(r); err != nil {
+					rr.Response.Code = http.StatusBadRequest
+					m["title"] = "Password Recovery Failed"
+					m["view"] = "terminate"
+					return m, fmt.Errorf("Password recovery failed. Please retry")
+				}
+				p.requestRecovery(r, rr, "password", backend.GetRealm(), strings.TrimSpace(r.PostFormValue("email")), rr.User.Username)
+				p.sandboxes.Delete(usr.Authenticator.TempSessionID)
+				m["title"] = "Password Recovery"
+				m["view"] = "password_recovery_sent"
+				return m, nil
 			default:
 				// Handle password authentication.
 				if err := validateSandboxPasswordForm(r, rr); err != nil {
@@ -300,6 +328,66 @@ func (p *Portal) nextSandboxCheckpoint(r *http.Request, rr *requests.Request, us
 				m["view"] = "redirect"
 				return m, nil
 			}
+		case "password_change":
+			m["title"] = "Password Change"
+			m["view"] = "password_change"
+			m["action"] = "auth"
+			if r.Method != "POST" {
+				return m, nil
+			}
+			// Handle the change of expired password.
+			if err := validatePasswordChangeForm(r, rr); err != nil {
+				checkpoint.FailedAttempts++
+				rr.Response.Code = http.StatusBadRequest
+				m["title"] = "Password Change Failed"
+				m["view"] = "error"
+				return m, err
+			}
+			if err := backend.Request(operator.ChangePassword, rr); err != nil {
+				rr.Response.Code = http.StatusBadRequest
+				checkpoint.FailedAttempts++
+				m["title"] = "Password Change Failed"
+				m["view"] = "error"
+				p.logger.Warn(
+					"password change failed",
+					zap.String("session_id", rr.Upstream.SessionID),
+					zap.String("request_id", rr.ID),
+					zap.Int("checkpoint_id", checkpoint.ID),
+					zap.String("checkpoint_name", checkpoint.Name),
+					zap.String("checkpoint_type", checkpoint.Type),
+					zap.Error(err),
+				)
+				var policyErr *identity.PasswordPolicyError
+				if errors.As(err, &policyErr) {
+					m["password_policy_violations"] = policyErr.Rules
+					return m, fmt.Errorf("The new password does not meet password policy requirements: %s", policyErr.Error())
+				}
+				return m, fmt.Errorf("Password change failed. Please retry")
+			}
+			// The tokens issued with the expired password are no longer
+			// valid.
+			if err := p.revokeSubject(usr.Claims.Subject); err != nil {
+				p.logger.Warn(
+					"failed revoking user tokens after password change",
+					zap.String("session_id", rr.Upstream.SessionID),
+					zap.String("request_id", rr.ID),
+					zap.String("sub", usr.Claims.Subject),
+					zap.Error(err),
+				)
+			}
+			p.logger.Info(
+				"user authorization checkpoint passed",
+				zap.String("session_id", rr.Upstream.SessionID),
+				zap.String("request_id", rr.ID),
+				zap.Int("checkpoint_id", checkpoint.ID),
+				zap.String("checkpoint_name", checkpoint.Name),
+				zap.String("checkpoint_type", checkpoint.Type),
+			)
+			checkpoint.Passed = true
+			checkpoint.FailedAttempts = 0
+			verifiedCount++
+			m["view"] = "redirect"
+			return m, nil
 		case "mfa":
 			if err := backend.Request(operator.GetMfaTokens, rr); err != nil {
 				checkpoint.FailedAttempts++
@@ -30,8 +30,9 @@ type AuthRequest struct {
 
 // AuthResponse is the response to authentication request.
 type AuthResponse struct {
-	Token     string `json:"token,omitempty" xml:"token,omitempty" yaml:"token,omitempty"`
-	TokenName string `json:"token_name,omitempty" xml:"token_name,omitempty" yaml:"token_name,omitempty"`
+	Token        string `json:"token,omitempty" xml:"token,omitempty" yaml:"token,omitempty"`
+	TokenName    string `json:"token_name,omitempty" xml:"token_name,omitempty" yaml:"token_name,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty" xml:"refresh_token,omitempty" yaml:"refresh_token,omitempty"`
 }
 
 func (p *Portal) handleJSONLogin(ctx context.Context, w http.ResponseWriter, r *http.Request, rr *requests.Request) error {
@@ -67,6 +68,13 @@ func (p *Portal) handleJSONLogin(ctx context.Context, w http.ResponseWriter, r *
 		TokenName: usr.TokenName,
 		Token:     usr.Token,
 	}
+	if p.refreshTokens != nil {
+		refreshToken, err := p.refreshTokens.issue(usr)
+		if err != nil {
+			return p.handleJSONErrorWithLog(ctx, w, r, rr, http.StatusInternalServerError, err.Error())
+		}
+		resp.RefreshToken = refreshToken
+	}
 	respBytes, _ := json.Marshal(resp)
 	w.WriteHeader(rr.Response.Code)
 	w.Write(respBytes)
@@ -0,0 +1,118 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authn
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/requests"
+	"go.uber.org/zap"
+)
+
+// RefreshRequest is the request to renew an access token.
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token,omitempty" xml:"refresh_token,omitempty" yaml:"refresh_token,omitempty"`
+}
+
+// handleJSONRefresh exchanges a refresh token for a new access token and
+// the next refresh token.
+func (p *Portal) handleJSONRefresh(ctx context.Context, w http.ResponseWriter, r *http.Request, rr *requests.Request) error {
+	if p.refreshTokens == nil {
+		return p.handleJSONError(ctx, w, http.StatusNotFound, "Not Found")
+	}
+	if r.Method != "POST" {
+		return p.handleJSONError(ctx, w, http.StatusUnauthorized, "Authentication Required")
+	}
+	refreshRequest := &RefreshRequest{}
+	r.Body = http.MaxBytesReader(w, r.Body, 1024)
+	reqDecoder := json.NewDecoder(r.Body)
+	reqDecoder.DisallowUnknownFields()
+	if err := reqDecoder.Decode(refreshRequest); err != nil {
+		return p.handleJSONErrorWithLog(ctx, w, r, rr, http.StatusBadRequest, err.Error())
+	}
+
+	family, refreshToken, err := p.refreshTokens.rotate(refreshRequest.RefreshToken)
+	if err != nil {
+		if err == errors.ErrRefreshTokenReused {
+			// The access tokens of the family are revoked too.
+			p.logger.Warn(
+				"refresh token reuse detected",
+				zap.String("session_id", rr.Upstream.SessionID),
+				zap.String("request_id", rr.ID),
+				zap.String("jti", family.user.Claims.ID),
+				zap.String("sub", family.user.Claims.Subject),
+			)
+			p.sessions.Delete(family.user.Claims.ID)
+			if p.revocationList != nil && family.user.Claims.ID != "" {
+				expiresAt := time.Now().Add(time.Duration(p.keystore.GetTokenLifetime(nil, nil)) * time.Second)
+				if err := p.revocationList.RevokeToken(family.user.Claims.ID, expiresAt); err != nil {
+					p.logger.Warn(
+						"failed revoking token",
+						zap.String("session_id", rr.Upstream.SessionID),
+						zap.String("request_id", rr.ID),
+						zap.Error(err),
+					)
+				}
+			}
+		}
+		return p.handleJSONErrorWithLog(ctx, w, r, rr, http.StatusUnauthorized, err.Error())
+	}
+
+	// The refresh tokens are revoked along with the access tokens, e.g.
+	// when the user logs out everywhere or changes password.
+	if p.revocationList != nil && p.revocationList.IsRevoked(family.user.Claims.ID, family.user.Claims.Subject, family.authTime.Unix()) {
+		p.refreshTokens.revokeSession(family.user.Claims.ID)
+		return p.handleJSONErrorWithLog(ctx, w, r, rr, http.StatusUnauthorized, errors.ErrTokenRevoked.Error())
+	}
+
+	// The user is identified again, so that the tokens reflect the current
+	// state of the user in the identity store or provider.
+	refreshedUser, err := p.refreshUser(ctx, rr, family.user)
+	if err != nil {
+		p.refreshTokens.revokeSession(family.user.Claims.ID)
+		p.sessions.Delete(family.user.Claims.ID)
+		return p.handleJSONErrorWithLog(ctx, w, r, rr, http.StatusUnauthorized, err.Error())
+	}
+
+	usr, err := p.reissueToken(refreshedUser)
+	if err != nil {
+		return p.handleJSONErrorWithLog(ctx, w, r, rr, http.StatusInternalServerError, err.Error())
+	}
+	if usr.Claims.ID != "" {
+		p.sessions.Add(usr.Claims.ID, usr)
+	}
+
+	p.logger.Debug(
+		"refreshed user token",
+		zap.String("session_id", rr.Upstream.SessionID),
+		zap.String("request_id", rr.ID),
+		zap.String("jti", usr.Claims.ID),
+		zap.String("sub", usr.Claims.Subject),
+	)
+
+	resp := &AuthResponse{
+		TokenName:    usr.TokenName,
+		Token:        usr.Token,
+		RefreshToken: refreshToken,
+	}
+	respBytes, _ := json.Marshal(resp)
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBytes)
+	return nil
+}
@@ -0,0 +1,394 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authn
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/kms"
+	"github.com/greenpau/go-authcrunch/pkg/requests"
+	"github.com/greenpau/go-authcrunch/pkg/user"
+	addrutil "github.com/greenpau/go-authcrunch/pkg/util/addr"
+	"go.uber.org/zap"
+)
+
+// openIDConnectScopeDescriptions are the descriptions of the default scopes
+// displayed on the consent screen.
+var openIDConnectScopeDescriptions = map[string]string{
+	"openid":  "Your user identifier",
+	"profile": "Your name and profile picture",
+	"email":   "Your email address",
+	"roles":   "Your roles",
+}
+
+// OpenIDConnectTokenResponse is the response of the token endpoint.
+type OpenIDConnectTokenResponse struct {
+	AccessToken string `json:"access_token,omitempty" xml:"access_token,omitempty" yaml:"access_token,omitempty"`
+	TokenType   string `json:"token_type,omitempty" xml:"token_type,omitempty" yaml:"token_type,omitempty"`
+	ExpiresIn   int    `json:"expires_in,omitempty" xml:"expires_in,omitempty" yaml:"expires_in,omitempty"`
+	IDToken     string `json:"id_token,omitempty" xml:"id_token,omitempty" yaml:"id_token,omitempty"`
+	Scope       string `json:"scope,omitempty" xml:"scope,omitempty" yaml:"scope,omitempty"`
+}
+
+type consentScopeEntry struct {
+	Name        string
+	Description string
+}
+
+func (p *Portal) handleOpenIDConnect(ctx context.Context, w http.ResponseWriter, r *http.Request, rr *requests.Request) error {
+	p.disableClientCache(w)
+	p.logger.Debug(
+		"Received OpenID Connect request",
+		zap.String("request_id", rr.ID),
+		zap.String("url_path", r.URL.Path),
+		zap.String("source_address", addrutil.GetSourceAddress(r)),
+	)
+
+	extractBaseURLPath(ctx, r, rr, "/oidc/")
+
+	if p.openID == nil {
+		return p.handleHTTPRenderPlainText(ctx, w, http.StatusNotFound)
+	}
+
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/oidc/authorize"):
+		return p.handleOpenIDConnectAuthorize(ctx, w, r, rr)
+	case strings.HasSuffix(r.URL.Path, "/oidc/consent"):
+		return p.handleOpenIDConnectConsent(ctx, w, r, rr)
+	case strings.HasSuffix(r.URL.Path, "/oidc/token"):
+		return p.handleOpenIDConnectToken(ctx, w, r, rr)
+	case strings.HasSuffix(r.URL.Path, "/oidc/userinfo"):
+		return p.handleOpenIDConnectUserInfo(ctx, w, r, rr)
+	}
+	return p.handleHTTPRenderPlainText(ctx, w, http.StatusNotFound)
+}
+
+// handleOpenIDConnectAuthorize handles the authorization requests of the
+// clients. The unauthenticated users are redirected to login and return to
+// the request afterwards.
+func (p *Portal) handleOpenIDConnectAuthorize(ctx context.Context, w http.ResponseWriter, r *http.Request, rr *requests.Request) error {
+	var q url.Values
+	switch r.Method {
+	case http.MethodGet:
+		q = r.URL.Query()
+	case http.MethodPost:
+		r.Body = http.MaxBytesReader(w, r.Body, 8192)
+		if err := r.ParseForm(); err != nil {
+			return p.handleHTTPErrorWithLog(ctx, w, r, rr, http.StatusBadRequest, err.Error())
+		}
+		q = r.PostForm
+	default:
+		return p.handleHTTPRenderPlainText(ctx, w, http.StatusMethodNotAllowed)
+	}
+
+	p.injectSessionID(ctx, w, r, rr)
+	usr, _ := p.authorizeRequest(ctx, w, r, rr)
+
+	client, err := p.openID.getClient(q.Get("client_id"), q.Get("redirect_uri"))
+	if err != nil {
+		return p.handleHTTPErrorWithLog(ctx, w, r, rr, http.StatusBadRequest, err.Error())
+	}
+
+	req, err := p.openID.newAuthorizationRequest(client, q)
+	if err != nil {
+		return p.handleOpenIDConnectAuthorizeError(ctx, w, r, rr, q.Get("redirect_uri"), q.Get("state"), err)
+	}
+
+	if usr == nil {
+		if req.prompt == "none" {
+			return p.handleOpenIDConnectAuthorizeError(ctx, w, r, rr, req.redirectURL, req.state,
+				newOAuthError("login_required", errors.ErrOpenIDConnectLoginRequired.WithArgs(client.ClientID)))
+		}
+		redirectURL := r.URL.Path + "?" + q.Encode()
+		return p.handleHTTPRedirect(ctx, w, r, rr, "/login?redirect_url="+url.QueryEscape(redirectURL))
+	}
+
+	if !p.openID.isConsentRequired(req, usr) {
+		return p.handleOpenIDConnectAuthorizeResponse(ctx, w, r, rr, req, usr)
+	}
+	if req.prompt == "none" {
+		return p.handleOpenIDConnectAuthorizeError(ctx, w, r, rr, req.redirectURL, req.state,
+			newOAuthError("consent_required", errors.ErrOpenIDConnectConsentRequired.WithArgs(client.ClientID)))
+	}
+
+	consentID, err := p.openID.saveAuthorizationRequest(req, usr)
+	if err != nil {
+		return p.handleHTTPRenderError(ctx, w, r, rr, err)
+	}
+
+	resp := p.ui.GetArgs()
+	resp.BaseURL(rr.Upstream.BasePath)
+	resp.PageTitle = "Authorize " + client.ClientName
+	resp.Data["consent_id"] = consentID
+	resp.Data["client_name"] = client.ClientName
+	resp.Data["username"] = usr.Claims.Email
+	if resp.Data["username"] == "" {
+		resp.Data["username"] = usr.Claims.Subject
+	}
+	var scopes []*consentScopeEntry
+	for _, scope := range req.scopes {
+		entry := &consentScopeEntry{Name: scope, Description: openIDConnectScopeDescriptions[scope]}
+		if _, exists := p.config.OpenIDConnect.ScopeClaims[scope]; exists || entry.Description == "" {
+			entry.Description = "Your " + strings.Join(p.config.OpenIDConnect.scopeClaims[scope], ", ") + " claims"
+		}
+		scopes = append(scopes, entry)
+	}
+	resp.Data["scopes"] = scopes
+	content, err := p.ui.Render("consent", resp)
+	if err != nil {
+		return p.handleHTTPRenderError(ctx, w, r, rr, err)
+	}
+	return p.handleHTTPRenderHTML(ctx, w, http.StatusOK, content.Bytes())
+}
+
+// handleOpenIDConnectConsent handles the decision of the user on the
+// consent screen.
+func (p *Portal) handleOpenIDConnectConsent(ctx context.Context, w http.ResponseWriter, r *http.Request, rr *requests.Request) error {
+	if r.Method != http.MethodPost {
+		return p.handleHTTPRenderPlainText(ctx, w, http.StatusMethodNotAllowed)
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 1024)
+	if err := r.ParseForm(); err != nil {
+		return p.handleHTTPErrorWithLog(ctx, w, r, rr, http.StatusBadRequest, err.Error())
+	}
+
+	p.injectSessionID(ctx, w, r, rr)
+	usr, _ := p.authorizeRequest(ctx, w, r, rr)
+	if usr == nil {
+		return p.handleHTTPRedirect(ctx, w, r, rr, "/login")
+	}
+
+	req, err := p.openID.loadAuthorizationRequest(r.PostForm.Get("consent_id"), usr)
+	if err != nil {
+		return p.handleHTTPErrorWithLog(ctx, w, r, rr, http.StatusBadRequest, err.Error())
+	}
+
+	if r.PostForm.Get("action") != "allow" {
+		return p.handleOpenIDConnectAuthorizeError(ctx, w, r, rr, req.redirectURL, req.state,
+			newOAuthError("access_denied", errors.ErrOpenIDConnectAccessDenied.WithArgs(req.client.ClientID)))
+	}
+	if err := p.openID.addConsent(req, usr); err != nil {
+		p.logger.Warn(
+			"failed storing consent",
+			zap.String("session_id", rr.Upstream.SessionID),
+			zap.String("request_id", rr.ID),
+			zap.String("client_id", req.client.ClientID),
+			zap.Error(err),
+		)
+	}
+	return p.handleOpenIDConnectAuthorizeResponse(ctx, w, r, rr, req, usr)
+}
+
+// handleOpenIDConnectAuthorizeResponse redirects the user back to the client
+// with the authorization code.
+func (p *Portal) handleOpenIDConnectAuthorizeResponse(ctx context.Context, w http.ResponseWriter, r *http.Request, rr *requests.Request,
+	req *oidcAuthorizationRequest, usr *user.User) error {
+	code, err := p.openID.issueCode(req, usr)
+	if err != nil {
+		return p.handleHTTPRenderError(ctx, w, r, rr, err)
+	}
+
+	p.logger.Info(
+		"Issued OpenID Connect authorization code",
+		zap.String("session_id", rr.Upstream.SessionID),
+		zap.String("request_id", rr.ID),
+		zap.String("client_id", req.client.ClientID),
+		zap.String("sub", usr.Claims.Subject),
+		zap.Strings("scopes", req.scopes),
+	)
+
+	params := url.Values{}
+	params.Set("code", code)
+	if req.state != "" {
+		params.Set("state", req.state)
+	}
+	return p.handleHTTPRedirectExternal(ctx, w, r, rr, addURLQueryParams(req.redirectURL, params))
+}
+
+// handleOpenIDConnectAuthorizeError redirects the user back to the client
+// with the error.
+func (p *Portal) handleOpenIDConnectAuthorizeError(ctx context.Context, w http.ResponseWriter, r *http.Request, rr *requests.Request,
+	redirectURL, state string, err error) error {
+	p.logger.Warn(
+		"OpenID Connect authorization request failed",
+		zap.String("session_id", rr.Upstream.SessionID),
+		zap.String("request_id", rr.ID),
+		zap.Error(err),
+	)
+	params := url.Values{}
+	params.Set("error", getOAuthErrorCode(err))
+	params.Set("error_description", err.Error())
+	if state != "" {
+		params.Set("state", state)
+	}
+	return p.handleHTTPRedirectExternal(ctx, w, r, rr, addURLQueryParams(redirectURL, params))
+}
+
+// handleOpenIDConnectToken exchanges authorization codes for ID tokens and
+// access tokens.
+func (p *Portal) handleOpenIDConnectToken(ctx context.Context, w http.ResponseWriter, r *http.Request, rr *requests.Request) error {
+	if r.Method != http.MethodPost {
+		return p.handleOpenIDConnectJSONError(ctx, w, r, rr, http.StatusMethodNotAllowed,
+			newOAuthError("invalid_request", errors.ErrOpenIDConnectRequestMethod.WithArgs(r.Method)))
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 8192)
+	if err := r.ParseForm(); err != nil {
+		return p.handleOpenIDConnectJSONError(ctx, w, r, rr, http.StatusBadRequest, newOAuthError("invalid_request", err))
+	}
+
+	// The client authenticates with either HTTP Basic authentication or
+	// the parameters in the request body. See RFC 6749, Section 2.3.1.
+	clientID, clientSecret, basicAuth := r.BasicAuth()
+	if basicAuth {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID = r.PostForm.Get("client_id")
+		clientSecret = r.PostForm.Get("client_secret")
+	}
+	client, err := p.openID.authenticateClient(clientID, clientSecret)
+	if err != nil {
+		if basicAuth {
+			w.Header().Set("WWW-Authenticate", `Basic realm="`+p.config.Name+`"`)
+		}
+		return p.handleOpenIDConnectJSONError(ctx, w, r, rr, http.StatusUnauthorized, err)
+	}
+
+	if s := r.PostForm.Get("grant_type"); s != "authorization_code" {
+		return p.handleOpenIDConnectJSONError(ctx, w, r, rr, http.StatusBadRequest,
+			newOAuthError("unsupported_grant_type", errors.ErrOpenIDConnectGrantTypeUnsupported.WithArgs(s)))
+	}
+
+	grant, accessToken, err := p.openID.redeemCode(client, r.PostForm.Get("code"), r.PostForm.Get("redirect_uri"), r.PostForm.Get("code_verifier"))
+	if err != nil {
+		return p.handleOpenIDConnectJSONError(ctx, w, r, rr, http.StatusBadRequest, err)
+	}
+
+	if p.isOpenIDConnectGrantRevoked(grant) {
+		return p.handleOpenIDConnectJSONError(ctx, w, r, rr, http.StatusBadRequest,
+			newOAuthError("invalid_grant", errors.ErrTokenRevoked))
+	}
+
+	claims := p.openID.getClaims(grant)
+	claims["iss"] = p.config.BaseURL
+	claims["aud"] = client.ClientID
+	claims["iat"] = grant.issuedAt.Unix()
+	claims["exp"] = grant.expiresAt.Unix()
+	if grant.request.nonce != "" {
+		claims["nonce"] = grant.request.nonce
+	}
+	idToken, err := p.keystore.SignClaims(kms.IDTokenName, nil, claims)
+	if err != nil {
+		return p.handleOpenIDConnectJSONError(ctx, w, r, rr, http.StatusInternalServerError, err)
+	}
+
+	p.logger.Info(
+		"Issued OpenID Connect ID token",
+		zap.String("request_id", rr.ID),
+		zap.String("client_id", client.ClientID),
+		zap.String("sub", grant.user.Claims.Subject),
+	)
+
+	resp := &OpenIDConnectTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(time.Until(grant.expiresAt).Seconds()),
+		IDToken:     idToken,
+		Scope:       strings.Join(grant.request.scopes, " "),
+	}
+	return p.handleOpenIDConnectJSON(ctx, w, http.StatusOK, resp)
+}
+
+// handleOpenIDConnectUserInfo returns the claims released to the client
+// holding the access token.
+func (p *Portal) handleOpenIDConnectUserInfo(ctx context.Context, w http.ResponseWriter, r *http.Request, rr *requests.Request) error {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		return p.handleOpenIDConnectJSONError(ctx, w, r, rr, http.StatusMethodNotAllowed,
+			newOAuthError("invalid_request", errors.ErrOpenIDConnectRequestMethod.WithArgs(r.Method)))
+	}
+
+	accessToken, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="`+p.config.Name+`"`)
+		return p.handleOpenIDConnectJSONError(ctx, w, r, rr, http.StatusUnauthorized,
+			newOAuthError("invalid_token", errors.ErrOpenIDConnectAccessTokenInvalid))
+	}
+	grant, err := p.openID.getAccessTokenGrant(accessToken)
+	if err == nil && p.isOpenIDConnectGrantRevoked(grant) {
+		err = errors.ErrTokenRevoked
+	}
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="`+p.config.Name+`", error="invalid_token"`)
+		return p.handleOpenIDConnectJSONError(ctx, w, r, rr, http.StatusUnauthorized, newOAuthError("invalid_token", err))
+	}
+	return p.handleOpenIDConnectJSON(ctx, w, http.StatusOK, p.openID.getClaims(grant))
+}
+
+// isOpenIDConnectGrantRevoked returns true when the portal session the
+// grant originates from has been revoked, e.g. the user logged out
+// everywhere.
+func (p *Portal) isOpenIDConnectGrantRevoked(grant *oidcGrant) bool {
+	if p.revocationList == nil {
+		return false
+	}
+	return p.revocationList.IsRevoked(grant.user.Claims.ID, grant.user.Claims.Subject, grant.user.Claims.IssuedAt)
+}
+
+func (p *Portal) handleOpenIDConnectJSON(_ context.Context, w http.ResponseWriter, code int, resp interface{}) error {
+	respBytes, _ := json.Marshal(resp)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(respBytes)
+	return nil
+}
+
+// handleOpenIDConnectJSONError responds with the error response defined in
+// RFC 6749, Section 5.2.
+func (p *Portal) handleOpenIDConnectJSONError(ctx context.Context, w http.ResponseWriter, r *http.Request, rr *requests.Request, code int, err error) error {
+	p.logger.Warn(
+		"OpenID Connect request failed",
+		zap.String("request_id", rr.ID),
+		zap.String("url_path", r.URL.Path),
+		zap.String("source_address", addrutil.GetSourceAddress(r)),
+		zap.Error(err),
+	)
+	resp := map[string]string{
+		"error":             getOAuthErrorCode(err),
+		"error_description": err.Error(),
+	}
+	return p.handleOpenIDConnectJSON(ctx, w, code, resp)
+}
+
+// addURLQueryParams adds the parameters to the query of the URL, keeping
+// the parameters already present.
+func addURLQueryParams(s string, params url.Values) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return s
+	}
+	q := u.Query()
+	for k, v := range params {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
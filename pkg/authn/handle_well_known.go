@@ -0,0 +1,152 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authn
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/greenpau/go-authcrunch/pkg/kms"
+	"github.com/greenpau/go-authcrunch/pkg/requests"
+	addrutil "github.com/greenpau/go-authcrunch/pkg/util/addr"
+	"go.uber.org/zap"
+)
+
+// OpenIDConfiguration is the OpenID Provider metadata published by the
+// portal. See https://openid.net/specs/openid-connect-discovery-1_0.html
+type OpenIDConfiguration struct {
+	Issuer                            string   `json:"issuer" xml:"issuer" yaml:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint" xml:"authorization_endpoint" yaml:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint,omitempty" xml:"token_endpoint,omitempty" yaml:"token_endpoint,omitempty"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint" xml:"userinfo_endpoint" yaml:"userinfo_endpoint"`
+	EndSessionEndpoint                string   `json:"end_session_endpoint" xml:"end_session_endpoint" yaml:"end_session_endpoint"`
+	JwksURI                           string   `json:"jwks_uri" xml:"jwks_uri" yaml:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported,omitempty" xml:"scopes_supported,omitempty" yaml:"scopes_supported,omitempty"`
+	ResponseTypesSupported            []string `json:"response_types_supported" xml:"response_types_supported" yaml:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported,omitempty" xml:"grant_types_supported,omitempty" yaml:"grant_types_supported,omitempty"`
+	SubjectTypesSupported             []string `json:"subject_types_supported" xml:"subject_types_supported" yaml:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported" xml:"id_token_signing_alg_values_supported" yaml:"id_token_signing_alg_values_supported"`
+	ClaimsSupported                   []string `json:"claims_supported" xml:"claims_supported" yaml:"claims_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported,omitempty" xml:"token_endpoint_auth_methods_supported,omitempty" yaml:"token_endpoint_auth_methods_supported,omitempty"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported,omitempty" xml:"code_challenge_methods_supported,omitempty" yaml:"code_challenge_methods_supported,omitempty"`
+	// KeyRotation is the state of the signing key rotation. It is not part
+	// of the OpenID specification.
+	KeyRotation *kms.KeyRotationStatus `json:"key_rotation,omitempty" xml:"key_rotation,omitempty" yaml:"key_rotation,omitempty"`
+}
+
+func (p *Portal) handleWellKnown(ctx context.Context, w http.ResponseWriter, r *http.Request, rr *requests.Request) error {
+	w.Header().Set("Content-Type", "application/json")
+	p.logger.Debug(
+		"Received well-known request",
+		zap.String("request_id", rr.ID),
+		zap.String("url_path", r.URL.Path),
+		zap.String("source_address", addrutil.GetSourceAddress(r)),
+	)
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return p.handleJSONError(ctx, w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+	}
+
+	extractBaseURLPath(ctx, r, rr, "/.well-known/")
+
+	var resp interface{}
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/.well-known/jwks.json"):
+		resp = p.keystore.GetJwksKeySet()
+	case strings.HasSuffix(r.URL.Path, "/.well-known/openid-configuration"):
+		resp = p.getOpenIDConfiguration(rr)
+	default:
+		return p.handleJSONError(ctx, w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+	}
+
+	rr.Response.Code = http.StatusOK
+	respBytes, _ := json.Marshal(resp)
+	if p.config.BaseURL == "" && strings.HasSuffix(r.URL.Path, "/.well-known/openid-configuration") {
+		// The URLs derived from the request must not be shared by caches.
+		w.Header().Set("Cache-Control", "no-store")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=300")
+	}
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(rr.Response.Code)
+	w.Write(respBytes)
+	return nil
+}
+
+// getPortalURL returns the external URL of the portal. It is the configured
+// base URL or, when the base URL is not configured, the URL derived from the
+// request.
+func (p *Portal) getPortalURL(rr *requests.Request) string {
+	if p.config.BaseURL != "" {
+		return p.config.BaseURL
+	}
+	return rr.Upstream.BaseURL + strings.TrimSuffix(rr.Upstream.BasePath, "/")
+}
+
+func (p *Portal) getOpenIDConfiguration(rr *requests.Request) *OpenIDConfiguration {
+	issuer := p.getPortalURL(rr)
+	cfg := &OpenIDConfiguration{
+		Issuer:                           issuer,
+		AuthorizationEndpoint:            issuer + "/login",
+		UserinfoEndpoint:                 issuer + "/whoami",
+		EndSessionEndpoint:               issuer + "/logout",
+		JwksURI:                          issuer + "/.well-known/jwks.json",
+		ResponseTypesSupported:           []string{"id_token"},
+		SubjectTypesSupported:            []string{"public"},
+		IDTokenSigningAlgValuesSupported: []string{},
+		ClaimsSupported: []string{
+			"iss", "sub", "aud", "exp", "iat", "nbf", "jti",
+			"name", "email", "roles", "origin", "addr",
+		},
+		KeyRotation: p.keystore.GetKeyRotationStatus(),
+	}
+
+	// The OpenID Connect provider, when configured, issues ID tokens with
+	// the authorization code flow.
+	if p.openID != nil {
+		cfg.AuthorizationEndpoint = issuer + "/oidc/authorize"
+		cfg.TokenEndpoint = issuer + "/oidc/token"
+		cfg.UserinfoEndpoint = issuer + "/oidc/userinfo"
+		cfg.ResponseTypesSupported = []string{"code"}
+		cfg.GrantTypesSupported = []string{"authorization_code"}
+		cfg.TokenEndpointAuthMethodsSupported = []string{"client_secret_basic", "client_secret_post", "none"}
+		cfg.CodeChallengeMethodsSupported = []string{"S256"}
+		cfg.ClaimsSupported = append(cfg.ClaimsSupported, "nonce")
+		for scope, claims := range p.config.OpenIDConnect.scopeClaims {
+			cfg.ScopesSupported = append(cfg.ScopesSupported, scope)
+			for _, claim := range claims {
+				if !slices.Contains(cfg.ClaimsSupported, claim) {
+					cfg.ClaimsSupported = append(cfg.ClaimsSupported, claim)
+				}
+			}
+		}
+		sort.Strings(cfg.ScopesSupported)
+	}
+
+	algs := make(map[string]bool)
+	for _, k := range p.keystore.GetJwksKeySet().Keys {
+		if algs[k.Algorithm] {
+			continue
+		}
+		algs[k.Algorithm] = true
+		cfg.IDTokenSigningAlgValuesSupported = append(cfg.IDTokenSigningAlgValuesSupported, k.Algorithm)
+	}
+	sort.Strings(cfg.IDTokenSigningAlgValuesSupported)
+	return cfg
+}
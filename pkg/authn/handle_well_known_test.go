@@ -0,0 +1,108 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authn
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/greenpau/go-authcrunch/internal/tests"
+	"github.com/greenpau/go-authcrunch/internal/testutils"
+	"github.com/greenpau/go-authcrunch/pkg/ids"
+	"github.com/greenpau/go-authcrunch/pkg/requests"
+	logutil "github.com/greenpau/go-authcrunch/pkg/util/log"
+)
+
+func TestOpenIDConfiguration(t *testing.T) {
+	db, err := testutils.CreateTestDatabase("TestOpenIDConfiguration")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	logger := logutil.NewLogger()
+	store, err := ids.NewIdentityStore(&ids.IdentityStoreConfig{
+		Name: "local_backend",
+		Kind: "local",
+		Params: map[string]interface{}{
+			"path":  db.GetPath(),
+			"realm": "local",
+		},
+	}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Configure(); err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := []struct {
+		name    string
+		baseURL string
+		want    map[string]interface{}
+	}{
+		{
+			name:    "test openid configuration with configured base url",
+			baseURL: "https://auth.contoso.com/auth",
+			want: map[string]interface{}{
+				"issuer":        "https://auth.contoso.com/auth",
+				"jwks_uri":      "https://auth.contoso.com/auth/.well-known/jwks.json",
+				"cache_control": "public, max-age=300",
+			},
+		},
+		{
+			name: "test openid configuration without configured base url",
+			want: map[string]interface{}{
+				"issuer":        "http://evil.contoso.com/auth",
+				"jwks_uri":      "http://evil.contoso.com/auth/.well-known/jwks.json",
+				"cache_control": "no-store",
+			},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			portal, err := NewPortal(PortalParameters{
+				Config: &PortalConfig{
+					Name:           "myportal",
+					BaseURL:        tc.baseURL,
+					IdentityStores: []string{"local_backend"},
+				},
+				Logger:         logger,
+				IdentityStores: []ids.IdentityStore{store},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := httptest.NewRequest(http.MethodGet, "http://evil.contoso.com/auth/.well-known/openid-configuration", nil)
+			w := httptest.NewRecorder()
+			if err := portal.ServeHTTP(context.Background(), w, r, requests.NewRequest()); err != nil {
+				t.Fatal(err)
+			}
+			cfg := &OpenIDConfiguration{}
+			if err := json.Unmarshal(w.Body.Bytes(), cfg); err != nil {
+				t.Fatal(err)
+			}
+			got := map[string]interface{}{
+				"issuer":        cfg.Issuer,
+				"jwks_uri":      cfg.JwksURI,
+				"cache_control": w.Header().Get("Cache-Control"),
+			}
+			tests.EvalObjectsWithLog(t, "openid configuration", tc.want, got, msgs)
+		})
+	}
+}
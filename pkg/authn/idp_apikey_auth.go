@@ -71,6 +71,28 @@ func (p *Portal) APIKeyAuth(r *authproxy.Request) error {
 		return errors.ErrAPIKeyAuthFailed
 	}
 
+	// The identity stores identify the unknown and disabled users as nobody.
+	if rr.User.Username == "nobody" {
+		p.logger.Warn(
+			"user lookup following api key lookup found no user",
+			zap.String("source_address", r.Address),
+			zap.String("custom_auth", "apikey"),
+			zap.String("realm", r.Realm),
+		)
+		return errors.ErrAPIKeyAuthFailed
+	}
+
+	if hasPendingPasswordChange(rr.User.Challenges) {
+		p.logger.Warn(
+			"user lookup following api key lookup failed",
+			zap.String("source_address", r.Address),
+			zap.String("custom_auth", "apikey"),
+			zap.String("realm", r.Realm),
+			zap.Error(errors.ErrUserPasswordExpired),
+		)
+		return errors.ErrAPIKeyAuthFailed
+	}
+
 	m := make(map[string]interface{})
 	m["sub"] = rr.User.Username
 	m["email"] = rr.User.Email
@@ -0,0 +1,520 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authn
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/kvstore"
+	"github.com/greenpau/go-authcrunch/pkg/user"
+)
+
+const (
+	oidcConsentRequestLifetime = 10 * time.Minute
+
+	oidcRequestKeyPrefix     = "oidc/request/"
+	oidcCodeKeyPrefix        = "oidc/code/"
+	oidcAccessTokenKeyPrefix = "oidc/access_token/"
+	oidcConsentKeyPrefix     = "oidc/consent/"
+)
+
+// oauthError is an error response of the authorization server. The code is
+// one of the error codes defined in RFC 6749 and OpenID Connect Core.
+type oauthError struct {
+	code string
+	err  error
+}
+
+func newOAuthError(code string, err error) error {
+	return &oauthError{code: code, err: err}
+}
+
+func (e *oauthError) Error() string {
+	return e.err.Error()
+}
+
+// getOAuthErrorCode returns the error code of the error, or server_error
+// when the error is not an oauthError.
+func getOAuthErrorCode(err error) string {
+	if e, ok := err.(*oauthError); ok {
+		return e.code
+	}
+	return "server_error"
+}
+
+// oidcAuthorizationRequest is a validated authorization request of a client.
+type oidcAuthorizationRequest struct {
+	id            string
+	client        *OpenIDConnectClientConfig
+	redirectURL   string
+	state         string
+	nonce         string
+	prompt        string
+	codeChallenge string
+	scopes        []string
+	// subject is the user the request awaits consent from.
+	subject   string
+	expiresAt time.Time
+}
+
+// oidcGrant is the authorization granted by a user to a client. It backs
+// both the authorization codes and the access tokens.
+type oidcGrant struct {
+	request   *oidcAuthorizationRequest
+	user      *user.User
+	issuedAt  time.Time
+	expiresAt time.Time
+}
+
+// oidcAuthorizationRecord is the serialized form of oidcAuthorizationRequest
+// kept in a key/value store.
+type oidcAuthorizationRecord struct {
+	ClientID      string    `json:"client_id"`
+	RedirectURL   string    `json:"redirect_url"`
+	State         string    `json:"state,omitempty"`
+	Nonce         string    `json:"nonce,omitempty"`
+	Prompt        string    `json:"prompt,omitempty"`
+	CodeChallenge string    `json:"code_challenge,omitempty"`
+	Scopes        []string  `json:"scopes"`
+	Subject       string    `json:"subject,omitempty"`
+	ExpiresAt     time.Time `json:"expires_at,omitempty"`
+}
+
+// oidcGrantRecord is the serialized form of oidcGrant kept in a key/value
+// store.
+type oidcGrantRecord struct {
+	Request   *oidcAuthorizationRecord `json:"request"`
+	Claims    map[string]interface{}   `json:"claims"`
+	IssuedAt  time.Time                `json:"issued_at"`
+	ExpiresAt time.Time                `json:"expires_at"`
+}
+
+// openIDProvider holds the state of the OpenID Connect provider, i.e. the
+// authorization requests awaiting consent, the authorization codes, the
+// access tokens, and the consents of the users. The codes and the access
+// tokens are opaque and only their hashes are kept. The state is kept in a
+// key/value store, which is in memory unless set with SetStore.
+type openIDProvider struct {
+	mu            sync.RWMutex
+	config        *OpenIDConnectConfig
+	clients       map[string]*OpenIDConnectClientConfig
+	codeLifetime  time.Duration
+	tokenLifetime time.Duration
+	store         kvstore.Store
+}
+
+func newOpenIDProvider(cfg *OpenIDConnectConfig) *openIDProvider {
+	p := &openIDProvider{
+		config:        cfg,
+		clients:       make(map[string]*OpenIDConnectClientConfig),
+		codeLifetime:  time.Duration(cfg.CodeLifetime) * time.Second,
+		tokenLifetime: time.Duration(cfg.TokenLifetime) * time.Second,
+		store:         kvstore.NewMemoryStore(),
+	}
+	for _, client := range cfg.Clients {
+		p.clients[client.ClientID] = client
+	}
+	return p
+}
+
+// SetStore sets the key/value store holding the state of the provider.
+func (p *openIDProvider) SetStore(store kvstore.Store) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.store = store
+}
+
+func (p *openIDProvider) getStore() kvstore.Store {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.store
+}
+
+// getClient returns the client with the provided id and redirect URL. The
+// errors are not sent to the redirect URL, because it is not trusted.
+func (p *openIDProvider) getClient(clientID, redirectURL string) (*OpenIDConnectClientConfig, error) {
+	client, exists := p.clients[clientID]
+	if !exists {
+		return nil, errors.ErrOpenIDConnectClientNotFound.WithArgs(clientID)
+	}
+	if !slices.Contains(client.RedirectURLs, redirectURL) {
+		return nil, errors.ErrOpenIDConnectRedirectURLMismatch.WithArgs(clientID, redirectURL)
+	}
+	return client, nil
+}
+
+// newAuthorizationRequest validates the parameters of the authorization
+// request of the client.
+func (p *openIDProvider) newAuthorizationRequest(client *OpenIDConnectClientConfig, q url.Values) (*oidcAuthorizationRequest, error) {
+	if s := q.Get("response_type"); s != "code" {
+		return nil, newOAuthError("unsupported_response_type", errors.ErrOpenIDConnectResponseTypeUnsupported.WithArgs(s))
+	}
+
+	var scopes []string
+	for _, scope := range strings.Fields(q.Get("scope")) {
+		if !slices.Contains(client.Scopes, scope) {
+			return nil, newOAuthError("invalid_scope", errors.ErrOpenIDConnectScopeNotAllowed.WithArgs(client.ClientID, scope))
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if !slices.Contains(scopes, "openid") {
+		return nil, newOAuthError("invalid_scope", errors.ErrOpenIDConnectScopeNotFound)
+	}
+
+	codeChallenge := q.Get("code_challenge")
+	if codeChallenge == "" {
+		if client.ClientSecret == "" || client.PKCERequired {
+			return nil, newOAuthError("invalid_request", errors.ErrOpenIDConnectCodeChallengeNotFound.WithArgs(client.ClientID))
+		}
+	} else {
+		// The plain method offers no protection when the request is
+		// intercepted, hence only S256 is supported.
+		if s := q.Get("code_challenge_method"); s != "S256" {
+			return nil, newOAuthError("invalid_request", errors.ErrOpenIDConnectCodeChallengeMethod.WithArgs(s))
+		}
+	}
+
+	req := &oidcAuthorizationRequest{
+		client:        client,
+		redirectURL:   q.Get("redirect_uri"),
+		state:         q.Get("state"),
+		nonce:         q.Get("nonce"),
+		prompt:        q.Get("prompt"),
+		codeChallenge: codeChallenge,
+		scopes:        scopes,
+	}
+	return req, nil
+}
+
+// isConsentRequired returns true when the user has not granted the
+// requested scopes to the client yet.
+func (p *openIDProvider) isConsentRequired(req *oidcAuthorizationRequest, usr *user.User) bool {
+	if req.prompt == "consent" {
+		return true
+	}
+	if req.client.SkipConsent {
+		return false
+	}
+	granted := p.getConsent(usr.Claims.Subject, req.client.ClientID)
+	for _, scope := range req.scopes {
+		if !slices.Contains(granted, scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// addConsent records the consent of the user to release the requested
+// scopes to the client.
+func (p *openIDProvider) addConsent(req *oidcAuthorizationRequest, usr *user.User) error {
+	granted := p.getConsent(usr.Claims.Subject, req.client.ClientID)
+	for _, scope := range req.scopes {
+		if !slices.Contains(granted, scope) {
+			granted = append(granted, scope)
+		}
+	}
+	b, err := json.Marshal(granted)
+	if err != nil {
+		return err
+	}
+	return p.getStore().Set(getOpenIDConnectConsentKey(usr.Claims.Subject, req.client.ClientID), b, 0)
+}
+
+func (p *openIDProvider) getConsent(subject, clientID string) []string {
+	b, err := p.getStore().Get(getOpenIDConnectConsentKey(subject, clientID))
+	if err != nil {
+		return nil
+	}
+	var granted []string
+	if err := json.Unmarshal(b, &granted); err != nil {
+		return nil
+	}
+	return granted
+}
+
+// saveAuthorizationRequest saves the authorization request awaiting the
+// consent of the user and returns the id of the request.
+func (p *openIDProvider) saveAuthorizationRequest(req *oidcAuthorizationRequest, usr *user.User) (string, error) {
+	id, err := newRefreshTokenPart(16)
+	if err != nil {
+		return "", err
+	}
+	req.id = id
+	req.subject = usr.Claims.Subject
+	req.expiresAt = time.Now().Add(oidcConsentRequestLifetime)
+
+	b, err := json.Marshal(newOpenIDConnectAuthorizationRecord(req))
+	if err != nil {
+		return "", err
+	}
+	if err := p.getStore().Set(getOpenIDConnectStateKey(oidcRequestKeyPrefix, id), b, oidcConsentRequestLifetime); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// loadAuthorizationRequest removes the authorization request awaiting the
+// consent of the user and returns it.
+func (p *openIDProvider) loadAuthorizationRequest(id string, usr *user.User) (*oidcAuthorizationRequest, error) {
+	if id == "" {
+		return nil, errors.ErrOpenIDConnectAuthorizationRequestNotFound
+	}
+	store := p.getStore()
+	k := getOpenIDConnectStateKey(oidcRequestKeyPrefix, id)
+	b, err := store.Get(k)
+	if err != nil {
+		return nil, errors.ErrOpenIDConnectAuthorizationRequestNotFound
+	}
+	record := &oidcAuthorizationRecord{}
+	if err := json.Unmarshal(b, record); err != nil || record.Subject != usr.Claims.Subject {
+		return nil, errors.ErrOpenIDConnectAuthorizationRequestNotFound
+	}
+	if err := p.markUsed(store, k, oidcConsentRequestLifetime); err != nil {
+		return nil, errors.ErrOpenIDConnectAuthorizationRequestNotFound
+	}
+	store.Delete(k)
+	if !time.Now().Before(record.ExpiresAt) {
+		return nil, errors.ErrOpenIDConnectAuthorizationRequestNotFound
+	}
+	req, err := p.getAuthorizationRequest(record)
+	if err != nil {
+		return nil, errors.ErrOpenIDConnectAuthorizationRequestNotFound
+	}
+	req.id = id
+	return req, nil
+}
+
+// issueCode returns the authorization code for the request granted by the
+// user.
+func (p *openIDProvider) issueCode(req *oidcAuthorizationRequest, usr *user.User) (string, error) {
+	code, err := newRefreshTokenPart(32)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	grant := &oidcGrant{
+		request:   req,
+		user:      usr,
+		issuedAt:  now,
+		expiresAt: now.Add(p.codeLifetime),
+	}
+	if err := p.putGrant(oidcCodeKeyPrefix, code, grant); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// authenticateClient returns the client authenticated by the secret. The
+// public clients have no secret.
+func (p *openIDProvider) authenticateClient(clientID, clientSecret string) (*OpenIDConnectClientConfig, error) {
+	client, exists := p.clients[clientID]
+	if !exists {
+		return nil, newOAuthError("invalid_client", errors.ErrOpenIDConnectClientNotFound.WithArgs(clientID))
+	}
+	if client.ClientSecret == "" {
+		return client, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(client.ClientSecret), []byte(clientSecret)) != 1 {
+		return nil, newOAuthError("invalid_client", errors.ErrOpenIDConnectClientAuthFailed.WithArgs(clientID))
+	}
+	return client, nil
+}
+
+// redeemCode exchanges the authorization code for an access token. The code
+// is single use, i.e. it is removed even when the exchange fails.
+func (p *openIDProvider) redeemCode(client *OpenIDConnectClientConfig, code, redirectURL, codeVerifier string) (*oidcGrant, string, error) {
+	accessToken, err := newRefreshTokenPart(32)
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	store := p.getStore()
+	grant, err := p.getGrant(oidcCodeKeyPrefix, code)
+	if err != nil {
+		return nil, "", newOAuthError("invalid_grant", errors.ErrOpenIDConnectAuthorizationCodeInvalid)
+	}
+	// The code is redeemed once, even when several instances of the portal
+	// receive it at the same time.
+	k := getOpenIDConnectStateKey(oidcCodeKeyPrefix, code)
+	if err := p.markUsed(store, k, p.codeLifetime); err != nil {
+		return nil, "", newOAuthError("invalid_grant", errors.ErrOpenIDConnectAuthorizationCodeInvalid)
+	}
+	store.Delete(k)
+	if !now.Before(grant.expiresAt) || grant.request.client.ClientID != client.ClientID || grant.request.redirectURL != redirectURL {
+		return nil, "", newOAuthError("invalid_grant", errors.ErrOpenIDConnectAuthorizationCodeInvalid)
+	}
+	if !isValidCodeVerifier(grant.request.codeChallenge, codeVerifier) {
+		return nil, "", newOAuthError("invalid_grant", errors.ErrOpenIDConnectCodeVerifierMismatch)
+	}
+
+	tokenGrant := &oidcGrant{
+		request:   grant.request,
+		user:      grant.user,
+		issuedAt:  now,
+		expiresAt: now.Add(p.tokenLifetime),
+	}
+	if err := p.putGrant(oidcAccessTokenKeyPrefix, accessToken, tokenGrant); err != nil {
+		return nil, "", err
+	}
+	return tokenGrant, accessToken, nil
+}
+
+// getAccessTokenGrant returns the grant of the access token.
+func (p *openIDProvider) getAccessTokenGrant(accessToken string) (*oidcGrant, error) {
+	grant, err := p.getGrant(oidcAccessTokenKeyPrefix, accessToken)
+	if err != nil || !time.Now().Before(grant.expiresAt) {
+		return nil, errors.ErrOpenIDConnectAccessTokenInvalid
+	}
+	return grant, nil
+}
+
+// getClaims returns the user claims released for the granted scopes.
+func (p *openIDProvider) getClaims(grant *oidcGrant) map[string]interface{} {
+	userClaims := grant.user.AsMap()
+	claims := map[string]interface{}{
+		"sub": grant.user.Claims.Subject,
+	}
+	for _, scope := range grant.request.scopes {
+		for _, k := range p.config.scopeClaims[scope] {
+			if v, exists := userClaims[k]; exists {
+				claims[k] = v
+			}
+		}
+	}
+	return claims
+}
+
+func (p *openIDProvider) putGrant(prefix, secret string, grant *oidcGrant) error {
+	ttl := time.Until(grant.expiresAt)
+	if ttl <= 0 {
+		return errors.ErrOpenIDConnectGrantExpired
+	}
+	b, err := json.Marshal(&oidcGrantRecord{
+		Request:   newOpenIDConnectAuthorizationRecord(grant.request),
+		Claims:    grant.user.AsMap(),
+		IssuedAt:  grant.issuedAt,
+		ExpiresAt: grant.expiresAt,
+	})
+	if err != nil {
+		return err
+	}
+	return p.getStore().Set(getOpenIDConnectStateKey(prefix, secret), b, ttl)
+}
+
+func (p *openIDProvider) getGrant(prefix, secret string) (*oidcGrant, error) {
+	if secret == "" {
+		return nil, errors.ErrKVStoreKeyNotFound
+	}
+	b, err := p.getStore().Get(getOpenIDConnectStateKey(prefix, secret))
+	if err != nil {
+		return nil, err
+	}
+	record := &oidcGrantRecord{}
+	if err := json.Unmarshal(b, record); err != nil {
+		return nil, err
+	}
+	if record.Request == nil {
+		return nil, errors.ErrKVStoreKeyNotFound
+	}
+	req, err := p.getAuthorizationRequest(record.Request)
+	if err != nil {
+		return nil, err
+	}
+	usr, err := user.NewUser(record.Claims)
+	if err != nil {
+		return nil, err
+	}
+	return &oidcGrant{
+		request:   req,
+		user:      usr,
+		issuedAt:  record.IssuedAt,
+		expiresAt: record.ExpiresAt,
+	}, nil
+}
+
+// getAuthorizationRequest returns the authorization request of the record.
+// It fails when the client has been removed from the configuration.
+func (p *openIDProvider) getAuthorizationRequest(record *oidcAuthorizationRecord) (*oidcAuthorizationRequest, error) {
+	client, exists := p.clients[record.ClientID]
+	if !exists {
+		return nil, errors.ErrOpenIDConnectClientNotFound.WithArgs(record.ClientID)
+	}
+	return &oidcAuthorizationRequest{
+		client:        client,
+		redirectURL:   record.RedirectURL,
+		state:         record.State,
+		nonce:         record.Nonce,
+		prompt:        record.Prompt,
+		codeChallenge: record.CodeChallenge,
+		scopes:        record.Scopes,
+		subject:       record.Subject,
+		expiresAt:     record.ExpiresAt,
+	}, nil
+}
+
+// markUsed marks the entry with the key as used. It fails when the entry
+// has been used already.
+func (p *openIDProvider) markUsed(store kvstore.Store, k string, ttl time.Duration) error {
+	return store.Add(k+"/used", []byte{1}, ttl)
+}
+
+func newOpenIDConnectAuthorizationRecord(req *oidcAuthorizationRequest) *oidcAuthorizationRecord {
+	return &oidcAuthorizationRecord{
+		ClientID:      req.client.ClientID,
+		RedirectURL:   req.redirectURL,
+		State:         req.state,
+		Nonce:         req.nonce,
+		Prompt:        req.prompt,
+		CodeChallenge: req.codeChallenge,
+		Scopes:        req.scopes,
+		Subject:       req.subject,
+		ExpiresAt:     req.expiresAt,
+	}
+}
+
+// getOpenIDConnectStateKey returns the key of the request, code or access
+// token. Only the hash of the secret is kept.
+func getOpenIDConnectStateKey(prefix, secret string) string {
+	h := sha256.Sum256([]byte(secret))
+	return prefix + hex.EncodeToString(h[:])
+}
+
+func getOpenIDConnectConsentKey(subject, clientID string) string {
+	return oidcConsentKeyPrefix + url.PathEscape(clientID) + "/" + url.PathEscape(subject)
+}
+
+// isValidCodeVerifier checks the code verifier against the S256 code
+// challenge. See RFC 7636, Section 4.6.
+func isValidCodeVerifier(codeChallenge, codeVerifier string) bool {
+	if codeChallenge == "" {
+		return codeVerifier == ""
+	}
+	h := sha256.Sum256([]byte(codeVerifier))
+	s := base64.RawURLEncoding.EncodeToString(h[:])
+	return subtle.ConstantTimeCompare([]byte(s), []byte(codeChallenge)) == 1
+}
@@ -0,0 +1,154 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authn
+
+import (
+	"net/url"
+	"slices"
+
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+)
+
+const (
+	defaultOpenIDConnectTokenLifetime int = 3600
+	minOpenIDConnectTokenLifetime     int = 60
+	maxOpenIDConnectTokenLifetime     int = 86400
+	defaultOpenIDConnectCodeLifetime  int = 60
+	minOpenIDConnectCodeLifetime      int = 10
+	maxOpenIDConnectCodeLifetime      int = 600
+)
+
+// defaultOpenIDConnectScopeClaims maps the scopes to the user claims
+// released for them.
+var defaultOpenIDConnectScopeClaims = map[string][]string{
+	"openid":  {"sub"},
+	"profile": {"name", "picture"},
+	"email":   {"email"},
+	"roles":   {"roles"},
+}
+
+var defaultOpenIDConnectClientScopes = []string{"openid", "profile", "email"}
+
+// OpenIDConnectConfig holds the configuration of the OpenID Connect
+// provider of the portal. The provider issues ID tokens to the registered
+// clients, i.e. the applications relying on the portal for the login.
+type OpenIDConnectConfig struct {
+	// Clients holds the registered clients.
+	Clients []*OpenIDConnectClientConfig `json:"clients,omitempty" xml:"clients,omitempty" yaml:"clients,omitempty"`
+	// ScopeClaims maps the scopes to the user claims released for them.
+	// The entries extend or override the default mapping of openid,
+	// profile, email, and roles scopes.
+	ScopeClaims map[string][]string `json:"scope_claims,omitempty" xml:"scope_claims,omitempty" yaml:"scope_claims,omitempty"`
+	// The lifetime (in seconds) of ID tokens and access tokens. The
+	// default is 1 hour.
+	TokenLifetime int `json:"token_lifetime,omitempty" xml:"token_lifetime,omitempty" yaml:"token_lifetime,omitempty"`
+	// The lifetime (in seconds) of authorization codes. The default is
+	// 1 minute.
+	CodeLifetime int `json:"code_lifetime,omitempty" xml:"code_lifetime,omitempty" yaml:"code_lifetime,omitempty"`
+	scopeClaims  map[string][]string
+}
+
+// OpenIDConnectClientConfig is the registration of an OpenID Connect client.
+type OpenIDConnectClientConfig struct {
+	ClientID string `json:"client_id,omitempty" xml:"client_id,omitempty" yaml:"client_id,omitempty"`
+	// ClientName is the name of the client displayed on the consent screen.
+	// The default is the client id.
+	ClientName string `json:"client_name,omitempty" xml:"client_name,omitempty" yaml:"client_name,omitempty"`
+	// ClientSecret authenticates the client at the token endpoint. The
+	// clients without secret, e.g. single-page applications, are public
+	// clients and must use PKCE.
+	ClientSecret string `json:"client_secret,omitempty" xml:"client_secret,omitempty" yaml:"client_secret,omitempty"`
+	// RedirectURLs holds the URLs the authorization responses are sent to.
+	// The redirect URL of an authorization request must match one of them
+	// exactly.
+	RedirectURLs []string `json:"redirect_urls,omitempty" xml:"redirect_urls,omitempty" yaml:"redirect_urls,omitempty"`
+	// Scopes holds the scopes the client is allowed to request. The default
+	// is openid, profile, and email.
+	Scopes []string `json:"scopes,omitempty" xml:"scopes,omitempty" yaml:"scopes,omitempty"`
+	// When enabled, the client must use PKCE even if it has a secret.
+	PKCERequired bool `json:"pkce_required,omitempty" xml:"pkce_required,omitempty" yaml:"pkce_required,omitempty"`
+	// When enabled, the users are not asked for consent, e.g. for the
+	// in-house applications.
+	SkipConsent bool `json:"skip_consent,omitempty" xml:"skip_consent,omitempty" yaml:"skip_consent,omitempty"`
+}
+
+// Validate validates OpenID Connect configuration.
+func (cfg *OpenIDConnectConfig) Validate(portalName string) error {
+	if cfg.TokenLifetime == 0 {
+		cfg.TokenLifetime = defaultOpenIDConnectTokenLifetime
+	}
+	if cfg.TokenLifetime < minOpenIDConnectTokenLifetime || cfg.TokenLifetime > maxOpenIDConnectTokenLifetime {
+		return errors.ErrOpenIDConnectConfigTokenLifetime.WithArgs(portalName, cfg.TokenLifetime)
+	}
+	if cfg.CodeLifetime == 0 {
+		cfg.CodeLifetime = defaultOpenIDConnectCodeLifetime
+	}
+	if cfg.CodeLifetime < minOpenIDConnectCodeLifetime || cfg.CodeLifetime > maxOpenIDConnectCodeLifetime {
+		return errors.ErrOpenIDConnectConfigCodeLifetime.WithArgs(portalName, cfg.CodeLifetime)
+	}
+
+	cfg.scopeClaims = make(map[string][]string)
+	for k, v := range defaultOpenIDConnectScopeClaims {
+		cfg.scopeClaims[k] = v
+	}
+	for k, v := range cfg.ScopeClaims {
+		if len(v) == 0 {
+			return errors.ErrOpenIDConnectConfigScopeClaimsEmpty.WithArgs(portalName, k)
+		}
+		cfg.scopeClaims[k] = v
+	}
+
+	clientIDs := make(map[string]bool)
+	for _, client := range cfg.Clients {
+		if client.ClientID == "" {
+			return errors.ErrOpenIDConnectConfigClientIDEmpty.WithArgs(portalName)
+		}
+		if clientIDs[client.ClientID] {
+			return errors.ErrOpenIDConnectConfigClientDuplicate.WithArgs(portalName, client.ClientID)
+		}
+		clientIDs[client.ClientID] = true
+		if err := client.validate(portalName, cfg.scopeClaims); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (client *OpenIDConnectClientConfig) validate(portalName string, scopeClaims map[string][]string) error {
+	if client.ClientName == "" {
+		client.ClientName = client.ClientID
+	}
+	if len(client.RedirectURLs) == 0 {
+		return errors.ErrOpenIDConnectConfigRedirectURLsNotFound.WithArgs(portalName, client.ClientID)
+	}
+	for _, s := range client.RedirectURLs {
+		u, err := url.Parse(s)
+		if err != nil || u.Scheme == "" || u.Host == "" || u.Fragment != "" {
+			return errors.ErrOpenIDConnectConfigRedirectURLInvalid.WithArgs(portalName, client.ClientID, s)
+		}
+	}
+	if len(client.Scopes) == 0 {
+		client.Scopes = append(client.Scopes, defaultOpenIDConnectClientScopes...)
+	}
+	if !slices.Contains(client.Scopes, "openid") {
+		client.Scopes = append([]string{"openid"}, client.Scopes...)
+	}
+	for _, scope := range client.Scopes {
+		if _, exists := scopeClaims[scope]; !exists {
+			return errors.ErrOpenIDConnectConfigScopeUnsupported.WithArgs(portalName, client.ClientID, scope)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,743 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authn
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	jwtlib "github.com/golang-jwt/jwt/v4"
+	"github.com/greenpau/go-authcrunch/internal/tests"
+	"github.com/greenpau/go-authcrunch/internal/testutils"
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/ids"
+	"github.com/greenpau/go-authcrunch/pkg/kms"
+	"github.com/greenpau/go-authcrunch/pkg/kvstore"
+	"github.com/greenpau/go-authcrunch/pkg/requests"
+	"github.com/greenpau/go-authcrunch/pkg/user"
+	logutil "github.com/greenpau/go-authcrunch/pkg/util/log"
+)
+
+const (
+	testOpenIDConnectRedirectURL  = "https://app.contoso.com/callback"
+	testOpenIDConnectIssuer       = "https://auth.contoso.com/auth"
+	testOpenIDConnectCodeVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+var testOpenIDConnectConsentRgx = regexp.MustCompile(`name="consent_id" type="hidden" value="([^"]+)"`)
+
+func TestOpenIDConnectConfig(t *testing.T) {
+	testcases := []struct {
+		name      string
+		config    *OpenIDConnectConfig
+		want      map[string]interface{}
+		shouldErr bool
+		err       error
+	}{
+		{
+			name: "test valid config with defaults",
+			config: &OpenIDConnectConfig{
+				Clients: []*OpenIDConnectClientConfig{
+					{
+						ClientID:     "grafana",
+						RedirectURLs: []string{"https://grafana.contoso.com/login/generic_oauth"},
+						Scopes:       []string{"email", "roles"},
+					},
+				},
+			},
+			want: map[string]interface{}{
+				"token_lifetime": 3600,
+				"code_lifetime":  60,
+				"client_name":    "grafana",
+				"client_scopes":  []string{"openid", "email", "roles"},
+			},
+		},
+		{
+			name: "test custom scope",
+			config: &OpenIDConnectConfig{
+				ScopeClaims: map[string][]string{
+					"org": {"org"},
+				},
+				Clients: []*OpenIDConnectClientConfig{
+					{
+						ClientID:     "grafana",
+						ClientName:   "Grafana",
+						RedirectURLs: []string{"https://grafana.contoso.com/login/generic_oauth"},
+						Scopes:       []string{"openid", "org"},
+					},
+				},
+			},
+			want: map[string]interface{}{
+				"token_lifetime": 3600,
+				"code_lifetime":  60,
+				"client_name":    "Grafana",
+				"client_scopes":  []string{"openid", "org"},
+			},
+		},
+		{
+			name: "test unsupported scope",
+			config: &OpenIDConnectConfig{
+				Clients: []*OpenIDConnectClientConfig{
+					{
+						ClientID:     "grafana",
+						RedirectURLs: []string{"https://grafana.contoso.com/login/generic_oauth"},
+						Scopes:       []string{"openid", "org"},
+					},
+				},
+			},
+			shouldErr: true,
+			err:       errors.ErrOpenIDConnectConfigScopeUnsupported.WithArgs("myportal", "grafana", "org"),
+		},
+		{
+			name: "test relative redirect url",
+			config: &OpenIDConnectConfig{
+				Clients: []*OpenIDConnectClientConfig{
+					{
+						ClientID:     "grafana",
+						RedirectURLs: []string{"/login/generic_oauth"},
+					},
+				},
+			},
+			shouldErr: true,
+			err:       errors.ErrOpenIDConnectConfigRedirectURLInvalid.WithArgs("myportal", "grafana", "/login/generic_oauth"),
+		},
+		{
+			name: "test duplicate client",
+			config: &OpenIDConnectConfig{
+				Clients: []*OpenIDConnectClientConfig{
+					{
+						ClientID:     "grafana",
+						RedirectURLs: []string{"https://grafana.contoso.com/login/generic_oauth"},
+					},
+					{
+						ClientID:     "grafana",
+						RedirectURLs: []string{"https://grafana.contoso.com/login/generic_oauth"},
+					},
+				},
+			},
+			shouldErr: true,
+			err:       errors.ErrOpenIDConnectConfigClientDuplicate.WithArgs("myportal", "grafana"),
+		},
+		{
+			name: "test token lifetime out of range",
+			config: &OpenIDConnectConfig{
+				TokenLifetime: 30,
+			},
+			shouldErr: true,
+			err:       errors.ErrOpenIDConnectConfigTokenLifetime.WithArgs("myportal", 30),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			err := tc.config.Validate("myportal")
+			if tests.EvalErrWithLog(t, err, "config", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			got := map[string]interface{}{
+				"token_lifetime": tc.config.TokenLifetime,
+				"code_lifetime":  tc.config.CodeLifetime,
+				"client_name":    tc.config.Clients[0].ClientName,
+				"client_scopes":  tc.config.Clients[0].Scopes,
+			}
+			tests.EvalObjectsWithLog(t, "config", tc.want, got, msgs)
+		})
+	}
+}
+
+func newTestOpenIDConnectPortal(t *testing.T) *Portal {
+	portal, err := newTestOpenIDConnectPortalWithConfig(t, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return portal
+}
+
+func newTestOpenIDConnectPortalWithConfig(t *testing.T, configure func(*PortalConfig)) (*Portal, error) {
+	db, err := testutils.CreateTestDatabase("TestOpenIDConnect")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	logger := logutil.NewLogger()
+	store, err := ids.NewIdentityStore(&ids.IdentityStoreConfig{
+		Name: "local_backend",
+		Kind: "local",
+		Params: map[string]interface{}{
+			"path":  db.GetPath(),
+			"realm": "local",
+		},
+	}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Configure(); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &PortalConfig{
+		Name:           "myportal",
+		BaseURL:        testOpenIDConnectIssuer,
+		IdentityStores: []string{"local_backend"},
+		OpenIDConnect: &OpenIDConnectConfig{
+			Clients: []*OpenIDConnectClientConfig{
+				{
+					ClientID:     "webapp",
+					ClientName:   "Web App",
+					ClientSecret: "foobar",
+					RedirectURLs: []string{testOpenIDConnectRedirectURL},
+				},
+				{
+					ClientID:     "spa",
+					RedirectURLs: []string{testOpenIDConnectRedirectURL},
+					Scopes:       []string{"openid", "email", "roles"},
+					SkipConsent:  true,
+				},
+			},
+		},
+	}
+	if configure != nil {
+		configure(cfg)
+	}
+	return NewPortal(PortalParameters{
+		Config:         cfg,
+		Logger:         logger,
+		IdentityStores: []ids.IdentityStore{store},
+	})
+}
+
+func newTestOpenIDConnectKeyConfigs(t *testing.T, s string) []*kms.CryptoKeyConfig {
+	configs, err := kms.ParseCryptoKeyConfigs(s)
+	if err != nil {
+		t.Fatalf("failed parsing crypto key configs: %v", err)
+	}
+	return configs
+}
+
+func TestOpenIDConnectPortalConfig(t *testing.T) {
+	testcases := []struct {
+		name      string
+		configure func(*PortalConfig)
+		shouldErr bool
+		err       error
+	}{
+		{
+			name: "test portal with auto-generated keys",
+		},
+		{
+			name: "test portal with id token key",
+			configure: func(cfg *PortalConfig) {
+				cfg.CryptoKeyConfigs = newTestOpenIDConnectKeyConfigs(t, strings.Join([]string{
+					`crypto key sign-verify foobar`,
+					`crypto key k1 sign-verify from file ./../../testdata/ecdsakeys/test_4_pri.pem`,
+					`crypto key k1 token name id_token`,
+				}, "\n"))
+			},
+		},
+		{
+			name: "test portal without base url",
+			configure: func(cfg *PortalConfig) {
+				cfg.BaseURL = ""
+			},
+			shouldErr: true,
+			err:       errors.ErrNewPortal.WithArgs(errors.ErrOpenIDConnectConfigBaseURLEmpty.WithArgs("myportal")),
+		},
+		{
+			name: "test portal with shared secret keys only",
+			configure: func(cfg *PortalConfig) {
+				cfg.CryptoKeyConfigs = newTestOpenIDConnectKeyConfigs(t, strings.Join([]string{
+					`crypto key sign-verify foobar`,
+					`crypto key k1 sign-verify barfoo`,
+					`crypto key k1 token name id_token`,
+				}, "\n"))
+			},
+			shouldErr: true,
+			err:       errors.ErrOpenIDConnectConfigSignKeyNotFound.WithArgs("myportal", "id_token"),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			_, err := newTestOpenIDConnectPortalWithConfig(t, tc.configure)
+			tests.EvalErrWithLog(t, err, "portal", tc.shouldErr, tc.err, msgs)
+		})
+	}
+}
+
+func TestOpenIDConnect(t *testing.T) {
+	portal := newTestOpenIDConnectPortal(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := portal.ServeHTTP(context.Background(), w, r, requests.NewRequest()); err != nil {
+			t.Logf("failed serving request: %v", err)
+		}
+	}))
+	defer ts.Close()
+
+	h := sha256.Sum256([]byte(testOpenIDConnectCodeVerifier))
+	codeChallenge := base64.RawURLEncoding.EncodeToString(h[:])
+
+	testcases := []struct {
+		name         string
+		unauthorized bool
+		params       map[string]string
+		consent      string
+		clientID     string
+		clientSecret string
+		codeVerifier string
+		redeemTwice  bool
+		want         map[string]interface{}
+	}{
+		{
+			name:         "test unauthenticated user is redirected to login",
+			unauthorized: true,
+			params: map[string]string{
+				"client_id": "webapp",
+				"scope":     "openid email",
+			},
+			want: map[string]interface{}{
+				"status_code": http.StatusFound,
+				"location":    "/auth/login",
+			},
+		},
+		{
+			name:         "test unauthenticated user with prompt none",
+			unauthorized: true,
+			params: map[string]string{
+				"client_id": "webapp",
+				"scope":     "openid",
+				"prompt":    "none",
+			},
+			want: map[string]interface{}{
+				"status_code": http.StatusFound,
+				"error":       "login_required",
+				"state":       "af0ifjsldkj",
+			},
+		},
+		{
+			name: "test confidential client with consent",
+			params: map[string]string{
+				"client_id": "webapp",
+				"scope":     "openid profile email",
+				"nonce":     "n-0S6_WzA2Mj",
+			},
+			consent:      "allow",
+			clientID:     "webapp",
+			clientSecret: "foobar",
+			want: map[string]interface{}{
+				"status_code":    http.StatusFound,
+				"consent":        true,
+				"state":          "af0ifjsldkj",
+				"token_status":   http.StatusOK,
+				"scope":          "openid profile email",
+				"id_token_aud":   "webapp",
+				"id_token_iss":   testOpenIDConnectIssuer,
+				"id_token_nonce": "n-0S6_WzA2Mj",
+				"id_token_email": tests.TestEmail1,
+				"userinfo":       map[string]interface{}{"email": tests.TestEmail1},
+			},
+		},
+		{
+			name: "test consent is remembered",
+			params: map[string]string{
+				"client_id": "webapp",
+				"scope":     "openid email",
+			},
+			clientID:     "webapp",
+			clientSecret: "foobar",
+			want: map[string]interface{}{
+				"status_code":    http.StatusFound,
+				"consent":        false,
+				"state":          "af0ifjsldkj",
+				"token_status":   http.StatusOK,
+				"scope":          "openid email",
+				"id_token_aud":   "webapp",
+				"id_token_iss":   testOpenIDConnectIssuer,
+				"id_token_nonce": nil,
+				"id_token_email": tests.TestEmail1,
+				"userinfo":       map[string]interface{}{"email": tests.TestEmail1},
+			},
+		},
+		{
+			name: "test scope not allowed",
+			params: map[string]string{
+				"client_id": "webapp",
+				"scope":     "openid roles",
+			},
+			want: map[string]interface{}{
+				"status_code": http.StatusFound,
+				"error":       "invalid_scope",
+				"state":       "af0ifjsldkj",
+			},
+		},
+		{
+			name: "test user denies consent",
+			params: map[string]string{
+				"client_id": "webapp",
+				"scope":     "openid profile",
+				"prompt":    "consent",
+			},
+			consent: "deny",
+			want: map[string]interface{}{
+				"status_code": http.StatusFound,
+				"consent":     true,
+				"error":       "access_denied",
+				"state":       "af0ifjsldkj",
+			},
+		},
+		{
+			name: "test public client with pkce",
+			params: map[string]string{
+				"client_id":             "spa",
+				"scope":                 "openid roles",
+				"code_challenge":        codeChallenge,
+				"code_challenge_method": "S256",
+			},
+			clientID:     "spa",
+			codeVerifier: testOpenIDConnectCodeVerifier,
+			redeemTwice:  true,
+			want: map[string]interface{}{
+				"status_code":    http.StatusFound,
+				"consent":        false,
+				"state":          "af0ifjsldkj",
+				"token_status":   http.StatusOK,
+				"scope":          "openid roles",
+				"id_token_aud":   "spa",
+				"id_token_iss":   testOpenIDConnectIssuer,
+				"id_token_nonce": nil,
+				"id_token_email": nil,
+				"userinfo":       map[string]interface{}{"email": nil},
+				"second_redeem":  "invalid_grant",
+			},
+		},
+		{
+			name: "test public client without pkce",
+			params: map[string]string{
+				"client_id": "spa",
+				"scope":     "openid",
+			},
+			want: map[string]interface{}{
+				"status_code": http.StatusFound,
+				"error":       "invalid_request",
+				"state":       "af0ifjsldkj",
+			},
+		},
+		{
+			name: "test public client with wrong code verifier",
+			params: map[string]string{
+				"client_id":             "spa",
+				"scope":                 "openid",
+				"code_challenge":        codeChallenge,
+				"code_challenge_method": "S256",
+			},
+			clientID:     "spa",
+			codeVerifier: "foobar",
+			want: map[string]interface{}{
+				"status_code":  http.StatusFound,
+				"consent":      false,
+				"state":        "af0ifjsldkj",
+				"token_status": http.StatusBadRequest,
+				"token_error":  "invalid_grant",
+			},
+		},
+		{
+			name: "test confidential client with wrong secret",
+			params: map[string]string{
+				"client_id": "webapp",
+				"scope":     "openid email",
+			},
+			clientID:     "webapp",
+			clientSecret: "barfoo",
+			want: map[string]interface{}{
+				"status_code":  http.StatusFound,
+				"consent":      false,
+				"state":        "af0ifjsldkj",
+				"token_status": http.StatusUnauthorized,
+				"token_error":  "invalid_client",
+			},
+		},
+		{
+			name: "test unregistered redirect url",
+			params: map[string]string{
+				"client_id":    "webapp",
+				"scope":        "openid",
+				"redirect_uri": "https://evil.contoso.com/callback",
+			},
+			want: map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+			},
+		},
+	}
+
+	cj, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{
+		Jar: cj,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	anonymousClient := &http.Client{
+		CheckRedirect: client.CheckRedirect,
+	}
+
+	// Authenticate.
+	b, _ := json.Marshal(&AuthRequest{Username: tests.TestUser1, Password: tests.TestPwd1, Realm: "local"})
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/auth/login", bytes.NewReader(b))
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("failed authentication request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("failed authentication request: %d", resp.StatusCode)
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			got := make(map[string]interface{})
+
+			q := url.Values{}
+			q.Set("response_type", "code")
+			q.Set("redirect_uri", testOpenIDConnectRedirectURL)
+			q.Set("state", "af0ifjsldkj")
+			for k, v := range tc.params {
+				q.Set(k, v)
+			}
+			c := client
+			if tc.unauthorized {
+				c = anonymousClient
+			}
+			resp, err := c.Get(ts.URL + "/auth/oidc/authorize?" + q.Encode())
+			if err != nil {
+				t.Fatalf("failed authorization request: %v", err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			if m := testOpenIDConnectConsentRgx.FindSubmatch(body); m != nil {
+				got["consent"] = true
+				form := url.Values{}
+				form.Set("consent_id", string(m[1]))
+				form.Set("action", tc.consent)
+				resp, err = client.PostForm(ts.URL+"/auth/oidc/consent", form)
+				if err != nil {
+					t.Fatalf("failed consent request: %v", err)
+				}
+				resp.Body.Close()
+			} else if resp.StatusCode == http.StatusFound {
+				got["consent"] = false
+			}
+			got["status_code"] = resp.StatusCode
+
+			location, _ := url.Parse(resp.Header.Get("Location"))
+			switch {
+			case tc.unauthorized && location.Query().Get("error") == "":
+				got["location"] = location.Path
+				delete(got, "consent")
+				tests.EvalObjectsWithLog(t, "authorize", tc.want, got, msgs)
+				return
+			case resp.StatusCode != http.StatusFound:
+				tests.EvalObjectsWithLog(t, "authorize", tc.want, got, msgs)
+				return
+			}
+
+			got["state"] = location.Query().Get("state")
+			if s := location.Query().Get("error"); s != "" {
+				got["error"] = s
+				if got["consent"] == false {
+					delete(got, "consent")
+				}
+				tests.EvalObjectsWithLog(t, "authorize", tc.want, got, msgs)
+				return
+			}
+
+			redeem := func() (int, map[string]interface{}) {
+				form := url.Values{}
+				form.Set("grant_type", "authorization_code")
+				form.Set("code", location.Query().Get("code"))
+				form.Set("redirect_uri", testOpenIDConnectRedirectURL)
+				if tc.codeVerifier != "" {
+					form.Set("code_verifier", tc.codeVerifier)
+				}
+				req, _ := http.NewRequest(http.MethodPost, ts.URL+"/auth/oidc/token", strings.NewReader(form.Encode()))
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				if tc.clientSecret != "" {
+					req.SetBasicAuth(tc.clientID, tc.clientSecret)
+				} else {
+					form.Set("client_id", tc.clientID)
+					req.Body = io.NopCloser(strings.NewReader(form.Encode()))
+					req.ContentLength = int64(len(form.Encode()))
+				}
+				resp, err := anonymousClient.Do(req)
+				if err != nil {
+					t.Fatalf("failed token request: %v", err)
+				}
+				defer resp.Body.Close()
+				m := make(map[string]interface{})
+				if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+					t.Fatalf("failed decoding token response: %v", err)
+				}
+				msgs = append(msgs, fmt.Sprintf("token response: %v", m))
+				return resp.StatusCode, m
+			}
+
+			code, tokenResp := redeem()
+			got["token_status"] = code
+			if code != http.StatusOK {
+				got["token_error"] = tokenResp["error"]
+				tests.EvalObjectsWithLog(t, "token", tc.want, got, msgs)
+				return
+			}
+			got["scope"] = tokenResp["scope"]
+
+			idToken, err := jwtlib.Parse(tokenResp["id_token"].(string), func(token *jwtlib.Token) (interface{}, error) {
+				for _, k := range portal.keystore.GetVerifyKeys() {
+					if k.Verify.Token.Name == kms.IDTokenName {
+						return k.Verify.Secret, nil
+					}
+				}
+				return nil, fmt.Errorf("id token key not found")
+			})
+			if err != nil {
+				t.Fatalf("failed validating id token: %v", err)
+			}
+			claims := idToken.Claims.(jwtlib.MapClaims)
+			got["id_token_aud"] = claims["aud"]
+			got["id_token_iss"] = claims["iss"]
+			got["id_token_nonce"] = claims["nonce"]
+			got["id_token_email"] = claims["email"]
+
+			// The ID token is not an access token.
+			req, _ := http.NewRequest(http.MethodGet, ts.URL+"/auth/whoami", nil)
+			req.Header.Set("Authorization", "Bearer "+tokenResp["id_token"].(string))
+			if _, err := portal.validator.Authorize(context.Background(), req, requests.NewAuthorizationRequest()); err == nil {
+				t.Fatalf("id token accepted as access token")
+			}
+
+			req, _ = http.NewRequest(http.MethodGet, ts.URL+"/auth/oidc/userinfo", nil)
+			req.Header.Set("Authorization", "Bearer "+tokenResp["access_token"].(string))
+			resp, err = anonymousClient.Do(req)
+			if err != nil {
+				t.Fatalf("failed userinfo request: %v", err)
+			}
+			userInfo := make(map[string]interface{})
+			json.NewDecoder(resp.Body).Decode(&userInfo)
+			resp.Body.Close()
+			if userInfo["sub"] != claims["sub"] {
+				t.Fatalf("userinfo subject mismatch: %v, %v", userInfo["sub"], claims["sub"])
+			}
+			got["userinfo"] = map[string]interface{}{"email": userInfo["email"]}
+
+			if tc.redeemTwice {
+				_, tokenResp = redeem()
+				got["second_redeem"] = tokenResp["error"]
+			}
+			tests.EvalObjectsWithLog(t, "flow", tc.want, got, msgs)
+		})
+	}
+}
+
+func TestOpenIDConnectSharedStore(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+	p1 := newTestOpenIDConnectPortal(t)
+	p1.SetCacheStore(store)
+	p2 := newTestOpenIDConnectPortal(t)
+	p2.SetCacheStore(store)
+
+	usr, err := user.NewUser(map[string]interface{}{
+		"sub":   tests.TestUser1,
+		"email": tests.TestEmail1,
+		"jti":   "a1b2c3",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := p1.openID.getClient("webapp", testOpenIDConnectRedirectURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("redirect_uri", testOpenIDConnectRedirectURL)
+	q.Set("scope", "openid email")
+	q.Set("nonce", "n-0S6_WzA2Mj")
+	req, err := p1.openID.newAuthorizationRequest(client, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]interface{})
+	got["consent_required"] = p2.openID.isConsentRequired(req, usr)
+	consentID, err := p1.openID.saveAuthorizationRequest(req, usr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err = p2.openID.loadAuthorizationRequest(consentID, usr)
+	if err != nil {
+		t.Fatalf("failed loading authorization request: %v", err)
+	}
+	_, err = p1.openID.loadAuthorizationRequest(consentID, usr)
+	got["second_load"] = err != nil
+	if err := p2.openID.addConsent(req, usr); err != nil {
+		t.Fatal(err)
+	}
+	got["consented"] = !p1.openID.isConsentRequired(req, usr)
+
+	code, err := p2.openID.issueCode(req, usr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	grant, accessToken, err := p1.openID.redeemCode(p1.openID.clients["webapp"], code, testOpenIDConnectRedirectURL, "")
+	if err != nil {
+		t.Fatalf("failed redeeming code: %v", err)
+	}
+	_, _, err = p2.openID.redeemCode(p2.openID.clients["webapp"], code, testOpenIDConnectRedirectURL, "")
+	got["second_redeem"] = getOAuthErrorCode(err)
+	got["nonce"] = grant.request.nonce
+	tokenGrant, err := p2.openID.getAccessTokenGrant(accessToken)
+	if err != nil {
+		t.Fatalf("failed getting access token grant: %v", err)
+	}
+	got["claims"] = p2.openID.getClaims(tokenGrant)
+	got["jti"] = tokenGrant.user.Claims.ID
+
+	want := map[string]interface{}{
+		"consent_required": true,
+		"second_load":      true,
+		"consented":        true,
+		"second_redeem":    "invalid_grant",
+		"nonce":            "n-0S6_WzA2Mj",
+		"claims": map[string]interface{}{
+			"sub":   tests.TestUser1,
+			"email": tests.TestEmail1,
+		},
+		"jti": "a1b2c3",
+	}
+	tests.EvalObjectsWithLog(t, "shared store", want, got, []string{})
+}
@@ -31,7 +31,9 @@ import (
 	"github.com/greenpau/go-authcrunch/pkg/idp"
 	"github.com/greenpau/go-authcrunch/pkg/ids"
 	"github.com/greenpau/go-authcrunch/pkg/kms"
+	"github.com/greenpau/go-authcrunch/pkg/kvstore"
 	"github.com/greenpau/go-authcrunch/pkg/registry"
+	"github.com/greenpau/go-authcrunch/pkg/revocation"
 	"github.com/greenpau/go-authcrunch/pkg/sso"
 	cfgutil "github.com/greenpau/go-authcrunch/pkg/util/cfg"
 
@@ -64,6 +66,13 @@ type Portal struct {
 	startedAt         time.Time
 	sessions          *cache.SessionCache
 	sandboxes         *cache.SandboxCache
+	recovery          *recoveryTokenManager
+	recoveryQueue     *recoveryQueue
+	revocationList    *revocation.List
+	refreshTokens     *refreshTokenManager
+	upstreamSessions  *upstreamSessionStore
+	samlSessions      *samlSessionStore
+	openID            *openIDProvider
 	loginOptions      map[string]interface{}
 	logger            *zap.Logger
 }
@@ -173,6 +182,25 @@ func (p *Portal) GetName() string {
 	return p.config.Name
 }
 
+// SetCacheStore sets the key/value store holding the session, sandbox,
+// refresh token, SAML session and OpenID Connect entries, e.g. a store
+// shared by several instances of the portal.
+func (p *Portal) SetCacheStore(store kvstore.Store) {
+	store = kvstore.WithPrefix(store, "authn/"+p.config.Name+"/")
+	p.sessions.SetStore(store)
+	p.sandboxes.SetStore(store)
+	if p.refreshTokens != nil {
+		p.refreshTokens.SetStore(store)
+		p.upstreamSessions.SetStore(store)
+	}
+	if p.samlSessions != nil {
+		p.samlSessions.SetStore(store)
+	}
+	if p.openID != nil {
+		p.openID.SetStore(store)
+	}
+}
+
 func (p *Portal) configure() error {
 	if err := p.configureEssentials(); err != nil {
 		return err
@@ -180,6 +208,16 @@ func (p *Portal) configure() error {
 	if err := p.configureCryptoKeyStore(); err != nil {
 		return err
 	}
+	if err := p.configureRecovery(); err != nil {
+		return err
+	}
+	if err := p.configureTokenRefresh(); err != nil {
+		return err
+	}
+	p.configureSingleLogout()
+	if err := p.configureOpenIDConnect(); err != nil {
+		return err
+	}
 	if err := p.configureLoginOptions(); err != nil {
 		return err
 	}
@@ -240,6 +278,87 @@ func (p *Portal) configureEssentials() error {
 	return nil
 }
 
+func (p *Portal) configureRecovery() error {
+	if p.config.Recovery == nil {
+		return nil
+	}
+
+	p.logger.Debug(
+		"Configuring password and username recovery",
+		zap.String("portal_name", p.config.Name),
+		zap.String("portal_id", p.id),
+		zap.String("email_provider", p.config.Recovery.EmailProvider),
+		zap.Int("token_lifetime", p.config.Recovery.TokenLifetime),
+	)
+
+	m, err := newRecoveryTokenManager(p.config.Recovery)
+	if err != nil {
+		return err
+	}
+	p.recovery = m
+	p.recoveryQueue = newRecoveryQueue(recoveryQueueSize, recoveryQueueWorkers, p.processRecovery)
+	return nil
+}
+
+func (p *Portal) configureTokenRefresh() error {
+	if p.config.TokenRefresh == nil {
+		return nil
+	}
+
+	p.logger.Debug(
+		"Configuring token refresh",
+		zap.String("portal_name", p.config.Name),
+		zap.String("portal_id", p.id),
+		zap.Int("token_lifetime", p.config.TokenRefresh.TokenLifetime),
+		zap.Bool("sliding_renewal_enabled", p.config.TokenRefresh.SlidingRenewalEnabled),
+		zap.Int("renewal_window", p.config.TokenRefresh.RenewalWindow),
+	)
+
+	// The renewal window shorter than the lifetime of access tokens
+	// prevents the renewal on every request.
+	if p.config.TokenRefresh.SlidingRenewalEnabled && p.config.TokenRefresh.RenewalWindow >= p.keystore.GetTokenLifetime(nil, nil) {
+		return errors.ErrTokenRefreshConfigRenewalWindow.WithArgs(p.config.Name, p.config.TokenRefresh.RenewalWindow)
+	}
+
+	p.refreshTokens = newRefreshTokenManager(p.config.TokenRefresh)
+	p.upstreamSessions = newUpstreamSessionStore(p.refreshTokens.lifetime)
+	return nil
+}
+
+// configureSingleLogout sets up the store of the sessions with SAML identity
+// providers. The sessions last as long as the tokens issued by the portal.
+func (p *Portal) configureSingleLogout() {
+	lifetime := time.Duration(p.keystore.GetTokenLifetime(nil, nil)) * time.Second
+	if p.refreshTokens != nil && p.refreshTokens.lifetime > lifetime {
+		lifetime = p.refreshTokens.lifetime
+	}
+	p.samlSessions = newSamlSessionStore(lifetime)
+}
+
+func (p *Portal) configureOpenIDConnect() error {
+	if p.config.OpenIDConnect == nil {
+		return nil
+	}
+	if !p.keystore.HasAsymmetricSignKey(kms.IDTokenName) {
+		return errors.ErrOpenIDConnectConfigSignKeyNotFound.WithArgs(p.config.Name, kms.IDTokenName)
+	}
+
+	var clientIDs []string
+	for _, client := range p.config.OpenIDConnect.Clients {
+		clientIDs = append(clientIDs, client.ClientID)
+	}
+	p.logger.Debug(
+		"Configuring OpenID Connect provider",
+		zap.String("portal_name", p.config.Name),
+		zap.String("portal_id", p.id),
+		zap.Strings("client_ids", clientIDs),
+		zap.Int("token_lifetime", p.config.OpenIDConnect.TokenLifetime),
+	)
+
+	p.openID = newOpenIDProvider(p.config.OpenIDConnect)
+	return nil
+}
+
 func (p *Portal) configureCryptoKeyStore() error {
 	if len(p.config.AccessListConfigs) == 0 {
 		defaultACLConfig := []*acl.RuleConfiguration{}
@@ -337,6 +456,13 @@ func (p *Portal) configureCryptoKeyStore() error {
 		if err := p.keystore.AutoGenerate("default", "ES512"); err != nil {
 			return errors.ErrCryptoKeyStoreConfig.WithArgs(p.config.Name, err)
 		}
+		// The ID tokens are signed with a separate key, so that they are
+		// not accepted as access tokens.
+		if p.config.OpenIDConnect != nil {
+			if err := p.keystore.GenerateKey(kms.IDTokenName, "ES512"); err != nil {
+				return errors.ErrCryptoKeyStoreConfig.WithArgs(p.config.Name, err)
+			}
+		}
 	} else {
 		if err := p.keystore.AddKeysWithConfigs(p.config.CryptoKeyConfigs); err != nil {
 			return errors.ErrCryptoKeyStoreConfig.WithArgs(p.config.Name, err)
@@ -352,6 +478,21 @@ func (p *Portal) configureCryptoKeyStore() error {
 		return errors.ErrCryptoKeyStoreConfig.WithArgs(p.config.Name, err)
 	}
 
+	// Keep the validator keys in sync with the rotated keys.
+	p.keystore.SetKeyRotationHandler(func(keys []*kms.CryptoKey) {
+		if err := p.validator.UpdateKeys(ctx, keys); err != nil {
+			p.logger.Warn(
+				"failed updating validator keys",
+				zap.String("portal_name", p.config.Name),
+				zap.String("portal_id", p.id),
+				zap.Error(err),
+			)
+		}
+	})
+	if err := p.keystore.StartKeyRotation(); err != nil {
+		return errors.ErrCryptoKeyStoreConfig.WithArgs(p.config.Name, err)
+	}
+
 	p.logger.Debug(
 		"Configured validator ACL",
 		zap.String("portal_name", p.config.Name),
@@ -425,6 +566,7 @@ func (p *Portal) configureLoginIcons() error {
 	if len(iconConfigs) == 1 {
 		p.loginOptions["hide_contact_support_link"] = "yes"
 		p.loginOptions["hide_forgot_username_link"] = "yes"
+		p.loginOptions["hide_forgot_password_link"] = "yes"
 		p.loginOptions["hide_register_link"] = "yes"
 		p.loginOptions["hide_links"] = "yes"
 		for _, iconConfig := range iconConfigs {
@@ -440,6 +582,10 @@ func (p *Portal) configureLoginIcons() error {
 				p.loginOptions["hide_forgot_username_link"] = "no"
 				p.loginOptions["hide_links"] = "no"
 			}
+			if v, exists := iconConfig["password_recovery_enabled"]; exists && v == "yes" {
+				p.loginOptions["hide_forgot_password_link"] = "no"
+				p.loginOptions["hide_links"] = "no"
+			}
 		}
 	}
 
@@ -493,10 +639,14 @@ func (p *Portal) configureIdentityStoreLogin() error {
 		switch store.GetKind() {
 		case "local":
 			icon.RegistrationEnabled = false
-			icon.UsernameRecoveryEnabled = false
+			if p.config.Recovery == nil {
+				icon.UsernameRecoveryEnabled = false
+				icon.PasswordRecoveryEnabled = false
+			}
 		case "ldap":
 			icon.RegistrationEnabled = false
 			icon.UsernameRecoveryEnabled = false
+			icon.PasswordRecoveryEnabled = false
 		}
 	}
 
@@ -105,6 +105,34 @@ func TestNewPortal(t *testing.T) {
 			shouldErr: true,
 			err:       errors.ErrNewPortal.WithArgs(errors.ErrPortalConfigBackendsNotFound),
 		},
+		{
+			name: "test new portal with invalid base url",
+			loggerFunc: func() *zap.Logger {
+				return logutil.NewLogger()
+			},
+			configFunc: func() *PortalConfig {
+				return &PortalConfig{
+					Name:    "myportal",
+					BaseURL: "auth.example.com",
+				}
+			},
+			shouldErr: true,
+			err:       errors.ErrNewPortal.WithArgs(errors.ErrPortalConfigBaseURLInvalid.WithArgs("myportal", "auth.example.com")),
+		},
+		{
+			name: "test new portal with recovery and without base url",
+			loggerFunc: func() *zap.Logger {
+				return logutil.NewLogger()
+			},
+			configFunc: func() *PortalConfig {
+				return &PortalConfig{
+					Name:     "myportal",
+					Recovery: &RecoveryConfig{EmailProvider: "local_email_provider"},
+				}
+			},
+			shouldErr: true,
+			err:       errors.ErrNewPortal.WithArgs(errors.ErrRecoveryConfigBaseURLEmpty.WithArgs("myportal")),
+		},
 		{
 			name: "test new portal backed by local database",
 			loggerFunc: func() *zap.Logger {
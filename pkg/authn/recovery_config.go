@@ -0,0 +1,92 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authn
+
+import (
+	"github.com/greenpau/go-authcrunch/pkg/credentials"
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/messaging"
+)
+
+const defaultRecoveryTokenLifetime int = 900
+
+// RecoveryConfig holds the configuration for the self-service recovery of
+// passwords and usernames. The recovery is available for the identity
+// stores having password_recovery_enabled or username_recovery_enabled.
+type RecoveryConfig struct {
+	// The email provider used for the delivery of recovery messages.
+	EmailProvider string `json:"email_provider,omitempty" xml:"email_provider,omitempty" yaml:"email_provider,omitempty"`
+	// The lifetime (in seconds) of password reset tokens. The default is
+	// 15 minutes.
+	TokenLifetime int `json:"token_lifetime,omitempty" xml:"token_lifetime,omitempty" yaml:"token_lifetime,omitempty"`
+	// The secret for signing password reset tokens. When empty, a random
+	// secret is generated at startup, i.e. the tokens issued prior to a
+	// restart become invalid.
+	TokenSecret string `json:"token_secret,omitempty" xml:"token_secret,omitempty" yaml:"token_secret,omitempty"`
+
+	credentials *credentials.Config
+	messaging   *messaging.Config
+}
+
+// Validate validates recovery configuration.
+func (cfg *RecoveryConfig) Validate(portalName string) error {
+	if cfg.EmailProvider == "" {
+		return errors.ErrRecoveryConfigEmailProviderEmpty.WithArgs(portalName)
+	}
+	if cfg.TokenLifetime == 0 {
+		cfg.TokenLifetime = defaultRecoveryTokenLifetime
+	}
+	if cfg.TokenLifetime < 60 {
+		return errors.ErrRecoveryConfigTokenLifetime.WithArgs(portalName, cfg.TokenLifetime)
+	}
+	return nil
+}
+
+// SetCredentials binds to shared credentials.
+func (cfg *RecoveryConfig) SetCredentials(c *credentials.Config) {
+	cfg.credentials = c
+}
+
+// SetMessaging binds to messaging config.
+func (cfg *RecoveryConfig) SetMessaging(c *messaging.Config) {
+	cfg.messaging = c
+}
+
+// ValidateMessaging validates messaging provider and credentials used for
+// the recovery.
+func (cfg *RecoveryConfig) ValidateMessaging(portalName string) error {
+	if cfg.messaging == nil {
+		return errors.ErrRecoveryConfigMessagingNil.WithArgs(portalName)
+	}
+	if found := cfg.messaging.FindProvider(cfg.EmailProvider); !found {
+		return errors.ErrRecoveryConfigMessagingProviderNotFound.WithArgs(portalName, cfg.EmailProvider)
+	}
+
+	if cfg.messaging.GetProviderType(cfg.EmailProvider) == "email" {
+		providerCreds := cfg.messaging.FindProviderCredentials(cfg.EmailProvider)
+		if providerCreds == "" {
+			return errors.ErrRecoveryConfigMessagingProviderCredentialsNotFound.WithArgs(portalName, cfg.EmailProvider)
+		}
+		if providerCreds != "passwordless" {
+			if cfg.credentials == nil {
+				return errors.ErrRecoveryConfigCredentialsNil.WithArgs(portalName)
+			}
+			if found := cfg.credentials.FindCredential(providerCreds); !found {
+				return errors.ErrRecoveryConfigCredentialsNotFound.WithArgs(portalName, providerCreds)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authn
+
+import (
+	"bytes"
+	"mime/quotedprintable"
+	"strings"
+	"text/template"
+
+	"github.com/greenpau/go-authcrunch/pkg/credentials"
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/messaging"
+)
+
+// notifyRecovery sends password and username recovery notifications.
+func (p *Portal) notifyRecovery(data map[string]string) error {
+	var requiredFields []string
+
+	commonRequiredFields := []string{
+		"session_id", "request_id", "timestamp",
+		"template", "username", "email", "src_ip",
+	}
+
+	if data == nil {
+		return errors.ErrNotifyRequestDataNil
+	}
+
+	for _, fieldName := range commonRequiredFields {
+		if _, exists := data[fieldName]; !exists {
+			return errors.ErrNotifyRequestFieldNotFound.WithArgs(fieldName)
+		}
+	}
+
+	tmplName := data["template"]
+	switch tmplName {
+	case "password_recovery":
+		requiredFields = []string{"recovery_url", "recovery_lifetime"}
+	case "username_recovery":
+	default:
+		return errors.ErrNotifyRequestTemplateUnsupported.WithArgs(tmplName)
+	}
+
+	for _, fieldName := range requiredFields {
+		if _, exists := data[fieldName]; !exists {
+			return errors.ErrNotifyRequestFieldNotFound.WithArgs(fieldName)
+		}
+	}
+
+	rcpts := []string{data["email"]}
+
+	lang := "en"
+	if v, exists := data["lang"]; exists {
+		lang = v
+	} else {
+		data["lang"] = lang
+	}
+
+	switch lang {
+	case "en":
+	default:
+		return errors.ErrNotifyRequestLangUnsupported.WithArgs(lang)
+	}
+
+	cfg := p.config.Recovery
+	if cfg.messaging == nil {
+		return errors.ErrNotifyRequestMessagingNil.WithArgs(cfg.EmailProvider)
+	}
+
+	tmplSubj, tmplSubjErr := template.New("email_subj").Parse(messaging.EmailTemplateSubject[lang+"/"+tmplName])
+	if tmplSubjErr != nil {
+		return errors.ErrNotifyRequestEmail.WithArgs(cfg.EmailProvider, tmplSubjErr)
+	}
+	emailSubj := bytes.NewBuffer(nil)
+	if err := tmplSubj.Execute(emailSubj, data); err != nil {
+		return errors.ErrNotifyRequestEmail.WithArgs(cfg.EmailProvider, err)
+	}
+
+	tmplBody, tmplBodyErr := template.New("email_body").Parse(messaging.EmailTemplateBody[lang+"/"+tmplName])
+	if tmplBodyErr != nil {
+		return errors.ErrNotifyRequestEmail.WithArgs(cfg.EmailProvider, tmplBodyErr)
+	}
+	emailBody := bytes.NewBuffer(nil)
+	if err := tmplBody.Execute(emailBody, data); err != nil {
+		return errors.ErrNotifyRequestEmail.WithArgs(cfg.EmailProvider, err)
+	}
+
+	var qpEmailBody string
+	qpEmailBody, err := quotedPrintableBody(emailBody.String())
+	if err != nil {
+		return errors.ErrNotifyRequestEmail.WithArgs(cfg.EmailProvider, err)
+	}
+
+	qpEmailSubj := emailSubj.String()
+	repl := strings.NewReplacer("\r", "", "\n", " ")
+	qpEmailSubj = strings.TrimSpace(repl.Replace(qpEmailSubj))
+
+	providerType := cfg.messaging.GetProviderType(cfg.EmailProvider)
+
+	switch providerType {
+	case "email":
+		provider := cfg.messaging.ExtractEmailProvider(cfg.EmailProvider)
+		if provider == nil {
+			return errors.ErrNotifyRequestEmailProviderNotFound.WithArgs(cfg.EmailProvider)
+		}
+
+		providerCredName := cfg.messaging.FindProviderCredentials(cfg.EmailProvider)
+		if providerCredName == "" {
+			return errors.ErrNotifyRequestEmailProviderCredNotFound.WithArgs(cfg.EmailProvider)
+		}
+
+		var providerCred *credentials.Generic
+		if providerCredName != "passwordless" {
+			if cfg.credentials == nil {
+				return errors.ErrNotifyRequestCredNil.WithArgs(cfg.EmailProvider)
+			}
+			providerCred = cfg.credentials.ExtractGeneric(providerCredName)
+			if providerCred == nil {
+				return errors.ErrNotifyRequestCredNotFound.WithArgs(cfg.EmailProvider, providerCredName)
+			}
+		}
+
+		if err := provider.Send(&messaging.EmailProviderSendInput{
+			Subject:     qpEmailSubj,
+			Body:        qpEmailBody,
+			Recipients:  rcpts,
+			Credentials: providerCred,
+		}); err != nil {
+			return errors.ErrNotifyRequestEmail.WithArgs(cfg.EmailProvider, err)
+		}
+	case "file":
+		provider := cfg.messaging.ExtractFileProvider(cfg.EmailProvider)
+		if provider == nil {
+			return errors.ErrNotifyRequestEmailProviderNotFound.WithArgs(cfg.EmailProvider)
+		}
+		if err := provider.Send(&messaging.FileProviderSendInput{
+			Subject:    qpEmailSubj,
+			Body:       qpEmailBody,
+			Recipients: rcpts,
+		}); err != nil {
+			return errors.ErrNotifyRequestEmail.WithArgs(cfg.EmailProvider, err)
+		}
+	default:
+		return errors.ErrNotifyRequestProviderTypeUnsupported.WithArgs(cfg.EmailProvider, providerType)
+	}
+	return nil
+}
+
+func quotedPrintableBody(s string) (string, error) {
+	var b bytes.Buffer
+	w := quotedprintable.NewWriter(&b)
+	if _, err := w.Write([]byte(s)); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authn
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+)
+
+const (
+	recoveryQueueSize    = 64
+	recoveryQueueWorkers = 4
+	// recoveryRequestInterval is the time window of the recovery request
+	// limits. An email address receives one message per window, and a
+	// source address makes recoveryRequestsPerAddress requests per window.
+	recoveryRequestInterval    = time.Minute
+	recoveryRequestsPerAddress = 10
+)
+
+// recoveryQueue processes recovery requests in the background with a fixed
+// number of workers. The requests exceeding the limits or arriving while
+// the queue is full are dropped, so that neither the mailboxes of the users
+// nor the portal are flooded.
+type recoveryQueue struct {
+	mu       sync.Mutex
+	requests chan *recoveryRequest
+	counters map[string]*recoveryCounter
+}
+
+// recoveryCounter counts the recovery requests in a time window.
+type recoveryCounter struct {
+	start time.Time
+	count int
+}
+
+func newRecoveryQueue(size, workers int, process func(*recoveryRequest)) *recoveryQueue {
+	q := &recoveryQueue{
+		requests: make(chan *recoveryRequest, size),
+		counters: make(map[string]*recoveryCounter),
+	}
+	for i := 0; i < workers; i++ {
+		go func() {
+			for req := range q.requests {
+				process(req)
+			}
+		}()
+	}
+	return q
+}
+
+// enqueue adds the request to the queue. It fails when the request exceeds
+// the limits of its email or source address, or when the queue is full.
+func (q *recoveryQueue) enqueue(req *recoveryRequest) error {
+	now := time.Now()
+	emailKey := "email/" + req.kind + "/" + strings.ToLower(req.email)
+	addrKey := "addr/" + req.srcIP
+
+	q.mu.Lock()
+	q.prune(now)
+	if q.exceeds(emailKey, 1) || q.exceeds(addrKey, recoveryRequestsPerAddress) {
+		q.mu.Unlock()
+		return errors.ErrRecoveryRequestThrottled
+	}
+	q.count(emailKey, now)
+	q.count(addrKey, now)
+	q.mu.Unlock()
+
+	select {
+	case q.requests <- req:
+		return nil
+	default:
+		return errors.ErrRecoveryQueueFull
+	}
+}
+
+func (q *recoveryQueue) exceeds(key string, limit int) bool {
+	counter, exists := q.counters[key]
+	return exists && counter.count >= limit
+}
+
+func (q *recoveryQueue) count(key string, now time.Time) {
+	counter, exists := q.counters[key]
+	if !exists {
+		counter = &recoveryCounter{start: now}
+		q.counters[key] = counter
+	}
+	counter.count++
+}
+
+// prune removes the counters of the past time windows.
+func (q *recoveryQueue) prune(now time.Time) {
+	for key, counter := range q.counters {
+		if now.Sub(counter.start) >= recoveryRequestInterval {
+			delete(q.counters, key)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authn
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/greenpau/go-authcrunch/internal/tests"
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+)
+
+func TestRecoveryQueue(t *testing.T) {
+	// The worker blocks until released, so that the queue fills up.
+	started := make(chan *recoveryRequest)
+	release := make(chan struct{})
+	q := newRecoveryQueue(2, 1, func(req *recoveryRequest) {
+		started <- req
+		<-release
+	})
+	defer close(release)
+
+	newRequest := func(email, srcIP string) *recoveryRequest {
+		return &recoveryRequest{kind: "password", realm: "local", email: email, srcIP: srcIP}
+	}
+
+	testcases := []struct {
+		name      string
+		req       *recoveryRequest
+		wait      bool
+		shouldErr bool
+		err       error
+	}{
+		{
+			name: "test first request",
+			req:  newRequest("jsmith@localhost.localdomain", "10.0.0.1"),
+			wait: true,
+		},
+		{
+			name:      "test repeated request for the same email address",
+			req:       newRequest("JSmith@localhost.localdomain", "10.0.0.2"),
+			shouldErr: true,
+			err:       errors.ErrRecoveryRequestThrottled,
+		},
+		{
+			name: "test request queued behind the busy worker",
+			req:  newRequest("user1@localhost.localdomain", "10.0.0.1"),
+		},
+		{
+			name: "test request filling the queue",
+			req:  newRequest("user2@localhost.localdomain", "10.0.0.1"),
+		},
+		{
+			name:      "test request exceeding the queue size",
+			req:       newRequest("user3@localhost.localdomain", "10.0.0.1"),
+			shouldErr: true,
+			err:       errors.ErrRecoveryQueueFull,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			err := q.enqueue(tc.req)
+			if tests.EvalErrWithLog(t, err, "enqueue", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			if tc.wait {
+				tests.EvalObjectsWithLog(t, "processed", tc.req.email, (<-started).email, msgs)
+			}
+		})
+	}
+}
+
+func TestRecoveryQueueAddressLimit(t *testing.T) {
+	q := newRecoveryQueue(recoveryRequestsPerAddress+1, 0, nil)
+	for i := 0; i < recoveryRequestsPerAddress; i++ {
+		req := &recoveryRequest{kind: "password", email: fmt.Sprintf("user%d@localhost.localdomain", i), srcIP: "10.0.0.1"}
+		if err := q.enqueue(req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	req := &recoveryRequest{kind: "password", email: "jsmith@localhost.localdomain", srcIP: "10.0.0.1"}
+	err := q.enqueue(req)
+	tests.EvalErrWithLog(t, err, "enqueue", true, errors.ErrRecoveryRequestThrottled, []string{})
+}
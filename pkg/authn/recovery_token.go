@@ -0,0 +1,158 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authn
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+)
+
+const recoveryTokenType = "password_reset"
+
+// recoveryClaims are the claims of a password reset token.
+type recoveryClaims struct {
+	ID        string `json:"jti"`
+	Type      string `json:"typ"`
+	Realm     string `json:"realm"`
+	Username  string `json:"sub"`
+	Email     string `json:"email"`
+	ExpiresAt int64  `json:"exp"`
+	// Fingerprint is the password fingerprint of the user at the time of
+	// issuance. The token becomes invalid once the password changes.
+	Fingerprint string `json:"pwd"`
+}
+
+// recoveryTokenManager issues and redeems signed single-use password reset
+// tokens. A token is the base64url encoded JSON claims followed by a dot
+// and the base64url encoded HMAC-SHA256 signature of the claims.
+type recoveryTokenManager struct {
+	mu       sync.Mutex
+	secret   []byte
+	lifetime time.Duration
+	// The identifiers of the redeemed tokens mapped to their expiry.
+	used map[string]time.Time
+}
+
+func newRecoveryTokenManager(cfg *RecoveryConfig) (*recoveryTokenManager, error) {
+	m := &recoveryTokenManager{
+		secret:   []byte(cfg.TokenSecret),
+		lifetime: time.Duration(cfg.TokenLifetime) * time.Second,
+		used:     make(map[string]time.Time),
+	}
+	if m.lifetime == 0 {
+		m.lifetime = time.Duration(defaultRecoveryTokenLifetime) * time.Second
+	}
+	if len(m.secret) == 0 {
+		m.secret = make([]byte, 32)
+		if _, err := rand.Read(m.secret); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// issue returns a signed token for the user. The token is bound to the
+// password fingerprint of the user.
+func (m *recoveryTokenManager) issue(realm, username, email, fingerprint string) (string, error) {
+	claims := &recoveryClaims{
+		ID:          uuid.New().String(),
+		Type:        recoveryTokenType,
+		Realm:       realm,
+		Username:    username,
+		Email:       email,
+		ExpiresAt:   time.Now().Add(m.lifetime).Unix(),
+		Fingerprint: fingerprint,
+	}
+	b, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(b)
+	return payload + "." + m.sign(payload), nil
+}
+
+// parse verifies the signature and the expiry of the token and returns its
+// claims. It does not redeem the token.
+func (m *recoveryTokenManager) parse(s string) (*recoveryClaims, error) {
+	arr := strings.Split(s, ".")
+	if len(arr) != 2 {
+		return nil, errors.ErrRecoveryTokenMalformed
+	}
+	if subtle.ConstantTimeCompare([]byte(m.sign(arr[0])), []byte(arr[1])) != 1 {
+		return nil, errors.ErrRecoveryTokenSignature
+	}
+	b, err := base64.RawURLEncoding.DecodeString(arr[0])
+	if err != nil {
+		return nil, errors.ErrRecoveryTokenMalformed
+	}
+	claims := &recoveryClaims{}
+	if err := json.Unmarshal(b, claims); err != nil {
+		return nil, errors.ErrRecoveryTokenMalformed
+	}
+	if claims.Type != recoveryTokenType || claims.ID == "" || claims.Username == "" || claims.Fingerprint == "" {
+		return nil, errors.ErrRecoveryTokenMalformed
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, errors.ErrRecoveryTokenExpired
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.used[claims.ID]; exists {
+		return nil, errors.ErrRecoveryTokenUsed
+	}
+	return claims, nil
+}
+
+// redeem marks the token as used. It fails when the token has already been
+// used.
+func (m *recoveryTokenManager) redeem(claims *recoveryClaims) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for k, exp := range m.used {
+		if now.After(exp) {
+			delete(m.used, k)
+		}
+	}
+	if _, exists := m.used[claims.ID]; exists {
+		return errors.ErrRecoveryTokenUsed
+	}
+	m.used[claims.ID] = time.Unix(claims.ExpiresAt, 0)
+	return nil
+}
+
+// release reverts the redemption of the token, e.g. when the password reset
+// fails and the user should be able to retry.
+func (m *recoveryTokenManager) release(claims *recoveryClaims) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.used, claims.ID)
+}
+
+func (m *recoveryTokenManager) sign(s string) string {
+	h := hmac.New(sha256.New, m.secret)
+	h.Write([]byte(s))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,148 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authn
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/greenpau/go-authcrunch/internal/tests"
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+)
+
+func TestRecoveryToken(t *testing.T) {
+	testcases := []struct {
+		name      string
+		config    *RecoveryConfig
+		tamper    func(string) string
+		redeem    int
+		want      map[string]interface{}
+		shouldErr bool
+		err       error
+	}{
+		{
+			name:   "test valid token",
+			config: &RecoveryConfig{TokenSecret: "foobar"},
+			want: map[string]interface{}{
+				"realm":       "local",
+				"username":    "jsmith",
+				"email":       "jsmith@localhost.localdomain",
+				"fingerprint": "foobar",
+			},
+		},
+		{
+			name:   "test token with random secret",
+			config: &RecoveryConfig{},
+			want: map[string]interface{}{
+				"realm":       "local",
+				"username":    "jsmith",
+				"email":       "jsmith@localhost.localdomain",
+				"fingerprint": "foobar",
+			},
+		},
+		{
+			name:   "test tampered token payload",
+			config: &RecoveryConfig{TokenSecret: "foobar"},
+			tamper: func(s string) string {
+				return "x" + s
+			},
+			shouldErr: true,
+			err:       errors.ErrRecoveryTokenSignature,
+		},
+		{
+			name:   "test malformed token",
+			config: &RecoveryConfig{TokenSecret: "foobar"},
+			tamper: func(s string) string {
+				return strings.Replace(s, ".", "", 1)
+			},
+			shouldErr: true,
+			err:       errors.ErrRecoveryTokenMalformed,
+		},
+		{
+			name:      "test expired token",
+			config:    &RecoveryConfig{TokenSecret: "foobar", TokenLifetime: -1},
+			shouldErr: true,
+			err:       errors.ErrRecoveryTokenExpired,
+		},
+		{
+			name:      "test used token",
+			config:    &RecoveryConfig{TokenSecret: "foobar"},
+			redeem:    1,
+			shouldErr: true,
+			err:       errors.ErrRecoveryTokenUsed,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			m, err := newRecoveryTokenManager(tc.config)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			token, err := m.issue("local", "jsmith", "jsmith@localhost.localdomain", "foobar")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tc.tamper != nil {
+				token = tc.tamper(token)
+			}
+			for i := 0; i < tc.redeem; i++ {
+				claims, err := m.parse(token)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if err := m.redeem(claims); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			claims, err := m.parse(token)
+			if tests.EvalErrWithLog(t, err, "parse", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			got := make(map[string]interface{})
+			got["realm"] = claims.Realm
+			got["username"] = claims.Username
+			got["email"] = claims.Email
+			got["fingerprint"] = claims.Fingerprint
+			tests.EvalObjectsWithLog(t, "claims", tc.want, got, msgs)
+		})
+	}
+}
+
+func TestRecoveryTokenRelease(t *testing.T) {
+	m, err := newRecoveryTokenManager(&RecoveryConfig{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	token, err := m.issue("local", "jsmith", "jsmith@localhost.localdomain", "foobar")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	claims, err := m.parse(token)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := m.redeem(claims); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := m.redeem(claims); err == nil {
+		t.Fatalf("expected error on second redemption")
+	}
+	m.release(claims)
+	if _, err := m.parse(token); err != nil {
+		t.Fatalf("expected released token to be valid: %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authn
+
+import (
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+)
+
+const (
+	defaultRefreshTokenLifetime int = 604800
+	minRefreshTokenLifetime     int = 300
+	defaultRenewalWindow        int = 300
+)
+
+// TokenRefreshConfig holds the configuration for the renewal of access
+// tokens without an interactive login.
+type TokenRefreshConfig struct {
+	// The lifetime (in seconds) of refresh tokens. The lifetime is counted
+	// from the login, i.e. the rotation of a refresh token does not extend
+	// it. The default is 7 days.
+	TokenLifetime int `json:"token_lifetime,omitempty" xml:"token_lifetime,omitempty" yaml:"token_lifetime,omitempty"`
+	// When enabled, the access tokens in browser cookies are reissued when
+	// the portal receives them shortly before their expiry.
+	SlidingRenewalEnabled bool `json:"sliding_renewal_enabled,omitempty" xml:"sliding_renewal_enabled,omitempty" yaml:"sliding_renewal_enabled,omitempty"`
+	// The time (in seconds) prior to the expiry of an access token when
+	// the sliding renewal reissues the token. The default is 5 minutes.
+	RenewalWindow int `json:"renewal_window,omitempty" xml:"renewal_window,omitempty" yaml:"renewal_window,omitempty"`
+}
+
+// Validate validates token refresh configuration.
+func (cfg *TokenRefreshConfig) Validate(portalName string) error {
+	if cfg.TokenLifetime == 0 {
+		cfg.TokenLifetime = defaultRefreshTokenLifetime
+	}
+	if cfg.TokenLifetime < minRefreshTokenLifetime {
+		return errors.ErrTokenRefreshConfigTokenLifetime.WithArgs(portalName, cfg.TokenLifetime)
+	}
+	if cfg.RenewalWindow == 0 {
+		cfg.RenewalWindow = defaultRenewalWindow
+	}
+	if cfg.RenewalWindow < 0 {
+		return errors.ErrTokenRefreshConfigRenewalWindow.WithArgs(portalName, cfg.RenewalWindow)
+	}
+	return nil
+}
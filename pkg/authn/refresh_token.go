@@ -0,0 +1,283 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authn
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/kvstore"
+	"github.com/greenpau/go-authcrunch/pkg/user"
+)
+
+const (
+	refreshFamilyKeyPrefix  = "refresh/family/"
+	refreshSessionKeyPrefix = "refresh/session/"
+	refreshSubjectKeyPrefix = "refresh/subject/"
+	refreshUsedKeyPrefix    = "refresh/used/"
+)
+
+// refreshTokenFamily is the chain of refresh tokens originating from a
+// login. Only the latest token of the family is valid.
+type refreshTokenFamily struct {
+	key string
+	// user holds the claims of the access tokens issued for the family.
+	user      *user.User
+	authTime  time.Time
+	expiresAt time.Time
+	// secretHash is the hash of the secret of the latest token.
+	secretHash [32]byte
+}
+
+// refreshTokenRecord is the serialized form of refreshTokenFamily kept in
+// a key/value store.
+type refreshTokenRecord struct {
+	Claims        map[string]interface{} `json:"claims"`
+	Authenticator user.Authenticator     `json:"authenticator,omitempty"`
+	AuthTime      time.Time              `json:"auth_time"`
+	ExpiresAt     time.Time              `json:"expires_at"`
+	SecretHash    []byte                 `json:"secret_hash"`
+}
+
+// refreshTokenManager issues and rotates opaque refresh tokens. A token is
+// the base64url encoded key of its family followed by a dot and the
+// base64url encoded random secret. Every use of a token yields a new token
+// of the same family. The use of a superseded token indicates that the
+// token has been stolen, and the whole family is revoked. The families are
+// kept in a key/value store, which is in memory unless set with SetStore.
+type refreshTokenManager struct {
+	mu       sync.RWMutex
+	lifetime time.Duration
+	store    kvstore.Store
+}
+
+func newRefreshTokenManager(cfg *TokenRefreshConfig) *refreshTokenManager {
+	m := &refreshTokenManager{
+		lifetime: time.Duration(cfg.TokenLifetime) * time.Second,
+		store:    kvstore.NewMemoryStore(),
+	}
+	if m.lifetime == 0 {
+		m.lifetime = time.Duration(defaultRefreshTokenLifetime) * time.Second
+	}
+	return m
+}
+
+// SetStore sets the key/value store holding the token families.
+func (m *refreshTokenManager) SetStore(store kvstore.Store) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.store = store
+}
+
+func (m *refreshTokenManager) getStore() kvstore.Store {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.store
+}
+
+// issue starts a new family for the user and returns its first token.
+func (m *refreshTokenManager) issue(usr *user.User) (string, error) {
+	key, err := newRefreshTokenPart(16)
+	if err != nil {
+		return "", err
+	}
+	secret, err := newRefreshTokenPart(32)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	family := &refreshTokenFamily{
+		key:        key,
+		user:       usr,
+		authTime:   now,
+		expiresAt:  now.Add(m.lifetime),
+		secretHash: sha256.Sum256([]byte(secret)),
+	}
+
+	store := m.getStore()
+	if err := m.putFamily(store, family); err != nil {
+		return "", err
+	}
+	if id := usr.Claims.ID; id != "" {
+		if prevKey, err := store.Get(refreshSessionKeyPrefix + id); err == nil {
+			store.Delete(refreshFamilyKeyPrefix + string(prevKey))
+		}
+		if err := store.Set(refreshSessionKeyPrefix+id, []byte(key), m.lifetime); err != nil {
+			return "", err
+		}
+	}
+	return key + "." + secret, nil
+}
+
+// rotate redeems the token and returns a copy of its family and the next
+// token of the family. When the token has been superseded, the family is
+// revoked and returned along with the error.
+func (m *refreshTokenManager) rotate(s string) (*refreshTokenFamily, string, error) {
+	arr := strings.Split(s, ".")
+	if len(arr) != 2 || arr[0] == "" || arr[1] == "" {
+		return nil, "", errors.ErrRefreshTokenMalformed
+	}
+	secret, err := newRefreshTokenPart(32)
+	if err != nil {
+		return nil, "", err
+	}
+
+	store := m.getStore()
+	family, err := m.getFamily(store, arr[0])
+	if err != nil {
+		return nil, "", err
+	}
+	now := time.Now()
+	if !now.Before(family.expiresAt) {
+		m.deleteFamily(store, family)
+		return nil, "", errors.ErrRefreshTokenExpired
+	}
+	if m.isSubjectRevoked(store, family) {
+		m.deleteFamily(store, family)
+		return nil, "", errors.ErrRefreshTokenRevoked
+	}
+	hash := sha256.Sum256([]byte(arr[1]))
+	if subtle.ConstantTimeCompare(hash[:], family.secretHash[:]) != 1 {
+		m.deleteFamily(store, family)
+		return family, "", errors.ErrRefreshTokenReused
+	}
+	// The token is redeemed once, even when several processes share the
+	// store and receive the same token at the same time.
+	usedKey := refreshUsedKeyPrefix + family.key + "/" + hex.EncodeToString(hash[:])
+	if err := store.Add(usedKey, []byte{1}, family.expiresAt.Sub(now)); err != nil {
+		if err == errors.ErrKVStoreKeyExists {
+			m.deleteFamily(store, family)
+			return family, "", errors.ErrRefreshTokenReused
+		}
+		return nil, "", err
+	}
+	family.secretHash = sha256.Sum256([]byte(secret))
+	if err := m.putFamily(store, family); err != nil {
+		return nil, "", err
+	}
+	return family, family.key + "." + secret, nil
+}
+
+// revokeSession revokes the family of the access token with the provided
+// id, e.g. on logout.
+func (m *refreshTokenManager) revokeSession(id string) {
+	if id == "" {
+		return
+	}
+	store := m.getStore()
+	if key, err := store.Get(refreshSessionKeyPrefix + id); err == nil {
+		store.Delete(refreshFamilyKeyPrefix + string(key))
+	}
+	store.Delete(refreshSessionKeyPrefix + id)
+}
+
+// revokeSubject revokes the families of the subject started so far, e.g.
+// when the user logs out everywhere or changes password.
+func (m *refreshTokenManager) revokeSubject(subject string) error {
+	if subject == "" {
+		return nil
+	}
+	ts := strconv.FormatInt(time.Now().UnixNano(), 10)
+	return m.getStore().Set(refreshSubjectKeyPrefix+subject, []byte(ts), m.lifetime)
+}
+
+func (m *refreshTokenManager) isSubjectRevoked(store kvstore.Store, family *refreshTokenFamily) bool {
+	if family.user.Claims.Subject == "" {
+		return false
+	}
+	b, err := store.Get(refreshSubjectKeyPrefix + family.user.Claims.Subject)
+	if err != nil {
+		return false
+	}
+	ts, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil {
+		return false
+	}
+	return family.authTime.UnixNano() <= ts
+}
+
+func (m *refreshTokenManager) getFamily(store kvstore.Store, key string) (*refreshTokenFamily, error) {
+	b, err := store.Get(refreshFamilyKeyPrefix + key)
+	if err != nil {
+		if err == errors.ErrKVStoreKeyNotFound {
+			return nil, errors.ErrRefreshTokenInvalid
+		}
+		return nil, err
+	}
+	record := &refreshTokenRecord{}
+	if err := json.Unmarshal(b, record); err != nil || len(record.SecretHash) != sha256.Size {
+		store.Delete(refreshFamilyKeyPrefix + key)
+		return nil, errors.ErrRefreshTokenInvalid
+	}
+	usr, err := user.NewUser(record.Claims)
+	if err != nil {
+		store.Delete(refreshFamilyKeyPrefix + key)
+		return nil, errors.ErrRefreshTokenInvalid
+	}
+	usr.Authenticator = record.Authenticator
+	family := &refreshTokenFamily{
+		key:       key,
+		user:      usr,
+		authTime:  record.AuthTime,
+		expiresAt: record.ExpiresAt,
+	}
+	copy(family.secretHash[:], record.SecretHash)
+	return family, nil
+}
+
+func (m *refreshTokenManager) putFamily(store kvstore.Store, family *refreshTokenFamily) error {
+	ttl := time.Until(family.expiresAt)
+	if ttl <= 0 {
+		return errors.ErrRefreshTokenExpired
+	}
+	record := &refreshTokenRecord{
+		Claims:        family.user.AsMap(),
+		Authenticator: family.user.Authenticator,
+		AuthTime:      family.authTime,
+		ExpiresAt:     family.expiresAt,
+		SecretHash:    family.secretHash[:],
+	}
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return store.Set(refreshFamilyKeyPrefix+family.key, b, ttl)
+}
+
+func (m *refreshTokenManager) deleteFamily(store kvstore.Store, family *refreshTokenFamily) {
+	store.Delete(refreshFamilyKeyPrefix + family.key)
+	if id := family.user.Claims.ID; id != "" {
+		if key, err := store.Get(refreshSessionKeyPrefix + id); err == nil && string(key) == family.key {
+			store.Delete(refreshSessionKeyPrefix + id)
+		}
+	}
+}
+
+func newRefreshTokenPart(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
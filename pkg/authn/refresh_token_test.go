@@ -0,0 +1,268 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authn
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/greenpau/go-authcrunch/internal/tests"
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/kvstore"
+	"github.com/greenpau/go-authcrunch/pkg/user"
+)
+
+func newTestRefreshTokenUser(t *testing.T) *user.User {
+	usr, err := user.NewUser(map[string]interface{}{
+		"jti":   "a1b2c3",
+		"sub":   "jsmith",
+		"email": "jsmith@localhost.localdomain",
+		"roles": []string{"authp/user"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return usr
+}
+
+func TestRefreshToken(t *testing.T) {
+	testcases := []struct {
+		name   string
+		config *TokenRefreshConfig
+		tamper func(string) string
+		// rotate is the number of rotations prior to the test.
+		rotate int
+		// reuse uses the first token rather than the latest token.
+		reuse         bool
+		revoke        bool
+		revokeSubject bool
+		want          map[string]interface{}
+		shouldErr     bool
+		err           error
+	}{
+		{
+			name:   "test valid token",
+			config: &TokenRefreshConfig{},
+			want: map[string]interface{}{
+				"jti": "a1b2c3",
+				"sub": "jsmith",
+			},
+		},
+		{
+			name:   "test rotated token",
+			config: &TokenRefreshConfig{},
+			rotate: 3,
+			want: map[string]interface{}{
+				"jti": "a1b2c3",
+				"sub": "jsmith",
+			},
+		},
+		{
+			name:      "test reused token",
+			config:    &TokenRefreshConfig{},
+			rotate:    1,
+			reuse:     true,
+			shouldErr: true,
+			err:       errors.ErrRefreshTokenReused,
+		},
+		{
+			name:   "test malformed token",
+			config: &TokenRefreshConfig{},
+			tamper: func(s string) string {
+				return strings.Replace(s, ".", "", 1)
+			},
+			shouldErr: true,
+			err:       errors.ErrRefreshTokenMalformed,
+		},
+		{
+			name:   "test unknown token",
+			config: &TokenRefreshConfig{},
+			tamper: func(s string) string {
+				return "x" + s
+			},
+			shouldErr: true,
+			err:       errors.ErrRefreshTokenInvalid,
+		},
+		{
+			name:      "test expired token",
+			config:    &TokenRefreshConfig{TokenLifetime: -1},
+			shouldErr: true,
+			err:       errors.ErrRefreshTokenExpired,
+		},
+		{
+			name:      "test token revoked on logout",
+			config:    &TokenRefreshConfig{},
+			revoke:    true,
+			shouldErr: true,
+			err:       errors.ErrRefreshTokenInvalid,
+		},
+		{
+			name:          "test token revoked for subject",
+			config:        &TokenRefreshConfig{},
+			rotate:        1,
+			revokeSubject: true,
+			shouldErr:     true,
+			err:           errors.ErrRefreshTokenRevoked,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			m := newRefreshTokenManager(tc.config)
+			token, err := m.issue(newTestRefreshTokenUser(t))
+			if err != nil {
+				// The tokens expired on issue are not stored.
+				tests.EvalErrWithLog(t, err, "issue", tc.shouldErr, tc.err, msgs)
+				return
+			}
+			firstToken := token
+			for i := 0; i < tc.rotate; i++ {
+				_, token, err = m.rotate(token)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			if tc.reuse {
+				token = firstToken
+			}
+			if tc.tamper != nil {
+				token = tc.tamper(token)
+			}
+			if tc.revoke {
+				m.revokeSession("a1b2c3")
+			}
+			if tc.revokeSubject {
+				if err := m.revokeSubject("jsmith"); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			family, nextToken, err := m.rotate(token)
+			if tests.EvalErrWithLog(t, err, "rotate", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			if nextToken == token {
+				t.Fatalf("expected rotated token to differ from redeemed token")
+			}
+			got := make(map[string]interface{})
+			got["jti"] = family.user.Claims.ID
+			got["sub"] = family.user.Claims.Subject
+			tests.EvalObjectsWithLog(t, "family", tc.want, got, msgs)
+		})
+	}
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	m := newRefreshTokenManager(&TokenRefreshConfig{})
+	token, err := m.issue(newTestRefreshTokenUser(t))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, nextToken, err := m.rotate(token)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	family, _, err := m.rotate(token)
+	if err != errors.ErrRefreshTokenReused {
+		t.Fatalf("expected reuse error, got: %v", err)
+	}
+	if family == nil || family.user.Claims.ID != "a1b2c3" {
+		t.Fatalf("expected reused family to be returned")
+	}
+	// The latest token of the family is no longer valid.
+	if _, _, err := m.rotate(nextToken); err != errors.ErrRefreshTokenInvalid {
+		t.Fatalf("expected invalid token error, got: %v", err)
+	}
+}
+
+func TestRefreshTokenSharedStore(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+	m1 := newRefreshTokenManager(&TokenRefreshConfig{})
+	m1.SetStore(store)
+	m2 := newRefreshTokenManager(&TokenRefreshConfig{})
+	m2.SetStore(store)
+
+	token, err := m1.issue(newTestRefreshTokenUser(t))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The token issued by one instance is redeemed by another one.
+	family, nextToken, err := m2.rotate(token)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if family.user.Claims.Subject != "jsmith" {
+		t.Fatalf("unexpected family subject: %s", family.user.Claims.Subject)
+	}
+	// The redeemed token is rejected by any instance.
+	if _, _, err := m1.rotate(token); err != errors.ErrRefreshTokenReused {
+		t.Fatalf("expected reuse error, got: %v", err)
+	}
+	if _, _, err := m2.rotate(nextToken); err != errors.ErrRefreshTokenInvalid {
+		t.Fatalf("expected invalid token error, got: %v", err)
+	}
+}
+
+func TestValidateTokenRefreshConfig(t *testing.T) {
+	testcases := []struct {
+		name      string
+		config    *TokenRefreshConfig
+		want      map[string]interface{}
+		shouldErr bool
+		err       error
+	}{
+		{
+			name:   "test default config",
+			config: &TokenRefreshConfig{},
+			want: map[string]interface{}{
+				"token_lifetime": 604800,
+				"renewal_window": 300,
+			},
+		},
+		{
+			name:   "test custom config",
+			config: &TokenRefreshConfig{TokenLifetime: 3600, SlidingRenewalEnabled: true, RenewalWindow: 120},
+			want: map[string]interface{}{
+				"token_lifetime": 3600,
+				"renewal_window": 120,
+			},
+		},
+		{
+			name:      "test short token lifetime",
+			config:    &TokenRefreshConfig{TokenLifetime: 60},
+			shouldErr: true,
+			err:       errors.ErrTokenRefreshConfigTokenLifetime.WithArgs("default", 60),
+		},
+		{
+			name:      "test negative renewal window",
+			config:    &TokenRefreshConfig{RenewalWindow: -1},
+			shouldErr: true,
+			err:       errors.ErrTokenRefreshConfigRenewalWindow.WithArgs("default", -1),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			err := tc.config.Validate("default")
+			if tests.EvalErrWithLog(t, err, "validate", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			got := make(map[string]interface{})
+			got["token_lifetime"] = tc.config.TokenLifetime
+			got["renewal_window"] = tc.config.RenewalWindow
+			tests.EvalObjectsWithLog(t, "config", tc.want, got, msgs)
+		})
+	}
+}
@@ -60,11 +60,7 @@ func (p *Portal) handleAPI(ctx context.Context, w http.ResponseWriter, r *http.R
 			)
 			return p.handleJSONError(ctx, w, http.StatusForbidden, http.StatusText(http.StatusForbidden))
 		}
-		// case p.config.API.AdminEnabled && strings.HasSuffix(r.URL.Path, "/api/metadata"):
-		// 	return p.handleAPIMetadata(ctx, w, r, rr, usr)
-		// case p.config.API.AdminEnabled && strings.Contains(r.URL.Path, "/api/users"):
-		// 	return p.handleAPIListUsers(ctx, w, r, rr, usr)
-		return p.handleJSONError(ctx, w, http.StatusNotImplemented, http.StatusText(http.StatusNotImplemented))
+		return p.handleAPIManager(ctx, w, r, rr, usr)
 	case p.config.API.ProfileEnabled && r.Method == "POST" && strings.Contains(r.URL.Path, "/api/profile"):
 		if err := p.authorizedRole(usr, []role.Kind{role.Admin, role.User}, rr.Response.Authenticated); err != nil {
 			p.logger.Debug(
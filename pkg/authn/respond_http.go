@@ -41,8 +41,8 @@ func (p *Portal) handleHTTP(ctx context.Context, w http.ResponseWriter, r *http.
 		return p.handleHTTPStaticAssets(ctx, w, r, rr)
 	case strings.Contains(r.URL.Path, "/portal"):
 		return p.handleHTTPPortal(ctx, w, r, rr, usr)
-	case strings.HasSuffix(r.URL.Path, "/recover"), strings.HasSuffix(r.URL.Path, "/forgot"):
-		// TODO(greenpau): implement password recovery.
+	case strings.HasSuffix(r.URL.Path, "/recover"), strings.Contains(r.URL.Path, "/recover/"),
+		strings.HasSuffix(r.URL.Path, "/forgot"), strings.Contains(r.URL.Path, "/forgot/"):
 		return p.handleHTTPRecover(ctx, w, r, rr)
 	case strings.HasSuffix(r.URL.Path, "/register"), strings.Contains(r.URL.Path, "/register/"):
 		return p.handleHTTPRegister(ctx, w, r, rr)
@@ -54,6 +54,8 @@ func (p *Portal) handleHTTP(ctx context.Context, w http.ResponseWriter, r *http.
 		return p.handleHTTPAppsMobileAccess(ctx, w, r, rr, usr)
 	case strings.Contains(r.URL.Path, "/oauth2/") && strings.HasSuffix(r.URL.Path, "/logout"):
 		return p.handleHTTPExternalLogout(ctx, w, r, rr, "oauth2")
+	case strings.Contains(r.URL.Path, "/saml/") && strings.HasSuffix(r.URL.Path, "/logout"):
+		return p.handleHTTPSamlLogout(ctx, w, r, rr)
 	case strings.Contains(r.URL.Path, "/saml/"):
 		return p.handleHTTPExternalLogin(ctx, w, r, rr, "saml")
 	case strings.Contains(r.URL.Path, "/oauth2/"):
@@ -302,6 +304,7 @@ func (p *Portal) authorizeRequest(ctx context.Context, w http.ResponseWriter, r
 	}
 	if usr != nil {
 		rr.Response.Authenticated = true
+		usr = p.renewToken(ctx, w, r, rr, usr)
 	}
 	return usr, nil
 }
@@ -334,12 +337,15 @@ func extractBasePath(ctx context.Context, r *http.Request, rr *requests.Request)
 		extractBaseURLPath(ctx, r, rr, "/portal")
 	case strings.Contains(r.URL.Path, "/sandbox/"):
 		extractBaseURLPath(ctx, r, rr, "/sandbox/")
-	case strings.HasSuffix(r.URL.Path, "/recover"), strings.HasSuffix(r.URL.Path, "/forgot"):
+	case strings.HasSuffix(r.URL.Path, "/recover"), strings.Contains(r.URL.Path, "/recover/"),
+		strings.HasSuffix(r.URL.Path, "/forgot"), strings.Contains(r.URL.Path, "/forgot/"):
 		extractBaseURLPath(ctx, r, rr, "/recover,/forgot")
 	case strings.HasSuffix(r.URL.Path, "/register"):
 		extractBaseURLPath(ctx, r, rr, "/register")
 	case strings.HasSuffix(r.URL.Path, "/whoami"):
 		extractBaseURLPath(ctx, r, rr, "/whoami")
+	case strings.Contains(r.URL.Path, "/oidc/"):
+		extractBaseURLPath(ctx, r, rr, "/oidc/")
 	case strings.Contains(r.URL.Path, "/saml/"):
 		extractBaseURLPath(ctx, r, rr, "/saml/")
 	case strings.Contains(r.URL.Path, "/oauth2/"):
@@ -79,6 +79,11 @@ func (p *Portal) handleJSON(ctx context.Context, w http.ResponseWriter, r *http.
 		zap.String("source_address", addrutil.GetSourceAddress(r)),
 	)
 
+	// The refresh requests may carry expired access tokens.
+	if strings.HasSuffix(r.URL.Path, "/refresh") {
+		return p.handleJSONRefresh(ctx, w, r, rr)
+	}
+
 	usr, err := p.authorizeRequest(ctx, w, r, rr)
 	if err != nil {
 		return p.handleJSONErrorWithLog(ctx, w, r, rr, http.StatusUnauthorized, err.Error())
@@ -0,0 +1,71 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authn
+
+import (
+	"time"
+
+	"github.com/greenpau/go-authcrunch/pkg/revocation"
+	"github.com/greenpau/go-authcrunch/pkg/user"
+)
+
+// SetRevocationList sets the deny list of revoked tokens. The portal writes
+// to the list on logout, password change, and user management actions.
+func (p *Portal) SetRevocationList(l *revocation.List) {
+	p.revocationList = l
+	p.validator.SetRevocationList(l)
+}
+
+// revokeToken revokes the token of the user. The renewed copies of the
+// token share its id and expire later, hence the revocation is kept until
+// all the tokens issued by the portal so far expire.
+func (p *Portal) revokeToken(usr *user.User) error {
+	if p.revocationList == nil || usr == nil || usr.Claims == nil || usr.Claims.ID == "" {
+		return nil
+	}
+	expiresAt := time.Now().Add(p.getMaxTokenLifetime())
+	if usr.Claims.ExpiresAt > 0 && time.Unix(usr.Claims.ExpiresAt, 0).After(expiresAt) {
+		expiresAt = time.Unix(usr.Claims.ExpiresAt, 0)
+	}
+	return p.revocationList.RevokeToken(usr.Claims.ID, expiresAt)
+}
+
+// revokeSubject revokes the access and refresh tokens issued to the subject
+// so far. The revocation is kept until all the tokens issued by the portal
+// expire.
+func (p *Portal) revokeSubject(subject string) error {
+	if p.refreshTokens != nil {
+		if err := p.refreshTokens.revokeSubject(subject); err != nil {
+			return err
+		}
+	}
+	if p.revocationList == nil {
+		return nil
+	}
+	now := time.Now()
+	return p.revocationList.RevokeSubject(subject, now, now.Add(p.getMaxTokenLifetime()))
+}
+
+// getMaxTokenLifetime returns the maximum lifetime of the tokens signed by
+// the portal.
+func (p *Portal) getMaxTokenLifetime() time.Duration {
+	var maxLifetime int
+	for _, k := range p.keystore.GetSignKeys() {
+		if k.Sign.Token.MaxLifetime > maxLifetime {
+			maxLifetime = k.Sign.Token.MaxLifetime
+		}
+	}
+	return time.Duration(maxLifetime) * time.Second
+}
@@ -0,0 +1,96 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authn
+
+import (
+	"testing"
+	"time"
+
+	"github.com/greenpau/go-authcrunch/internal/tests"
+	"github.com/greenpau/go-authcrunch/internal/testutils"
+	"github.com/greenpau/go-authcrunch/pkg/ids"
+	"github.com/greenpau/go-authcrunch/pkg/revocation"
+	"github.com/greenpau/go-authcrunch/pkg/user"
+	logutil "github.com/greenpau/go-authcrunch/pkg/util/log"
+)
+
+func TestRevokeRenewedToken(t *testing.T) {
+	db, err := testutils.CreateTestDatabase("TestRevokeRenewedToken")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	logger := logutil.NewLogger()
+	store, err := ids.NewIdentityStore(&ids.IdentityStoreConfig{
+		Name: "local_backend",
+		Kind: "local",
+		Params: map[string]interface{}{
+			"path":  db.GetPath(),
+			"realm": "local",
+		},
+	}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Configure(); err != nil {
+		t.Fatal(err)
+	}
+	portal, err := NewPortal(PortalParameters{
+		Config: &PortalConfig{
+			Name:           "myportal",
+			IdentityStores: []string{"local_backend"},
+		},
+		Logger:         logger,
+		IdentityStores: []ids.IdentityStore{store},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := revocation.NewList(&revocation.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	portal.SetRevocationList(l)
+
+	usr, err := user.NewUser(map[string]interface{}{
+		"jti": "a1b2c3",
+		"sub": "jsmith",
+		"exp": time.Now().Add(time.Second).Unix(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	renewed, err := portal.reissueToken(usr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Log out with the older token and wait for it to expire.
+	if err := portal.revokeToken(usr); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Until(time.Unix(usr.Claims.ExpiresAt, 0)) + 100*time.Millisecond)
+
+	got := map[string]interface{}{
+		"jti":     renewed.Claims.ID,
+		"renewed": renewed.Claims.ExpiresAt > usr.Claims.ExpiresAt,
+		"revoked": l.IsRevoked(renewed.Claims.ID, renewed.Claims.Subject, renewed.Claims.IssuedAt),
+	}
+	want := map[string]interface{}{
+		"jti":     "a1b2c3",
+		"renewed": true,
+		"revoked": true,
+	}
+	tests.EvalObjectsWithLog(t, "renewed token", want, got, []string{})
+}
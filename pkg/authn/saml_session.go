@@ -0,0 +1,296 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authn
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/greenpau/go-authcrunch/pkg/authn/enums/operator"
+	"github.com/greenpau/go-authcrunch/pkg/kvstore"
+	"github.com/greenpau/go-authcrunch/pkg/requests"
+	"github.com/greenpau/go-authcrunch/pkg/user"
+	addrutil "github.com/greenpau/go-authcrunch/pkg/util/addr"
+	"go.uber.org/zap"
+)
+
+const (
+	samlSessionKeyPrefix = "saml/session/"
+	samlNameIDKeyPrefix  = "saml/nameid/"
+)
+
+// samlSession is the session of a user with a SAML identity provider.
+type samlSession struct {
+	realm     string
+	session   requests.IdentityProviderSession
+	expiresAt time.Time
+}
+
+// samlSessionRecord is the serialized form of samlSession kept in a
+// key/value store.
+type samlSessionRecord struct {
+	Realm        string    `json:"realm"`
+	NameID       string    `json:"name_id"`
+	NameIDFormat string    `json:"name_id_format,omitempty"`
+	SessionIndex string    `json:"session_index,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// samlSessionStore holds the sessions of the users authenticated by SAML
+// identity providers, so that the users are logged out of the identity
+// providers and vice versa. The sessions are keyed by the ids (jti claim)
+// of the access tokens issued by the portal, and indexed by the name ids of
+// the users. The sessions are kept in a key/value store, which is in memory
+// unless set with SetStore.
+type samlSessionStore struct {
+	mu       sync.RWMutex
+	lifetime time.Duration
+	store    kvstore.Store
+}
+
+func newSamlSessionStore(lifetime time.Duration) *samlSessionStore {
+	return &samlSessionStore{
+		lifetime: lifetime,
+		store:    kvstore.NewMemoryStore(),
+	}
+}
+
+// SetStore sets the key/value store holding the sessions.
+func (s *samlSessionStore) SetStore(store kvstore.Store) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.store = store
+}
+
+func (s *samlSessionStore) getStore() kvstore.Store {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.store
+}
+
+func getSamlNameIDKey(realm, nameID string) string {
+	return samlNameIDKeyPrefix + url.PathEscape(realm) + "/" + url.PathEscape(nameID)
+}
+
+func (s *samlSessionStore) add(id, realm string, session requests.IdentityProviderSession) error {
+	now := time.Now()
+	b, err := json.Marshal(&samlSessionRecord{
+		Realm:        realm,
+		NameID:       session.NameID,
+		NameIDFormat: session.NameIDFormat,
+		SessionIndex: session.SessionIndex,
+		ExpiresAt:    now.Add(s.lifetime),
+	})
+	if err != nil {
+		return err
+	}
+	store := s.getStore()
+	if err := store.Set(samlSessionKeyPrefix+id, b, s.lifetime); err != nil {
+		return err
+	}
+
+	// The index of the sessions of the user drops the sessions which have
+	// expired or have been deleted. Every session of the index outlives
+	// the sessions added before it, hence the index expires with the
+	// latest session.
+	ids := []string{id}
+	for _, k := range s.getIndex(store, realm, session.NameID) {
+		if k == id {
+			continue
+		}
+		if _, found := s.get(k); found {
+			ids = append(ids, k)
+		}
+	}
+	b, err = json.Marshal(ids)
+	if err != nil {
+		return err
+	}
+	return store.Set(getSamlNameIDKey(realm, session.NameID), b, s.lifetime)
+}
+
+func (s *samlSessionStore) getIndex(store kvstore.Store, realm, nameID string) []string {
+	b, err := store.Get(getSamlNameIDKey(realm, nameID))
+	if err != nil {
+		return nil
+	}
+	var ids []string
+	if err := json.Unmarshal(b, &ids); err != nil {
+		return nil
+	}
+	return ids
+}
+
+func (s *samlSessionStore) get(id string) (samlSession, bool) {
+	b, err := s.getStore().Get(samlSessionKeyPrefix + id)
+	if err != nil {
+		return samlSession{}, false
+	}
+	var record samlSessionRecord
+	if err := json.Unmarshal(b, &record); err != nil || !time.Now().Before(record.ExpiresAt) {
+		return samlSession{}, false
+	}
+	return samlSession{
+		realm: record.Realm,
+		session: requests.IdentityProviderSession{
+			NameID:       record.NameID,
+			NameIDFormat: record.NameIDFormat,
+			SessionIndex: record.SessionIndex,
+		},
+		expiresAt: record.ExpiresAt,
+	}, true
+}
+
+func (s *samlSessionStore) delete(id string) {
+	s.getStore().Delete(samlSessionKeyPrefix + id)
+}
+
+// find returns the sessions of the user with the name id. When the session
+// index is not empty, only the session with the index is returned.
+func (s *samlSessionStore) find(realm, nameID, sessionIndex string) map[string]samlSession {
+	m := make(map[string]samlSession)
+	for _, k := range s.getIndex(s.getStore(), realm, nameID) {
+		v, found := s.get(k)
+		if !found || v.realm != realm || v.session.NameID != nameID {
+			continue
+		}
+		if sessionIndex != "" && v.session.SessionIndex != sessionIndex {
+			continue
+		}
+		m[k] = v
+	}
+	return m
+}
+
+// requestSamlLogout returns the URL of the single logout service of the
+// identity provider which authenticated the user. It is empty when the user
+// was not authenticated by a SAML identity provider or the single logout
+// is disabled.
+func (p *Portal) requestSamlLogout(r *http.Request, rr *requests.Request, usr *user.User) string {
+	if p.samlSessions == nil || usr.Claims.ID == "" {
+		return ""
+	}
+	session, found := p.samlSessions.get(usr.Claims.ID)
+	if !found {
+		return ""
+	}
+	provider := p.getIdentityProviderByRealm(session.realm)
+	if provider == nil {
+		return ""
+	}
+
+	ur := requests.NewRequest()
+	ur.ID = rr.ID
+	ur.Upstream.Request = r
+	ur.Upstream.Method = "saml"
+	ur.Upstream.Realm = session.realm
+	ur.Session = session.session
+	if err := provider.Request(operator.Logout, ur); err != nil {
+		p.logger.Warn(
+			"failed requesting logout with identity provider",
+			zap.String("session_id", rr.Upstream.SessionID),
+			zap.String("request_id", rr.ID),
+			zap.String("realm", session.realm),
+			zap.Error(err),
+		)
+		return ""
+	}
+	if ur.Response.Code != http.StatusFound {
+		return ""
+	}
+	return ur.Response.RedirectURL
+}
+
+// handleHTTPSamlLogout handles the logout requests of SAML identity
+// providers and the responses to the logout requests of the portal.
+func (p *Portal) handleHTTPSamlLogout(ctx context.Context, w http.ResponseWriter, r *http.Request, rr *requests.Request) error {
+	p.disableClientCache(w)
+	authRealm, err := getEndpoint(r.URL.Path, "/saml/")
+	if err != nil {
+		return p.handleHTTPError(ctx, w, r, rr, http.StatusBadRequest)
+	}
+	authRealm = strings.Split(authRealm, "/")[0]
+	provider := p.getIdentityProviderByRealm(authRealm)
+	if provider == nil || provider.GetKind() != "saml" {
+		return p.handleHTTPRedirect(ctx, w, r, rr, "/login")
+	}
+
+	rr.Upstream.Method = "saml"
+	rr.Upstream.Realm = authRealm
+	if err := provider.Request(operator.Logout, rr); err != nil {
+		p.logger.Warn(
+			"SAML logout failed",
+			zap.String("session_id", rr.Upstream.SessionID),
+			zap.String("request_id", rr.ID),
+			zap.String("realm", authRealm),
+			zap.Error(err),
+		)
+		return p.handleHTTPError(ctx, w, r, rr, http.StatusBadRequest)
+	}
+
+	if rr.Session.NameID != "" {
+		// The identity provider terminated the session of the user.
+		p.revokeSamlSessions(rr, authRealm)
+		h := addrutil.GetSourceHost(r)
+		for tokenName := range p.validator.GetAuthCookies() {
+			w.Header().Add("Set-Cookie", p.cookie.GetDeleteCookie(h, tokenName))
+		}
+		w.Header().Add("Set-Cookie", p.cookie.GetDeleteCookie(h, p.cookie.SessionID))
+	}
+
+	if rr.Response.Code == http.StatusFound {
+		return p.handleHTTPRedirectExternal(ctx, w, r, rr, rr.Response.RedirectURL)
+	}
+	return p.handleHTTPRedirect(ctx, w, r, rr, "/login")
+}
+
+// revokeSamlSessions revokes the tokens of the sessions terminated by the
+// identity provider.
+func (p *Portal) revokeSamlSessions(rr *requests.Request, realm string) {
+	if p.samlSessions == nil {
+		return
+	}
+	for id, session := range p.samlSessions.find(realm, rr.Session.NameID, rr.Session.SessionIndex) {
+		p.samlSessions.delete(id)
+		p.sessions.Delete(id)
+		if p.refreshTokens != nil {
+			p.refreshTokens.revokeSession(id)
+			p.upstreamSessions.delete(id)
+		}
+		if p.revocationList != nil {
+			if err := p.revocationList.RevokeToken(id, session.expiresAt); err != nil {
+				p.logger.Warn(
+					"failed revoking token on identity provider logout",
+					zap.String("session_id", rr.Upstream.SessionID),
+					zap.String("request_id", rr.ID),
+					zap.String("jti", id),
+					zap.Error(err),
+				)
+			}
+		}
+		p.logger.Info(
+			"user logged out by identity provider",
+			zap.String("session_id", rr.Upstream.SessionID),
+			zap.String("request_id", rr.ID),
+			zap.String("realm", realm),
+			zap.String("jti", id),
+		)
+	}
+}
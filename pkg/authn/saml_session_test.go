@@ -0,0 +1,88 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authn
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/greenpau/go-authcrunch/internal/tests"
+	"github.com/greenpau/go-authcrunch/pkg/kvstore"
+	"github.com/greenpau/go-authcrunch/pkg/requests"
+)
+
+func TestSamlSessionStore(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+	s1 := newSamlSessionStore(time.Hour)
+	s1.SetStore(store)
+	s2 := newSamlSessionStore(time.Hour)
+	s2.SetStore(store)
+
+	for id, index := range map[string]string{"a1b2c3": "idx1", "d4e5f6": "idx2", "g7h8i9": "idx3"} {
+		session := requests.IdentityProviderSession{NameID: "jsmith@contoso.com", SessionIndex: index}
+		if err := s1.add(id, "contoso", session); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s1.add("j0k1l2", "contoso", requests.IdentityProviderSession{NameID: "bjones@contoso.com"}); err != nil {
+		t.Fatal(err)
+	}
+	s2.delete("g7h8i9")
+
+	session, found := s2.get("a1b2c3")
+	var ids []string
+	for id := range s2.find("contoso", "jsmith@contoso.com", "") {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	var indexIDs []string
+	for id := range s2.find("contoso", "jsmith@contoso.com", "idx2") {
+		indexIDs = append(indexIDs, id)
+	}
+
+	got := map[string]interface{}{
+		"found":         found,
+		"realm":         session.realm,
+		"name_id":       session.session.NameID,
+		"session_index": session.session.SessionIndex,
+		"ids":           ids,
+		"index_ids":     indexIDs,
+		"other_realm":   len(s2.find("azure", "jsmith@contoso.com", "")),
+	}
+	want := map[string]interface{}{
+		"found":         true,
+		"realm":         "contoso",
+		"name_id":       "jsmith@contoso.com",
+		"session_index": "idx1",
+		"ids":           []string{"a1b2c3", "d4e5f6"},
+		"index_ids":     []string{"d4e5f6"},
+		"other_realm":   0,
+	}
+	tests.EvalObjectsWithLog(t, "shared sessions", want, got, []string{})
+
+	expired := newSamlSessionStore(-1 * time.Second)
+	expired.add("a1b2c3", "contoso", requests.IdentityProviderSession{NameID: "jsmith@contoso.com"})
+	_, expiredFound := expired.get("a1b2c3")
+	got = map[string]interface{}{
+		"expired_found": expiredFound,
+		"expired_ids":   len(expired.find("contoso", "jsmith@contoso.com", "")),
+	}
+	want = map[string]interface{}{
+		"expired_found": false,
+		"expired_ids":   0,
+	}
+	tests.EvalObjectsWithLog(t, "expired sessions", want, got, []string{})
+}
@@ -36,6 +36,10 @@ func (p *Portal) ServeHTTP(ctx context.Context, w http.ResponseWriter, r *http.R
 	}
 	rr.Response.RedirectTokenName = p.cookie.Referer
 	switch {
+	case strings.Contains(r.URL.Path, "/.well-known/"):
+		return p.handleWellKnown(ctx, w, r, rr)
+	case strings.Contains(r.URL.Path, "/oidc/"):
+		return p.handleOpenIDConnect(ctx, w, r, rr)
 	case strings.Contains(r.URL.Path, "/api/"):
 		return p.handleAPI(ctx, w, r, rr)
 	case strings.Contains(r.URL.Path, "/qrcode/"):
@@ -222,6 +222,40 @@ func TestServeHTTP(t *testing.T) {
 				"content_type": "image/png",
 			},
 		},
+		{
+			name: "test unauthenticated user accessing jwks",
+			requests: []*testAppRequest{
+				{
+					method: "GET",
+					path:   "/auth/.well-known/jwks.json",
+				},
+			},
+			want: map[string]interface{}{
+				"response": requests.Response{
+					Code:              http.StatusOK,
+					RedirectTokenName: "AUTHP_REDIRECT_URL",
+				},
+				"status_code":  http.StatusOK,
+				"content_type": "application/json",
+			},
+		},
+		{
+			name: "test unauthenticated user accessing openid configuration",
+			requests: []*testAppRequest{
+				{
+					method: "GET",
+					path:   "/auth/.well-known/openid-configuration",
+				},
+			},
+			want: map[string]interface{}{
+				"response": requests.Response{
+					Code:              http.StatusOK,
+					RedirectTokenName: "AUTHP_REDIRECT_URL",
+				},
+				"status_code":  http.StatusOK,
+				"content_type": "application/json",
+			},
+		},
 		{
 			name: "test unauthenticated user accessing default portal page",
 			requests: []*testAppRequest{
@@ -0,0 +1,181 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authn
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/greenpau/go-authcrunch/pkg/authn/enums/operator"
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/requests"
+	"github.com/greenpau/go-authcrunch/pkg/user"
+	addrutil "github.com/greenpau/go-authcrunch/pkg/util/addr"
+	"go.uber.org/zap"
+)
+
+// reissueToken returns a copy of the user with a newly signed token. The
+// copy has the claims of the user, including the token id, with renewed
+// issue and expiry times.
+func (p *Portal) reissueToken(usr *user.User) (*user.User, error) {
+	m := make(map[string]interface{})
+	for k, v := range usr.AsMap() {
+		m[k] = v
+	}
+	now := time.Now()
+	m["exp"] = now.Add(time.Duration(p.keystore.GetTokenLifetime(nil, nil)) * time.Second).UTC().Unix()
+	m["iat"] = now.UTC().Unix()
+	m["nbf"] = now.Add(time.Duration(60) * time.Second * -1).UTC().Unix()
+
+	nusr, err := user.NewUser(m)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.keystore.SignToken(nil, nil, nusr); err != nil {
+		return nil, err
+	}
+	nusr.Authenticator = usr.Authenticator
+	nusr.Authorized = true
+	return nusr, nil
+}
+
+// refreshUser checks whether the user is still active with the identity
+// store or provider which authenticated the user, and returns the user
+// with the current claims. The users authenticated by identity providers
+// not issuing refresh tokens are returned as is.
+func (p *Portal) refreshUser(ctx context.Context, rr *requests.Request, usr *user.User) (*user.User, error) {
+	if p.upstreamSessions != nil && usr.Claims.ID != "" {
+		if session, found := p.upstreamSessions.get(usr.Claims.ID); found {
+			return p.refreshUpstreamUser(ctx, rr, usr, session)
+		}
+	}
+	if usr.Authenticator.Realm == "" {
+		return usr, nil
+	}
+	backend := p.getIdentityStoreByRealm(usr.Authenticator.Realm)
+	if backend == nil {
+		if p.getIdentityProviderByRealm(usr.Authenticator.Realm) != nil {
+			return usr, nil
+		}
+		return nil, errors.ErrRefreshUserRealmNotFound.WithArgs(usr.Authenticator.Realm)
+	}
+
+	ur := requests.NewRequest()
+	ur.ID = rr.ID
+	ur.Logger = p.logger
+	ur.Upstream.SessionID = usr.Claims.ID
+	ur.Upstream.Realm = usr.Authenticator.Realm
+	ur.User.Username = usr.Claims.Subject
+	if err := backend.Request(operator.IdentifyUser, ur); err != nil {
+		return nil, err
+	}
+	// The identity stores identify unknown and disabled users as nobody.
+	if ur.User.Username == "nobody" || !strings.EqualFold(ur.User.Username, usr.Claims.Subject) {
+		return nil, errors.ErrRefreshUserNotFound.WithArgs(usr.Claims.Subject, usr.Authenticator.Realm)
+	}
+	if hasPendingPasswordChange(ur.User.Challenges) {
+		return nil, errors.ErrUserPasswordExpired
+	}
+
+	m := make(map[string]interface{})
+	m["sub"] = ur.User.Username
+	m["email"] = ur.User.Email
+	if ur.User.FullName != "" {
+		m["name"] = ur.User.FullName
+	}
+	if len(ur.User.Roles) > 0 {
+		m["roles"] = ur.User.Roles
+	}
+	claims := usr.AsMap()
+	for _, k := range []string{"jti", "origin", "iss", "addr"} {
+		if v, exists := claims[k]; exists {
+			m[k] = v
+		}
+	}
+	if err := p.transformUser(ctx, ur, m); err != nil {
+		return nil, err
+	}
+	injectPortalRoles(m, p.config)
+
+	nusr, err := user.NewUser(m)
+	if err != nil {
+		return nil, err
+	}
+	nusr.Authenticator = usr.Authenticator
+	return nusr, nil
+}
+
+// renewToken performs the sliding renewal of the access token in a browser
+// cookie. When the token expires within the renewal window, the cookie is
+// reissued with a new token. It returns the user with the token in effect.
+func (p *Portal) renewToken(ctx context.Context, w http.ResponseWriter, r *http.Request, rr *requests.Request, usr *user.User) *user.User {
+	if p.config.TokenRefresh == nil || !p.config.TokenRefresh.SlidingRenewalEnabled {
+		return usr
+	}
+	if usr.TokenSource != "cookie" || usr.Claims.ExpiresAt == 0 {
+		return usr
+	}
+	window := time.Duration(p.config.TokenRefresh.RenewalWindow) * time.Second
+	if time.Until(time.Unix(usr.Claims.ExpiresAt, 0)) > window {
+		return usr
+	}
+
+	// The session holds the authenticator of the user.
+	prototype := usr
+	if sessionUser, err := p.sessions.Get(usr.Claims.ID); err == nil {
+		prototype = sessionUser
+	}
+	prototype, err := p.refreshUser(ctx, rr, prototype)
+	if err != nil {
+		// The user is no longer active with the identity store or provider.
+		p.logger.Warn(
+			"token renewal denied by identity store or provider",
+			zap.String("session_id", rr.Upstream.SessionID),
+			zap.String("request_id", rr.ID),
+			zap.String("jti", usr.Claims.ID),
+			zap.Error(err),
+		)
+		p.sessions.Delete(usr.Claims.ID)
+		if p.refreshTokens != nil {
+			p.refreshTokens.revokeSession(usr.Claims.ID)
+		}
+		return usr
+	}
+	nusr, err := p.reissueToken(prototype)
+	if err != nil {
+		p.logger.Warn(
+			"token renewal failed",
+			zap.String("session_id", rr.Upstream.SessionID),
+			zap.String("request_id", rr.ID),
+			zap.Error(err),
+		)
+		return usr
+	}
+	nusr.TokenSource = usr.TokenSource
+	if usr.Claims.ID != "" {
+		p.sessions.Add(usr.Claims.ID, nusr)
+	}
+	w.Header().Add("Set-Cookie", p.cookie.GetCookie(addrutil.GetSourceHost(r), nusr.TokenName, nusr.Token))
+	p.logger.Debug(
+		"renewed user token",
+		zap.String("session_id", rr.Upstream.SessionID),
+		zap.String("request_id", rr.ID),
+		zap.String("jti", nusr.Claims.ID),
+		zap.Int64("exp", nusr.Claims.ExpiresAt),
+	)
+	return nusr
+}
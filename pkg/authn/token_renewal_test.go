@@ -0,0 +1,144 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authn
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/greenpau/go-authcrunch/internal/tests"
+	"github.com/greenpau/go-authcrunch/internal/testutils"
+	"github.com/greenpau/go-authcrunch/pkg/authn/enums/operator"
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/ids"
+	"github.com/greenpau/go-authcrunch/pkg/requests"
+	"github.com/greenpau/go-authcrunch/pkg/user"
+	logutil "github.com/greenpau/go-authcrunch/pkg/util/log"
+)
+
+func TestRefreshUser(t *testing.T) {
+	db, err := testutils.CreateTestDatabase("TestRefreshUser")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	logger := logutil.NewLogger()
+	store, err := ids.NewIdentityStore(&ids.IdentityStoreConfig{
+		Name: "local_backend",
+		Kind: "local",
+		Params: map[string]interface{}{
+			"path":  db.GetPath(),
+			"realm": "local",
+		},
+	}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Configure(); err != nil {
+		t.Fatal(err)
+	}
+	portal, err := NewPortal(PortalParameters{
+		Config: &PortalConfig{
+			Name:           "myportal",
+			IdentityStores: []string{"local_backend"},
+		},
+		Logger:         logger,
+		IdentityStores: []ids.IdentityStore{store},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Request(operator.DisableUser, &requests.Request{
+		User: requests.User{Username: tests.TestUser2, Email: tests.TestEmail2},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := []struct {
+		name      string
+		claims    map[string]interface{}
+		realm     string
+		want      map[string]interface{}
+		shouldErr bool
+		err       error
+	}{
+		{
+			name: "test user with outdated roles",
+			claims: map[string]interface{}{
+				"jti":   "a1b2c3",
+				"sub":   tests.TestUser1,
+				"roles": []string{"viewer"},
+			},
+			realm: "local",
+			want: map[string]interface{}{
+				"jti":   "a1b2c3",
+				"sub":   tests.TestUser1,
+				"roles": tests.TestRoles1,
+			},
+		},
+		{
+			name: "test disabled user",
+			claims: map[string]interface{}{
+				"jti": "a1b2c3",
+				"sub": tests.TestUser2,
+			},
+			realm:     "local",
+			shouldErr: true,
+			err:       errors.ErrRefreshUserNotFound.WithArgs(tests.TestUser2, "local"),
+		},
+		{
+			name: "test deleted user",
+			claims: map[string]interface{}{
+				"jti": "a1b2c3",
+				"sub": "foobar",
+			},
+			realm:     "local",
+			shouldErr: true,
+			err:       errors.ErrRefreshUserNotFound.WithArgs("foobar", "local"),
+		},
+		{
+			name: "test user of unknown realm",
+			claims: map[string]interface{}{
+				"jti": "a1b2c3",
+				"sub": tests.TestUser1,
+			},
+			realm:     "contoso",
+			shouldErr: true,
+			err:       errors.ErrRefreshUserRealmNotFound.WithArgs("contoso"),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			usr, err := user.NewUser(tc.claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+			usr.Authenticator.Name = "local_backend"
+			usr.Authenticator.Realm = tc.realm
+			usr.Authenticator.Method = "local"
+			nusr, err := portal.refreshUser(context.Background(), requests.NewRequest(), usr)
+			if tests.EvalErrWithLog(t, err, "refresh user", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			got := map[string]interface{}{
+				"jti":   nusr.Claims.ID,
+				"sub":   nusr.Claims.Subject,
+				"roles": nusr.Claims.Roles,
+			}
+			tests.EvalObjectsWithLog(t, "user", tc.want, got, msgs)
+		})
+	}
+}
@@ -117,6 +117,13 @@ var PageTemplates = map[string]string{
                   </a>
                 </div>
 
+                <div id="forgot_password_link" {{ if eq .Data.login_options.hide_forgot_password_link "yes" }}class="hidden"{{ end -}}>
+                  <a class="text-primary-600" href="{{ pathjoin .ActionEndpoint "/recover" .Data.login_options.default_realm }}">
+                    <i class="las la-key"></i>
+                    <span class="text-lg">Forgot Password?</span>
+                  </a>
+                </div>
+
                 <div id="contact_support_link" {{ if eq .Data.login_options.hide_contact_support_link "yes" }}class="hidden"{{ end -}}>
                   <a class="text-primary-600" href="{{ pathjoin .ActionEndpoint "/help" .Data.login_options.default_realm }}">
                     <i class="las la-info-circle"></i>
@@ -231,6 +238,20 @@ var PageTemplates = map[string]string{
                 </div>
               </a>
             </div>
+            {{ if .Data.csrf_token }}
+            <div class="pb-2">
+              <form action="{{ pathjoin .ActionEndpoint "/logout" }}" method="POST">
+                <input type="hidden" name="everywhere" value="true" />
+                <input type="hidden" name="csrf_token" value="{{ .Data.csrf_token }}" />
+                <button type="submit" class="w-full">
+                  <div class="app-portal-btn-box">
+                    <div class="app-portal-btn-img"><i class="las la-user-slash"></i></div>
+                    <div class="app-portal-btn-txt"><span>Sign Out Everywhere</span></div>
+                  </div>
+                </button>
+              </form>
+            </div>
+            {{ end }}
           </div>
         </div>
       </div>
@@ -569,6 +590,191 @@ var PageTemplates = map[string]string{
     </script>
     {{ end }}
   </body>
+</html>`,
+	"basic/recover": `<!DOCTYPE html>
+<html lang="en" class="h-full bg-blue-100">
+  <head>
+    <title>{{ .MetaTitle }} - {{ .PageTitle }}</title>
+    <!-- Required meta tags -->
+    <meta charset="utf-8" />
+    <meta name="viewport" content="width=device-width, initial-scale=1, shrink-to-fit=no" />
+    <meta name="description" content="{{ .MetaDescription }}" />
+    <meta name="author" content="{{ .MetaAuthor }}" />
+    <link rel="shortcut icon" href="{{ pathjoin .ActionEndpoint "/assets/images/favicon.png" }}" type="image/png" />
+    <link rel="icon" href="{{ pathjoin .ActionEndpoint "/assets/images/favicon.png" }}" type="image/png" />
+    <link rel="stylesheet" href="{{ pathjoin .ActionEndpoint "/assets/line-awesome/line-awesome.css" }}" />
+    <link rel="stylesheet" href="{{ pathjoin .ActionEndpoint "/assets/google-webfonts/roboto.css" }}" />
+    <link rel="stylesheet" href="{{ pathjoin .ActionEndpoint "/assets/google-webfonts/montserrat.css" }}" />
+    <link rel="stylesheet" href="{{ pathjoin .ActionEndpoint "/assets/css/register.css" }}" />
+    {{ if eq .Data.ui_options.custom_css_required "yes" }}
+      <link rel="stylesheet" href="{{ pathjoin .ActionEndpoint "/assets/css/custom.css" }}" />
+    {{ end }}
+  </head>
+
+  <body class="h-full">
+    <div class="app-page">
+      <div class="app-content">
+        <div class="app-container">
+          <div class="logo-col-box justify-center">
+            {{ if .LogoURL }}
+              <div>
+                <img class="logo-img" src="{{ .LogoURL }}" alt="{{ .LogoDescription }}" />
+              </div>
+            {{ end }}
+            <div>
+              <h2 class="logo-col-txt">{{ .PageTitle }}</h2>
+            </div>
+          </div>
+
+          {{ if .Message }}
+          <div id="alerts" class="rounded-md bg-red-50 p-4">
+            <div class="flex items-center">
+              <div class="flex-shrink-0"><i class="las la-exclamation-triangle text-2xl text-red-600"></i></div>
+              <div class="ml-3">
+                <p class="text-sm font-medium text-red-800">{{ .Message }}</p>
+                {{ range .Data.password_policy_violations }}
+                <p class="text-sm text-red-800">{{ . }}</p>
+                {{ end }}
+              </div>
+              <div class="ml-auto pl-3">
+                <div class="-mx-1.5 -my-1.5">
+                  <button type="button" onclick="hideAlert(); return false;" class="app-alert-banner">
+                    <span class="sr-only">Dismiss</span>
+                    <i class="las la-times text-2xl text-red-600"></i>
+                  </button>
+                </div>
+              </div>
+            </div>
+          </div>
+          {{ end }}
+
+          <div class="mt-3">
+              {{ if eq .Data.view "password" }}
+              <form method="POST" action="{{ pathjoin .ActionEndpoint "/recover" .Data.realm }}" class="space-y-6">
+              {{ end }}
+
+              {{ if eq .Data.view "username" }}
+              <form method="POST" action="{{ pathjoin .ActionEndpoint "/forgot" .Data.realm }}" class="space-y-6">
+              {{ end }}
+
+              {{ if eq .Data.view "reset" }}
+              <form method="POST" action="{{ pathjoin .ActionEndpoint "/recover" .Data.realm }}" class="space-y-6">
+              {{ end }}
+
+              {{ if or (eq .Data.view "password") (eq .Data.view "username") }}
+                <div class="app-txt-section">
+                  {{ if eq .Data.view "password" }}
+                  <p>Please provide the email address of your account. We will send you a link to reset your password.</p>
+                  {{ else }}
+                  <p>Please provide the email address of your account. We will send you your username.</p>
+                  {{ end }}
+                </div>
+                <div>
+                  <label for="email" class="app-gen-inp-lbl">Email</label>
+                  <div class="mt-1">
+                    <input id="email" name="email" type="email"
+                      class="app-gen-inp-txt validate"
+                      autocorrect="off" autocapitalize="off" autocomplete="email" spellcheck="false"
+                      autofocus required
+                    />
+                  </div>
+                </div>
+                <input id="realm" name="realm" type="hidden" value="{{ .Data.realm }}" />
+              {{ end }}
+
+              {{ if eq .Data.view "reset" }}
+                <div>
+                  <label for="secret1" class="app-gen-inp-lbl">New Password</label>
+                  <div class="mt-1">
+                    <input type="password" name="secret1" id="secret1"
+                      class="app-gen-inp-txt validate"
+                      autocorrect="off" autocapitalize="off" autocomplete="new-password" spellcheck="false"
+                      autofocus required
+                    />
+                  </div>
+                </div>
+                <div>
+                  <label for="secret2" class="app-gen-inp-lbl">Confirm New Password</label>
+                  <div class="mt-1">
+                    <input type="password" name="secret2" id="secret2"
+                      class="app-gen-inp-txt validate"
+                      autocorrect="off" autocapitalize="off" autocomplete="new-password" spellcheck="false"
+                      required
+                    />
+                  </div>
+                </div>
+                <input id="token" name="token" type="hidden" value="{{ .Data.token }}" />
+              {{ end }}
+
+              {{ if eq .Data.view "sent" }}
+              <div class="app-txt-section">
+                <p>If the provided email address belongs to an account, you will receive an email with further instructions shortly.</p>
+                <p>If you still don't see it, please check your spam folder or contact support.</p>
+              </div>
+              {{ end }}
+
+              {{ if eq .Data.view "resetfail" }}
+              <div class="app-txt-section">
+                <p>Unfortunately, things did not go as expected. {{ .Data.message }}.</p>
+                <p>Please request a new password reset link.</p>
+              </div>
+              {{ end }}
+
+              {{ if eq .Data.view "resetdone" }}
+              <div class="app-txt-section">
+                <p>Your password has been reset. You can now login with your new password.</p>
+              </div>
+              {{ end }}
+
+              <div>
+                <div class="flex gap-4 justify-end">
+                  <a href="{{ .ActionEndpoint }}">
+                    <button type="button" name="portal" class="app-btn-sec">
+                      <div><i class="las la-home"></i></div>
+                      <div class="pl-1 pr-2"><span>Home</span></div>
+                    </button>
+                  </a>
+                  {{ if or (eq .Data.view "password") (eq .Data.view "username") (eq .Data.view "reset") }}
+                  <button type="reset" name="reset" class="app-btn-sec">
+                    <div><i class="las la-redo-alt"></i></div>
+                    <div class="pl-1 pr-2"><span>Clear</span></div>
+                  </button>
+                  <button type="submit" name="submit" class="app-btn-pri">
+                    <div><i class="las la-check"></i></div>
+                    <div class="pl-1 pr-2"><span>Submit</span></div>
+                  </button>
+                  {{ end }}
+                  {{ if eq .Data.view "resetfail" }}
+                  <a href="{{ pathjoin .ActionEndpoint "/recover" .Data.realm }}">
+                    <button type="button" name="recover" class="app-btn-pri">
+                      <div><i class="las la-redo-alt"></i></div>
+                      <div class="pl-1 pr-2"><span>Retry</span></div>
+                    </button>
+                  </a>
+                  {{ end }}
+                </div>
+              </div>
+
+            {{ if or (eq .Data.view "password") (eq .Data.view "username") (eq .Data.view "reset") }}
+            </form>
+            {{ end }}
+
+          </div>
+        </div>
+      </div>
+    </div>
+    <!-- JavaScript -->
+    {{ if eq .Data.ui_options.custom_js_required "yes" }}
+      <script src="{{ pathjoin .ActionEndpoint "/assets/js/custom.js" }}"></script>
+    {{ end }}
+    {{ if .Message }}
+    <script>
+    function hideAlert() {
+      document.getElementById("alerts").remove();
+    }
+    </script>
+    {{ end }}
+  </body>
 </html>`,
 	"basic/generic": `<!DOCTYPE html>
 <html lang="en" class="h-full bg-blue-100">
@@ -1557,7 +1763,7 @@ function u2f_token_authenticate(formID, btnID) {
     {{ if or (eq .Data.view "mfa_app_auth") (eq .Data.view "mfa_app_register") }}
     <link rel="stylesheet" href="{{ pathjoin .ActionEndpoint "/assets/css/mfa_app.css" }}" />
     {{ end }}
-    {{ if eq .Data.view "password_recovery" }}
+    {{ if or (eq .Data.view "password_recovery") (eq .Data.view "password_change") }}
     <link rel="stylesheet" href="{{ pathjoin .ActionEndpoint "/assets/css/password.css" }}" />
     {{ end }}
   </head>
@@ -1628,6 +1834,14 @@ function u2f_token_authenticate(formID, btnID) {
                 <input id="sandbox_id" name="sandbox_id" type="hidden" value="{{ .Data.id }}" />
               </div>
 
+              {{ if .Data.password_recovery_enabled }}
+              <div class="text-center">
+                <a class="text-primary-600" href="{{ pathjoin .ActionEndpoint "sandbox" .Data.id "password-recovery" }}">
+                  <span>Forgot your password?</span>
+                </a>
+              </div>
+              {{ end }}
+
               <div class="flex gap-4">
                 <div class="flex-none">
                   <a href="{{ pathjoin .ActionEndpoint "sandbox" .Data.id "terminate" }}">
@@ -1715,6 +1929,71 @@ function u2f_token_authenticate(formID, btnID) {
           </div>
           <!-- End of Password Recovery -->
 
+          {{ else if eq .Data.view "password_change" }}
+
+          <!-- Start of Password Change -->
+          <div class="app-txt-section">
+            <p>Your password has expired. Please change your password to proceed further.</p>
+          </div>
+          <div>
+            <form class="space-y-6"
+                  action="{{ pathjoin .ActionEndpoint "sandbox" .Data.id "password-change" }}"
+                  method="POST"
+                  autocomplete="off"
+                  >
+              <div class="py-4">
+                <label for="secret1" class="app-inp-lbl">Current Password</label>
+                <div class="app-inp-box">
+                  <input id="secret1" name="secret1" type="password" class="app-inp-txt"
+                         autocorrect="off" autocapitalize="off" autocomplete="current-password" spellcheck="false" autofocus required />
+                </div>
+              </div>
+              <div class="py-4">
+                <label for="secret2" class="app-inp-lbl">New Password</label>
+                <div class="app-inp-box">
+                  <input id="secret2" name="secret2" type="password" class="app-inp-txt"
+                         autocorrect="off" autocapitalize="off" autocomplete="new-password" spellcheck="false" required />
+                </div>
+              </div>
+              <div class="py-4">
+                <label for="secret3" class="app-inp-lbl">Confirm New Password</label>
+                <div class="app-inp-box">
+                  <input id="secret3" name="secret3" type="password" class="app-inp-txt"
+                         autocorrect="off" autocapitalize="off" autocomplete="new-password" spellcheck="false" required />
+                </div>
+              </div>
+
+              <input id="sandbox_id" name="sandbox_id" type="hidden" value="{{ .Data.id }}" />
+
+              <div class="flex gap-4">
+                <div class="flex-none">
+                  <a href="{{ pathjoin .ActionEndpoint "sandbox" .Data.id "terminate" }}">
+                    <button type="button" class="app-btn-sec">
+                      <div>
+                        <svg xmlns="http://www.w3.org/2000/svg" class="h-6 w-6" fill="none" viewBox="0 0 24 24" stroke="currentColor" stroke-width="2">
+                          <path stroke-linecap="round" stroke-linejoin="round" d="M3 12l2-2m0 0l7-7 7 7M5 10v10a1 1 0 001 1h3m10-11l2 2m-2-2v10a1 1 0 01-1 1h-3m-6 0a1 1 0 001-1v-4a1 1 0 011-1h2a1 1 0 011 1v4a1 1 0 001 1m-6 0h6" />
+                        </svg>
+                      </div>
+                    </button>
+                  </a>
+                </div>
+                <div class="grow">
+                  <button type="submit" name="submit" class="app-btn-pri">
+                    <div>
+                      <svg xmlns="http://www.w3.org/2000/svg" class="h-6 w-6" fill="none" viewBox="0 0 24 24" stroke="currentColor" stroke-width="2">
+                        <path stroke-linecap="round" stroke-linejoin="round" d="M5 13l4 4L19 7" />
+                      </svg>
+                    </div>
+                    <div class="pl-2">
+                      <span>Change Password</span>
+                    </div>
+                  </button>
+                </div>
+              </div>
+            </form>
+          </div>
+          <!-- End of Password Change -->
+
           {{ else if eq .Data.view "mfa_app_auth" }}
           <div>
             <form class="space-y-6"
@@ -2025,6 +2304,19 @@ function u2f_token_authenticate(formID, btnID) {
               </a>
             </div>
           </div>
+          {{ else if eq .Data.view "password_recovery_sent" }}
+          <div class="app-txt-section">
+            <p>If the provided email address belongs to your account, you will receive an email with further instructions shortly.</p>
+          </div>
+          <div class="flex gap-4">
+            <div class="grow">
+              <a href="{{ pathjoin .ActionEndpoint "login" }}">
+                <button type="button" class="app-btn-pri">
+                  <span>Back to login</span>
+                </button>
+              </a>
+            </div>
+          </div>
           {{ else if eq .Data.view "terminate" }}
           <div class="app-txt-section">
             <p>{{ .Data.error }}.</p>
@@ -2182,7 +2474,34 @@ function u2f_token_authenticate(formID, btnID) {
             </div>
           </div>
 
-          {{ if gt .Data.role_count 0 }}
+          {{ if .Data.service_providers }}
+            <div class="pb-4 pt-4">
+              <p class="app-inp-lbl">Sign in to any of the following applications by clicking the name of the application.</p>
+            </div>
+
+            <div class="flex flex-col">
+              <div class="-my-2 -mx-4 overflow-x-auto sm:-mx-6 lg:-mx-8">
+                <div class="inline-block min-w-full py-2 align-middle md:px-6 lg:px-8">
+                  <table class="min-w-full divide-y divide-gray-300">
+                    <thead>
+                      <tr>
+                        <th scope="col" class="py-3.5 pl-4 pr-3 text-left text-sm font-semibold text-primary-700 sm:pl-6 md:pl-0">Application</th>
+                      </tr>
+                    </thead>
+                    <tbody class="divide-y divide-gray-200">
+                      {{ range .Data.service_providers }}
+                        <tr>
+                          <td class="whitespace-nowrap py-4 pl-4 pr-3 text-sm font-medium text-primary-700 sm:pl-6 md:pl-0 leading-none">
+                            <a href="{{ pathjoin $.ActionEndpoint "/apps/sso" .ProviderName "login" .Name }}">{{ .Name }}</a>
+                          </td>
+                        </tr>
+                      {{ end }}
+                    </tbody>
+                  </table>
+                </div>
+              </div>
+            </div>
+          {{ else if gt .Data.role_count 0 }}
             <div class="pb-4 pt-4">
               <p class="app-inp-lbl">Assume any of the following roles on the associated AWS accounts by clicking the name of the role.</p>
             </div>
@@ -2218,7 +2537,7 @@ function u2f_token_authenticate(formID, btnID) {
           {{ end }}
 
 
-          <div class="flex flex-wrap {{ if gt .Data.role_count 0 }}pt-6{{ end }} justify-center gap-4">
+          <div class="flex flex-wrap {{ if or .Data.service_providers (gt .Data.role_count 0) }}pt-6{{ end }} justify-center gap-4">
             <div id="forgot_username_link">
               <a class="text-primary-600" href="{{ pathjoin .ActionEndpoint "/portal" }}">
                 <i class="las la-layer-group"></i>
@@ -2302,5 +2621,74 @@ function u2f_token_authenticate(formID, btnID) {
       <script src="{{ pathjoin .ActionEndpoint "/assets/js/custom.js" }}"></script>
     {{ end }}
   </body>
+</html>`,
+	"basic/consent": `<!DOCTYPE html>
+<html lang="en" class="h-full bg-blue-100">
+  <head>
+    <title>{{ .MetaTitle }} - {{ .PageTitle }}</title>
+    <!-- Required meta tags -->
+    <meta charset="utf-8" />
+    <meta name="viewport" content="width=device-width, initial-scale=1, shrink-to-fit=no" />
+    <meta name="description" content="{{ .MetaDescription }}" />
+    <meta name="author" content="{{ .MetaAuthor }}" />
+    <link rel="shortcut icon" href="{{ pathjoin .ActionEndpoint "/assets/images/favicon.png" }}" type="image/png" />
+    <link rel="icon" href="{{ pathjoin .ActionEndpoint "/assets/images/favicon.png" }}" type="image/png" />
+    <link rel="stylesheet" href="{{ pathjoin .ActionEndpoint "/assets/line-awesome/line-awesome.css" }}" />
+    <link rel="stylesheet" href="{{ pathjoin .ActionEndpoint "/assets/google-webfonts/roboto.css" }}" />
+    <link rel="stylesheet" href="{{ pathjoin .ActionEndpoint "/assets/google-webfonts/montserrat.css" }}" />
+    <link rel="stylesheet" href="{{ pathjoin .ActionEndpoint "/assets/css/register.css" }}" />
+    {{ if eq .Data.ui_options.custom_css_required "yes" }}
+      <link rel="stylesheet" href="{{ pathjoin .ActionEndpoint "/assets/css/custom.css" }}" />
+    {{ end }}
+  </head>
+
+  <body class="h-full">
+    <div class="app-page">
+      <div class="app-content">
+        <div class="app-container">
+          <div class="logo-col-box justify-center">
+            {{ if .LogoURL }}
+              <div>
+                <img class="logo-img" src="{{ .LogoURL }}" alt="{{ .LogoDescription }}" />
+              </div>
+            {{ end }}
+            <div>
+              <h2 class="logo-col-txt">{{ .PageTitle }}</h2>
+            </div>
+          </div>
+
+          <div class="mt-3">
+            <form method="POST" action="{{ pathjoin .ActionEndpoint "/oidc/consent" }}" class="space-y-6">
+              <div class="app-txt-section">
+                <p><b>{{ .Data.client_name }}</b> would like to sign you in as <b>{{ .Data.username }}</b> and access the following information:</p>
+              </div>
+              <ul class="list-disc pl-6">
+                {{ range .Data.scopes }}
+                  <li class="text-sm text-primary-700">{{ .Description }}</li>
+                {{ end }}
+              </ul>
+              <input id="consent_id" name="consent_id" type="hidden" value="{{ .Data.consent_id }}" />
+              <div>
+                <div class="flex gap-4 justify-end">
+                  <button type="submit" name="action" value="deny" class="app-btn-sec">
+                    <div><i class="las la-times"></i></div>
+                    <div class="pl-1 pr-2"><span>Deny</span></div>
+                  </button>
+                  <button type="submit" name="action" value="allow" class="app-btn-pri">
+                    <div><i class="las la-check"></i></div>
+                    <div class="pl-1 pr-2"><span>Allow</span></div>
+                  </button>
+                </div>
+              </div>
+            </form>
+          </div>
+        </div>
+      </div>
+    </div>
+    <!-- JavaScript -->
+    {{ if eq .Data.ui_options.custom_js_required "yes" }}
+      <script src="{{ pathjoin .ActionEndpoint "/assets/js/custom.js" }}"></script>
+    {{ end }}
+  </body>
 </html>`,
 }
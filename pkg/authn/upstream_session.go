@@ -0,0 +1,173 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authn
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/greenpau/go-authcrunch/pkg/authn/enums/operator"
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/kvstore"
+	"github.com/greenpau/go-authcrunch/pkg/requests"
+	"github.com/greenpau/go-authcrunch/pkg/user"
+	"go.uber.org/zap"
+)
+
+const upstreamSessionKeyPrefix = "upstream/"
+
+// upstreamSession is the session of a user with an identity provider.
+type upstreamSession struct {
+	Realm        string    `json:"realm"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// upstreamSessionStore holds the refresh tokens issued by identity
+// providers. The sessions are keyed by the ids (jti claim) of the access
+// tokens issued by the portal. The sessions are kept in a key/value store,
+// which is in memory unless set with SetStore.
+type upstreamSessionStore struct {
+	mu       sync.RWMutex
+	lifetime time.Duration
+	store    kvstore.Store
+}
+
+func newUpstreamSessionStore(lifetime time.Duration) *upstreamSessionStore {
+	return &upstreamSessionStore{
+		lifetime: lifetime,
+		store:    kvstore.NewMemoryStore(),
+	}
+}
+
+// SetStore sets the key/value store holding the sessions.
+func (s *upstreamSessionStore) SetStore(store kvstore.Store) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.store = store
+}
+
+func (s *upstreamSessionStore) getStore() kvstore.Store {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.store
+}
+
+func (s *upstreamSessionStore) add(id, realm, refreshToken string) error {
+	return s.put(id, &upstreamSession{
+		Realm:        realm,
+		RefreshToken: refreshToken,
+		ExpiresAt:    time.Now().Add(s.lifetime),
+	})
+}
+
+// update replaces the refresh token of the session, e.g. after the rotation
+// by the identity provider.
+func (s *upstreamSessionStore) update(id, refreshToken string) error {
+	session, found := s.get(id)
+	if !found {
+		return nil
+	}
+	session.RefreshToken = refreshToken
+	return s.put(id, &session)
+}
+
+func (s *upstreamSessionStore) put(id string, session *upstreamSession) error {
+	ttl := time.Until(session.ExpiresAt)
+	if ttl <= 0 {
+		return errors.ErrIdentityProviderOauthSessionExpired
+	}
+	b, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return s.getStore().Set(upstreamSessionKeyPrefix+id, b, ttl)
+}
+
+func (s *upstreamSessionStore) get(id string) (upstreamSession, bool) {
+	b, err := s.getStore().Get(upstreamSessionKeyPrefix + id)
+	if err != nil {
+		return upstreamSession{}, false
+	}
+	var session upstreamSession
+	if err := json.Unmarshal(b, &session); err != nil || !time.Now().Before(session.ExpiresAt) {
+		return upstreamSession{}, false
+	}
+	return session, true
+}
+
+func (s *upstreamSessionStore) delete(id string) {
+	s.getStore().Delete(upstreamSessionKeyPrefix + id)
+}
+
+// refreshUpstreamUser checks the user with the identity provider which
+// authenticated the user. It returns the user with the claims provided by
+// the identity provider.
+func (p *Portal) refreshUpstreamUser(ctx context.Context, rr *requests.Request, usr *user.User, session upstreamSession) (*user.User, error) {
+	provider := p.getIdentityProviderByRealm(session.Realm)
+	if provider == nil {
+		p.upstreamSessions.delete(usr.Claims.ID)
+		return nil, errors.ErrIdentityProviderRealmNotFound.WithArgs(session.Realm)
+	}
+
+	ur := requests.NewRequest()
+	ur.ID = rr.ID
+	ur.Upstream.SessionID = usr.Claims.ID
+	ur.Upstream.Method = "oauth2"
+	ur.Upstream.Realm = session.Realm
+	ur.Session.RefreshToken = session.RefreshToken
+	if err := provider.Request(operator.RefreshSession, ur); err != nil {
+		p.upstreamSessions.delete(usr.Claims.ID)
+		return nil, err
+	}
+	if ur.Session.RefreshToken != session.RefreshToken {
+		if err := p.upstreamSessions.update(usr.Claims.ID, ur.Session.RefreshToken); err != nil {
+			return nil, err
+		}
+	}
+
+	m, ok := ur.Response.Payload.(map[string]interface{})
+	if !ok {
+		return nil, errors.ErrIdentityProviderOauthResponseProcessingFailed
+	}
+	combineGroupRoles(m)
+	claims := usr.AsMap()
+	for _, k := range []string{"jti", "origin", "iss", "addr"} {
+		if v, exists := claims[k]; exists {
+			m[k] = v
+		}
+	}
+	if err := p.transformUser(ctx, ur, m); err != nil {
+		return nil, err
+	}
+	injectPortalRoles(m, p.config)
+
+	nusr, err := user.NewUser(m)
+	if err != nil {
+		return nil, err
+	}
+	nusr.Authenticator = usr.Authenticator
+
+	p.logger.Debug(
+		"refreshed user with identity provider",
+		zap.String("session_id", rr.Upstream.SessionID),
+		zap.String("request_id", rr.ID),
+		zap.String("realm", session.Realm),
+		zap.Any("user", m),
+	)
+	return nusr, nil
+}
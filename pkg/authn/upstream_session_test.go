@@ -0,0 +1,86 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authn
+
+import (
+	"testing"
+	"time"
+
+	"github.com/greenpau/go-authcrunch/internal/tests"
+	"github.com/greenpau/go-authcrunch/pkg/kvstore"
+)
+
+func TestUpstreamSessionStore(t *testing.T) {
+	s := newUpstreamSessionStore(time.Hour)
+	s.add("a1b2c3", "contoso", "foo")
+	s.update("a1b2c3", "bar")
+	session, found := s.get("a1b2c3")
+	_, unknownFound := s.get("d4e5f6")
+
+	got := map[string]interface{}{
+		"found":         found,
+		"realm":         session.Realm,
+		"refresh_token": session.RefreshToken,
+		"unknown_found": unknownFound,
+	}
+	want := map[string]interface{}{
+		"found":         true,
+		"realm":         "contoso",
+		"refresh_token": "bar",
+		"unknown_found": false,
+	}
+	tests.EvalObjectsWithLog(t, "active session", want, got, []string{})
+
+	s.delete("a1b2c3")
+	_, found = s.get("a1b2c3")
+	expired := newUpstreamSessionStore(-1 * time.Second)
+	expired.add("a1b2c3", "contoso", "foo")
+	_, expiredFound := expired.get("a1b2c3")
+
+	got = map[string]interface{}{
+		"deleted_found": found,
+		"expired_found": expiredFound,
+	}
+	want = map[string]interface{}{
+		"deleted_found": false,
+		"expired_found": false,
+	}
+	tests.EvalObjectsWithLog(t, "inactive session", want, got, []string{})
+}
+
+func TestUpstreamSessionStoreShared(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+	s1 := newUpstreamSessionStore(time.Hour)
+	s1.SetStore(store)
+	s2 := newUpstreamSessionStore(time.Hour)
+	s2.SetStore(store)
+
+	if err := s1.add("a1b2c3", "contoso", "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s2.update("a1b2c3", "bar"); err != nil {
+		t.Fatal(err)
+	}
+	session, found := s1.get("a1b2c3")
+	got := map[string]interface{}{
+		"found":         found,
+		"refresh_token": session.RefreshToken,
+	}
+	want := map[string]interface{}{
+		"found":         true,
+		"refresh_token": "bar",
+	}
+	tests.EvalObjectsWithLog(t, "shared session", want, got, []string{})
+}
@@ -111,6 +111,15 @@ func (g *Gatekeeper) handleUnauthorizedUser(w http.ResponseWriter, r *http.Reque
 
 	switch {
 	case (err == errors.ErrAccessNotAllowed) || (err == errors.ErrAccessNotAllowedByPathACL):
+		if ar.Response.Reason != "" {
+			g.logger.Info(
+				"access denied",
+				zap.String("session_id", ar.SessionID),
+				zap.String("request_id", ar.ID),
+				zap.String("reason", ar.Response.Reason),
+				zap.Any("user", ar.Response.User),
+			)
+		}
 		return g.handleAuthorizeWithForbidden(w, r, ar)
 	case (err == errors.ErrBasicAuthFailed) || (err == errors.ErrAPIKeyAuthFailed):
 		return g.handleAuthorizeWithAuthFailed(w, r, ar)
@@ -59,6 +59,8 @@ type PolicyConfig struct {
 	ValidateAccessListPathClaim bool `json:"validate_access_list_path_claim,omitempty" xml:"validate_access_list_path_claim,omitempty" yaml:"validate_access_list_path_claim,omitempty"`
 	// Validate source address matches between HTTP request and JWT token.
 	ValidateSourceAddress bool `json:"validate_source_address,omitempty" xml:"validate_source_address,omitempty" yaml:"validate_source_address,omitempty"`
+	// The audiences accepted in the aud claim of JWT token.
+	AllowedAudiences []string `json:"allowed_audiences,omitempty" xml:"allowed_audiences,omitempty" yaml:"allowed_audiences,omitempty"`
 	// Pass claims from JWT token via HTTP X- headers.
 	PassClaimsWithHeaders bool `json:"pass_claims_with_headers,omitempty" xml:"pass_claims_with_headers,omitempty" yaml:"pass_claims_with_headers,omitempty"`
 	// Validate the login hint which can be passed to the auth provider
@@ -22,6 +22,7 @@ import (
 	"github.com/greenpau/go-authcrunch/pkg/authz/validator"
 	"github.com/greenpau/go-authcrunch/pkg/errors"
 	"github.com/greenpau/go-authcrunch/pkg/kms"
+	"github.com/greenpau/go-authcrunch/pkg/revocation"
 
 	"github.com/google/uuid"
 	"go.uber.org/zap"
@@ -96,11 +97,16 @@ func (g *Gatekeeper) configure() error {
 	if g.config.ValidateSourceAddress {
 		g.opts.ValidateSourceAddress = true
 	}
+	g.opts.AllowedAudiences = g.config.AllowedAudiences
 
 	// Load token configuration into key managers, extract token verification
 	// keys and add them to token validator.
 	ks := kms.NewCryptoKeyStore()
+	ks.SetLogger(g.logger)
 	if g.config.CryptoKeyStoreConfig != nil {
+		if _, exists := g.config.CryptoKeyStoreConfig["key_rotation_interval"]; exists {
+			return errors.ErrInvalidConfiguration.WithArgs(g.config.Name, "key rotation is supported by authentication portals only")
+		}
 		// Add default token name, lifetime, etc.
 		if err := ks.AddDefaults(g.config.CryptoKeyStoreConfig); err != nil {
 			return errors.ErrInvalidConfiguration.WithArgs(g.config.Name, err)
@@ -134,6 +140,21 @@ func (g *Gatekeeper) configure() error {
 		return errors.ErrInvalidConfiguration.WithArgs(g.config.Name, err)
 	}
 
+	// Keep the validator keys in sync with the keys shared via keyring.
+	ks.SetKeyRotationHandler(func(keys []*kms.CryptoKey) {
+		if err := g.tokenValidator.UpdateKeys(ctx, keys); err != nil {
+			g.logger.Warn(
+				"failed updating validator keys",
+				zap.String("gatekeeper_name", g.config.Name),
+				zap.String("gatekeeper_id", g.id),
+				zap.Error(err),
+			)
+		}
+	})
+	if err := ks.StartKeyringSync(); err != nil {
+		return errors.ErrInvalidConfiguration.WithArgs(g.config.Name, err)
+	}
+
 	// Set allow token sources and their priority.
 	if len(g.config.AllowedTokenSources) > 0 {
 		if err := g.tokenValidator.SetSourcePriority(g.config.AllowedTokenSources); err != nil {
@@ -164,3 +185,9 @@ func (g *Gatekeeper) AddAuthenticators(authenticators []authproxy.Authenticator)
 	}
 	return nil
 }
+
+// SetRevocationList sets the deny list of revoked tokens shared with the
+// authentication portals.
+func (g *Gatekeeper) SetRevocationList(l *revocation.List) {
+	g.tokenValidator.SetRevocationList(l)
+}
@@ -20,6 +20,9 @@ type TokenValidatorOptions struct {
 	ValidateBearerHeader        bool `json:"validate_bearer_header,omitempty" xml:"validate_bearer_header,omitempty" yaml:"validate_bearer_header,omitempty"`
 	ValidateMethodPath          bool `json:"validate_method_path,omitempty" xml:"validate_method_path,omitempty" yaml:"validate_method_path,omitempty"`
 	ValidateAccessListPathClaim bool `json:"validate_access_list_path_claim,omitempty" xml:"validate_access_list_path_claim,omitempty" yaml:"validate_access_list_path_claim,omitempty"`
+	// AllowedAudiences holds the audiences accepted in the aud claim of the
+	// tokens. When set, the tokens without an allowed audience are rejected.
+	AllowedAudiences []string `json:"allowed_audiences,omitempty" xml:"allowed_audiences,omitempty" yaml:"allowed_audiences,omitempty"`
 }
 
 // TokenGrantorOptions provides options for TokenGrantor.
@@ -0,0 +1,190 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authz
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/greenpau/go-authcrunch/pkg/acl"
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/user"
+	fileutil "github.com/greenpau/go-authcrunch/pkg/util/file"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// PolicyTestSuite is a collection of tests of the access list rules of a
+// policy, i.e. the claims and the expected verdicts.
+type PolicyTestSuite struct {
+	Tests []*PolicyTest `json:"tests,omitempty" xml:"tests,omitempty" yaml:"tests,omitempty"`
+}
+
+// PolicyTest is a test of the access list decision.
+type PolicyTest struct {
+	Name   string                 `json:"name,omitempty" xml:"name,omitempty" yaml:"name,omitempty"`
+	Claims map[string]interface{} `json:"claims,omitempty" xml:"claims,omitempty" yaml:"claims,omitempty"`
+	// Request is the HTTP request authorized by the policy. The default
+	// request is GET /.
+	Request *PolicyTestRequest `json:"request,omitempty" xml:"request,omitempty" yaml:"request,omitempty"`
+	// Expect is the expected verdict, i.e. allow or deny.
+	Expect string `json:"expect,omitempty" xml:"expect,omitempty" yaml:"expect,omitempty"`
+}
+
+// PolicyTestRequest is the HTTP request of a policy test.
+type PolicyTestRequest struct {
+	Method string `json:"method,omitempty" xml:"method,omitempty" yaml:"method,omitempty"`
+	// URL is the path, with optional query, or the absolute URL of the request.
+	URL     string            `json:"url,omitempty" xml:"url,omitempty" yaml:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty" xml:"headers,omitempty" yaml:"headers,omitempty"`
+	// SourceAddress is the IP address of the client.
+	SourceAddress string `json:"source_address,omitempty" xml:"source_address,omitempty" yaml:"source_address,omitempty"`
+}
+
+// PolicyTestResult is the result of a policy test.
+type PolicyTestResult struct {
+	Name        string           `json:"name,omitempty" xml:"name,omitempty" yaml:"name,omitempty"`
+	Expected    string           `json:"expected,omitempty" xml:"expected,omitempty" yaml:"expected,omitempty"`
+	Actual      string           `json:"actual,omitempty" xml:"actual,omitempty" yaml:"actual,omitempty"`
+	Passed      bool             `json:"passed,omitempty" xml:"passed,omitempty" yaml:"passed,omitempty"`
+	Explanation *acl.Explanation `json:"explanation,omitempty" xml:"explanation,omitempty" yaml:"explanation,omitempty"`
+}
+
+// LoadPolicyTestSuite loads policy test suite from a YAML or JSON file.
+func LoadPolicyTestSuite(fp string) (*PolicyTestSuite, error) {
+	b, err := fileutil.ReadFileBytes(fp)
+	if err != nil {
+		return nil, errors.ErrPolicyTestSuiteLoad.WithArgs(fp, err)
+	}
+	return ParsePolicyTestSuite(b)
+}
+
+// ParsePolicyTestSuite parses policy test suite in YAML or JSON format.
+func ParsePolicyTestSuite(b []byte) (*PolicyTestSuite, error) {
+	suite := &PolicyTestSuite{}
+	if err := yaml.Unmarshal(b, suite); err != nil {
+		return nil, errors.ErrPolicyTestSuiteParse.WithArgs(err)
+	}
+	if err := suite.Validate(); err != nil {
+		return nil, err
+	}
+	return suite, nil
+}
+
+// Validate validates policy test suite.
+func (suite *PolicyTestSuite) Validate() error {
+	if len(suite.Tests) == 0 {
+		return errors.ErrPolicyTestSuiteEmpty
+	}
+	for i, tc := range suite.Tests {
+		if tc.Name == "" {
+			return errors.ErrPolicyTestNameEmpty.WithArgs(i)
+		}
+		tc.Expect = strings.ToLower(strings.TrimSpace(tc.Expect))
+		switch tc.Expect {
+		case "allow", "deny":
+		default:
+			return errors.ErrPolicyTestExpectUnsupported.WithArgs(tc.Name, tc.Expect)
+		}
+	}
+	return nil
+}
+
+// RunPolicyTests evaluates the access list rules of the policy against the
+// tests in the suite. The access list input is built from the claims and
+// the request the same way the gatekeeper builds it.
+func (cfg *PolicyConfig) RunPolicyTests(ctx context.Context, suite *PolicyTestSuite) ([]*PolicyTestResult, error) {
+	if len(cfg.AccessListRules) == 0 {
+		return nil, errors.ErrPolicyTestAccessListNotFound.WithArgs(cfg.Name)
+	}
+	if err := suite.Validate(); err != nil {
+		return nil, err
+	}
+	accessList := acl.NewAccessList()
+	accessList.SetLogger(zap.NewNop())
+	if err := accessList.AddRules(ctx, cfg.AccessListRules); err != nil {
+		return nil, errors.ErrPolicyTestAccessListRules.WithArgs(cfg.Name, err)
+	}
+
+	var results []*PolicyTestResult
+	for _, tc := range suite.Tests {
+		usr, err := user.NewUser(tc.Claims)
+		if err != nil {
+			return nil, errors.ErrPolicyTestClaimsInvalid.WithArgs(tc.Name, err)
+		}
+		r, err := tc.Request.newHTTPRequest()
+		if err != nil {
+			return nil, errors.ErrPolicyTestRequestInvalid.WithArgs(tc.Name, err)
+		}
+		data := usr.GetData()
+		if cfg.ValidateMethodPath {
+			kv := make(map[string]interface{})
+			for k, v := range data {
+				kv[k] = v
+			}
+			kv["method"] = r.Method
+			kv["path"] = r.URL.Path
+			data = kv
+		}
+		result := &PolicyTestResult{
+			Name:        tc.Name,
+			Expected:    tc.Expect,
+			Explanation: accessList.Explain(ctx, accessList.WithRequestData(data, r)),
+		}
+		result.Actual = "deny"
+		if result.Explanation.Allow {
+			result.Actual = "allow"
+		}
+		result.Passed = result.Actual == result.Expected
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func (tr *PolicyTestRequest) newHTTPRequest() (*http.Request, error) {
+	method := http.MethodGet
+	s := "/"
+	if tr != nil {
+		if tr.Method != "" {
+			method = strings.ToUpper(tr.Method)
+		}
+		if tr.URL != "" {
+			s = tr.URL
+		}
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	r := &http.Request{
+		Method:     method,
+		URL:        u,
+		Host:       u.Host,
+		Header:     make(http.Header),
+		RemoteAddr: "127.0.0.1:0",
+	}
+	if tr == nil {
+		return r, nil
+	}
+	for k, v := range tr.Headers {
+		r.Header.Set(k, v)
+	}
+	if tr.SourceAddress != "" {
+		r.RemoteAddr = tr.SourceAddress
+	}
+	return r, nil
+}
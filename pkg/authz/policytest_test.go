@@ -0,0 +1,136 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authz
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/greenpau/go-authcrunch/internal/tests"
+	"github.com/greenpau/go-authcrunch/pkg/acl"
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+	fileutil "github.com/greenpau/go-authcrunch/pkg/util/file"
+	"gopkg.in/yaml.v3"
+)
+
+func TestRunPolicyTests(t *testing.T) {
+	b, err := fileutil.ReadFileBytes("../../testdata/policy/policy.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := &PolicyConfig{}
+	if err := yaml.Unmarshal(b, policy); err != nil {
+		t.Fatal(err)
+	}
+
+	var testcases = []struct {
+		name      string
+		path      string
+		suite     string
+		want      map[string]interface{}
+		shouldErr bool
+		err       error
+	}{
+		{
+			name: "run policy tests from file",
+			path: "../../testdata/policy/tests.yaml",
+			want: map[string]interface{}{
+				"editor changes docs from office network": "allow/allow allowed by rule1",
+				"editor changes docs from home":           "deny/deny default deny",
+				"viewer reads docs":                       "allow/allow allowed by rule2",
+				"contractor reads docs":                   "deny/deny denied by rule0",
+			},
+		},
+		{
+			name: "run failing policy test",
+			suite: `
+tests:
+  - name: viewer changes docs
+    claims: {"sub": "jdoe", "roles": ["viewer"]}
+    request: {"method": "POST", "url": "/api/docs/1"}
+    expect: allow
+`,
+			want: map[string]interface{}{
+				"viewer changes docs": "allow/deny default deny",
+			},
+		},
+		{
+			name:      "policy test with unsupported verdict",
+			suite:     `{"tests": [{"name": "foo", "expect": "maybe"}]}`,
+			shouldErr: true,
+			err:       errors.ErrPolicyTestExpectUnsupported.WithArgs("foo", "maybe"),
+		},
+		{
+			name:      "policy test without name",
+			suite:     `{"tests": [{"expect": "allow"}]}`,
+			shouldErr: true,
+			err:       errors.ErrPolicyTestNameEmpty.WithArgs(0),
+		},
+		{
+			name:      "policy test suite without tests",
+			suite:     `tests: []`,
+			shouldErr: true,
+			err:       errors.ErrPolicyTestSuiteEmpty,
+		},
+		{
+			name:      "policy test with invalid claims",
+			suite:     `{"tests": [{"name": "foo", "claims": {"exp": "foo"}, "expect": "allow"}]}`,
+			shouldErr: true,
+			err:       errors.ErrPolicyTestClaimsInvalid.WithArgs("foo", errors.ErrInvalidClaimExpiresAt.WithArgs("foo")),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			var suite *PolicyTestSuite
+			var err error
+			if tc.path != "" {
+				suite, err = LoadPolicyTestSuite(tc.path)
+			} else {
+				suite, err = ParsePolicyTestSuite([]byte(tc.suite))
+			}
+			if err == nil {
+				var results []*PolicyTestResult
+				results, err = policy.RunPolicyTests(context.Background(), suite)
+				if err == nil {
+					got := make(map[string]interface{})
+					for _, result := range results {
+						got[result.Name] = fmt.Sprintf("%s/%s %s", result.Expected, result.Actual, result.Explanation.Reason)
+						if result.Passed != (result.Expected == result.Actual) {
+							t.Fatalf("unexpected result %v", result)
+						}
+					}
+					tests.EvalObjectsWithLog(t, "results", tc.want, got, msgs)
+				}
+			}
+			tests.EvalErrWithLog(t, err, "policy tests", tc.shouldErr, tc.err, msgs)
+		})
+	}
+}
+
+func TestRunPolicyTestsWithoutRules(t *testing.T) {
+	policy := &PolicyConfig{Name: "mypolicy"}
+	_, err := policy.RunPolicyTests(context.Background(), &PolicyTestSuite{})
+	tests.EvalErrWithLog(t, err, "policy tests", true, errors.ErrPolicyTestAccessListNotFound.WithArgs("mypolicy"), []string{})
+
+	policy.AccessListRules = []*acl.RuleConfiguration{{Conditions: []string{"foo"}, Action: "allow"}}
+	_, err = policy.RunPolicyTests(context.Background(), &PolicyTestSuite{
+		Tests: []*PolicyTest{{Name: "foo", Expect: "allow"}},
+	})
+	if err == nil {
+		t.Fatalf("expected error for invalid rules")
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/greenpau/go-authcrunch/internal/tests"
+	"github.com/greenpau/go-authcrunch/internal/testutils"
+	"github.com/greenpau/go-authcrunch/pkg/acl"
+	"github.com/greenpau/go-authcrunch/pkg/authz/options"
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/requests"
+)
+
+func TestAuthorizeWithRequestData(t *testing.T) {
+	rules := []*acl.RuleConfiguration{
+		{
+			Comment:    "deny debug requests",
+			Conditions: []string{"match request.query.debug yes"},
+			Action:     `deny stop`,
+		},
+		{
+			Comment: "guest may post docs from office network",
+			Conditions: []string{
+				"match role guest",
+				"match request.method POST",
+				"prefix match request.path /api/docs/",
+				"cidr match request.addr 10.0.0.0/8",
+			},
+			Action: `allow stop`,
+		},
+		{
+			Comment: "guest may read docs with api version 2",
+			Conditions: []string{
+				"match role guest",
+				"match request.method GET",
+				"match request.header.X-Api-Version 2",
+			},
+			Action: `allow stop`,
+		},
+	}
+
+	var testcases = []struct {
+		name       string
+		method     string
+		url        string
+		remoteAddr string
+		headers    map[string]string
+		shouldErr  bool
+		err        error
+		reason     string
+	}{
+		{
+			name:       "post docs from office network",
+			method:     "POST",
+			url:        "/api/docs/1",
+			remoteAddr: "10.1.2.3:52044",
+		},
+		{
+			name:       "post docs from outside of office network",
+			method:     "POST",
+			url:        "/api/docs/1",
+			remoteAddr: "192.168.1.1:52044",
+			shouldErr:  true,
+			err:        errors.ErrAccessNotAllowed,
+			reason:     "default deny",
+		},
+		{
+			name:       "post docs from outside of office network with forwarded headers",
+			method:     "POST",
+			url:        "/api/docs/1",
+			remoteAddr: "192.168.1.1:52044",
+			headers:    map[string]string{"X-Real-Ip": "10.1.2.3", "X-Forwarded-For": "10.1.2.3"},
+			shouldErr:  true,
+			err:        errors.ErrAccessNotAllowed,
+			reason:     "default deny",
+		},
+		{
+			name:       "post other path from office network",
+			method:     "POST",
+			url:        "/api/users/1",
+			remoteAddr: "10.1.2.3:52044",
+			shouldErr:  true,
+			err:        errors.ErrAccessNotAllowed,
+		},
+		{
+			name:    "get docs with api version header",
+			method:  "GET",
+			url:     "/api/docs/1",
+			headers: map[string]string{"x-api-version": "2"},
+		},
+		{
+			name:      "get docs with api version header and debug query parameter",
+			method:    "GET",
+			url:       "/api/docs/1?debug=yes",
+			headers:   map[string]string{"x-api-version": "2"},
+			shouldErr: true,
+			err:       errors.ErrAccessNotAllowed,
+			reason:    "denied by rule0",
+		},
+		{
+			name:      "get docs without api version header",
+			method:    "GET",
+			url:       "/api/docs/1",
+			shouldErr: true,
+			err:       errors.ErrAccessNotAllowed,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			accessList := acl.NewAccessList()
+			if err := accessList.AddRules(ctx, rules); err != nil {
+				t.Fatal(err)
+			}
+			ks := testutils.NewTestCryptoKeyStore()
+			keys := ks.GetKeys()
+			validator := NewTokenValidator()
+			if err := validator.Configure(ctx, keys, accessList, options.NewTokenValidatorOptions()); err != nil {
+				t.Fatal(err)
+			}
+
+			tkn := testutils.NewInjectedTestToken("access_token", tokenSourceCookie, "")
+			if err := keys[0].SignToken("HS512", tkn.User); err != nil {
+				t.Fatal(err)
+			}
+			req, err := http.NewRequest(tc.method, tc.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.remoteAddr != "" {
+				req.RemoteAddr = tc.remoteAddr
+			}
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			req.AddCookie(testutils.GetCookie("access_token", tkn.User.Token, 10))
+
+			ar := requests.NewAuthorizationRequest()
+			usr, err := validator.Authorize(ctx, req, ar)
+			if tests.EvalErrWithLog(t, err, "authorize", tc.shouldErr, tc.err, msgs) {
+				if tc.reason != "" {
+					tests.EvalObjectsWithLog(t, "reason", tc.reason, ar.Response.Reason, msgs)
+				}
+				return
+			}
+			got := map[string]interface{}{
+				"sub": usr.Claims.Subject,
+			}
+			want := map[string]interface{}{
+				"sub": "smithj@outlook.com",
+			}
+			tests.EvalObjectsWithLog(t, "authorize", want, got, msgs)
+		})
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/greenpau/go-authcrunch/internal/tests"
+	"github.com/greenpau/go-authcrunch/internal/testutils"
+	"github.com/greenpau/go-authcrunch/pkg/authz/options"
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/requests"
+	"github.com/greenpau/go-authcrunch/pkg/revocation"
+)
+
+func TestAuthorizeRevokedTokens(t *testing.T) {
+	now := time.Now()
+	var testcases = []struct {
+		name      string
+		claims    string
+		revoke    func(*revocation.List) error
+		shouldErr bool
+		err       error
+	}{
+		{
+			name:   "token without revocations",
+			claims: `"jti": "a1b2c3",`,
+			revoke: func(l *revocation.List) error {
+				return l.RevokeToken("d4e5f6", now.Add(time.Hour))
+			},
+		},
+		{
+			name:   "token revoked by id",
+			claims: `"jti": "a1b2c3",`,
+			revoke: func(l *revocation.List) error {
+				return l.RevokeToken("a1b2c3", now.Add(time.Hour))
+			},
+			shouldErr: true,
+			err:       errors.ErrTokenRevoked,
+		},
+		{
+			name:   "token revoked by subject",
+			claims: `"jti": "a1b2c3",`,
+			revoke: func(l *revocation.List) error {
+				return l.RevokeSubject("smithj@outlook.com", now, now.Add(time.Hour))
+			},
+			shouldErr: true,
+			err:       errors.ErrTokenRevoked,
+		},
+		{
+			name:   "token issued after subject revocation",
+			claims: `"jti": "a1b2c3",`,
+			revoke: func(l *revocation.List) error {
+				return l.RevokeSubject("smithj@outlook.com", now.Add(-time.Hour), now.Add(time.Hour))
+			},
+		},
+		{
+			name:   "token of another subject",
+			claims: `"jti": "a1b2c3",`,
+			revoke: func(l *revocation.List) error {
+				return l.RevokeSubject("jsmith@outlook.com", now, now.Add(time.Hour))
+			},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			ks := testutils.NewTestCryptoKeyStore()
+			keys := ks.GetKeys()
+			validator := NewTokenValidator()
+			if err := validator.Configure(ctx, keys, testutils.NewTestGuestAccessList(), options.NewTokenValidatorOptions()); err != nil {
+				t.Fatal(err)
+			}
+			revocationList, err := revocation.NewList(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			validator.SetRevocationList(revocationList)
+
+			tkn := testutils.NewInjectedTestToken("access_token", tokenSourceCookie, tc.claims)
+			if err := keys[0].SignToken("HS512", tkn.User); err != nil {
+				t.Fatal(err)
+			}
+			req, err := http.NewRequest("GET", "/protected/path", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.AddCookie(testutils.GetCookie("access_token", tkn.User.Token, 10))
+
+			// The token is valid and cached prior to the revocation.
+			usr, err := validator.Authorize(ctx, req, requests.NewAuthorizationRequest())
+			if err != nil {
+				t.Fatalf("unexpected error prior to revocation: %v", err)
+			}
+			if err := validator.CacheUser(usr); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := tc.revoke(revocationList); err != nil {
+				t.Fatal(err)
+			}
+			usr, err = validator.Authorize(ctx, req, requests.NewAuthorizationRequest())
+			if tests.EvalErrWithLog(t, err, "authorize", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			got := map[string]interface{}{
+				"sub": usr.Claims.Subject,
+			}
+			want := map[string]interface{}{
+				"sub": "smithj@outlook.com",
+			}
+			tests.EvalObjectsWithLog(t, "authorize", want, got, msgs)
+		})
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/greenpau/go-authcrunch/pkg/requests"
 	"github.com/greenpau/go-authcrunch/pkg/user"
 	"net/http"
+	"slices"
 	"strings"
 )
 
@@ -178,6 +179,14 @@ func (v *TokenValidator) Authorize(ctx context.Context, r *http.Request, ar *req
 		return nil, errors.ErrNoTokenFound
 	}
 
+	// Reject revoked tokens, including the ones found in the cache.
+	if v.revocationList != nil {
+		if err := v.revocationList.CheckToken(ar.Token.Payload); err != nil {
+			v.cache.Delete(ar.Token.Payload)
+			return nil, err
+		}
+	}
+
 	// Perform cache lookup for the previously obtained credentials.
 	usr = v.cache.Get(ar.Token.Payload)
 	if usr == nil {
@@ -188,7 +197,11 @@ func (v *TokenValidator) Authorize(ctx context.Context, r *http.Request, ar *req
 		}
 	}
 
-	if err := v.guardian.authorize(ctx, r, usr); err != nil {
+	if err := v.checkAudience(usr); err != nil {
+		return nil, err
+	}
+
+	if err := v.guardian.authorize(ctx, r, ar, usr); err != nil {
 		ar.Response.User = make(map[string]interface{})
 		if usr.Claims.ID != "" {
 			ar.Response.User["jti"] = usr.Claims.ID
@@ -209,3 +222,17 @@ func (v *TokenValidator) Authorize(ctx context.Context, r *http.Request, ar *req
 	usr.Token = ar.Token.Payload
 	return usr, nil
 }
+
+// checkAudience rejects the tokens issued for other audiences, e.g. the ID
+// tokens issued to OpenID Connect clients.
+func (v *TokenValidator) checkAudience(usr *user.User) error {
+	if v.opts == nil || len(v.opts.AllowedAudiences) == 0 {
+		return nil
+	}
+	for _, aud := range usr.Claims.Audience {
+		if slices.Contains(v.opts.AllowedAudiences, aud) {
+			return nil
+		}
+	}
+	return errors.ErrValidatorAudienceNotAllowed.WithArgs(usr.Claims.Audience)
+}
@@ -16,6 +16,7 @@ package validator
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -26,7 +27,9 @@ import (
 	"github.com/greenpau/go-authcrunch/internal/testutils"
 	"github.com/greenpau/go-authcrunch/pkg/authz/options"
 	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/kms"
 	"github.com/greenpau/go-authcrunch/pkg/requests"
+	"github.com/greenpau/go-authcrunch/pkg/user"
 )
 
 func TestAuthorizationSources(t *testing.T) {
@@ -281,3 +284,156 @@ func TestAuthorizationSources(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthorizeAudiences(t *testing.T) {
+	var testcases = []struct {
+		name      string
+		claims    string
+		audiences []string
+		shouldErr bool
+		err       error
+	}{
+		{
+			name:   "token without audience and without allowed audiences",
+			claims: `"jti": "a1b2c3",`,
+		},
+		{
+			name:   "token with audience and without allowed audiences",
+			claims: `"aud": "grafana",`,
+		},
+		{
+			name:      "token with allowed audience",
+			claims:    `"aud": ["webapp", "grafana"],`,
+			audiences: []string{"grafana"},
+		},
+		{
+			name:      "token with audience not allowed",
+			claims:    `"aud": "webapp",`,
+			audiences: []string{"grafana"},
+			shouldErr: true,
+			err:       errors.ErrValidatorAudienceNotAllowed.WithArgs([]string{"webapp"}),
+		},
+		{
+			name:      "token without audience and with allowed audiences",
+			claims:    `"jti": "a1b2c3",`,
+			audiences: []string{"grafana"},
+			shouldErr: true,
+			err:       errors.ErrValidatorAudienceNotAllowed.WithArgs([]string(nil)),
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			ks := testutils.NewTestCryptoKeyStore()
+			keys := ks.GetKeys()
+			opts := options.NewTokenValidatorOptions()
+			opts.AllowedAudiences = tc.audiences
+			validator := NewTokenValidator()
+			if err := validator.Configure(ctx, keys, testutils.NewTestGuestAccessList(), opts); err != nil {
+				t.Fatal(err)
+			}
+
+			tkn := testutils.NewInjectedTestToken("access_token", tokenSourceCookie, tc.claims)
+			if err := keys[0].SignToken("HS512", tkn.User); err != nil {
+				t.Fatal(err)
+			}
+			req, err := http.NewRequest("GET", "/protected/path", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.AddCookie(testutils.GetCookie("access_token", tkn.User.Token, 10))
+
+			usr, err := validator.Authorize(ctx, req, requests.NewAuthorizationRequest())
+			if tests.EvalErrWithLog(t, err, "authorize", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			tests.EvalObjectsWithLog(t, "authorize", "smithj@outlook.com", usr.Claims.Subject, msgs)
+		})
+	}
+}
+
+func TestAuthorizeIDToken(t *testing.T) {
+	portalKeyStore := kms.NewCryptoKeyStore()
+	if err := portalKeyStore.AutoGenerate("default", "ES512"); err != nil {
+		t.Fatal(err)
+	}
+	if err := portalKeyStore.GenerateKey(kms.IDTokenName, "ES512"); err != nil {
+		t.Fatal(err)
+	}
+	// The gatekeeper trusts the key set published by the portal, including
+	// the key signing the ID tokens.
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(portalKeyStore.GetJwksKeySet())
+	}))
+	defer ts.Close()
+
+	claims := map[string]interface{}{
+		"sub":   "jsmith",
+		"roles": []string{"guest"},
+		"exp":   time.Now().Add(10 * time.Minute).Unix(),
+	}
+	usr, err := user.NewUser(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := portalKeyStore.SignToken(nil, nil, usr); err != nil {
+		t.Fatal(err)
+	}
+	claims["aud"] = "grafana"
+	idToken, err := portalKeyStore.SignClaims(kms.IDTokenName, nil, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var testcases = []struct {
+		name      string
+		token     string
+		shouldErr bool
+		err       error
+	}{
+		{
+			name:  "access token",
+			token: usr.Token,
+		},
+		{
+			name:      "id token",
+			token:     idToken,
+			shouldErr: true,
+			err:       errors.ErrCryptoKeyStoreParseTokenIDToken,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			configs, err := kms.ParseCryptoKeyConfigs("crypto key verify from jwks " + ts.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ks := kms.NewCryptoKeyStore()
+			if err := ks.AddKeysWithConfigs(configs); err != nil {
+				t.Fatal(err)
+			}
+			validator := NewTokenValidator()
+			if err := validator.Configure(ctx, ks.GetKeys(), testutils.NewTestGuestAccessList(), options.NewTokenValidatorOptions()); err != nil {
+				t.Fatal(err)
+			}
+
+			req, err := http.NewRequest("GET", "/protected/path", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.AddCookie(testutils.GetCookie("access_token", tc.token, 10))
+
+			authUser, err := validator.Authorize(ctx, req, requests.NewAuthorizationRequest())
+			if tests.EvalErrWithLog(t, err, "authorize", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			tests.EvalObjectsWithLog(t, "authorize", "jsmith", authUser.Claims.Subject, msgs)
+		})
+	}
+}
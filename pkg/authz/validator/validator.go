@@ -25,12 +25,14 @@ import (
 	"github.com/greenpau/go-authcrunch/pkg/authz/options"
 	"github.com/greenpau/go-authcrunch/pkg/errors"
 	"github.com/greenpau/go-authcrunch/pkg/kms"
+	"github.com/greenpau/go-authcrunch/pkg/requests"
+	"github.com/greenpau/go-authcrunch/pkg/revocation"
 	"github.com/greenpau/go-authcrunch/pkg/user"
 	addrutil "github.com/greenpau/go-authcrunch/pkg/util/addr"
 )
 
 type guardian interface {
-	authorize(context.Context, *http.Request, *user.User) error
+	authorize(context.Context, *http.Request, *requests.AuthorizationRequest, *user.User) error
 }
 
 type guardianBase struct {
@@ -72,6 +74,7 @@ type TokenValidator struct {
 	authCookies       map[string]interface{}
 	authQueryParams   map[string]interface{}
 	cache             *cache.TokenCache
+	revocationList    *revocation.List
 	accessList        *acl.AccessList
 	guardian          guardian
 	tokenSources      []string
@@ -156,22 +159,33 @@ func (v *TokenValidator) GetSourcePriority() []string {
 	return v.tokenSources
 }
 
-func (g *guardianBase) authorize(ctx context.Context, r *http.Request, usr *user.User) error {
+// checkAccessList evaluates the input data against the access list. When
+// the access is denied, the reason of the decision is added to the response
+// to the authorization request.
+func checkAccessList(ctx context.Context, accessList *acl.AccessList, ar *requests.AuthorizationRequest, data map[string]interface{}) error {
+	if accessList.Allow(ctx, data) {
+		return nil
+	}
+	ar.Response.Reason = accessList.Explain(ctx, data).Reason
+	return errors.ErrAccessNotAllowed
+}
+
+func (g *guardianBase) authorize(ctx context.Context, r *http.Request, ar *requests.AuthorizationRequest, usr *user.User) error {
 	// Note: the cache was removed because authorize uses the same
 	// authorization endpoint. Previously, the endpoint was
 	// attached to a route.
 	// if usr.Cached {
 	//	return nil
 	// }
-	if userAllowed := g.accessList.Allow(ctx, usr.GetData()); !userAllowed {
-		return errors.ErrAccessNotAllowed
+	if err := checkAccessList(ctx, g.accessList, ar, g.accessList.WithRequestData(usr.GetData(), r)); err != nil {
+		return err
 	}
 	return nil
 }
 
-func (g *guardianWithSrcAddr) authorize(ctx context.Context, r *http.Request, usr *user.User) error {
-	if userAllowed := g.accessList.Allow(ctx, usr.GetData()); !userAllowed {
-		return errors.ErrAccessNotAllowed
+func (g *guardianWithSrcAddr) authorize(ctx context.Context, r *http.Request, ar *requests.AuthorizationRequest, usr *user.User) error {
+	if err := checkAccessList(ctx, g.accessList, ar, g.accessList.WithRequestData(usr.GetData(), r)); err != nil {
+		return err
 	}
 	if usr.Claims.Address == "" {
 		return errors.ErrSourceAddressNotFound
@@ -183,9 +197,9 @@ func (g *guardianWithSrcAddr) authorize(ctx context.Context, r *http.Request, us
 	return nil
 }
 
-func (g *guardianWithPathClaim) authorize(ctx context.Context, r *http.Request, usr *user.User) error {
-	if userAllowed := g.accessList.Allow(ctx, usr.GetData()); !userAllowed {
-		return errors.ErrAccessNotAllowed
+func (g *guardianWithPathClaim) authorize(ctx context.Context, r *http.Request, ar *requests.AuthorizationRequest, usr *user.User) error {
+	if err := checkAccessList(ctx, g.accessList, ar, g.accessList.WithRequestData(usr.GetData(), r)); err != nil {
+		return err
 	}
 	if usr.Claims.AccessList == nil {
 		return errors.ErrAccessNotAllowedByPathACL
@@ -198,9 +212,9 @@ func (g *guardianWithPathClaim) authorize(ctx context.Context, r *http.Request,
 	return errors.ErrAccessNotAllowedByPathACL
 }
 
-func (g *guardianWithSrcAddrPathClaim) authorize(ctx context.Context, r *http.Request, usr *user.User) error {
-	if userAllowed := g.accessList.Allow(ctx, usr.GetData()); !userAllowed {
-		return errors.ErrAccessNotAllowed
+func (g *guardianWithSrcAddrPathClaim) authorize(ctx context.Context, r *http.Request, ar *requests.AuthorizationRequest, usr *user.User) error {
+	if err := checkAccessList(ctx, g.accessList, ar, g.accessList.WithRequestData(usr.GetData(), r)); err != nil {
+		return err
 	}
 	if usr.Claims.Address == "" {
 		return errors.ErrSourceAddressNotFound
@@ -220,28 +234,28 @@ func (g *guardianWithSrcAddrPathClaim) authorize(ctx context.Context, r *http.Re
 	return errors.ErrAccessNotAllowedByPathACL
 }
 
-func (g *guardianWithMethodPath) authorize(ctx context.Context, r *http.Request, usr *user.User) error {
+func (g *guardianWithMethodPath) authorize(ctx context.Context, r *http.Request, ar *requests.AuthorizationRequest, usr *user.User) error {
 	kv := make(map[string]interface{})
 	for k, v := range usr.GetData() {
 		kv[k] = v
 	}
 	kv["method"] = r.Method
 	kv["path"] = r.URL.Path
-	if userAllowed := g.accessList.Allow(ctx, kv); !userAllowed {
-		return errors.ErrAccessNotAllowed
+	if err := checkAccessList(ctx, g.accessList, ar, g.accessList.WithRequestData(kv, r)); err != nil {
+		return err
 	}
 	return nil
 }
 
-func (g *guardianWithMethodPathSrcAddr) authorize(ctx context.Context, r *http.Request, usr *user.User) error {
+func (g *guardianWithMethodPathSrcAddr) authorize(ctx context.Context, r *http.Request, ar *requests.AuthorizationRequest, usr *user.User) error {
 	kv := make(map[string]interface{})
 	for k, v := range usr.GetData() {
 		kv[k] = v
 	}
 	kv["method"] = r.Method
 	kv["path"] = r.URL.Path
-	if userAllowed := g.accessList.Allow(ctx, kv); !userAllowed {
-		return errors.ErrAccessNotAllowed
+	if err := checkAccessList(ctx, g.accessList, ar, g.accessList.WithRequestData(kv, r)); err != nil {
+		return err
 	}
 	if usr.Claims.Address == "" {
 		return errors.ErrSourceAddressNotFound
@@ -253,15 +267,15 @@ func (g *guardianWithMethodPathSrcAddr) authorize(ctx context.Context, r *http.R
 	return nil
 }
 
-func (g *guardianWithMethodPathPathClaim) authorize(ctx context.Context, r *http.Request, usr *user.User) error {
+func (g *guardianWithMethodPathPathClaim) authorize(ctx context.Context, r *http.Request, ar *requests.AuthorizationRequest, usr *user.User) error {
 	kv := make(map[string]interface{})
 	for k, v := range usr.GetData() {
 		kv[k] = v
 	}
 	kv["method"] = r.Method
 	kv["path"] = r.URL.Path
-	if userAllowed := g.accessList.Allow(ctx, kv); !userAllowed {
-		return errors.ErrAccessNotAllowed
+	if err := checkAccessList(ctx, g.accessList, ar, g.accessList.WithRequestData(kv, r)); err != nil {
+		return err
 	}
 	if usr.Claims.AccessList == nil {
 		return errors.ErrAccessNotAllowedByPathACL
@@ -274,15 +288,15 @@ func (g *guardianWithMethodPathPathClaim) authorize(ctx context.Context, r *http
 	return errors.ErrAccessNotAllowedByPathACL
 }
 
-func (g *guardianWithMethodPathSrcAddrPathClaim) authorize(ctx context.Context, r *http.Request, usr *user.User) error {
+func (g *guardianWithMethodPathSrcAddrPathClaim) authorize(ctx context.Context, r *http.Request, ar *requests.AuthorizationRequest, usr *user.User) error {
 	kv := make(map[string]interface{})
 	for k, v := range usr.GetData() {
 		kv[k] = v
 	}
 	kv["method"] = r.Method
 	kv["path"] = r.URL.Path
-	if userAllowed := g.accessList.Allow(ctx, kv); !userAllowed {
-		return errors.ErrAccessNotAllowed
+	if err := checkAccessList(ctx, g.accessList, ar, g.accessList.WithRequestData(kv, r)); err != nil {
+		return err
 	}
 	if usr.Claims.Address == "" {
 		return errors.ErrSourceAddressNotFound
@@ -374,6 +388,9 @@ func (v *TokenValidator) addKeys(ctx context.Context, keys []*kms.CryptoKey) err
 		if k.Verify.Token.MaxLifetime == 0 {
 			continue
 		}
+		if k.Verify.Token.Name == kms.IDTokenName {
+			continue
+		}
 		v.keystore.AddKey(k)
 		tokenMap[k.Verify.Token.Name] = true
 	}
@@ -392,6 +409,37 @@ func (v *TokenValidator) addKeys(ctx context.Context, keys []*kms.CryptoKey) err
 	return nil
 }
 
+// UpdateKeys replaces the keys for the verification of tokens, e.g. after
+// a key rotation.
+func (v *TokenValidator) UpdateKeys(ctx context.Context, keys []*kms.CryptoKey) error {
+	var verifyKeys []*kms.CryptoKey
+	for _, k := range keys {
+		if !k.Verify.Token.Capable {
+			continue
+		}
+		if k.Verify.Token.Name == "" {
+			continue
+		}
+		if k.Verify.Token.MaxLifetime == 0 {
+			continue
+		}
+		if k.Verify.Token.Name == kms.IDTokenName {
+			continue
+		}
+		verifyKeys = append(verifyKeys, k)
+	}
+	if len(verifyKeys) == 0 {
+		return errors.ErrValidatorCryptoKeyStoreNoVerifyKeys
+	}
+	return v.keystore.ReplaceKeys(verifyKeys)
+}
+
+// SetRevocationList sets the deny list of revoked tokens. The tokens are
+// checked against the list before the cache lookup and the verification.
+func (v *TokenValidator) SetRevocationList(l *revocation.List) {
+	v.revocationList = l
+}
+
 // CacheUser adds a user to token validator cache.
 func (v *TokenValidator) CacheUser(usr *user.User) error {
 	return v.cache.Add(usr)
@@ -26,6 +26,11 @@ const (
 	ErrACLRuleConditionSyntaxUnsupported        StandardError = "invalid condition syntax, failed creating rule condition: %v"
 	ErrACLRuleConditionSyntaxStrategyNotFound   StandardError = "invalid condition syntax, matcher strategy not found: %v"
 	ErrACLRuleConditionSyntaxReservedWordUsage  StandardError = "invalid condition syntax, found reserved keyword %q: %v"
+	ErrACLRuleConditionSyntaxSingleValue        StandardError = "invalid condition syntax, matcher accepts a single value: %v"
+	ErrACLRuleConditionSyntaxInvalidNetwork     StandardError = "invalid condition syntax, invalid network %q: %v"
+	ErrACLRuleConditionSyntaxInvalidTimeWindow  StandardError = "invalid condition syntax, invalid time window %q: %v"
+	ErrACLRuleConditionSyntaxInvalidDuration    StandardError = "invalid condition syntax, invalid duration %q: %v"
+	ErrACLRuleConditionSyntaxInvalidNumber      StandardError = "invalid condition syntax, invalid number %q: %v"
 
 	ErrACLRuleSyntaxExtractCondToken   StandardError = "invalid rule syntax, failed to extract condition tokens: %v"
 	ErrACLRuleSyntaxDuplicateField     StandardError = "invalid rule syntax, duplicate field: %s"
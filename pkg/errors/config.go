@@ -24,5 +24,6 @@ const (
 	ErrConfigDirectiveFail             StandardError = "the %q directive with value of %q failed: %v"
 	ErrPortalConfigBackendsNotFound    StandardError = "portal config has no identity providers or stores"
 	ErrPortalConfigNameNotFound        StandardError = "portal config name not found"
+	ErrPortalConfigBaseURLInvalid      StandardError = "portal config %q has invalid base url %q"
 	ErrPolicyConfigNameNotFound        StandardError = "gatekeeper policy config name not found"
 )
@@ -23,10 +23,18 @@ const (
 	ErrNewDatabaseDuplicateEmail  StandardError = "failed initializing database: found duplicate email address %s, %v"
 	ErrNewDatabaseDuplicateAPIKey StandardError = "failed initializing database: found duplicate api key %s, %v"
 
-	ErrDatabaseCommit       StandardError = "failed database commit to %q: %v"
-	ErrDatabaseOperation    StandardError = "database operation failed: %v"
-	ErrDatabaseInvalidUser  StandardError = "username and email point to a different identity in the database"
-	ErrDatabaseUserNotFound StandardError = "user not found"
+	ErrDatabaseCommit             StandardError = "failed database commit to %q: %v"
+	ErrDatabaseRevisionConflict   StandardError = "failed database commit to %q: revision %d on disk does not match revision %d in memory"
+	ErrDatabaseReload             StandardError = "failed reloading database from %q: %v"
+	ErrDatabaseBackupCount        StandardError = "invalid database backup count: %d"
+	ErrDatabasePathDirectory      StandardError = "path points to a directory"
+	ErrDatabaseStorageUnsupported StandardError = "unsupported database storage %q"
+	ErrDatabaseStorageDuplicate   StandardError = "found duplicate %s entry %q in database storage"
+	ErrDatabaseImportNotEmpty     StandardError = "failed importing database: the target database has %d users"
+	ErrDatabaseReadOnly           StandardError = "database is read-only"
+	ErrDatabaseOperation          StandardError = "database operation failed: %v"
+	ErrDatabaseInvalidUser        StandardError = "username and email point to a different identity in the database"
+	ErrDatabaseUserNotFound       StandardError = "user not found"
 	// ErrDatabaseInvalidUserPassword StandardError = "invalid password"
 	ErrAuthFailed StandardError = "user authentication failed: %v"
 
@@ -42,8 +50,12 @@ const (
 
 	ErrChangeUserPassword   StandardError = "failed change user password: %v"
 	ErrUpdateUserPassword   StandardError = "failed updating user password: %v"
+	ErrResetUserPassword    StandardError = "failed resetting user password: %v"
+	ErrPasswordHashedInput  StandardError = "hashed password input is not allowed"
 	ErrUserPasswordNotFound StandardError = "user password not set"
 	ErrUserPasswordInvalid  StandardError = "user password is invalid"
+	ErrUserPasswordChanged  StandardError = "user password has changed"
+	ErrUserPasswordExpired  StandardError = "user password has expired"
 
 	ErrUserPolicyCompliance     StandardError = "username policy compliance check failed"
 	ErrPasswordPolicyCompliance StandardError = "user password policy compliance check failed: %v"
@@ -52,6 +64,12 @@ const (
 	ErrDeleteUser StandardError = "failed deleting user %q: %v"
 	ErrGetUsers   StandardError = "failed retrieving users: %v"
 	ErrGetUser    StandardError = "failed retrieving user %q: %v"
+	ErrUpdateUser StandardError = "failed updating user %q: %v"
+	ErrLookupUser StandardError = "failed looking up user %q: %v"
+
+	ErrUserDisabled          StandardError = "user is disabled"
+	ErrLastAdminUser         StandardError = "the operation would leave the database without admin users"
+	ErrDatabaseUserIDMissing StandardError = "user id is empty"
 
 	ErrPasswordEmpty                StandardError = "empty password"
 	ErrPasswordEmptyAlgorithm       StandardError = "empty password hash algorithm"
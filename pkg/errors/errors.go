@@ -15,7 +15,6 @@
 package errors
 
 import (
-	"errors"
 	"fmt"
 )
 
@@ -64,7 +63,14 @@ func (e advErr) Error() string {
 	return fmt.Sprintf(e.err.Error(), e.v...)
 }
 
-// Unwrap returns unwrapped error.
-func (e advErr) Unwrap() error {
-	return errors.Unwrap(e.err)
+// Unwrap returns unwrapped errors, i.e. the standard error and the errors
+// passed as parameters.
+func (e advErr) Unwrap() []error {
+	errs := []error{e.err}
+	for _, v := range e.v {
+		if err, ok := v.(error); ok {
+			errs = append(errs, err)
+		}
+	}
+	return errs
 }
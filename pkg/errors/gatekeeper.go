@@ -23,3 +23,16 @@ const (
 	ErrGatekeeperRegistryEntryExists   StandardError = "gatekeeper %q already registered"
 	ErrGatekeeperUnavailable           StandardError = "gatekeeper unavailable"
 )
+
+// Policy test errors.
+const (
+	ErrPolicyTestSuiteLoad          StandardError = "failed loading policy test suite %q: %v"
+	ErrPolicyTestSuiteParse         StandardError = "failed parsing policy test suite: %v"
+	ErrPolicyTestSuiteEmpty         StandardError = "policy test suite has no tests"
+	ErrPolicyTestNameEmpty          StandardError = "policy test #%d has no name"
+	ErrPolicyTestExpectUnsupported  StandardError = "policy test %q has unsupported expected verdict %q, must be allow or deny"
+	ErrPolicyTestClaimsInvalid      StandardError = "policy test %q has invalid claims: %v"
+	ErrPolicyTestRequestInvalid     StandardError = "policy test %q has invalid request: %v"
+	ErrPolicyTestAccessListRules    StandardError = "failed loading access list rules of policy %q: %v"
+	ErrPolicyTestAccessListNotFound StandardError = "policy %q has no access list rules"
+)
@@ -19,7 +19,8 @@ const (
 	ErrIdentityProviderConfigInvalid StandardError = "invalid identity provider config: %v"
 
 	// Generic Errors.
-	ErrIdentityProviderRequest StandardError = "%s failed: %v"
+	ErrIdentityProviderRequest       StandardError = "%s failed: %v"
+	ErrIdentityProviderRealmNotFound StandardError = "identity provider for realm %q not found"
 
 	// Config Errors.
 	ErrIdentityProviderConfigureEmptyConfig    StandardError = "identity provider configuration is empty"
@@ -31,6 +32,7 @@ const (
 
 	// OAuth Errors.
 	ErrIdentityProviderOauthAuthorizationStateNotFound   StandardError = "OAuth 2.0 authorization state not found"
+	ErrIdentityProviderOauthAuthorizationStateSave       StandardError = "failed saving OAuth 2.0 authorization state: %v"
 	ErrIdentityProviderOauthAuthorizationFailedDetailed  StandardError = "failed OAuth 2.0 authorization flow, error: %s, description: %s"
 	ErrIdentityProviderOauthAuthorizationFailed          StandardError = "failed OAuth 2.0 authorization flow, error: %s"
 	ErrIdentityProviderOauthFetchAccessTokenFailed       StandardError = "failed fetching OAuth 2.0 access token: %s"
@@ -40,6 +42,9 @@ const (
 	ErrIdentityProviderOauthValidateAccessTokenFailed    StandardError = "failed validating OAuth 2.0 access token: %s"
 	ErrIdentityProviderOauthResponseProcessingFailed     StandardError = "unable to process OAuth 2.0 response"
 	ErrIdentityProviderOauthGetAccessTokenFailedDetailed StandardError = "failed obtaining OAuth 2.0 access token, error: %v, description: %q"
+	ErrIdentityProviderOauthRefreshTokenNotFound         StandardError = "OAuth 2.0 refresh token not found"
+	ErrIdentityProviderOauthRefreshSessionFailed         StandardError = "failed refreshing OAuth 2.0 session: %v"
+	ErrIdentityProviderOauthSessionExpired               StandardError = "OAuth 2.0 session expired"
 
 	ErrIdentityProviderOauthKeyFetchFailed           StandardError = "failed to fetch jwt keys for OAuth 2.0 authorization server: %s"
 	ErrIdentityProviderOauthMetadataFieldNotFound    StandardError = "metadata %s field not found for provider %s"
@@ -62,4 +67,14 @@ const (
 	ErrIdentityProviderOauthMetadataFetchFailed                 StandardError = "failed to fetch metadata for OAuth 2.0 authorization server: %s"
 	ErrIdentityProviderOauthGetAccessTokenFailed                StandardError = "failed obtaining OAuth 2.0 access token, error: %v"
 	ErrIdentityProviderAuthorizationServerResponseFieldNotFound StandardError = "authorization server response has no %q field"
+
+	// SAML Errors.
+	ErrIdentityProviderSamlSigningKeyLoad      StandardError = "failed loading SAML service provider signing key: %v"
+	ErrIdentityProviderSamlSingleSignOnURL     StandardError = "SAML IdP metadata has no single sign-on service with HTTP-Redirect binding"
+	ErrIdentityProviderSamlAuthnRequestFailed  StandardError = "failed creating SAML authentication request: %v"
+	ErrIdentityProviderSamlRequestIDNotFound   StandardError = "SAML response to unknown request %q"
+	ErrIdentityProviderSamlRequestIDEmpty      StandardError = "SAML request has empty id"
+	ErrIdentityProviderSamlRequestIDReplayed   StandardError = "SAML request %q was already received"
+	ErrIdentityProviderSamlLogoutRequestFailed StandardError = "failed creating SAML logout request: %v"
+	ErrIdentityProviderSamlLogoutInvalid       StandardError = "invalid SAML logout %s: %v"
 )
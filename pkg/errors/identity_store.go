@@ -19,14 +19,25 @@ const (
 	ErrIdentityStoreConfigInvalid StandardError = "invalid identity store config: %v"
 
 	// Local identity store errors.
-	ErrIdentityStoreLocalConfigurePathEmpty    StandardError = "identity store configuration has empty database path"
-	ErrIdentityStoreLocalConfigurePathMismatch StandardError = "identity store configuration database path does not match to an existing path in the same realm: %v %v"
+	ErrIdentityStoreLocalConfigurePathEmpty     StandardError = "identity store configuration has empty database path"
+	ErrIdentityStoreLocalConfigurePathMismatch  StandardError = "identity store configuration database path does not match to an existing path in the same realm: %v %v"
+	ErrIdentityStoreLocalConfigureLockoutPolicy StandardError = "identity store configuration has invalid lockout policy: %v"
+	ErrIdentityStoreLocalConfigureStorage       StandardError = "identity store configuration has unsupported database storage: %s"
+	ErrIdentityStoreLocalConfigureBackupCount   StandardError = "identity store configuration has invalid database backup count: %d"
+	ErrIdentityStoreLocalConfigureWatchInterval StandardError = "identity store configuration has invalid database watch interval: %d"
 
 	// LDAP identity store errors.
 	ErrIdentityStoreLdapAuthenticateInvalidUserEmail StandardError = "LDAP authentication request contains invalid user email"
 	ErrIdentityStoreLdapAuthenticateInvalidUsername  StandardError = "LDAP authentication request contains invalid username"
 	ErrIdentityStoreLdapAuthenticateInvalidPassword  StandardError = "LDAP authentication request contains invalid password"
 	ErrIdentityStoreLdapAuthFailed                   StandardError = "LDAP authentication failed: %v"
+	ErrIdentityStoreLdapOverlayStorage               StandardError = "LDAP identity store configuration has unsupported overlay storage: %s"
+	ErrIdentityStoreLdapRecoveryUnsupported          StandardError = "LDAP identity store does not support %s recovery"
+	ErrIdentityStoreLdapOverlayUser                  StandardError = "LDAP identity store overlay failed adding user %q: %v"
+	ErrIdentityStoreLdapChangePasswordFailed         StandardError = "LDAP password change failed: %v"
+	ErrIdentityStoreLdapUserDisabled                 StandardError = "LDAP user %q is disabled"
+	ErrIdentityStoreLdapUserMismatch                 StandardError = "LDAP user %q has different email address in the directory"
+	ErrIdentityStoreLdapAnchorInvalid                StandardError = "LDAP identity store overlay has invalid directory anchor %q"
 
 	// Generic Errors.
 	ErrIdentityStoreRequest StandardError = "%s failed: %v"
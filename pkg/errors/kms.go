@@ -26,6 +26,8 @@ const (
 	ErrCryptoKeyConfigFileKeyNotFound           StandardError = "kms: file %q has no keys"
 	ErrCryptoKeyConfigUnsupportedPrivateKeyAlgo StandardError = "unsupported private key algo %T"
 	ErrCryptoKeyConfigUnsupportedPublicKeyAlgo  StandardError = "unsupported public key algo %T"
+	ErrCryptoKeyConfigUnsupportedRSAPSSParams   StandardError = "unsupported rsa-pss key parameters: %v"
+	ErrCryptoKeyConfigSignMethodUnsupported     StandardError = "key %q does not support %s token signing method"
 	ErrCryptoKeyConfigEmptyEnvVar               StandardError = "environment variable %s has empty value"
 	ErrCryptoKeyConfigEntryInvalid              StandardError = "key config entry %q is invalid: %v"
 	ErrCryptoKeyConfigNoConfigFound             StandardError = "no key configs found"
@@ -40,12 +42,29 @@ const (
 	ErrCryptoKeyStoreParseTokenFailed         StandardError = "keystore: failed to parse token"
 	ErrCryptoKeyStoreTokenData                StandardError = "keystore: failed creating user from a parsed token"
 	ErrCryptoKeyStoreParseTokenExpired        StandardError = "keystore: parsed token has expired"
+	ErrCryptoKeyStoreParseTokenIDToken        StandardError = "keystore: parsed token is an id token"
 	ErrCryptoKeyStoreSignTokenFailed          StandardError = "keystore: failed to sign token"
 	ErrCryptoKeyStoreNoVerifyKeysFound        StandardError = "keystore: no verification keys found"
 	ErrCryptoKeyStoreNoSignKeysFound          StandardError = "keystore: no signing keys found"
 	ErrCryptoKeyStoreAutoGenerateNotAvailable StandardError = "auto-generate not available when keystore is not empty"
 	ErrCryptoKeyStoreAutoGenerateFailed       StandardError = "failed to auto-generate keystore keypair: %v"
 	ErrCryptoKeyStoreAutoGenerateAlgo         StandardError = "auto-generate does not support %q algorithm"
+	// Key Rotation
+	ErrCryptoKeyStoreKeyRotationInterval StandardError = "keystore: key rotation interval %q is invalid: %v"
+	ErrCryptoKeyStoreKeyRotationFailed   StandardError = "keystore: key rotation failed: %v"
+	ErrCryptoKeyStoreKeyringSecretEmpty  StandardError = "keystore: keyring %q has no secret"
+	ErrCryptoKeyStoreKeyringLoad         StandardError = "keystore: failed loading keyring %q: %v"
+	ErrCryptoKeyStoreKeyringDecrypt      StandardError = "keystore: failed decrypting keyring %q: invalid secret or corrupted keyring"
+	ErrCryptoKeyStoreKeyringSave         StandardError = "keystore: failed saving keyring %q: %v"
+	ErrCryptoKeyStoreKeyringLock         StandardError = "keystore: failed locking keyring %q: %v"
+	ErrCryptoKeyStoreKeyringEntry        StandardError = "keystore: keyring %q has invalid key %q: %v"
+	// JWKS
+	ErrCryptoKeyJwksNotPublic       StandardError = "kms: key %q is not an asymmetric key and cannot be published"
+	ErrCryptoKeyJwksUnsupportedType StandardError = "kms: key %q has unsupported public key type %T"
+	ErrCryptoKeyJwksFetch           StandardError = "kms: failed fetching jwks from %q: %v"
+	ErrCryptoKeyJwksFetchStatus     StandardError = "kms: failed fetching jwks from %q: unexpected status code %d"
+	ErrCryptoKeyJwksKeyNotFound     StandardError = "kms: jwks from %q has no key %q"
+	ErrCryptoKeyJwksKeyIDEmpty      StandardError = "kms: token has no key id and jwks from %q has %d keys"
 	// Signing
 	ErrUnsupportedSigningMethod StandardError = "kms: grantor does not support %s token signing method"
 	ErrUnexpectedSigningMethod  StandardError = "signing method mismatch: %v (expected) vs. %v (received)"
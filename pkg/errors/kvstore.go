@@ -0,0 +1,32 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+// Key/Value Store Errors
+const (
+	ErrKVStoreConfigDriverUnsupported   StandardError = "kvstore: driver %q is unsupported"
+	ErrKVStoreConfigPathEmpty           StandardError = "kvstore: %s driver requires path"
+	ErrKVStoreConfigAddressEmpty        StandardError = "kvstore: %s driver requires address"
+	ErrKVStoreConfigTimeout             StandardError = "kvstore: timeout must not be negative"
+	ErrKVStoreConfigTLSDisabled         StandardError = "kvstore: %s driver has tls options with tls disabled"
+	ErrKVStoreConfigTLSTrustedAuthority StandardError = "kvstore: failed loading trusted authority %q: %v"
+	ErrKVStoreKeyEmpty                  StandardError = "kvstore: key is empty"
+	ErrKVStoreKeyNotFound               StandardError = "kvstore: key not found"
+	ErrKVStoreKeyExists                 StandardError = "kvstore: key already exists"
+	ErrKVStoreTTLNegative               StandardError = "kvstore: ttl must not be negative"
+	ErrKVStoreOpen                      StandardError = "kvstore: failed opening %s store: %v"
+	ErrKVStoreOperation                 StandardError = "kvstore: %s failed: %v"
+	ErrKVStoreClosed                    StandardError = "kvstore: store is closed"
+)
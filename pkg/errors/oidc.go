@@ -0,0 +1,48 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+// OpenID Connect provider errors.
+const (
+	ErrOpenIDConnectConfigClientIDEmpty        StandardError = "openid connect config in %q portal has client without id"
+	ErrOpenIDConnectConfigClientDuplicate      StandardError = "openid connect config in %q portal has duplicate client %q"
+	ErrOpenIDConnectConfigRedirectURLsNotFound StandardError = "openid connect config in %q portal has client %q without redirect urls"
+	ErrOpenIDConnectConfigRedirectURLInvalid   StandardError = "openid connect config in %q portal has client %q with invalid redirect url %q"
+	ErrOpenIDConnectConfigScopeUnsupported     StandardError = "openid connect config in %q portal has client %q with unsupported scope %q"
+	ErrOpenIDConnectConfigScopeClaimsEmpty     StandardError = "openid connect config in %q portal has scope %q without claims"
+	ErrOpenIDConnectConfigTokenLifetime        StandardError = "openid connect config in %q portal has invalid token lifetime %d"
+	ErrOpenIDConnectConfigCodeLifetime         StandardError = "openid connect config in %q portal has invalid authorization code lifetime %d"
+	ErrOpenIDConnectConfigBaseURLEmpty         StandardError = "openid connect config in %q portal requires base url"
+	ErrOpenIDConnectConfigSignKeyNotFound      StandardError = "openid connect config in %q portal requires public-private signing key with token name %q"
+
+	ErrOpenIDConnectRequestMethod                StandardError = "openid connect request method %q is not allowed"
+	ErrOpenIDConnectClientNotFound               StandardError = "openid connect client %q not found"
+	ErrOpenIDConnectClientAuthFailed             StandardError = "openid connect client %q authentication failed"
+	ErrOpenIDConnectRedirectURLMismatch          StandardError = "openid connect client %q has no redirect url %q"
+	ErrOpenIDConnectResponseTypeUnsupported      StandardError = "openid connect response type %q is unsupported"
+	ErrOpenIDConnectGrantTypeUnsupported         StandardError = "openid connect grant type %q is unsupported"
+	ErrOpenIDConnectScopeNotFound                StandardError = "openid connect request has no openid scope"
+	ErrOpenIDConnectScopeNotAllowed              StandardError = "openid connect client %q is not allowed scope %q"
+	ErrOpenIDConnectCodeChallengeNotFound        StandardError = "openid connect client %q requires code challenge"
+	ErrOpenIDConnectCodeChallengeMethod          StandardError = "openid connect code challenge method %q is unsupported"
+	ErrOpenIDConnectCodeVerifierMismatch         StandardError = "openid connect code verifier does not match code challenge"
+	ErrOpenIDConnectAuthorizationRequestNotFound StandardError = "openid connect authorization request not found or expired"
+	ErrOpenIDConnectAuthorizationCodeInvalid     StandardError = "openid connect authorization code is invalid or expired"
+	ErrOpenIDConnectAccessTokenInvalid           StandardError = "openid connect access token is invalid or expired"
+	ErrOpenIDConnectGrantExpired                 StandardError = "openid connect grant expired"
+	ErrOpenIDConnectConsentRequired              StandardError = "openid connect client %q requires user consent"
+	ErrOpenIDConnectLoginRequired                StandardError = "openid connect client %q requires user login"
+	ErrOpenIDConnectAccessDenied                 StandardError = "user denied access to openid connect client %q"
+)
@@ -0,0 +1,35 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+// Recovery errors.
+const (
+	ErrRecoveryConfigEmailProviderEmpty                   StandardError = "recovery config in %q portal has no email provider"
+	ErrRecoveryConfigBaseURLEmpty                         StandardError = "recovery config in %q portal requires portal base url"
+	ErrRecoveryConfigTokenLifetime                        StandardError = "recovery config in %q portal has invalid token lifetime %d"
+	ErrRecoveryConfigMessagingNil                         StandardError = "recovery config in %q portal messaging is nil"
+	ErrRecoveryConfigMessagingProviderNotFound            StandardError = "recovery config in %q portal messaging provider %q not found"
+	ErrRecoveryConfigMessagingProviderCredentialsNotFound StandardError = "recovery config in %q portal messaging provider %q has no associated credentials"
+	ErrRecoveryConfigCredentialsNil                       StandardError = "recovery config in %q portal credentials is nil"
+	ErrRecoveryConfigCredentialsNotFound                  StandardError = "recovery config in %q portal credential %q not found"
+
+	ErrRecoveryTokenMalformed StandardError = "recovery token is malformed"
+	ErrRecoveryTokenSignature StandardError = "recovery token signature is invalid"
+	ErrRecoveryTokenExpired   StandardError = "recovery token is expired"
+	ErrRecoveryTokenUsed      StandardError = "recovery token has already been used"
+
+	ErrRecoveryRequestThrottled StandardError = "recovery request throttled"
+	ErrRecoveryQueueFull        StandardError = "recovery request queue is full"
+)
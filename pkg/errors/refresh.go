@@ -0,0 +1,30 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+// Token refresh errors.
+const (
+	ErrTokenRefreshConfigTokenLifetime StandardError = "token refresh config in %q portal has invalid token lifetime %d"
+	ErrTokenRefreshConfigRenewalWindow StandardError = "token refresh config in %q portal has invalid renewal window %d"
+
+	ErrRefreshTokenMalformed StandardError = "refresh token is malformed"
+	ErrRefreshTokenInvalid   StandardError = "refresh token is invalid"
+	ErrRefreshTokenExpired   StandardError = "refresh token is expired"
+	ErrRefreshTokenReused    StandardError = "refresh token has already been used"
+	ErrRefreshTokenRevoked   StandardError = "refresh token is revoked"
+
+	ErrRefreshUserNotFound      StandardError = "user %q not found in %q realm"
+	ErrRefreshUserRealmNotFound StandardError = "identity store or provider for realm %q not found"
+)
@@ -0,0 +1,25 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+// Token Revocation Errors
+const (
+	ErrRevocationConfigSyncInterval StandardError = "revocation: sync interval must be equal to or greater than %d seconds"
+	ErrRevocationTokenIDEmpty       StandardError = "revocation: token id is empty"
+	ErrRevocationSubjectEmpty       StandardError = "revocation: subject is empty"
+	ErrRevocationLoad               StandardError = "revocation: failed loading deny list %q: %v"
+	ErrRevocationSave               StandardError = "revocation: failed saving deny list %q: %v"
+	ErrTokenRevoked                 StandardError = "revocation: token has been revoked"
+)
@@ -16,8 +16,18 @@ package errors
 
 // SSO Provider Errors
 const (
-	ErrSingleSignOnProviderConfigInvalid           StandardError = "invalid sso provider config: %v: %v"
-	ErrSingleSignOnProviderConfigureLoggerNotFound StandardError = "sso provider configuration has no logger"
-	ErrSingleSignOnProviderRequestMalformed        StandardError = "malformed sso provider request"
+	ErrSingleSignOnProviderConfigInvalid            StandardError = "invalid sso provider config: %v: %v"
+	ErrSingleSignOnProviderConfigureLoggerNotFound  StandardError = "sso provider configuration has no logger"
+	ErrSingleSignOnProviderRequestMalformed         StandardError = "malformed sso provider request"
+	ErrSingleSignOnProviderRoleUnauthorized         StandardError = "unauthorized sso assume role request for role %q in account %q"
+	ErrSingleSignOnProviderAssumeRoleInvalid        StandardError = "invalid sso assume role request: %v"
+	ErrSingleSignOnProviderResponseFailed           StandardError = "failed building sso response: %v"
+	ErrSingleSignOnProviderRequestUnsupported       StandardError = "sso provider %q with %q driver does not support %s requests"
+	ErrSingleSignOnProviderServiceProviderNotFound  StandardError = "sso service provider %q not found"
+	ErrSingleSignOnProviderServiceProviderLoad      StandardError = "failed loading sso service provider %q: %v"
+	ErrSingleSignOnProviderServiceProviderForbidden StandardError = "user has no role allowed to log in to sso service provider %q"
+	ErrSingleSignOnProviderAuthnRequestInvalid      StandardError = "invalid sso authn request: %v"
+	ErrSingleSignOnProviderAuthnRequestNotFound     StandardError = "sso authn request not found or expired"
+	ErrSingleSignOnProviderNameIDNotFound           StandardError = "sso name id claim %q not found"
 	// ErrSingleSignOnProviderRequestInvalid          StandardError = "invalid sso provider request: %v"
 )
@@ -29,4 +29,5 @@ const (
 	ErrValidatorAuthProxy                  StandardError = "token validator: auth proxy config is nil"
 	ErrValidatorAuthProxyPortalName        StandardError = "token validator: auth proxy config has empty portal name"
 	ErrValidatorAuthProxyNotFound          StandardError = "token validator: auth proxy %q not found"
+	ErrValidatorAudienceNotAllowed         StandardError = "token validator: audience %v is not allowed"
 )
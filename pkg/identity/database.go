@@ -15,10 +15,10 @@
 package identity
 
 import (
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
 	"os"
-	"path/filepath"
 	"regexp"
 	"strings"
 	"sync"
@@ -89,6 +89,16 @@ type PasswordPolicy struct {
 	RequireNonAlphaNumeric bool `json:"require_non_alpha_numeric" xml:"require_non_alpha_numeric" yaml:"require_non_alpha_numeric"`
 	BlockReuse             bool `json:"block_reuse" xml:"block_reuse" yaml:"block_reuse"`
 	BlockPasswordChange    bool `json:"block_password_change" xml:"block_password_change" yaml:"block_password_change"`
+	// MaxAgeDays is the number of days after which a password expires and
+	// the user must change it at next login. Zero disables the expiry.
+	MaxAgeDays int `json:"max_age_days" xml:"max_age_days" yaml:"max_age_days"`
+	// Algorithm is the algorithm for hashing passwords, i.e. bcrypt,
+	// argon2id, or scrypt. The default is bcrypt. The passwords hashed with
+	// a different algorithm or parameters are re-hashed at next login.
+	Algorithm string `json:"algorithm" xml:"algorithm" yaml:"algorithm"`
+	// AlgorithmParams are the parameters of the hashing algorithm, e.g.
+	// "cost" for bcrypt, or "time", "memory" and "threads" for argon2id.
+	AlgorithmParams map[string]interface{} `json:"algorithm_params" xml:"algorithm_params" yaml:"algorithm_params"`
 }
 
 // UserPolicy represents database username policy
@@ -113,10 +123,23 @@ type Database struct {
 	refAPIKey       map[string]*User
 	path            string
 	inMemory        bool
+	readOnly        bool
+	lockoutPolicy   *LockoutPolicy
+	backupCount     int
+	storage         Storage
+	// indexer looks the users up in the storage, when the storage
+	// implements userIndexer. The Users and the references are unused then.
+	indexer userIndexer
 }
 
-// NewDatabase return an instance of Database.
+// NewDatabase return an instance of Database backed by a JSON file.
 func NewDatabase(fp string) (*Database, error) {
+	return NewDatabaseWithStorage(fp, StorageKindJSON)
+}
+
+// NewDatabaseWithStorage return an instance of Database backed by the
+// storage of the provided kind, i.e. json or bolt.
+func NewDatabaseWithStorage(fp, kind string) (*Database, error) {
 	if fp == "/dev/null" {
 		return nil, errors.ErrNewDatabase.WithArgs(fp, "null path")
 	}
@@ -130,36 +153,34 @@ func NewDatabase(fp string) (*Database, error) {
 		refAPIKey:       make(map[string]*User),
 		inMemory:        fp == ":memory:",
 	}
-	fileInfo, err := os.Stat(fp)
-	if err != nil {
-		if !db.inMemory {
-			if !os.IsNotExist(err) {
-				return nil, errors.ErrNewDatabase.WithArgs(fp, err)
-			}
-			if err := os.MkdirAll(filepath.Dir(fp), 0700); err != nil {
-				return nil, errors.ErrNewDatabase.WithArgs(fp, err)
-			}
-		}
-		db.Version = app.Version
-		db.enforceDefaultPolicy()
-		if err := db.commit(); err != nil {
+
+	var found bool
+	if !db.inMemory {
+		storage, err := newStorage(kind)
+		if err != nil {
 			return nil, errors.ErrNewDatabase.WithArgs(fp, err)
 		}
-	} else {
-		if fileInfo.IsDir() {
-			return nil, errors.ErrNewDatabase.WithArgs(fp, "path points to a directory")
-		}
-		b, err := fileutil.ReadFileBytes(fp)
+		found, err = storage.Open(db)
 		if err != nil {
 			return nil, errors.ErrNewDatabase.WithArgs(fp, err)
 		}
-		if err := json.Unmarshal(b, db); err != nil {
+		db.storage = storage
+		if indexer, ok := storage.(userIndexer); ok {
+			db.indexer = indexer
+		}
+	}
+
+	if !found {
+		db.Version = app.Version
+		db.enforceDefaultPolicy()
+		if err := db.commit(); err != nil {
+			db.Close()
 			return nil, errors.ErrNewDatabase.WithArgs(fp, err)
 		}
-		if changed := db.enforceDefaultPolicy(); changed {
-			if err := db.commit(); err != nil {
-				return nil, errors.ErrNewDatabase.WithArgs(fp, err)
-			}
+	} else if changed := db.enforceDefaultPolicy(); changed {
+		if err := db.commit(); err != nil {
+			db.Close()
+			return nil, errors.ErrNewDatabase.WithArgs(fp, err)
 		}
 	}
 
@@ -167,39 +188,86 @@ func NewDatabase(fp string) (*Database, error) {
 	// db.path = fp
 	db.Version = app.Version
 
+	if err := db.index(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// OpenDatabaseReadOnly returns an instance of Database loaded from an
+// existing JSON file. Unlike NewDatabase, it neither creates the file nor
+// enforces the default policy, and the changes to the database fail, i.e.
+// the file is left untouched.
+func OpenDatabaseReadOnly(fp string) (*Database, error) {
+	db := &Database{
+		mu:              &sync.RWMutex{},
+		path:            fp,
+		refUsername:     make(map[string]*User),
+		refID:           make(map[string]*User),
+		refEmailAddress: make(map[string]*User),
+		refAPIKey:       make(map[string]*User),
+		readOnly:        true,
+		storage:         &jsonStorage{},
+	}
+	// The storage creates the missing directory of the file on open.
+	if _, err := os.Stat(fp); err != nil {
+		return nil, errors.ErrNewDatabase.WithArgs(fp, err)
+	}
+	if _, err := db.storage.Open(db); err != nil {
+		return nil, errors.ErrNewDatabase.WithArgs(fp, err)
+	}
+	if err := db.index(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// index validates the users of the database and builds the lookup
+// references by username, user id, email address and api key prefix.
+func (db *Database) index() error {
 	for _, user := range db.Users {
 		if err := user.Valid(); err != nil {
-			return nil, errors.ErrNewDatabaseInvalidUser.WithArgs(user, err)
+			return errors.ErrNewDatabaseInvalidUser.WithArgs(user, err)
 		}
 		username := strings.ToLower(user.Username)
 		if _, exists := db.refUsername[username]; exists {
-			return nil, errors.ErrNewDatabaseDuplicateUser.WithArgs(user.Username, user)
+			return errors.ErrNewDatabaseDuplicateUser.WithArgs(user.Username, user)
 		}
 		if _, exists := db.refID[user.ID]; exists {
-			return nil, errors.ErrNewDatabaseDuplicateUserID.WithArgs(user.ID, user)
+			return errors.ErrNewDatabaseDuplicateUserID.WithArgs(user.ID, user)
 		}
+		normalizeUser(user)
 		db.refUsername[username] = user
 		db.refID[user.ID] = user
 		for _, email := range user.EmailAddresses {
 			emailAddress := strings.ToLower(email.Address)
 			if _, exists := db.refEmailAddress[emailAddress]; exists {
-				return nil, errors.ErrNewDatabaseDuplicateEmail.WithArgs(emailAddress, user)
+				return errors.ErrNewDatabaseDuplicateEmail.WithArgs(emailAddress, user)
 			}
 			db.refEmailAddress[emailAddress] = user
 		}
-		for _, p := range user.Passwords {
-			if p.Algorithm == "" {
-				p.Algorithm = "bcrypt"
-			}
-		}
 		for _, apiKey := range user.APIKeys {
 			if _, exists := db.refAPIKey[apiKey.Prefix]; exists {
-				return nil, errors.ErrNewDatabaseDuplicateAPIKey.WithArgs(apiKey.Prefix, user)
+				return errors.ErrNewDatabaseDuplicateAPIKey.WithArgs(apiKey.Prefix, user)
 			}
 			db.refAPIKey[apiKey.Prefix] = user
 		}
 	}
-	return db, nil
+	return nil
+}
+
+// normalizeUser fills in the fields of the user saved by the earlier
+// versions of the database.
+func normalizeUser(user *User) {
+	// The users saved before the Enabled field was kept in sync with
+	// Disabled have it unset.
+	user.Enabled = !user.Disabled
+	for _, p := range user.Passwords {
+		if p.Algorithm == "" {
+			p.Algorithm = "bcrypt"
+		}
+	}
 }
 
 func (db *Database) enforceDefaultPolicy() bool {
@@ -248,53 +316,107 @@ func (db *Database) checkUserPolicyCompliance(s string) error {
 }
 
 func (db *Database) checkPasswordPolicyCompliance(s string) error {
-	if len(s) > db.Policy.Password.MaxLength || len(s) < db.Policy.Password.MinLength {
-		return errors.ErrPasswordPolicyCompliance.WithArgs(fmt.Errorf("password length is %d characters", len(s)))
+	if err := db.Policy.Password.Check(s); err != nil {
+		return errors.ErrPasswordPolicyCompliance.WithArgs(err)
+	}
+	return nil
+}
+
+func (db *Database) checkPasswordReuse(user *User, s string) error {
+	if err := db.Policy.Password.CheckReuse(user, s); err != nil {
+		return errors.ErrPasswordPolicyCompliance.WithArgs(err)
+	}
+	return nil
+}
+
+func (db *Database) isPasswordExpired(user *User) bool {
+	return user.IsPasswordExpired(db.Policy.Password.GetMaxAge())
+}
+
+// SetLockoutPolicy sets the policy for locking out users following repeated
+// authentication failures.
+func (db *Database) SetLockoutPolicy(p *LockoutPolicy) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.lockoutPolicy = p
+}
+
+// SetBackupCount sets the number of rotated backups of the database file,
+// i.e. <path>.1 through <path>.N, kept on each commit to a JSON file. Zero
+// disables backups.
+func (db *Database) SetBackupCount(n int) error {
+	if n < 0 {
+		return errors.ErrDatabaseBackupCount.WithArgs(n)
 	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.backupCount = n
 	return nil
 }
 
+// GetRevision returns the revision of Database.
+func (db *Database) GetRevision() uint64 {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.Revision
+}
+
 // GetPath returns the path  to Database.
 func (db *Database) GetPath() string {
 	return db.path
 }
 
-// AddUser adds user identity to the database.
+// AddUser adds user identity to the database. It does not accept
+// pre-hashed passwords because the input may originate from the user, e.g.
+// during registration.
 func (db *Database) AddUser(r *requests.Request) error {
 	db.mu.Lock()
 	defer db.mu.Unlock()
+	if isHashedPassword(r.User.Password) {
+		return errors.ErrAddUser.WithArgs(r.User.Username, errors.ErrPasswordHashedInput)
+	}
+	return db.addUser(r)
+}
+
+// ImportUser adds user identity to the database. Unlike AddUser, it accepts
+// pre-hashed passwords, e.g. when migrating users from another system or
+// when creating the users defined in the configuration.
+func (db *Database) ImportUser(r *requests.Request) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.addUser(r)
+}
 
+func (db *Database) addUser(r *requests.Request) error {
 	if err := db.checkPolicyCompliance(r.User.Username, r.User.Password); err != nil {
 		return errors.ErrAddUser.WithArgs(r.User.Username, err)
 	}
 
-	user, err := NewUserWithRoles(
+	user, err := newUserWithPolicy(
 		r.User.Username, r.User.Password,
 		r.User.Email, r.User.FullName,
-		r.User.Roles,
+		r.User.Roles, &db.Policy.Password,
 	)
 	if err != nil {
 		return errors.ErrAddUser.WithArgs(r.User.Username, err)
 	}
 	for i := 0; i < 10; i++ {
 		id := NewID()
-		if _, exists := db.refID[id]; !exists {
+		if _, err := db.getUserByIndex(userIndexID, id); err != nil {
 			user.ID = id
 			break
 		}
 	}
 	username := strings.ToLower(user.Username)
-	if _, exists := db.refUsername[username]; exists {
+	if _, err := db.getUserByIndex(userIndexUsername, username); err == nil {
 		return errors.ErrAddUser.WithArgs(username, "username already in use")
 	}
 
-	emailAddresses := []string{}
 	for _, email := range user.EmailAddresses {
 		emailAddress := strings.ToLower(email.Address)
-		if _, exists := db.refEmailAddress[emailAddress]; exists {
+		if _, err := db.getUserByIndex(userIndexEmailAddress, emailAddress); err == nil {
 			return errors.ErrAddUser.WithArgs(emailAddress, "email address already in use")
 		}
-		emailAddresses = append(emailAddresses, emailAddress)
 	}
 
 	if r.Query.ID != "" {
@@ -302,14 +424,9 @@ func (db *Database) AddUser(r *requests.Request) error {
 		user.Registration = NewRegistration(r.Query.ID)
 	}
 
-	db.refUsername[username] = user
-	db.refID[user.ID] = user
-	for _, emailAddress := range emailAddresses {
-		db.refEmailAddress[emailAddress] = user
-	}
-	db.Users = append(db.Users, user)
+	db.reference(user)
 
-	if err := db.commit(); err != nil {
+	if err := db.commit(user); err != nil {
 		return errors.ErrAddUser.WithArgs(username, err)
 	}
 	return nil
@@ -323,8 +440,12 @@ func (db *Database) GetUsers(r *requests.Request) error {
 	if err != nil {
 		return errors.ErrGetUsers.WithArgs(err)
 	}
+	users, err := db.listUsers()
+	if err != nil {
+		return errors.ErrGetUsers.WithArgs(err)
+	}
 	bundle := NewUserMetadataBundle()
-	for _, user := range db.Users {
+	for _, user := range users {
 		bundle.Add(user.GetMetadata())
 	}
 	r.Response.Payload = bundle
@@ -335,9 +456,9 @@ func (db *Database) GetUsers(r *requests.Request) error {
 func (db *Database) GetUser(r *requests.Request) error {
 	db.mu.RLock()
 	defer db.mu.RUnlock()
-	user, err := db.validateUserIdentity(r.User.Username, r.User.Email)
+	user, err := db.lookupUser(r)
 	if err != nil {
-		return errors.ErrGetUsers.WithArgs(err)
+		return errors.ErrGetUser.WithArgs(r.Query.ID, err)
 	}
 	r.Response.Payload = user
 	return nil
@@ -347,57 +468,316 @@ func (db *Database) GetUser(r *requests.Request) error {
 func (db *Database) DeleteUser(r *requests.Request) error {
 	db.mu.Lock()
 	defer db.mu.Unlock()
-	// user, err := db.validateUserIdentity(r.User.Username, r.User.Email)
-	_, err := db.validateUserIdentity(r.User.Username, r.User.Email)
+	user, err := db.lookupUser(r)
 	if err != nil {
 		return errors.ErrDeleteUser.WithArgs(r.Query.ID, err)
 	}
-	return errors.ErrDeleteUser.WithArgs(r.Query.ID, "user delete operation is not supported")
-	// TODO: how do we delete a user ???
+	if user.HasAdminRights() && db.countAdminUsers() < 2 {
+		return errors.ErrDeleteUser.WithArgs(user.Username, errors.ErrLastAdminUser)
+	}
 
-	// if err := user.DeletePublicKey(r); err != nil {
-	//	return err
-	//}
-	/*
-		if err := db.commit(); err != nil {
-			return errors.ErrDeleteUser.WithArgs(r.Query.ID, err)
+	db.dereference(user)
+
+	if err := db.commitDelete(user); err != nil {
+		if err == errors.ErrDatabaseReadOnly {
+			db.reference(user)
 		}
+		return errors.ErrDeleteUser.WithArgs(user.Username, err)
+	}
+	return nil
+}
+
+// DisableUser disables a user by user id. The disabled user cannot
+// authenticate.
+func (db *Database) DisableUser(r *requests.Request) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	user, err := db.lookupUser(r)
+	if err != nil {
+		return errors.ErrUpdateUser.WithArgs(r.Query.ID, err)
+	}
+	if user.Disabled {
+		return nil
+	}
+	if user.HasAdminRights() && db.countAdminUsers() < 2 {
+		return errors.ErrUpdateUser.WithArgs(user.Username, errors.ErrLastAdminUser)
+	}
+	user.Disable()
+	if err := db.commit(user); err != nil {
+		return errors.ErrUpdateUser.WithArgs(user.Username, err)
+	}
+	return nil
+}
+
+// EnableUser enables a previously disabled user by user id.
+func (db *Database) EnableUser(r *requests.Request) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	user, err := db.lookupUser(r)
+	if err != nil {
+		return errors.ErrUpdateUser.WithArgs(r.Query.ID, err)
+	}
+	if !user.Disabled {
 		return nil
-	*/
+	}
+	user.Enable()
+	if err := db.commit(user); err != nil {
+		return errors.ErrUpdateUser.WithArgs(user.Username, err)
+	}
+	return nil
+}
+
+// UpdateUserRoles replaces the roles of a user by user id.
+func (db *Database) UpdateUserRoles(r *requests.Request) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	user, err := db.lookupUser(r)
+	if err != nil {
+		return errors.ErrUpdateUser.WithArgs(r.Query.ID, err)
+	}
+	roles, revision, lastModified := user.Roles, user.Revision, user.LastModified
+	if err := user.SetRoles(r.User.Roles); err != nil {
+		return errors.ErrUpdateUser.WithArgs(user.Username, err)
+	}
+	if db.countAdminUsers(user) < 1 {
+		user.Roles, user.Revision, user.LastModified = roles, revision, lastModified
+		return errors.ErrUpdateUser.WithArgs(user.Username, errors.ErrLastAdminUser)
+	}
+	if err := db.commit(user); err != nil {
+		return errors.ErrUpdateUser.WithArgs(user.Username, err)
+	}
+	return nil
+}
+
+// lookupUser returns the user referenced by the query id of a request. When
+// the id is not provided, the user is located by username and email address.
+func (db *Database) lookupUser(r *requests.Request) (*User, error) {
+	if r.Query.ID != "" {
+		return db.getUserByID(r.Query.ID)
+	}
+	return db.validateUserIdentity(r.User.Username, r.User.Email)
 }
 
 // AuthenticateUser adds user identity to the database.
 func (db *Database) AuthenticateUser(r *requests.Request) error {
+	// The credentials are verified under the read lock, so that the logins
+	// run concurrently. The write lock is taken only when the lockout state
+	// or the password hash of the user changes.
 	db.mu.RLock()
-	defer db.mu.RUnlock()
 	user, err := db.getUser(r.User.Username)
 	if err != nil {
+		db.mu.RUnlock()
 		r.Response.Code = 400
 		// Calculate password hash as the means to prevent user discovery.
-		NewPassword(r.User.Password)
+		db.Policy.Password.NewPassword(r.User.Password)
 		return errors.ErrAuthFailed.WithArgs(err)
 	}
 
+	if user.Disabled {
+		db.mu.RUnlock()
+		r.Response.Code = 400
+		return errors.ErrAuthFailed.WithArgs(errors.ErrUserDisabled)
+	}
+
+	var authErr error
 	switch {
 	case r.User.Password != "":
-		if err := user.VerifyPassword(r.User.Password); err != nil {
-			r.Response.Code = 400
-			return errors.ErrAuthFailed.WithArgs(err)
-		}
+		authErr = user.VerifyPassword(r.User.Password)
 	case r.WebAuthn.Request != "":
-		if err := user.VerifyWebAuthnRequest(r); err != nil {
-			r.Response.Code = 400
-			return errors.ErrAuthFailed.WithArgs(err)
-		}
+		authErr = user.VerifyWebAuthnRequest(r)
 	default:
+		db.mu.RUnlock()
 		r.Response.Code = 400
 		return errors.ErrAuthFailed.WithArgs("malformed auth request")
 	}
+	lockedOut := user.IsLockedOut()
+	db.mu.RUnlock()
+
+	if lockedOut {
+		// The locked out user gets the same response as the user with
+		// invalid credentials, regardless of the provided credentials.
+		r.Response.Code = 400
+		return errors.ErrAuthFailed.WithArgs(errors.ErrUserPasswordInvalid)
+	}
+
+	if authErr != nil {
+		r.Response.Code = 400
+		if err := db.recordFailedAuth(user.ID); err != nil {
+			return errors.ErrAuthFailed.WithArgs(err)
+		}
+		return errors.ErrAuthFailed.WithArgs(authErr)
+	}
+
+	if err := db.recordSuccessfulAuth(user.ID, r.User.Password); err != nil {
+		r.Response.Code = 400
+		return errors.ErrAuthFailed.WithArgs(err)
+	}
 
 	r.Response.Code = 200
 	return nil
 }
 
+// recordSuccessfulAuth clears the failed authentication attempts of the user
+// and re-hashes the password of the user, when necessary.
+func (db *Database) recordSuccessfulAuth(id, password string) error {
+	db.mu.RLock()
+	user, err := db.getUserByIndex(userIndexID, id)
+	exists := err == nil
+	changed := exists && user.hasFailedAuth()
+	if exists && password != "" && db.needsRehash(user) {
+		changed = true
+	}
+	db.mu.RUnlock()
+	if !changed {
+		return nil
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	user, err = db.getUserByIndex(userIndexID, id)
+	if err != nil {
+		return nil
+	}
+	changed = user.ResetFailedAuth()
+	if password != "" && db.rehashPassword(user, password) {
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return db.commit(user)
+}
+
+// needsRehash returns true when the current password of the user was hashed
+// with an algorithm or parameters other than the ones in the password policy.
+func (db *Database) needsRehash(user *User) bool {
+	if len(user.Passwords) == 0 {
+		return false
+	}
+	current := user.Passwords[0]
+	return !current.Disabled && current.NeedsRehash(db.Policy.Password.GetAlgorithm(), db.Policy.Password.AlgorithmParams)
+}
+
+// rehashPassword re-hashes the current password of the user when it was
+// hashed with an algorithm or parameters other than the ones in the password
+// policy. The provided password must be the verified plain text password.
+func (db *Database) rehashPassword(user *User, s string) bool {
+	if len(user.Passwords) == 0 {
+		return false
+	}
+	if !db.needsRehash(user) {
+		return false
+	}
+	current := user.Passwords[0]
+	if !current.Match(s) {
+		return false
+	}
+	password, err := db.Policy.Password.NewPassword(s)
+	if err != nil {
+		return false
+	}
+	password.Purpose = current.Purpose
+	password.CreatedAt = current.CreatedAt
+	user.Passwords[0] = password
+	user.Revise()
+	return true
+}
+
+// recordFailedAuth registers failed authentication attempt of the user with
+// the provided id when the lockout policy is in effect.
+func (db *Database) recordFailedAuth(id string) error {
+	if !db.lockoutPolicy.Enabled() {
+		return nil
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	user, err := db.getUserByIndex(userIndexID, id)
+	if err != nil {
+		return nil
+	}
+	user.RecordFailedAuth(db.lockoutPolicy)
+	return db.commit(user)
+}
+
+// UnlockUser removes the lockout of a user by user id.
+func (db *Database) UnlockUser(r *requests.Request) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	user, err := db.lookupUser(r)
+	if err != nil {
+		return errors.ErrUpdateUser.WithArgs(r.Query.ID, err)
+	}
+	if user.Lockout == nil {
+		return nil
+	}
+	user.Unlock()
+	if err := db.commit(user); err != nil {
+		return errors.ErrUpdateUser.WithArgs(user.Username, err)
+	}
+	return nil
+}
+
+// LookupUser finds a user by email address or username. It populates the
+// username, email address and full name of the user in the request.
+func (db *Database) LookupUser(r *requests.Request) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	s := r.User.Email
+	if s == "" {
+		s = r.User.Username
+	}
+	user, err := db.getUser(s)
+	if err != nil {
+		return errors.ErrLookupUser.WithArgs(s, err)
+	}
+	if user.Disabled {
+		return errors.ErrLookupUser.WithArgs(s, errors.ErrUserDisabled)
+	}
+	r.User.Username = user.Username
+	r.User.Email = user.GetMailClaim()
+	r.User.FullName = user.GetNameClaim()
+	r.User.PasswordFingerprint = user.GetPasswordFingerprint()
+	r.Response.Code = 200
+	return nil
+}
+
+// ResetUserPassword sets a new password for a user that forgot the
+// current one. Unlike UpdateUserPassword, it does not accept pre-hashed
+// passwords because the input originates from the user. The request must
+// carry the password fingerprint returned by LookupUser, i.e. the reset
+// fails when the password changed in the meantime.
+func (db *Database) ResetUserPassword(r *requests.Request) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	user, err := db.validateUserIdentity(r.User.Username, r.User.Email)
+	if err != nil {
+		return errors.ErrResetUserPassword.WithArgs(err)
+	}
+	if user.Disabled {
+		return errors.ErrResetUserPassword.WithArgs(errors.ErrUserDisabled)
+	}
+	fingerprint := user.GetPasswordFingerprint()
+	if r.User.PasswordFingerprint == "" || subtle.ConstantTimeCompare([]byte(r.User.PasswordFingerprint), []byte(fingerprint)) != 1 {
+		return errors.ErrResetUserPassword.WithArgs(errors.ErrUserPasswordChanged)
+	}
+	if isHashedPassword(r.User.Password) {
+		return errors.ErrResetUserPassword.WithArgs(errors.ErrPasswordHashedInput)
+	}
+	if err := db.checkPasswordPolicyCompliance(r.User.Password); err != nil {
+		return errors.ErrResetUserPassword.WithArgs(err)
+	}
+	if err := db.checkPasswordReuse(user, r.User.Password); err != nil {
+		return errors.ErrResetUserPassword.WithArgs(err)
+	}
+	if err := user.AddPasswordWithPolicy(r.User.Password, &db.Policy.Password); err != nil {
+		return errors.ErrResetUserPassword.WithArgs(err)
+	}
+	if err := db.commit(user); err != nil {
+		return errors.ErrResetUserPassword.WithArgs(err)
+	}
+	return nil
+}
+
 // getUser return User by either email address or username.
 func (db *Database) getUser(s string) (*User, error) {
 	if strings.Contains(s, "@") {
@@ -408,12 +788,7 @@ func (db *Database) getUser(s string) (*User, error) {
 
 // getUserByID returns a user by id
 func (db *Database) getUserByID(s string) (*User, error) {
-	s = strings.ToLower(s)
-	user, exists := db.refID[s]
-	if exists && user != nil {
-		return user, nil
-	}
-	return nil, errors.ErrDatabaseUserNotFound
+	return db.getUserByIndex(userIndexID, strings.ToLower(s))
 }
 
 // getUserByUsername returns a user by username
@@ -421,12 +796,7 @@ func (db *Database) getUserByUsername(s string) (*User, error) {
 	if len(s) < 2 {
 		return nil, errors.ErrDatabaseUserNotFound
 	}
-	s = strings.ToLower(s)
-	user, exists := db.refUsername[s]
-	if exists && user != nil {
-		return user, nil
-	}
-	return nil, errors.ErrDatabaseUserNotFound
+	return db.getUserByIndex(userIndexUsername, strings.ToLower(s))
 }
 
 // getUserByEmailAddress returns a liast of users associated with a specific email
@@ -435,28 +805,43 @@ func (db *Database) getUserByEmailAddress(s string) (*User, error) {
 	if len(s) < 6 {
 		return nil, errors.ErrDatabaseUserNotFound
 	}
-	s = strings.ToLower(s)
-	user, exists := db.refEmailAddress[s]
-	if exists && user != nil {
-		return user, nil
-	}
-	return nil, errors.ErrDatabaseUserNotFound
+	return db.getUserByIndex(userIndexEmailAddress, strings.ToLower(s))
 }
 
 // GetUserCount returns user count.
 func (db *Database) GetUserCount() int {
 	db.mu.RLock()
 	defer db.mu.RUnlock()
-	return len(db.Users)
+	count, _ := db.countUsers()
+	return count
 }
 
 // GetAdminUserCount returns user count.
 func (db *Database) GetAdminUserCount() int {
 	db.mu.RLock()
 	defer db.mu.RUnlock()
+	return db.countAdminUsers()
+}
+
+// countAdminUsers returns the number of enabled users with admin rights. The
+// provided users take the place of their stored copies, i.e. the count
+// includes the changes not committed yet. It returns zero when the users
+// cannot be listed.
+func (db *Database) countAdminUsers(changed ...*User) int {
+	users, err := db.listAdminUsers()
+	if err != nil {
+		return 0
+	}
+	admins := make(map[string]bool)
+	for _, user := range users {
+		admins[user.ID] = !user.Disabled && user.HasAdminRights()
+	}
+	for _, user := range changed {
+		admins[user.ID] = !user.Disabled && user.HasAdminRights()
+	}
 	var counter int
-	for _, user := range db.Users {
-		if user.HasAdminRights() {
+	for _, isAdmin := range admins {
+		if isAdmin {
 			counter++
 		}
 	}
@@ -467,33 +852,32 @@ func (db *Database) GetAdminUserCount() int {
 func (db *Database) Save() error {
 	db.mu.Lock()
 	defer db.mu.Unlock()
-	return db.commit()
+	return db.commit(db.Users...)
 }
 
-// Copy copies the database to another file.
+// Copy copies the database to another JSON file.
 func (db *Database) Copy(fp string) error {
 	db.mu.Lock()
 	defer db.mu.Unlock()
-	path := db.path
-	db.path = fp
-	err := db.commit()
-	db.path = path
-	return err
-}
-
-// commit writes the database contents to a file.
-func (db *Database) commit() error {
-	db.Revision++
-	db.LastModified = time.Now().UTC()
 	if db.inMemory {
 		return nil
 	}
-	data, err := json.MarshalIndent(db, "", "  ")
+	users, err := db.listUsers()
 	if err != nil {
-		return errors.ErrDatabaseCommit.WithArgs(db.path, err)
+		return errors.ErrDatabaseCommit.WithArgs(fp, err)
+	}
+	data, err := json.MarshalIndent(&Database{
+		Version:      db.Version,
+		Policy:       db.Policy,
+		Revision:     db.Revision,
+		LastModified: db.LastModified,
+		Users:        users,
+	}, "", "  ")
+	if err != nil {
+		return errors.ErrDatabaseCommit.WithArgs(fp, err)
 	}
-	if err := os.WriteFile(db.path, []byte(data), 0600); err != nil {
-		return errors.ErrDatabaseCommit.WithArgs(db.path, err)
+	if err := fileutil.WriteFileAtomic(fp, data, 0600); err != nil {
+		return errors.ErrDatabaseCommit.WithArgs(fp, err)
 	}
 	return nil
 }
@@ -524,7 +908,7 @@ func (db *Database) AddPublicKey(r *requests.Request) error {
 	if err := user.AddPublicKey(r); err != nil {
 		return err
 	}
-	if err := db.commit(); err != nil {
+	if err := db.commit(user); err != nil {
 		return errors.ErrAddPublicKey.WithArgs(r.Key.Usage, err)
 	}
 	return nil
@@ -591,7 +975,7 @@ func (db *Database) DeletePublicKey(r *requests.Request) error {
 	if err := user.DeletePublicKey(r); err != nil {
 		return err
 	}
-	if err := db.commit(); err != nil {
+	if err := db.commit(user); err != nil {
 		return errors.ErrDeletePublicKey.WithArgs(r.Key.Usage, err)
 	}
 	return nil
@@ -634,7 +1018,7 @@ func (db *Database) AddAPIKey(r *requests.Request) error {
 			continue
 		}
 		keyPrefix := string(s[:24])
-		if _, exists := db.refAPIKey[keyPrefix]; exists {
+		if _, err := db.getUserByIndex(userIndexAPIKey, keyPrefix); err == nil {
 			continue
 		}
 		r.Response.Payload = s
@@ -643,11 +1027,13 @@ func (db *Database) AddAPIKey(r *requests.Request) error {
 		if err := user.AddAPIKey(r); err != nil {
 			return err
 		}
-		db.refAPIKey[keyPrefix] = user
+		if db.indexer == nil {
+			db.refAPIKey[keyPrefix] = user
+		}
 		break
 	}
 
-	if err := db.commit(); err != nil {
+	if err := db.commit(user); err != nil {
 		return errors.ErrAddAPIKey.WithArgs(r.Key.Usage, err)
 	}
 	return nil
@@ -665,7 +1051,7 @@ func (db *Database) DeleteAPIKey(r *requests.Request) error {
 		return err
 	}
 	delete(db.refAPIKey, r.Key.Prefix)
-	if err := db.commit(); err != nil {
+	if err := db.commit(user); err != nil {
 		return errors.ErrDeleteAPIKey.WithArgs(r.Key.Usage, err)
 	}
 	return nil
@@ -725,20 +1111,40 @@ func (db *Database) ChangeUserPassword(r *requests.Request) error {
 	if err != nil {
 		return errors.ErrChangeUserPassword.WithArgs(err)
 	}
+	if db.Policy.Password.BlockPasswordChange && !db.isPasswordExpired(user) {
+		return errors.ErrChangeUserPassword.WithArgs(
+			errors.ErrPasswordPolicyCompliance.WithArgs(&PasswordPolicyError{
+				Rules: []string{PasswordRuleBlockPasswordChange},
+			}),
+		)
+	}
+	if isHashedPassword(r.User.Password) {
+		return errors.ErrChangeUserPassword.WithArgs(errors.ErrPasswordHashedInput)
+	}
 	if err := db.checkPasswordPolicyCompliance(r.User.Password); err != nil {
 		return errors.ErrChangeUserPassword.WithArgs(err)
 	}
-	if err := user.ChangePassword(r, db.Policy.Password.KeepVersions); err != nil {
-		return err
+	if err := user.VerifyPassword(r.User.OldPassword); err != nil {
+		return errors.ErrChangeUserPassword.WithArgs(err)
+	}
+	if err := db.checkPasswordReuse(user, r.User.Password); err != nil {
+		return errors.ErrChangeUserPassword.WithArgs(err)
+	}
+	if err := user.AddPasswordWithPolicy(r.User.Password, &db.Policy.Password); err != nil {
+		return errors.ErrChangeUserPassword.WithArgs(err)
 	}
 	// if db.Policy.Password.KeepVersions
-	if err := db.commit(); err != nil {
+	if err := db.commit(user); err != nil {
 		return errors.ErrChangeUserPassword.WithArgs(err)
 	}
 	return nil
 }
 
-// UpdateUserPassword change user password.
+// UpdateUserPassword change user password. Like ImportUser, it accepts
+// pre-hashed passwords, i.e. it must not be used with user input. When the
+// password is the current password of the user, the update is skipped, so
+// that the password of a statically-defined user keeps its age and history
+// across restarts.
 func (db *Database) UpdateUserPassword(r *requests.Request) error {
 	db.mu.Lock()
 	defer db.mu.Unlock()
@@ -746,13 +1152,19 @@ func (db *Database) UpdateUserPassword(r *requests.Request) error {
 	if err != nil {
 		return errors.ErrUpdateUserPassword.WithArgs(err)
 	}
+	if !isHashedPassword(r.User.Password) && user.VerifyPassword(r.User.Password) == nil {
+		return nil
+	}
 	if err := db.checkPasswordPolicyCompliance(r.User.Password); err != nil {
 		return errors.ErrUpdateUserPassword.WithArgs(err)
 	}
-	if err := user.UpdatePassword(r, db.Policy.Password.KeepVersions); err != nil {
-		return err
+	if err := db.checkPasswordReuse(user, r.User.Password); err != nil {
+		return errors.ErrUpdateUserPassword.WithArgs(err)
+	}
+	if err := user.AddPasswordWithPolicy(r.User.Password, &db.Policy.Password); err != nil {
+		return errors.ErrUpdateUserPassword.WithArgs(err)
 	}
-	if err := db.commit(); err != nil {
+	if err := db.commit(user); err != nil {
 		return errors.ErrUpdateUserPassword.WithArgs(err)
 	}
 	return nil
@@ -764,7 +1176,7 @@ func (db *Database) IdentifyUser(r *requests.Request) error {
 	db.mu.Lock()
 	defer db.mu.Unlock()
 	user, err := db.getUser(r.User.Username)
-	if err != nil {
+	if err != nil || user.Disabled {
 		r.User.Username = "nobody"
 		r.User.Email = "nobody@localhost"
 		r.User.Challenges = []string{"password"}
@@ -778,6 +1190,9 @@ func (db *Database) IdentifyUser(r *requests.Request) error {
 	r.User.FullName = user.GetNameClaim()
 	r.User.Roles = user.GetRolesClaim()
 	r.User.Challenges = user.GetChallenges()
+	if db.isPasswordExpired(user) {
+		r.User.Challenges = append(r.User.Challenges, "password_change")
+	}
 	r.Response.Code = 200
 	return nil
 }
@@ -792,17 +1207,26 @@ func (db *Database) LookupAPIKey(r *requests.Request) error {
 		return errors.ErrLookupAPIKeyMalformedPayload
 	}
 	r.Key.Prefix = string(r.Key.Payload[:24])
-	db.mu.Lock()
-	defer db.mu.Unlock()
-	user, exists := db.refAPIKey[r.Key.Prefix]
-	if !exists {
+	db.mu.RLock()
+	user, err := db.getUserByIndex(userIndexAPIKey, r.Key.Prefix)
+	if err != nil || user.Disabled || user.IsLockedOut() {
+		db.mu.RUnlock()
 		return errors.ErrLookupAPIKeyFailed
 	}
-	if err := user.LookupAPIKey(r); err != nil {
+	err = user.LookupAPIKey(r)
+	id, username, email := user.ID, user.Username, user.GetMailClaim()
+	db.mu.RUnlock()
+	if err != nil {
+		if err := db.recordFailedAuth(id); err != nil {
+			return errors.ErrLookupAPIKeyFailed
+		}
 		return err
 	}
-	r.User.Username = user.Username
-	r.User.Email = user.GetMailClaim()
+	if err := db.recordSuccessfulAuth(id, ""); err != nil {
+		return errors.ErrLookupAPIKeyFailed
+	}
+	r.User.Username = username
+	r.User.Email = email
 	r.Response.Code = 200
 	return nil
 }
@@ -818,7 +1242,7 @@ func (db *Database) AddMfaToken(r *requests.Request) error {
 	if err := user.AddMfaToken(r); err != nil {
 		return err
 	}
-	if err := db.commit(); err != nil {
+	if err := db.commit(user); err != nil {
 		return errors.ErrAddMfaToken.WithArgs(err)
 	}
 	return nil
@@ -879,7 +1303,7 @@ func (db *Database) DeleteMfaToken(r *requests.Request) error {
 	if err := user.DeleteMfaToken(r); err != nil {
 		return err
 	}
-	if err := db.commit(); err != nil {
+	if err := db.commit(user); err != nil {
 		return errors.ErrDeleteMfaToken.WithArgs(r.MfaToken.ID, err)
 	}
 	return nil
@@ -968,8 +1392,8 @@ func (db *Database) GetPasswordPolicyRegex() string {
 func (db *Database) UserExists(username, emailAddress string) (bool, error) {
 	username = strings.ToLower(username)
 	emailAddress = strings.ToLower(emailAddress)
-	user1 := db.refUsername[username]
-	user2 := db.refEmailAddress[emailAddress]
+	user1, _ := db.getUserByIndex(userIndexUsername, username)
+	user2, _ := db.getUserByIndex(userIndexEmailAddress, emailAddress)
 	switch {
 	case user1 == nil && user2 == nil:
 		return false, nil
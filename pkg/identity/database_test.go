@@ -16,6 +16,7 @@ package identity
 
 import (
 	"fmt"
+	"os"
 	"path"
 	"path/filepath"
 	"testing"
@@ -396,6 +397,7 @@ func TestDatabaseAddUser(t *testing.T) {
 	testcases := []struct {
 		name          string
 		req           *requests.Request
+		importUser    bool
 		overwritePath string
 		want          map[string]interface{}
 		shouldErr     bool
@@ -440,6 +442,32 @@ func TestDatabaseAddUser(t *testing.T) {
 			shouldErr: true,
 			err:       errors.ErrAddUser.WithArgs(testEmail1, "email address already in use"),
 		},
+		{
+			name: "add user with hashed password",
+			req: &requests.Request{
+				User: requests.User{
+					Username: "foobar",
+					Password: "bcrypt:10:$2a$10$iqq53VjdCwknBSBrnyLd9OH1Mfh6kqPezMMy6h6F41iLdVDkj13I6",
+					Email:    "foobar@barfoo",
+				},
+			},
+			shouldErr: true,
+			err:       errors.ErrAddUser.WithArgs("foobar", errors.ErrPasswordHashedInput),
+		},
+		{
+			name: "import user with hashed password",
+			req: &requests.Request{
+				User: requests.User{
+					Username: "barfoo",
+					Password: "bcrypt:10:$2a$10$iqq53VjdCwknBSBrnyLd9OH1Mfh6kqPezMMy6h6F41iLdVDkj13I6",
+					Email:    "barfoo@foobar",
+				},
+			},
+			importUser: true,
+			want: map[string]interface{}{
+				"user_count": 3,
+			},
+		},
 
 		{
 			name: "fail committing after adding new user",
@@ -453,7 +481,7 @@ func TestDatabaseAddUser(t *testing.T) {
 			overwritePath: path.Dir(databasePath),
 			shouldErr:     true,
 			err: errors.ErrAddUser.WithArgs("foobar",
-				errors.ErrDatabaseCommit.WithArgs(path.Dir(databasePath), "open "+path.Dir(databasePath)+": is a directory"),
+				errors.ErrDatabaseCommit.WithArgs(path.Dir(databasePath), "read "+path.Dir(databasePath)+": is a directory"),
 			),
 		},
 	}
@@ -466,7 +494,11 @@ func TestDatabaseAddUser(t *testing.T) {
 			}
 			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
 			msgs = append(msgs, fmt.Sprintf("database path: %s", db.path))
-			err = db.AddUser(tc.req)
+			if tc.importUser {
+				err = db.ImportUser(tc.req)
+			} else {
+				err = db.AddUser(tc.req)
+			}
 			if tests.EvalErrWithLog(t, err, "add user", tc.shouldErr, tc.err, msgs) {
 				return
 			}
@@ -506,6 +538,19 @@ func TestDatabaseChangeUserPassword(t *testing.T) {
 			shouldErr: true,
 			err:       errors.ErrChangeUserPassword.WithArgs(errors.ErrUserPasswordInvalid),
 		},
+		{
+			name: "change user1 password to hashed password",
+			req: &requests.Request{
+				User: requests.User{
+					Username:    testUser1,
+					Email:       testEmail1,
+					OldPassword: testPwd1,
+					Password:    "bcrypt:10:$2a$10$iqq53VjdCwknBSBrnyLd9OH1Mfh6kqPezMMy6h6F41iLdVDkj13I6",
+				},
+			},
+			shouldErr: true,
+			err:       errors.ErrChangeUserPassword.WithArgs(errors.ErrPasswordHashedInput),
+		},
 		{
 			name: "change user1 password",
 			req: &requests.Request{
@@ -546,7 +591,7 @@ func TestDatabaseChangeUserPassword(t *testing.T) {
 			overwritePath: path.Dir(databasePath),
 			shouldErr:     true,
 			err: errors.ErrChangeUserPassword.WithArgs(
-				errors.ErrDatabaseCommit.WithArgs(path.Dir(databasePath), "open "+path.Dir(databasePath)+": is a directory"),
+				errors.ErrDatabaseCommit.WithArgs(path.Dir(databasePath), "read "+path.Dir(databasePath)+": is a directory"),
 			),
 		},
 	}
@@ -757,7 +802,7 @@ func TestDatabaseUserPublicKey(t *testing.T) {
 			overwritePath: path.Dir(databasePath),
 			shouldErr:     true,
 			err: errors.ErrAddPublicKey.WithArgs("ssh",
-				errors.ErrDatabaseCommit.WithArgs(path.Dir(databasePath), "open "+path.Dir(databasePath)+": is a directory"),
+				errors.ErrDatabaseCommit.WithArgs(path.Dir(databasePath), "read "+path.Dir(databasePath)+": is a directory"),
 			),
 		},
 		{
@@ -769,7 +814,7 @@ func TestDatabaseUserPublicKey(t *testing.T) {
 			overwritePath: path.Dir(databasePath),
 			shouldErr:     true,
 			err: errors.ErrDeletePublicKey.WithArgs("ssh",
-				errors.ErrDatabaseCommit.WithArgs(path.Dir(databasePath), "open "+path.Dir(databasePath)+": is a directory"),
+				errors.ErrDatabaseCommit.WithArgs(path.Dir(databasePath), "read "+path.Dir(databasePath)+": is a directory"),
 			),
 		},
 	}
@@ -1074,7 +1119,7 @@ func TestDatabaseUserMfaToken(t *testing.T) {
 			overwritePath: path.Dir(databasePath),
 			shouldErr:     true,
 			err: errors.ErrAddMfaToken.WithArgs(
-				errors.ErrDatabaseCommit.WithArgs(path.Dir(databasePath), "open "+path.Dir(databasePath)+": is a directory"),
+				errors.ErrDatabaseCommit.WithArgs(path.Dir(databasePath), "read "+path.Dir(databasePath)+": is a directory"),
 			),
 		},
 		{
@@ -1092,7 +1137,7 @@ func TestDatabaseUserMfaToken(t *testing.T) {
 			overwritePath: path.Dir(databasePath),
 			shouldErr:     true,
 			err: errors.ErrDeleteMfaToken.WithArgs("zzzzzzzzzzzzzzzzzzzzzzzzzz5h3s765Tpx5Laa",
-				errors.ErrDatabaseCommit.WithArgs(path.Dir(databasePath), "open "+path.Dir(databasePath)+": is a directory"),
+				errors.ErrDatabaseCommit.WithArgs(path.Dir(databasePath), "read "+path.Dir(databasePath)+": is a directory"),
 			),
 		},
 	}
@@ -1199,18 +1244,22 @@ func TestDatabaseGetUsers(t *testing.T) {
 				"users": []*UserMetadata{
 					{
 						ID:           "000000000000000000000000000000000001",
+						Enabled:      true,
 						Username:     "jsmith",
 						Name:         "Smith, John",
 						Email:        "jsmith@gmail.com",
 						LastModified: ts,
 						Created:      ts,
+						Roles:        []string{"viewer", "editor", "admin"},
 					},
 					{
 						ID:           "000000000000000000000000000000000002",
+						Enabled:      true,
 						Username:     "bjones",
 						Email:        "bjones@gmail.com",
 						LastModified: ts,
 						Created:      ts,
+						Roles:        []string{"viewer"},
 					},
 				},
 			},
@@ -1242,6 +1291,701 @@ func TestDatabaseGetUsers(t *testing.T) {
 	}
 }
 
+func TestDatabaseManageUsers(t *testing.T) {
+	db, err := createTestDatabase("TestDatabaseManageUsers")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	testcases := []struct {
+		name      string
+		operation string
+		username  string
+		password  string
+		roles     []string
+		want      map[string]interface{}
+		shouldErr bool
+		err       error
+	}{
+		{
+			name:      "disable user2",
+			operation: "disable",
+			username:  testUser2,
+			want: map[string]interface{}{
+				"user_count": 2,
+				"disabled":   true,
+				"enabled":    false,
+				"roles":      []string{"viewer"},
+			},
+		},
+		{
+			name:      "authenticate disabled user2",
+			operation: "authenticate",
+			username:  testUser2,
+			password:  testPwd2,
+			shouldErr: true,
+			err:       errors.ErrAuthFailed.WithArgs(errors.ErrUserDisabled),
+		},
+		{
+			name:      "enable user2",
+			operation: "enable",
+			username:  testUser2,
+			want: map[string]interface{}{
+				"user_count": 2,
+				"disabled":   false,
+				"enabled":    true,
+				"roles":      []string{"viewer"},
+			},
+		},
+		{
+			name:      "grant admin role to user2",
+			operation: "update_roles",
+			username:  testUser2,
+			roles:     []string{"authp/admin", "viewer", "authp/admin"},
+			want: map[string]interface{}{
+				"user_count": 2,
+				"disabled":   false,
+				"enabled":    true,
+				"roles":      []string{"authp/admin", "viewer"},
+			},
+		},
+		{
+			name:      "revoke admin role from the last admin user",
+			operation: "update_roles",
+			username:  testUser2,
+			roles:     []string{"viewer"},
+			shouldErr: true,
+			err:       errors.ErrUpdateUser.WithArgs(testUser2, errors.ErrLastAdminUser),
+		},
+		{
+			name:      "disable the last admin user",
+			operation: "disable",
+			username:  testUser2,
+			shouldErr: true,
+			err:       errors.ErrUpdateUser.WithArgs(testUser2, errors.ErrLastAdminUser),
+		},
+		{
+			name:      "delete the last admin user",
+			operation: "delete",
+			username:  testUser2,
+			shouldErr: true,
+			err:       errors.ErrDeleteUser.WithArgs(testUser2, errors.ErrLastAdminUser),
+		},
+		{
+			name:      "delete user1",
+			operation: "delete",
+			username:  testUser1,
+			want: map[string]interface{}{
+				"user_count": 1,
+			},
+		},
+		{
+			name:      "delete non-existing user",
+			operation: "delete",
+			username:  "foobar",
+			shouldErr: true,
+			err:       errors.ErrDeleteUser.WithArgs("foobar", errors.ErrDatabaseUserNotFound),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			msgs = append(msgs, fmt.Sprintf("database path: %s", db.path))
+			req := &requests.Request{
+				User: requests.User{
+					Username: tc.username,
+					Password: tc.password,
+					Roles:    tc.roles,
+				},
+				Query: requests.Query{
+					ID: tc.username,
+				},
+			}
+			var revision int
+			if user, err := db.getUser(tc.username); err == nil {
+				req.Query.ID = user.ID
+				revision = user.Revision
+			}
+			switch tc.operation {
+			case "authenticate":
+				err = db.AuthenticateUser(req)
+			case "disable":
+				err = db.DisableUser(req)
+			case "enable":
+				err = db.EnableUser(req)
+			case "update_roles":
+				err = db.UpdateUserRoles(req)
+			case "delete":
+				err = db.DeleteUser(req)
+			default:
+				t.Fatalf("unsupported operation: %s", tc.operation)
+			}
+			if tests.EvalErrWithLog(t, err, tc.operation, tc.shouldErr, tc.err, msgs) {
+				// The rejected changes leave the user intact.
+				if user, err := db.getUser(tc.username); err == nil && user.Revision != revision {
+					t.Fatalf("user revision changed from %d to %d", revision, user.Revision)
+				}
+				return
+			}
+			got := make(map[string]interface{})
+			got["user_count"] = db.GetUserCount()
+			if user, err := db.getUser(tc.username); err == nil {
+				got["disabled"] = user.Disabled
+				got["enabled"] = user.Enabled
+				got["roles"] = user.GetRolesClaim()
+			}
+			tests.EvalObjectsWithLog(t, "output", tc.want, got, msgs)
+		})
+	}
+}
+
+func TestDatabaseLockout(t *testing.T) {
+	db, err := createTestDatabase("TestDatabaseLockout")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	policy := &LockoutPolicy{MaxAttempts: 3, Duration: 60}
+	if err := policy.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	db.SetLockoutPolicy(policy)
+
+	testcases := []struct {
+		name      string
+		operation string
+		password  string
+		want      map[string]interface{}
+		shouldErr bool
+		err       error
+	}{
+		{
+			name:      "first failed attempt",
+			operation: "authenticate",
+			password:  testPwd2,
+			shouldErr: true,
+			err:       errors.ErrAuthFailed.WithArgs(errors.ErrUserPasswordInvalid),
+		},
+		{
+			name:      "successful attempt resets failed attempts",
+			operation: "authenticate",
+			password:  testPwd1,
+			want: map[string]interface{}{
+				"locked_out":      false,
+				"failed_attempts": 0,
+			},
+		},
+		{
+			name:      "first failed attempt after reset",
+			operation: "authenticate",
+			password:  testPwd2,
+			shouldErr: true,
+			err:       errors.ErrAuthFailed.WithArgs(errors.ErrUserPasswordInvalid),
+		},
+		{
+			name:      "second failed attempt after reset",
+			operation: "authenticate",
+			password:  testPwd2,
+			shouldErr: true,
+			err:       errors.ErrAuthFailed.WithArgs(errors.ErrUserPasswordInvalid),
+		},
+		{
+			name:      "third failed attempt after reset locks out the user",
+			operation: "authenticate",
+			password:  testPwd2,
+			shouldErr: true,
+			err:       errors.ErrAuthFailed.WithArgs(errors.ErrUserPasswordInvalid),
+		},
+		{
+			name:      "valid password is rejected for locked out user",
+			operation: "authenticate",
+			password:  testPwd1,
+			shouldErr: true,
+			err:       errors.ErrAuthFailed.WithArgs(errors.ErrUserPasswordInvalid),
+		},
+		{
+			name:      "reload database with lockout state",
+			operation: "reload",
+			want: map[string]interface{}{
+				"locked_out":      true,
+				"failed_attempts": 0,
+			},
+		},
+		{
+			name:      "admin unlocks the user",
+			operation: "unlock",
+			want: map[string]interface{}{
+				"locked_out":      false,
+				"failed_attempts": 0,
+			},
+		},
+		{
+			name:      "authenticate unlocked user",
+			operation: "authenticate",
+			password:  testPwd1,
+			want: map[string]interface{}{
+				"locked_out":      false,
+				"failed_attempts": 0,
+			},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			msgs = append(msgs, fmt.Sprintf("database path: %s", db.path))
+			req := &requests.Request{
+				User: requests.User{
+					Username: testUser1,
+					Email:    testEmail1,
+					Password: tc.password,
+				},
+			}
+			switch tc.operation {
+			case "authenticate":
+				err = db.AuthenticateUser(req)
+			case "unlock":
+				err = db.UnlockUser(req)
+			case "reload":
+				db, err = NewDatabase(db.path)
+			default:
+				t.Fatalf("unsupported operation: %s", tc.operation)
+			}
+			if tests.EvalErrWithLog(t, err, tc.operation, tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			user, err := db.getUser(testUser1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string]interface{})
+			got["locked_out"] = user.IsLockedOut()
+			got["failed_attempts"] = 0
+			if user.Lockout != nil {
+				got["failed_attempts"] = user.Lockout.FailedAttempts
+			}
+			tests.EvalObjectsWithLog(t, "output", tc.want, got, msgs)
+		})
+	}
+}
+
+func TestDatabasePasswordPolicy(t *testing.T) {
+	db, err := createTestDatabase("TestDatabasePasswordPolicy")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	db.Policy.Password.RequireUppercase = true
+	db.Policy.Password.RequireNumber = true
+	db.Policy.Password.BlockReuse = true
+	db.Policy.Password.MaxAgeDays = 90
+
+	testcases := []struct {
+		name        string
+		operation   string
+		oldPassword string
+		password    string
+		blockChange bool
+		allowReuse  bool
+		want        map[string]interface{}
+		shouldErr   bool
+		err         error
+	}{
+		{
+			name:      "add user with non-compliant password",
+			operation: "add",
+			password:  "foobarfoobar",
+			shouldErr: true,
+			err: errors.ErrAddUser.WithArgs(testUser2+"x", errors.ErrPasswordPolicyCompliance.WithArgs(
+				db.Policy.Password.Check("foobarfoobar"),
+			)),
+		},
+		{
+			name:        "change password to non-compliant password",
+			operation:   "change",
+			oldPassword: testPwd1,
+			password:    "foobarfoobar",
+			shouldErr:   true,
+			err: errors.ErrChangeUserPassword.WithArgs(errors.ErrPasswordPolicyCompliance.WithArgs(
+				db.Policy.Password.Check("foobarfoobar"),
+			)),
+		},
+		{
+			name:        "change password to compliant password",
+			operation:   "change",
+			oldPassword: testPwd1,
+			password:    "Foo.Bar-123",
+			want: map[string]interface{}{
+				"challenges": []string{"password"},
+			},
+		},
+		{
+			name:        "change password again",
+			operation:   "change",
+			oldPassword: "Foo.Bar-123",
+			password:    "Foo.Bar-456",
+			want: map[string]interface{}{
+				"challenges": []string{"password"},
+			},
+		},
+		{
+			name:        "change password to previously used password",
+			operation:   "change",
+			oldPassword: "Foo.Bar-456",
+			password:    "Foo.Bar-123",
+			shouldErr:   true,
+			err: errors.ErrChangeUserPassword.WithArgs(errors.ErrPasswordPolicyCompliance.WithArgs(
+				&PasswordPolicyError{Rules: []string{PasswordRuleBlockReuse}},
+			)),
+		},
+		{
+			name:      "update password to previously used password",
+			operation: "update",
+			password:  "Foo.Bar-123",
+			shouldErr: true,
+			err: errors.ErrUpdateUserPassword.WithArgs(errors.ErrPasswordPolicyCompliance.WithArgs(
+				&PasswordPolicyError{Rules: []string{PasswordRuleBlockReuse}},
+			)),
+		},
+		{
+			name:      "update password to current password",
+			operation: "update",
+			password:  "Foo.Bar-456",
+			want: map[string]interface{}{
+				"challenges":     []string{"password"},
+				"password_added": false,
+			},
+		},
+		{
+			name:       "update password to current password when reuse is allowed",
+			operation:  "update",
+			password:   "Foo.Bar-456",
+			allowReuse: true,
+			want: map[string]interface{}{
+				"challenges":     []string{"password"},
+				"password_added": false,
+			},
+		},
+		{
+			name:        "change password when password change is blocked",
+			operation:   "change",
+			oldPassword: "Foo.Bar-456",
+			password:    "Foo.Bar-789",
+			blockChange: true,
+			shouldErr:   true,
+			err: errors.ErrChangeUserPassword.WithArgs(errors.ErrPasswordPolicyCompliance.WithArgs(
+				&PasswordPolicyError{Rules: []string{PasswordRuleBlockPasswordChange}},
+			)),
+		},
+		{
+			name:      "expired password requires password change",
+			operation: "expire",
+			want: map[string]interface{}{
+				"challenges": []string{"password", "password_change"},
+			},
+		},
+		{
+			name:        "change expired password when password change is blocked",
+			operation:   "change",
+			oldPassword: "Foo.Bar-456",
+			password:    "Foo.Bar-789",
+			blockChange: true,
+			want: map[string]interface{}{
+				"challenges": []string{"password"},
+			},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			msgs = append(msgs, fmt.Sprintf("database path: %s", db.path))
+			var err error
+			db.Policy.Password.BlockPasswordChange = tc.blockChange
+			db.Policy.Password.BlockReuse = !tc.allowReuse
+			req := &requests.Request{
+				User: requests.User{
+					Username:    testUser1,
+					Email:       testEmail1,
+					OldPassword: tc.oldPassword,
+					Password:    tc.password,
+				},
+			}
+			current, err := db.getUser(testUser1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			passwordVersions := len(current.Passwords)
+			switch tc.operation {
+			case "add":
+				req.User.Username = testUser2 + "x"
+				req.User.Email = "x" + testEmail2
+				err = db.AddUser(req)
+			case "change":
+				err = db.ChangeUserPassword(req)
+			case "update":
+				err = db.UpdateUserPassword(req)
+			case "expire":
+				var user *User
+				user, err = db.getUser(testUser1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				user.Passwords[0].CreatedAt = time.Now().UTC().Add(-91 * 24 * time.Hour)
+			default:
+				t.Fatalf("unsupported operation: %s", tc.operation)
+			}
+			if tests.EvalErrWithLog(t, err, tc.operation, tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			req = &requests.Request{User: requests.User{Username: testUser1}}
+			if err := db.IdentifyUser(req); err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string]interface{})
+			got["challenges"] = req.User.Challenges
+			if _, exists := tc.want["password_added"]; exists {
+				got["password_added"] = len(current.Passwords) != passwordVersions
+			}
+			tests.EvalObjectsWithLog(t, "output", tc.want, got, msgs)
+		})
+	}
+}
+
+func TestDatabaseRecovery(t *testing.T) {
+	db, err := createTestDatabase("TestDatabaseRecovery")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	db.Policy.Password.RequireUppercase = true
+	db.Policy.Password.BlockReuse = true
+
+	testcases := []struct {
+		name        string
+		operation   string
+		username    string
+		email       string
+		password    string
+		fingerprint string
+		want        map[string]interface{}
+		shouldErr   bool
+		err         error
+	}{
+		{
+			name:      "lookup user by email address",
+			operation: "lookup",
+			email:     testEmail1,
+			want: map[string]interface{}{
+				"username":  testUser1,
+				"email":     testEmail1,
+				"full_name": testFullName1,
+			},
+		},
+		{
+			name:      "lookup user by unknown email address",
+			operation: "lookup",
+			email:     "foo@bar.com",
+			shouldErr: true,
+			err:       errors.ErrLookupUser.WithArgs("foo@bar.com", errors.ErrDatabaseUserNotFound),
+		},
+		{
+			name:      "reset password with mismatched identity",
+			operation: "reset",
+			username:  testUser1,
+			email:     testEmail2,
+			password:  "Foo.Bar-123",
+			shouldErr: true,
+			err:       errors.ErrResetUserPassword.WithArgs(errors.ErrDatabaseInvalidUser),
+		},
+		{
+			name:        "reset password with stale password fingerprint",
+			operation:   "reset",
+			username:    testUser1,
+			email:       testEmail1,
+			password:    "Foo.Bar-123",
+			fingerprint: "foobar",
+			shouldErr:   true,
+			err:         errors.ErrResetUserPassword.WithArgs(errors.ErrUserPasswordChanged),
+		},
+		{
+			name:      "reset password with hashed password",
+			operation: "reset",
+			username:  testUser1,
+			email:     testEmail1,
+			password:  "bcrypt:10:$2a$10$iqq53VjdCwknBSBrnyLd9OH1Mfh6kqPezMMy6h6F41iLdVDkj13I6",
+			shouldErr: true,
+			err:       errors.ErrResetUserPassword.WithArgs(errors.ErrPasswordHashedInput),
+		},
+		{
+			name:      "reset password with non-compliant password",
+			operation: "reset",
+			username:  testUser1,
+			email:     testEmail1,
+			password:  "foobarfoobar",
+			shouldErr: true,
+			err: errors.ErrResetUserPassword.WithArgs(errors.ErrPasswordPolicyCompliance.WithArgs(
+				db.Policy.Password.Check("foobarfoobar"),
+			)),
+		},
+		{
+			name:      "reset password",
+			operation: "reset",
+			username:  testUser1,
+			email:     testEmail1,
+			password:  "Foo.Bar-123",
+			want: map[string]interface{}{
+				"verified": true,
+			},
+		},
+		{
+			name:      "reset password to previously used password",
+			operation: "reset",
+			username:  testUser1,
+			email:     testEmail1,
+			password:  "Foo.Bar-123",
+			shouldErr: true,
+			err: errors.ErrResetUserPassword.WithArgs(errors.ErrPasswordPolicyCompliance.WithArgs(
+				&PasswordPolicyError{Rules: []string{PasswordRuleBlockReuse}},
+			)),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			msgs = append(msgs, fmt.Sprintf("database path: %s", db.path))
+			var err error
+			got := make(map[string]interface{})
+			req := &requests.Request{
+				User: requests.User{
+					Username: tc.username,
+					Email:    tc.email,
+					Password: tc.password,
+				},
+			}
+			switch tc.operation {
+			case "lookup":
+				err = db.LookupUser(req)
+				got["username"] = req.User.Username
+				got["email"] = req.User.Email
+				got["full_name"] = req.User.FullName
+			case "reset":
+				req.User.PasswordFingerprint = tc.fingerprint
+				if user, err := db.getUser(tc.username); err == nil && tc.fingerprint == "" {
+					req.User.PasswordFingerprint = user.GetPasswordFingerprint()
+				}
+				err = db.ResetUserPassword(req)
+				if err == nil {
+					user, _ := db.getUser(tc.username)
+					got["verified"] = user.VerifyPassword(tc.password) == nil
+				}
+			default:
+				t.Fatalf("unsupported operation: %s", tc.operation)
+			}
+			if tests.EvalErrWithLog(t, err, tc.operation, tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			tests.EvalObjectsWithLog(t, "output", tc.want, got, msgs)
+		})
+	}
+}
+
+func TestDatabasePasswordRehash(t *testing.T) {
+	db, err := createTestDatabase("TestDatabasePasswordRehash")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+
+	testcases := []struct {
+		name      string
+		algorithm string
+		params    map[string]interface{}
+		hash      string
+		password  string
+		want      map[string]interface{}
+		shouldErr bool
+		err       error
+	}{
+		{
+			name:     "import ssha password and rehash with bcrypt",
+			hash:     "{SSHA}lRRmNs0Qv604LdZlMjiFOG615m8xMjM0NTY3OA==",
+			password: "foobar",
+			want: map[string]interface{}{
+				"algorithm": "bcrypt",
+				"match":     true,
+			},
+		},
+		{
+			name:      "rehash bcrypt password with argon2id",
+			algorithm: "argon2id",
+			params:    map[string]interface{}{"time": 1, "memory": 1024, "threads": 1},
+			password:  "foobar",
+			want: map[string]interface{}{
+				"algorithm": "argon2id",
+				"match":     true,
+			},
+		},
+		{
+			name:      "rehash argon2id password with scrypt",
+			algorithm: "scrypt",
+			params:    map[string]interface{}{"n": 1024},
+			password:  "foobar",
+			want: map[string]interface{}{
+				"algorithm": "scrypt",
+				"match":     true,
+			},
+		},
+		{
+			name:      "failed authentication does not rehash password",
+			algorithm: "argon2id",
+			params:    map[string]interface{}{"time": 1, "memory": 1024, "threads": 1},
+			password:  "barfoo",
+			shouldErr: true,
+			err:       errors.ErrAuthFailed.WithArgs(errors.ErrUserPasswordInvalid),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			msgs = append(msgs, fmt.Sprintf("database path: %s", db.path))
+			if tc.hash != "" {
+				req := &requests.Request{
+					User: requests.User{
+						Username: testUser1,
+						Email:    testEmail1,
+						Password: tc.hash,
+					},
+				}
+				if err := db.UpdateUserPassword(req); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			db.Policy.Password.Algorithm = tc.algorithm
+			db.Policy.Password.AlgorithmParams = tc.params
+			user, err := db.getUser(testUser1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			createdAt := user.Passwords[0].CreatedAt
+
+			req := &requests.Request{
+				User: requests.User{
+					Username: testUser1,
+					Password: tc.password,
+				},
+			}
+			err = db.AuthenticateUser(req)
+			if tests.EvalErrWithLog(t, err, "authenticate", tc.shouldErr, tc.err, msgs) {
+				if user.Passwords[0].Algorithm == tc.algorithm {
+					t.Fatalf("unexpected rehash after failed authentication")
+				}
+				return
+			}
+			if !user.Passwords[0].CreatedAt.Equal(createdAt) {
+				t.Fatalf("unexpected password creation time change")
+			}
+			got := make(map[string]interface{})
+			got["algorithm"] = user.Passwords[0].Algorithm
+			got["match"] = user.Passwords[0].Match(tc.password)
+			tests.EvalObjectsWithLog(t, "output", tc.want, got, msgs)
+		})
+	}
+}
+
 func TestDatabasePolicy(t *testing.T) {
 	var databasePath string
 	db, err := createTestDatabase("TestDatabasePolicy")
@@ -1301,3 +2045,121 @@ func TestDatabasePolicy(t *testing.T) {
 		})
 	}
 }
+
+func TestDatabaseStorage(t *testing.T) {
+	db1, err := createTestDatabase("TestDatabaseStorage")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	if err := db1.SetBackupCount(2); err != nil {
+		t.Fatal(err)
+	}
+	db2, err := NewDatabase(db1.GetPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db2.SetBackupCount(2); err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := []struct {
+		name      string
+		db        *Database
+		reload    *Database
+		username  string
+		want      map[string]interface{}
+		shouldErr bool
+		err       error
+	}{
+		{
+			name:     "add user with first writer",
+			db:       db1,
+			username: "foobar1",
+			want: map[string]interface{}{
+				"revision":   db1.GetRevision() + 1,
+				"user_count": 3,
+				"backups":    []bool{true, false},
+			},
+		},
+		{
+			name:      "add user with second writer having stale revision",
+			db:        db2,
+			username:  "foobar2",
+			shouldErr: true,
+			err: errors.ErrAddUser.WithArgs("foobar2", errors.ErrDatabaseRevisionConflict.WithArgs(
+				db1.GetPath(), db1.GetRevision()+1, db1.GetRevision(),
+			)),
+		},
+		{
+			name:     "add user with second writer after reload on conflict",
+			db:       db2,
+			username: "foobar2",
+			want: map[string]interface{}{
+				"revision":   db1.GetRevision() + 2,
+				"user_count": 4,
+				"backups":    []bool{true, true},
+			},
+		},
+		{
+			name:     "add user with first writer after reload",
+			db:       db1,
+			reload:   db1,
+			username: "foobar3",
+			want: map[string]interface{}{
+				"revision":   db1.GetRevision() + 3,
+				"user_count": 5,
+				"backups":    []bool{true, true},
+			},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			msgs = append(msgs, fmt.Sprintf("database path: %s", tc.db.path))
+			if tc.reload != nil {
+				reloaded, err := tc.reload.Reload()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reloaded {
+					t.Fatalf("expected database reload")
+				}
+			}
+			req := &requests.Request{
+				User: requests.User{
+					Username: tc.username,
+					Password: "Foo.Bar-123",
+					Email:    tc.username + "@localdomain.local",
+					Roles:    []string{"viewer"},
+				},
+			}
+			err := tc.db.AddUser(req)
+			if tests.EvalErrWithLog(t, err, "add user", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+
+			onDisk, err := NewDatabase(tc.db.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string]interface{})
+			got["revision"] = onDisk.GetRevision()
+			got["user_count"] = onDisk.GetUserCount()
+			backups := []bool{}
+			for i := 1; i <= 2; i++ {
+				_, err := os.Stat(fmt.Sprintf("%s.%d", tc.db.path, i))
+				backups = append(backups, err == nil)
+			}
+			got["backups"] = backups
+			tests.EvalObjectsWithLog(t, "output", tc.want, got, msgs)
+
+			if reloaded, err := tc.db.Reload(); err != nil || reloaded {
+				t.Fatalf("unexpected reload of unchanged database: %v, %v", reloaded, err)
+			}
+			matches, _ := filepath.Glob(filepath.Join(filepath.Dir(tc.db.path), ".*.tmp-*"))
+			if len(matches) > 0 {
+				t.Fatalf("unexpected temporary files: %v", matches)
+			}
+		})
+	}
+}
@@ -15,19 +15,122 @@
 package identity
 
 import (
+	"fmt"
 	"time"
 )
 
+const (
+	defaultLockoutDuration    = 900
+	defaultLockoutMaxDuration = 86400
+)
+
 // LockoutState indicates whether user identity is temporarily
 // disabled. If the identity is lockedout, when does the
 // lockout end.
 type LockoutState struct {
-	Enabled   bool      `json:"enabled,omitempty" xml:"enabled,omitempty" yaml:"enabled,omitempty"`
-	StartTime time.Time `json:"start_time,omitempty" xml:"start_time,omitempty" yaml:"start_time,omitempty"`
-	EndTime   time.Time `json:"end_time,omitempty" xml:"end_time,omitempty" yaml:"end_time,omitempty"`
+	Enabled        bool      `json:"enabled,omitempty" xml:"enabled,omitempty" yaml:"enabled,omitempty"`
+	StartTime      time.Time `json:"start_time,omitempty" xml:"start_time,omitempty" yaml:"start_time,omitempty"`
+	EndTime        time.Time `json:"end_time,omitempty" xml:"end_time,omitempty" yaml:"end_time,omitempty"`
+	FailedAttempts int       `json:"failed_attempts,omitempty" xml:"failed_attempts,omitempty" yaml:"failed_attempts,omitempty"`
+	LastFailure    time.Time `json:"last_failure,omitempty" xml:"last_failure,omitempty" yaml:"last_failure,omitempty"`
+	// Lockouts is the number of consecutive lockouts. It drives the
+	// progressive backoff and resets following a successful authentication.
+	Lockouts int `json:"lockouts,omitempty" xml:"lockouts,omitempty" yaml:"lockouts,omitempty"`
+}
+
+// LockoutPolicy is the brute-force protection policy of an identity store.
+// The lockout is disabled when MaxAttempts is zero.
+type LockoutPolicy struct {
+	// MaxAttempts is the number of consecutive failed authentication
+	// attempts after which the user is locked out.
+	MaxAttempts int `json:"max_attempts,omitempty" xml:"max_attempts,omitempty" yaml:"max_attempts,omitempty"`
+	// Duration is the lockout duration in seconds.
+	Duration int `json:"duration,omitempty" xml:"duration,omitempty" yaml:"duration,omitempty"`
+	// ProgressiveBackoff doubles the lockout duration for every consecutive
+	// lockout, up to MaxDuration.
+	ProgressiveBackoff bool `json:"progressive_backoff,omitempty" xml:"progressive_backoff,omitempty" yaml:"progressive_backoff,omitempty"`
+	// MaxDuration is the maximum lockout duration in seconds.
+	MaxDuration int `json:"max_duration,omitempty" xml:"max_duration,omitempty" yaml:"max_duration,omitempty"`
 }
 
 // NewLockoutState returns an instance of LockoutState.
 func NewLockoutState() *LockoutState {
 	return &LockoutState{}
 }
+
+// Validate validates and sets the defaults of LockoutPolicy.
+func (p *LockoutPolicy) Validate() error {
+	if p.MaxAttempts < 0 {
+		return fmt.Errorf("max attempts must not be negative")
+	}
+	if p.Duration < 0 {
+		return fmt.Errorf("duration must not be negative")
+	}
+	if p.MaxDuration < 0 {
+		return fmt.Errorf("max duration must not be negative")
+	}
+	if p.Duration == 0 {
+		p.Duration = defaultLockoutDuration
+	}
+	if p.MaxDuration == 0 {
+		p.MaxDuration = defaultLockoutMaxDuration
+	}
+	if p.MaxDuration < p.Duration {
+		return fmt.Errorf("max duration %d is less than duration %d", p.MaxDuration, p.Duration)
+	}
+	return nil
+}
+
+// Enabled returns true when the policy locks out users.
+func (p *LockoutPolicy) Enabled() bool {
+	if p == nil {
+		return false
+	}
+	return p.MaxAttempts > 0
+}
+
+// GetDuration returns the duration of a lockout based on the number of
+// preceding consecutive lockouts.
+func (p *LockoutPolicy) GetDuration(lockouts int) time.Duration {
+	d := time.Duration(p.Duration) * time.Second
+	maxDuration := time.Duration(p.MaxDuration) * time.Second
+	if !p.ProgressiveBackoff {
+		return d
+	}
+	for i := 0; i < lockouts; i++ {
+		d = d * 2
+		if d >= maxDuration {
+			return maxDuration
+		}
+	}
+	return d
+}
+
+// Active returns true if the lockout is in effect at the provided time.
+func (l *LockoutState) Active(now time.Time) bool {
+	if l == nil || !l.Enabled {
+		return false
+	}
+	return now.Before(l.EndTime)
+}
+
+// RecordFailure registers failed authentication attempt. It returns true
+// when the failure results in a lockout.
+func (l *LockoutState) RecordFailure(p *LockoutPolicy, now time.Time) bool {
+	if l.Enabled && !l.Active(now) {
+		// The previous lockout expired.
+		l.Enabled = false
+		l.FailedAttempts = 0
+	}
+	l.FailedAttempts++
+	l.LastFailure = now
+	if l.FailedAttempts < p.MaxAttempts {
+		return false
+	}
+	l.Enabled = true
+	l.StartTime = now
+	l.EndTime = now.Add(p.GetDuration(l.Lockouts))
+	l.Lockouts++
+	l.FailedAttempts = 0
+	return true
+}
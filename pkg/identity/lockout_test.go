@@ -15,9 +15,120 @@
 package identity
 
 import (
+	"fmt"
 	"testing"
+	"time"
+
+	"github.com/greenpau/go-authcrunch/internal/tests"
 )
 
 func TestNewLockoutState(t *testing.T) {
 	NewLockoutState()
 }
+
+func TestLockoutPolicy(t *testing.T) {
+	testcases := []struct {
+		name      string
+		policy    *LockoutPolicy
+		lockouts  []int
+		want      map[string]interface{}
+		shouldErr bool
+		err       error
+	}{
+		{
+			name:     "test default durations",
+			policy:   &LockoutPolicy{MaxAttempts: 3},
+			lockouts: []int{0, 1, 5},
+			want: map[string]interface{}{
+				"enabled":   true,
+				"durations": []time.Duration{15 * time.Minute, 15 * time.Minute, 15 * time.Minute},
+			},
+		},
+		{
+			name: "test progressive backoff",
+			policy: &LockoutPolicy{
+				MaxAttempts:        3,
+				Duration:           60,
+				ProgressiveBackoff: true,
+				MaxDuration:        300,
+			},
+			lockouts: []int{0, 1, 2, 3, 10},
+			want: map[string]interface{}{
+				"enabled": true,
+				"durations": []time.Duration{
+					time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute,
+				},
+			},
+		},
+		{
+			name:   "test disabled policy",
+			policy: &LockoutPolicy{},
+			want: map[string]interface{}{
+				"enabled": false,
+			},
+		},
+		{
+			name:      "test negative max attempts",
+			policy:    &LockoutPolicy{MaxAttempts: -1},
+			shouldErr: true,
+			err:       fmt.Errorf("max attempts must not be negative"),
+		},
+		{
+			name:      "test max duration less than duration",
+			policy:    &LockoutPolicy{MaxAttempts: 1, Duration: 600, MaxDuration: 60},
+			shouldErr: true,
+			err:       fmt.Errorf("max duration 60 is less than duration 600"),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			err := tc.policy.Validate()
+			if tests.EvalErrWithLog(t, err, "validate", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			got := make(map[string]interface{})
+			got["enabled"] = tc.policy.Enabled()
+			if len(tc.lockouts) > 0 {
+				var durations []time.Duration
+				for _, i := range tc.lockouts {
+					durations = append(durations, tc.policy.GetDuration(i))
+				}
+				got["durations"] = durations
+			}
+			tests.EvalObjectsWithLog(t, "output", tc.want, got, msgs)
+		})
+	}
+}
+
+func TestLockoutStateRecordFailure(t *testing.T) {
+	policy := &LockoutPolicy{MaxAttempts: 2, Duration: 60, ProgressiveBackoff: true}
+	if err := policy.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC()
+	state := NewLockoutState()
+
+	if state.RecordFailure(policy, now) {
+		t.Fatalf("unexpected lockout after first failure")
+	}
+	if !state.RecordFailure(policy, now) {
+		t.Fatalf("expected lockout after second failure")
+	}
+	if !state.Active(now.Add(59 * time.Second)) {
+		t.Fatalf("expected active lockout")
+	}
+	if state.Active(now.Add(61 * time.Second)) {
+		t.Fatalf("unexpected active lockout after expiry")
+	}
+
+	// The second lockout lasts twice as long.
+	now = now.Add(2 * time.Minute)
+	state.RecordFailure(policy, now)
+	if !state.RecordFailure(policy, now) {
+		t.Fatalf("expected lockout after fourth failure")
+	}
+	if got := state.EndTime.Sub(state.StartTime); got != 2*time.Minute {
+		t.Fatalf("unexpected lockout duration: %v", got)
+	}
+}
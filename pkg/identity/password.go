@@ -43,7 +43,11 @@ func NewPassword(s string) (*Password, error) {
 }
 
 // NewPasswordWithOptions returns an instance of Password based on the
-// provided parameters.
+// provided parameters. The supported algorithms are bcrypt, argon2id and
+// scrypt. The bcrypt algorithm accepts "cost" parameter. The argon2id
+// algorithm accepts "time", "memory" (in KiB), "threads", "key_length" and
+// "salt_length" parameters. The scrypt algorithm accepts "n", "r", "p",
+// "key_length" and "salt_length" parameters.
 func NewPasswordWithOptions(s, purpose, algo string, params map[string]interface{}) (*Password, error) {
 	p := &Password{
 		Purpose:   purpose,
@@ -53,11 +57,15 @@ func NewPasswordWithOptions(s, purpose, algo string, params map[string]interface
 
 	if params != nil {
 		if v, exists := params["cost"]; exists {
-			p.Cost = v.(int)
+			cost, err := getIntParam(v)
+			if err != nil {
+				return nil, errors.ErrPasswordGenerate.WithArgs(err)
+			}
+			p.Cost = cost
 		}
 	}
 
-	if err := p.hash(s); err != nil {
+	if err := p.hash(s, params); err != nil {
 		return nil, err
 	}
 	return p, nil
@@ -71,7 +79,7 @@ func (p *Password) Disable() {
 	p.DisabledAt = time.Now().UTC()
 }
 
-func (p *Password) hash(s string) error {
+func (p *Password) hash(s string, params map[string]interface{}) error {
 	s = strings.TrimSpace(s)
 	if s == "" {
 		return errors.ErrPasswordEmpty
@@ -95,10 +103,31 @@ func (p *Password) hash(s string) error {
 		return nil
 	}
 
+	// Handle the hashes imported from other systems.
+	if algo := getHashedPasswordAlgorithm(s); algo != "" {
+		switch algo {
+		case "bcrypt":
+			p.Cost = getBcryptCost(s)
+			if p.Cost == 0 {
+				return errors.ErrPasswordHashed.WithArgs("malformed bcrypt hash")
+			}
+		case "argon2id", "scrypt":
+			if _, _, _, err := parsePHC(algo, s); err != nil {
+				return errors.ErrPasswordHashed.WithArgs(err)
+			}
+			p.Cost = 0
+		default:
+			p.Cost = 0
+		}
+		p.Algorithm = algo
+		p.Hash = s
+		return nil
+	}
+
 	switch p.Algorithm {
 	case "bcrypt":
 		if p.Cost < 8 {
-			p.Cost = 10
+			p.Cost = defaultBcryptCost
 		}
 		ph, err := bcrypt.GenerateFromPassword([]byte(s), p.Cost)
 		if err != nil {
@@ -106,6 +135,22 @@ func (p *Password) hash(s string) error {
 		}
 		p.Hash = string(ph)
 		return nil
+	case "argon2id", "scrypt":
+		hp, err := newHashParams(p.Algorithm, params)
+		if err != nil {
+			return errors.ErrPasswordGenerate.WithArgs(err)
+		}
+		var ph string
+		if p.Algorithm == "argon2id" {
+			ph, err = hashArgon2id(s, hp)
+		} else {
+			ph, err = hashScrypt(s, hp)
+		}
+		if err != nil {
+			return errors.ErrPasswordGenerate.WithArgs(err)
+		}
+		p.Hash = ph
+		return nil
 	case "":
 		return errors.ErrPasswordEmptyAlgorithm
 	}
@@ -114,8 +159,55 @@ func (p *Password) hash(s string) error {
 
 // Match returns true when the provided password matches the user.
 func (p *Password) Match(s string) bool {
-	if err := bcrypt.CompareHashAndPassword([]byte(p.Hash), []byte(s)); err == nil {
+	switch p.Algorithm {
+	case "", "bcrypt":
+		if err := bcrypt.CompareHashAndPassword([]byte(p.Hash), []byte(s)); err == nil {
+			return true
+		}
+	case "argon2id":
+		return matchArgon2id(p.Hash, s)
+	case "scrypt":
+		return matchScrypt(p.Hash, s)
+	case "ssha":
+		return matchSSHA(p.Hash, s)
+	case "sha512_crypt":
+		return matchSha512Crypt(p.Hash, s)
+	}
+	return false
+}
+
+// NeedsRehash returns true when the password was hashed with an algorithm
+// or parameters other than the provided ones.
+func (p *Password) NeedsRehash(algo string, params map[string]interface{}) bool {
+	if algo == "" {
+		algo = "bcrypt"
+	}
+	current := p.Algorithm
+	if current == "" {
+		current = "bcrypt"
+	}
+	if current != algo {
 		return true
 	}
+	switch algo {
+	case "bcrypt":
+		cost := defaultBcryptCost
+		if v, exists := params["cost"]; exists {
+			if i, err := getIntParam(v); err == nil && i >= 8 {
+				cost = i
+			}
+		}
+		return getBcryptCost(p.Hash) != cost
+	case "argon2id", "scrypt":
+		want, err := newHashParams(algo, params)
+		if err != nil {
+			return false
+		}
+		got, _, _, err := parsePHC(algo, p.Hash)
+		if err != nil {
+			return true
+		}
+		return *got != *want
+	}
 	return false
 }
@@ -0,0 +1,422 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identity
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+// The default parameters of the password hashing algorithms.
+const (
+	defaultBcryptCost       = 10
+	defaultArgon2Time       = 3
+	defaultArgon2Memory     = 64 * 1024
+	defaultArgon2Threads    = 4
+	defaultScryptN          = 32768
+	defaultScryptR          = 8
+	defaultScryptP          = 1
+	defaultHashKeyLength    = 32
+	defaultHashSaltLength   = 16
+	defaultSha512CryptRound = 5000
+)
+
+// hashParams holds the parameters of argon2id and scrypt hashes.
+type hashParams struct {
+	time       int
+	memory     int
+	threads    int
+	n          int
+	r          int
+	p          int
+	keyLength  int
+	saltLength int
+}
+
+func newHashParams(algo string, params map[string]interface{}) (*hashParams, error) {
+	hp := &hashParams{
+		keyLength:  defaultHashKeyLength,
+		saltLength: defaultHashSaltLength,
+	}
+	switch algo {
+	case "argon2id":
+		hp.time = defaultArgon2Time
+		hp.memory = defaultArgon2Memory
+		hp.threads = defaultArgon2Threads
+	case "scrypt":
+		hp.n = defaultScryptN
+		hp.r = defaultScryptR
+		hp.p = defaultScryptP
+	}
+	for k, v := range params {
+		i, err := getIntParam(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s parameter %q: %v", algo, k, err)
+		}
+		switch k {
+		case "time":
+			hp.time = i
+		case "memory":
+			hp.memory = i
+		case "threads":
+			hp.threads = i
+		case "n":
+			hp.n = i
+		case "r":
+			hp.r = i
+		case "p":
+			hp.p = i
+		case "key_length":
+			hp.keyLength = i
+		case "salt_length":
+			hp.saltLength = i
+		}
+	}
+	if hp.keyLength < 16 || hp.saltLength < 8 {
+		return nil, fmt.Errorf("%s key length must be at least 16 and salt length at least 8", algo)
+	}
+	switch algo {
+	case "argon2id":
+		if hp.time < 1 || hp.memory < 8*hp.threads || hp.threads < 1 || hp.threads > 255 {
+			return nil, fmt.Errorf("argon2id parameters are invalid")
+		}
+	case "scrypt":
+		if hp.n < 2 || hp.n&(hp.n-1) != 0 || hp.r < 1 || hp.p < 1 {
+			return nil, fmt.Errorf("scrypt parameters are invalid")
+		}
+	}
+	return hp, nil
+}
+
+func getIntParam(v interface{}) (int, error) {
+	switch i := v.(type) {
+	case int:
+		return i, nil
+	case int64:
+		return int(i), nil
+	case float64:
+		return int(i), nil
+	case string:
+		return strconv.Atoi(i)
+	}
+	return 0, fmt.Errorf("unsupported value type %T", v)
+}
+
+func newSalt(n int) ([]byte, error) {
+	salt := make([]byte, n)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+// hashArgon2id returns argon2id hash in PHC string format, e.g.
+// "$argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>".
+func hashArgon2id(s string, hp *hashParams) (string, error) {
+	salt, err := newSalt(hp.saltLength)
+	if err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(s), salt, uint32(hp.time), uint32(hp.memory), uint8(hp.threads), uint32(hp.keyLength))
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, hp.memory, hp.time, hp.threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// hashScrypt returns scrypt hash in PHC string format, e.g.
+// "$scrypt$ln=15,r=8,p=1$<salt>$<hash>".
+func hashScrypt(s string, hp *hashParams) (string, error) {
+	salt, err := newSalt(hp.saltLength)
+	if err != nil {
+		return "", err
+	}
+	key, err := scrypt.Key([]byte(s), salt, hp.n, hp.r, hp.p, hp.keyLength)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("$scrypt$ln=%d,r=%d,p=%d$%s$%s",
+		log2(hp.n), hp.r, hp.p,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// parsePHC parses PHC string format hash and returns its parameters, salt
+// and key.
+func parsePHC(algo, h string) (*hashParams, []byte, []byte, error) {
+	arr := strings.Split(h, "$")
+	// The argon2id hashes have version segment.
+	if algo == "argon2id" && len(arr) > 2 && strings.HasPrefix(arr[2], "v=") {
+		if arr[2] != fmt.Sprintf("v=%d", argon2.Version) {
+			return nil, nil, nil, fmt.Errorf("unsupported argon2id version")
+		}
+		arr = append(arr[:2], arr[3:]...)
+	}
+	if len(arr) != 5 || arr[0] != "" || arr[1] != algo {
+		return nil, nil, nil, fmt.Errorf("malformed %s hash", algo)
+	}
+	hp := &hashParams{}
+	for _, kv := range strings.Split(arr[2], ",") {
+		kva := strings.SplitN(kv, "=", 2)
+		if len(kva) != 2 {
+			return nil, nil, nil, fmt.Errorf("malformed %s hash parameters", algo)
+		}
+		i, err := strconv.Atoi(kva[1])
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("malformed %s hash parameters", algo)
+		}
+		switch kva[0] {
+		case "m":
+			hp.memory = i
+		case "t":
+			hp.time = i
+		case "p":
+			if algo == "argon2id" {
+				hp.threads = i
+			} else {
+				hp.p = i
+			}
+		case "ln":
+			if i < 1 || i > 30 {
+				return nil, nil, nil, fmt.Errorf("malformed %s hash parameters", algo)
+			}
+			hp.n = 1 << uint(i)
+		case "r":
+			hp.r = i
+		}
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(arr[3])
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("malformed %s hash salt", algo)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(arr[4])
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("malformed %s hash key", algo)
+	}
+	hp.saltLength = len(salt)
+	hp.keyLength = len(key)
+	return hp, salt, key, nil
+}
+
+func matchArgon2id(h, s string) bool {
+	hp, salt, key, err := parsePHC("argon2id", h)
+	if err != nil || hp.threads < 1 || hp.threads > 255 {
+		return false
+	}
+	other := argon2.IDKey([]byte(s), salt, uint32(hp.time), uint32(hp.memory), uint8(hp.threads), uint32(hp.keyLength))
+	return subtle.ConstantTimeCompare(key, other) == 1
+}
+
+func matchScrypt(h, s string) bool {
+	hp, salt, key, err := parsePHC("scrypt", h)
+	if err != nil {
+		return false
+	}
+	other, err := scrypt.Key([]byte(s), salt, hp.n, hp.r, hp.p, hp.keyLength)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(key, other) == 1
+}
+
+// matchSSHA matches salted SHA-1 hashes used by LDAP directories, i.e.
+// "{SSHA}" followed by base64 encoded digest and salt.
+func matchSSHA(h, s string) bool {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(h, "{SSHA}"))
+	if err != nil || len(b) <= sha1.Size {
+		return false
+	}
+	digest, salt := b[:sha1.Size], b[sha1.Size:]
+	sum := sha1.Sum(append([]byte(s), salt...))
+	return subtle.ConstantTimeCompare(digest, sum[:]) == 1
+}
+
+// matchSha512Crypt matches SHA-512 based crypt(3) hashes, i.e. "$6$".
+func matchSha512Crypt(h, s string) bool {
+	arr := strings.Split(h, "$")
+	if len(arr) < 4 || arr[0] != "" || arr[1] != "6" {
+		return false
+	}
+	rounds := defaultSha512CryptRound
+	customRounds := false
+	arr = arr[2:]
+	if strings.HasPrefix(arr[0], "rounds=") {
+		i, err := strconv.Atoi(strings.TrimPrefix(arr[0], "rounds="))
+		if err != nil {
+			return false
+		}
+		rounds = i
+		customRounds = true
+		arr = arr[1:]
+	}
+	if len(arr) != 2 {
+		return false
+	}
+	other := sha512Crypt([]byte(s), []byte(arr[0]), rounds, customRounds)
+	return subtle.ConstantTimeCompare([]byte(h), []byte(other)) == 1
+}
+
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// sha512Crypt implements SHA-512 based crypt(3) as specified in
+// https://www.akkadia.org/drepper/SHA-crypt.txt.
+func sha512Crypt(key, salt []byte, rounds int, customRounds bool) string {
+	if len(salt) > 16 {
+		salt = salt[:16]
+	}
+	if rounds < 1000 {
+		rounds = 1000
+	}
+	if rounds > 999999999 {
+		rounds = 999999999
+	}
+
+	alt := sha512.New()
+	alt.Write(key)
+	alt.Write(salt)
+	alt.Write(key)
+	altSum := alt.Sum(nil)
+
+	a := sha512.New()
+	a.Write(key)
+	a.Write(salt)
+	i := len(key)
+	for ; i > 64; i -= 64 {
+		a.Write(altSum)
+	}
+	a.Write(altSum[:i])
+	for i = len(key); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			a.Write(altSum)
+		} else {
+			a.Write(key)
+		}
+	}
+	aSum := a.Sum(nil)
+
+	dp := sha512.New()
+	for i = 0; i < len(key); i++ {
+		dp.Write(key)
+	}
+	dpSum := dp.Sum(nil)
+	p := bytes.Repeat(dpSum, len(key)/64+1)[:len(key)]
+
+	ds := sha512.New()
+	for i = 0; i < 16+int(aSum[0]); i++ {
+		ds.Write(salt)
+	}
+	dsSum := ds.Sum(nil)
+	sv := dsSum[:len(salt)]
+
+	c := aSum
+	for i = 0; i < rounds; i++ {
+		h := sha512.New()
+		if i&1 != 0 {
+			h.Write(p)
+		} else {
+			h.Write(c)
+		}
+		if i%3 != 0 {
+			h.Write(sv)
+		}
+		if i%7 != 0 {
+			h.Write(p)
+		}
+		if i&1 != 0 {
+			h.Write(c)
+		} else {
+			h.Write(p)
+		}
+		c = h.Sum(nil)
+	}
+
+	var out strings.Builder
+	out.WriteString("$6$")
+	if customRounds {
+		out.WriteString("rounds=" + strconv.Itoa(rounds) + "$")
+	}
+	out.Write(salt)
+	out.WriteString("$")
+	order := [][3]int{
+		{0, 21, 42}, {22, 43, 1}, {44, 2, 23}, {3, 24, 45}, {25, 46, 4},
+		{47, 5, 26}, {6, 27, 48}, {28, 49, 7}, {50, 8, 29}, {9, 30, 51},
+		{31, 52, 10}, {53, 11, 32}, {12, 33, 54}, {34, 55, 13}, {56, 14, 35},
+		{15, 36, 57}, {37, 58, 16}, {59, 17, 38}, {18, 39, 60}, {40, 61, 19},
+		{62, 20, 41},
+	}
+	for _, o := range order {
+		w := uint(c[o[0]])<<16 | uint(c[o[1]])<<8 | uint(c[o[2]])
+		for j := 0; j < 4; j++ {
+			out.WriteByte(cryptAlphabet[w&0x3f])
+			w >>= 6
+		}
+	}
+	w := uint(c[63])
+	for j := 0; j < 2; j++ {
+		out.WriteByte(cryptAlphabet[w&0x3f])
+		w >>= 6
+	}
+	return out.String()
+}
+
+// getHashedPasswordAlgorithm returns the algorithm of the provided hash,
+// or empty string when the input is not a recognized hash.
+func getHashedPasswordAlgorithm(s string) string {
+	switch {
+	case strings.HasPrefix(s, "bcrypt:"):
+		return "bcrypt"
+	case strings.HasPrefix(s, "$2a$"), strings.HasPrefix(s, "$2b$"), strings.HasPrefix(s, "$2y$"):
+		return "bcrypt"
+	case strings.HasPrefix(s, "$argon2id$"):
+		return "argon2id"
+	case strings.HasPrefix(s, "$scrypt$"):
+		return "scrypt"
+	case strings.HasPrefix(s, "{SSHA}"):
+		return "ssha"
+	case strings.HasPrefix(s, "$6$"):
+		return "sha512_crypt"
+	}
+	return ""
+}
+
+func getBcryptCost(h string) int {
+	cost, err := bcrypt.Cost([]byte(h))
+	if err != nil {
+		return 0
+	}
+	return cost
+}
+
+func log2(n int) int {
+	var i int
+	for n > 1 {
+		n >>= 1
+		i++
+	}
+	return i
+}
@@ -0,0 +1,169 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identity
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// The identifiers of the password policy rules.
+const (
+	PasswordRuleMinLength           = "min_length"
+	PasswordRuleMaxLength           = "max_length"
+	PasswordRuleUppercase           = "require_uppercase"
+	PasswordRuleLowercase           = "require_lowercase"
+	PasswordRuleNumber              = "require_number"
+	PasswordRuleNonAlphaNumeric     = "require_non_alpha_numeric"
+	PasswordRuleBlockReuse          = "block_reuse"
+	PasswordRuleBlockPasswordChange = "block_password_change"
+)
+
+// PasswordPolicyError is returned when a password fails password policy
+// rules. The Rules field holds the identifiers of the failed rules.
+type PasswordPolicyError struct {
+	Rules   []string `json:"rules,omitempty" xml:"rules,omitempty" yaml:"rules,omitempty"`
+	policy  *PasswordPolicy
+	charLen int
+}
+
+// Error returns error string.
+func (e *PasswordPolicyError) Error() string {
+	var msgs []string
+	for _, rule := range e.Rules {
+		switch rule {
+		case PasswordRuleMinLength:
+			msgs = append(msgs, fmt.Sprintf("password length is %d characters, must be at least %d", e.charLen, e.policy.MinLength))
+		case PasswordRuleMaxLength:
+			msgs = append(msgs, fmt.Sprintf("password length is %d characters, must be at most %d", e.charLen, e.policy.MaxLength))
+		case PasswordRuleUppercase:
+			msgs = append(msgs, "password must contain uppercase characters")
+		case PasswordRuleLowercase:
+			msgs = append(msgs, "password must contain lowercase characters")
+		case PasswordRuleNumber:
+			msgs = append(msgs, "password must contain numbers")
+		case PasswordRuleNonAlphaNumeric:
+			msgs = append(msgs, "password must contain non alpha-numeric characters")
+		case PasswordRuleBlockReuse:
+			msgs = append(msgs, "password was used previously")
+		case PasswordRuleBlockPasswordChange:
+			msgs = append(msgs, "password change is not allowed")
+		default:
+			msgs = append(msgs, rule)
+		}
+	}
+	return strings.Join(msgs, ", ")
+}
+
+// HasRule returns true when the error was caused by the provided rule.
+func (e *PasswordPolicyError) HasRule(rule string) bool {
+	for _, r := range e.Rules {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *PasswordPolicyError) add(rule string) {
+	e.Rules = append(e.Rules, rule)
+}
+
+// Check returns an error when the provided password does not comply
+// with the policy. The character class rules do not apply to pre-hashed
+// passwords, e.g. "bcrypt:10:$2a$10$..." or "$argon2id$v=19$...".
+func (p *PasswordPolicy) Check(s string) error {
+	e := &PasswordPolicyError{policy: p, charLen: len(s)}
+	if len(s) < p.MinLength {
+		e.add(PasswordRuleMinLength)
+	}
+	if len(s) > p.MaxLength {
+		e.add(PasswordRuleMaxLength)
+	}
+	if !isHashedPassword(s) {
+		var hasUpper, hasLower, hasNumber, hasOther bool
+		for _, c := range s {
+			switch {
+			case unicode.IsUpper(c):
+				hasUpper = true
+			case unicode.IsLower(c):
+				hasLower = true
+			case unicode.IsDigit(c):
+				hasNumber = true
+			case !unicode.IsLetter(c):
+				hasOther = true
+			}
+		}
+		if p.RequireUppercase && !hasUpper {
+			e.add(PasswordRuleUppercase)
+		}
+		if p.RequireLowercase && !hasLower {
+			e.add(PasswordRuleLowercase)
+		}
+		if p.RequireNumber && !hasNumber {
+			e.add(PasswordRuleNumber)
+		}
+		if p.RequireNonAlphaNumeric && !hasOther {
+			e.add(PasswordRuleNonAlphaNumeric)
+		}
+	}
+	if len(e.Rules) > 0 {
+		return e
+	}
+	return nil
+}
+
+// CheckReuse returns an error when the reuse of passwords is blocked and
+// the provided password matches one of the passwords retained for the user.
+func (p *PasswordPolicy) CheckReuse(user *User, s string) error {
+	if !p.BlockReuse || isHashedPassword(s) {
+		return nil
+	}
+	for _, password := range user.Passwords {
+		if password.Match(s) {
+			return &PasswordPolicyError{Rules: []string{PasswordRuleBlockReuse}, policy: p}
+		}
+	}
+	return nil
+}
+
+// GetMaxAge returns the maximum age of a password. Zero means that
+// passwords do not expire.
+func (p *PasswordPolicy) GetMaxAge() time.Duration {
+	if p.MaxAgeDays < 1 {
+		return 0
+	}
+	return time.Duration(p.MaxAgeDays) * 24 * time.Hour
+}
+
+// GetAlgorithm returns the algorithm for hashing passwords.
+func (p *PasswordPolicy) GetAlgorithm() string {
+	if p.Algorithm == "" {
+		return "bcrypt"
+	}
+	return p.Algorithm
+}
+
+// NewPassword returns an instance of Password hashed with the algorithm and
+// the parameters of the policy.
+func (p *PasswordPolicy) NewPassword(s string) (*Password, error) {
+	return NewPasswordWithOptions(s, "generic", p.GetAlgorithm(), p.AlgorithmParams)
+}
+
+func isHashedPassword(s string) bool {
+	return getHashedPasswordAlgorithm(s) != ""
+}
@@ -0,0 +1,95 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identity
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/greenpau/go-authcrunch/internal/tests"
+)
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	policy := &PasswordPolicy{
+		MinLength:              8,
+		MaxLength:              16,
+		RequireUppercase:       true,
+		RequireLowercase:       true,
+		RequireNumber:          true,
+		RequireNonAlphaNumeric: true,
+	}
+	testcases := []struct {
+		name     string
+		policy   *PasswordPolicy
+		password string
+		want     []string
+		err      error
+	}{
+		{
+			name:     "test compliant password",
+			policy:   policy,
+			password: "Foo.Bar-123",
+		},
+		{
+			name:     "test too short password",
+			policy:   policy,
+			password: "Fo.1",
+			want:     []string{PasswordRuleMinLength},
+			err:      fmt.Errorf("password length is 4 characters, must be at least 8"),
+		},
+		{
+			name:     "test too long password",
+			policy:   policy,
+			password: "Foo.Bar-123456789",
+			want:     []string{PasswordRuleMaxLength},
+			err:      fmt.Errorf("password length is 17 characters, must be at most 16"),
+		},
+		{
+			name:     "test password without required character classes",
+			policy:   policy,
+			password: "foobarfoobar",
+			want:     []string{PasswordRuleUppercase, PasswordRuleNumber, PasswordRuleNonAlphaNumeric},
+			err: fmt.Errorf("password must contain uppercase characters, " +
+				"password must contain numbers, " +
+				"password must contain non alpha-numeric characters"),
+		},
+		{
+			name:     "test password without lowercase characters",
+			policy:   policy,
+			password: "FOO.BAR-123",
+			want:     []string{PasswordRuleLowercase},
+			err:      fmt.Errorf("password must contain lowercase characters"),
+		},
+		{
+			name:     "test hashed password skips character class rules",
+			policy:   &PasswordPolicy{MinLength: 8, MaxLength: 128, RequireUppercase: true, RequireNumber: true},
+			password: "bcrypt:10:$2a$10$iqq53VjdCwknBSBrnyLd9OH1Mfh6kqPezMMy6h6F41iLdVDkj13I6",
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			err := tc.policy.Check(tc.password)
+			if tests.EvalErrWithLog(t, err, "check", len(tc.want) > 0, tc.err, msgs) {
+				var policyErr *PasswordPolicyError
+				if !errors.As(err, &policyErr) {
+					t.Fatalf("expected PasswordPolicyError, got %T", err)
+				}
+				tests.EvalObjectsWithLog(t, "rules", tc.want, policyErr.Rules, msgs)
+			}
+		})
+	}
+}
@@ -75,6 +75,106 @@ func TestNewPassword(t *testing.T) {
 			shouldErr: true,
 			err:       errors.ErrPasswordGenerate.WithArgs("crypto/bcrypt: cost 10000 is outside allowed range (4,31)"),
 		},
+		{
+			name:      "test argon2id password",
+			purpose:   "generic",
+			algorithm: "argon2id",
+			params: map[string]interface{}{
+				"time":    1,
+				"memory":  1024,
+				"threads": 1,
+			},
+			input:    "foobar",
+			password: "foobar",
+			want: map[string]interface{}{
+				"purpose":        "generic",
+				"algorithm":      "argon2id",
+				"cost":           0,
+				"password_match": true,
+			},
+		},
+		{
+			name:      "test scrypt password",
+			purpose:   "generic",
+			algorithm: "scrypt",
+			params: map[string]interface{}{
+				"n": float64(1024),
+			},
+			input:    "foobar",
+			password: "foobar2",
+			want: map[string]interface{}{
+				"purpose":        "generic",
+				"algorithm":      "scrypt",
+				"cost":           0,
+				"password_match": false,
+			},
+		},
+		{
+			name:      "test password with invalid scrypt params",
+			purpose:   "generic",
+			algorithm: "scrypt",
+			params: map[string]interface{}{
+				"n": 1000,
+			},
+			input:     "foobar",
+			shouldErr: true,
+			err:       errors.ErrPasswordGenerate.WithArgs("scrypt parameters are invalid"),
+		},
+		{
+			name:      "test imported ssha password",
+			algorithm: "bcrypt",
+			input:     "{SSHA}lRRmNs0Qv604LdZlMjiFOG615m8xMjM0NTY3OA==",
+			password:  "foobar",
+			want: map[string]interface{}{
+				"purpose":        "",
+				"algorithm":      "ssha",
+				"cost":           0,
+				"password_match": true,
+			},
+		},
+		{
+			name:      "test imported sha512 crypt password",
+			algorithm: "bcrypt",
+			input:     "$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1",
+			password:  "Hello world!",
+			want: map[string]interface{}{
+				"purpose":        "",
+				"algorithm":      "sha512_crypt",
+				"cost":           0,
+				"password_match": true,
+			},
+		},
+		{
+			name:      "test imported sha512 crypt password with rounds",
+			algorithm: "bcrypt",
+			input:     "$6$rounds=10000$saltstringsaltst$OW1/O6BYHV6BcXZu8QVeXbDWra3Oeqh0sbHbbMCVNSnCM/UrjmM0Dp8vOuZeHBy/YTBmSK6H9qs/y3RnOaw5v.",
+			password:  "Hello world!",
+			want: map[string]interface{}{
+				"purpose":        "",
+				"algorithm":      "sha512_crypt",
+				"cost":           0,
+				"password_match": true,
+			},
+		},
+		{
+			name:      "test imported 2y bcrypt password",
+			algorithm: "argon2id",
+			input:     "$2y$10$t15k.Y3JCCLFWtJLY/ApqexA3YQVzdKe9P3fwFl0VvBvFE9ZVvvKK",
+			password:  "foobar",
+			want: map[string]interface{}{
+				"purpose":        "",
+				"algorithm":      "bcrypt",
+				"cost":           10,
+				"password_match": true,
+			},
+		},
+		{
+			name:      "test imported malformed argon2id password",
+			algorithm: "bcrypt",
+			input:     "$argon2id$v=19$m=1024,t=1,p=1$foo",
+			shouldErr: true,
+			err:       errors.ErrPasswordHashed.WithArgs("malformed argon2id hash"),
+		},
 		{
 			name:      "test password with empty hash algorithm",
 			input:     "foobar",
@@ -118,3 +218,71 @@ func TestNewPassword(t *testing.T) {
 		})
 	}
 }
+
+func TestPasswordNeedsRehash(t *testing.T) {
+	argon2Params := map[string]interface{}{"time": 1, "memory": 1024, "threads": 1}
+	testcases := []struct {
+		name      string
+		algorithm string
+		params    map[string]interface{}
+		input     string
+		policy    *PasswordPolicy
+		want      bool
+	}{
+		{
+			name:      "test bcrypt password with same cost",
+			algorithm: "bcrypt",
+			input:     "foobar",
+			policy:    &PasswordPolicy{},
+			want:      false,
+		},
+		{
+			name:      "test bcrypt password with lower cost",
+			algorithm: "bcrypt",
+			input:     "foobar",
+			policy:    &PasswordPolicy{AlgorithmParams: map[string]interface{}{"cost": 11}},
+			want:      true,
+		},
+		{
+			name:      "test bcrypt password with argon2id policy",
+			algorithm: "bcrypt",
+			input:     "foobar",
+			policy:    &PasswordPolicy{Algorithm: "argon2id", AlgorithmParams: argon2Params},
+			want:      true,
+		},
+		{
+			name:      "test argon2id password with same params",
+			algorithm: "argon2id",
+			params:    argon2Params,
+			input:     "foobar",
+			policy:    &PasswordPolicy{Algorithm: "argon2id", AlgorithmParams: argon2Params},
+			want:      false,
+		},
+		{
+			name:      "test argon2id password with different params",
+			algorithm: "argon2id",
+			params:    argon2Params,
+			input:     "foobar",
+			policy:    &PasswordPolicy{Algorithm: "argon2id", AlgorithmParams: map[string]interface{}{"time": 2, "memory": 1024, "threads": 1}},
+			want:      true,
+		},
+		{
+			name:      "test imported ssha password",
+			algorithm: "bcrypt",
+			input:     "{SSHA}lRRmNs0Qv604LdZlMjiFOG615m8xMjM0NTY3OA==",
+			policy:    &PasswordPolicy{},
+			want:      true,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			entry, err := NewPasswordWithOptions(tc.input, "generic", tc.algorithm, tc.params)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got := entry.NeedsRehash(tc.policy.GetAlgorithm(), tc.policy.AlgorithmParams)
+			tests.EvalObjectsWithLog(t, "eval", tc.want, got, msgs)
+		})
+	}
+}
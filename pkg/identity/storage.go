@@ -0,0 +1,304 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identity
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+)
+
+const (
+	// StorageKindJSON is the storage keeping the database in a JSON file.
+	StorageKindJSON = "json"
+	// StorageKindBolt is the storage keeping the database in an embedded
+	// BoltDB key/value store, with a record per user.
+	StorageKindBolt = "bolt"
+)
+
+// Storage is the persistence backend of Database. The database keeps the
+// users and the lookup references in memory, unless the storage implements
+// userIndexer, and hands the changes over to the storage on each commit.
+type Storage interface {
+	// GetKind returns the kind of the storage.
+	GetKind() string
+	// Open opens the storage and loads the database contents. It returns
+	// false when the storage holds no database yet.
+	Open(db *Database) (bool, error)
+	// Commit persists the database metadata, the updated users, and the
+	// removal of the deleted users. The revision of the storage must match
+	// the revision of the database.
+	Commit(db *Database, updated, deleted []*User) error
+	// Reload loads the database contents when the storage was changed by
+	// another writer. It returns true when the database was reloaded.
+	Reload(db *Database) (bool, error)
+	// Close releases the resources held by the storage.
+	Close() error
+}
+
+// The indexes of the users in a storage implementing userIndexer.
+const (
+	userIndexID           = "id"
+	userIndexUsername     = "username"
+	userIndexEmailAddress = "email_address"
+	userIndexAPIKey       = "api_key"
+)
+
+// userIndexer is implemented by the storages that look the users up in
+// their own indexes. The database backed by such storage does not keep the
+// users in memory. Each lookup returns a fresh copy of the user, i.e. the
+// changes to the user take effect on commit.
+type userIndexer interface {
+	// lookupUser returns the user referenced by the key in the index. The
+	// key is lowercased for the username and email address indexes.
+	lookupUser(index, key string) (*User, error)
+	// listUsers returns all the users.
+	listUsers() ([]*User, error)
+	// countUsers returns the number of the users.
+	countUsers() (int, error)
+	// listAdminUsers returns the enabled users with admin rights.
+	listAdminUsers() ([]*User, error)
+}
+
+// newStorage returns an instance of Storage of the provided kind.
+func newStorage(kind string) (Storage, error) {
+	switch kind {
+	case "", StorageKindJSON:
+		return &jsonStorage{}, nil
+	case StorageKindBolt:
+		return &boltStorage{}, nil
+	}
+	return nil, errors.ErrDatabaseStorageUnsupported.WithArgs(kind)
+}
+
+// revise increments the revision of the database.
+func (db *Database) revise() {
+	db.Revision++
+	db.LastModified = time.Now().UTC()
+}
+
+// commit persists the database metadata and the provided users.
+func (db *Database) commit(users ...*User) error {
+	if db.readOnly {
+		return errors.ErrDatabaseReadOnly
+	}
+	if db.inMemory {
+		db.revise()
+		return nil
+	}
+	return db.storage.Commit(db, users, nil)
+}
+
+// commitDelete persists the removal of the provided user.
+func (db *Database) commitDelete(user *User) error {
+	if db.readOnly {
+		return errors.ErrDatabaseReadOnly
+	}
+	if db.inMemory {
+		db.revise()
+		return nil
+	}
+	return db.storage.Commit(db, nil, []*User{user})
+}
+
+// Reload loads the database contents when the storage was changed by another
+// writer. It returns true when the database was reloaded.
+func (db *Database) Reload() (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.inMemory {
+		return false, nil
+	}
+	return db.storage.Reload(db)
+}
+
+// Close closes the storage of the database.
+func (db *Database) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.inMemory {
+		return nil
+	}
+	return db.storage.Close()
+}
+
+// GetStorageKind returns the kind of the storage of the database.
+func (db *Database) GetStorageKind() string {
+	if db.inMemory {
+		return ""
+	}
+	return db.storage.GetKind()
+}
+
+// getUserByIndex returns the user referenced by the key in the index, either
+// in the storage or in the in-memory references of the database.
+func (db *Database) getUserByIndex(index, key string) (*User, error) {
+	if db.indexer != nil {
+		return db.indexer.lookupUser(index, key)
+	}
+	var user *User
+	switch index {
+	case userIndexID:
+		user = db.refID[key]
+	case userIndexUsername:
+		user = db.refUsername[key]
+	case userIndexEmailAddress:
+		user = db.refEmailAddress[key]
+	case userIndexAPIKey:
+		user = db.refAPIKey[key]
+	}
+	if user == nil {
+		return nil, errors.ErrDatabaseUserNotFound
+	}
+	return user, nil
+}
+
+// listUsers returns all the users of the database.
+func (db *Database) listUsers() ([]*User, error) {
+	if db.indexer != nil {
+		return db.indexer.listUsers()
+	}
+	return db.Users, nil
+}
+
+// listAdminUsers returns the users of the database having admin rights. The
+// users listed in memory are not filtered, i.e. the caller checks the
+// rights of each user.
+func (db *Database) listAdminUsers() ([]*User, error) {
+	if db.indexer != nil {
+		return db.indexer.listAdminUsers()
+	}
+	return db.Users, nil
+}
+
+// countUsers returns the number of the users of the database.
+func (db *Database) countUsers() (int, error) {
+	if db.indexer != nil {
+		return db.indexer.countUsers()
+	}
+	return len(db.Users), nil
+}
+
+// reference adds the user to the in-memory lookup references. It is a noop
+// when the users are looked up in the storage.
+func (db *Database) reference(user *User) {
+	if db.indexer != nil {
+		return
+	}
+	db.refUsername[strings.ToLower(user.Username)] = user
+	db.refID[user.ID] = user
+	for _, email := range user.EmailAddresses {
+		db.refEmailAddress[strings.ToLower(email.Address)] = user
+	}
+	for _, apiKey := range user.APIKeys {
+		db.refAPIKey[apiKey.Prefix] = user
+	}
+	db.Users = append(db.Users, user)
+}
+
+// dereference removes the user from the in-memory lookup references.
+func (db *Database) dereference(user *User) {
+	if db.indexer != nil {
+		return
+	}
+	users := []*User{}
+	for _, u := range db.Users {
+		if u.ID == user.ID {
+			continue
+		}
+		users = append(users, u)
+	}
+	db.Users = users
+	delete(db.refID, user.ID)
+	delete(db.refUsername, strings.ToLower(user.Username))
+	for _, email := range user.EmailAddresses {
+		delete(db.refEmailAddress, strings.ToLower(email.Address))
+	}
+	for _, apiKey := range user.APIKeys {
+		delete(db.refAPIKey, apiKey.Prefix)
+	}
+}
+
+// replace replaces the policy, the users, and the lookup references of the
+// database with the ones of the provided database.
+func (db *Database) replace(src *Database) {
+	db.Policy = src.Policy
+	db.Revision = src.Revision
+	db.LastModified = src.LastModified
+	db.Users = src.Users
+	db.refUsername = src.refUsername
+	db.refID = src.refID
+	db.refEmailAddress = src.refEmailAddress
+	db.refAPIKey = src.refAPIKey
+}
+
+// newIndexedDatabase returns an empty Database for staging the contents
+// loaded from a storage.
+func newIndexedDatabase() *Database {
+	return &Database{
+		refUsername:     make(map[string]*User),
+		refID:           make(map[string]*User),
+		refEmailAddress: make(map[string]*User),
+		refAPIKey:       make(map[string]*User),
+	}
+}
+
+// Import copies the policy and the users of the source database into the
+// database. The database must have no users.
+func (db *Database) Import(src *Database) error {
+	src.mu.RLock()
+	users, err := src.listUsers()
+	if err != nil {
+		src.mu.RUnlock()
+		return errors.ErrDatabaseOperation.WithArgs(err)
+	}
+	data, err := json.Marshal(users)
+	policy := src.Policy
+	src.mu.RUnlock()
+	if err != nil {
+		return errors.ErrDatabaseOperation.WithArgs(err)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	count, err := db.countUsers()
+	if err != nil {
+		return errors.ErrDatabaseOperation.WithArgs(err)
+	}
+	if count > 0 {
+		return errors.ErrDatabaseImportNotEmpty.WithArgs(count)
+	}
+	// The source database may be read-only, i.e. its policy was not
+	// checked against the defaults.
+	tmp := newIndexedDatabase()
+	tmp.Policy = policy
+	tmp.enforceDefaultPolicy()
+	if err := json.Unmarshal(data, &tmp.Users); err != nil {
+		return errors.ErrDatabaseOperation.WithArgs(err)
+	}
+	if err := tmp.index(); err != nil {
+		return err
+	}
+	if db.indexer != nil {
+		db.Policy = tmp.Policy
+		return db.commit(tmp.Users...)
+	}
+	tmp.Revision = db.Revision
+	tmp.LastModified = db.LastModified
+	db.replace(tmp)
+	return db.commit(db.Users...)
+}
@@ -0,0 +1,392 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identity
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"go.etcd.io/bbolt"
+)
+
+var (
+	boltMetadataBucket = []byte("metadata")
+	boltUsersBucket    = []byte("users")
+	boltUsernameIndex  = []byte("usernames")
+	boltEmailIndex     = []byte("email_addresses")
+	boltAPIKeyIndex    = []byte("api_keys")
+	boltAdminIndex     = []byte("admins")
+	boltMetadataKey    = []byte("database")
+	boltBuckets        = [][]byte{
+		boltMetadataBucket, boltUsersBucket,
+		boltUsernameIndex, boltEmailIndex, boltAPIKeyIndex, boltAdminIndex,
+	}
+	boltIndexes = map[string][]byte{
+		userIndexUsername:     boltUsernameIndex,
+		userIndexEmailAddress: boltEmailIndex,
+		userIndexAPIKey:       boltAPIKeyIndex,
+	}
+)
+
+// boltStorage keeps the database in an embedded BoltDB key/value store.
+// Each user is a record keyed by the user id. The usernames, the email
+// addresses and the api key prefixes are indexed in separate buckets, i.e.
+// the users are looked up in the store rather than loaded into memory. The
+// ids of the enabled users with admin rights are indexed too, so that the
+// admins are counted without decoding all the users. Each commit updates
+// the changed records in a single transaction.
+type boltStorage struct {
+	db *bbolt.DB
+}
+
+// boltMetadata is the database metadata stored in BoltDB.
+type boltMetadata struct {
+	Version      string    `json:"version,omitempty"`
+	Policy       Policy    `json:"policy,omitempty"`
+	Revision     uint64    `json:"revision,omitempty"`
+	LastModified time.Time `json:"last_modified,omitempty"`
+}
+
+// GetKind returns the kind of the storage.
+func (s *boltStorage) GetKind() string {
+	return StorageKindBolt
+}
+
+// Open opens the BoltDB file and loads the database metadata.
+func (s *boltStorage) Open(db *Database) (bool, error) {
+	fileInfo, err := os.Stat(db.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return false, err
+		}
+		if err := os.MkdirAll(filepath.Dir(db.path), 0700); err != nil {
+			return false, err
+		}
+	} else if fileInfo.IsDir() {
+		return false, errors.ErrDatabasePathDirectory
+	}
+
+	bdb, err := bbolt.Open(db.path, 0600, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		return false, err
+	}
+	var found bool
+	err = bdb.Update(func(tx *bbolt.Tx) error {
+		// The stores created before the users were indexed have the
+		// records only, or lack some of the indexes.
+		var reindex bool
+		if tx.Bucket(boltUsersBucket) != nil {
+			for _, name := range boltBuckets {
+				if tx.Bucket(name) == nil {
+					reindex = true
+				}
+			}
+		}
+		for _, name := range boltBuckets {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		if reindex {
+			if err := boltReindex(tx); err != nil {
+				return err
+			}
+		}
+		m, err := boltLoadMetadata(tx)
+		if err != nil {
+			return err
+		}
+		if m == nil {
+			return nil
+		}
+		found = true
+		db.Version = m.Version
+		db.Policy = m.Policy
+		db.Revision = m.Revision
+		db.LastModified = m.LastModified
+		return nil
+	})
+	if err != nil {
+		bdb.Close()
+		return false, err
+	}
+	s.db = bdb
+	return found, nil
+}
+
+// Commit updates the database metadata and the changed user records.
+func (s *boltStorage) Commit(db *Database, updated, deleted []*User) error {
+	var conflict error
+	revision := db.Revision
+	lastModified := db.LastModified
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		m, err := boltLoadMetadata(tx)
+		if err != nil {
+			return err
+		}
+		if m != nil && m.Revision != db.Revision {
+			db.Policy = m.Policy
+			db.Revision = m.Revision
+			db.LastModified = m.LastModified
+			conflict = errors.ErrDatabaseRevisionConflict.WithArgs(db.path, m.Revision, revision)
+			return conflict
+		}
+		db.revise()
+		b, err := json.Marshal(&boltMetadata{
+			Version:      db.Version,
+			Policy:       db.Policy,
+			Revision:     db.Revision,
+			LastModified: db.LastModified,
+		})
+		if err != nil {
+			return err
+		}
+		if err := tx.Bucket(boltMetadataBucket).Put(boltMetadataKey, b); err != nil {
+			return err
+		}
+		for _, user := range deleted {
+			if err := boltDeleteUser(tx, user.ID); err != nil {
+				return err
+			}
+		}
+		for _, user := range updated {
+			if err := boltPutUser(tx, user); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if conflict != nil {
+		return conflict
+	}
+	if err != nil {
+		db.Revision = revision
+		db.LastModified = lastModified
+		return errors.ErrDatabaseCommit.WithArgs(db.path, err)
+	}
+	return nil
+}
+
+// Reload is a noop, because BoltDB holds an exclusive lock on the file and
+// there are no other writers.
+func (s *boltStorage) Reload(db *Database) (bool, error) {
+	return false, nil
+}
+
+// Close closes the BoltDB file.
+func (s *boltStorage) Close() error {
+	if s.db == nil {
+		return nil
+	}
+	return s.db.Close()
+}
+
+// lookupUser returns the user referenced by the key in the index.
+func (s *boltStorage) lookupUser(index, key string) (*User, error) {
+	var user *User
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		id := []byte(key)
+		if index != userIndexID {
+			bucket, exists := boltIndexes[index]
+			if !exists {
+				return errors.ErrDatabaseUserNotFound
+			}
+			id = tx.Bucket(bucket).Get([]byte(key))
+			if id == nil {
+				return errors.ErrDatabaseUserNotFound
+			}
+		}
+		b := tx.Bucket(boltUsersBucket).Get(id)
+		if b == nil {
+			return errors.ErrDatabaseUserNotFound
+		}
+		var err error
+		user, err = boltDecodeUser(b)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// listUsers returns all the users.
+func (s *boltStorage) listUsers() ([]*User, error) {
+	var users []*User
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltUsersBucket).ForEach(func(k, v []byte) error {
+			user, err := boltDecodeUser(v)
+			if err != nil {
+				return err
+			}
+			users = append(users, user)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// listAdminUsers returns the users in the admin index.
+func (s *boltStorage) listAdminUsers() ([]*User, error) {
+	var users []*User
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		records := tx.Bucket(boltUsersBucket)
+		return tx.Bucket(boltAdminIndex).ForEach(func(k, v []byte) error {
+			b := records.Get(v)
+			if b == nil {
+				return nil
+			}
+			user, err := boltDecodeUser(b)
+			if err != nil {
+				return err
+			}
+			users = append(users, user)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// countUsers returns the number of the users.
+func (s *boltStorage) countUsers() (int, error) {
+	var count int
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		count = tx.Bucket(boltUsersBucket).Stats().KeyN
+		return nil
+	})
+	return count, err
+}
+
+// boltLoadMetadata reads the database metadata. It returns nil when the
+// metadata is absent.
+func boltLoadMetadata(tx *bbolt.Tx) (*boltMetadata, error) {
+	b := tx.Bucket(boltMetadataBucket).Get(boltMetadataKey)
+	if b == nil {
+		return nil, nil
+	}
+	m := &boltMetadata{}
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// boltDecodeUser decodes the user record.
+func boltDecodeUser(b []byte) (*User, error) {
+	user := &User{}
+	if err := json.Unmarshal(b, user); err != nil {
+		return nil, err
+	}
+	normalizeUser(user)
+	return user, nil
+}
+
+// boltUserIndexes returns the index entries of the user.
+func boltUserIndexes(user *User) map[string][]string {
+	m := map[string][]string{
+		string(boltUsernameIndex): {strings.ToLower(user.Username)},
+	}
+	for _, email := range user.EmailAddresses {
+		m[string(boltEmailIndex)] = append(m[string(boltEmailIndex)], strings.ToLower(email.Address))
+	}
+	for _, apiKey := range user.APIKeys {
+		m[string(boltAPIKeyIndex)] = append(m[string(boltAPIKeyIndex)], apiKey.Prefix)
+	}
+	if !user.Disabled && user.HasAdminRights() {
+		m[string(boltAdminIndex)] = []string{user.ID}
+	}
+	return m
+}
+
+// boltReindex adds the index entries of the stored users.
+func boltReindex(tx *bbolt.Tx) error {
+	var users []*User
+	err := tx.Bucket(boltUsersBucket).ForEach(func(k, v []byte) error {
+		user, err := boltDecodeUser(v)
+		if err != nil {
+			return err
+		}
+		users = append(users, user)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		if err := boltPutUser(tx, user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// boltPutUser writes the user record and updates the indexes. It fails when
+// an index entry points to another user.
+func boltPutUser(tx *bbolt.Tx, user *User) error {
+	if err := boltDeleteUser(tx, user.ID); err != nil {
+		return err
+	}
+	for index, keys := range boltUserIndexes(user) {
+		bucket := tx.Bucket([]byte(index))
+		for _, key := range keys {
+			if id := bucket.Get([]byte(key)); id != nil && string(id) != user.ID {
+				return errors.ErrDatabaseStorageDuplicate.WithArgs(index, key)
+			}
+			if err := bucket.Put([]byte(key), []byte(user.ID)); err != nil {
+				return err
+			}
+		}
+	}
+	b, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(boltUsersBucket).Put([]byte(user.ID), b)
+}
+
+// boltDeleteUser removes the user record and its index entries.
+func boltDeleteUser(tx *bbolt.Tx, id string) error {
+	users := tx.Bucket(boltUsersBucket)
+	b := users.Get([]byte(id))
+	if b == nil {
+		return nil
+	}
+	user := &User{}
+	if err := json.Unmarshal(b, user); err != nil {
+		return err
+	}
+	for index, keys := range boltUserIndexes(user) {
+		bucket := tx.Bucket([]byte(index))
+		for _, key := range keys {
+			if string(bucket.Get([]byte(key))) != id {
+				continue
+			}
+			if err := bucket.Delete([]byte(key)); err != nil {
+				return err
+			}
+		}
+	}
+	return users.Delete([]byte(id))
+}
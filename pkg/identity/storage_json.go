@@ -0,0 +1,167 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identity
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+	fileutil "github.com/greenpau/go-authcrunch/pkg/util/file"
+)
+
+// jsonStorage keeps the database in a JSON file. Each commit rewrites the
+// file.
+type jsonStorage struct{}
+
+// jsonRevision is the revision of the database in a JSON file.
+type jsonRevision struct {
+	Revision uint64 `json:"revision"`
+}
+
+// GetKind returns the kind of the storage.
+func (s *jsonStorage) GetKind() string {
+	return StorageKindJSON
+}
+
+// Open reads the database from the JSON file.
+func (s *jsonStorage) Open(db *Database) (bool, error) {
+	fileInfo, err := os.Stat(db.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return false, err
+		}
+		if err := os.MkdirAll(filepath.Dir(db.path), 0700); err != nil {
+			return false, err
+		}
+		return false, nil
+	}
+	if fileInfo.IsDir() {
+		return false, errors.ErrDatabasePathDirectory
+	}
+	b, err := fileutil.ReadFileBytes(db.path)
+	if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(b, db); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Commit writes the database contents to the JSON file. The revision of the
+// file on disk must match the revision of the database in memory. Otherwise,
+// the file was changed by another writer, the database is reloaded from
+// disk, and the commit fails with a revision conflict. The check and the
+// write happen under an exclusive lock of the file shared with the other
+// writers.
+func (s *jsonStorage) Commit(db *Database, updated, deleted []*User) error {
+	unlock, err := fileutil.LockFile(db.path)
+	if err != nil {
+		return errors.ErrDatabaseCommit.WithArgs(db.path, err)
+	}
+	defer unlock()
+
+	current, err := os.ReadFile(db.path)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.ErrDatabaseCommit.WithArgs(db.path, err)
+	}
+	if len(current) > 0 {
+		var onDisk jsonRevision
+		if err := json.Unmarshal(current, &onDisk); err == nil && onDisk.Revision != db.Revision {
+			revision := db.Revision
+			if err := s.load(db, current); err != nil {
+				return errors.ErrDatabaseCommit.WithArgs(db.path, err)
+			}
+			return errors.ErrDatabaseRevisionConflict.WithArgs(db.path, onDisk.Revision, revision)
+		}
+	}
+
+	db.revise()
+	data, err := json.MarshalIndent(db, "", "  ")
+	if err != nil {
+		return errors.ErrDatabaseCommit.WithArgs(db.path, err)
+	}
+	if len(current) > 0 && db.backupCount > 0 {
+		if err := rotateBackups(db.path, current, db.backupCount); err != nil {
+			return errors.ErrDatabaseCommit.WithArgs(db.path, err)
+		}
+	}
+	if err := fileutil.WriteFileAtomic(db.path, data, 0600); err != nil {
+		return errors.ErrDatabaseCommit.WithArgs(db.path, err)
+	}
+	return nil
+}
+
+// Reload reads the JSON file and replaces the contents of the database in
+// memory when the revision on disk differs.
+func (s *jsonStorage) Reload(db *Database) (bool, error) {
+	data, err := os.ReadFile(db.path)
+	if err != nil {
+		return false, errors.ErrDatabaseReload.WithArgs(db.path, err)
+	}
+	var onDisk jsonRevision
+	if err := json.Unmarshal(data, &onDisk); err != nil {
+		return false, errors.ErrDatabaseReload.WithArgs(db.path, err)
+	}
+	if onDisk.Revision == db.Revision {
+		return false, nil
+	}
+	if err := s.load(db, data); err != nil {
+		return false, errors.ErrDatabaseReload.WithArgs(db.path, err)
+	}
+	return true, nil
+}
+
+// Close is a noop, because the JSON file is not held open.
+func (s *jsonStorage) Close() error {
+	return nil
+}
+
+// load parses the database contents and, when they are valid, replaces the
+// policy, the users and the lookup references of the database.
+func (s *jsonStorage) load(db *Database, data []byte) error {
+	tmp := newIndexedDatabase()
+	if err := json.Unmarshal(data, tmp); err != nil {
+		return err
+	}
+	tmp.enforceDefaultPolicy()
+	if err := tmp.index(); err != nil {
+		return err
+	}
+	db.replace(tmp)
+	return nil
+}
+
+// rotateBackups shifts the existing backups of the file, i.e. <fp>.1
+// becomes <fp>.2, and writes the current contents of the file to <fp>.1.
+// The backups beyond the count are discarded.
+func rotateBackups(fp string, current []byte, count int) error {
+	for i := count - 1; i > 0; i-- {
+		src := fmt.Sprintf("%s.%d", fp, i)
+		if _, err := os.Stat(src); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		if err := os.Rename(src, fmt.Sprintf("%s.%d", fp, i+1)); err != nil {
+			return err
+		}
+	}
+	return fileutil.WriteFileAtomic(fp+".1", current, 0600)
+}
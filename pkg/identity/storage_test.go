@@ -0,0 +1,446 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identity
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/greenpau/go-authcrunch/internal/tests"
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/requests"
+	"go.etcd.io/bbolt"
+)
+
+func TestNewDatabaseWithStorage(t *testing.T) {
+	tmpDir, err := tests.TempDir("TestNewDatabaseWithStorage")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+
+	testcases := []struct {
+		name      string
+		path      string
+		kind      string
+		want      map[string]interface{}
+		shouldErr bool
+		err       error
+	}{
+		{
+			name: "test create new json database",
+			path: filepath.Join(tmpDir, "user_db.json"),
+			kind: StorageKindJSON,
+			want: map[string]interface{}{
+				"kind":       "json",
+				"user_count": 0,
+			},
+		},
+		{
+			name: "test create new bolt database",
+			path: filepath.Join(tmpDir, "user_db.bolt"),
+			kind: StorageKindBolt,
+			want: map[string]interface{}{
+				"kind":       "bolt",
+				"user_count": 0,
+			},
+		},
+		{
+			name: "test create new in-memory database",
+			path: ":memory:",
+			kind: StorageKindBolt,
+			want: map[string]interface{}{
+				"kind":       "",
+				"user_count": 0,
+			},
+		},
+		{
+			name:      "test new bolt database is directory",
+			path:      tmpDir,
+			kind:      StorageKindBolt,
+			shouldErr: true,
+			err:       errors.ErrNewDatabase.WithArgs(tmpDir, errors.ErrDatabasePathDirectory),
+		},
+		{
+			name:      "test new database with unsupported storage",
+			path:      filepath.Join(tmpDir, "user_db.sqlite"),
+			kind:      "sqlite",
+			shouldErr: true,
+			err: errors.ErrNewDatabase.WithArgs(
+				filepath.Join(tmpDir, "user_db.sqlite"),
+				errors.ErrDatabaseStorageUnsupported.WithArgs("sqlite"),
+			),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			msgs = append(msgs, fmt.Sprintf("temporary directory: %s", tmpDir))
+			db, err := NewDatabaseWithStorage(tc.path, tc.kind)
+			if tests.EvalErrWithLog(t, err, "new database", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			defer db.Close()
+			got := make(map[string]interface{})
+			got["kind"] = db.GetStorageKind()
+			got["user_count"] = db.GetUserCount()
+			tests.EvalObjectsWithLog(t, "eval", tc.want, got, msgs)
+		})
+	}
+}
+
+func TestBoltStorage(t *testing.T) {
+	src, err := createTestDatabase("TestBoltStorage")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	fp := filepath.Join(filepath.Dir(src.GetPath()), "user_db.bolt")
+	db, err := NewDatabaseWithStorage(fp, StorageKindBolt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		db.Close()
+	}()
+
+	testcases := []struct {
+		name      string
+		op        func() error
+		want      map[string]interface{}
+		shouldErr bool
+		err       error
+	}{
+		{
+			name: "import json database",
+			op: func() error {
+				return db.Import(src)
+			},
+			want: map[string]interface{}{
+				"user_count":        2,
+				"loaded_user_count": 0,
+				"usernames":         map[string]bool{testUser1: true, testUser2: true},
+				"emails":            map[string]bool{testEmail1: true, testEmail2: true},
+				"admins":            map[string]bool{testUser1: false, testUser2: false},
+			},
+		},
+		{
+			name: "import json database into non-empty database",
+			op: func() error {
+				return db.Import(src)
+			},
+			shouldErr: true,
+			err:       errors.ErrDatabaseImportNotEmpty.WithArgs(2),
+		},
+		{
+			name: "reopen database and authenticate user",
+			op: func() error {
+				if err := db.Close(); err != nil {
+					return err
+				}
+				reopened, err := NewDatabaseWithStorage(fp, StorageKindBolt)
+				if err != nil {
+					return err
+				}
+				db = reopened
+				return db.AuthenticateUser(&requests.Request{
+					User: requests.User{
+						Username: testUser1,
+						Password: testPwd1,
+					},
+				})
+			},
+			want: map[string]interface{}{
+				"user_count":        2,
+				"loaded_user_count": 0,
+				"usernames":         map[string]bool{testUser1: true, testUser2: true},
+				"emails":            map[string]bool{testEmail1: true, testEmail2: true},
+				"admins":            map[string]bool{testUser1: false, testUser2: false},
+			},
+		},
+		{
+			name: "add user",
+			op: func() error {
+				return db.AddUser(&requests.Request{
+					User: requests.User{
+						Username: "foobar",
+						Password: "Foo.Bar-123",
+						Email:    "foobar@localdomain.local",
+						Roles:    []string{"viewer"},
+					},
+				})
+			},
+			want: map[string]interface{}{
+				"user_count":        3,
+				"loaded_user_count": 0,
+				"usernames":         map[string]bool{testUser1: true, testUser2: true, "foobar": true},
+				"emails":            map[string]bool{testEmail1: true, testEmail2: true, "foobar@localdomain.local": true},
+				"admins":            map[string]bool{testUser1: false, testUser2: false, "foobar": false},
+			},
+		},
+		{
+			name: "add api key and authenticate with it",
+			op: func() error {
+				r := &requests.Request{
+					User: requests.User{
+						Username: testUser1,
+						Email:    testEmail1,
+					},
+					Key: requests.Key{
+						Usage:   "api",
+						Comment: "foobar",
+					},
+				}
+				if err := db.AddAPIKey(r); err != nil {
+					return err
+				}
+				return db.LookupAPIKey(&requests.Request{
+					Key: requests.Key{
+						Payload: r.Response.Payload.(string),
+					},
+				})
+			},
+			want: map[string]interface{}{
+				"user_count":        3,
+				"loaded_user_count": 0,
+				"usernames":         map[string]bool{testUser1: true, testUser2: true, "foobar": true},
+				"emails":            map[string]bool{testEmail1: true, testEmail2: true, "foobar@localdomain.local": true},
+				"admins":            map[string]bool{testUser1: false, testUser2: false, "foobar": false},
+			},
+		},
+		{
+			name: "delete user",
+			op: func() error {
+				user, err := db.getUser(testUser2)
+				if err != nil {
+					return err
+				}
+				return db.DeleteUser(&requests.Request{Query: requests.Query{ID: user.ID}})
+			},
+			want: map[string]interface{}{
+				"user_count":        2,
+				"loaded_user_count": 0,
+				"usernames":         map[string]bool{testUser1: true, testUser2: false, "foobar": true},
+				"emails":            map[string]bool{testEmail1: true, testEmail2: false, "foobar@localdomain.local": true},
+				"admins":            map[string]bool{testUser1: false, "foobar": false},
+			},
+		},
+		{
+			name: "reopen store without indexes",
+			op: func() error {
+				if err := db.Close(); err != nil {
+					return err
+				}
+				bdb, err := bbolt.Open(fp, 0600, nil)
+				if err != nil {
+					return err
+				}
+				err = bdb.Update(func(tx *bbolt.Tx) error {
+					for _, bucket := range boltIndexes {
+						if err := tx.DeleteBucket(bucket); err != nil {
+							return err
+						}
+					}
+					return tx.DeleteBucket(boltAdminIndex)
+				})
+				if err != nil {
+					bdb.Close()
+					return err
+				}
+				if err := bdb.Close(); err != nil {
+					return err
+				}
+				db, err = NewDatabaseWithStorage(fp, StorageKindBolt)
+				return err
+			},
+			want: map[string]interface{}{
+				"user_count":        2,
+				"loaded_user_count": 0,
+				"usernames":         map[string]bool{testUser1: true, testUser2: false, "foobar": true},
+				"emails":            map[string]bool{testEmail1: true, testEmail2: false, "foobar@localdomain.local": true},
+				"admins":            map[string]bool{testUser1: false, "foobar": false},
+			},
+		},
+		{
+			name: "grant admin role",
+			op: func() error {
+				for _, username := range []string{"foobar", testUser1} {
+					user, err := db.getUser(username)
+					if err != nil {
+						return err
+					}
+					err = db.UpdateUserRoles(&requests.Request{
+						Query: requests.Query{ID: user.ID},
+						User:  requests.User{Roles: []string{"authp/admin"}},
+					})
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			want: map[string]interface{}{
+				"user_count":        2,
+				"loaded_user_count": 0,
+				"usernames":         map[string]bool{testUser1: true, "foobar": true},
+				"emails":            map[string]bool{testEmail1: true, "foobar@localdomain.local": true},
+				"admins":            map[string]bool{testUser1: true, "foobar": true},
+				"admin_count":       2,
+			},
+		},
+		{
+			name: "disable admin user",
+			op: func() error {
+				user, err := db.getUser(testUser1)
+				if err != nil {
+					return err
+				}
+				return db.DisableUser(&requests.Request{Query: requests.Query{ID: user.ID}})
+			},
+			want: map[string]interface{}{
+				"user_count":        2,
+				"loaded_user_count": 0,
+				"usernames":         map[string]bool{testUser1: true, "foobar": true},
+				"emails":            map[string]bool{testEmail1: true, "foobar@localdomain.local": true},
+				"admins":            map[string]bool{testUser1: false, "foobar": true},
+				"admin_count":       1,
+			},
+		},
+		{
+			name: "disable last admin user",
+			op: func() error {
+				user, err := db.getUser("foobar")
+				if err != nil {
+					return err
+				}
+				return db.DisableUser(&requests.Request{Query: requests.Query{ID: user.ID}})
+			},
+			shouldErr: true,
+			err:       errors.ErrUpdateUser.WithArgs("foobar", errors.ErrLastAdminUser),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			msgs = append(msgs, fmt.Sprintf("database path: %s", fp))
+			err := tc.op()
+			if tests.EvalErrWithLog(t, err, "op", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			storage := db.storage.(*boltStorage)
+			got := make(map[string]interface{})
+			got["user_count"] = db.GetUserCount()
+			got["loaded_user_count"] = len(db.Users)
+			usernames := make(map[string]bool)
+			for k := range tc.want["usernames"].(map[string]bool) {
+				_, err := storage.lookupUser(userIndexUsername, k)
+				usernames[k] = err == nil
+			}
+			got["usernames"] = usernames
+			emails := make(map[string]bool)
+			for k := range tc.want["emails"].(map[string]bool) {
+				_, err := storage.lookupUser(userIndexEmailAddress, k)
+				emails[k] = err == nil
+			}
+			got["emails"] = emails
+			admins := make(map[string]bool)
+			for k := range tc.want["admins"].(map[string]bool) {
+				admins[k] = false
+			}
+			users, err := storage.listAdminUsers()
+			if err != nil {
+				t.Fatalf("failed listing admin users: %v", err)
+			}
+			for _, user := range users {
+				admins[user.Username] = true
+			}
+			got["admins"] = admins
+			if _, exists := tc.want["admin_count"]; exists {
+				got["admin_count"] = db.GetAdminUserCount()
+			}
+			tests.EvalObjectsWithLog(t, "output", tc.want, got, msgs)
+		})
+	}
+}
+
+func TestOpenDatabaseReadOnly(t *testing.T) {
+	src, err := createTestDatabase("TestOpenDatabaseReadOnly")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	fp := src.GetPath()
+	// The database saved by an earlier version lacks some of the policy.
+	var m map[string]interface{}
+	b, err := os.ReadFile(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	delete(m, "policy")
+	b, err = json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fp, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := OpenDatabaseReadOnly(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	user, err := db.getUser(testUser2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.DeleteUser(&requests.Request{Query: requests.Query{ID: user.ID}})
+	msgs := []string{fmt.Sprintf("database path: %s", fp)}
+	tests.EvalErrWithLog(t, err, "delete user", true, errors.ErrDeleteUser.WithArgs(testUser2, errors.ErrDatabaseReadOnly), msgs)
+
+	dst, err := NewDatabaseWithStorage(filepath.Join(filepath.Dir(fp), "user_db.bolt"), StorageKindBolt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	if err := dst.Import(db); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests.EvalObjectsWithLog(t, "output", map[string]interface{}{
+		"source":            string(b),
+		"user_count":        2,
+		"policy_min_length": defaultPolicy.Password.MinLength,
+	}, map[string]interface{}{
+		"source":            string(got),
+		"user_count":        dst.GetUserCount(),
+		"policy_min_length": dst.Policy.Password.MinLength,
+	}, msgs)
+
+	missing := filepath.Join(filepath.Dir(fp), "missing", "user_db.json")
+	if _, err := OpenDatabaseReadOnly(missing); err == nil {
+		t.Fatalf("expected error opening %q", missing)
+	}
+	if _, err := os.Stat(filepath.Dir(missing)); !os.IsNotExist(err) {
+		t.Fatalf("expected %q to be left missing, got: %v", filepath.Dir(missing), err)
+	}
+}
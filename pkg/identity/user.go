@@ -15,6 +15,8 @@
 package identity
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
 	"strings"
 	"time"
 
@@ -26,6 +28,7 @@ import (
 type UserMetadata struct {
 	ID           string    `json:"id,omitempty" xml:"id,omitempty" yaml:"id,omitempty"`
 	Enabled      bool      `json:"enabled,omitempty" xml:"enabled,omitempty" yaml:"enabled,omitempty"`
+	Disabled     bool      `json:"disabled,omitempty" xml:"disabled,omitempty" yaml:"disabled,omitempty"`
 	Username     string    `json:"username,omitempty" xml:"username,omitempty" yaml:"username,omitempty"`
 	Title        string    `json:"title,omitempty" xml:"title,omitempty" yaml:"title,omitempty"`
 	Name         string    `json:"name,omitempty" xml:"name,omitempty" yaml:"name,omitempty"`
@@ -34,6 +37,8 @@ type UserMetadata struct {
 	LastModified time.Time `json:"last_modified,omitempty" xml:"last_modified,omitempty" yaml:"last_modified,omitempty"`
 	Revision     int       `json:"revision,omitempty" xml:"revision,omitempty" yaml:"revision,omitempty"`
 	Avatar       string    `json:"avatar,omitempty" xml:"avatar,omitempty" yaml:"avatar,omitempty"`
+	Roles        []string  `json:"roles,omitempty" xml:"roles,omitempty" yaml:"roles,omitempty"`
+	LockedOut    bool      `json:"locked_out,omitempty" xml:"locked_out,omitempty" yaml:"locked_out,omitempty"`
 }
 
 // UserMetadataBundle is a collection of public users.
@@ -42,10 +47,12 @@ type UserMetadataBundle struct {
 	size  int
 }
 
-// User is a user identity.
+// User is a user identity. The Enabled field is the opposite of Disabled,
+// and is kept in sync with it.
 type User struct {
 	ID             string          `json:"id,omitempty" xml:"id,omitempty" yaml:"id,omitempty"`
 	Enabled        bool            `json:"enabled,omitempty" xml:"enabled,omitempty" yaml:"enabled,omitempty"`
+	Disabled       bool            `json:"disabled,omitempty" xml:"disabled,omitempty" yaml:"disabled,omitempty"`
 	Human          bool            `json:"human,omitempty" xml:"human,omitempty" yaml:"human,omitempty"`
 	Username       string          `json:"username,omitempty" xml:"username,omitempty" yaml:"username,omitempty"`
 	Title          string          `json:"title,omitempty" xml:"title,omitempty" yaml:"title,omitempty"`
@@ -97,6 +104,7 @@ func (b *UserMetadataBundle) Size() int {
 func NewUser(s string) *User {
 	user := &User{
 		ID:           NewID(),
+		Enabled:      true,
 		Username:     s,
 		Created:      time.Now().UTC(),
 		LastModified: time.Now().UTC(),
@@ -106,8 +114,12 @@ func NewUser(s string) *User {
 
 // NewUserWithRoles returns User with additional fields.
 func NewUserWithRoles(username, password, email, fullName string, roles []string) (*User, error) {
+	return newUserWithPolicy(username, password, email, fullName, roles, &PasswordPolicy{})
+}
+
+func newUserWithPolicy(username, password, email, fullName string, roles []string, policy *PasswordPolicy) (*User, error) {
 	user := NewUser(username)
-	if err := user.AddPassword(password, 0); err != nil {
+	if err := user.AddPasswordWithPolicy(password, policy); err != nil {
 		return nil, err
 	}
 	if err := user.AddEmailAddress(email); err != nil {
@@ -150,8 +162,15 @@ func (user *User) Valid() error {
 
 // AddPassword returns creates and adds password for a user identity.
 func (user *User) AddPassword(s string, keepVersions int) error {
+	return user.AddPasswordWithPolicy(s, &PasswordPolicy{KeepVersions: keepVersions})
+}
+
+// AddPasswordWithPolicy adds password to User. The password is hashed with
+// the algorithm of the policy.
+func (user *User) AddPasswordWithPolicy(s string, policy *PasswordPolicy) error {
 	var passwords []*Password
-	password, err := NewPassword(s)
+	keepVersions := policy.KeepVersions
+	password, err := policy.NewPassword(s)
 	if err != nil {
 		return err
 	}
@@ -264,6 +283,92 @@ func (user *User) AddRole(s string) error {
 	return nil
 }
 
+// SetRoles replaces the roles of a user identity.
+func (user *User) SetRoles(roles []string) error {
+	var entries []*Role
+	for _, s := range roles {
+		role, err := NewRole(s)
+		if err != nil {
+			return err
+		}
+		var found bool
+		for _, r := range entries {
+			if (r.Name == role.Name) && (r.Organization == role.Organization) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			entries = append(entries, role)
+		}
+	}
+	user.Roles = entries
+	user.Revise()
+	return nil
+}
+
+// Disable disables a user identity.
+func (user *User) Disable() {
+	if user.Disabled {
+		return
+	}
+	user.Disabled = true
+	user.Enabled = false
+	user.Revise()
+}
+
+// Enable enables a previously disabled user identity.
+func (user *User) Enable() {
+	if !user.Disabled {
+		return
+	}
+	user.Disabled = false
+	user.Enabled = true
+	user.Revise()
+}
+
+// IsLockedOut returns true if the user identity is locked out.
+func (user *User) IsLockedOut() bool {
+	return user.Lockout.Active(time.Now().UTC())
+}
+
+// RecordFailedAuth registers a failed authentication attempt. It returns
+// true when the attempt results in a lockout.
+func (user *User) RecordFailedAuth(p *LockoutPolicy) bool {
+	if user.Lockout == nil {
+		user.Lockout = NewLockoutState()
+	}
+	return user.Lockout.RecordFailure(p, time.Now().UTC())
+}
+
+// hasFailedAuth returns true when the user has failed authentication
+// attempts or lockouts on record.
+func (user *User) hasFailedAuth() bool {
+	if user.Lockout == nil {
+		return false
+	}
+	return user.Lockout.FailedAttempts != 0 || user.Lockout.Lockouts != 0 || user.Lockout.Enabled
+}
+
+// ResetFailedAuth clears failed authentication attempts following a
+// successful authentication. It returns true if the lockout state changed.
+func (user *User) ResetFailedAuth() bool {
+	if !user.hasFailedAuth() {
+		return false
+	}
+	user.Lockout = nil
+	return true
+}
+
+// Unlock removes the lockout of a user identity.
+func (user *User) Unlock() {
+	if user.Lockout == nil {
+		return
+	}
+	user.Lockout = nil
+	user.Revise()
+}
+
 // VerifyPassword verifies provided password matches to the one in the database.
 func (user *User) VerifyPassword(s string) error {
 	if len(user.Passwords) == 0 {
@@ -280,6 +385,30 @@ func (user *User) VerifyPassword(s string) error {
 	return errors.ErrUserPasswordInvalid
 }
 
+// GetPasswordFingerprint returns the digest of the hash of the current
+// password. It changes whenever the password changes.
+func (user *User) GetPasswordFingerprint() string {
+	if len(user.Passwords) == 0 {
+		return ""
+	}
+	h := sha256.Sum256([]byte(user.Passwords[0].Hash))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
+
+// IsPasswordExpired returns true when the current password of the user
+// is older than the provided maximum age. Zero maximum age means that
+// passwords do not expire.
+func (user *User) IsPasswordExpired(maxAge time.Duration) bool {
+	if maxAge == 0 || len(user.Passwords) == 0 {
+		return false
+	}
+	p := user.Passwords[0]
+	if p.CreatedAt.IsZero() {
+		return false
+	}
+	return time.Now().UTC().After(p.CreatedAt.Add(maxAge))
+}
+
 // VerifyWebAuthnRequest authenticated WebAuthn requests.
 func (user *User) VerifyWebAuthnRequest(r *requests.Request) error {
 	req, err := unpackWebAuthnRequest(r.WebAuthn.Request)
@@ -512,42 +641,19 @@ func (user *User) GetFlags(r *requests.Request) {
 	}
 }
 
-// ChangePassword changes user password.
-func (user *User) ChangePassword(r *requests.Request, keepVersions int) error {
-	if err := user.VerifyPassword(r.User.OldPassword); err != nil {
-		return errors.ErrChangeUserPassword.WithArgs(err)
-	}
-	if err := user.AddPassword(r.User.Password, keepVersions); err != nil {
-		return errors.ErrChangeUserPassword.WithArgs(err)
-	}
-	return nil
-}
-
-// UpdatePassword update user password.
-func (user *User) UpdatePassword(r *requests.Request, keepVersions int) error {
-	if !strings.HasPrefix(r.User.Password, "bcrypt:") {
-		// Check whether the existing password matches the newly provided password,
-		// and skip updating if it is.
-		if user.VerifyPassword(r.User.Password) == nil {
-			return nil
-		}
-	}
-	if err := user.AddPassword(r.User.Password, keepVersions); err != nil {
-		return errors.ErrUpdateUserPassword.WithArgs(err)
-	}
-	return nil
-}
-
 // GetMetadata returns user metadata.
 func (user *User) GetMetadata() *UserMetadata {
 	m := &UserMetadata{
 		ID:           user.ID,
-		Enabled:      user.Enabled,
+		Enabled:      !user.Disabled,
+		Disabled:     user.Disabled,
 		Username:     user.Username,
 		Title:        user.Title,
 		Created:      user.Created,
 		LastModified: user.LastModified,
 		Revision:     user.Revision,
+		Roles:        user.GetRolesClaim(),
+		LockedOut:    user.IsLockedOut(),
 	}
 	if user.Avatar != nil {
 		m.Avatar = user.Avatar.Path
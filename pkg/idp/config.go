@@ -73,10 +73,13 @@ func (cfg *IdentityProviderConfig) Validate() error {
 			"response_type_disabled",
 			"scope_disabled",
 			"nonce_disabled",
+			"pkce_disabled",
 			// Enabled features.
 			"accept_header_enabled",
 			"js_callback_enabled",
 			"logout_enabled",
+			"pkce_enabled",
+			"refresh_token_enabled",
 			// Retry and delay.
 			"delay_start",
 			"retry_attempts",
@@ -116,6 +119,10 @@ func (cfg *IdentityProviderConfig) Validate() error {
 			"application_name",
 			"tls_insecure_skip_verify",
 			"login_icon",
+			"sp_key_location",
+			"sp_cert_location",
+			"attributes",
+			"logout_enabled",
 		}
 	case "":
 		return errors.ErrIdentityProviderConfigInvalid.WithArgs("empty identity provider type")
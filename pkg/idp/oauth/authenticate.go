@@ -85,9 +85,7 @@ func (b *IdentityProvider) Authenticate(r *requests.Request) error {
 		switch {
 		case codeExists && stateExists:
 			// Received Authorization Code
-			if b.state.exists(reqParamsState) {
-				b.state.addCode(reqParamsState, reqParamsCode)
-			} else {
+			if err := b.state.addCode(reqParamsState, reqParamsCode); err != nil {
 				return errors.ErrIdentityProviderOauthAuthorizationStateNotFound
 			}
 			b.logger.Debug(
@@ -155,6 +153,12 @@ func (b *IdentityProvider) Authenticate(r *requests.Request) error {
 				)
 			}
 
+			if b.enableRefreshToken {
+				if v, ok := accessToken["refresh_token"].(string); ok {
+					r.Session.RefreshToken = v
+				}
+			}
+
 			if b.config.IdentityTokenCookieEnabled {
 				if v, exists := accessToken["id_token"]; exists {
 					r.Response.IdentityTokenCookie.Enabled = true
@@ -232,9 +236,19 @@ func (b *IdentityProvider) Authenticate(r *requests.Request) error {
 
 	params.Set("client_id", b.config.ClientID)
 
+	var codeVerifier string
+	if b.enablePKCE {
+		// Authorization Code Interception Protection
+		codeVerifier = util.GetRandomStringFromRange(64, 96)
+		params.Set("code_challenge", getCodeChallenge(codeVerifier))
+		params.Set("code_challenge_method", "S256")
+	}
+
 	r.Response.RedirectURL = b.authorizationURL + "?" + params.Encode()
 
-	b.state.add(state, nonce)
+	if err := b.state.add(state, nonce, codeVerifier); err != nil {
+		return errors.ErrIdentityProviderOauthAuthorizationStateSave.WithArgs(err)
+	}
 	b.logger.Debug(
 		"redirecting to OAuth 2.0 endpoint",
 		zap.String("request_id", r.ID),
@@ -253,11 +267,26 @@ func (b *IdentityProvider) fetchAccessToken(redirectURI, state, code string) (ma
 	params.Set("state", state)
 	params.Set("code", code)
 	params.Set("redirect_uri", redirectURI)
+	if verifier := b.state.getCodeVerifier(state); verifier != "" {
+		params.Set("code_verifier", verifier)
+	}
 
-	cli := &http.Client{
-		Timeout: time.Second * 10,
+	data, err := b.requestToken(params)
+	if err != nil {
+		return nil, err
+	}
+
+	for k := range b.requiredTokenFields {
+		if _, exists := data[k]; !exists {
+			return nil, errors.ErrIdentityProviderAuthorizationServerResponseFieldNotFound.WithArgs(k)
+		}
 	}
+	return data, nil
+}
 
+// requestToken sends the token request to the token endpoint of the
+// authorization server.
+func (b *IdentityProvider) requestToken(params url.Values) (map[string]interface{}, error) {
 	cli, err := b.newBrowser()
 	if err != nil {
 		return nil, err
@@ -290,7 +319,7 @@ func (b *IdentityProvider) fetchAccessToken(redirectURI, state, code string) (ma
 	b.logger.Debug(
 		"OAuth 2.0 access token response received",
 		zap.Any("body", respBody),
-		zap.String("redirect_uri", redirectURI),
+		zap.String("redirect_uri", params.Get("redirect_uri")),
 	)
 
 	data := make(map[string]interface{})
@@ -314,12 +343,6 @@ func (b *IdentityProvider) fetchAccessToken(redirectURI, state, code string) (ma
 			return nil, errors.ErrIdentityProviderOauthGetAccessTokenFailed.WithArgs(data["error"])
 		}
 	}
-
-	for k := range b.requiredTokenFields {
-		if _, exists := data[k]; !exists {
-			return nil, errors.ErrIdentityProviderAuthorizationServerResponseFieldNotFound.WithArgs(k)
-		}
-	}
 	return data, nil
 }
 
@@ -329,6 +352,9 @@ func (b *IdentityProvider) fetchFacebookAccessToken(redirectURI, state, code str
 	params.Set("client_secret", b.config.ClientSecret)
 	params.Set("code", code)
 	params.Set("redirect_uri", redirectURI)
+	if verifier := b.state.getCodeVerifier(state); verifier != "" {
+		params.Set("code_verifier", verifier)
+	}
 
 	cli := &http.Client{
 		Timeout: time.Second * 10,
@@ -109,6 +109,15 @@ type Config struct {
 	IdentityTokenCookieName string `json:"identity_token_cookie_name,omitempty" xml:"identity_token_cookie_name,omitempty" yaml:"identity_token_cookie_name,omitempty"`
 	// Enables the storing of id_token from OAuth provider in a HTTP cookie.
 	IdentityTokenCookieEnabled bool `json:"identity_token_cookie_enabled,omitempty" xml:"identity_token_cookie_enabled,omitempty" yaml:"identity_token_cookie_enabled,omitempty"`
+
+	// Enables PKCE (RFC 7636) for the drivers not using it by default.
+	PKCEEnabled bool `json:"pkce_enabled,omitempty" xml:"pkce_enabled,omitempty" yaml:"pkce_enabled,omitempty"`
+	// Disables PKCE. It is enabled by default for the generic, okta, google,
+	// azure, and gitlab drivers.
+	PKCEDisabled bool `json:"pkce_disabled,omitempty" xml:"pkce_disabled,omitempty" yaml:"pkce_disabled,omitempty"`
+	// Enables the storing of refresh_token from OAuth provider. The portal
+	// uses it to check the user with the provider when renewing the session.
+	RefreshTokenEnabled bool `json:"refresh_token_enabled,omitempty" xml:"refresh_token_enabled,omitempty" yaml:"refresh_token_enabled,omitempty"`
 }
 
 // Validate validates identity store configuration.
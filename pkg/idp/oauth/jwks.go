@@ -16,8 +16,6 @@ package oauth
 
 import (
 	"bytes"
-	"crypto/ecdsa"
-	"crypto/elliptic"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/base64"
@@ -25,10 +23,9 @@ import (
 	"encoding/pem"
 	"fmt"
 	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/kms"
 	"github.com/greenpau/go-authcrunch/pkg/util"
 	"io/ioutil"
-	"math/big"
-	"strings"
 )
 
 // JwksKey is a JSON object that represents a cryptographic key.
@@ -54,149 +51,23 @@ type JwksKey struct {
 
 // Validate returns error if JwksKey does not contain relevant information.
 func (k *JwksKey) Validate() error {
-	if k.KeyID == "" {
-		return errors.ErrJwksKeyIDEmpty
+	jk := &kms.JwksKey{
+		KeyType:      k.KeyType,
+		PublicKeyUse: k.PublicKeyUse,
+		KeyID:        k.KeyID,
+		Algorithm:    k.Algorithm,
+		Modulus:      k.Modulus,
+		Exponent:     k.Exponent,
+		Curve:        k.Curve,
+		CoordX:       k.CoordX,
+		CoordY:       k.CoordY,
+		SharedSecret: k.SharedSecret,
 	}
-
-	switch k.KeyType {
-	case "RSA":
-		switch k.Algorithm {
-		case "RS256", "RS384", "RS512", "RSA-OAEP-256", "":
-		default:
-			return errors.ErrJwksKeyAlgoUnsupported.WithArgs(k.Algorithm, k.KeyID)
-		}
-	case "EC":
-		switch k.Curve {
-		case "P-256", "P-384", "P-521":
-		case "":
-			return errors.ErrJwksKeyCurveEmpty.WithArgs(k.KeyID)
-		default:
-			return errors.ErrJwksKeyCurveUnsupported.WithArgs(k.Curve, k.KeyID)
-		}
-		if k.CoordX == "" || k.CoordY == "" {
-			return errors.ErrJwksKeyCurveCoordNotFound.WithArgs(k.KeyID)
-		}
-	case "oct":
-		if k.SharedSecret == "" {
-			return errors.ErrJwksKeySharedSecretEmpty.WithArgs(k.KeyID)
-		}
-		switch k.Algorithm {
-		case "HS256", "HS384", "HS512", "":
-		default:
-			return errors.ErrJwksKeyAlgoUnsupported.WithArgs(k.Algorithm, k.KeyID)
-		}
-	case "":
-		return errors.ErrJwksKeyTypeEmpty.WithArgs(k.KeyID)
-	default:
-		return errors.ErrJwksKeyTypeUnsupported.WithArgs(k.KeyType, k.KeyID)
-	}
-
-	switch k.PublicKeyUse {
-	case "sig", "enc", "":
-	default:
-		return errors.ErrJwksKeyUsageUnsupported.WithArgs(k.PublicKeyUse, k.KeyID)
-	}
-
-	switch k.KeyType {
-	case "RSA":
-		if k.Exponent == "" {
-			return errors.ErrJwksKeyExponentEmpty.WithArgs(k.KeyID)
-		}
-
-		if k.Modulus == "" {
-			return errors.ErrJwksKeyModulusEmpty.WithArgs(k.KeyID)
-		}
-
-		// Add padding
-		if i := len(k.Modulus) % 4; i != 0 {
-			k.Modulus += strings.Repeat("=", 4-i)
-		}
-
-		var mod []byte
-		var err error
-		if strings.ContainsAny(k.Modulus, "/+") {
-			// This decoding works with + and / signs. (legacy)
-			mod, err = base64.StdEncoding.DecodeString(k.Modulus)
-		} else {
-			// This decoding works with - and _ signs.
-			mod, err = base64.URLEncoding.DecodeString(k.Modulus)
-		}
-
-		if err != nil {
-			return errors.ErrJwksKeyDecodeModulus.WithArgs(k.KeyID, k.Modulus, err)
-		}
-		n := big.NewInt(0)
-		n.SetBytes(mod)
-
-		exp, err := base64.StdEncoding.DecodeString(k.Exponent)
-		if err != nil {
-			return errors.ErrJwksKeyDecodeExponent.WithArgs(k.KeyID, err)
-		}
-		// The "e" (exponent) parameter contains the exponent value for the RSA
-		// public key.  It is represented as a Base64urlUInt-encoded value.
-		//
-		// For instance, when representing the value 65537, the octet sequence
-		// to be base64url-encoded MUST consist of the three octets [1, 0, 1];
-		// the resulting representation for this value is "AQAB".
-		var eb []byte
-		if len(exp) < 8 {
-			eb = make([]byte, 8-len(exp), 8)
-			eb = append(eb, exp...)
-		} else {
-			eb = exp
-		}
-		er := bytes.NewReader(eb)
-		var e uint64
-		if err := binary.Read(er, binary.BigEndian, &e); err != nil {
-			return errors.ErrJwksKeyConvExponent.WithArgs(k.KeyID, err)
-		}
-		k.publicKey = &rsa.PublicKey{N: n, E: int(e)}
-	case "EC":
-		var expByteCount int
-		pk := &ecdsa.PublicKey{}
-		switch k.Curve {
-		case "P-256":
-			pk.Curve = elliptic.P256()
-			expByteCount = 32
-		case "P-384":
-			pk.Curve = elliptic.P384()
-			expByteCount = 48
-		case "P-521":
-			pk.Curve = elliptic.P521()
-			expByteCount = 66
-		}
-
-		for i, c := range []string{k.CoordX, k.CoordY} {
-			ltr := "X"
-			if i > 0 {
-				ltr = "Y"
-			}
-			b, err := base64.RawURLEncoding.DecodeString(c)
-			if err != nil {
-				return errors.ErrJwksKeyDecodeCoord.WithArgs(k.KeyID, ltr, err)
-			}
-			if len(b) != expByteCount {
-				return errors.ErrJwksKeyCoordLength.WithArgs(k.KeyID, ltr, len(b), expByteCount)
-			}
-			bi := big.NewInt(0)
-			bi.SetBytes(b)
-			if i == 0 {
-				pk.X = bi
-				continue
-			}
-			pk.Y = bi
-		}
-		k.publicKey = pk
-	case "oct":
-		key, err := base64.RawURLEncoding.DecodeString(k.SharedSecret)
-		if err != nil {
-			return errors.ErrJwksKeyDecodeSharedSecret.WithArgs(k.KeyID, err)
-		}
-		k.publicKey = key
-	default:
-		return errors.ErrJwksKeyTypeNotImplemented.WithArgs(k.KeyID, k.KeyType, k)
+	if err := jk.Validate(); err != nil {
+		return err
 	}
-
+	k.Modulus = jk.Modulus
+	k.publicKey = jk.GetPublic()
 	return nil
 }
 
@@ -19,6 +19,7 @@ import (
 	"github.com/greenpau/go-authcrunch/pkg/authn/enums/operator"
 	"github.com/greenpau/go-authcrunch/pkg/authn/icons"
 	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/kvstore"
 	"github.com/greenpau/go-authcrunch/pkg/requests"
 	"go.uber.org/zap"
 	"io/ioutil"
@@ -65,6 +66,8 @@ type IdentityProvider struct {
 	disableScope           bool
 	enableAcceptHeader     bool
 	enableBodyDecoder      bool
+	enablePKCE             bool
+	enableRefreshToken     bool
 	requiredTokenFields    map[string]interface{}
 	scopeMap               map[string]interface{}
 	userInfoFields         map[string]interface{}
@@ -128,6 +131,12 @@ func (b *IdentityProvider) GetConfig() map[string]interface{} {
 	return m
 }
 
+// SetCacheStore sets the key/value store holding the states of the
+// authorization requests, e.g. a store shared by several instances.
+func (b *IdentityProvider) SetCacheStore(store kvstore.Store) {
+	b.state.setStore(kvstore.WithPrefix(store, "oauth/"+b.config.Name+"/"))
+}
+
 // ScopeExists returns true if any of the provided scopes exist.
 func (b *IdentityProvider) ScopeExists(scopes ...string) bool {
 	for _, scope := range scopes {
@@ -143,6 +152,8 @@ func (b *IdentityProvider) Request(op operator.Type, r *requests.Request) error
 	switch op {
 	case operator.Authenticate:
 		return b.Authenticate(r)
+	case operator.RefreshSession:
+		return b.RefreshSession(r)
 	}
 	return errors.ErrOperatorNotSupported.WithArgs(op)
 }
@@ -191,11 +202,8 @@ func (b *IdentityProvider) Configure() error {
 	}
 
 	switch b.config.Driver {
-	case "generic":
-	case "okta":
-	case "google":
-	case "gitlab":
-	case "azure":
+	case "generic", "okta", "google", "gitlab", "azure":
+		b.enablePKCE = true
 	case "github":
 		b.disableKeyVerification = true
 		b.disablePassGrantType = true
@@ -218,6 +226,16 @@ func (b *IdentityProvider) Configure() error {
 		b.disableKeyVerification = true
 	}
 
+	if b.config.PKCEEnabled {
+		b.enablePKCE = true
+	}
+	if b.config.PKCEDisabled {
+		b.enablePKCE = false
+	}
+	if b.config.RefreshTokenEnabled {
+		b.enableRefreshToken = true
+	}
+
 	b.serverName = b.config.ServerName
 
 	b.requiredTokenFields = make(map[string]interface{})
@@ -267,6 +285,8 @@ func (b *IdentityProvider) Configure() error {
 		zap.Int("retry_attempts", b.config.RetryAttempts),
 		zap.Int("retry_interval", b.config.RetryInterval),
 		zap.Strings("scopes", b.config.Scopes),
+		zap.Bool("pkce_enabled", b.enablePKCE),
+		zap.Bool("refresh_token_enabled", b.enableRefreshToken),
 		zap.Any("login_icon", b.config.LoginIcon),
 	)
 
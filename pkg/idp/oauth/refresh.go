@@ -0,0 +1,95 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/requests"
+
+	"go.uber.org/zap"
+)
+
+// RefreshSession exchanges the refresh token of the user for new tokens.
+// It confirms that the user is still active with the authorization server
+// and returns the current user claims, e.g. with changed group membership.
+func (b *IdentityProvider) RefreshSession(r *requests.Request) error {
+	r.Response.Code = http.StatusUnauthorized
+	if r.Session.RefreshToken == "" {
+		return errors.ErrIdentityProviderOauthRefreshTokenNotFound
+	}
+
+	params := url.Values{}
+	params.Set("client_id", b.config.ClientID)
+	params.Set("client_secret", b.config.ClientSecret)
+	params.Set("grant_type", "refresh_token")
+	params.Set("refresh_token", r.Session.RefreshToken)
+
+	accessToken, err := b.requestToken(params)
+	if err != nil {
+		return errors.ErrIdentityProviderOauthRefreshSessionFailed.WithArgs(err)
+	}
+	if _, exists := accessToken["access_token"]; !exists {
+		return errors.ErrIdentityProviderOauthRefreshSessionFailed.WithArgs(
+			errors.ErrIdentityProviderAuthorizationServerResponseFieldNotFound.WithArgs("access_token"),
+		)
+	}
+
+	var m map[string]interface{}
+	switch b.config.Driver {
+	case "github", "gitlab", "facebook", "discord", "linkedin":
+		m, err = b.fetchClaims(accessToken)
+		if err != nil {
+			return errors.ErrIdentityProviderOauthFetchClaimsFailed.WithArgs(err)
+		}
+	default:
+		m, err = b.validateRefreshedAccessToken(accessToken)
+		if err != nil {
+			return errors.ErrIdentityProviderOauthValidateAccessTokenFailed.WithArgs(err)
+		}
+	}
+
+	if err := b.fetchUserInfo(accessToken, m); err != nil {
+		b.logger.Debug(
+			"failed fetching user info",
+			zap.String("request_id", r.ID),
+			zap.Error(err),
+		)
+	}
+
+	if err := b.fetchUserGroups(accessToken, m); err != nil {
+		b.logger.Debug(
+			"failed fetching user groups",
+			zap.String("request_id", r.ID),
+			zap.Error(err),
+		)
+	}
+
+	// The authorization server may rotate refresh tokens.
+	if v, ok := accessToken["refresh_token"].(string); ok && v != "" {
+		r.Session.RefreshToken = v
+	}
+
+	r.Response.Payload = m
+	r.Response.Code = http.StatusOK
+	b.logger.Debug(
+		"refreshed OAuth 2.0 session",
+		zap.String("request_id", r.ID),
+		zap.Any("claims", m),
+	)
+	return nil
+}
@@ -0,0 +1,256 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	jwtlib "github.com/golang-jwt/jwt/v4"
+	"github.com/greenpau/go-authcrunch/internal/tests"
+	"github.com/greenpau/go-authcrunch/pkg/requests"
+	logutil "github.com/greenpau/go-authcrunch/pkg/util/log"
+)
+
+type testAuthorizationServer struct {
+	t      *testing.T
+	mu     sync.Mutex
+	pk     *rsa.PrivateKey
+	jwk    *JwksKey
+	groups []string
+	// challenge is the PKCE code challenge of the authorization request.
+	challenge string
+	nonce     string
+	// refreshTokens holds the valid refresh tokens.
+	refreshTokens map[string]bool
+	counter       int
+	// params holds the parameters of the last token request.
+	params url.Values
+}
+
+func (s *testAuthorizationServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resp := make(map[string]interface{})
+	switch r.URL.Path {
+	case "/oauth/.well-known/openid-configuration":
+		resp["authorization_endpoint"] = "https://" + r.Host + "/oauth/authorize"
+		resp["token_endpoint"] = "https://" + r.Host + "/oauth/token"
+		resp["jwks_uri"] = "https://" + r.Host + "/oauth/jwks.json"
+	case "/oauth/jwks.json":
+		resp["keys"] = []*JwksKey{s.jwk}
+	case "/oauth/token":
+		if err := r.ParseForm(); err != nil {
+			s.t.Fatalf("failed parsing token request: %v", err)
+		}
+		s.params = r.PostForm
+		switch r.PostForm.Get("grant_type") {
+		case "authorization_code":
+			if s.challenge != "" && getCodeChallenge(r.PostForm.Get("code_verifier")) != s.challenge {
+				resp["error"] = "invalid_grant"
+				resp["error_description"] = "code verifier mismatch"
+				break
+			}
+			s.issueTokens(resp, true)
+		case "refresh_token":
+			if !s.refreshTokens[r.PostForm.Get("refresh_token")] {
+				resp["error"] = "invalid_grant"
+				break
+			}
+			delete(s.refreshTokens, r.PostForm.Get("refresh_token"))
+			s.issueTokens(resp, false)
+		default:
+			resp["error"] = "unsupported_grant_type"
+		}
+	default:
+		s.t.Fatalf("unsupported path: %v", r.URL.Path)
+	}
+	b, _ := json.Marshal(resp)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+func (s *testAuthorizationServer) issueTokens(resp map[string]interface{}, withNonce bool) {
+	claims := jwtlib.MapClaims{
+		"sub":    "jsmith",
+		"email":  "jsmith@contoso.com",
+		"groups": s.groups,
+		"exp":    time.Now().Add(time.Hour).Unix(),
+	}
+	if withNonce {
+		claims["nonce"] = s.nonce
+	}
+	token := jwtlib.NewWithClaims(jwtlib.SigningMethodRS256, claims)
+	token.Header["kid"] = s.jwk.KeyID
+	idToken, err := token.SignedString(s.pk)
+	if err != nil {
+		s.t.Fatalf("failed signing id token: %v", err)
+	}
+	s.counter++
+	refreshToken := fmt.Sprintf("refresh-token-%d", s.counter)
+	s.refreshTokens[refreshToken] = true
+	resp["access_token"] = "access-token"
+	resp["id_token"] = idToken
+	resp["refresh_token"] = refreshToken
+}
+
+func (s *testAuthorizationServer) setGroups(groups ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.groups = groups
+}
+
+func newTestAuthorizationServer(t *testing.T) *testAuthorizationServer {
+	pk, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk, err := NewJwksKeyFromRSAPrivateKey(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testAuthorizationServer{
+		t:             t,
+		pk:            pk,
+		jwk:           jwk,
+		groups:        []string{"users"},
+		refreshTokens: make(map[string]bool),
+	}
+}
+
+func newTestOauthRequest(rawQuery string) *requests.Request {
+	r := requests.NewRequest()
+	r.ID = "foobar"
+	r.Upstream.BaseURL = "https://localhost"
+	r.Upstream.BasePath = "/auth"
+	r.Upstream.Method = "oauth2"
+	r.Upstream.Realm = "contoso"
+	r.Upstream.Request = httptest.NewRequest("GET", "/auth/oauth2/contoso?"+rawQuery, nil)
+	return r
+}
+
+func TestAuthenticateWithPKCEAndRefreshToken(t *testing.T) {
+	testcases := []struct {
+		name   string
+		config *Config
+		want   map[string]interface{}
+	}{
+		{
+			name: "generic provider with pkce and refresh token",
+			config: &Config{
+				RefreshTokenEnabled: true,
+			},
+			want: map[string]interface{}{
+				"code_challenge_method": "S256",
+				"code_verifier_sent":    true,
+				"login_groups":          []interface{}{"users"},
+				"login_refresh_token":   "refresh-token-1",
+				"refresh_groups":        []interface{}{"users", "admins"},
+				"refresh_token":         "refresh-token-2",
+				"reused_token_error":    true,
+			},
+		},
+		{
+			name: "generic provider with pkce disabled",
+			config: &Config{
+				PKCEDisabled: true,
+			},
+			want: map[string]interface{}{
+				"code_challenge_method": "",
+				"code_verifier_sent":    false,
+				"login_groups":          []interface{}{"users"},
+				"login_refresh_token":   "",
+			},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			srv := newTestAuthorizationServer(t)
+			ts := httptest.NewTLSServer(srv)
+			defer ts.Close()
+
+			cfg := tc.config
+			cfg.Name = "contoso"
+			cfg.Realm = "contoso"
+			cfg.Driver = "generic"
+			cfg.ClientID = "foo"
+			cfg.ClientSecret = "bar"
+			cfg.BaseAuthURL = ts.URL + "/oauth"
+			cfg.MetadataURL = ts.URL + "/oauth/.well-known/openid-configuration"
+			cfg.TLSInsecureSkipVerify = true
+
+			prv, err := NewIdentityProvider(cfg, logutil.NewLogger())
+			if err != nil {
+				t.Fatalf("failed creating identity provider: %v", err)
+			}
+			if err := prv.Configure(); err != nil {
+				t.Fatalf("failed configuring identity provider: %v", err)
+			}
+
+			got := make(map[string]interface{})
+
+			// Redirect to the authorization server.
+			r := newTestOauthRequest("")
+			if err := prv.Authenticate(r); err != nil {
+				t.Fatalf("failed authorization request: %v", err)
+			}
+			redirectURL, err := url.Parse(r.Response.RedirectURL)
+			if err != nil {
+				t.Fatalf("failed parsing redirect url: %v", err)
+			}
+			params := redirectURL.Query()
+			got["code_challenge_method"] = params.Get("code_challenge_method")
+			srv.challenge = params.Get("code_challenge")
+			srv.nonce = params.Get("nonce")
+
+			// Receive the authorization code.
+			r = newTestOauthRequest(url.Values{"code": {"foo"}, "state": {params.Get("state")}}.Encode())
+			if err := prv.Authenticate(r); err != nil {
+				t.Fatalf("failed authentication: %v", err)
+			}
+			got["code_verifier_sent"] = srv.params.Get("code_verifier") != ""
+			got["login_groups"] = r.Response.Payload.(map[string]interface{})["groups"]
+			got["login_refresh_token"] = r.Session.RefreshToken
+
+			if r.Session.RefreshToken != "" {
+				// Refresh the session with changed group membership.
+				srv.setGroups("users", "admins")
+				rr := newTestOauthRequest("")
+				rr.Session.RefreshToken = r.Session.RefreshToken
+				if err := prv.RefreshSession(rr); err != nil {
+					t.Fatalf("failed refreshing session: %v", err)
+				}
+				got["refresh_groups"] = rr.Response.Payload.(map[string]interface{})["groups"]
+				got["refresh_token"] = rr.Session.RefreshToken
+
+				// The redeemed refresh token is no longer valid.
+				rr = newTestOauthRequest("")
+				rr.Session.RefreshToken = r.Session.RefreshToken
+				got["reused_token_error"] = prv.RefreshSession(rr) != nil
+			}
+
+			tests.EvalObjectsWithLog(t, "IdentityProvider", tc.want, got, msgs)
+		})
+	}
+}
@@ -15,99 +15,133 @@
 package oauth
 
 import (
+	"encoding/json"
 	"fmt"
 	"sync"
 	"time"
+
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/kvstore"
+)
+
+const (
+	stateKeyPrefix = "state/"
+	// stateLifetime is the time the user has to complete the
+	// authorization with the authorization server.
+	stateLifetime = 15 * time.Minute
 )
 
+// stateEntry is the state of an authorization request.
+type stateEntry struct {
+	Nonce string `json:"nonce"`
+	Code  string `json:"code,omitempty"`
+	// Verifier is the PKCE code verifier.
+	Verifier  string    `json:"verifier,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// stateManager keeps the states of authorization requests in a key/value
+// store, which is in memory unless set with setStore.
 type stateManager struct {
-	mux    sync.Mutex
-	nonces map[string]string
-	states map[string]time.Time
-	codes  map[string]string
-	status map[string]interface{}
+	mux   sync.RWMutex
+	store kvstore.Store
 }
 
 func newStateManager() *stateManager {
 	return &stateManager{
-		nonces: make(map[string]string),
-		states: make(map[string]time.Time),
-		codes:  make(map[string]string),
-		status: make(map[string]interface{}),
+		store: kvstore.NewMemoryStore(),
 	}
 }
 
-func (sm *stateManager) add(state, nonce string) {
+func (sm *stateManager) setStore(store kvstore.Store) {
 	sm.mux.Lock()
 	defer sm.mux.Unlock()
-	sm.nonces[state] = nonce
-	sm.states[state] = time.Now()
+	sm.store = store
+}
+
+func (sm *stateManager) getStore() kvstore.Store {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+	return sm.store
+}
+
+func (sm *stateManager) add(state, nonce, verifier string) error {
+	return sm.put(state, &stateEntry{
+		Nonce:     nonce,
+		Verifier:  verifier,
+		CreatedAt: time.Now().UTC(),
+	})
+}
+
+// put stores the state for the remainder of its lifetime.
+func (sm *stateManager) put(state string, entry *stateEntry) error {
+	ttl := time.Until(entry.CreatedAt.Add(stateLifetime))
+	if ttl <= 0 {
+		return errors.ErrIdentityProviderOauthAuthorizationStateNotFound
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return sm.getStore().Set(stateKeyPrefix+state, b, ttl)
+}
+
+func (sm *stateManager) get(state string) (*stateEntry, error) {
+	b, err := sm.getStore().Get(stateKeyPrefix + state)
+	if err != nil {
+		return nil, err
+	}
+	entry := &stateEntry{}
+	if err := json.Unmarshal(b, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
 }
 
 func (sm *stateManager) del(state string) {
-	sm.mux.Lock()
-	defer sm.mux.Unlock()
-	delete(sm.nonces, state)
-	delete(sm.states, state)
-	delete(sm.codes, state)
-	delete(sm.status, state)
+	sm.getStore().Delete(stateKeyPrefix + state)
 }
 
 func (sm *stateManager) exists(state string) bool {
-	sm.mux.Lock()
-	defer sm.mux.Unlock()
-	if _, exists := sm.states[state]; exists {
-		return true
+	if _, err := sm.get(state); err != nil {
+		return false
 	}
-	return false
+	return true
 }
 
 func (sm *stateManager) validateNonce(state, nonce string) error {
-	sm.mux.Lock()
-	defer sm.mux.Unlock()
-	v, exists := sm.nonces[state]
-	if !exists {
+	entry, err := sm.get(state)
+	if err != nil {
 		return fmt.Errorf("no nonce found for %s", state)
 	}
-	if v != nonce {
-		return fmt.Errorf("nonce mismatch %s (expected) vs. %s (received)", v, nonce)
+	if entry.Nonce != nonce {
+		return fmt.Errorf("nonce mismatch %s (expected) vs. %s (received)", entry.Nonce, nonce)
 	}
 	return nil
 }
 
-func (sm *stateManager) addCode(state, code string) {
-	sm.mux.Lock()
-	defer sm.mux.Unlock()
-	sm.codes[state] = code
+func (sm *stateManager) addCode(state, code string) error {
+	entry, err := sm.get(state)
+	if err != nil {
+		return err
+	}
+	entry.Code = code
+	return sm.put(state, entry)
+}
+
+func (sm *stateManager) getCodeVerifier(state string) string {
+	entry, err := sm.get(state)
+	if err != nil {
+		return ""
+	}
+	return entry.Verifier
 }
 
+// manageStateManager purges expired states from the stores that do not
+// expire entries on their own.
 func manageStateManager(sm *stateManager) {
 	intervals := time.NewTicker(time.Minute * time.Duration(2))
 	for range intervals.C {
-		if sm.states == nil {
-			return
-		}
-		now := time.Now()
-		sm.mux.Lock()
-		for state, ts := range sm.states {
-			deleteState := false
-			if _, exists := sm.status[state]; !exists {
-				if ts.Sub(now).Minutes() > 5 {
-					deleteState = true
-				}
-			} else {
-				if ts.Sub(now).Hours() > 12 {
-					deleteState = true
-				}
-			}
-			if deleteState {
-				delete(sm.nonces, state)
-				delete(sm.states, state)
-				delete(sm.codes, state)
-				delete(sm.status, state)
-			}
-		}
-		sm.mux.Unlock()
+		kvstore.Purge(sm.getStore())
 	}
-	return
 }
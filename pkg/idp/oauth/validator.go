@@ -32,6 +32,16 @@ var (
 )
 
 func (b *IdentityProvider) validateAccessToken(state string, data map[string]interface{}) (map[string]interface{}, error) {
+	return b.validateToken(state, data, true)
+}
+
+// validateRefreshedAccessToken validates the token issued in exchange for
+// a refresh token. The nonce claim of such tokens is optional.
+func (b *IdentityProvider) validateRefreshedAccessToken(data map[string]interface{}) (map[string]interface{}, error) {
+	return b.validateToken("", data, false)
+}
+
+func (b *IdentityProvider) validateToken(state string, data map[string]interface{}, nonceRequired bool) (map[string]interface{}, error) {
 	var tokenString string
 	if v, exists := data[b.config.IdentityTokenName]; exists {
 		tokenString = v.(string)
@@ -84,11 +94,13 @@ func (b *IdentityProvider) validateAccessToken(state string, data map[string]int
 		return nil, errors.ErrIdentityProviderOAuthInvalidToken.WithArgs(b.config.IdentityTokenName, tokenString)
 	}
 	claims := token.Claims.(jwtlib.MapClaims)
-	if _, exists := claims["nonce"]; !exists {
-		return nil, errors.ErrIdentityProviderOAuthNonceValidationFailed.WithArgs(b.config.IdentityTokenName, "nonce not found")
-	}
-	if err := b.state.validateNonce(state, claims["nonce"].(string)); err != nil {
-		return nil, errors.ErrIdentityProviderOAuthNonceValidationFailed.WithArgs(b.config.IdentityTokenName, err)
+	if nonceRequired {
+		if _, exists := claims["nonce"]; !exists {
+			return nil, errors.ErrIdentityProviderOAuthNonceValidationFailed.WithArgs(b.config.IdentityTokenName, "nonce not found")
+		}
+		if err := b.state.validateNonce(state, claims["nonce"].(string)); err != nil {
+			return nil, errors.ErrIdentityProviderOAuthNonceValidationFailed.WithArgs(b.config.IdentityTokenName, err)
+		}
 	}
 
 	if !b.disableEmailClaimCheck {
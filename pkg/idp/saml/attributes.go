@@ -0,0 +1,191 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saml
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	samllib "github.com/crewjam/saml"
+)
+
+var (
+	// azureAttributes are the attribute mappings of Azure AD.
+	azureAttributes = map[string]string{
+		"Attributes/MaxSessionDuration":                          "session_duration",
+		"Attributes/Role":                                        "roles",
+		"identity/claims/displayname":                            "name",
+		"identity/claims/emailaddress":                           "email",
+		"identity/claims/identityprovider":                       "origin",
+		"identity/claims/name":                                   "sub",
+		"schemas.microsoft.com/identity/claims/objectidentifier": "metadata.oid",
+		"schemas.xmlsoap.org/ws/2005/05/identity/claims/upn":     "metadata.upn",
+	}
+
+	// genericAttributes are the attribute mappings commonly used by Okta,
+	// Keycloak, JumpCloud, and LDAP-backed identity providers.
+	genericAttributes = map[string]string{
+		"email":                             "email",
+		"mail":                              "email",
+		"emailAddress":                      "email",
+		"urn:oid:0.9.2342.19200300.100.1.3": "email",
+		"name":                              "name",
+		"displayName":                       "name",
+		"urn:oid:2.16.840.1.113730.3.1.241": "name",
+		"firstName":                         "given_name",
+		"givenName":                         "given_name",
+		"urn:oid:2.5.4.42":                  "given_name",
+		"lastName":                          "family_name",
+		"sn":                                "family_name",
+		"surname":                           "family_name",
+		"urn:oid:2.5.4.4":                   "family_name",
+		"role":                              "roles",
+		"roles":                             "roles",
+		"Role":                              "roles",
+		"groups":                            "groups",
+		"memberOf":                          "groups",
+		"urn:oid:1.3.6.1.4.1.5923.1.5.1.1":  "groups",
+	}
+)
+
+// attributeMapper maps the attributes of SAML assertions to user claims.
+// The mapping of an attribute is found by its name or friendly name. When
+// none matches, the mapping with the longest path suffix of the attribute
+// name wins, e.g. identity/claims/emailaddress matches
+// http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress.
+type attributeMapper struct {
+	// mappings are ordered by precedence, i.e. the configured mappings
+	// come before the mappings of the driver.
+	mappings []map[string]string
+}
+
+func newAttributeMapper(driver string, attrs map[string]string) *attributeMapper {
+	m := &attributeMapper{}
+	if len(attrs) > 0 {
+		m.mappings = append(m.mappings, attrs)
+	}
+	if driver == "generic" {
+		m.mappings = append(m.mappings, genericAttributes)
+	}
+	m.mappings = append(m.mappings, azureAttributes)
+	return m
+}
+
+// getClaim returns the user claim the attribute maps to.
+func (m *attributeMapper) getClaim(attr samllib.Attribute) string {
+	for _, mappings := range m.mappings {
+		if claim, exists := mappings[attr.Name]; exists {
+			return claim
+		}
+		if attr.FriendlyName == "" {
+			continue
+		}
+		if claim, exists := mappings[attr.FriendlyName]; exists {
+			return claim
+		}
+	}
+	var claim string
+	var suffixLength int
+	for _, mappings := range m.mappings {
+		for k, v := range mappings {
+			if len(k) <= suffixLength || !strings.HasSuffix(attr.Name, "/"+k) {
+				continue
+			}
+			claim = v
+			suffixLength = len(k)
+		}
+	}
+	return claim
+}
+
+// mapAttributes returns the user claims found in the attribute statements.
+// Roles and groups are lists. Other claims are strings, unless the attribute
+// has multiple values. The session duration, in seconds, sets the expiry of
+// the user session.
+func (m *attributeMapper) mapAttributes(statements []samllib.AttributeStatement) map[string]interface{} {
+	claims := make(map[string]interface{})
+	metadata := make(map[string]interface{})
+	for _, statement := range statements {
+		for _, attr := range statement.Attributes {
+			var values []string
+			for _, v := range attr.Values {
+				if v.Value != "" {
+					values = append(values, v.Value)
+				}
+			}
+			if len(values) == 0 {
+				continue
+			}
+
+			claim := m.getClaim(attr)
+			switch claim {
+			case "":
+				continue
+			case "session_duration":
+				seconds, err := strconv.Atoi(values[0])
+				if err != nil {
+					continue
+				}
+				claims["exp"] = time.Now().Add(time.Duration(seconds) * time.Second).Unix()
+				continue
+			}
+
+			dst := claims
+			if strings.HasPrefix(claim, "metadata.") {
+				dst = metadata
+				claim = strings.TrimPrefix(claim, "metadata.")
+			}
+			addClaimValues(dst, claim, values)
+		}
+	}
+
+	if _, exists := claims["name"]; !exists {
+		var arr []string
+		for _, k := range []string{"given_name", "family_name"} {
+			if v, ok := claims[k].(string); ok {
+				arr = append(arr, v)
+			}
+		}
+		if len(arr) > 0 {
+			claims["name"] = strings.Join(arr, " ")
+		}
+	}
+
+	if len(metadata) > 0 {
+		claims["metadata"] = metadata
+	}
+	return claims
+}
+
+func addClaimValues(m map[string]interface{}, claim string, values []string) {
+	switch claim {
+	case "roles", "groups":
+		if v, exists := m[claim].([]string); exists {
+			values = append(v, values...)
+		}
+		m[claim] = values
+		return
+	}
+	if _, exists := m[claim]; exists {
+		// The first attribute mapped to the claim wins.
+		return
+	}
+	if len(values) == 1 {
+		m[claim] = values[0]
+		return
+	}
+	m[claim] = values
+}
@@ -0,0 +1,164 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saml
+
+import (
+	"fmt"
+	"testing"
+
+	samllib "github.com/crewjam/saml"
+	"github.com/greenpau/go-authcrunch/internal/tests"
+)
+
+func newTestAttribute(name, friendlyName string, values ...string) samllib.Attribute {
+	attr := samllib.Attribute{
+		Name:         name,
+		FriendlyName: friendlyName,
+	}
+	for _, v := range values {
+		attr.Values = append(attr.Values, samllib.AttributeValue{Value: v})
+	}
+	return attr
+}
+
+func TestMapAttributes(t *testing.T) {
+	testcases := []struct {
+		name   string
+		driver string
+		attrs  map[string]string
+		input  []samllib.Attribute
+		want   map[string]interface{}
+	}{
+		{
+			name:   "azure attributes",
+			driver: "azure",
+			input: []samllib.Attribute{
+				newTestAttribute("http://schemas.xmlsoap.org/ws/2005/05/identity/claims/name", "", "jsmith@contoso.com"),
+				newTestAttribute("http://schemas.microsoft.com/identity/claims/displayname", "", "John Smith"),
+				newTestAttribute("http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress", "", "jsmith@contoso.com"),
+				newTestAttribute("http://schemas.microsoft.com/identity/claims/identityprovider", "", "https://sts.windows.net/1b9e886b/"),
+				newTestAttribute("http://schemas.microsoft.com/identity/claims/objectidentifier", "", "b5d1ed1d"),
+				newTestAttribute("http://schemas.xmlsoap.org/ws/2005/05/identity/claims/upn", "", "jsmith@contoso.com"),
+				newTestAttribute("https://aws.amazon.com/SAML/Attributes/Role", "", "admin", "user"),
+				newTestAttribute("http://schemas.microsoft.com/identity/claims/tenantid", "", "1b9e886b"),
+			},
+			want: map[string]interface{}{
+				"sub":    "jsmith@contoso.com",
+				"name":   "John Smith",
+				"email":  "jsmith@contoso.com",
+				"origin": "https://sts.windows.net/1b9e886b/",
+				"roles":  []string{"admin", "user"},
+				"metadata": map[string]interface{}{
+					"oid": "b5d1ed1d",
+					"upn": "jsmith@contoso.com",
+				},
+			},
+		},
+		{
+			name:   "okta attributes",
+			driver: "generic",
+			input: []samllib.Attribute{
+				newTestAttribute("email", "", "jsmith@contoso.com"),
+				newTestAttribute("firstName", "", "John"),
+				newTestAttribute("lastName", "", "Smith"),
+				newTestAttribute("groups", "", "Everyone", "Engineering"),
+			},
+			want: map[string]interface{}{
+				"email":       "jsmith@contoso.com",
+				"name":        "John Smith",
+				"given_name":  "John",
+				"family_name": "Smith",
+				"groups":      []string{"Everyone", "Engineering"},
+			},
+		},
+		{
+			name:   "keycloak attributes with oid names",
+			driver: "generic",
+			input: []samllib.Attribute{
+				newTestAttribute("urn:oid:0.9.2342.19200300.100.1.3", "email", "jsmith@contoso.com"),
+				newTestAttribute("urn:oid:2.5.4.42", "givenName", "John"),
+				newTestAttribute("urn:oid:2.5.4.4", "surname", "Smith"),
+				newTestAttribute("Role", "", "offline_access", "uma_authorization"),
+			},
+			want: map[string]interface{}{
+				"email":       "jsmith@contoso.com",
+				"name":        "John Smith",
+				"given_name":  "John",
+				"family_name": "Smith",
+				"roles":       []string{"offline_access", "uma_authorization"},
+			},
+		},
+		{
+			name:   "jumpcloud attributes with custom mappings",
+			driver: "generic",
+			attrs: map[string]string{
+				"memberOf":       "roles",
+				"employeeNumber": "metadata.employee_id",
+				"department":     "department",
+				"mail":           "metadata.mail",
+			},
+			input: []samllib.Attribute{
+				newTestAttribute("email", "", "jsmith@contoso.com"),
+				newTestAttribute("mail", "", "john.smith@contoso.com"),
+				newTestAttribute("displayName", "", "John Smith"),
+				newTestAttribute("memberOf", "", "admins"),
+				newTestAttribute("employeeNumber", "", "1001"),
+				newTestAttribute("department", "", "Engineering", "Research"),
+				newTestAttribute("phone", "", "555-1234"),
+			},
+			want: map[string]interface{}{
+				"email":      "jsmith@contoso.com",
+				"name":       "John Smith",
+				"roles":      []string{"admins"},
+				"department": []string{"Engineering", "Research"},
+				"metadata": map[string]interface{}{
+					"employee_id": "1001",
+					"mail":        "john.smith@contoso.com",
+				},
+			},
+		},
+		{
+			name:   "custom mapping by path suffix",
+			driver: "generic",
+			attrs: map[string]string{
+				"claims/nickname": "nickname",
+			},
+			input: []samllib.Attribute{
+				newTestAttribute("http://schemas.contoso.com/claims/nickname", "", "johnny"),
+				newTestAttribute("http://schemas.contoso.com/claims/emailaddress", "", "jsmith@contoso.com"),
+			},
+			want: map[string]interface{}{
+				"nickname": "johnny",
+			},
+		},
+		{
+			name:   "generic mappings are not applied to azure",
+			driver: "azure",
+			input: []samllib.Attribute{
+				newTestAttribute("email", "", "jsmith@contoso.com"),
+				newTestAttribute("https://aws.amazon.com/SAML/Attributes/MaxSessionDuration", "", "foo"),
+			},
+			want: map[string]interface{}{},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			m := newAttributeMapper(tc.driver, tc.attrs)
+			got := m.mapAttributes([]samllib.AttributeStatement{{Attributes: tc.input}})
+			tests.EvalObjectsWithLog(t, "claims", tc.want, got, msgs)
+		})
+	}
+}
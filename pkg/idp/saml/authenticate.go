@@ -18,17 +18,19 @@ import (
 	"encoding/base64"
 	"fmt"
 	"github.com/greenpau/go-authcrunch/pkg/requests"
-	"strconv"
 	"strings"
-	"time"
 
-	"go.uber.org/zap"
+	samllib "github.com/crewjam/saml"
+	"github.com/greenpau/go-authcrunch/pkg/errors"
 )
 
 // Authenticate performs authentication.
 func (b *IdentityProvider) Authenticate(r *requests.Request) error {
 	r.Response.Code = 400
 	if r.Upstream.Request.Method != "POST" {
+		if b.loginURL == "" {
+			return b.requestAuthentication(r)
+		}
 		r.Response.Code = 302
 		r.Response.RedirectURL = b.loginURL
 		return nil
@@ -85,73 +87,65 @@ func (b *IdentityProvider) Authenticate(r *requests.Request) error {
 		return fmt.Errorf("failed to ParseXMLResponse: %s", err)
 	}
 
-	m := make(map[string]interface{})
-	metadata := make(map[string]interface{})
-	for _, attrStatement := range samlAssertions.AttributeStatements {
-
-		for _, attrEntry := range attrStatement.Attributes {
-			if len(attrEntry.Values) == 0 {
-				continue
-			}
-			switch {
-			case strings.HasSuffix(attrEntry.Name, "Attributes/MaxSessionDuration"):
-				multiplier, err := strconv.Atoi(attrEntry.Values[0].Value)
-				if err != nil {
-					b.logger.Error(
-						"Failed parsing Attributes/MaxSessionDuration",
-						zap.String("request_id", r.ID),
-						zap.String("error", err.Error()),
-					)
-					continue
-				}
-				m["exp"] = time.Now().Add(time.Duration(multiplier) * time.Second).Unix()
-			case strings.HasSuffix(attrEntry.Name, "identity/claims/displayname"):
-				if attrEntry.Values[0].Value != "" {
-					m["name"] = attrEntry.Values[0].Value
-				}
-			case strings.HasSuffix(attrEntry.Name, "identity/claims/emailaddress"):
-				if attrEntry.Values[0].Value != "" {
-					m["email"] = attrEntry.Values[0].Value
-				}
-			case strings.HasSuffix(attrEntry.Name, "identity/claims/identityprovider"):
-				if attrEntry.Values[0].Value != "" {
-					m["origin"] = attrEntry.Values[0].Value
-				}
-			case strings.HasSuffix(attrEntry.Name, "schemas.microsoft.com/identity/claims/objectidentifier"):
-				if attrEntry.Values[0].Value != "" {
-					metadata["oid"] = attrEntry.Values[0].Value
-				}
-			case strings.HasSuffix(attrEntry.Name, "schemas.xmlsoap.org/ws/2005/05/identity/claims/upn"):
-				if attrEntry.Values[0].Value != "" {
-					metadata["upn"] = attrEntry.Values[0].Value
-				}
-			case strings.HasSuffix(attrEntry.Name, "identity/claims/name"):
-				if attrEntry.Values[0].Value != "" {
-					m["sub"] = attrEntry.Values[0].Value
-				}
-			case strings.HasSuffix(attrEntry.Name, "Attributes/Role"):
-				roles := []string{}
-				for _, attrEntryElement := range attrEntry.Values {
-					roles = append(roles, attrEntryElement.Value)
-				}
-				if len(roles) > 0 {
-					m["roles"] = roles
-				}
-			}
+	if samlAssertions.Subject == nil {
+		return fmt.Errorf("SAML assertion has no subject")
+	}
+	for _, sc := range samlAssertions.Subject.SubjectConfirmations {
+		if sc.SubjectConfirmationData == nil || sc.SubjectConfirmationData.InResponseTo == "" {
+			continue
 		}
+		// The response to the authentication request sent by the portal.
+		if err := b.pending.consume(sc.SubjectConfirmationData.InResponseTo); err != nil {
+			return err
+		}
+		break
 	}
 
+	m := b.mapper.mapAttributes(samlAssertions.AttributeStatements)
+
 	for _, k := range []string{"email", "name"} {
 		if _, exists := m[k]; !exists {
 			return fmt.Errorf("SAML authorization failed, mandatory %s attribute not found: %v", k, m)
 		}
 	}
 
-	if len(metadata) > 0 {
-		m["metadata"] = metadata
+	if nameID := samlAssertions.Subject.NameID; nameID != nil {
+		r.Session.NameID = nameID.Value
+		r.Session.NameIDFormat = nameID.Format
+	}
+	for _, stmt := range samlAssertions.AuthnStatements {
+		if stmt.SessionIndex != "" {
+			r.Session.SessionIndex = stmt.SessionIndex
+			break
+		}
 	}
 
 	r.Response.Code = 200
 	r.Response.Payload = m
 	return nil
 }
+
+// requestAuthentication redirects the user to the single sign-on service of
+// the Identity Provider with the authentication request. The request is
+// signed when the service provider has signing key.
+func (b *IdentityProvider) requestAuthentication(r *requests.Request) error {
+	sp := b.getServiceProvider(r.Upstream.Request)
+	req, err := sp.MakeAuthenticationRequest(
+		sp.GetSSOBindingLocation(samllib.HTTPRedirectBinding),
+		samllib.HTTPRedirectBinding,
+		samllib.HTTPPostBinding,
+	)
+	if err != nil {
+		return errors.ErrIdentityProviderSamlAuthnRequestFailed.WithArgs(err)
+	}
+	redirectURL, err := encodeRedirectURL(req.Destination, "SAMLRequest", req.Element(), "", b.signer)
+	if err != nil {
+		return errors.ErrIdentityProviderSamlAuthnRequestFailed.WithArgs(err)
+	}
+	if err := b.pending.add(req.ID); err != nil {
+		return errors.ErrIdentityProviderSamlAuthnRequestFailed.WithArgs(err)
+	}
+	r.Response.Code = 302
+	r.Response.RedirectURL = redirectURL
+	return nil
+}
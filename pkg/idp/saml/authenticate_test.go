@@ -0,0 +1,232 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saml
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/greenpau/go-authcrunch/internal/tests"
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/requests"
+	"github.com/greenpau/go-authcrunch/pkg/sso"
+	logutil "github.com/greenpau/go-authcrunch/pkg/util/log"
+)
+
+var samlResponseRegex = regexp.MustCompile(`name="SAMLResponse" value="([^"]+)"`)
+
+func newTestIdentityProvider(t *testing.T) *IdentityProvider {
+	cfg := &Config{
+		Name:                "authp",
+		Realm:               "authp",
+		Driver:              "generic",
+		IdpMetadataLocation: "../../../testdata/saml/authp/idp_metadata.xml",
+		IdpSignCertLocation: "../../../testdata/saml/authp/idp.crt",
+		EntityID:            "urn:authp",
+		AssertionConsumerServiceURLs: []string{
+			"https://localhost/saml/authp",
+		},
+		SpKeyLocation:  "../../../testdata/saml/authp/sp.key",
+		SpCertLocation: "../../../testdata/saml/authp/sp.crt",
+		LogoutEnabled:  true,
+	}
+	prv, err := NewIdentityProvider(cfg, logutil.NewLogger())
+	if err != nil {
+		t.Fatalf("failed to create identity provider: %v", err)
+	}
+	if err := prv.Configure(); err != nil {
+		t.Fatalf("failed to configure identity provider: %v", err)
+	}
+	return prv
+}
+
+func newTestSingleSignOnProvider(t *testing.T) sso.SingleSignOnProvider {
+	cfg := &sso.SingleSignOnProviderConfig{
+		Name:           "contoso",
+		Driver:         "generic",
+		EntityID:       "https://idp.contoso.com/saml/metadata",
+		Locations:      []string{"https://idp.contoso.com/saml/sso"},
+		PrivateKeyPath: "../../../testdata/saml/authp/idp.key",
+		CertPath:       "../../../testdata/saml/authp/idp.crt",
+		ServiceProviders: []*sso.ServiceProviderConfig{
+			{
+				Name:         "authp",
+				EntityID:     "urn:authp",
+				AcsURL:       "https://localhost/saml/authp",
+				CertPath:     "../../../testdata/saml/authp/sp.crt",
+				NameIDFormat: "email",
+				Attributes: map[string]string{
+					"email":     "email",
+					"firstName": "given_name",
+					"lastName":  "family_name",
+					"groups":    "roles",
+				},
+				RequireSignedRequests: true,
+			},
+		},
+	}
+	prv, err := sso.NewSingleSignOnProvider(cfg, logutil.NewLogger())
+	if err != nil {
+		t.Fatalf("failed to create sso provider: %v", err)
+	}
+	if err := prv.Configure(); err != nil {
+		t.Fatalf("failed to configure sso provider: %v", err)
+	}
+	return prv
+}
+
+// signOn sends the user to the Identity Provider and returns the SAML
+// response form posted back to the ACS URL, along with the request id.
+func signOn(t *testing.T, prv *IdentityProvider, idp sso.SingleSignOnProvider, data map[string]interface{}) (string, string) {
+	r := requests.NewRequest()
+	r.Upstream.Request = httptest.NewRequest(http.MethodGet, "https://localhost/saml/authp", nil)
+	if err := prv.Authenticate(r); err != nil {
+		t.Fatalf("failed to request authentication: %v", err)
+	}
+	if r.Response.Code != 302 || !strings.HasPrefix(r.Response.RedirectURL, "https://idp.contoso.com/saml/sso?SAMLRequest=") {
+		t.Fatalf("unexpected authentication redirect: %d %s", r.Response.Code, r.Response.RedirectURL)
+	}
+
+	// The sso provider rejects unsigned requests.
+	req, err := idp.ParseAuthnRequest(httptest.NewRequest(http.MethodGet, r.Response.RedirectURL, nil))
+	if err != nil {
+		t.Fatalf("failed to parse authentication request: %v", err)
+	}
+	page, err := idp.SignOn(req, data)
+	if err != nil {
+		t.Fatalf("failed to sign on: %v", err)
+	}
+	m := samlResponseRegex.FindSubmatch(page)
+	if m == nil {
+		t.Fatalf("SAMLResponse not found: %s", page)
+	}
+	form := url.Values{}
+	form.Set("SAMLResponse", html.UnescapeString(string(m[1])))
+	return form.Encode(), req.ID
+}
+
+func newTestAcsRequest(body string) *requests.Request {
+	r := requests.NewRequest()
+	r.Upstream.Request = httptest.NewRequest(http.MethodPost, "https://localhost/saml/authp", strings.NewReader(body))
+	r.Upstream.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+func TestAuthenticate(t *testing.T) {
+	testcases := []struct {
+		name string
+		data map[string]interface{}
+		// replay posts the response to the ACS URL twice.
+		replay bool
+		// unsolicited posts the response to another instance of the provider.
+		unsolicited bool
+		want        map[string]interface{}
+		shouldErr   bool
+		err         error
+	}{
+		{
+			name: "sign in with signed authentication request",
+			data: map[string]interface{}{
+				"email":       "jsmith@contoso.com",
+				"given_name":  "John",
+				"family_name": "Smith",
+				"roles":       []string{"admin", "user"},
+			},
+			want: map[string]interface{}{
+				"code": 200,
+				"payload": map[string]interface{}{
+					"email":       "jsmith@contoso.com",
+					"name":        "John Smith",
+					"given_name":  "John",
+					"family_name": "Smith",
+					"groups":      []string{"admin", "user"},
+				},
+				"name_id":        "jsmith@contoso.com",
+				"name_id_format": "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress",
+				"session_index":  true,
+			},
+		},
+		{
+			name: "sign in with replayed response",
+			data: map[string]interface{}{
+				"email":       "jsmith@contoso.com",
+				"given_name":  "John",
+				"family_name": "Smith",
+			},
+			replay:    true,
+			shouldErr: true,
+			err:       errors.ErrIdentityProviderSamlRequestIDNotFound,
+		},
+		{
+			name: "sign in with response to unknown request",
+			data: map[string]interface{}{
+				"email":       "jsmith@contoso.com",
+				"given_name":  "John",
+				"family_name": "Smith",
+			},
+			unsolicited: true,
+			shouldErr:   true,
+			err:         errors.ErrIdentityProviderSamlRequestIDNotFound,
+		},
+		{
+			name: "sign in without name",
+			data: map[string]interface{}{
+				"email": "jsmith@contoso.com",
+			},
+			shouldErr: true,
+			err:       fmt.Errorf("SAML authorization failed, mandatory name attribute not found: map[email:jsmith@contoso.com]"),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			prv := newTestIdentityProvider(t)
+			idp := newTestSingleSignOnProvider(t)
+			body, reqID := signOn(t, prv, idp, tc.data)
+
+			if tc.unsolicited {
+				prv = newTestIdentityProvider(t)
+			}
+			if tc.replay {
+				if err := prv.Authenticate(newTestAcsRequest(body)); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			if tc.err == errors.ErrIdentityProviderSamlRequestIDNotFound {
+				tc.err = errors.ErrIdentityProviderSamlRequestIDNotFound.WithArgs(reqID)
+			}
+
+			r := newTestAcsRequest(body)
+			err := prv.Authenticate(r)
+			if tests.EvalErrWithLog(t, err, "authenticate", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			got := map[string]interface{}{
+				"code":           r.Response.Code,
+				"payload":        r.Response.Payload,
+				"name_id":        r.Session.NameID,
+				"name_id_format": r.Session.NameIDFormat,
+				"session_index":  r.Session.SessionIndex != "",
+			}
+			tests.EvalObjectsWithLog(t, "response", tc.want, got, msgs)
+		})
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/beevik/etree"
+	samllib "github.com/crewjam/saml"
+	"github.com/greenpau/go-authcrunch/internal/samlbinding"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// encodeRedirectURL returns the URL sending the message to the destination
+// via HTTP-Redirect binding. The query is signed when the signer is not nil.
+func encodeRedirectURL(destination, param string, el *etree.Element, relayState string, signer crypto.Signer) (string, error) {
+	doc := etree.NewDocument()
+	doc.SetRoot(el)
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := doc.WriteTo(w); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	// The query is built by hand, because the signature covers the
+	// parameters in the order defined by the binding.
+	query := param + "=" + url.QueryEscape(base64.StdEncoding.EncodeToString(buf.Bytes()))
+	if relayState != "" {
+		query += "&RelayState=" + url.QueryEscape(relayState)
+	}
+	if signer != nil {
+		sigAlg, sig, err := signRedirectQuery(signer, query)
+		if err != nil {
+			return "", err
+		}
+		query += "&SigAlg=" + url.QueryEscape(sigAlg)
+		query += "&Signature=" + url.QueryEscape(base64.StdEncoding.EncodeToString(sig))
+	}
+
+	if strings.Contains(destination, "?") {
+		return destination + "&" + query, nil
+	}
+	return destination + "?" + query, nil
+}
+
+func signRedirectQuery(signer crypto.Signer, query string) (string, []byte, error) {
+	switch pub := signer.Public().(type) {
+	case *rsa.PublicKey:
+		query += "&SigAlg=" + url.QueryEscape(dsig.RSASHA256SignatureMethod)
+		digest := sha256.Sum256([]byte(query))
+		sig, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+		if err != nil {
+			return "", nil, err
+		}
+		return dsig.RSASHA256SignatureMethod, sig, nil
+	case *ecdsa.PublicKey:
+		priv, ok := signer.(*ecdsa.PrivateKey)
+		if !ok {
+			return "", nil, fmt.Errorf("unsupported ecdsa signer %T", signer)
+		}
+		query += "&SigAlg=" + url.QueryEscape(dsig.ECDSASHA256SignatureMethod)
+		digest := sha256.Sum256([]byte(query))
+		r, s, err := ecdsa.Sign(rand.Reader, priv, digest[:])
+		if err != nil {
+			return "", nil, err
+		}
+		// The signature is the concatenation of r and s.
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		sig := make([]byte, 2*size)
+		r.FillBytes(sig[:size])
+		s.FillBytes(sig[size:])
+		return dsig.ECDSASHA256SignatureMethod, sig, nil
+	}
+	return "", nil, fmt.Errorf("unsupported signing key %T", signer.Public())
+}
+
+// decodeMessage returns the signed SAML message received via HTTP-Redirect
+// or HTTP-POST binding, and the relay state. The message must be signed by
+// one of the certificates.
+func decodeMessage(r *http.Request, param string, certs []*x509.Certificate) (*etree.Element, string, error) {
+	msg, err := samlbinding.Decode(r, param)
+	if err != nil {
+		return nil, "", err
+	}
+	el, err := msg.Verify(certs, samllib.TimeNow())
+	if err != nil {
+		return nil, "", err
+	}
+	return el, msg.RelayState, nil
+}
+
+// getSigningCerts returns the signing certificates of the Identity Provider
+// found in its metadata. The malformed certificates are skipped.
+func getSigningCerts(md *samllib.EntityDescriptor) []*x509.Certificate {
+	var certs []*x509.Certificate
+	for _, descriptor := range md.IDPSSODescriptors {
+		for _, kd := range descriptor.KeyDescriptors {
+			if kd.Use != "" && kd.Use != "signing" {
+				continue
+			}
+			for _, xc := range kd.KeyInfo.X509Data.X509Certificates {
+				data := strings.Join(strings.Fields(xc.Data), "")
+				if data == "" {
+					continue
+				}
+				b, err := base64.StdEncoding.DecodeString(data)
+				if err != nil {
+					continue
+				}
+				cert, err := x509.ParseCertificate(b)
+				if err != nil {
+					continue
+				}
+				certs = append(certs, cert)
+			}
+		}
+	}
+	return certs
+}
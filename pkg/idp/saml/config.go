@@ -33,6 +33,9 @@ type Config struct {
 	// IdpSignCertLocation is the path to the Identity Provider signing certificate.
 	IdpSignCertLocation string `json:"idp_sign_cert_location,omitempty" xml:"idp_sign_cert_location,omitempty" yaml:"idp_sign_cert_location,omitempty"`
 	// IdpLoginURL is the SAML authentication endpoint with the Identity Provider.
+	// When the generic driver has no login URL, the login starts with the
+	// authentication request sent to the single sign-on service of the
+	// Identity Provider.
 	IdpLoginURL string `json:"idp_login_url,omitempty" xml:"idp_login_url,omitempty" yaml:"idp_login_url,omitempty"`
 	// TenantID is the tenant ID associated with the IdentityProvider.
 	TenantID string `json:"tenant_id,omitempty" xml:"tenant_id,omitempty" yaml:"tenant_id,omitempty"`
@@ -51,6 +54,23 @@ type Config struct {
 	// by name, i.e. app. Each of the URLs is a separate endpoint.
 	AssertionConsumerServiceURLs []string `json:"acs_urls,omitempty" xml:"acs_urls,omitempty" yaml:"acs_urls,omitempty"`
 
+	// SpKeyLocation is the path to the private key signing the authentication
+	// and logout requests of the service provider.
+	SpKeyLocation string `json:"sp_key_location,omitempty" xml:"sp_key_location,omitempty" yaml:"sp_key_location,omitempty"`
+	// SpCertLocation is the path to the certificate of the service provider
+	// signing key.
+	SpCertLocation string `json:"sp_cert_location,omitempty" xml:"sp_cert_location,omitempty" yaml:"sp_cert_location,omitempty"`
+
+	// Attributes maps assertion attribute names to user claims, e.g. email,
+	// name, roles, groups, or custom claims. The claims prefixed with
+	// "metadata." are added to user metadata. The mappings extend the default
+	// mappings of the driver.
+	Attributes map[string]string `json:"attributes,omitempty" xml:"attributes,omitempty" yaml:"attributes,omitempty"`
+
+	// LogoutEnabled enables single logout with the Identity Provider when
+	// the user logs out of the portal.
+	LogoutEnabled bool `json:"logout_enabled,omitempty" xml:"logout_enabled,omitempty" yaml:"logout_enabled,omitempty"`
+
 	TLSInsecureSkipVerify bool `json:"tls_insecure_skip_verify,omitempty" xml:"tls_insecure_skip_verify,omitempty" yaml:"tls_insecure_skip_verify,omitempty"`
 
 	// LoginIcon is the UI login icon attributes.
@@ -96,7 +116,9 @@ func (cfg *Config) Validate() error {
 		)
 	}
 
-	if cfg.IdpLoginURL == "" {
+	// The generic driver without login URL finds the single sign-on service
+	// in the IdP metadata.
+	if cfg.IdpLoginURL == "" && (cfg.Driver != "generic" || cfg.IdpMetadataLocation == "") {
 		return errors.ErrIdentityProviderConfig.WithArgs("IdP Loging URL not found")
 	}
 
@@ -108,6 +130,18 @@ func (cfg *Config) Validate() error {
 		return errors.ErrIdentityProviderConfig.WithArgs("IdP Signing Certificate not found")
 	}
 
+	if (cfg.SpKeyLocation == "") != (cfg.SpCertLocation == "") {
+		return errors.ErrIdentityProviderConfig.WithArgs("SP signing key and certificate must be configured together")
+	}
+
+	for name, claim := range cfg.Attributes {
+		if name == "" || claim == "" || claim == "metadata." {
+			return errors.ErrIdentityProviderConfig.WithArgs(
+				fmt.Errorf("attribute mapping %q to %q is invalid", name, claim),
+			)
+		}
+	}
+
 	// Configure UI login icon.
 	if cfg.LoginIcon == nil {
 		cfg.LoginIcon = icons.NewLoginIcon(cfg.Driver)
@@ -198,6 +198,42 @@ func TestValidateConfig(t *testing.T) {
 			shouldErr: true,
 			err:       errors.ErrIdentityProviderConfig.WithArgs("IdP Signing Certificate not found"),
 		},
+		{
+			name: "test config SP signing certificate not found",
+			config: &Config{
+				Name:                "authp",
+				Realm:               "authp",
+				Driver:              "generic",
+				IdpMetadataLocation: "../../../testdata/saml/authp/idp_metadata.xml",
+				IdpSignCertLocation: "../../../testdata/saml/authp/idp.crt",
+				AssertionConsumerServiceURLs: []string{
+					"https://localhost/saml/authp",
+				},
+				SpKeyLocation: "../../../testdata/saml/authp/sp.key",
+			},
+			shouldErr: true,
+			err:       errors.ErrIdentityProviderConfig.WithArgs("SP signing key and certificate must be configured together"),
+		},
+		{
+			name: "test config invalid attribute mapping",
+			config: &Config{
+				Name:                "authp",
+				Realm:               "authp",
+				Driver:              "generic",
+				IdpMetadataLocation: "../../../testdata/saml/authp/idp_metadata.xml",
+				IdpSignCertLocation: "../../../testdata/saml/authp/idp.crt",
+				AssertionConsumerServiceURLs: []string{
+					"https://localhost/saml/authp",
+				},
+				Attributes: map[string]string{
+					"employeeNumber": "metadata.",
+				},
+			},
+			shouldErr: true,
+			err: errors.ErrIdentityProviderConfig.WithArgs(
+				fmt.Errorf("attribute mapping %q to %q is invalid", "employeeNumber", "metadata."),
+			),
+		},
 	}
 	for _, tc := range testcases {
 		t.Run(tc.name, func(t *testing.T) {
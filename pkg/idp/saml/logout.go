@@ -0,0 +1,245 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saml
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/beevik/etree"
+	samllib "github.com/crewjam/saml"
+	"github.com/greenpau/go-authcrunch/internal/samlbinding"
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/requests"
+	"github.com/greenpau/go-authcrunch/pkg/util"
+)
+
+// Logout performs single logout with the Identity Provider. The logout
+// requests of the Identity Provider and the responses to the logout
+// requests of the portal arrive at the SLO URL of the service provider,
+// i.e. the ACS URL with /logout suffix. Otherwise, the portal starts the
+// logout of the user session provided in the request.
+func (b *IdentityProvider) Logout(r *requests.Request) error {
+	req := r.Upstream.Request
+	if req != nil {
+		if req.Method == http.MethodPost {
+			req.Body = http.MaxBytesReader(nil, req.Body, 2*samlbinding.MaxMessageSize)
+		}
+		switch {
+		case req.FormValue("SAMLRequest") != "":
+			return b.handleLogoutRequest(r)
+		case req.FormValue("SAMLResponse") != "":
+			return b.handleLogoutResponse(r)
+		}
+	}
+	return b.requestLogout(r)
+}
+
+// requestLogout redirects the user to the single logout service of the
+// Identity Provider with the logout request for the user session. The
+// response code is 200 when the logout with the Identity Provider is
+// disabled or unsupported.
+func (b *IdentityProvider) requestLogout(r *requests.Request) error {
+	r.Response.Code = 200
+	if !b.config.LogoutEnabled || r.Session.NameID == "" {
+		return nil
+	}
+	sp := b.getServiceProvider(r.Upstream.Request)
+	destination := sp.GetSLOBindingLocation(samllib.HTTPRedirectBinding)
+	if destination == "" {
+		return nil
+	}
+
+	req := &samllib.LogoutRequest{
+		ID:           "id-" + util.GetRandomString(40),
+		Version:      "2.0",
+		IssueInstant: samllib.TimeNow().UTC(),
+		Destination:  destination,
+		Issuer:       getIssuer(sp),
+		NameID: &samllib.NameID{
+			Format: r.Session.NameIDFormat,
+			Value:  r.Session.NameID,
+		},
+	}
+	if r.Session.SessionIndex != "" {
+		req.SessionIndex = &samllib.SessionIndex{Value: r.Session.SessionIndex}
+	}
+	redirectURL, err := encodeRedirectURL(destination, "SAMLRequest", req.Element(), "", b.signer)
+	if err != nil {
+		return errors.ErrIdentityProviderSamlLogoutRequestFailed.WithArgs(err)
+	}
+	if err := b.pending.add(req.ID); err != nil {
+		return errors.ErrIdentityProviderSamlLogoutRequestFailed.WithArgs(err)
+	}
+	r.Response.Code = 302
+	r.Response.RedirectURL = redirectURL
+	return nil
+}
+
+// handleLogoutRequest validates the logout request of the Identity Provider
+// and redirects the user back with the logout response. The session to
+// terminate is returned in the request.
+func (b *IdentityProvider) handleLogoutRequest(r *requests.Request) error {
+	sp := b.getServiceProviderBySloURL(r.Upstream.Request)
+	el, relayState, err := decodeMessage(r.Upstream.Request, "SAMLRequest", b.idpCerts)
+	if err != nil {
+		return errors.ErrIdentityProviderSamlLogoutInvalid.WithArgs("request", err)
+	}
+	req := &samllib.LogoutRequest{}
+	if err := unmarshalElement(el, req); err != nil {
+		return errors.ErrIdentityProviderSamlLogoutInvalid.WithArgs("request", err)
+	}
+	if err := validateMessage(sp, req.Issuer, req.Destination, req.IssueInstant); err != nil {
+		return errors.ErrIdentityProviderSamlLogoutInvalid.WithArgs("request", err)
+	}
+	if req.NotOnOrAfter != nil && samllib.TimeNow().After(*req.NotOnOrAfter) {
+		return errors.ErrIdentityProviderSamlLogoutInvalid.WithArgs("request", "expired request")
+	}
+	if req.NameID == nil || req.NameID.Value == "" {
+		return errors.ErrIdentityProviderSamlLogoutInvalid.WithArgs("request", "empty name id")
+	}
+	if err := b.pending.addReceived(req.ID); err != nil {
+		return errors.ErrIdentityProviderSamlLogoutInvalid.WithArgs("request", err)
+	}
+
+	destination := getSingleLogoutResponseLocation(sp)
+	if destination == "" {
+		return errors.ErrIdentityProviderSamlLogoutInvalid.WithArgs("request", "IdP metadata has no single logout service")
+	}
+	resp := &samllib.LogoutResponse{
+		ID:           "id-" + util.GetRandomString(40),
+		InResponseTo: req.ID,
+		Version:      "2.0",
+		IssueInstant: samllib.TimeNow().UTC(),
+		Destination:  destination,
+		Issuer:       getIssuer(sp),
+		Status: samllib.Status{
+			StatusCode: samllib.StatusCode{Value: samllib.StatusSuccess},
+		},
+	}
+	redirectURL, err := encodeRedirectURL(destination, "SAMLResponse", resp.Element(), relayState, b.signer)
+	if err != nil {
+		return errors.ErrIdentityProviderSamlLogoutInvalid.WithArgs("request", err)
+	}
+
+	r.Session.NameID = req.NameID.Value
+	r.Session.NameIDFormat = req.NameID.Format
+	if req.SessionIndex != nil {
+		r.Session.SessionIndex = req.SessionIndex.Value
+	}
+	r.Response.Code = 302
+	r.Response.RedirectURL = redirectURL
+	return nil
+}
+
+// handleLogoutResponse validates the response of the Identity Provider to
+// the logout request of the portal.
+func (b *IdentityProvider) handleLogoutResponse(r *requests.Request) error {
+	sp := b.getServiceProviderBySloURL(r.Upstream.Request)
+	el, _, err := decodeMessage(r.Upstream.Request, "SAMLResponse", b.idpCerts)
+	if err != nil {
+		return errors.ErrIdentityProviderSamlLogoutInvalid.WithArgs("response", err)
+	}
+	resp := &samllib.LogoutResponse{}
+	if err := unmarshalElement(el, resp); err != nil {
+		return errors.ErrIdentityProviderSamlLogoutInvalid.WithArgs("response", err)
+	}
+	if err := validateMessage(sp, resp.Issuer, resp.Destination, resp.IssueInstant); err != nil {
+		return errors.ErrIdentityProviderSamlLogoutInvalid.WithArgs("response", err)
+	}
+	if err := b.pending.consume(resp.InResponseTo); err != nil {
+		return errors.ErrIdentityProviderSamlLogoutInvalid.WithArgs("response", err)
+	}
+	if resp.Status.StatusCode.Value != samllib.StatusSuccess {
+		return errors.ErrIdentityProviderSamlLogoutInvalid.WithArgs("response",
+			fmt.Sprintf("unexpected status %q", resp.Status.StatusCode.Value))
+	}
+	r.Response.Code = 200
+	return nil
+}
+
+// getServiceProviderBySloURL returns the service provider with the SLO URL
+// of the request.
+func (b *IdentityProvider) getServiceProviderBySloURL(r *http.Request) *samllib.ServiceProvider {
+	for _, acsURL := range b.config.AssertionConsumerServiceURLs {
+		if sp := b.serviceProviders[acsURL]; sp.SloURL.Path == r.URL.Path {
+			return sp
+		}
+	}
+	return b.getServiceProvider(r)
+}
+
+// validateMessage validates the issuer, destination, and issue instant of
+// the message of the Identity Provider.
+func validateMessage(sp *samllib.ServiceProvider, issuer *samllib.Issuer, destination string, issuedAt time.Time) error {
+	if issuer == nil || issuer.Value != sp.IDPMetadata.EntityID {
+		return fmt.Errorf("issuer does not match IdP metadata entity id %q", sp.IDPMetadata.EntityID)
+	}
+	if destination == "" {
+		return fmt.Errorf("empty destination")
+	}
+	if destination != sp.SloURL.String() {
+		return fmt.Errorf("unexpected destination %q", destination)
+	}
+	now := samllib.TimeNow()
+	if issuedAt.Add(samllib.MaxIssueDelay).Before(now) {
+		return fmt.Errorf("expired message")
+	}
+	if issuedAt.After(now.Add(samllib.MaxClockSkew)) {
+		return fmt.Errorf("message issued in the future")
+	}
+	return nil
+}
+
+// getSingleLogoutResponseLocation returns the location receiving logout
+// responses via HTTP-Redirect binding.
+func getSingleLogoutResponseLocation(sp *samllib.ServiceProvider) string {
+	for _, descriptor := range sp.IDPMetadata.IDPSSODescriptors {
+		for _, svc := range descriptor.SingleLogoutServices {
+			if svc.Binding != samllib.HTTPRedirectBinding {
+				continue
+			}
+			if svc.ResponseLocation != "" {
+				return svc.ResponseLocation
+			}
+			return svc.Location
+		}
+	}
+	return ""
+}
+
+// getIssuer returns the issuer of the messages of the service provider.
+func getIssuer(sp *samllib.ServiceProvider) *samllib.Issuer {
+	issuer := &samllib.Issuer{
+		Format: "urn:oasis:names:tc:SAML:2.0:nameid-format:entity",
+		Value:  sp.EntityID,
+	}
+	if issuer.Value == "" {
+		issuer.Value = sp.MetadataURL.String()
+	}
+	return issuer
+}
+
+func unmarshalElement(el *etree.Element, v interface{}) error {
+	doc := etree.NewDocument()
+	doc.SetRoot(el.Copy())
+	b, err := doc.WriteToBytes()
+	if err != nil {
+		return err
+	}
+	return xml.Unmarshal(b, v)
+}
@@ -0,0 +1,326 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saml
+
+import (
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/beevik/etree"
+	samllib "github.com/crewjam/saml"
+	"github.com/greenpau/go-authcrunch/internal/tests"
+	"github.com/greenpau/go-authcrunch/pkg/authn/enums/operator"
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/requests"
+)
+
+const (
+	testIdpEntityID = "https://idp.contoso.com/saml/metadata"
+	testSloURL      = "https://localhost/saml/authp/logout"
+)
+
+func loadTestSigningKeyPair(t *testing.T, name string) (crypto.Signer, *x509.Certificate) {
+	signer, cert, err := loadSigningKeyPair(
+		"../../../testdata/saml/authp/"+name+".key",
+		"../../../testdata/saml/authp/"+name+".crt",
+	)
+	if err != nil {
+		t.Fatalf("failed to load %s key pair: %v", name, err)
+	}
+	return signer, cert
+}
+
+func TestRequestLogout(t *testing.T) {
+	testcases := []struct {
+		name    string
+		session requests.IdentityProviderSession
+		want    map[string]interface{}
+	}{
+		{
+			name: "logout user session",
+			session: requests.IdentityProviderSession{
+				NameID:       "jsmith@contoso.com",
+				NameIDFormat: "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress",
+				SessionIndex: "id-foobar",
+			},
+			want: map[string]interface{}{
+				"code":          302,
+				"redirect":      true,
+				"name_id":       "jsmith@contoso.com",
+				"session_index": "id-foobar",
+				"destination":   "https://idp.contoso.com/saml/slo",
+				"issuer":        "urn:authp",
+			},
+		},
+		{
+			name: "logout session without name id",
+			want: map[string]interface{}{
+				"code":     200,
+				"redirect": false,
+			},
+		},
+	}
+	_, spCert := loadTestSigningKeyPair(t, "sp")
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			prv := newTestIdentityProvider(t)
+			r := requests.NewRequest()
+			r.Session = tc.session
+			if err := prv.Request(operator.Logout, r); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got := map[string]interface{}{
+				"code":     r.Response.Code,
+				"redirect": r.Response.RedirectURL != "",
+			}
+			if r.Response.RedirectURL != "" {
+				// The request must be signed by the service provider.
+				el, _, err := decodeMessage(httptest.NewRequest(http.MethodGet, r.Response.RedirectURL, nil), "SAMLRequest", []*x509.Certificate{spCert})
+				if err != nil {
+					t.Fatalf("failed to decode logout request: %v", err)
+				}
+				req := &samllib.LogoutRequest{}
+				if err := unmarshalElement(el, req); err != nil {
+					t.Fatalf("failed to unmarshal logout request: %v", err)
+				}
+				got["name_id"] = req.NameID.Value
+				got["session_index"] = req.SessionIndex.Value
+				got["destination"] = req.Destination
+				got["issuer"] = req.Issuer.Value
+			}
+			tests.EvalObjectsWithLog(t, "response", tc.want, got, msgs)
+		})
+	}
+}
+
+func TestHandleLogout(t *testing.T) {
+	idpSigner, _ := loadTestSigningKeyPair(t, "idp")
+	spSigner, spCert := loadTestSigningKeyPair(t, "sp")
+
+	testcases := []struct {
+		name   string
+		param  string
+		issuer string
+		signer crypto.Signer
+		// initiate starts the logout with the Identity Provider first.
+		initiate bool
+		// replay sends the message twice.
+		replay bool
+		// noDestination sends the message without destination.
+		noDestination bool
+		want          map[string]interface{}
+		shouldErr     bool
+		err           error
+	}{
+		{
+			name:   "logout request of identity provider",
+			param:  "SAMLRequest",
+			issuer: testIdpEntityID,
+			signer: idpSigner,
+			want: map[string]interface{}{
+				"code":          302,
+				"redirect":      true,
+				"name_id":       "jsmith@contoso.com",
+				"session_index": "id-foobar",
+			},
+		},
+		{
+			name:      "unsigned logout request",
+			param:     "SAMLRequest",
+			issuer:    testIdpEntityID,
+			shouldErr: true,
+			err:       errors.ErrIdentityProviderSamlLogoutInvalid.WithArgs("request", "unsigned SAMLRequest"),
+		},
+		{
+			name:      "logout request signed with unknown key",
+			param:     "SAMLRequest",
+			issuer:    testIdpEntityID,
+			signer:    spSigner,
+			shouldErr: true,
+			err:       errors.ErrIdentityProviderSamlLogoutInvalid.WithArgs("request", "signature verification failed"),
+		},
+		{
+			name:      "logout request of unknown issuer",
+			param:     "SAMLRequest",
+			issuer:    "https://idp.fabrikam.com/saml/metadata",
+			signer:    idpSigner,
+			shouldErr: true,
+			err: errors.ErrIdentityProviderSamlLogoutInvalid.WithArgs("request",
+				fmt.Errorf("issuer does not match IdP metadata entity id %q", testIdpEntityID)),
+		},
+		{
+			name:      "replayed logout request",
+			param:     "SAMLRequest",
+			issuer:    testIdpEntityID,
+			signer:    idpSigner,
+			replay:    true,
+			shouldErr: true,
+			err: errors.ErrIdentityProviderSamlLogoutInvalid.WithArgs("request",
+				errors.ErrIdentityProviderSamlRequestIDReplayed.WithArgs("id-foo")),
+		},
+		{
+			name:          "logout request without destination",
+			param:         "SAMLRequest",
+			issuer:        testIdpEntityID,
+			signer:        idpSigner,
+			noDestination: true,
+			shouldErr:     true,
+			err:           errors.ErrIdentityProviderSamlLogoutInvalid.WithArgs("request", fmt.Errorf("empty destination")),
+		},
+		{
+			name:          "logout response without destination",
+			param:         "SAMLResponse",
+			issuer:        testIdpEntityID,
+			signer:        idpSigner,
+			initiate:      true,
+			noDestination: true,
+			shouldErr:     true,
+			err:           errors.ErrIdentityProviderSamlLogoutInvalid.WithArgs("response", fmt.Errorf("empty destination")),
+		},
+		{
+			name:     "logout response of identity provider",
+			param:    "SAMLResponse",
+			issuer:   testIdpEntityID,
+			signer:   idpSigner,
+			initiate: true,
+			want: map[string]interface{}{
+				"code":     200,
+				"redirect": false,
+			},
+		},
+		{
+			name:      "replayed logout response",
+			param:     "SAMLResponse",
+			issuer:    testIdpEntityID,
+			signer:    idpSigner,
+			initiate:  true,
+			replay:    true,
+			shouldErr: true,
+		},
+		{
+			name:      "unsolicited logout response",
+			param:     "SAMLResponse",
+			issuer:    testIdpEntityID,
+			signer:    idpSigner,
+			shouldErr: true,
+			err: errors.ErrIdentityProviderSamlLogoutInvalid.WithArgs("response",
+				errors.ErrIdentityProviderSamlRequestIDNotFound.WithArgs("")),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			prv := newTestIdentityProvider(t)
+			issuer := &samllib.Issuer{Value: tc.issuer}
+			now := samllib.TimeNow().UTC()
+
+			var inResponseTo string
+			if tc.initiate {
+				r := requests.NewRequest()
+				r.Session.NameID = "jsmith@contoso.com"
+				if err := prv.Logout(r); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				el, _, err := decodeMessage(httptest.NewRequest(http.MethodGet, r.Response.RedirectURL, nil), "SAMLRequest", []*x509.Certificate{spCert})
+				if err != nil {
+					t.Fatalf("failed to decode logout request: %v", err)
+				}
+				req := &samllib.LogoutRequest{}
+				if err := unmarshalElement(el, req); err != nil {
+					t.Fatalf("failed to unmarshal logout request: %v", err)
+				}
+				inResponseTo = req.ID
+			}
+
+			destination := testSloURL
+			if tc.noDestination {
+				destination = ""
+			}
+
+			var msg interface{ Element() *etree.Element }
+			switch tc.param {
+			case "SAMLRequest":
+				msg = &samllib.LogoutRequest{
+					ID:           "id-foo",
+					Version:      "2.0",
+					IssueInstant: now,
+					Destination:  destination,
+					Issuer:       issuer,
+					NameID: &samllib.NameID{
+						Format: "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress",
+						Value:  "jsmith@contoso.com",
+					},
+					SessionIndex: &samllib.SessionIndex{Value: "id-foobar"},
+				}
+			default:
+				msg = &samllib.LogoutResponse{
+					ID:           "id-bar",
+					InResponseTo: inResponseTo,
+					Version:      "2.0",
+					IssueInstant: now,
+					Destination:  destination,
+					Issuer:       issuer,
+					Status: samllib.Status{
+						StatusCode: samllib.StatusCode{Value: samllib.StatusSuccess},
+					},
+				}
+			}
+			u, err := encodeRedirectURL(testSloURL, tc.param, msg.Element(), "foo", tc.signer)
+			if err != nil {
+				t.Fatalf("failed to encode logout message: %v", err)
+			}
+
+			if tc.replay {
+				r := requests.NewRequest()
+				r.Upstream.Request = httptest.NewRequest(http.MethodGet, u, nil)
+				if err := prv.Logout(r); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if tc.param == "SAMLResponse" {
+					tc.err = errors.ErrIdentityProviderSamlLogoutInvalid.WithArgs("response",
+						errors.ErrIdentityProviderSamlRequestIDNotFound.WithArgs(inResponseTo))
+				}
+			}
+
+			r := requests.NewRequest()
+			r.Upstream.Request = httptest.NewRequest(http.MethodGet, u, nil)
+			err = prv.Logout(r)
+			if tests.EvalErrWithLog(t, err, "logout", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			got := map[string]interface{}{
+				"code":     r.Response.Code,
+				"redirect": r.Response.RedirectURL != "",
+			}
+			if tc.param == "SAMLRequest" {
+				if !strings.HasPrefix(r.Response.RedirectURL, "https://idp.contoso.com/saml/slo?SAMLResponse=") {
+					t.Fatalf("unexpected logout response redirect: %s", r.Response.RedirectURL)
+				}
+				if !strings.Contains(r.Response.RedirectURL, "&RelayState=foo&") {
+					t.Fatalf("logout response redirect has no relay state: %s", r.Response.RedirectURL)
+				}
+				got["name_id"] = r.Session.NameID
+				got["session_index"] = r.Session.SessionIndex
+			}
+			tests.EvalObjectsWithLog(t, "response", tc.want, got, msgs)
+		})
+	}
+}
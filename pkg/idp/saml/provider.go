@@ -16,13 +16,18 @@ package saml
 
 import (
 	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
 	"encoding/xml"
 	samllib "github.com/crewjam/saml"
 	"github.com/crewjam/saml/samlsp"
 	"github.com/greenpau/go-authcrunch/pkg/authn/enums/operator"
 	"github.com/greenpau/go-authcrunch/pkg/authn/icons"
 	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/kvstore"
 	"github.com/greenpau/go-authcrunch/pkg/requests"
 	fileutil "github.com/greenpau/go-authcrunch/pkg/util/file"
 	"go.uber.org/zap"
@@ -44,7 +49,16 @@ type IdentityProvider struct {
 	// loginURL is the link to Azure AD authentication portal.
 	// The link is auto-generated based on Azure AD tenant and
 	// application IDs.
-	loginURL   string
+	loginURL string
+	// mapper maps assertion attributes to user claims.
+	mapper *attributeMapper
+	// pending holds the ids of the requests sent to the Identity Provider.
+	pending *requestManager
+	// idpCerts are the certificates signing the messages of the Identity
+	// Provider.
+	idpCerts []*x509.Certificate
+	// signer signs the requests of the service provider.
+	signer     crypto.Signer
 	logger     *zap.Logger
 	configured bool
 }
@@ -56,8 +70,9 @@ func NewIdentityProvider(cfg *Config, logger *zap.Logger) (*IdentityProvider, er
 	}
 
 	b := &IdentityProvider{
-		config: cfg,
-		logger: logger,
+		config:  cfg,
+		logger:  logger,
+		pending: newRequestManager(),
 	}
 
 	if err := b.config.Validate(); err != nil {
@@ -92,10 +107,18 @@ func (b *IdentityProvider) Request(op operator.Type, r *requests.Request) error
 	switch op {
 	case operator.Authenticate:
 		return b.Authenticate(r)
+	case operator.Logout:
+		return b.Logout(r)
 	}
 	return errors.ErrOperatorNotSupported.WithArgs(op)
 }
 
+// SetCacheStore sets the key/value store holding the ids of the requests
+// sent to the Identity Provider, e.g. a store shared by several instances.
+func (b *IdentityProvider) SetCacheStore(store kvstore.Store) {
+	b.pending.setStore(kvstore.WithPrefix(store, "saml/"+b.config.Name+"/"))
+}
+
 // GetConfig returns IdentityProvider configuration.
 func (b *IdentityProvider) GetConfig() map[string]interface{} {
 	var m map[string]interface{}
@@ -106,7 +129,22 @@ func (b *IdentityProvider) GetConfig() map[string]interface{} {
 
 // Configure configures IdentityProvider.
 func (b *IdentityProvider) Configure() error {
+	opts := samlsp.Options{}
 	b.loginURL = b.config.IdpLoginURL
+	b.mapper = newAttributeMapper(b.config.Driver, b.config.Attributes)
+
+	if b.config.SpKeyLocation != "" {
+		signer, cert, err := loadSigningKeyPair(b.config.SpKeyLocation, b.config.SpCertLocation)
+		if err != nil {
+			return errors.ErrIdentityProviderSamlSigningKeyLoad.WithArgs(err)
+		}
+		b.signer = signer
+		if k, ok := signer.(*rsa.PrivateKey); ok {
+			// The key decrypts encrypted assertions.
+			opts.Key = k
+			opts.Certificate = cert
+		}
+	}
 
 	idpSignCert, err := fileutil.ReadCertFile(b.config.IdpSignCertLocation)
 	if err != nil {
@@ -114,7 +152,6 @@ func (b *IdentityProvider) Configure() error {
 	}
 
 	// Obtain SAML IdP Metadata
-	opts := samlsp.Options{}
 	if strings.HasPrefix(b.config.IdpMetadataLocation, "http") {
 		idpMetadataURL, err := url.Parse(b.config.IdpMetadataLocation)
 		if err != nil {
@@ -151,6 +188,8 @@ func (b *IdentityProvider) Configure() error {
 
 		cfgAcsURL, _ := url.Parse(acsURL)
 		sp.AcsURL = *cfgAcsURL
+		sp.SloURL = *cfgAcsURL
+		sp.SloURL.Path = strings.TrimSuffix(sp.SloURL.Path, "/") + "/logout"
 
 		entityID, _ := url.Parse(b.config.EntityID)
 		sp.MetadataURL = *entityID
@@ -183,6 +222,15 @@ func (b *IdentityProvider) Configure() error {
 		b.serviceProviders[acsURL] = &sp
 	}
 
+	b.idpCerts = getSigningCerts(opts.IDPMetadata)
+
+	if b.loginURL == "" {
+		// The login starts with the authentication request.
+		if b.getServiceProvider(nil).GetSSOBindingLocation(samllib.HTTPRedirectBinding) == "" {
+			return errors.ErrIdentityProviderSamlSingleSignOnURL
+		}
+	}
+
 	b.logger.Info(
 		"successfully configured SAML identity provider",
 		zap.String("tenant_id", b.config.TenantID),
@@ -192,6 +240,8 @@ func (b *IdentityProvider) Configure() error {
 		zap.String("login_url", b.loginURL),
 		zap.String("idp_sign_cert_location", b.config.IdpSignCertLocation),
 		zap.String("idp_metadata_location", b.config.IdpMetadataLocation),
+		zap.Bool("request_signing_enabled", b.signer != nil),
+		zap.Bool("logout_enabled", b.config.LogoutEnabled),
 		zap.Any("login_icon", b.config.LoginIcon),
 	)
 
@@ -200,6 +250,61 @@ func (b *IdentityProvider) Configure() error {
 	return nil
 }
 
+// getServiceProvider returns the service provider serving the host of the
+// request. It defaults to the service provider of the first ACS URL.
+func (b *IdentityProvider) getServiceProvider(r *http.Request) *samllib.ServiceProvider {
+	if r != nil {
+		for _, acsURL := range b.config.AssertionConsumerServiceURLs {
+			if sp := b.serviceProviders[acsURL]; sp.AcsURL.Host == r.Host {
+				return sp
+			}
+		}
+	}
+	return b.serviceProviders[b.config.AssertionConsumerServiceURLs[0]]
+}
+
+// loadSigningKeyPair loads PEM-encoded private key and certificate.
+func loadSigningKeyPair(keyPath, certPath string) (crypto.Signer, *x509.Certificate, error) {
+	b, err := fileutil.ReadFileBytes(keyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, nil, errors.ErrIdentityProviderConfig.WithArgs("private key is not PEM-encoded")
+	}
+	var pk interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		pk, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		pk, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		pk, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	signer, ok := pk.(crypto.Signer)
+	if !ok {
+		return nil, nil, errors.ErrIdentityProviderConfig.WithArgs("private key is not a signer")
+	}
+
+	b, err = fileutil.ReadFileBytes(certPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	block, _ = pem.Decode(b)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, nil, errors.ErrIdentityProviderConfig.WithArgs("certificate is not PEM-encoded")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	return signer, cert, nil
+}
+
 // GetLoginIcon returns the instance of the icon associated with the provider.
 func (b *IdentityProvider) GetLoginIcon() *icons.LoginIcon {
 	return b.config.LoginIcon
@@ -207,7 +312,10 @@ func (b *IdentityProvider) GetLoginIcon() *icons.LoginIcon {
 
 // GetLogoutURL returns the logout URL associated with the provider.
 func (b *IdentityProvider) GetLogoutURL() string {
-	return ""
+	if !b.config.LogoutEnabled || !b.configured {
+		return ""
+	}
+	return b.getServiceProvider(nil).GetSLOBindingLocation(samllib.HTTPRedirectBinding)
 }
 
 // GetDriver returns the name of the driver associated with the provider.
@@ -0,0 +1,94 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saml
+
+import (
+	"sync"
+	"time"
+
+	samllib "github.com/crewjam/saml"
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/kvstore"
+)
+
+const (
+	requestKeyPrefix = "request/"
+	// receivedRequestKeyPrefix is the prefix of the ids of the logout
+	// requests received from the Identity Provider.
+	receivedRequestKeyPrefix = "received_request/"
+	// requestLifetime is the time the user has to complete the login or
+	// logout with the Identity Provider.
+	requestLifetime = 15 * time.Minute
+)
+
+// requestManager keeps the ids of the authentication and logout requests
+// sent to the Identity Provider, so that only the responses to the requests
+// are accepted, and the ids of the logout requests received from the
+// Identity Provider, so that the requests are not replayed. The ids are kept in a key/value store, which is in memory
+// unless set with setStore.
+type requestManager struct {
+	mux   sync.RWMutex
+	store kvstore.Store
+}
+
+func newRequestManager() *requestManager {
+	return &requestManager{
+		store: kvstore.NewMemoryStore(),
+	}
+}
+
+func (rm *requestManager) setStore(store kvstore.Store) {
+	rm.mux.Lock()
+	defer rm.mux.Unlock()
+	rm.store = store
+}
+
+func (rm *requestManager) getStore() kvstore.Store {
+	rm.mux.RLock()
+	defer rm.mux.RUnlock()
+	return rm.store
+}
+
+func (rm *requestManager) add(id string) error {
+	return rm.getStore().Set(requestKeyPrefix+id, []byte(time.Now().UTC().Format(time.RFC3339)), requestLifetime)
+}
+
+// consume removes the request id. It returns an error when the request is
+// unknown or expired.
+func (rm *requestManager) consume(id string) error {
+	store := rm.getStore()
+	if _, err := store.Get(requestKeyPrefix + id); err != nil {
+		return errors.ErrIdentityProviderSamlRequestIDNotFound.WithArgs(id)
+	}
+	store.Delete(requestKeyPrefix + id)
+	return nil
+}
+
+// addReceived records the id of the request received from the Identity
+// Provider. It returns an error when the request was already received. The
+// id is kept until the request expires, see validateMessage.
+func (rm *requestManager) addReceived(id string) error {
+	if id == "" {
+		return errors.ErrIdentityProviderSamlRequestIDEmpty
+	}
+	ttl := samllib.MaxIssueDelay + samllib.MaxClockSkew
+	if err := rm.getStore().Add(receivedRequestKeyPrefix+id, []byte(time.Now().UTC().Format(time.RFC3339)), ttl); err != nil {
+		if err == errors.ErrKVStoreKeyExists {
+			return errors.ErrIdentityProviderSamlRequestIDReplayed.WithArgs(id)
+		}
+		return err
+	}
+	return nil
+}
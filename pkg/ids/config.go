@@ -57,6 +57,10 @@ func (cfg *IdentityStoreConfig) Validate() error {
 		}
 		optionalFields = []string{
 			"users",
+			"lockout",
+			"storage",
+			"backup_count",
+			"watch_interval",
 			"login_icon",
 			"registration_enabled",
 			"username_recovery_enabled",
@@ -87,6 +91,11 @@ func (cfg *IdentityStoreConfig) Validate() error {
 			"support_link",
 			"support_email",
 			"fallback_roles",
+			"overlay_path",
+			"overlay_storage",
+			"nested_groups",
+			"nested_groups_max_depth",
+			"password_change",
 		}
 	case "":
 		return errors.ErrIdentityStoreConfigInvalid.WithArgs("empty identity store type")
@@ -47,6 +47,29 @@ func TestNewIdentityStoreConfig(t *testing.T) {
 			    "path":"foo",
 				"realm":"local"
 			  }
+            }`,
+		},
+		{
+			name:      "test local identity store with lockout policy",
+			storeName: "default",
+			kind:      "local",
+			params: map[string]interface{}{
+				"path":  "foo",
+				"realm": "local",
+				"lockout": map[string]interface{}{
+					"max_attempts": 5,
+				},
+			},
+			want: `{
+			  "kind": "local",
+			  "name": "default",
+			  "params": {
+			    "path":"foo",
+				"realm":"local",
+				"lockout": {
+				  "max_attempts": 5
+				}
+			  }
             }`,
 		},
 		{
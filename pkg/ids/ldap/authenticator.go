@@ -17,6 +17,7 @@ package ldap
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/hex"
 	"fmt"
 	ldap "github.com/go-ldap/ldap/v3"
 	"github.com/greenpau/go-authcrunch/pkg/errors"
@@ -26,16 +27,40 @@ import (
 	"net"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf16"
 )
 
-// Authenticator represents database connector.
+const (
+	// inChainMatchingRule is the OID of the LDAP_MATCHING_RULE_IN_CHAIN
+	// matching rule of Active Directory.
+	inChainMatchingRule         = "1.2.840.113556.1.4.1941"
+	defaultNestedGroupsMaxDepth = 8
+	maxNestedGroupsMaxDepth     = 32
+
+	// The attributes identifying the entries of the users, regardless of
+	// renames and moves, and the attributes of disabled accounts.
+	objectGUIDAttribute         = "objectGUID"
+	entryUUIDAttribute          = "entryUUID"
+	userAccountControlAttribute = "userAccountControl"
+	nsAccountLockAttribute      = "nsAccountLock"
+	// accountDisableFlag is the ACCOUNTDISABLE flag of userAccountControl.
+	accountDisableFlag = 0x2
+)
+
+var errServersUnavailable = errors.ErrIdentityStoreLdapAuthFailed.WithArgs("LDAP servers are unavailable")
+
+// Authenticator represents database connector. The configuration is
+// guarded by the mutex, while the requests to the LDAP servers run
+// concurrently using the connection pools of the servers.
 type Authenticator struct {
 	mux               sync.Mutex
 	realm             string
 	servers           []*AuthServer
+	pools             []*connPool
 	username          string
 	password          string
 	searchBaseDN      string
@@ -45,6 +70,9 @@ type Authenticator struct {
 	fallbackRoles     []string
 	rootCAs           *x509.CertPool
 	groups            []*UserGroup
+	nestedGroups      string
+	nestedGroupsDepth int
+	passwordChange    string
 	logger            *zap.Logger
 }
 
@@ -90,12 +118,19 @@ func (sa *Authenticator) ConfigureServers(cfg *Config) error {
 		if entry.Timeout > 10 {
 			return fmt.Errorf("invalid timeout value: %d, cannot exceed 10 seconds", entry.Timeout)
 		}
+		if entry.MaxConnections == 0 {
+			entry.MaxConnections = defaultMaxConnections
+		}
+		if entry.MaxConnections < 0 || entry.MaxConnections > maxMaxConnections {
+			return fmt.Errorf("invalid max connections value: %d, must be between 1 and %d", entry.MaxConnections, maxMaxConnections)
+		}
 
 		server := &AuthServer{
 			Address:          entry.Address,
 			IgnoreCertErrors: entry.IgnoreCertErrors,
 			Timeout:          entry.Timeout,
 			PosixGroups:      entry.PosixGroups,
+			MaxConnections:   entry.MaxConnections,
 		}
 
 		url, err := url.Parse(entry.Address)
@@ -125,8 +160,10 @@ func (sa *Authenticator) ConfigureServers(cfg *Config) error {
 			zap.Bool("ignore_cert_errors", server.IgnoreCertErrors),
 			zap.Bool("posix_groups", server.PosixGroups),
 			zap.Int("timeout", server.Timeout),
+			zap.Int("max_connections", server.MaxConnections),
 		)
 		sa.servers = append(sa.servers, server)
+		sa.pools = append(sa.pools, newConnPool(server, sa.dial))
 	}
 	return nil
 }
@@ -276,120 +313,432 @@ func (sa *Authenticator) ConfigureUserGroups(cfg *Config) error {
 		)
 		sa.groups = append(sa.groups, saGroup)
 	}
+
+	switch cfg.NestedGroups {
+	case "", "in_chain", "recursive":
+	default:
+		return fmt.Errorf("unsupported nested groups method: %s", cfg.NestedGroups)
+	}
+	// The depth of the in_chain method is unbounded, because the directory
+	// server resolves the whole chain of memberships.
+	depth := cfg.NestedGroupsMaxDepth
+	if depth != 0 && cfg.NestedGroups != "recursive" {
+		return fmt.Errorf("nested groups max depth requires recursive nested groups method")
+	}
+	if depth == 0 && cfg.NestedGroups == "recursive" {
+		depth = defaultNestedGroupsMaxDepth
+	}
+	if depth < 0 || depth > maxNestedGroupsMaxDepth {
+		return fmt.Errorf("invalid nested groups max depth value: %d, must be between 1 and %d", depth, maxNestedGroupsMaxDepth)
+	}
+	sa.nestedGroups = cfg.NestedGroups
+	sa.nestedGroupsDepth = depth
+	switch sa.nestedGroups {
+	case "recursive":
+		sa.logger.Info(
+			"LDAP plugin configuration",
+			zap.String("phase", "nested_groups"),
+			zap.String("method", sa.nestedGroups),
+			zap.Int("max_depth", sa.nestedGroupsDepth),
+		)
+	case "in_chain":
+		sa.logger.Info(
+			"LDAP plugin configuration",
+			zap.String("phase", "nested_groups"),
+			zap.String("method", sa.nestedGroups),
+		)
+	}
 	return nil
 }
 
-// IdentifyUser returns user challenges.
-func (sa *Authenticator) IdentifyUser(r *requests.Request) error {
+// ConfigurePasswordChange configures the method of changing user passwords.
+func (sa *Authenticator) ConfigurePasswordChange(cfg *Config) error {
 	sa.mux.Lock()
 	defer sa.mux.Unlock()
+	switch cfg.PasswordChange {
+	case "", "password_modify", "unicode_pwd":
+	default:
+		return fmt.Errorf("unsupported password change method: %s", cfg.PasswordChange)
+	}
+	sa.passwordChange = cfg.PasswordChange
+	if sa.passwordChange != "" {
+		sa.logger.Info(
+			"LDAP plugin configuration",
+			zap.String("phase", "password_change"),
+			zap.String("method", sa.passwordChange),
+		)
+	}
+	return nil
+}
+
+// IdentifyUser returns user challenges.
+func (sa *Authenticator) IdentifyUser(r *requests.Request) error {
+	_, err := sa.identifyUser(r)
+	return err
+}
+
+// identifyUser returns user challenges and the directory entry of the user.
+// The entry is nil when the user is not found.
+func (sa *Authenticator) identifyUser(r *requests.Request) (*ldap.Entry, error) {
+	var user *ldap.Entry
+	err := sa.withConn(func(conn *ldap.Conn, server *AuthServer) error {
+		entry, err := sa.findUser(conn, server, r)
+		user = entry
+		return err
+	})
+	if err == nil {
+		return user, nil
+	}
+	switch err.Error() {
+	case errors.ErrIdentityStoreLdapAuthFailed.WithArgs("user not found").Error():
+		r.User.Username = "nobody"
+		r.User.Email = "nobody@localhost"
+		r.User.Challenges = []string{"password"}
+		return nil, nil
+	case errServersUnavailable.Error():
+		r.Response.Code = 500
+	default:
+		r.Response.Code = 401
+	}
+	return nil, err
+}
 
-	for _, server := range sa.servers {
-		conn, err := sa.dial(server)
+// LookupAnchor returns the anchor of the directory entry of the user with
+// the username. It fails when the user is not found, the account of the
+// user is disabled, or the email address of the user, if any, differs from
+// the one in the directory.
+func (sa *Authenticator) LookupAnchor(r *requests.Request) (string, error) {
+	var anchor string
+	err := sa.withConn(func(conn *ldap.Conn, server *AuthServer) error {
+		user, err := sa.searchUser(conn, server, r.User.Username, []string{
+			sa.userAttributes.Email,
+			objectGUIDAttribute,
+			entryUUIDAttribute,
+			userAccountControlAttribute,
+			nsAccountLockAttribute,
+		})
 		if err != nil {
-			continue
-		}
-		defer conn.Close()
-		if err := sa.findUser(conn, server, r); err != nil {
-			if err.Error() == errors.ErrIdentityStoreLdapAuthFailed.WithArgs("user not found").Error() {
-				r.User.Username = "nobody"
-				r.User.Email = "nobody@localhost"
-				r.User.Challenges = []string{"password"}
-				return nil
-			}
-			r.Response.Code = 401
 			return err
 		}
-
+		if isEntryDisabled(user) {
+			return errors.ErrIdentityStoreLdapUserDisabled.WithArgs(r.User.Username)
+		}
+		if r.User.Email != "" && !strings.EqualFold(r.User.Email, user.GetAttributeValue(sa.userAttributes.Email)) {
+			return errors.ErrIdentityStoreLdapUserMismatch.WithArgs(r.User.Username)
+		}
+		anchor = getEntryAnchor(user)
 		return nil
-	}
-	r.Response.Code = 500
-	return errors.ErrIdentityStoreLdapAuthFailed.WithArgs("LDAP servers are unavailable")
+	})
+	return anchor, err
+}
+
+// LookupUser identifies the user of the directory entry with the anchor.
+// Unlike IdentifyUser, it fails when the entry is not found or the account
+// of the user is disabled.
+func (sa *Authenticator) LookupUser(anchor string, r *requests.Request) error {
+	return sa.withConn(func(conn *ldap.Conn, server *AuthServer) error {
+		user, err := sa.searchAnchor(conn, server, anchor)
+		if err != nil {
+			return err
+		}
+		if isEntryDisabled(user) {
+			return errors.ErrIdentityStoreLdapUserDisabled.WithArgs(user.DN)
+		}
+		return sa.identifyEntry(conn, server, user, r)
+	})
 }
 
 // AuthenticateUser checks the database for the presence of a username/email
 // and password and returns user claims.
 func (sa *Authenticator) AuthenticateUser(r *requests.Request) error {
-	sa.mux.Lock()
-	defer sa.mux.Unlock()
-
-	for _, server := range sa.servers {
-		ldapConnection, err := sa.dial(server)
+	return sa.withConn(func(conn *ldap.Conn, server *AuthServer) error {
+		user, err := sa.searchUser(conn, server, r.User.Username, []string{sa.userAttributes.Email})
 		if err != nil {
-			continue
+			return err
 		}
-		defer ldapConnection.Close()
-
-		searchUserFilter := strings.ReplaceAll(sa.searchUserFilter, "%s", r.User.Username)
-
-		req := ldap.NewSearchRequest(
-			// group.GroupDN,
-			sa.searchBaseDN,
-			ldap.ScopeWholeSubtree,
-			ldap.NeverDerefAliases,
-			0,
-			server.Timeout,
-			false,
-			searchUserFilter,
-			[]string{
-				sa.userAttributes.Email,
-			},
-			nil, // Controls
-		)
 
-		if req == nil {
+		// Use the provided password to bind the connection, and then bind it
+		// back with the service account credentials before returning it
+		// to the pool.
+		err = conn.Bind(user.DN, r.User.Password)
+		sa.rebind(conn, server)
+		if err != nil {
 			sa.logger.Error(
-				"LDAP request building failed, request is nil",
+				"LDAP auth binding failed",
 				zap.String("server", server.Address),
-				zap.String("search_base_dn", sa.searchBaseDN),
-				zap.String("search_user_filter", searchUserFilter),
+				zap.String("dn", user.DN),
+				zap.String("username", r.User.Username),
+				zap.String("error", err.Error()),
 			)
-			continue
+			if isNetworkError(err) {
+				return err
+			}
+			return errors.ErrIdentityStoreLdapAuthFailed.WithArgs(err)
 		}
 
-		resp, err := ldapConnection.Search(req)
+		sa.logger.Debug(
+			"LDAP auth succeeded",
+			zap.String("server", server.Address),
+			zap.String("dn", user.DN),
+			zap.String("username", r.User.Username),
+		)
+		return nil
+	})
+}
+
+// ChangePassword changes the password of the user in the directory. The
+// change is performed on behalf of the user, i.e. the connection is bound
+// with the current password of the user.
+func (sa *Authenticator) ChangePassword(r *requests.Request) error {
+	return sa.withConn(func(conn *ldap.Conn, server *AuthServer) error {
+		user, err := sa.searchUser(conn, server, r.User.Username, []string{sa.userAttributes.Email})
 		if err != nil {
-			sa.logger.Error(
-				"LDAP search failed",
-				zap.String("server", server.Address),
-				zap.String("search_base_dn", sa.searchBaseDN),
-				zap.String("search_user_filter", searchUserFilter),
-				zap.String("error", err.Error()),
-			)
-			continue
+			return err
 		}
 
-		switch len(resp.Entries) {
-		case 1:
-		case 0:
-			return errors.ErrIdentityStoreLdapAuthFailed.WithArgs("user not found")
-		default:
-			return errors.ErrIdentityStoreLdapAuthFailed.WithArgs("multiple users matched")
+		if err := conn.Bind(user.DN, r.User.OldPassword); err != nil {
+			sa.rebind(conn, server)
+			if isNetworkError(err) {
+				return err
+			}
+			return errors.ErrIdentityStoreLdapChangePasswordFailed.WithArgs(err)
 		}
 
-		user := resp.Entries[0]
-		// Use the provided password to make an LDAP connection.
-		if err := ldapConnection.Bind(user.DN, r.User.Password); err != nil {
+		switch sa.passwordChange {
+		case "unicode_pwd":
+			// Active Directory requires deleting the current password and
+			// adding the new one in a single request, unless the change is
+			// an administrative reset.
+			req := ldap.NewModifyRequest(user.DN, nil)
+			req.Delete("unicodePwd", []string{encodeUnicodePwd(r.User.OldPassword)})
+			req.Add("unicodePwd", []string{encodeUnicodePwd(r.User.Password)})
+			err = conn.Modify(req)
+		default:
+			_, err = conn.PasswordModify(ldap.NewPasswordModifyRequest(user.DN, r.User.OldPassword, r.User.Password))
+		}
+		sa.rebind(conn, server)
+		if err != nil {
 			sa.logger.Error(
-				"LDAP auth binding failed",
+				"LDAP password change failed",
 				zap.String("server", server.Address),
 				zap.String("dn", user.DN),
 				zap.String("username", r.User.Username),
+				zap.String("method", sa.passwordChange),
 				zap.String("error", err.Error()),
 			)
-			return errors.ErrIdentityStoreLdapAuthFailed.WithArgs(err)
+			if isNetworkError(err) {
+				return err
+			}
+			return errors.ErrIdentityStoreLdapChangePasswordFailed.WithArgs(err)
 		}
 
-		sa.logger.Debug(
-			"LDAP auth succeeded",
+		sa.logger.Info(
+			"LDAP password change succeeded",
 			zap.String("server", server.Address),
 			zap.String("dn", user.DN),
 			zap.String("username", r.User.Username),
 		)
 		return nil
+	})
+}
+
+// withConn runs the function with a pooled connection to an LDAP server.
+// The servers are tried in order, starting with the healthy ones. The
+// function is retried with the next server upon network errors.
+func (sa *Authenticator) withConn(fn func(*ldap.Conn, *AuthServer) error) error {
+	var pools, unhealthyPools []*connPool
+	for _, pool := range sa.pools {
+		if pool.healthy() {
+			pools = append(pools, pool)
+		} else {
+			unhealthyPools = append(unhealthyPools, pool)
+		}
+	}
+	pools = append(pools, unhealthyPools...)
+
+	for _, pool := range pools {
+		conn, err := pool.get()
+		if err != nil {
+			sa.logger.Warn(
+				"LDAP connection unavailable",
+				zap.String("server", pool.server.Address),
+				zap.Error(err),
+			)
+			continue
+		}
+		err = fn(conn, pool.server)
+		if isNetworkError(err) {
+			// The responses of the timed out requests may still arrive.
+			conn.Close()
+			pool.put(conn)
+			sa.logger.Warn(
+				"LDAP request failed",
+				zap.String("server", pool.server.Address),
+				zap.Error(err),
+			)
+			continue
+		}
+		pool.put(conn)
+		return err
+	}
+	return errServersUnavailable
+}
+
+// rebind binds the connection with the service account credentials. The
+// connection failing to bind is closed.
+func (sa *Authenticator) rebind(conn *ldap.Conn, server *AuthServer) {
+	if err := conn.Bind(sa.username, sa.password); err != nil {
+		sa.logger.Error(
+			"LDAP connection binding failed",
+			zap.String("server", server.Address),
+			zap.String("username", sa.username),
+			zap.String("error", err.Error()),
+		)
+		conn.Close()
+	}
+}
+
+// searchUser returns the entry of the user with the username or email
+// address.
+func (sa *Authenticator) searchUser(conn *ldap.Conn, server *AuthServer, username string, attrs []string) (*ldap.Entry, error) {
+	searchUserFilter := strings.ReplaceAll(sa.searchUserFilter, "%s", ldap.EscapeFilter(username))
+
+	req := ldap.NewSearchRequest(
+		sa.searchBaseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		0,
+		server.Timeout,
+		false,
+		searchUserFilter,
+		attrs,
+		nil, // Controls
+	)
+
+	resp, err := conn.Search(req)
+	if err != nil {
+		sa.logger.Error(
+			"LDAP search failed",
+			zap.String("server", server.Address),
+			zap.String("search_base_dn", sa.searchBaseDN),
+			zap.String("search_user_filter", searchUserFilter),
+			zap.String("error", err.Error()),
+		)
+		if isNetworkError(err) {
+			return nil, err
+		}
+		return nil, errors.ErrIdentityStoreLdapAuthFailed.WithArgs("LDAP search failed")
+	}
+
+	sa.logger.Debug(
+		"LDAP search succeeded",
+		zap.String("server", server.Address),
+		zap.Int("entry_count", len(resp.Entries)),
+		zap.String("search_base_dn", sa.searchBaseDN),
+		zap.String("search_user_filter", searchUserFilter),
+		zap.Any("users", resp.Entries),
+	)
+
+	switch len(resp.Entries) {
+	case 1:
+	case 0:
+		return nil, errors.ErrIdentityStoreLdapAuthFailed.WithArgs("user not found")
+	default:
+		return nil, errors.ErrIdentityStoreLdapAuthFailed.WithArgs("multiple users matched")
+	}
+	return resp.Entries[0], nil
+}
+
+// searchAnchor returns the entry of the user with the anchor. The entries
+// having the objectGUID or entryUUID of the anchor are searched under the
+// search base, while the entry with the distinguished name of the anchor is
+// read directly.
+func (sa *Authenticator) searchAnchor(conn *ldap.Conn, server *AuthServer, anchor string) (*ldap.Entry, error) {
+	baseDN, scope, filter := sa.searchBaseDN, ldap.ScopeWholeSubtree, ""
+	switch {
+	case strings.HasPrefix(anchor, "guid:"):
+		b, err := hex.DecodeString(strings.TrimPrefix(anchor, "guid:"))
+		if err != nil || len(b) == 0 {
+			return nil, errors.ErrIdentityStoreLdapAnchorInvalid.WithArgs(anchor)
+		}
+		var sb strings.Builder
+		for _, c := range b {
+			fmt.Fprintf(&sb, "\\%02x", c)
+		}
+		filter = "(" + objectGUIDAttribute + "=" + sb.String() + ")"
+	case strings.HasPrefix(anchor, "uuid:"):
+		filter = "(" + entryUUIDAttribute + "=" + ldap.EscapeFilter(strings.TrimPrefix(anchor, "uuid:")) + ")"
+	case strings.HasPrefix(anchor, "dn:"):
+		baseDN, scope, filter = strings.TrimPrefix(anchor, "dn:"), ldap.ScopeBaseObject, "(objectClass=*)"
+	default:
+		return nil, errors.ErrIdentityStoreLdapAnchorInvalid.WithArgs(anchor)
+	}
+
+	req := ldap.NewSearchRequest(
+		baseDN,
+		scope,
+		ldap.NeverDerefAliases,
+		0,
+		server.Timeout,
+		false,
+		filter,
+		sa.getSearchAttributes(),
+		nil, // Controls
+	)
+
+	resp, err := conn.Search(req)
+	if err != nil {
+		if isNetworkError(err) {
+			return nil, err
+		}
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+			return nil, errors.ErrIdentityStoreLdapAuthFailed.WithArgs("user not found")
+		}
+		sa.logger.Error(
+			"LDAP anchor search failed",
+			zap.String("server", server.Address),
+			zap.String("anchor", anchor),
+			zap.String("error", err.Error()),
+		)
+		return nil, errors.ErrIdentityStoreLdapAuthFailed.WithArgs("LDAP search failed")
+	}
+
+	switch len(resp.Entries) {
+	case 1:
+	case 0:
+		return nil, errors.ErrIdentityStoreLdapAuthFailed.WithArgs("user not found")
+	default:
+		return nil, errors.ErrIdentityStoreLdapAuthFailed.WithArgs("multiple users matched")
+	}
+	if getEntryAnchor(resp.Entries[0]) != anchor {
+		return nil, errors.ErrIdentityStoreLdapAuthFailed.WithArgs("user not found")
 	}
+	return resp.Entries[0], nil
+}
 
-	return errors.ErrIdentityStoreLdapAuthFailed.WithArgs("LDAP servers are unavailable")
+// getEntryAnchor returns the immutable identifier of the directory entry,
+// i.e. the objectGUID in Active Directory or the entryUUID in OpenLDAP, or
+// the distinguished name of the entry otherwise.
+func getEntryAnchor(entry *ldap.Entry) string {
+	if v := entry.GetRawAttributeValue(objectGUIDAttribute); len(v) > 0 {
+		return "guid:" + hex.EncodeToString(v)
+	}
+	if v := entry.GetAttributeValue(entryUUIDAttribute); v != "" {
+		return "uuid:" + strings.ToLower(v)
+	}
+	return "dn:" + strings.ToLower(entry.DN)
+}
+
+// isEntryDisabled returns true when the account of the user is disabled,
+// i.e. the ACCOUNTDISABLE flag of userAccountControl is set in Active
+// Directory, or nsAccountLock is true in 389 Directory Server.
+func isEntryDisabled(entry *ldap.Entry) bool {
+	if v := entry.GetAttributeValue(userAccountControlAttribute); v != "" {
+		if flags, err := strconv.ParseInt(v, 10, 64); err == nil && flags&accountDisableFlag != 0 {
+			return true
+		}
+	}
+	return strings.EqualFold(entry.GetAttributeValue(nsAccountLockAttribute), "true")
 }
 
 // ConfigureTrustedAuthorities configured trusted certificate authorities, if any.
@@ -418,11 +767,9 @@ func (sa *Authenticator) ConfigureTrustedAuthorities(cfg *Config) error {
 	return nil
 }
 
-func (sa *Authenticator) searchGroups(conn *ldap.Conn, reqData map[string]interface{}, roles map[string]bool) error {
-	if roles == nil {
-		roles = make(map[string]bool)
-	}
-
+// searchGroups adds the groups matching the group search filter to the set
+// of group DNs.
+func (sa *Authenticator) searchGroups(conn *ldap.Conn, reqData map[string]interface{}, groups map[string]bool) error {
 	req := ldap.NewSearchRequest(reqData["base_dn"].(string), ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0,
 		reqData["timeout"].(int), false, reqData["search_group_filter"].(string), []string{"dn"}, nil,
 	)
@@ -440,16 +787,96 @@ func (sa *Authenticator) searchGroups(conn *ldap.Conn, reqData map[string]interf
 	}
 
 	for _, entry := range resp.Entries {
-		for _, g := range sa.groups {
-			if g.GroupDN != entry.DN {
-				continue
+		groups[entry.DN] = true
+	}
+	return nil
+}
+
+// searchNestedGroups adds the groups the user belongs to through other
+// groups to the set of group DNs.
+func (sa *Authenticator) searchNestedGroups(conn *ldap.Conn, server *AuthServer, userDN string, groups map[string]bool) error {
+	if sa.nestedGroups == "in_chain" {
+		filter := fmt.Sprintf("(member:%s:=%s)", inChainMatchingRule, ldap.EscapeFilter(userDN))
+		req := ldap.NewSearchRequest(sa.searchBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0,
+			server.Timeout, false, filter, []string{"dn"}, nil,
+		)
+		resp, err := conn.Search(req)
+		if err != nil {
+			return err
+		}
+		for _, entry := range resp.Entries {
+			groups[entry.DN] = true
+		}
+		return nil
+	}
+
+	// Follow the memberships of the groups found at the previous level,
+	// until no new groups are found or the depth limit is reached.
+	var level []string
+	for groupDN := range groups {
+		level = append(level, groupDN)
+	}
+	for depth := 1; len(level) > 0; depth++ {
+		if depth > sa.nestedGroupsDepth {
+			sa.logger.Warn(
+				"LDAP nested group search reached depth limit",
+				zap.String("server", server.Address),
+				zap.String("user_dn", userDN),
+				zap.Int("max_depth", sa.nestedGroupsDepth),
+			)
+			break
+		}
+		parents := make(map[string]bool)
+		for _, groupDN := range level {
+			if err := sa.searchParentGroups(conn, server, groupDN, parents); err != nil {
+				return err
 			}
-			for _, role := range g.Roles {
-				if role == "" {
-					continue
-				}
-				roles[role] = true
+		}
+		level = nil
+		for groupDN := range parents {
+			if groups[groupDN] {
+				continue
 			}
+			groups[groupDN] = true
+			level = append(level, groupDN)
+		}
+	}
+	return nil
+}
+
+// searchParentGroups adds the groups the group is a member of to the set of
+// group DNs. The groups are found in the same way as the direct group
+// memberships of users.
+func (sa *Authenticator) searchParentGroups(conn *ldap.Conn, server *AuthServer, groupDN string, parents map[string]bool) error {
+	if server.PosixGroups {
+		filter := strings.ReplaceAll(sa.searchGroupFilter, "%s", ldap.EscapeFilter(groupDN))
+		req := ldap.NewSearchRequest(sa.searchBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0,
+			server.Timeout, false, filter, []string{"dn"}, nil,
+		)
+		resp, err := conn.Search(req)
+		if err != nil {
+			return err
+		}
+		for _, entry := range resp.Entries {
+			parents[entry.DN] = true
+		}
+		return nil
+	}
+
+	req := ldap.NewSearchRequest(groupDN, ldap.ScopeBaseObject, ldap.NeverDerefAliases, 0,
+		server.Timeout, false, "(objectClass=*)", []string{sa.userAttributes.MemberOf}, nil,
+	)
+	resp, err := conn.Search(req)
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+			// The group is outside of the directory, e.g. in a trusted domain.
+			return nil
+		}
+		return err
+	}
+	for _, entry := range resp.Entries {
+		for _, v := range entry.GetAttributeValues(sa.userAttributes.MemberOf) {
+			parents[v] = true
 		}
 	}
 	return nil
@@ -524,6 +951,7 @@ func (sa *Authenticator) dial(server *AuthServer) (*ldap.Conn, error) {
 				zap.String("server", server.Address),
 				zap.Error(err),
 			)
+			ldapConnection.Close()
 			return nil, err
 		}
 
@@ -538,6 +966,7 @@ func (sa *Authenticator) dial(server *AuthServer) (*ldap.Conn, error) {
 	}
 
 	ldapConnection.Start()
+	ldapConnection.SetTimeout(timeout)
 
 	if err := ldapConnection.Bind(sa.username, sa.password); err != nil {
 		sa.logger.Error(
@@ -546,6 +975,7 @@ func (sa *Authenticator) dial(server *AuthServer) (*ldap.Conn, error) {
 			zap.String("username", sa.username),
 			zap.String("error", err.Error()),
 		)
+		ldapConnection.Close()
 		return nil, err
 	}
 	sa.logger.Debug(
@@ -555,69 +985,35 @@ func (sa *Authenticator) dial(server *AuthServer) (*ldap.Conn, error) {
 	return ldapConnection, nil
 }
 
-func (sa *Authenticator) findUser(ldapConnection *ldap.Conn, server *AuthServer, r *requests.Request) error {
-	searchUserFilter := strings.ReplaceAll(sa.searchUserFilter, "%s", r.User.Username)
-
-	req := ldap.NewSearchRequest(
-		// group.GroupDN,
-		sa.searchBaseDN,
-		ldap.ScopeWholeSubtree,
-		ldap.NeverDerefAliases,
-		0,
-		server.Timeout,
-		false,
-		searchUserFilter,
-		[]string{
-			sa.userAttributes.Name,
-			sa.userAttributes.Surname,
-			sa.userAttributes.Username,
-			sa.userAttributes.MemberOf,
-			sa.userAttributes.Email,
-		},
-		nil, // Controls
-	)
-
-	if req == nil {
-		sa.logger.Error(
-			"LDAP request building failed, request is nil",
-			zap.String("server", server.Address),
-			zap.String("search_base_dn", sa.searchBaseDN),
-			zap.String("search_user_filter", searchUserFilter),
-		)
-		return errors.ErrIdentityStoreLdapAuthFailed.WithArgs("LDAP request building failed, request is nil")
-	}
-
-	resp, err := ldapConnection.Search(req)
+func (sa *Authenticator) findUser(ldapConnection *ldap.Conn, server *AuthServer, r *requests.Request) (*ldap.Entry, error) {
+	user, err := sa.searchUser(ldapConnection, server, r.User.Username, sa.getSearchAttributes())
 	if err != nil {
-		sa.logger.Error(
-			"LDAP search failed",
-			zap.String("server", server.Address),
-			zap.String("search_base_dn", sa.searchBaseDN),
-			zap.String("search_user_filter", searchUserFilter),
-			zap.String("error", err.Error()),
-		)
-		return errors.ErrIdentityStoreLdapAuthFailed.WithArgs("LDAP search failed")
+		return nil, err
 	}
+	return user, sa.identifyEntry(ldapConnection, server, user, r)
+}
 
-	sa.logger.Debug(
-		"LDAP search succeeded",
-		zap.String("server", server.Address),
-		zap.Int("entry_count", len(resp.Entries)),
-		zap.String("search_base_dn", sa.searchBaseDN),
-		zap.String("search_user_filter", searchUserFilter),
-		zap.Any("users", resp.Entries),
-	)
-
-	switch len(resp.Entries) {
-	case 1:
-	case 0:
-		return errors.ErrIdentityStoreLdapAuthFailed.WithArgs("user not found")
-	default:
-		return errors.ErrIdentityStoreLdapAuthFailed.WithArgs("multiple users matched")
+// getSearchAttributes returns the attributes of the user entries needed to
+// identify the users.
+func (sa *Authenticator) getSearchAttributes() []string {
+	return []string{
+		sa.userAttributes.Name,
+		sa.userAttributes.Surname,
+		sa.userAttributes.Username,
+		sa.userAttributes.MemberOf,
+		sa.userAttributes.Email,
+		objectGUIDAttribute,
+		entryUUIDAttribute,
+		userAccountControlAttribute,
+		nsAccountLockAttribute,
 	}
+}
 
-	user := resp.Entries[0]
+// identifyEntry sets the claims of the user from the directory entry of the
+// user and the groups the user belongs to.
+func (sa *Authenticator) identifyEntry(ldapConnection *ldap.Conn, server *AuthServer, user *ldap.Entry, r *requests.Request) error {
 	var userFullName, userLastName, userFirstName, userAccountName, userMail string
+	userGroups := make(map[string]bool)
 	userRoles := make(map[string]bool)
 
 	if server.PosixGroups {
@@ -625,10 +1021,10 @@ func (sa *Authenticator) findUser(ldapConnection *ldap.Conn, server *AuthServer,
 		searchGroupRequest := map[string]interface{}{
 			"user_dn":             user.DN,
 			"base_dn":             sa.searchBaseDN,
-			"search_group_filter": strings.ReplaceAll(sa.searchGroupFilter, "%s", user.DN),
+			"search_group_filter": strings.ReplaceAll(sa.searchGroupFilter, "%s", ldap.EscapeFilter(user.DN)),
 			"timeout":             server.Timeout,
 		}
-		if err := sa.searchGroups(ldapConnection, searchGroupRequest, userRoles); err != nil {
+		if err := sa.searchGroups(ldapConnection, searchGroupRequest, userGroups); err != nil {
 			sa.logger.Error(
 				"LDAP group search failed, request",
 				zap.String("server", server.Address),
@@ -655,17 +1051,7 @@ func (sa *Authenticator) findUser(ldapConnection *ldap.Conn, server *AuthServer,
 		}
 		if attr.Name == sa.userAttributes.MemberOf {
 			for _, v := range attr.Values {
-				for _, g := range sa.groups {
-					if g.GroupDN != v {
-						continue
-					}
-					for _, role := range g.Roles {
-						if role == "" {
-							continue
-						}
-						userRoles[role] = true
-					}
-				}
+				userGroups[v] = true
 			}
 		}
 		if attr.Name == sa.userAttributes.Email {
@@ -673,6 +1059,33 @@ func (sa *Authenticator) findUser(ldapConnection *ldap.Conn, server *AuthServer,
 		}
 	}
 
+	if sa.nestedGroups != "" {
+		if err := sa.searchNestedGroups(ldapConnection, server, user.DN, userGroups); err != nil {
+			sa.logger.Error(
+				"LDAP nested group search failed",
+				zap.String("server", server.Address),
+				zap.String("user_dn", user.DN),
+				zap.String("method", sa.nestedGroups),
+				zap.Error(err),
+			)
+			return err
+		}
+	}
+
+	for groupDN := range userGroups {
+		for _, g := range sa.groups {
+			if g.GroupDN != groupDN {
+				continue
+			}
+			for _, role := range g.Roles {
+				if role == "" {
+					continue
+				}
+				userRoles[role] = true
+			}
+		}
+	}
+
 	if userFirstName != "" {
 		userFullName = userFirstName
 	}
@@ -714,3 +1127,21 @@ func (sa *Authenticator) findUser(ldapConnection *ldap.Conn, server *AuthServer,
 	r.Response.Code = 200
 	return nil
 }
+
+// encodeUnicodePwd returns the value of the unicodePwd attribute of Active
+// Directory, i.e. the quoted password encoded in UTF-16LE.
+func encodeUnicodePwd(password string) string {
+	codes := utf16.Encode([]rune("\"" + password + "\""))
+	b := make([]byte, len(codes)*2)
+	for i, c := range codes {
+		b[i*2] = byte(c)
+		b[i*2+1] = byte(c >> 8)
+	}
+	return string(b)
+}
+
+// isNetworkError returns true when the error is caused by the connection to
+// the LDAP server, including request timeouts.
+func isNetworkError(err error) bool {
+	return ldap.IsErrorWithCode(err, ldap.ErrorNetwork)
+}
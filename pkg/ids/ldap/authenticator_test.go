@@ -0,0 +1,719 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ldap
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/greenpau/go-authcrunch/internal/tests"
+	"github.com/greenpau/go-authcrunch/pkg/authn/enums/operator"
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/requests"
+	logutil "github.com/greenpau/go-authcrunch/pkg/util/log"
+	"go.uber.org/zap"
+)
+
+const (
+	testBindUsername = "CN=authzsvc,OU=Service Accounts,DC=CONTOSO,DC=COM"
+	testBindPassword = "P@ssW0rd123"
+)
+
+func newTestDirectory() []*testEntry {
+	return []*testEntry{
+		{
+			dn:       testBindUsername,
+			password: testBindPassword,
+			attrs: map[string][]string{
+				"objectClass":    {"user"},
+				"sAMAccountName": {"authzsvc"},
+			},
+		},
+		{
+			dn:       "CN=John Smith,OU=Users,DC=CONTOSO,DC=COM",
+			password: "jsm1th",
+			attrs: map[string][]string{
+				"objectClass":    {"user"},
+				"sAMAccountName": {"jsmith"},
+				"mail":           {"jsmith@contoso.com"},
+				"givenName":      {"John"},
+				"sn":             {"Smith"},
+				"memberOf":       {"CN=Admins,OU=Security,OU=Groups,DC=CONTOSO,DC=COM"},
+			},
+		},
+		{
+			dn:       "CN=Jane Doe (Ops),OU=Users,DC=CONTOSO,DC=COM",
+			password: "jd0e",
+			attrs: map[string][]string{
+				"objectClass":    {"user"},
+				"sAMAccountName": {"jdoe"},
+				"mail":           {"jdoe@contoso.com"},
+				"givenName":      {"Jane"},
+				"sn":             {"Doe"},
+			},
+		},
+		{
+			dn: "CN=Editors,OU=Security,OU=Groups,DC=CONTOSO,DC=COM",
+			attrs: map[string][]string{
+				"objectClass":  {"groupOfUniqueNames"},
+				"uniqueMember": {"CN=Jane Doe (Ops),OU=Users,DC=CONTOSO,DC=COM"},
+			},
+		},
+		{
+			dn: "CN=Staff,OU=Security,OU=Groups,DC=CONTOSO,DC=COM",
+			attrs: map[string][]string{
+				"objectClass":  {"groupOfUniqueNames"},
+				"uniqueMember": {"CN=Editors,OU=Security,OU=Groups,DC=CONTOSO,DC=COM"},
+			},
+		},
+		// The user belongs to the Admins group through the Ops and Site
+		// Operators groups. The Admins group is a member of the Ops group,
+		// closing the loop.
+		{
+			dn:       "CN=Alice Smith,OU=Users,DC=CONTOSO,DC=COM",
+			password: "asm1th",
+			attrs: map[string][]string{
+				"objectClass":    {"user"},
+				"sAMAccountName": {"asmith"},
+				"mail":           {"asmith@contoso.com"},
+				"givenName":      {"Alice"},
+				"sn":             {"Smith"},
+				"memberOf":       {"CN=Ops,OU=Security,OU=Groups,DC=CONTOSO,DC=COM"},
+			},
+		},
+		{
+			dn: "CN=Ops,OU=Security,OU=Groups,DC=CONTOSO,DC=COM",
+			attrs: map[string][]string{
+				"objectClass": {"group"},
+				"member": {
+					"CN=Alice Smith,OU=Users,DC=CONTOSO,DC=COM",
+					"CN=Admins,OU=Security,OU=Groups,DC=CONTOSO,DC=COM",
+				},
+				"memberOf": {"CN=Site Operators,OU=Security,OU=Groups,DC=CONTOSO,DC=COM"},
+			},
+		},
+		{
+			dn: "CN=Site Operators,OU=Security,OU=Groups,DC=CONTOSO,DC=COM",
+			attrs: map[string][]string{
+				"objectClass": {"group"},
+				"member":      {"CN=Ops,OU=Security,OU=Groups,DC=CONTOSO,DC=COM"},
+				"memberOf":    {"CN=Admins,OU=Security,OU=Groups,DC=CONTOSO,DC=COM"},
+			},
+		},
+		{
+			dn: "CN=Admins,OU=Security,OU=Groups,DC=CONTOSO,DC=COM",
+			attrs: map[string][]string{
+				"objectClass": {"group"},
+				"member": {
+					"CN=John Smith,OU=Users,DC=CONTOSO,DC=COM",
+					"CN=Site Operators,OU=Security,OU=Groups,DC=CONTOSO,DC=COM",
+				},
+				"memberOf": {"CN=Ops,OU=Security,OU=Groups,DC=CONTOSO,DC=COM"},
+			},
+		},
+	}
+}
+
+func newTestIdentityStore(t testing.TB, servers []AuthServer, logger *zap.Logger, opts ...func(*Config)) *IdentityStore {
+	cfg := &Config{
+		Name:         "contoso.com",
+		Realm:        "contoso.com",
+		SearchBaseDN: "DC=CONTOSO,DC=COM",
+		Servers:      servers,
+		BindUsername: testBindUsername,
+		BindPassword: testBindPassword,
+		Groups: []UserGroup{
+			{
+				GroupDN: "CN=Admins,OU=Security,OU=Groups,DC=CONTOSO,DC=COM",
+				Roles:   []string{"admin"},
+			},
+			{
+				GroupDN: "CN=Editors,OU=Security,OU=Groups,DC=CONTOSO,DC=COM",
+				Roles:   []string{"editor"},
+			},
+			{
+				GroupDN: "CN=Staff,OU=Security,OU=Groups,DC=CONTOSO,DC=COM",
+				Roles:   []string{"staff"},
+			},
+		},
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	st, err := NewIdentityStore(cfg, logger)
+	if err != nil {
+		t.Fatalf("failed to create identity store: %v", err)
+	}
+	if err := st.Configure(); err != nil {
+		t.Fatalf("failed to configure identity store: %v", err)
+	}
+	t.Cleanup(func() {
+		for _, pool := range st.authenticator.pools {
+			pool.close()
+		}
+	})
+	return st
+}
+
+// getUnusedAddress returns the address of the LDAP server which is down.
+func getUnusedAddress(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	return "ldap://" + addr
+}
+
+func TestAuthenticator(t *testing.T) {
+	testcases := []struct {
+		name     string
+		op       operator.Type
+		username string
+		password string
+		// down is the number of unavailable servers preceding the server.
+		down        int
+		unavailable bool
+		posixGroups bool
+		// skipValidation sends the request directly to the authenticator.
+		skipValidation bool
+		want           map[string]interface{}
+		shouldErr      bool
+		err            error
+	}{
+		{
+			name:     "identify user by username",
+			op:       operator.IdentifyUser,
+			username: "jsmith",
+			want: map[string]interface{}{
+				"username": "jsmith",
+				"email":    "jsmith@contoso.com",
+				"name":     "John Smith",
+				"roles":    []string{"admin"},
+				"code":     200,
+			},
+		},
+		{
+			name:     "identify user by email address",
+			op:       operator.IdentifyUser,
+			username: "jsmith@contoso.com",
+			want: map[string]interface{}{
+				"username": "jsmith",
+				"email":    "jsmith@contoso.com",
+				"name":     "John Smith",
+				"roles":    []string{"admin"},
+				"code":     200,
+			},
+		},
+		{
+			name:        "identify user with posix groups and special characters in dn",
+			op:          operator.IdentifyUser,
+			username:    "jdoe",
+			posixGroups: true,
+			want: map[string]interface{}{
+				"username": "jdoe",
+				"email":    "jdoe@contoso.com",
+				"name":     "Jane Doe",
+				"roles":    []string{"editor"},
+				"code":     200,
+			},
+		},
+		{
+			name:           "identify user with filter wildcard",
+			op:             operator.IdentifyUser,
+			username:       "*",
+			skipValidation: true,
+			want: map[string]interface{}{
+				"username": "nobody",
+				"email":    "nobody@localhost",
+				"name":     "",
+				"roles":    []string(nil),
+				"code":     0,
+			},
+		},
+		{
+			name:     "identify user with failover to second server",
+			op:       operator.IdentifyUser,
+			username: "jsmith",
+			down:     1,
+			want: map[string]interface{}{
+				"username": "jsmith",
+				"email":    "jsmith@contoso.com",
+				"name":     "John Smith",
+				"roles":    []string{"admin"},
+				"code":     200,
+			},
+		},
+		{
+			name:        "identify user with unavailable servers",
+			op:          operator.IdentifyUser,
+			username:    "jsmith",
+			down:        2,
+			unavailable: true,
+			shouldErr:   true,
+			err:         errors.ErrIdentityStoreLdapAuthFailed.WithArgs("LDAP servers are unavailable"),
+		},
+		{
+			name:     "authenticate user",
+			op:       operator.Authenticate,
+			username: "jsmith",
+			password: "jsm1th",
+			want: map[string]interface{}{
+				"username": "jsmith",
+				"email":    "",
+				"name":     "",
+				"roles":    []string(nil),
+				"code":     0,
+			},
+		},
+		{
+			name:      "authenticate user with invalid password",
+			op:        operator.Authenticate,
+			username:  "jsmith",
+			password:  "foobar",
+			shouldErr: true,
+			err: errors.ErrIdentityStoreLdapAuthFailed.WithArgs(
+				`LDAP Result Code 49 "Invalid Credentials": invalid credentials`,
+			),
+		},
+		{
+			name:      "authenticate unknown user",
+			op:        operator.Authenticate,
+			username:  "foobar",
+			password:  "foobar",
+			shouldErr: true,
+			err:       errors.ErrIdentityStoreLdapAuthFailed.WithArgs("user not found"),
+		},
+		{
+			name:     "authenticate user with failover to third server",
+			op:       operator.Authenticate,
+			username: "jsmith",
+			password: "jsm1th",
+			down:     2,
+			want: map[string]interface{}{
+				"username": "jsmith",
+				"email":    "",
+				"name":     "",
+				"roles":    []string(nil),
+				"code":     0,
+			},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			var servers []AuthServer
+			for i := 0; i < tc.down; i++ {
+				servers = append(servers, AuthServer{Address: getUnusedAddress(t), Timeout: 1})
+			}
+			if !tc.unavailable {
+				srv := newTestServer(t, newTestDirectory())
+				servers = append(servers, AuthServer{Address: srv.address(), PosixGroups: tc.posixGroups})
+			}
+			st := newTestIdentityStore(t, servers, logutil.NewLogger())
+
+			r := requests.NewRequest()
+			r.User.Username = tc.username
+			r.User.Password = tc.password
+			var err error
+			if tc.skipValidation {
+				err = st.authenticator.IdentifyUser(r)
+			} else {
+				err = st.Request(tc.op, r)
+			}
+			if tests.EvalErrWithLog(t, err, "request", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			got := map[string]interface{}{
+				"username": r.User.Username,
+				"email":    r.User.Email,
+				"name":     r.User.FullName,
+				"roles":    r.User.Roles,
+				"code":     r.Response.Code,
+			}
+			tests.EvalObjectsWithLog(t, "user", tc.want, got, msgs)
+		})
+	}
+}
+
+func TestAuthenticatorConnectionPool(t *testing.T) {
+	srv := newTestServer(t, newTestDirectory())
+	srv.delay = 5 * time.Millisecond
+	st := newTestIdentityStore(t, []AuthServer{{Address: srv.address(), MaxConnections: 4}}, logutil.NewLogger())
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 32)
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, op := range []operator.Type{operator.IdentifyUser, operator.Authenticate} {
+				r := requests.NewRequest()
+				r.User.Username = "jsmith"
+				r.User.Password = "jsm1th"
+				if err := st.Request(op, r); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The connections are reused, and the pool does not exceed its size.
+	dials, maxOpenConns := srv.stats()
+	got := map[string]interface{}{
+		"dials":          dials,
+		"max_open_conns": maxOpenConns,
+	}
+	want := map[string]interface{}{
+		"dials":          4,
+		"max_open_conns": 4,
+	}
+	tests.EvalObjects(t, "connections", want, got)
+}
+
+func TestAuthenticatorConfigureServers(t *testing.T) {
+	testcases := []struct {
+		name      string
+		server    AuthServer
+		want      []int
+		shouldErr bool
+		err       error
+	}{
+		{
+			name:   "default timeout and max connections",
+			server: AuthServer{Address: "ldaps://localhost"},
+			want:   []int{5, 10},
+		},
+		{
+			name:   "custom timeout and max connections",
+			server: AuthServer{Address: "ldap://localhost", Timeout: 3, MaxConnections: 50},
+			want:   []int{3, 50},
+		},
+		{
+			name:      "max connections exceeding limit",
+			server:    AuthServer{Address: "ldap://localhost", MaxConnections: 101},
+			shouldErr: true,
+			err:       fmt.Errorf("invalid max connections value: 101, must be between 1 and 100"),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			sa := NewAuthenticator()
+			sa.logger = logutil.NewLogger()
+			err := sa.ConfigureServers(&Config{Servers: []AuthServer{tc.server}})
+			if tests.EvalErrWithLog(t, err, "configure", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			got := []int{sa.servers[0].Timeout, sa.servers[0].MaxConnections, cap(sa.pools[0].slots)}
+			tests.EvalObjectsWithLog(t, "server", append(tc.want, tc.want[1]), got, msgs)
+		})
+	}
+}
+
+func TestAuthenticatorNestedGroups(t *testing.T) {
+	testcases := []struct {
+		name         string
+		username     string
+		nestedGroups string
+		maxDepth     int
+		posixGroups  bool
+		want         []string
+		shouldErr    bool
+		err          error
+	}{
+		{
+			name:      "direct memberships only",
+			username:  "asmith",
+			shouldErr: true,
+			err:       errors.ErrIdentityStoreLdapAuthFailed.WithArgs("no matched groups"),
+		},
+		{
+			name:         "nested memberships with in chain matching rule",
+			username:     "asmith",
+			nestedGroups: "in_chain",
+			want:         []string{"admin"},
+		},
+		{
+			name:         "nested memberships with recursive search",
+			username:     "asmith",
+			nestedGroups: "recursive",
+			want:         []string{"admin"},
+		},
+		{
+			name:         "nested memberships with recursive search within depth limit",
+			username:     "asmith",
+			nestedGroups: "recursive",
+			maxDepth:     2,
+			want:         []string{"admin"},
+		},
+		{
+			name:         "nested memberships with recursive search beyond depth limit",
+			username:     "asmith",
+			nestedGroups: "recursive",
+			maxDepth:     1,
+			shouldErr:    true,
+			err:          errors.ErrIdentityStoreLdapAuthFailed.WithArgs("no matched groups"),
+		},
+		{
+			name:         "nested memberships with recursive search of posix groups",
+			username:     "jdoe",
+			nestedGroups: "recursive",
+			posixGroups:  true,
+			want:         []string{"editor", "staff"},
+		},
+		{
+			name:         "direct memberships with in chain matching rule",
+			username:     "jsmith",
+			nestedGroups: "in_chain",
+			want:         []string{"admin"},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			srv := newTestServer(t, newTestDirectory())
+			servers := []AuthServer{{Address: srv.address(), PosixGroups: tc.posixGroups}}
+			st := newTestIdentityStore(t, servers, logutil.NewLogger(), func(cfg *Config) {
+				cfg.NestedGroups = tc.nestedGroups
+				cfg.NestedGroupsMaxDepth = tc.maxDepth
+			})
+			r := requests.NewRequest()
+			r.User.Username = tc.username
+			err := st.Request(operator.IdentifyUser, r)
+			if tests.EvalErrWithLog(t, err, "identify", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			sort.Strings(r.User.Roles)
+			tests.EvalObjectsWithLog(t, "roles", tc.want, r.User.Roles, msgs)
+		})
+	}
+}
+
+func TestAuthenticatorChangePassword(t *testing.T) {
+	testcases := []struct {
+		name           string
+		passwordChange string
+		username       string
+		oldPassword    string
+		password       string
+		shouldErr      bool
+		err            error
+	}{
+		{
+			name:        "change password not configured",
+			username:    "jsmith",
+			oldPassword: "jsm1th",
+			password:    "N3wPassw0rd",
+			shouldErr:   true,
+			err:         errors.ErrOperatorNotAvailable.WithArgs(operator.ChangePassword),
+		},
+		{
+			name:           "change password with password modify extended operation",
+			passwordChange: "password_modify",
+			username:       "jsmith",
+			oldPassword:    "jsm1th",
+			password:       "N3wPassw0rd",
+		},
+		{
+			name:           "change password with unicode pwd attribute",
+			passwordChange: "unicode_pwd",
+			username:       "jsmith@contoso.com",
+			oldPassword:    "jsm1th",
+			password:       "N3wPassw0rd",
+		},
+		{
+			name:           "change password with invalid current password",
+			passwordChange: "password_modify",
+			username:       "jsmith",
+			oldPassword:    "foobar",
+			password:       "N3wPassw0rd",
+			shouldErr:      true,
+			err: errors.ErrIdentityStoreLdapChangePasswordFailed.WithArgs(
+				"LDAP Result Code 49 \"Invalid Credentials\": invalid credentials",
+			),
+		},
+		{
+			name:           "change password of unknown user",
+			passwordChange: "unicode_pwd",
+			username:       "foobar",
+			oldPassword:    "foobar",
+			password:       "N3wPassw0rd",
+			shouldErr:      true,
+			err:            errors.ErrIdentityStoreLdapAuthFailed.WithArgs("user not found"),
+		},
+		{
+			name:           "change password with empty new password",
+			passwordChange: "password_modify",
+			username:       "jsmith",
+			oldPassword:    "jsm1th",
+			shouldErr:      true,
+			err:            errors.ErrIdentityStoreLdapAuthenticateInvalidPassword,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			srv := newTestServer(t, newTestDirectory())
+			st := newTestIdentityStore(t, []AuthServer{{Address: srv.address()}}, logutil.NewLogger(), func(cfg *Config) {
+				cfg.PasswordChange = tc.passwordChange
+			})
+			r := requests.NewRequest()
+			r.User.Username = tc.username
+			r.User.OldPassword = tc.oldPassword
+			r.User.Password = tc.password
+			err := st.Request(operator.ChangePassword, r)
+			if tests.EvalErrWithLog(t, err, "change password", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+
+			// The user authenticates with the new password only, while the
+			// pooled connection remains bound with the service account.
+			for _, password := range []string{tc.oldPassword, tc.password} {
+				r := requests.NewRequest()
+				r.User.Username = tc.username
+				r.User.Password = password
+				err := st.Request(operator.Authenticate, r)
+				msgs := append(msgs, fmt.Sprintf("password: %s", password))
+				if password == tc.oldPassword {
+					tests.EvalErrWithLog(t, err, "authenticate", true, errors.ErrIdentityStoreLdapAuthFailed.WithArgs(
+						"LDAP Result Code 49 \"Invalid Credentials\": invalid credentials",
+					), msgs)
+					continue
+				}
+				tests.EvalErrWithLog(t, err, "authenticate", false, nil, msgs)
+			}
+			r = requests.NewRequest()
+			r.User.Username = tc.username
+			tests.EvalErrWithLog(t, st.Request(operator.IdentifyUser, r), "identify", false, nil, msgs)
+		})
+	}
+}
+
+func TestAuthenticatorConfigureNestedGroups(t *testing.T) {
+	testcases := []struct {
+		name      string
+		config    *Config
+		want      map[string]interface{}
+		shouldErr bool
+		err       error
+	}{
+		{
+			name:   "default max depth",
+			config: &Config{NestedGroups: "recursive"},
+			want: map[string]interface{}{
+				"method":    "recursive",
+				"max_depth": 8,
+			},
+		},
+		{
+			name:      "unsupported method",
+			config:    &Config{NestedGroups: "token_groups"},
+			shouldErr: true,
+			err:       fmt.Errorf("unsupported nested groups method: token_groups"),
+		},
+		{
+			name:   "in chain method",
+			config: &Config{NestedGroups: "in_chain"},
+			want: map[string]interface{}{
+				"method":    "in_chain",
+				"max_depth": 0,
+			},
+		},
+		{
+			name:      "max depth with in chain method",
+			config:    &Config{NestedGroups: "in_chain", NestedGroupsMaxDepth: 4},
+			shouldErr: true,
+			err:       fmt.Errorf("nested groups max depth requires recursive nested groups method"),
+		},
+		{
+			name:      "max depth without nested groups method",
+			config:    &Config{NestedGroupsMaxDepth: 4},
+			shouldErr: true,
+			err:       fmt.Errorf("nested groups max depth requires recursive nested groups method"),
+		},
+		{
+			name:      "max depth exceeding limit",
+			config:    &Config{NestedGroups: "recursive", NestedGroupsMaxDepth: 33},
+			shouldErr: true,
+			err:       fmt.Errorf("invalid nested groups max depth value: 33, must be between 1 and 32"),
+		},
+		{
+			name:      "unsupported password change method",
+			config:    &Config{PasswordChange: "kpasswd"},
+			shouldErr: true,
+			err:       fmt.Errorf("unsupported password change method: kpasswd"),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			sa := NewAuthenticator()
+			sa.logger = logutil.NewLogger()
+			tc.config.Groups = []UserGroup{{GroupDN: "CN=Admins,DC=CONTOSO,DC=COM", Roles: []string{"admin"}}}
+			err := sa.ConfigureUserGroups(tc.config)
+			if err == nil {
+				err = sa.ConfigurePasswordChange(tc.config)
+			}
+			if tests.EvalErrWithLog(t, err, "configure", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			got := map[string]interface{}{
+				"method":    sa.nestedGroups,
+				"max_depth": sa.nestedGroupsDepth,
+			}
+			tests.EvalObjectsWithLog(t, "nested groups", tc.want, got, msgs)
+		})
+	}
+}
+
+// BenchmarkAuthenticatorParallel measures the throughput of parallel logins,
+// i.e. user identification followed by password authentication, against
+// the LDAP server with 1ms latency, using connection pools of different
+// sizes.
+func BenchmarkAuthenticatorParallel(b *testing.B) {
+	for _, n := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("max_connections_%d", n), func(b *testing.B) {
+			srv := newTestServer(b, newTestDirectory())
+			srv.delay = time.Millisecond
+			st := newTestIdentityStore(b, []AuthServer{{Address: srv.address(), MaxConnections: n}}, zap.NewNop())
+			b.SetParallelism(4)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					for _, op := range []operator.Type{operator.IdentifyUser, operator.Authenticate} {
+						r := requests.NewRequest()
+						r.User.Username = "jsmith"
+						r.User.Password = "jsm1th"
+						if err := st.Request(op, r); err != nil {
+							b.Fatalf("unexpected error: %v", err)
+						}
+					}
+				}
+			})
+		})
+	}
+}
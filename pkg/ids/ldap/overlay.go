@@ -0,0 +1,176 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ldap
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+
+	"github.com/greenpau/go-authcrunch/pkg/authn/enums/operator"
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/identity"
+	"github.com/greenpau/go-authcrunch/pkg/requests"
+	"github.com/greenpau/go-authcrunch/pkg/util"
+	"go.uber.org/zap"
+)
+
+// overlay is the local database holding the MFA tokens, API keys, and SSH
+// and GPG keys of LDAP users. The users are keyed by the anchor of their
+// directory entries, i.e. objectGUID, entryUUID or distinguished name, so
+// that the records are not inherited by the users taking over the username
+// or email address of deleted users. The users are added to the database
+// upon first use. Their passwords are random and never used, because the
+// users authenticate with the directory.
+type overlay struct {
+	mu     sync.Mutex
+	db     *identity.Database
+	logger *zap.Logger
+}
+
+const (
+	// overlayUsernameMaxLength is the maximum length of the usernames of
+	// the overlay users, allowing the distinguished names as anchors.
+	overlayUsernameMaxLength = 1024
+	// overlayEmailDomain is the domain of the email addresses of the
+	// overlay users.
+	overlayEmailDomain = "overlay.localhost"
+)
+
+func newOverlay(fp, storage string, logger *zap.Logger) (*overlay, error) {
+	if storage == "" {
+		storage = identity.StorageKindJSON
+	}
+	db, err := identity.NewDatabaseWithStorage(fp, storage)
+	if err != nil {
+		return nil, err
+	}
+	db.Policy.User.MaxLength = overlayUsernameMaxLength
+	return &overlay{db: db, logger: logger}, nil
+}
+
+// getOverlayIdentity returns the username and email address of the overlay
+// user of the directory entry with the anchor.
+func getOverlayIdentity(anchor string) (string, string) {
+	sum := sha256.Sum256([]byte(anchor))
+	return anchor, hex.EncodeToString(sum[:16]) + "@" + overlayEmailDomain
+}
+
+// Request performs the requested operation on behalf of the LDAP user with
+// the directory entry anchor.
+func (o *overlay) Request(op operator.Type, anchor string, r *requests.Request) error {
+	username, email := r.User.Username, r.User.Email
+	r.User.Username, r.User.Email = getOverlayIdentity(anchor)
+	defer func() {
+		r.User.Username, r.User.Email = username, email
+	}()
+	if err := o.addUser(r, username); err != nil {
+		return err
+	}
+	switch op {
+	case operator.AddKeySSH, operator.AddKeyGPG:
+		return o.db.AddPublicKey(r)
+	case operator.DeletePublicKey:
+		return o.db.DeletePublicKey(r)
+	case operator.GetPublicKeys:
+		return o.db.GetPublicKeys(r)
+	case operator.GetPublicKey:
+		return o.db.GetPublicKey(r)
+	case operator.AddMfaToken:
+		return o.db.AddMfaToken(r)
+	case operator.DeleteMfaToken:
+		return o.db.DeleteMfaToken(r)
+	case operator.GetMfaTokens:
+		return o.db.GetMfaTokens(r)
+	case operator.GetMfaToken:
+		return o.db.GetMfaToken(r)
+	case operator.AddAPIKey:
+		return o.db.AddAPIKey(r)
+	case operator.DeleteAPIKey:
+		return o.db.DeleteAPIKey(r)
+	case operator.GetAPIKeys:
+		return o.db.GetAPIKeys(r)
+	case operator.GetAPIKey:
+		return o.db.GetAPIKey(r)
+	}
+	return errors.ErrOperatorNotSupported.WithArgs(op)
+}
+
+// lookupAPIKey returns the directory entry anchor of the user with the API
+// key.
+func (o *overlay) lookupAPIKey(r *requests.Request) (string, error) {
+	if err := o.db.LookupAPIKey(r); err != nil {
+		return "", err
+	}
+	anchor := r.User.Username
+	r.User.Username, r.User.Email = "", ""
+	return anchor, nil
+}
+
+// addUser adds the overlay user to the database, unless the user exists.
+func (o *overlay) addUser(r *requests.Request, username string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	exists, err := o.db.UserExists(r.User.Username, r.User.Email)
+	if err != nil {
+		return errors.ErrIdentityStoreLdapOverlayUser.WithArgs(username, err)
+	}
+	if exists {
+		return nil
+	}
+	req := &requests.Request{
+		User: requests.User{
+			Username: r.User.Username,
+			Email:    r.User.Email,
+			// The password satisfies the password policies requiring
+			// character classes.
+			Password: util.GetRandomString(64) + "Aa1!",
+		},
+	}
+	if err := o.db.AddUser(req); err != nil {
+		return errors.ErrIdentityStoreLdapOverlayUser.WithArgs(username, err)
+	}
+	o.logger.Debug(
+		"added LDAP user to overlay database",
+		zap.String("username", username),
+		zap.String("anchor", r.User.Username),
+	)
+	return nil
+}
+
+// getChallenges returns the challenges of the user with the directory entry
+// anchor, other than password, e.g. mfa when the user has MFA tokens.
+func (o *overlay) getChallenges(anchor string) []string {
+	// The user is identified by the email address, because the
+	// distinguished names may contain the @ character.
+	_, email := getOverlayIdentity(anchor)
+	req := &requests.Request{
+		User: requests.User{
+			Username: email,
+		},
+	}
+	if err := o.db.IdentifyUser(req); err != nil || req.Response.Code != 200 {
+		return nil
+	}
+	var challenges []string
+	for _, challenge := range req.User.Challenges {
+		switch challenge {
+		case "password", "password_change":
+			continue
+		}
+		challenges = append(challenges, challenge)
+	}
+	return challenges
+}
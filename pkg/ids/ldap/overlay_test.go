@@ -0,0 +1,379 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ldap
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/greenpau/go-authcrunch/internal/tests"
+	"github.com/greenpau/go-authcrunch/pkg/authn/enums/operator"
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/identity"
+	"github.com/greenpau/go-authcrunch/pkg/requests"
+	logutil "github.com/greenpau/go-authcrunch/pkg/util/log"
+)
+
+// getTestPasscode returns the current six-digit TOTP passcode of the secret.
+func getTestPasscode(secret string) string {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(time.Now().Unix()/30))
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write(buf)
+	sum := mac.Sum(nil)
+	off := sum[len(sum)-1] & 0xf
+	val := binary.BigEndian.Uint32(sum[off:off+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", val%1000000)
+}
+
+func TestOverlay(t *testing.T) {
+	testSecret := "c71ca4c68bc14ec5b4ab8d3c3b63802c"
+	testAPIKey := strings.Repeat("a1B2c3D4", 9)
+
+	srv := newTestServer(t, newTestDirectory())
+	st := newTestIdentityStore(t, []AuthServer{{Address: srv.address()}}, logutil.NewLogger())
+	ov, err := newOverlay(filepath.Join(t.TempDir(), "overlay.json"), "", st.logger)
+	if err != nil {
+		t.Fatalf("failed to create overlay: %v", err)
+	}
+	t.Cleanup(func() { ov.db.Close() })
+	st.overlay = ov
+
+	testcases := []struct {
+		name      string
+		op        operator.Type
+		req       *requests.Request
+		want      map[string]interface{}
+		shouldErr bool
+		err       error
+	}{
+		{
+			name: "identify user without mfa tokens",
+			op:   operator.IdentifyUser,
+			req: &requests.Request{
+				User: requests.User{Username: "jsmith"},
+			},
+			want: map[string]interface{}{
+				"username":   "jsmith",
+				"email":      "jsmith@contoso.com",
+				"challenges": []string{"password"},
+				"code":       200,
+			},
+		},
+		{
+			name: "add mfa token for user unknown to overlay",
+			op:   operator.AddMfaToken,
+			req: &requests.Request{
+				User: requests.User{Username: "jsmith", Email: "jsmith@contoso.com"},
+				MfaToken: requests.MfaToken{
+					Comment:   "ms auth app",
+					Type:      "totp",
+					Secret:    testSecret,
+					Algorithm: "sha1",
+					Period:    30,
+					Digits:    6,
+					Passcode:  getTestPasscode(testSecret),
+				},
+			},
+			want: map[string]interface{}{
+				"username":   "jsmith",
+				"email":      "jsmith@contoso.com",
+				"challenges": []string(nil),
+				"code":       0,
+			},
+		},
+		{
+			name: "get mfa tokens",
+			op:   operator.GetMfaTokens,
+			req: &requests.Request{
+				User: requests.User{Username: "jsmith", Email: "jsmith@contoso.com"},
+			},
+			want: map[string]interface{}{
+				"username":   "jsmith",
+				"email":      "jsmith@contoso.com",
+				"challenges": []string(nil),
+				"code":       0,
+				"tokens":     1,
+			},
+		},
+		{
+			name: "identify user with mfa tokens",
+			op:   operator.IdentifyUser,
+			req: &requests.Request{
+				User: requests.User{Username: "jsmith"},
+			},
+			want: map[string]interface{}{
+				"username":   "jsmith",
+				"email":      "jsmith@contoso.com",
+				"challenges": []string{"password", "mfa"},
+				"code":       200,
+			},
+		},
+		{
+			name: "add api key",
+			op:   operator.AddAPIKey,
+			req: &requests.Request{
+				User: requests.User{Username: "jsmith", Email: "jsmith@contoso.com"},
+				Key: requests.Key{
+					Usage:   "api",
+					Comment: "ci",
+					Payload: testAPIKey,
+				},
+			},
+			want: map[string]interface{}{
+				"username":   "jsmith",
+				"email":      "jsmith@contoso.com",
+				"challenges": []string(nil),
+				"code":       0,
+			},
+		},
+		{
+			name: "lookup api key",
+			op:   operator.LookupAPIKey,
+			req: &requests.Request{
+				Key: requests.Key{Payload: testAPIKey},
+			},
+			want: map[string]interface{}{
+				"username":   "jsmith",
+				"email":      "jsmith@contoso.com",
+				"challenges": []string{"password"},
+				"code":       200,
+			},
+		},
+		{
+			name: "lookup unknown api key",
+			op:   operator.LookupAPIKey,
+			req: &requests.Request{
+				Key: requests.Key{Payload: strings.Repeat("z9Y8x7W6", 9)},
+			},
+			shouldErr: true,
+			err:       errors.ErrLookupAPIKeyFailed,
+		},
+		{
+			name: "get mfa tokens for user with mismatched email",
+			op:   operator.GetMfaTokens,
+			req: &requests.Request{
+				User: requests.User{Username: "jsmith", Email: "john.smith@contoso.com"},
+			},
+			shouldErr: true,
+			err:       errors.ErrIdentityStoreLdapUserMismatch.WithArgs("jsmith"),
+		},
+		{
+			name: "get mfa tokens for unknown user",
+			op:   operator.GetMfaTokens,
+			req: &requests.Request{
+				User: requests.User{Username: "jdoe2", Email: "jdoe2@contoso.com"},
+			},
+			shouldErr: true,
+			err:       errors.ErrIdentityStoreLdapAuthFailed.WithArgs("user not found"),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			err := st.Request(tc.op, tc.req)
+			if tests.EvalErrWithLog(t, err, "request", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			got := map[string]interface{}{
+				"username":   tc.req.User.Username,
+				"email":      tc.req.User.Email,
+				"challenges": tc.req.User.Challenges,
+				"code":       tc.req.Response.Code,
+			}
+			if bundle, ok := tc.req.Response.Payload.(*identity.MfaTokenBundle); ok {
+				got["tokens"] = bundle.Size()
+			}
+			tests.EvalObjectsWithLog(t, "response", tc.want, got, msgs)
+		})
+	}
+}
+
+func TestOverlayLookupAPIKey(t *testing.T) {
+	testAPIKey := strings.Repeat("a1B2c3D4", 9)
+	testGUID := "\x1d\x8e\x27\x44\x0f\x3a\x4b\x4c\x9e\x55\x12\x6a\x80\x01\xfe\x7b"
+
+	testcases := []struct {
+		name      string
+		attrs     map[string][]string
+		change    func(*testServer, *testEntry)
+		want      map[string]interface{}
+		shouldErr bool
+		err       error
+	}{
+		{
+			name:  "user with objectGUID",
+			attrs: map[string][]string{"objectGUID": {testGUID}},
+			want: map[string]interface{}{
+				"username": "jsmith",
+				"email":    "jsmith@contoso.com",
+				"roles":    []string{"admin"},
+			},
+		},
+		{
+			name:  "moved user with objectGUID",
+			attrs: map[string][]string{"objectGUID": {testGUID}},
+			change: func(srv *testServer, entry *testEntry) {
+				entry.dn = "CN=John Smith,OU=Former Users,DC=CONTOSO,DC=COM"
+			},
+			want: map[string]interface{}{
+				"username": "jsmith",
+				"email":    "jsmith@contoso.com",
+				"roles":    []string{"admin"},
+			},
+		},
+		{
+			name:  "user with entryUUID",
+			attrs: map[string][]string{"entryUUID": {"6f1c0b1e-2d4a-4e8b-9a53-0c2f5e7d1a44"}},
+			want: map[string]interface{}{
+				"username": "jsmith",
+				"email":    "jsmith@contoso.com",
+				"roles":    []string{"admin"},
+			},
+		},
+		{
+			name: "user with distinguished name",
+			want: map[string]interface{}{
+				"username": "jsmith",
+				"email":    "jsmith@contoso.com",
+				"roles":    []string{"admin"},
+			},
+		},
+		{
+			name:  "deleted user",
+			attrs: map[string][]string{"objectGUID": {testGUID}},
+			change: func(srv *testServer, entry *testEntry) {
+				for i, e := range srv.entries {
+					if e == entry {
+						srv.entries = append(srv.entries[:i], srv.entries[i+1:]...)
+						break
+					}
+				}
+			},
+			shouldErr: true,
+			err:       errors.ErrLookupAPIKeyFailed,
+		},
+		{
+			name: "deleted user with distinguished name",
+			change: func(srv *testServer, entry *testEntry) {
+				entry.dn = "CN=John Smith,OU=Former Users,DC=CONTOSO,DC=COM"
+			},
+			shouldErr: true,
+			err:       errors.ErrLookupAPIKeyFailed,
+		},
+		{
+			name:  "recreated user",
+			attrs: map[string][]string{"objectGUID": {testGUID}},
+			change: func(srv *testServer, entry *testEntry) {
+				entry.attrs["objectGUID"] = []string{strings.Repeat("\x42", 16)}
+			},
+			shouldErr: true,
+			err:       errors.ErrLookupAPIKeyFailed,
+		},
+		{
+			name:  "disabled active directory user",
+			attrs: map[string][]string{"objectGUID": {testGUID}},
+			change: func(srv *testServer, entry *testEntry) {
+				entry.attrs["userAccountControl"] = []string{"514"}
+			},
+			shouldErr: true,
+			err:       errors.ErrLookupAPIKeyFailed,
+		},
+		{
+			name:  "locked 389 directory server user",
+			attrs: map[string][]string{"entryUUID": {"6f1c0b1e-2d4a-4e8b-9a53-0c2f5e7d1a44"}},
+			change: func(srv *testServer, entry *testEntry) {
+				entry.attrs["nsAccountLock"] = []string{"TRUE"}
+			},
+			shouldErr: true,
+			err:       errors.ErrLookupAPIKeyFailed,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			entries := newTestDirectory()
+			var entry *testEntry
+			for _, e := range entries {
+				if e.dn == "CN=John Smith,OU=Users,DC=CONTOSO,DC=COM" {
+					entry = e
+				}
+			}
+			for k, v := range tc.attrs {
+				entry.attrs[k] = v
+			}
+			srv := newTestServer(t, entries)
+			st := newTestIdentityStore(t, []AuthServer{{Address: srv.address()}}, logutil.NewLogger())
+			ov, err := newOverlay(filepath.Join(t.TempDir(), "overlay.json"), "", st.logger)
+			if err != nil {
+				t.Fatalf("failed to create overlay: %v", err)
+			}
+			t.Cleanup(func() { ov.db.Close() })
+			st.overlay = ov
+
+			r := &requests.Request{
+				User: requests.User{Username: "jsmith", Email: "jsmith@contoso.com"},
+				Key:  requests.Key{Usage: "api", Comment: "ci", Payload: testAPIKey},
+			}
+			if err := st.Request(operator.AddAPIKey, r); err != nil {
+				t.Fatalf("failed to add api key: %v", err)
+			}
+			if tc.change != nil {
+				tc.change(srv, entry)
+			}
+
+			r = &requests.Request{
+				Key: requests.Key{Payload: testAPIKey},
+			}
+			err = st.Request(operator.LookupAPIKey, r)
+			if tests.EvalErrWithLog(t, err, "lookup", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			got := map[string]interface{}{
+				"username": r.User.Username,
+				"email":    r.User.Email,
+				"roles":    r.User.Roles,
+			}
+			tests.EvalObjectsWithLog(t, "user", tc.want, got, msgs)
+		})
+	}
+}
+
+func TestOverlayNotConfigured(t *testing.T) {
+	srv := newTestServer(t, newTestDirectory())
+	st := newTestIdentityStore(t, []AuthServer{{Address: srv.address()}}, logutil.NewLogger())
+	for _, op := range []operator.Type{
+		operator.AddMfaToken,
+		operator.GetMfaTokens,
+		operator.AddAPIKey,
+		operator.LookupAPIKey,
+		operator.AddKeySSH,
+		operator.GetPublicKeys,
+	} {
+		t.Run(op.String(), func(t *testing.T) {
+			r := &requests.Request{
+				User: requests.User{Username: "jsmith", Email: "jsmith@contoso.com"},
+			}
+			err := st.Request(op, r)
+			tests.EvalErrWithLog(t, err, "request", true, errors.ErrOperatorNotAvailable.WithArgs(op), nil)
+		})
+	}
+}
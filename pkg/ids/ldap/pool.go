@@ -0,0 +1,135 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ldap
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+const (
+	defaultMaxConnections = 10
+	maxMaxConnections     = 100
+	// maxIdleTime is the time after which idle connections are closed.
+	maxIdleTime = 5 * time.Minute
+	// serverRetryInterval is the time during which the server failing to
+	// accept connections is tried only when other servers are unavailable.
+	serverRetryInterval = 30 * time.Second
+)
+
+// idleConn is the connection waiting in the pool.
+type idleConn struct {
+	conn      *ldap.Conn
+	idleSince time.Time
+}
+
+// connPool is the bounded pool of the connections to an LDAP server. The
+// connections in the pool are bound with the service account credentials.
+type connPool struct {
+	server *AuthServer
+	dial   func(*AuthServer) (*ldap.Conn, error)
+	// slots limits the number of the connections in use.
+	slots     chan struct{}
+	mu        sync.Mutex
+	idle      []*idleConn
+	downUntil time.Time
+}
+
+func newConnPool(server *AuthServer, dial func(*AuthServer) (*ldap.Conn, error)) *connPool {
+	return &connPool{
+		server: server,
+		dial:   dial,
+		slots:  make(chan struct{}, server.MaxConnections),
+	}
+}
+
+// get returns an idle connection or dials a new one. It waits for a free
+// slot up to the timeout of the server.
+func (p *connPool) get() (*ldap.Conn, error) {
+	timer := time.NewTimer(time.Duration(p.server.Timeout) * time.Second)
+	defer timer.Stop()
+	select {
+	case p.slots <- struct{}{}:
+	case <-timer.C:
+		return nil, fmt.Errorf("timed out waiting for connection")
+	}
+
+	var stale []*ldap.Conn
+	var conn *ldap.Conn
+	now := time.Now()
+	p.mu.Lock()
+	for len(p.idle) > 0 && conn == nil {
+		entry := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+		if entry.conn.IsClosing() || now.Sub(entry.idleSince) > maxIdleTime {
+			stale = append(stale, entry.conn)
+			continue
+		}
+		conn = entry.conn
+	}
+	p.mu.Unlock()
+	for _, c := range stale {
+		c.Close()
+	}
+	if conn != nil {
+		return conn, nil
+	}
+
+	conn, err := p.dial(p.server)
+	if err != nil {
+		<-p.slots
+		p.mu.Lock()
+		p.downUntil = time.Now().Add(serverRetryInterval)
+		p.mu.Unlock()
+		return nil, err
+	}
+	p.mu.Lock()
+	p.downUntil = time.Time{}
+	p.mu.Unlock()
+	return conn, nil
+}
+
+// put returns the connection to the pool. The closed connections are
+// discarded.
+func (p *connPool) put(conn *ldap.Conn) {
+	if !conn.IsClosing() {
+		p.mu.Lock()
+		p.idle = append(p.idle, &idleConn{conn: conn, idleSince: time.Now()})
+		p.mu.Unlock()
+	}
+	<-p.slots
+}
+
+// healthy returns false when the server recently failed to accept
+// connections.
+func (p *connPool) healthy() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return time.Now().After(p.downUntil)
+}
+
+// close closes the idle connections.
+func (p *connPool) close() {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.mu.Unlock()
+	for _, entry := range idle {
+		entry.conn.Close()
+	}
+}
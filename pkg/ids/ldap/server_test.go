@@ -0,0 +1,363 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ldap
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+// testEntry is the entry of the directory served by testServer.
+type testEntry struct {
+	dn       string
+	password string
+	attrs    map[string][]string
+}
+
+// testServer is the in-process LDAP server supporting simple bind, search
+// requests with equality, presence, boolean and LDAP_MATCHING_RULE_IN_CHAIN
+// filters, and password changes with the Password Modify extended operation
+// and the modify requests of the unicodePwd attribute.
+type testServer struct {
+	listener net.Listener
+	entries  []*testEntry
+	// delay is the latency added to each request.
+	delay time.Duration
+
+	mu           sync.Mutex
+	conns        map[net.Conn]bool
+	dials        int
+	maxOpenConns int
+}
+
+func newTestServer(t testing.TB, entries []*testEntry) *testServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start test LDAP server: %v", err)
+	}
+	srv := &testServer{
+		listener: listener,
+		entries:  entries,
+		conns:    make(map[net.Conn]bool),
+	}
+	go srv.serve()
+	t.Cleanup(srv.close)
+	return srv
+}
+
+func (srv *testServer) address() string {
+	return "ldap://" + srv.listener.Addr().String()
+}
+
+func (srv *testServer) close() {
+	srv.listener.Close()
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for conn := range srv.conns {
+		conn.Close()
+	}
+}
+
+func (srv *testServer) stats() (int, int) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return srv.dials, srv.maxOpenConns
+}
+
+func (srv *testServer) serve() {
+	for {
+		conn, err := srv.listener.Accept()
+		if err != nil {
+			return
+		}
+		srv.mu.Lock()
+		srv.conns[conn] = true
+		srv.dials++
+		if len(srv.conns) > srv.maxOpenConns {
+			srv.maxOpenConns = len(srv.conns)
+		}
+		srv.mu.Unlock()
+		go srv.handle(conn)
+	}
+}
+
+func (srv *testServer) handle(conn net.Conn) {
+	defer func() {
+		srv.mu.Lock()
+		delete(srv.conns, conn)
+		srv.mu.Unlock()
+		conn.Close()
+	}()
+	var boundDN string
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		msgID := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+		if srv.delay > 0 {
+			time.Sleep(srv.delay)
+		}
+		var responses []*ber.Packet
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			resp := srv.bind(op)
+			boundDN = ""
+			if resp.Children[0].Value.(int64) == ldap.LDAPResultSuccess {
+				boundDN = op.Children[1].Value.(string)
+			}
+			responses = append(responses, resp)
+		case ldap.ApplicationUnbindRequest:
+			return
+		case ldap.ApplicationSearchRequest:
+			responses = srv.search(op)
+		case ldap.ApplicationModifyRequest:
+			responses = append(responses, srv.modify(boundDN, op))
+		case ldap.ApplicationExtendedRequest:
+			responses = append(responses, srv.passwordModify(boundDN, op))
+		default:
+			responses = append(responses, newTestResult(ldap.ApplicationExtendedResponse, ldap.LDAPResultUnwillingToPerform, "unsupported operation"))
+		}
+		for _, resp := range responses {
+			envelope := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+			envelope.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, msgID, "MessageID"))
+			envelope.AppendChild(resp)
+			if _, err := conn.Write(envelope.Bytes()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (srv *testServer) bind(op *ber.Packet) *ber.Packet {
+	dn := op.Children[1].Value.(string)
+	password := op.Children[2].Data.String()
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for _, entry := range srv.entries {
+		if entry.password != "" && strings.EqualFold(entry.dn, dn) && entry.password == password {
+			return newTestResult(ldap.ApplicationBindResponse, ldap.LDAPResultSuccess, "")
+		}
+	}
+	return newTestResult(ldap.ApplicationBindResponse, ldap.LDAPResultInvalidCredentials, "invalid credentials")
+}
+
+// modify handles the password change of the bound user in the unicodePwd
+// attribute, i.e. the deletion of the current password followed by the
+// addition of the new one.
+func (srv *testServer) modify(boundDN string, op *ber.Packet) *ber.Packet {
+	dn := op.Children[0].Value.(string)
+	entry := srv.getEntry(dn)
+	if entry == nil {
+		return newTestResult(ldap.ApplicationModifyResponse, ldap.LDAPResultNoSuchObject, "no such object")
+	}
+	if !strings.EqualFold(boundDN, dn) {
+		return newTestResult(ldap.ApplicationModifyResponse, ldap.LDAPResultInsufficientAccessRights, "insufficient access rights")
+	}
+	var oldPassword, newPassword string
+	for _, change := range op.Children[1].Children {
+		attr := change.Children[1]
+		if !strings.EqualFold(attr.Children[0].Value.(string), "unicodePwd") || len(attr.Children[1].Children) != 1 {
+			return newTestResult(ldap.ApplicationModifyResponse, ldap.LDAPResultUnwillingToPerform, "unsupported modification")
+		}
+		value := attr.Children[1].Children[0].Data.String()
+		switch change.Children[0].Value.(int64) {
+		case ldap.DeleteAttribute:
+			oldPassword = value
+		case ldap.AddAttribute:
+			newPassword = value
+		}
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if oldPassword == "" || newPassword == "" || encodeUnicodePwd(entry.password) != oldPassword {
+		return newTestResult(ldap.ApplicationModifyResponse, ldap.LDAPResultConstraintViolation, "constraint violation")
+	}
+	entry.password = decodeTestUnicodePwd(newPassword)
+	return newTestResult(ldap.ApplicationModifyResponse, ldap.LDAPResultSuccess, "")
+}
+
+// passwordModify handles the Password Modify extended operation changing
+// the password of the bound user.
+func (srv *testServer) passwordModify(boundDN string, op *ber.Packet) *ber.Packet {
+	if len(op.Children) != 2 || op.Children[0].Data.String() != "1.3.6.1.4.1.4203.1.11.1" {
+		return newTestResult(ldap.ApplicationExtendedResponse, ldap.LDAPResultProtocolError, "unsupported extended operation")
+	}
+	var dn, oldPassword, newPassword string
+	for _, child := range ber.DecodePacket(op.Children[1].Data.Bytes()).Children {
+		switch child.Tag {
+		case 0:
+			dn = child.Data.String()
+		case 1:
+			oldPassword = child.Data.String()
+		case 2:
+			newPassword = child.Data.String()
+		}
+	}
+	if dn == "" {
+		dn = boundDN
+	}
+	entry := srv.getEntry(dn)
+	if entry == nil || !strings.EqualFold(boundDN, dn) {
+		return newTestResult(ldap.ApplicationExtendedResponse, ldap.LDAPResultInsufficientAccessRights, "insufficient access rights")
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if oldPassword != entry.password || newPassword == "" {
+		return newTestResult(ldap.ApplicationExtendedResponse, ldap.LDAPResultUnwillingToPerform, "unwilling to perform")
+	}
+	entry.password = newPassword
+	return newTestResult(ldap.ApplicationExtendedResponse, ldap.LDAPResultSuccess, "")
+}
+
+func (srv *testServer) getEntry(dn string) *testEntry {
+	for _, entry := range srv.entries {
+		if strings.EqualFold(entry.dn, dn) {
+			return entry
+		}
+	}
+	return nil
+}
+
+func (srv *testServer) search(op *ber.Packet) []*ber.Packet {
+	baseDN := strings.ToLower(op.Children[0].Value.(string))
+	scope := op.Children[1].Value.(int64)
+	filter := op.Children[6]
+	var responses []*ber.Packet
+	for _, entry := range srv.entries {
+		if !strings.HasSuffix(strings.ToLower(entry.dn), baseDN) || !srv.matchFilter(entry, filter) {
+			continue
+		}
+		if scope == ldap.ScopeBaseObject && strings.ToLower(entry.dn) != baseDN {
+			continue
+		}
+		resp := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+		resp.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.dn, "Object Name"))
+		attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+		for name, values := range entry.attrs {
+			attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+			attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+			set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+			for _, v := range values {
+				set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "Value"))
+			}
+			attr.AppendChild(set)
+			attrs.AppendChild(attr)
+		}
+		resp.AppendChild(attrs)
+		responses = append(responses, resp)
+	}
+	return append(responses, newTestResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess, ""))
+}
+
+func (srv *testServer) matchFilter(entry *testEntry, filter *ber.Packet) bool {
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, child := range filter.Children {
+			if !srv.matchFilter(entry, child) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, child := range filter.Children {
+			if srv.matchFilter(entry, child) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return !srv.matchFilter(entry, filter.Children[0])
+	case ldap.FilterEqualityMatch:
+		name := filter.Children[0].Value.(string)
+		value := filter.Children[1].Value.(string)
+		for _, v := range entry.getValues(name) {
+			if strings.EqualFold(v, value) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterPresent:
+		return len(entry.getValues(filter.Data.String())) > 0
+	case ldap.FilterExtensibleMatch:
+		var rule, name, value string
+		for _, child := range filter.Children {
+			switch child.Tag {
+			case ldap.MatchingRuleAssertionMatchingRule:
+				rule = child.Data.String()
+			case ldap.MatchingRuleAssertionType:
+				name = child.Data.String()
+			case ldap.MatchingRuleAssertionMatchValue:
+				value = child.Data.String()
+			}
+		}
+		if rule != inChainMatchingRule {
+			return false
+		}
+		return srv.matchInChain(entry, name, value, make(map[string]bool))
+	}
+	return false
+}
+
+// matchInChain returns true when the value is one of the values of the
+// attribute of the entry, or of the entries the values refer to.
+func (srv *testServer) matchInChain(entry *testEntry, name, value string, visited map[string]bool) bool {
+	visited[strings.ToLower(entry.dn)] = true
+	for _, v := range entry.getValues(name) {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+		if visited[strings.ToLower(v)] {
+			continue
+		}
+		if child := srv.getEntry(v); child != nil && srv.matchInChain(child, name, value, visited) {
+			return true
+		}
+	}
+	return false
+}
+
+func (entry *testEntry) getValues(name string) []string {
+	for k, values := range entry.attrs {
+		if strings.EqualFold(k, name) {
+			return values
+		}
+	}
+	return nil
+}
+
+func decodeTestUnicodePwd(s string) string {
+	codes := make([]uint16, len(s)/2)
+	for i := range codes {
+		codes[i] = uint16(s[i*2]) | uint16(s[i*2+1])<<8
+	}
+	return strings.Trim(string(utf16.Decode(codes)), "\"")
+}
+
+func newTestResult(tag ber.Tag, code uint16, msg string) *ber.Packet {
+	resp := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Response")
+	resp.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "Result Code"))
+	resp.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	resp.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, msg, "Diagnostic Message"))
+	return resp
+}
@@ -19,6 +19,7 @@ import (
 	"github.com/greenpau/go-authcrunch/pkg/authn/enums/operator"
 	"github.com/greenpau/go-authcrunch/pkg/authn/icons"
 	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/identity"
 	"github.com/greenpau/go-authcrunch/pkg/requests"
 	"go.uber.org/zap"
 	"net/url"
@@ -55,8 +56,10 @@ type Config struct {
 	// RegistrationEnabled controls whether visitors can registers.
 	RegistrationEnabled bool `json:"registration_enabled,omitempty" xml:"registration_enabled,omitempty" yaml:"registration_enabled,omitempty"`
 	// UsernameRecoveryEnabled controls whether a user could recover username by providing an email address.
+	// The recovery is not supported by LDAP identity store, and the configuration with it enabled is rejected.
 	UsernameRecoveryEnabled bool `json:"username_recovery_enabled,omitempty" xml:"username_recovery_enabled,omitempty" yaml:"username_recovery_enabled,omitempty"`
 	// PasswordRecoveryEnabled controls whether a user could recover password by providing an email address.
+	// The recovery is not supported by LDAP identity store, and the configuration with it enabled is rejected.
 	PasswordRecoveryEnabled bool `json:"password_recovery_enabled,omitempty" xml:"password_recovery_enabled,omitempty" yaml:"password_recovery_enabled,omitempty"`
 	// ContactSupportEnabled controls whether contact support link is available.
 	ContactSupportEnabled bool `json:"contact_support_enabled,omitempty" xml:"contact_support_enabled,omitempty" yaml:"contact_support_enabled,omitempty"`
@@ -68,6 +71,32 @@ type Config struct {
 
 	// The roles assigned to a user when no matching LDAP groups found.
 	FallbackRoles []string `json:"fallback_roles,omitempty" xml:"fallback_roles,omitempty" yaml:"fallback_roles,omitempty"`
+
+	// OverlayPath is the path to the local database holding the MFA tokens,
+	// API keys, and SSH and GPG keys of LDAP users. When it is empty, the
+	// users cannot manage the keys and tokens.
+	OverlayPath string `json:"overlay_path,omitempty" xml:"overlay_path,omitempty" yaml:"overlay_path,omitempty"`
+	// OverlayStorage is the storage kind of the overlay database, i.e. json
+	// or bolt. It defaults to json.
+	OverlayStorage string `json:"overlay_storage,omitempty" xml:"overlay_storage,omitempty" yaml:"overlay_storage,omitempty"`
+
+	// NestedGroups is the method of resolving the groups a user belongs to
+	// through other groups. The in_chain method relies on the
+	// LDAP_MATCHING_RULE_IN_CHAIN matching rule of Active Directory, which
+	// resolves the whole chain of memberships regardless of its depth, while
+	// the recursive method follows the group memberships of the groups one
+	// level at a time. By default, only the direct memberships are resolved.
+	NestedGroups string `json:"nested_groups,omitempty" xml:"nested_groups,omitempty" yaml:"nested_groups,omitempty"`
+	// NestedGroupsMaxDepth is the maximum number of levels followed by the
+	// recursive method. It defaults to 8, and is not supported by the
+	// in_chain method.
+	NestedGroupsMaxDepth int `json:"nested_groups_max_depth,omitempty" xml:"nested_groups_max_depth,omitempty" yaml:"nested_groups_max_depth,omitempty"`
+
+	// PasswordChange is the method of changing user passwords in the
+	// directory, i.e. password_modify for the Password Modify extended
+	// operation (RFC 3062), or unicode_pwd for Active Directory. By default,
+	// users cannot change their passwords.
+	PasswordChange string `json:"password_change,omitempty" xml:"password_change,omitempty" yaml:"password_change,omitempty"`
 }
 
 // UserGroup represent the binding between BaseDN and a serarch filter.
@@ -87,6 +116,9 @@ type AuthServer struct {
 	IgnoreCertErrors bool     `json:"ignore_cert_errors,omitempty" xml:"ignore_cert_errors,omitempty" yaml:"ignore_cert_errors,omitempty"`
 	PosixGroups      bool     `json:"posix_groups,omitempty" xml:"posix_groups,omitempty" yaml:"posix_groups,omitempty"`
 	Timeout          int      `json:"timeout,omitempty" xml:"timeout,omitempty" yaml:"timeout,omitempty"`
+	// MaxConnections is the maximum number of concurrent connections to the
+	// server. It defaults to 10.
+	MaxConnections int `json:"max_connections,omitempty" xml:"max_connections,omitempty" yaml:"max_connections,omitempty"`
 }
 
 // UserAttributes represent the mapping of LDAP attributes
@@ -103,6 +135,7 @@ type UserAttributes struct {
 type IdentityStore struct {
 	config        *Config        `json:"-"`
 	authenticator *Authenticator `json:"-"`
+	overlay       *overlay       `json:"-"`
 	logger        *zap.Logger
 	configured    bool
 }
@@ -154,11 +187,50 @@ func (b *IdentityStore) Request(op operator.Type, r *requests.Request) error {
 	case operator.IdentifyUser:
 		return b.IdentifyUser(r)
 	case operator.ChangePassword:
-		return errors.ErrOperatorNotAvailable.WithArgs(op)
+		if b.config.PasswordChange == "" {
+			return errors.ErrOperatorNotAvailable.WithArgs(op)
+		}
+		return b.ChangePassword(r)
+	case operator.AddKeySSH, operator.AddKeyGPG, operator.DeletePublicKey,
+		operator.GetPublicKeys, operator.GetPublicKey,
+		operator.AddMfaToken, operator.DeleteMfaToken, operator.GetMfaTokens, operator.GetMfaToken,
+		operator.AddAPIKey, operator.DeleteAPIKey, operator.GetAPIKeys, operator.GetAPIKey,
+		operator.LookupAPIKey:
+		if b.overlay == nil {
+			return errors.ErrOperatorNotAvailable.WithArgs(op)
+		}
+		if op == operator.LookupAPIKey {
+			return b.LookupAPIKey(r)
+		}
+		anchor, err := b.authenticator.LookupAnchor(r)
+		if err != nil {
+			return err
+		}
+		return b.overlay.Request(op, anchor, r)
 	}
 	return errors.ErrOperatorNotSupported.WithArgs(op)
 }
 
+// LookupAPIKey returns the user with the API key. The user is identified
+// with the directory entry the API key was issued for, and the lookup fails
+// when the entry is not found or the account of the user is disabled.
+func (b *IdentityStore) LookupAPIKey(r *requests.Request) error {
+	anchor, err := b.overlay.lookupAPIKey(r)
+	if err != nil {
+		return err
+	}
+	if err := b.authenticator.LookupUser(anchor, r); err != nil {
+		b.logger.Warn(
+			"LDAP user of API key not found",
+			zap.String("anchor", anchor),
+			zap.Error(err),
+		)
+		r.Response.Code = 0
+		return errors.ErrLookupAPIKeyFailed
+	}
+	return nil
+}
+
 // Authenticate performs authentication.
 func (b *IdentityStore) Authenticate(r *requests.Request) error {
 	if strings.Contains(r.User.Username, "@") {
@@ -176,6 +248,23 @@ func (b *IdentityStore) Authenticate(r *requests.Request) error {
 	return b.authenticator.AuthenticateUser(r)
 }
 
+// ChangePassword changes the password of a user in the directory.
+func (b *IdentityStore) ChangePassword(r *requests.Request) error {
+	if strings.Contains(r.User.Username, "@") {
+		if !emailRegexPattern.MatchString(r.User.Username) {
+			return errors.ErrIdentityStoreLdapAuthenticateInvalidUserEmail
+		}
+	} else {
+		if !usernameRegexPattern.MatchString(r.User.Username) {
+			return errors.ErrIdentityStoreLdapAuthenticateInvalidUsername
+		}
+	}
+	if len(r.User.OldPassword) < 3 || len(r.User.Password) < 3 {
+		return errors.ErrIdentityStoreLdapAuthenticateInvalidPassword
+	}
+	return b.authenticator.ChangePassword(r)
+}
+
 // IdentifyUser  performs user identification.
 func (b *IdentityStore) IdentifyUser(r *requests.Request) error {
 	if strings.Contains(r.User.Username, "@") {
@@ -187,7 +276,14 @@ func (b *IdentityStore) IdentifyUser(r *requests.Request) error {
 			return errors.ErrIdentityStoreLdapAuthenticateInvalidUsername
 		}
 	}
-	return b.authenticator.IdentifyUser(r)
+	user, err := b.authenticator.identifyUser(r)
+	if err != nil {
+		return err
+	}
+	if b.overlay != nil && user != nil && r.Response.Code == 200 {
+		r.User.Challenges = append(r.User.Challenges, b.overlay.getChallenges(getEntryAnchor(user))...)
+	}
+	return nil
 }
 
 // Configure configures IdentityStore.
@@ -228,6 +324,21 @@ func (b *IdentityStore) Configure() error {
 			zap.String("error", err.Error()))
 		return err
 	}
+	if err := b.authenticator.ConfigurePasswordChange(b.config); err != nil {
+		b.logger.Error("failed configuring password change",
+			zap.String("error", err.Error()))
+		return err
+	}
+
+	if b.config.OverlayPath != "" && b.overlay == nil {
+		ov, err := newOverlay(b.config.OverlayPath, b.config.OverlayStorage, b.logger)
+		if err != nil {
+			b.logger.Error("failed configuring overlay database",
+				zap.String("error", err.Error()))
+			return err
+		}
+		b.overlay = ov
+	}
 
 	// Configure UI login icon.
 	if b.config.LoginIcon == nil {
@@ -275,6 +386,19 @@ func (cfg *Config) Validate() error {
 	if cfg.Realm == "" {
 		return errors.ErrIdentityStoreConfigureRealmEmpty
 	}
+	switch cfg.OverlayStorage {
+	case "", identity.StorageKindJSON, identity.StorageKindBolt:
+	default:
+		return errors.ErrIdentityStoreLdapOverlayStorage.WithArgs(cfg.OverlayStorage)
+	}
+	// The recovery looks up users by email address and resets passwords,
+	// which the directory does not support.
+	if cfg.PasswordRecoveryEnabled {
+		return errors.ErrIdentityStoreLdapRecoveryUnsupported.WithArgs("password")
+	}
+	if cfg.UsernameRecoveryEnabled {
+		return errors.ErrIdentityStoreLdapRecoveryUnsupported.WithArgs("username")
+	}
 	return nil
 }
 
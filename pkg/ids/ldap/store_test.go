@@ -142,6 +142,43 @@ func TestNewIdentityStore(t *testing.T) {
 			errPhase:  "initialize",
 			err:       errors.ErrIdentityStoreConfigureRealmEmpty,
 		},
+		{
+			name: "test unsupported overlay storage",
+			config: &Config{
+				Name:           "ldap_store",
+				Realm:          "contoso.com",
+				OverlayPath:    "/tmp/overlay.db",
+				OverlayStorage: "sqlite",
+			},
+			logger:    logutil.NewLogger(),
+			shouldErr: true,
+			errPhase:  "initialize",
+			err:       errors.ErrIdentityStoreLdapOverlayStorage.WithArgs("sqlite"),
+		},
+		{
+			name: "test password recovery",
+			config: &Config{
+				Name:                    "ldap_store",
+				Realm:                   "contoso.com",
+				PasswordRecoveryEnabled: true,
+			},
+			logger:    logutil.NewLogger(),
+			shouldErr: true,
+			errPhase:  "initialize",
+			err:       errors.ErrIdentityStoreLdapRecoveryUnsupported.WithArgs("password"),
+		},
+		{
+			name: "test username recovery",
+			config: &Config{
+				Name:                    "ldap_store",
+				Realm:                   "contoso.com",
+				UsernameRecoveryEnabled: true,
+			},
+			logger:    logutil.NewLogger(),
+			shouldErr: true,
+			errPhase:  "initialize",
+			err:       errors.ErrIdentityStoreLdapRecoveryUnsupported.WithArgs("username"),
+		},
 		{
 			name: "test empty logger",
 			config: &Config{
@@ -15,6 +15,7 @@
 package local
 
 import (
+	"errors"
 	"os"
 	"sync"
 
@@ -30,10 +31,12 @@ const (
 
 // Authenticator represents database connector.
 type Authenticator struct {
-	db     *identity.Database
-	mux    sync.Mutex
-	path   string
-	logger *zap.Logger
+	db      *identity.Database
+	mux     sync.Mutex
+	path    string
+	logger  *zap.Logger
+	watcher *watcher
+	storage string
 }
 
 // NewAuthenticator returns an instance of Authenticator.
@@ -49,10 +52,17 @@ func (sa *Authenticator) Configure(fp string, users []*User) error {
 		"identity store authenticator configuration",
 		zap.String("kind", storeKind),
 		zap.String("db_path", fp),
+		zap.String("db_storage", sa.storage),
 	)
 	sa.path = fp
 
-	db, err := identity.NewDatabase(fp)
+	// The watcher of the previous database exits, i.e. the store starts
+	// another one when watching is enabled.
+	sa.stopWatcher()
+	if sa.db != nil {
+		sa.db.Close()
+	}
+	db, err := identity.NewDatabaseWithStorage(fp, sa.storage)
 	if err != nil {
 		return err
 	}
@@ -81,7 +91,7 @@ func (sa *Authenticator) Configure(fp string, users []*User) error {
 						FullName: user.Name,
 					},
 				}
-				if err := sa.db.AddUser(req); err != nil {
+				if err := sa.db.ImportUser(req); err != nil {
 					return err
 				}
 			} else {
@@ -100,7 +110,15 @@ func (sa *Authenticator) Configure(fp string, users []*User) error {
 						},
 					}
 					if err := sa.db.UpdateUserPassword(req); err != nil {
-						return err
+						var policyErr *identity.PasswordPolicyError
+						if !errors.As(err, &policyErr) || !policyErr.HasRule(identity.PasswordRuleBlockReuse) {
+							return err
+						}
+						sa.logger.Debug(
+							"password for statically-defined identity store user was used previously",
+							zap.String("user", user.Username),
+							zap.String("email", user.EmailAddress),
+						)
 					}
 				}
 			}
@@ -129,7 +147,7 @@ func (sa *Authenticator) Configure(fp string, users []*User) error {
 			req.User.Email = "webadmin@localdomain.local"
 		}
 
-		if err := sa.db.AddUser(req); err != nil {
+		if err := sa.db.ImportUser(req); err != nil {
 			return err
 		}
 		sa.logger.Info("created default admin user for the database",
@@ -141,6 +159,21 @@ func (sa *Authenticator) Configure(fp string, users []*User) error {
 	return nil
 }
 
+// SetLockoutPolicy sets the policy for locking out users following repeated
+// authentication failures.
+func (sa *Authenticator) SetLockoutPolicy(p *identity.LockoutPolicy) {
+	sa.mux.Lock()
+	defer sa.mux.Unlock()
+	sa.db.SetLockoutPolicy(p)
+}
+
+// SetBackupCount sets the number of rotated backups of the database file.
+func (sa *Authenticator) SetBackupCount(n int) error {
+	sa.mux.Lock()
+	defer sa.mux.Unlock()
+	return sa.db.SetBackupCount(n)
+}
+
 // AuthenticateUser checks the database for the presence of a username/email
 // and password and returns user claims.
 func (sa *Authenticator) AuthenticateUser(r *requests.Request) error {
@@ -177,6 +210,48 @@ func (sa *Authenticator) DeleteUser(r *requests.Request) error {
 	return sa.db.DeleteUser(r)
 }
 
+// DisableUser disables a specific user in database.
+func (sa *Authenticator) DisableUser(r *requests.Request) error {
+	sa.mux.Lock()
+	defer sa.mux.Unlock()
+	return sa.db.DisableUser(r)
+}
+
+// EnableUser enables a specific user in database.
+func (sa *Authenticator) EnableUser(r *requests.Request) error {
+	sa.mux.Lock()
+	defer sa.mux.Unlock()
+	return sa.db.EnableUser(r)
+}
+
+// UnlockUser removes the lockout of a specific user in database.
+func (sa *Authenticator) UnlockUser(r *requests.Request) error {
+	sa.mux.Lock()
+	defer sa.mux.Unlock()
+	return sa.db.UnlockUser(r)
+}
+
+// LookupUser finds a user by email address or username in database.
+func (sa *Authenticator) LookupUser(r *requests.Request) error {
+	sa.mux.Lock()
+	defer sa.mux.Unlock()
+	return sa.db.LookupUser(r)
+}
+
+// ResetPassword resets the password of a user in database.
+func (sa *Authenticator) ResetPassword(r *requests.Request) error {
+	sa.mux.Lock()
+	defer sa.mux.Unlock()
+	return sa.db.ResetUserPassword(r)
+}
+
+// UpdateUserRoles replaces the roles of a specific user in database.
+func (sa *Authenticator) UpdateUserRoles(r *requests.Request) error {
+	sa.mux.Lock()
+	defer sa.mux.Unlock()
+	return sa.db.UpdateUserRoles(r)
+}
+
 // ChangePassword changes password for a user.
 func (sa *Authenticator) ChangePassword(r *requests.Request) error {
 	sa.mux.Lock()
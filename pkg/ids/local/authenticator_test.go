@@ -239,3 +239,50 @@ func TestNewAuthenticator(t *testing.T) {
 		})
 	}
 }
+
+func TestConfigureStaticUsers(t *testing.T) {
+	db, err := testutils.CreateEmptyTestDatabase("TestConfigureStaticUsers")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	users := []*User{
+		{
+			Username:                 "webadmin",
+			EmailAddress:             "webadmin@localdomain.local",
+			Password:                 "Foo.Bar-456-Static",
+			Roles:                    []string{"authp/admin"},
+			PasswordOverwriteEnabled: true,
+		},
+	}
+
+	// The restarts with the unchanged password of a statically-defined user
+	// leave the database intact.
+	b := NewAuthenticator()
+	b.logger = logutil.NewLogger()
+	var revisions []uint64
+	for i := 0; i < 3; i++ {
+		if err := b.Configure(db.GetPath(), users); err != nil {
+			t.Fatal(err)
+		}
+		revisions = append(revisions, b.db.GetRevision())
+	}
+	tests.EvalObjectsWithLog(t, "revisions", []uint64{revisions[0], revisions[0], revisions[0]}, revisions, []string{})
+
+	// The changed password is updated.
+	users[0].Password = "Foo.Bar-789-Static"
+	if err := b.Configure(db.GetPath(), users); err != nil {
+		t.Fatal(err)
+	}
+	req := &requests.Request{
+		User: requests.User{
+			Username: "webadmin",
+			Password: "Foo.Bar-789-Static",
+		},
+	}
+	if err := b.AuthenticateUser(req); err != nil {
+		t.Fatal(err)
+	}
+	if b.db.GetRevision() == revisions[0] {
+		t.Fatalf("expected revision change on password update")
+	}
+}
@@ -16,10 +16,12 @@ package local
 
 import (
 	"encoding/json"
+	"time"
 
 	"github.com/greenpau/go-authcrunch/pkg/authn/enums/operator"
 	"github.com/greenpau/go-authcrunch/pkg/authn/icons"
 	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/identity"
 	"github.com/greenpau/go-authcrunch/pkg/requests"
 	"go.uber.org/zap"
 )
@@ -35,6 +37,21 @@ type Config struct {
 	Path  string  `json:"path,omitempty" xml:"path,omitempty" yaml:"path,omitempty"`
 	Users []*User `json:"users,omitempty" xml:"users,omitempty" yaml:"users,omitempty"`
 
+	// Lockout is the policy for locking out users following repeated
+	// authentication failures.
+	Lockout *identity.LockoutPolicy `json:"lockout,omitempty" xml:"lockout,omitempty" yaml:"lockout,omitempty"`
+
+	// Storage is the kind of the database storage, i.e. json (default) or
+	// bolt.
+	Storage string `json:"storage,omitempty" xml:"storage,omitempty" yaml:"storage,omitempty"`
+	// BackupCount is the number of rotated backups of the database file
+	// kept on each write, i.e. <path>.1 through <path>.N.
+	BackupCount int `json:"backup_count,omitempty" xml:"backup_count,omitempty" yaml:"backup_count,omitempty"`
+	// WatchInterval is the interval (in seconds) at which the database file
+	// is checked for changes made by other writers. When the file changes,
+	// the database is reloaded. Zero disables the watcher.
+	WatchInterval int `json:"watch_interval,omitempty" xml:"watch_interval,omitempty" yaml:"watch_interval,omitempty"`
+
 	// LoginIcon is the UI login icon attributes.
 	LoginIcon *icons.LoginIcon `json:"login_icon,omitempty" xml:"login_icon,omitempty" yaml:"login_icon,omitempty"`
 
@@ -149,6 +166,18 @@ func (b *IdentityStore) Request(op operator.Type, r *requests.Request) error {
 		return b.authenticator.GetUser(r)
 	case operator.DeleteUser:
 		return b.authenticator.DeleteUser(r)
+	case operator.DisableUser:
+		return b.authenticator.DisableUser(r)
+	case operator.EnableUser:
+		return b.authenticator.EnableUser(r)
+	case operator.UpdateUserRoles:
+		return b.authenticator.UpdateUserRoles(r)
+	case operator.UnlockUser:
+		return b.authenticator.UnlockUser(r)
+	case operator.LookupUser:
+		return b.authenticator.LookupUser(r)
+	case operator.ResetPassword:
+		return b.authenticator.ResetPassword(r)
 	case operator.LookupAPIKey:
 		return b.authenticator.LookupAPIKey(r)
 	}
@@ -167,16 +196,27 @@ func (b *IdentityStore) Configure() error {
 		b.authenticator = NewAuthenticator()
 	}
 	b.authenticator.logger = b.logger
+	b.authenticator.storage = b.config.Storage
 
 	if err := b.authenticator.Configure(b.config.Path, b.config.Users); err != nil {
 		return err
 	}
+	b.authenticator.SetLockoutPolicy(b.config.Lockout)
+	if err := b.authenticator.SetBackupCount(b.config.BackupCount); err != nil {
+		return err
+	}
+	if b.config.WatchInterval > 0 {
+		b.authenticator.StartWatcher(time.Duration(b.config.WatchInterval) * time.Second)
+	}
 
 	b.logger.Info(
 		"successfully configured identity store",
 		zap.String("name", b.config.Name),
 		zap.String("kind", storeKind),
 		zap.String("db_path", b.config.Path),
+		zap.String("db_storage", b.authenticator.db.GetStorageKind()),
+		zap.Int("backup_count", b.config.BackupCount),
+		zap.Int("watch_interval", b.config.WatchInterval),
 		zap.Any("login_icon", b.config.LoginIcon),
 	)
 
@@ -184,6 +224,15 @@ func (b *IdentityStore) Configure() error {
 	return nil
 }
 
+// Stop stops watching the database file of IdentityStore, e.g. when the
+// configuration of the store is replaced.
+func (b *IdentityStore) Stop() {
+	if b.authenticator == nil {
+		return
+	}
+	b.authenticator.StopWatcher()
+}
+
 // GetConfig returns IdentityStore configuration.
 func (b *IdentityStore) GetConfig() map[string]interface{} {
 	var m map[string]interface{}
@@ -211,6 +260,22 @@ func (cfg *Config) Validate() error {
 	if cfg.Path == "" {
 		return errors.ErrIdentityStoreLocalConfigurePathEmpty
 	}
+	if cfg.Lockout != nil {
+		if err := cfg.Lockout.Validate(); err != nil {
+			return errors.ErrIdentityStoreLocalConfigureLockoutPolicy.WithArgs(err)
+		}
+	}
+	switch cfg.Storage {
+	case "", identity.StorageKindJSON, identity.StorageKindBolt:
+	default:
+		return errors.ErrIdentityStoreLocalConfigureStorage.WithArgs(cfg.Storage)
+	}
+	if cfg.BackupCount < 0 {
+		return errors.ErrIdentityStoreLocalConfigureBackupCount.WithArgs(cfg.BackupCount)
+	}
+	if cfg.WatchInterval < 0 {
+		return errors.ErrIdentityStoreLocalConfigureWatchInterval.WithArgs(cfg.WatchInterval)
+	}
 	return nil
 }
 
@@ -24,6 +24,7 @@ import (
 	"github.com/greenpau/go-authcrunch/internal/testutils"
 	"github.com/greenpau/go-authcrunch/pkg/authn/enums/operator"
 	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/identity"
 	"github.com/greenpau/go-authcrunch/pkg/requests"
 	logutil "github.com/greenpau/go-authcrunch/pkg/util/log"
 	"go.uber.org/zap"
@@ -148,6 +149,20 @@ func TestNewIdentityStore(t *testing.T) {
 			shouldErr: true,
 			err:       errors.ErrIdentityStoreLocalConfigurePathEmpty,
 		},
+		{
+			name: "test invalid lockout policy",
+			config: &Config{
+				Name:  "local_store",
+				Realm: "local",
+				Path:  filepath.Join(path.Dir(dbPath), "user_db1.json"),
+				Lockout: &identity.LockoutPolicy{
+					MaxAttempts: -1,
+				},
+			},
+			logger:    logutil.NewLogger(),
+			shouldErr: true,
+			err:       errors.ErrIdentityStoreLocalConfigureLockoutPolicy.WithArgs("max attempts must not be negative"),
+		},
 		{
 			name: "test empty logger",
 			config: &Config{
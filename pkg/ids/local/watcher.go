@@ -0,0 +1,143 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// watcher polls the database file and reloads the database when the
+// modification time or the size of the file changes.
+type watcher struct {
+	path     string
+	interval time.Duration
+	modTime  time.Time
+	size     int64
+	exit     chan bool
+	done     chan bool
+}
+
+// newWatcher returns an instance of watcher for the database file.
+func newWatcher(fp string, interval time.Duration) *watcher {
+	w := &watcher{
+		path:     fp,
+		interval: interval,
+		exit:     make(chan bool),
+		done:     make(chan bool),
+	}
+	if fileInfo, err := os.Stat(fp); err == nil {
+		w.modTime = fileInfo.ModTime()
+		w.size = fileInfo.Size()
+	}
+	return w
+}
+
+// StartWatcher starts watching the database file for changes made by other
+// writers. The file is checked at the provided interval.
+func (sa *Authenticator) StartWatcher(interval time.Duration) {
+	sa.StopWatcher()
+	sa.mux.Lock()
+	defer sa.mux.Unlock()
+	w := newWatcher(sa.path, interval)
+	sa.watcher = w
+	go sa.watch(w)
+}
+
+// StopWatcher stops watching the database file. It returns after the
+// watcher exits.
+func (sa *Authenticator) StopWatcher() {
+	sa.mux.Lock()
+	done := sa.stopWatcher()
+	sa.mux.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+// stopWatcher signals the watcher to exit and returns the channel closed
+// on the exit. The caller must hold the lock.
+func (sa *Authenticator) stopWatcher() chan bool {
+	if sa.watcher == nil {
+		return nil
+	}
+	w := sa.watcher
+	close(w.exit)
+	sa.watcher = nil
+	return w.done
+}
+
+func (sa *Authenticator) watch(w *watcher) {
+	defer close(w.done)
+	intervals := time.NewTicker(w.interval)
+	defer intervals.Stop()
+	for {
+		select {
+		case <-w.exit:
+			return
+		case <-intervals.C:
+		}
+		if !sa.poll(w) {
+			return
+		}
+	}
+}
+
+// poll reloads the database when the file changed since the last poll. It
+// returns false when the watcher was stopped, e.g. when the database was
+// reconfigured.
+func (sa *Authenticator) poll(w *watcher) bool {
+	fileInfo, err := os.Stat(w.path)
+	if err != nil {
+		return true
+	}
+	if fileInfo.ModTime().Equal(w.modTime) && fileInfo.Size() == w.size {
+		return true
+	}
+	w.modTime = fileInfo.ModTime()
+	w.size = fileInfo.Size()
+
+	sa.mux.Lock()
+	if sa.watcher != w {
+		sa.mux.Unlock()
+		return false
+	}
+	reloaded, err := sa.db.Reload()
+	revision := sa.db.GetRevision()
+	sa.mux.Unlock()
+	if sa.logger == nil {
+		return true
+	}
+	if err != nil {
+		sa.logger.Error(
+			"failed reloading identity store database",
+			zap.String("kind", storeKind),
+			zap.String("db_path", w.path),
+			zap.Error(err),
+		)
+		return true
+	}
+	if reloaded {
+		sa.logger.Info(
+			"reloaded identity store database",
+			zap.String("kind", storeKind),
+			zap.String("db_path", w.path),
+			zap.Uint64("revision", revision),
+		)
+	}
+	return true
+}
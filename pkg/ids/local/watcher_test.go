@@ -0,0 +1,123 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"testing"
+	"time"
+
+	"github.com/greenpau/go-authcrunch/internal/testutils"
+	"github.com/greenpau/go-authcrunch/pkg/identity"
+	"github.com/greenpau/go-authcrunch/pkg/requests"
+	logutil "github.com/greenpau/go-authcrunch/pkg/util/log"
+)
+
+func TestAuthenticatorWatcher(t *testing.T) {
+	db, err := testutils.CreateTestDatabase("TestAuthenticatorWatcher")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+
+	sa := NewAuthenticator()
+	sa.logger = logutil.NewLogger()
+	if err := sa.Configure(db.GetPath(), nil); err != nil {
+		t.Fatal(err)
+	}
+	// The watcher is polled by the test rather than at an interval.
+	w := newWatcher(db.GetPath(), time.Hour)
+	sa.watcher = w
+
+	want := sa.db.GetUserCount() + 1
+	if !sa.poll(w) {
+		t.Fatal("watcher stopped before the database changed")
+	}
+	if got := sa.db.GetUserCount(); got != want-1 {
+		t.Fatalf("database was reloaded without changes: got %d users, want %d", got, want-1)
+	}
+
+	// Add a user with another writer.
+	writer, err := identity.NewDatabase(db.GetPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &requests.Request{
+		User: requests.User{
+			Username: "foobar",
+			Password: "Foo.Bar-123",
+			Email:    "foobar@localdomain.local",
+			Roles:    []string{"viewer"},
+		},
+	}
+	if err := writer.AddUser(req); err != nil {
+		t.Fatal(err)
+	}
+	if !sa.poll(w) {
+		t.Fatal("watcher stopped after the database changed")
+	}
+	if got := sa.db.GetUserCount(); got != want {
+		t.Fatalf("database was not reloaded: got %d users, want %d", got, want)
+	}
+
+	// The watcher of the previous database does not reload the
+	// reconfigured one.
+	if err := sa.Configure(db.GetPath(), nil); err != nil {
+		t.Fatal(err)
+	}
+	req.User.Username = "barfoo"
+	req.User.Email = "barfoo@localdomain.local"
+	if err := writer.AddUser(req); err != nil {
+		t.Fatal(err)
+	}
+	if sa.poll(w) {
+		t.Fatal("watcher was not stopped on reconfiguration")
+	}
+	if got := sa.db.GetUserCount(); got != want {
+		t.Fatalf("database was reloaded by stopped watcher: got %d users, want %d", got, want)
+	}
+}
+
+func TestAuthenticatorStopWatcher(t *testing.T) {
+	db, err := testutils.CreateTestDatabase("TestAuthenticatorStopWatcher")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+
+	sa := NewAuthenticator()
+	sa.logger = logutil.NewLogger()
+	if err := sa.Configure(db.GetPath(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// StopWatcher returns after the watcher exits.
+	sa.StartWatcher(time.Hour)
+	w := sa.watcher
+	sa.StopWatcher()
+	select {
+	case <-w.done:
+	default:
+		t.Fatal("watcher is running after StopWatcher")
+	}
+
+	// The reconfiguration stops the running watcher.
+	sa.StartWatcher(time.Hour)
+	w = sa.watcher
+	if err := sa.Configure(db.GetPath(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if sa.watcher != nil {
+		t.Fatal("watcher is set after reconfiguration")
+	}
+	<-w.done
+}
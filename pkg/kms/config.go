@@ -20,6 +20,8 @@ import (
 	"github.com/greenpau/go-authcrunch/pkg/errors"
 	cfgutil "github.com/greenpau/go-authcrunch/pkg/util/cfg"
 
+	"net"
+	"net/url"
 	"os"
 	"sort"
 	"strconv"
@@ -30,6 +32,13 @@ const (
 	defaultKeyID             = "0"
 	defaultTokenName         = "access_token"
 	defaultTokenLifetime int = 900
+	// IDTokenName is the token name of the keys signing OpenID Connect ID
+	// tokens. The keys are not used for the verification of access tokens.
+	IDTokenName = "id_token"
+	// IDTokenType is the typ header of OpenID Connect ID tokens. It tells
+	// the ID tokens apart from the access tokens when the verification keys
+	// of both are published in the same key set.
+	IDTokenType = "id_token+jwt"
 )
 
 var (
@@ -66,9 +75,9 @@ type CryptoKeyConfig struct {
 	Usage string `json:"usage,omitempty" xml:"usage,omitempty" yaml:"usage,omitempty"`
 	// TokenName is the token name associated with the key.
 	TokenName string `json:"token_name,omitempty" xml:"token_name,omitempty" yaml:"token_name,omitempty"`
-	// Source is either config or env.
+	// Source is either config, env, or jwks.
 	Source string `json:"source,omitempty" xml:"source,omitempty" yaml:"source,omitempty"`
-	// Algorithm is either hmac, rsa, or ecdsa.
+	// Algorithm is either hmac, rsa, ecdsa, rsapss, or eddsa.
 	Algorithm string `json:"algorithm,omitempty" xml:"algorithm,omitempty" yaml:"algorithm,omitempty"`
 	// EnvVarName is the name of environment variables holding either the value of
 	// a key or the path a directory or file containing a key.
@@ -83,6 +92,9 @@ type CryptoKeyConfig struct {
 	FilePath string `json:"file_path,omitempty" xml:"file_path,omitempty" yaml:"file_path,omitempty"`
 	// DirPath is the path to a directory containing crypto keys.
 	DirPath string `json:"dir_path,omitempty" xml:"dir_path,omitempty" yaml:"dir_path,omitempty"`
+	// JwksURL is the URL of a remote JSON Web Key Set containing token
+	// verification keys.
+	JwksURL string `json:"jwks_url,omitempty" xml:"jwks_url,omitempty" yaml:"jwks_url,omitempty"`
 	// TokenLifetime is the expected token grant lifetime in seconds.
 	TokenLifetime int `json:"token_lifetime,omitempty" xml:"token_lifetime,omitempty" yaml:"token_lifetime,omitempty"`
 	// Secret is the shared key used with HMAC algorithm.
@@ -90,6 +102,8 @@ type CryptoKeyConfig struct {
 	// PreferredSignMethod is the preferred method to sign tokens, e.g.
 	// all HMAC keys could use HS256, HS384, and HS512 methods. By default,
 	// the preferred method is HS512. However, one may prefer using HS256.
+	// Similarly, RSA keys sign tokens with RS512 by default, and with
+	// PS256 when preferred.
 	PreferredSignMethod string `json:"token_sign_method,omitempty" xml:"token_sign_method,omitempty" yaml:"token_sign_method,omitempty"`
 	// EvalExpr is a list of expressions evaluated whether a specific key
 	// should be used for signing and verification.
@@ -125,6 +139,9 @@ func (k *CryptoKeyConfig) ToString() string {
 	if k.DirPath != "" {
 		sb.WriteString(", dir path: " + k.DirPath)
 	}
+	if k.JwksURL != "" {
+		sb.WriteString(", jwks url: " + k.JwksURL)
+	}
 	if k.validated || k.parsed {
 		sb.WriteString(", flags:")
 		if k.parsed {
@@ -166,6 +183,24 @@ func (k *CryptoKeyConfig) validate() error {
 	case "":
 		return fmt.Errorf("key source not found")
 	case "config":
+	case "jwks":
+		if k.Usage != "verify" {
+			return fmt.Errorf("key source jwks supports verify usage only")
+		}
+		u, err := url.Parse(k.JwksURL)
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("key source jwks url %q is invalid", k.JwksURL)
+		}
+		switch u.Scheme {
+		case "https":
+		case "http":
+			// The plain text is allowed for the loopback only.
+			if !isLoopbackHost(u.Hostname()) {
+				return fmt.Errorf("key source jwks url %q must use https", k.JwksURL)
+			}
+		default:
+			return fmt.Errorf("key source jwks url %q is invalid", k.JwksURL)
+		}
 	case "env":
 		switch k.EnvVarType {
 		case "key", "file", "directory":
@@ -179,7 +214,7 @@ func (k *CryptoKeyConfig) validate() error {
 	}
 
 	switch k.Algorithm {
-	case "hmac", "rsa", "ecdsa", "":
+	case "hmac", "rsa", "ecdsa", "rsapss", "eddsa", "":
 	default:
 		return fmt.Errorf("key algorithm %q is invalid", k.Algorithm)
 	}
@@ -216,6 +251,29 @@ func ParseCryptoKeyStoreConfig(cfg string) (map[string]interface{}, error) {
 			default:
 				return nil, errors.ErrCryptoKeyConfigEntryInvalid.WithArgs(line, "contains unsupported 'crypto default token' parameter: %s", args[2])
 			}
+		case "key":
+			if args[2] != "rotation" || len(args) != 4 {
+				return nil, errors.ErrCryptoKeyConfigEntryInvalid.WithArgs(line, "must be 'crypto default key rotation <interval>'")
+			}
+			if _, err := parseKeyRotationInterval(args[3]); err != nil {
+				return nil, errors.ErrCryptoKeyConfigEntryInvalid.WithArgs(line, err)
+			}
+			m["key_rotation_interval"] = args[3]
+		case "keyring":
+			switch {
+			case args[2] == "path" && len(args) == 4:
+				m["keyring_path"] = args[3]
+			case args[2] == "secret" && len(args) == 4:
+				m["keyring_secret"] = args[3]
+			case args[2] == "secret" && len(args) == 5 && args[3] == "env":
+				v := strings.TrimSpace(os.Getenv(args[4]))
+				if v == "" {
+					return nil, errors.ErrCryptoKeyConfigEntryInvalid.WithArgs(line, errors.ErrCryptoKeyConfigEmptyEnvVar.WithArgs(args[4]))
+				}
+				m["keyring_secret"] = v
+			default:
+				return nil, errors.ErrCryptoKeyConfigEntryInvalid.WithArgs(line, "contains unsupported 'crypto default keyring' parameter")
+			}
 		default:
 			return nil, errors.ErrCryptoKeyConfigEntryInvalid.WithArgs(line, fmt.Sprintf("contains unsupported 'crypto default' keyword: %s", args[1]))
 		}
@@ -280,6 +338,9 @@ func ParseCryptoKeyConfigs(cfg string) ([]*CryptoKeyConfig, error) {
 				default:
 					return nil, errors.ErrCryptoKeyConfigEntryInvalid.WithArgs(line, "unknown default token setting")
 				}
+			case "key", "keyring":
+				// The key rotation and keyring settings are parsed by
+				// ParseCryptoKeyStoreConfig.
 			default:
 				return nil, errors.ErrCryptoKeyConfigEntryInvalid.WithArgs(line, "unknown default setting")
 			}
@@ -369,6 +430,8 @@ func ParseCryptoKeyConfigs(cfg string) ([]*CryptoKeyConfig, error) {
 						return nil, errors.ErrCryptoKeyConfigEntryInvalid.WithArgs(line, err)
 					}
 					key.TokenLifetime = i
+				case "method":
+					key.PreferredSignMethod = args[i+2]
 				default:
 					return nil, errors.ErrCryptoKeyConfigEntryInvalid.WithArgs(line, "unknown key token setting")
 				}
@@ -397,6 +460,9 @@ func ParseCryptoKeyConfigs(cfg string) ([]*CryptoKeyConfig, error) {
 					case "directory":
 						key.Source = "config"
 						key.DirPath = args[i+3]
+					case "jwks":
+						key.Source = "jwks"
+						key.JwksURL = args[i+3]
 					case "env":
 						key.Source = "env"
 						key.EnvVarName = args[i+3]
@@ -469,3 +535,11 @@ func ParseCryptoKeyConfigs(cfg string) ([]*CryptoKeyConfig, error) {
 	}
 	return keys, nil
 }
+
+func isLoopbackHost(s string) bool {
+	if s == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(s)
+	return ip != nil && ip.IsLoopback()
+}
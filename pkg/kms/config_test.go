@@ -435,6 +435,57 @@ func TestParseCryptoKeyConfigs(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "load keys from remote jwks url",
+			config: `
+                crypto key verify from jwks https://auth.example.com/.well-known/jwks.json
+            `,
+			want: map[string]interface{}{
+				"config_count": 1,
+				"configs": []*CryptoKeyConfig{
+					{
+						ID:            "0",
+						Usage:         "verify",
+						Source:        "jwks",
+						JwksURL:       "https://auth.example.com/.well-known/jwks.json",
+						TokenName:     "access_token",
+						TokenLifetime: 900,
+						parsed:        true,
+						validated:     true,
+					},
+				},
+			},
+		},
+		{
+			name: "load keys from remote jwks with invalid url",
+			config: `
+                crypto key verify from jwks auth.example.com/jwks.json
+            `,
+			shouldErr: true,
+			err: errors.ErrCryptoKeyConfigKeyInvalid.WithArgs(
+				0, fmt.Errorf(`key source jwks url "auth.example.com/jwks.json" is invalid`),
+			),
+		},
+		{
+			name: "load keys from remote jwks with plain text url",
+			config: `
+                crypto key verify from jwks http://auth.example.com/.well-known/jwks.json
+            `,
+			shouldErr: true,
+			err: errors.ErrCryptoKeyConfigKeyInvalid.WithArgs(
+				0, fmt.Errorf(`key source jwks url "http://auth.example.com/.well-known/jwks.json" must use https`),
+			),
+		},
+		{
+			name: "load signing keys from remote jwks url",
+			config: `
+                crypto key sign from jwks https://auth.example.com/.well-known/jwks.json
+            `,
+			shouldErr: true,
+			err: errors.ErrCryptoKeyConfigKeyInvalid.WithArgs(
+				0, fmt.Errorf("key source jwks supports verify usage only"),
+			),
+		},
 		{
 			name: "shared secret embedded in environment variable",
 			config: `
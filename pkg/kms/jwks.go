@@ -0,0 +1,307 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kms
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/binary"
+	"math/big"
+	"strings"
+
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+)
+
+// JwksKey is the public key of CryptoKey, or of a remote key set, in the
+// JSON Web Key format.
+// See https://tools.ietf.org/html/rfc7517#section-4,
+// https://tools.ietf.org/html/rfc7518#section-6,
+// https://tools.ietf.org/html/rfc8037#section-2
+type JwksKey struct {
+	KeyType      string `json:"kty" xml:"kty" yaml:"kty"`
+	PublicKeyUse string `json:"use" xml:"use" yaml:"use"`
+	KeyID        string `json:"kid" xml:"kid" yaml:"kid"`
+	Algorithm    string `json:"alg" xml:"alg" yaml:"alg"`
+
+	Modulus  string `json:"n,omitempty" xml:"n,omitempty" yaml:"n,omitempty"`
+	Exponent string `json:"e,omitempty" xml:"e,omitempty" yaml:"e,omitempty"`
+
+	Curve  string `json:"crv,omitempty" xml:"crv,omitempty" yaml:"crv,omitempty"`
+	CoordX string `json:"x,omitempty" xml:"x,omitempty" yaml:"x,omitempty"`
+	CoordY string `json:"y,omitempty" xml:"y,omitempty" yaml:"y,omitempty"`
+
+	SharedSecret string `json:"k,omitempty" xml:"k,omitempty" yaml:"k,omitempty"`
+
+	publicKey interface{}
+}
+
+// Validate returns error if JwksKey does not contain relevant information.
+func (k *JwksKey) Validate() error {
+	if k.KeyID == "" {
+		return errors.ErrJwksKeyIDEmpty
+	}
+
+	switch k.KeyType {
+	case "RSA":
+		switch k.Algorithm {
+		case "RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "RSA-OAEP-256", "":
+		default:
+			return errors.ErrJwksKeyAlgoUnsupported.WithArgs(k.Algorithm, k.KeyID)
+		}
+	case "EC":
+		switch k.Curve {
+		case "P-256", "P-384", "P-521":
+		case "":
+			return errors.ErrJwksKeyCurveEmpty.WithArgs(k.KeyID)
+		default:
+			return errors.ErrJwksKeyCurveUnsupported.WithArgs(k.Curve, k.KeyID)
+		}
+		if k.CoordX == "" || k.CoordY == "" {
+			return errors.ErrJwksKeyCurveCoordNotFound.WithArgs(k.KeyID)
+		}
+	case "OKP":
+		switch k.Curve {
+		case "Ed25519":
+		case "":
+			return errors.ErrJwksKeyCurveEmpty.WithArgs(k.KeyID)
+		default:
+			return errors.ErrJwksKeyCurveUnsupported.WithArgs(k.Curve, k.KeyID)
+		}
+		if k.CoordX == "" {
+			return errors.ErrJwksKeyCurveCoordNotFound.WithArgs(k.KeyID)
+		}
+		switch k.Algorithm {
+		case "EdDSA", "":
+		default:
+			return errors.ErrJwksKeyAlgoUnsupported.WithArgs(k.Algorithm, k.KeyID)
+		}
+	case "oct":
+		if k.SharedSecret == "" {
+			return errors.ErrJwksKeySharedSecretEmpty.WithArgs(k.KeyID)
+		}
+		switch k.Algorithm {
+		case "HS256", "HS384", "HS512", "":
+		default:
+			return errors.ErrJwksKeyAlgoUnsupported.WithArgs(k.Algorithm, k.KeyID)
+		}
+	case "":
+		return errors.ErrJwksKeyTypeEmpty.WithArgs(k.KeyID)
+	default:
+		return errors.ErrJwksKeyTypeUnsupported.WithArgs(k.KeyType, k.KeyID)
+	}
+
+	switch k.PublicKeyUse {
+	case "sig", "enc", "":
+	default:
+		return errors.ErrJwksKeyUsageUnsupported.WithArgs(k.PublicKeyUse, k.KeyID)
+	}
+
+	switch k.KeyType {
+	case "RSA":
+		if k.Exponent == "" {
+			return errors.ErrJwksKeyExponentEmpty.WithArgs(k.KeyID)
+		}
+
+		if k.Modulus == "" {
+			return errors.ErrJwksKeyModulusEmpty.WithArgs(k.KeyID)
+		}
+
+		// Add padding
+		if i := len(k.Modulus) % 4; i != 0 {
+			k.Modulus += strings.Repeat("=", 4-i)
+		}
+
+		var mod []byte
+		var err error
+		if strings.ContainsAny(k.Modulus, "/+") {
+			// This decoding works with + and / signs. (legacy)
+			mod, err = base64.StdEncoding.DecodeString(k.Modulus)
+		} else {
+			// This decoding works with - and _ signs.
+			mod, err = base64.URLEncoding.DecodeString(k.Modulus)
+		}
+
+		if err != nil {
+			return errors.ErrJwksKeyDecodeModulus.WithArgs(k.KeyID, k.Modulus, err)
+		}
+		n := big.NewInt(0)
+		n.SetBytes(mod)
+
+		exp, err := base64.StdEncoding.DecodeString(k.Exponent)
+		if err != nil {
+			return errors.ErrJwksKeyDecodeExponent.WithArgs(k.KeyID, err)
+		}
+		// The "e" (exponent) parameter contains the exponent value for the RSA
+		// public key.  It is represented as a Base64urlUInt-encoded value.
+		//
+		// For instance, when representing the value 65537, the octet sequence
+		// to be base64url-encoded MUST consist of the three octets [1, 0, 1];
+		// the resulting representation for this value is "AQAB".
+		var eb []byte
+		if len(exp) < 8 {
+			eb = make([]byte, 8-len(exp), 8)
+			eb = append(eb, exp...)
+		} else {
+			eb = exp
+		}
+		er := bytes.NewReader(eb)
+		var e uint64
+		if err := binary.Read(er, binary.BigEndian, &e); err != nil {
+			return errors.ErrJwksKeyConvExponent.WithArgs(k.KeyID, err)
+		}
+		k.publicKey = &rsa.PublicKey{N: n, E: int(e)}
+	case "EC":
+		var expByteCount int
+		pk := &ecdsa.PublicKey{}
+		switch k.Curve {
+		case "P-256":
+			pk.Curve = elliptic.P256()
+			expByteCount = 32
+		case "P-384":
+			pk.Curve = elliptic.P384()
+			expByteCount = 48
+		case "P-521":
+			pk.Curve = elliptic.P521()
+			expByteCount = 66
+		}
+
+		for i, c := range []string{k.CoordX, k.CoordY} {
+			ltr := "X"
+			if i > 0 {
+				ltr = "Y"
+			}
+			b, err := base64.RawURLEncoding.DecodeString(c)
+			if err != nil {
+				return errors.ErrJwksKeyDecodeCoord.WithArgs(k.KeyID, ltr, err)
+			}
+			if len(b) != expByteCount {
+				return errors.ErrJwksKeyCoordLength.WithArgs(k.KeyID, ltr, len(b), expByteCount)
+			}
+			bi := big.NewInt(0)
+			bi.SetBytes(b)
+			if i == 0 {
+				pk.X = bi
+				continue
+			}
+			pk.Y = bi
+		}
+		k.publicKey = pk
+	case "OKP":
+		b, err := base64.RawURLEncoding.DecodeString(k.CoordX)
+		if err != nil {
+			return errors.ErrJwksKeyDecodeCoord.WithArgs(k.KeyID, "X", err)
+		}
+		if len(b) != ed25519.PublicKeySize {
+			return errors.ErrJwksKeyCoordLength.WithArgs(k.KeyID, "X", len(b), ed25519.PublicKeySize)
+		}
+		k.publicKey = ed25519.PublicKey(b)
+	case "oct":
+		key, err := base64.RawURLEncoding.DecodeString(k.SharedSecret)
+		if err != nil {
+			return errors.ErrJwksKeyDecodeSharedSecret.WithArgs(k.KeyID, err)
+		}
+		k.publicKey = key
+	default:
+		return errors.ErrJwksKeyTypeNotImplemented.WithArgs(k.KeyID, k.KeyType, k)
+	}
+
+	return nil
+}
+
+// GetPublic returns pointer to public key.
+func (k *JwksKey) GetPublic() interface{} {
+	return k.publicKey
+}
+
+// JwksKeySet is a set of public keys in the JSON Web Key format.
+type JwksKeySet struct {
+	Keys []*JwksKey `json:"keys" xml:"keys" yaml:"keys"`
+}
+
+// GetJwksKey returns the public key of CryptoKey in the JSON Web Key format.
+// The shared secret keys, i.e. hmac, are never published.
+func (k *CryptoKey) GetJwksKey() (*JwksKey, error) {
+	if !k.Verify.Capable || k.Config.Algorithm == "hmac" {
+		return nil, errors.ErrCryptoKeyJwksNotPublic.WithArgs(k.Config.ID)
+	}
+
+	jk := &JwksKey{
+		PublicKeyUse: "sig",
+		KeyID:        k.Config.ID,
+		Algorithm:    k.Verify.Token.DefaultMethod,
+	}
+
+	if k.Sign.Token.Capable {
+		jk.Algorithm = k.Sign.Token.DefaultMethod
+	}
+
+	switch pk := k.Verify.Secret.(type) {
+	case *rsa.PublicKey:
+		jk.KeyType = "RSA"
+		jk.Modulus = base64.RawURLEncoding.EncodeToString(pk.N.Bytes())
+		jk.Exponent = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pk.E)).Bytes())
+	case *ecdsa.PublicKey:
+		params := pk.Curve.Params()
+		size := (params.BitSize + 7) / 8
+		x := make([]byte, size)
+		y := make([]byte, size)
+		pk.X.FillBytes(x)
+		pk.Y.FillBytes(y)
+		jk.KeyType = "EC"
+		jk.Curve = params.Name
+		jk.CoordX = base64.RawURLEncoding.EncodeToString(x)
+		jk.CoordY = base64.RawURLEncoding.EncodeToString(y)
+		// The ECDSA signing method is bound to the curve.
+		switch params.Name {
+		case "P-256":
+			jk.Algorithm = "ES256"
+		case "P-384":
+			jk.Algorithm = "ES384"
+		case "P-521":
+			jk.Algorithm = "ES512"
+		}
+	case ed25519.PublicKey:
+		jk.KeyType = "OKP"
+		jk.Curve = "Ed25519"
+		jk.CoordX = base64.RawURLEncoding.EncodeToString(pk)
+		jk.Algorithm = "EdDSA"
+	default:
+		return nil, errors.ErrCryptoKeyJwksUnsupportedType.WithArgs(k.Config.ID, k.Verify.Secret)
+	}
+	return jk, nil
+}
+
+// GetJwksKeySet returns the public keys of the verification keys of
+// CryptoKeyStore in the JSON Web Key format. The keys that cannot be
+// published, e.g. shared secrets, are skipped.
+func (ks *CryptoKeyStore) GetJwksKeySet() *JwksKeySet {
+	set := &JwksKeySet{
+		Keys: []*JwksKey{},
+	}
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	for _, k := range ks.verifyKeys {
+		jk, err := k.GetJwksKey()
+		if err != nil {
+			continue
+		}
+		set.Keys = append(set.Keys, jk)
+	}
+	return set
+}
@@ -0,0 +1,229 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kms
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	jwtlib "github.com/golang-jwt/jwt/v4"
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+)
+
+const (
+	// defaultJwksCacheMaxAge is the lifetime of the fetched keys when the
+	// response has no Cache-Control max-age directive.
+	defaultJwksCacheMaxAge = 15 * time.Minute
+	// defaultJwksRefreshInterval is the minimum interval between the fetches,
+	// e.g. triggered by tokens with unknown key ids.
+	defaultJwksRefreshInterval = 30 * time.Second
+	defaultJwksFetchTimeout    = 10 * time.Second
+	maxJwksResponseSize        = 1 << 20
+)
+
+// remoteJwksMethods are the signing methods accepted with the keys from a
+// remote JSON Web Key Set. The shared secrets, i.e. HMAC, are not accepted,
+// because a published secret allows anyone to sign tokens.
+var remoteJwksMethods = []string{
+	"RS512", "RS384", "RS256", "PS512", "PS384", "PS256", "ES512", "ES384", "ES256", "EdDSA",
+}
+
+// remoteJwksKeySet holds the keys fetched from a remote JSON Web Key Set.
+// The keys are fetched on first use, and then refetched when the cached
+// keys expire or when a token references an unknown key id.
+type remoteJwksKeySet struct {
+	url                string
+	client             *http.Client
+	minRefreshInterval time.Duration
+
+	mu        sync.RWMutex
+	keys      map[string]*JwksKey
+	expiresAt time.Time
+
+	// fetchMu serializes fetches and guards fetchedAt.
+	fetchMu   sync.Mutex
+	fetchedAt time.Time
+}
+
+func newRemoteJwksKeySet(url string) *remoteJwksKeySet {
+	return &remoteJwksKeySet{
+		url:                url,
+		client:             &http.Client{Timeout: defaultJwksFetchTimeout},
+		minRefreshInterval: defaultJwksRefreshInterval,
+		keys:               make(map[string]*JwksKey),
+	}
+}
+
+// provideKey returns the public key referenced by the token.
+func (s *remoteJwksKeySet) provideKey(token *jwtlib.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	jk, err := s.getKey(kid)
+	if err != nil {
+		return nil, err
+	}
+
+	switch jk.KeyType {
+	case "RSA":
+		switch token.Method.(type) {
+		case *jwtlib.SigningMethodRSA, *jwtlib.SigningMethodRSAPSS:
+		default:
+			return nil, errors.ErrUnexpectedSigningMethod.WithArgs("RS", token.Header["alg"])
+		}
+	case "EC":
+		if _, validMethod := token.Method.(*jwtlib.SigningMethodECDSA); !validMethod {
+			return nil, errors.ErrUnexpectedSigningMethod.WithArgs("ES", token.Header["alg"])
+		}
+	case "OKP":
+		if _, validMethod := token.Method.(*jwtlib.SigningMethodEd25519); !validMethod {
+			return nil, errors.ErrUnexpectedSigningMethod.WithArgs("EdDSA", token.Header["alg"])
+		}
+	default:
+		return nil, errors.ErrUnexpectedSigningMethod.WithArgs(jk.KeyType, token.Header["alg"])
+	}
+	if jk.Algorithm != "" && jk.Algorithm != token.Method.Alg() {
+		return nil, errors.ErrUnexpectedSigningMethod.WithArgs(jk.Algorithm, token.Header["alg"])
+	}
+	return jk.GetPublic(), nil
+}
+
+// getKey returns the key with the provided key id. When the key is not
+// in cache or the cache expired, the keys are refetched. If the refetch
+// fails, the expired key is still used.
+func (s *remoteJwksKeySet) getKey(kid string) (*JwksKey, error) {
+	jk, expired, err := s.lookup(kid)
+	if err == nil && !expired {
+		return jk, nil
+	}
+	if fetchErr := s.refresh(); fetchErr != nil {
+		if jk != nil {
+			return jk, nil
+		}
+		return nil, fetchErr
+	}
+	jk, _, err = s.lookup(kid)
+	return jk, err
+}
+
+func (s *remoteJwksKeySet) lookup(kid string) (*JwksKey, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	expired := time.Now().After(s.expiresAt)
+	if kid == "" {
+		if len(s.keys) != 1 {
+			return nil, expired, errors.ErrCryptoKeyJwksKeyIDEmpty.WithArgs(s.url, len(s.keys))
+		}
+		for _, jk := range s.keys {
+			return jk, expired, nil
+		}
+	}
+	jk, exists := s.keys[kid]
+	if !exists {
+		return nil, expired, errors.ErrCryptoKeyJwksKeyNotFound.WithArgs(s.url, kid)
+	}
+	return jk, expired, nil
+}
+
+// refresh fetches the keys unless they were fetched recently.
+func (s *remoteJwksKeySet) refresh() error {
+	s.fetchMu.Lock()
+	defer s.fetchMu.Unlock()
+	if !s.fetchedAt.IsZero() && time.Since(s.fetchedAt) < s.minRefreshInterval {
+		return nil
+	}
+	s.fetchedAt = time.Now()
+
+	keys, maxAge, err := s.fetch()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+	s.expiresAt = time.Now().Add(maxAge)
+	return nil
+}
+
+func (s *remoteJwksKeySet) fetch() (map[string]*JwksKey, time.Duration, error) {
+	req, err := http.NewRequest(http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, 0, errors.ErrCryptoKeyJwksFetch.WithArgs(s.url, err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, 0, errors.ErrCryptoKeyJwksFetch.WithArgs(s.url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, errors.ErrCryptoKeyJwksFetchStatus.WithArgs(s.url, resp.StatusCode)
+	}
+
+	set := &JwksKeySet{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxJwksResponseSize)).Decode(set); err != nil {
+		return nil, 0, errors.ErrCryptoKeyJwksFetch.WithArgs(s.url, err)
+	}
+
+	keys := make(map[string]*JwksKey)
+	for _, jk := range set.Keys {
+		if jk == nil || jk.PublicKeyUse == "enc" || jk.KeyType == "oct" {
+			continue
+		}
+		// The keys with unsupported types or algorithms are skipped.
+		if err := jk.Validate(); err != nil {
+			continue
+		}
+		keys[jk.KeyID] = jk
+	}
+	if len(keys) == 0 {
+		return nil, 0, errors.ErrCryptoKeyJwksFetch.WithArgs(s.url, "no valid keys found")
+	}
+
+	maxAge, found := parseCacheControlMaxAge(resp.Header.Get("Cache-Control"))
+	if !found {
+		maxAge = defaultJwksCacheMaxAge
+	}
+	return keys, maxAge, nil
+}
+
+// parseCacheControlMaxAge returns the lifetime of a response based on its
+// Cache-Control header. The no-cache and no-store directives yield zero
+// lifetime.
+func parseCacheControlMaxAge(s string) (time.Duration, bool) {
+	var maxAge time.Duration
+	var found bool
+	for _, directive := range strings.Split(s, ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		switch {
+		case directive == "no-cache", directive == "no-store":
+			return 0, true
+		case strings.HasPrefix(directive, "max-age="):
+			i, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(directive, "max-age="), `"`))
+			if err != nil || i < 0 {
+				continue
+			}
+			maxAge = time.Duration(i) * time.Second
+			found = true
+		}
+	}
+	return maxAge, found
+}
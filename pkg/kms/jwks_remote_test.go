@@ -0,0 +1,271 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kms
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/greenpau/go-authcrunch/internal/tests"
+	"github.com/greenpau/go-authcrunch/pkg/requests"
+	"github.com/greenpau/go-authcrunch/pkg/user"
+)
+
+type testJwksServer struct {
+	mu           sync.Mutex
+	ks           *CryptoKeyStore
+	cacheControl string
+	fetches      int
+	// body overrides the published key set.
+	body string
+}
+
+func (s *testJwksServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fetches++
+	if s.cacheControl != "" {
+		w.Header().Set("Cache-Control", s.cacheControl)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if s.body != "" {
+		w.Write([]byte(s.body))
+		return
+	}
+	json.NewEncoder(w).Encode(s.ks.GetJwksKeySet())
+}
+
+func (s *testJwksServer) rotate(ks *CryptoKeyStore) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ks = ks
+}
+
+func (s *testJwksServer) getFetches() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fetches
+}
+
+func newTestSigningKeyStore(t *testing.T, cfg string) *CryptoKeyStore {
+	configs, err := ParseCryptoKeyConfigs(cfg)
+	if err != nil {
+		t.Fatalf("failed parsing configs: %v", err)
+	}
+	ks := NewCryptoKeyStore()
+	if err := ks.AddKeysWithConfigs(configs); err != nil {
+		t.Fatalf("failed adding keys: %v", err)
+	}
+	return ks
+}
+
+func newTestSignedToken(t *testing.T, ks *CryptoKeyStore) string {
+	usr, err := user.NewUser(map[string]interface{}{
+		"sub": "jsmith",
+		"exp": float64(time.Now().Add(10 * time.Minute).Unix()),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SignToken(nil, nil, usr); err != nil {
+		t.Fatalf("failed signing token: %v", err)
+	}
+	return usr.Token
+}
+
+func TestRemoteJwksKeySet(t *testing.T) {
+	rsaKeyStore := newTestSigningKeyStore(t, `crypto key k1 sign-verify from file ./../../testdata/rskeys/test_1_pri.pem`)
+	ecKeyStore := newTestSigningKeyStore(t, `crypto key k2 sign-verify from file ./../../testdata/ecdsakeys/test_4_pri.pem`)
+	hmacKeyStore := newTestSigningKeyStore(t, `crypto key k3 sign-verify foobar`)
+	pssKeyStore := newTestSigningKeyStore(t, `crypto key k4 sign-verify from file ./../../testdata/rspsskeys/test_2_pri.pem`)
+	edKeyStore := newTestSigningKeyStore(t, `crypto key k5 sign-verify from file ./../../testdata/edkeys/test_1_pri.pem`)
+
+	testcases := []struct {
+		name            string
+		cacheControl    string
+		refreshInterval time.Duration
+		// The key stores signing the tokens, one per token.
+		signers []*CryptoKeyStore
+		// The key stores published by the server before each token.
+		published []*CryptoKeyStore
+		// The raw key set published by the server instead of key stores.
+		body string
+		want map[string]interface{}
+	}{
+		{
+			name:      "validate token with rsa key",
+			signers:   []*CryptoKeyStore{rsaKeyStore},
+			published: []*CryptoKeyStore{rsaKeyStore},
+			want: map[string]interface{}{
+				"valid":   []bool{true},
+				"fetches": 1,
+			},
+		},
+		{
+			name:      "validate token with rsa-pss key",
+			signers:   []*CryptoKeyStore{pssKeyStore},
+			published: []*CryptoKeyStore{pssKeyStore},
+			want: map[string]interface{}{
+				"valid":   []bool{true},
+				"fetches": 1,
+			},
+		},
+		{
+			name:      "validate token with ed25519 key",
+			signers:   []*CryptoKeyStore{edKeyStore},
+			published: []*CryptoKeyStore{edKeyStore},
+			want: map[string]interface{}{
+				"valid":   []bool{true},
+				"fetches": 1,
+			},
+		},
+		{
+			name:         "validate tokens with cached ecdsa key",
+			cacheControl: "public, max-age=300",
+			signers:      []*CryptoKeyStore{ecKeyStore, ecKeyStore, ecKeyStore},
+			published:    []*CryptoKeyStore{ecKeyStore, ecKeyStore, ecKeyStore},
+			want: map[string]interface{}{
+				"valid":   []bool{true, true, true},
+				"fetches": 1,
+			},
+		},
+		{
+			name:      "refetch keys after rotation",
+			signers:   []*CryptoKeyStore{rsaKeyStore, ecKeyStore},
+			published: []*CryptoKeyStore{rsaKeyStore, ecKeyStore},
+			want: map[string]interface{}{
+				"valid":   []bool{true, true},
+				"fetches": 2,
+			},
+		},
+		{
+			name:            "rate limit refetch of unknown key",
+			refreshInterval: time.Hour,
+			signers:         []*CryptoKeyStore{rsaKeyStore, ecKeyStore, ecKeyStore},
+			published:       []*CryptoKeyStore{rsaKeyStore, ecKeyStore, ecKeyStore},
+			want: map[string]interface{}{
+				"valid":   []bool{true, false, false},
+				"fetches": 1,
+			},
+		},
+		{
+			name:         "refetch keys when no-store cache",
+			cacheControl: "no-store",
+			signers:      []*CryptoKeyStore{rsaKeyStore, rsaKeyStore},
+			published:    []*CryptoKeyStore{rsaKeyStore, rsaKeyStore},
+			want: map[string]interface{}{
+				"valid":   []bool{true, true},
+				"fetches": 2,
+			},
+		},
+		{
+			name:      "reject token signed with unpublished shared secret",
+			signers:   []*CryptoKeyStore{hmacKeyStore},
+			published: []*CryptoKeyStore{rsaKeyStore},
+			want: map[string]interface{}{
+				"valid":   []bool{false},
+				"fetches": 1,
+			},
+		},
+		{
+			name:      "reject token signed with shared secret published in jwks",
+			signers:   []*CryptoKeyStore{hmacKeyStore},
+			published: []*CryptoKeyStore{hmacKeyStore},
+			body:      `{"keys":[{"kty":"oct","kid":"k3","use":"sig","k":"Zm9vYmFy"}]}`,
+			want: map[string]interface{}{
+				"valid":   []bool{false},
+				"fetches": 1,
+			},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			srv := &testJwksServer{cacheControl: tc.cacheControl, body: tc.body}
+			ts := httptest.NewServer(srv)
+			defer ts.Close()
+
+			configs, err := ParseCryptoKeyConfigs("crypto key verify from jwks " + ts.URL)
+			if err != nil {
+				t.Fatalf("failed parsing configs: %v", err)
+			}
+			ks := NewCryptoKeyStore()
+			if err := ks.AddKeysWithConfigs(configs); err != nil {
+				t.Fatalf("failed adding keys: %v", err)
+			}
+			for _, k := range ks.GetVerifyKeys() {
+				k.remote.minRefreshInterval = tc.refreshInterval
+			}
+
+			var valid []bool
+			for i, signer := range tc.signers {
+				srv.rotate(tc.published[i])
+				ar := requests.NewAuthorizationRequest()
+				ar.Token.Name = "access_token"
+				ar.Token.Payload = newTestSignedToken(t, signer)
+				usr, err := ks.ParseToken(ar)
+				valid = append(valid, err == nil && usr != nil && usr.Claims.Subject == "jsmith")
+			}
+
+			got := map[string]interface{}{
+				"valid":   valid,
+				"fetches": srv.getFetches(),
+			}
+			tests.EvalObjectsWithLog(t, "remote jwks", tc.want, got, msgs)
+		})
+	}
+}
+
+func TestParseCacheControlMaxAge(t *testing.T) {
+	testcases := []struct {
+		name   string
+		header string
+		want   map[string]interface{}
+	}{
+		{
+			name:   "public with max-age",
+			header: "public, max-age=300",
+			want:   map[string]interface{}{"max_age": 300 * time.Second, "found": true},
+		},
+		{
+			name:   "no-cache",
+			header: "no-cache, max-age=300",
+			want:   map[string]interface{}{"max_age": time.Duration(0), "found": true},
+		},
+		{
+			name:   "empty header",
+			header: "",
+			want:   map[string]interface{}{"max_age": time.Duration(0), "found": false},
+		},
+		{
+			name:   "invalid max-age",
+			header: "max-age=foo",
+			want:   map[string]interface{}{"max_age": time.Duration(0), "found": false},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			maxAge, found := parseCacheControlMaxAge(tc.header)
+			got := map[string]interface{}{"max_age": maxAge, "found": found}
+			tests.EvalObjectsWithLog(t, "cache control", tc.want, got, msgs)
+		})
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kms
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	jwtlib "github.com/golang-jwt/jwt/v4"
+	"github.com/greenpau/go-authcrunch/internal/tests"
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/user"
+)
+
+func TestGetJwksKeySet(t *testing.T) {
+	testcases := []struct {
+		name   string
+		config string
+		want   map[string]interface{}
+	}{
+		{
+			name:   "rsa key pair",
+			config: `crypto key k1 sign-verify from file ./../../testdata/rskeys/test_1_pri.pem`,
+			want: map[string]interface{}{
+				"keys": []map[string]string{
+					{"kty": "RSA", "kid": "k1", "use": "sig", "alg": "RS512", "e": "AQAB"},
+				},
+			},
+		},
+		{
+			name:   "ecdsa p-521 key pair",
+			config: `crypto key k2 sign-verify from file ./../../testdata/ecdsakeys/test_4_pri.pem`,
+			want: map[string]interface{}{
+				"keys": []map[string]string{
+					{"kty": "EC", "kid": "k2", "use": "sig", "alg": "ES512", "crv": "P-521"},
+				},
+			},
+		},
+		{
+			name:   "ecdsa p-384 public key",
+			config: `crypto key k3 verify from file ./../../testdata/ecdsakeys/test_3_pri.pem`,
+			want: map[string]interface{}{
+				"keys": []map[string]string{
+					{"kty": "EC", "kid": "k3", "use": "sig", "alg": "ES384", "crv": "P-384"},
+				},
+			},
+		},
+		{
+			name:   "rsa-pss key pair",
+			config: `crypto key k4 sign-verify from file ./../../testdata/rspsskeys/test_1_pri.pem`,
+			want: map[string]interface{}{
+				"keys": []map[string]string{
+					{"kty": "RSA", "kid": "k4", "use": "sig", "alg": "PS512", "e": "AQAB"},
+				},
+			},
+		},
+		{
+			name:   "rsa-pss key pair restricted to sha256",
+			config: `crypto key k5 sign-verify from file ./../../testdata/rspsskeys/test_2_pri.pem`,
+			want: map[string]interface{}{
+				"keys": []map[string]string{
+					{"kty": "RSA", "kid": "k5", "use": "sig", "alg": "PS256", "e": "AQAB"},
+				},
+			},
+		},
+		{
+			name:   "ed25519 key pair",
+			config: `crypto key k6 sign-verify from file ./../../testdata/edkeys/test_1_pri.pem`,
+			want: map[string]interface{}{
+				"keys": []map[string]string{
+					{"kty": "OKP", "kid": "k6", "use": "sig", "alg": "EdDSA", "crv": "Ed25519"},
+				},
+			},
+		},
+		{
+			name:   "shared secret key is not published",
+			config: `crypto key sign-verify foobar`,
+			want: map[string]interface{}{
+				"keys": []map[string]string{},
+			},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			configs, err := ParseCryptoKeyConfigs(tc.config)
+			if err != nil {
+				t.Fatalf("failed parsing configs: %v", err)
+			}
+			keys, err := GetKeysFromConfigs(configs)
+			if err != nil {
+				t.Fatalf("failed getting keys from configs: %v", err)
+			}
+			ks := NewCryptoKeyStore()
+			if err := ks.AddKeys(keys); err != nil {
+				t.Fatalf("failed adding keys: %v", err)
+			}
+
+			set := ks.GetJwksKeySet()
+			got := make(map[string]interface{})
+			entries := []map[string]string{}
+			for _, k := range set.Keys {
+				entry := map[string]string{"kty": k.KeyType, "kid": k.KeyID, "use": k.PublicKeyUse, "alg": k.Algorithm}
+				switch k.KeyType {
+				case "RSA":
+					entry["e"] = k.Exponent
+				case "EC", "OKP":
+					entry["crv"] = k.Curve
+				}
+				entries = append(entries, entry)
+			}
+			got["keys"] = entries
+			tests.EvalObjectsWithLog(t, "jwks", tc.want, got, msgs)
+
+			// Verify that a signed token validates with the published key.
+			if len(ks.GetSignKeys()) == 0 || len(set.Keys) == 0 {
+				return
+			}
+			usr, err := user.NewUser(map[string]interface{}{
+				"sub": "jsmith",
+				"exp": float64(time.Now().Add(10 * time.Minute).Unix()),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ks.SignToken(nil, set.Keys[0].Algorithm, usr); err != nil {
+				t.Fatalf("failed signing token: %v", err)
+			}
+			token, err := jwtlib.Parse(usr.Token, func(token *jwtlib.Token) (interface{}, error) {
+				for _, k := range set.Keys {
+					if k.KeyID == token.Header["kid"] && k.Algorithm == token.Header["alg"] {
+						return parseTestJwksKey(t, k), nil
+					}
+				}
+				return nil, fmt.Errorf("key %v not found", token.Header["kid"])
+			})
+			if err != nil || !token.Valid {
+				t.Fatalf("failed validating token with published key: %v", err)
+			}
+		})
+	}
+}
+
+func TestSignClaims(t *testing.T) {
+	testcases := []struct {
+		name      string
+		config    string
+		want      map[string]interface{}
+		shouldErr bool
+		err       error
+	}{
+		{
+			name: "sign claims with ecdsa key and skip shared secret key",
+			config: strings.Join([]string{
+				`crypto key k1 sign-verify foobar`,
+				`crypto key k1 token name id_token`,
+				`crypto key k2 sign-verify from file ./../../testdata/ecdsakeys/test_4_pri.pem`,
+				`crypto key k2 token name id_token`,
+			}, "\n"),
+			want: map[string]interface{}{
+				"kid":   "k2",
+				"alg":   "ES512",
+				"sub":   "jsmith",
+				"nonce": "abc123",
+			},
+		},
+		{
+			name: "sign claims with shared secret key only",
+			config: strings.Join([]string{
+				`crypto key k1 sign-verify foobar`,
+				`crypto key k1 token name id_token`,
+			}, "\n"),
+			shouldErr: true,
+			err:       errors.ErrCryptoKeyStoreSignTokenFailed,
+		},
+		{
+			name:      "sign claims without key of token name",
+			config:    `crypto key k2 sign-verify from file ./../../testdata/ecdsakeys/test_4_pri.pem`,
+			shouldErr: true,
+			err:       errors.ErrCryptoKeyStoreSignTokenFailed,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			ks := newTestSigningKeyStore(t, tc.config)
+			s, err := ks.SignClaims(IDTokenName, nil, map[string]interface{}{
+				"sub":   "jsmith",
+				"nonce": "abc123",
+				"exp":   time.Now().Add(10 * time.Minute).Unix(),
+			})
+			if tests.EvalErrWithLog(t, err, "sign claims", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			set := ks.GetJwksKeySet()
+			token, err := jwtlib.Parse(s, func(token *jwtlib.Token) (interface{}, error) {
+				for _, k := range set.Keys {
+					if k.KeyID == token.Header["kid"] {
+						return parseTestJwksKey(t, k), nil
+					}
+				}
+				return nil, fmt.Errorf("key %v not found", token.Header["kid"])
+			})
+			if err != nil || !token.Valid {
+				t.Fatalf("failed validating token with published key: %v", err)
+			}
+			claims := token.Claims.(jwtlib.MapClaims)
+			got := map[string]interface{}{
+				"kid":   token.Header["kid"],
+				"alg":   token.Header["alg"],
+				"sub":   claims["sub"],
+				"nonce": claims["nonce"],
+			}
+			tests.EvalObjectsWithLog(t, "claims", tc.want, got, msgs)
+		})
+	}
+}
+
+func parseTestJwksKey(t *testing.T, k *JwksKey) interface{} {
+	decode := func(s string) *big.Int {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			t.Fatalf("failed decoding %q: %v", s, err)
+		}
+		return new(big.Int).SetBytes(b)
+	}
+	switch k.KeyType {
+	case "RSA":
+		return &rsa.PublicKey{N: decode(k.Modulus), E: int(decode(k.Exponent).Int64())}
+	case "OKP":
+		b, err := base64.RawURLEncoding.DecodeString(k.CoordX)
+		if err != nil {
+			t.Fatalf("failed decoding %q: %v", k.CoordX, err)
+		}
+		return ed25519.PublicKey(b)
+	case "EC":
+		curves := map[string]elliptic.Curve{
+			"P-256": elliptic.P256(),
+			"P-384": elliptic.P384(),
+			"P-521": elliptic.P521(),
+		}
+		return &ecdsa.PublicKey{Curve: curves[k.Curve], X: decode(k.CoordX), Y: decode(k.CoordY)}
+	}
+	t.Fatalf("unsupported key type %q", k.KeyType)
+	return nil
+}
@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/hmac"
 	"crypto/rand"
@@ -31,6 +32,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	jwtlib "github.com/golang-jwt/jwt/v4"
 	"github.com/greenpau/go-authcrunch/pkg/errors"
@@ -43,6 +45,16 @@ type CryptoKey struct {
 	Config *CryptoKeyConfig   `json:"config,omitempty" xml:"config,omitempty" yaml:"config,omitempty"`
 	Sign   *CryptoKeyOperator `json:"sign,omitempty" xml:"sign,omitempty" yaml:"sign,omitempty"`
 	Verify *CryptoKeyOperator `json:"verify,omitempty" xml:"verify,omitempty" yaml:"verify,omitempty"`
+	// remote holds the keys fetched from a remote JWKS.
+	remote *remoteJwksKeySet
+	// rotated indicates whether the key is managed by key rotation.
+	rotated bool
+	// createdAt is the time the key was added to a keystore or generated
+	// by key rotation.
+	createdAt time.Time
+	// expiresAt is the time the key stops verifying tokens. It is set when
+	// the key is retired by key rotation.
+	expiresAt time.Time
 }
 
 // CryptoKeyTokenOperator represents CryptoKeyOperator token operator.
@@ -157,18 +169,32 @@ func GetKeysFromConfig(cfg *CryptoKeyConfig) ([]*CryptoKey, error) {
 		default:
 			return nil, fmt.Errorf("unsupported env config type %s", cfg.EnvVarType)
 		}
+	case "jwks":
+		// Discovered remote key set, the keys are fetched on first use.
+		k := newCryptoKey()
+		k.Config = cfg
+		k.remote = newRemoteJwksKeySet(cfg.JwksURL)
+		k.Verify.Capable = true
+		k.Verify.Token.PreferredMethods = remoteJwksMethods
+		keys = append(keys, k)
 	case "generate":
+		var method string
 		switch cfg.Algorithm {
 		case "ecdsa":
-			cfg.parsed = true
-			key, err := generateKey(cfg, cfg.ID, "ES512")
-			if err != nil {
-				return nil, fmt.Errorf("generating key failed: %v", err)
-			}
-			keys = append(keys, key)
+			method = "ES512"
+		case "rsapss":
+			method = "PS512"
+		case "eddsa":
+			method = "EdDSA"
 		default:
 			return nil, fmt.Errorf("unsupported algorithm for generate: %s", cfg.Algorithm)
 		}
+		cfg.parsed = true
+		key, err := generateKey(cfg, cfg.ID, method)
+		if err != nil {
+			return nil, fmt.Errorf("generating key failed: %v", err)
+		}
+		keys = append(keys, key)
 	default:
 		return nil, fmt.Errorf("unsupported source: '%s'", cfg.Source)
 	}
@@ -180,11 +206,20 @@ func GetKeysFromConfig(cfg *CryptoKeyConfig) ([]*CryptoKey, error) {
 			k.Verify.Capable = true
 			k.Sign.Secret = []byte(k.Config.Secret)
 			k.Verify.Secret = []byte(k.Config.Secret)
-		case "rsa", "ecdsa":
+		case "rsa", "ecdsa", "rsapss", "eddsa":
+		case "":
+			if k.remote == nil {
+				return nil, fmt.Errorf("unsupported config algorithm %s", k.Config.Algorithm)
+			}
 		default:
 			return nil, fmt.Errorf("unsupported config algorithm %s", k.Config.Algorithm)
 		}
 		k.enableUsage()
+		if m := k.Config.PreferredSignMethod; m != "" && k.Sign.Capable {
+			if _, supported := k.Sign.Token.Methods[m]; !supported {
+				return nil, errors.ErrCryptoKeyConfigSignMethodUnsupported.WithArgs(k.Config.ID, m)
+			}
+		}
 	}
 	return keys, nil
 }
@@ -202,8 +237,10 @@ func (k *CryptoKey) enableUsage() {
 		}
 		k.Sign.Token.Name = k.Config.TokenName
 		k.Sign.Token.MaxLifetime = k.Config.TokenLifetime
-		k.Sign.Token.DefaultMethod = k.Sign.Token.PreferredMethods[0]
-		if k.Config.ID != defaultKeyID && k.Config.ID != "" {
+		k.Sign.Token.DefaultMethod = k.getDefaultMethod(k.Sign.Token)
+		// The asymmetric keys are published in JWKS, hence the tokens
+		// signed with them always reference the key id.
+		if k.Config.ID != "" && (k.Config.ID != defaultKeyID || k.Config.Algorithm != "hmac") {
 			k.Sign.Token.injectKeyID = true
 		}
 	}
@@ -218,8 +255,17 @@ func (k *CryptoKey) enableUsage() {
 		}
 		k.Verify.Token.Name = k.Config.TokenName
 		k.Verify.Token.MaxLifetime = k.Config.TokenLifetime
-		k.Verify.Token.DefaultMethod = k.Verify.Token.PreferredMethods[0]
+		k.Verify.Token.DefaultMethod = k.getDefaultMethod(k.Verify.Token)
+	}
+}
+
+// getDefaultMethod returns the preferred sign method of the key config,
+// when the key supports it, or the first preferred method of the token.
+func (k *CryptoKey) getDefaultMethod(op *CryptoKeyTokenOperator) string {
+	if _, supported := op.Methods[k.Config.PreferredSignMethod]; supported {
+		return k.Config.PreferredSignMethod
 	}
+	return op.PreferredMethods[0]
 }
 
 // SignToken signs data using the requested method and returns it as string.
@@ -250,6 +296,9 @@ func (k *CryptoKey) sign(signMethod, data interface{}) (interface{}, error) {
 	}
 
 	header := map[string]interface{}{"typ": "JWT", "alg": method}
+	if k.Sign.Token.Name == IDTokenName {
+		header["typ"] = IDTokenType
+	}
 	if k.Sign.Token.injectKeyID {
 		header["kid"] = k.Sign.Token.ID
 	}
@@ -270,6 +319,10 @@ func (k *CryptoKey) sign(signMethod, data interface{}) (interface{}, error) {
 		return k.signRSA(method, s)
 	case "ecdsa":
 		return k.signECDSA(method, s)
+	case "rsapss":
+		return k.signRSAPSS(method, s)
+	case "eddsa":
+		return k.signEdDSA(method, s)
 	}
 
 	return nil, errors.ErrDataSigningFailed.WithArgs(method, "unsupported method")
@@ -277,19 +330,37 @@ func (k *CryptoKey) sign(signMethod, data interface{}) (interface{}, error) {
 
 // ProvideKey returns the appropriate encryption key.
 func (k *CryptoKey) ProvideKey(token *jwtlib.Token) (interface{}, error) {
+	if k.remote != nil {
+		return k.remote.provideKey(token)
+	}
 	switch k.Config.Algorithm {
 	case "hmac":
 		if _, validMethod := token.Method.(*jwtlib.SigningMethodHMAC); !validMethod {
 			return nil, errors.ErrUnexpectedSigningMethod.WithArgs("HS", token.Header["alg"])
 		}
 	case "rsa":
-		if _, validMethod := token.Method.(*jwtlib.SigningMethodRSA); !validMethod {
+		// The RSA keys verify both PKCS #1 v1.5 and RSASSA-PSS signatures.
+		switch token.Method.(type) {
+		case *jwtlib.SigningMethodRSA, *jwtlib.SigningMethodRSAPSS:
+		default:
 			return nil, errors.ErrUnexpectedSigningMethod.WithArgs("RS", token.Header["alg"])
 		}
 	case "ecdsa":
 		if _, validMethod := token.Method.(*jwtlib.SigningMethodECDSA); !validMethod {
 			return nil, errors.ErrUnexpectedSigningMethod.WithArgs("ES", token.Header["alg"])
 		}
+	case "rsapss":
+		if _, validMethod := token.Method.(*jwtlib.SigningMethodRSAPSS); !validMethod {
+			return nil, errors.ErrUnexpectedSigningMethod.WithArgs("PS", token.Header["alg"])
+		}
+		// The key parameters may restrict the key to a single method.
+		if _, supported := k.Verify.Token.Methods[token.Method.Alg()]; !supported {
+			return nil, errors.ErrUnexpectedSigningMethod.WithArgs(k.Verify.Token.DefaultMethod, token.Header["alg"])
+		}
+	case "eddsa":
+		if _, validMethod := token.Method.(*jwtlib.SigningMethodEd25519); !validMethod {
+			return nil, errors.ErrUnexpectedSigningMethod.WithArgs("EdDSA", token.Header["alg"])
+		}
 	}
 	return k.Verify.Secret, nil
 }
@@ -327,6 +398,7 @@ func extractKeysFromFile(fp string, cfg *CryptoKeyConfig) ([]*CryptoKey, error)
 
 func extractKey(kb []byte, cfg *CryptoKeyConfig) (*CryptoKey, error) {
 	var curveName string
+	var pssMethods []string
 	k := newCryptoKey()
 	kcfg := *cfg
 	k.Config = &kcfg
@@ -371,7 +443,7 @@ func extractKey(kb []byte, cfg *CryptoKeyConfig) (*CryptoKey, error) {
 			k.Verify.Secret = privKey.Public()
 		}
 	case bytes.Contains(kb, []byte("PRIVATE KEY")):
-		privKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		privKey, err := parsePKCS8PrivateKey(block.Bytes)
 		if err != nil {
 			return nil, err
 		}
@@ -401,8 +473,28 @@ func extractKey(kb []byte, cfg *CryptoKeyConfig) (*CryptoKey, error) {
 				k.Verify.Capable = true
 				k.Verify.Secret = privKey.Public()
 			}
+		case *rsaPSSPrivateKey:
+			k.Config.Algorithm = "rsapss"
+			k.Sign.Capable = true
+			k.Sign.Secret = privKey.PrivateKey
+			pssMethods = privKey.methods
+			switch k.Config.Usage {
+			case "sign":
+			default:
+				k.Verify.Capable = true
+				k.Verify.Secret = privKey.Public()
+			}
+		case ed25519.PrivateKey:
+			k.Config.Algorithm = "eddsa"
+			k.Sign.Capable = true
+			k.Sign.Secret = privKey
+			switch k.Config.Usage {
+			case "sign":
+			default:
+				k.Verify.Capable = true
+				k.Verify.Secret = privKey.Public()
+			}
 		default:
-			// case ed25519.PrivateKey
 			return nil, errors.ErrCryptoKeyConfigUnsupportedPrivateKeyAlgo.WithArgs(privKey)
 		}
 	case bytes.Contains(kb, []byte("RSA PUBLIC KEY")):
@@ -414,7 +506,7 @@ func extractKey(kb []byte, cfg *CryptoKeyConfig) (*CryptoKey, error) {
 		k.Verify.Capable = true
 		k.Verify.Secret = pubKey
 	case bytes.Contains(kb, []byte("PUBLIC KEY")):
-		pubKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+		pubKey, err := parsePKIXPublicKey(block.Bytes)
 		if err != nil {
 			return nil, err
 		}
@@ -431,9 +523,15 @@ func extractKey(kb []byte, cfg *CryptoKeyConfig) (*CryptoKey, error) {
 				return nil, errors.ErrNoECDSACurveParamsFound
 			}
 			curveName = curve.Name
+		case *rsaPSSPublicKey:
+			k.Config.Algorithm = "rsapss"
+			k.Verify.Secret = pubKey.PublicKey
+			pssMethods = pubKey.methods
+		case ed25519.PublicKey:
+			k.Config.Algorithm = "eddsa"
+			k.Verify.Secret = pubKey
 		default:
 			// case *dsa.PublicKey
-			// case ed25519.PublicKey
 			return nil, errors.ErrCryptoKeyConfigUnsupportedPublicKeyAlgo.WithArgs(pubKey)
 		}
 	default:
@@ -460,6 +558,15 @@ func extractKey(kb []byte, cfg *CryptoKeyConfig) (*CryptoKey, error) {
 			k.Verify.Token.PreferredMethods = []string{method}
 		}
 	}
+
+	if len(pssMethods) > 0 {
+		if k.Sign.Capable {
+			k.Sign.Token.PreferredMethods = pssMethods
+		}
+		if k.Verify.Capable {
+			k.Verify.Token.PreferredMethods = pssMethods
+		}
+	}
 	return k, nil
 }
 
@@ -583,6 +690,42 @@ func (k *CryptoKey) signRSA(method, data string) (interface{}, error) {
 	return data + "." + base64.RawURLEncoding.EncodeToString(b), nil
 }
 
+func (k *CryptoKey) signRSAPSS(method, data string) (interface{}, error) {
+	var h crypto.Hash
+	switch method {
+	case "PS256":
+		h = crypto.SHA256
+	case "PS384":
+		h = crypto.SHA384
+	case "PS512":
+		h = crypto.SHA512
+	default:
+		return nil, errors.ErrDataSigningFailed.WithArgs("RSAPSS", "unsupported method")
+	}
+	if !h.Available() {
+		return nil, errors.ErrDataSigningFailed.WithArgs("RSAPSS", "unavailable method")
+	}
+	hf := h.New()
+	hf.Write([]byte(data))
+
+	pk := k.Sign.Secret.(*rsa.PrivateKey)
+	opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}
+	b, err := rsa.SignPSS(rand.Reader, pk, h, hf.Sum(nil), opts)
+	if err != nil {
+		return nil, errors.ErrDataSigningFailed.WithArgs("RSAPSS", err)
+	}
+	return data + "." + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func (k *CryptoKey) signEdDSA(method, data string) (interface{}, error) {
+	if method != "EdDSA" {
+		return nil, errors.ErrDataSigningFailed.WithArgs("EdDSA", "unsupported method")
+	}
+	pk := k.Sign.Secret.(ed25519.PrivateKey)
+	b := ed25519.Sign(pk, []byte(data))
+	return data + "." + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
 func (k *CryptoKey) signHMAC(method, data string) (interface{}, error) {
 	var h crypto.Hash
 	switch method {
@@ -604,7 +747,9 @@ func (k *CryptoKey) signHMAC(method, data string) (interface{}, error) {
 	return data + "." + base64.RawURLEncoding.EncodeToString(hf.Sum(nil)), nil
 }
 
-func generateKey(cfg *CryptoKeyConfig, tag, algo string) (*CryptoKey, error) {
+// generateKeyPEM generates a private key for the provided signing method
+// and returns it in PEM format.
+func generateKeyPEM(algo string) ([]byte, error) {
 	generateES512Key := func() ([]byte, error) {
 		c := elliptic.P521()
 		priv, err := ecdsa.GenerateKey(c, rand.Reader)
@@ -626,14 +771,48 @@ func generateKey(cfg *CryptoKeyConfig, tag, algo string) (*CryptoKey, error) {
 		)
 		return pemBytes, nil
 	}
-	var (
-		generateKey func() ([]byte, error)
-		generated   bool
-		kb          string
-	)
+	generatePS512Key := func() ([]byte, error) {
+		priv, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		derBytes, err := marshalRSAPSSPrivateKey(priv)
+		if err != nil {
+			return nil, err
+		}
+		pemBytes := pem.EncodeToMemory(
+			&pem.Block{
+				Type:  "PRIVATE KEY",
+				Bytes: derBytes,
+			},
+		)
+		return pemBytes, nil
+	}
+	generateEdDSAKey := func() ([]byte, error) {
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		derBytes, err := x509.MarshalPKCS8PrivateKey(priv)
+		if err != nil {
+			return nil, err
+		}
+		pemBytes := pem.EncodeToMemory(
+			&pem.Block{
+				Type:  "PRIVATE KEY",
+				Bytes: derBytes,
+			},
+		)
+		return pemBytes, nil
+	}
+	var generateKey func() ([]byte, error)
 	switch algo {
 	case "ES512":
 		generateKey = generateES512Key
+	case "PS512":
+		generateKey = generatePS512Key
+	case "EdDSA":
+		generateKey = generateEdDSAKey
 	default:
 		return nil, errors.ErrCryptoKeyStoreAutoGenerateAlgo.WithArgs(algo)
 	}
@@ -643,13 +822,17 @@ func generateKey(cfg *CryptoKeyConfig, tag, algo string) (*CryptoKey, error) {
 			// try again
 			continue
 		}
-		kb = string(pemBytes)
-		generated = true
+		return pemBytes, nil
 	}
+	return nil, errors.ErrCryptoKeyStoreAutoGenerateFailed.WithArgs("failed")
+}
 
-	if !generated {
-		return nil, errors.ErrCryptoKeyStoreAutoGenerateFailed.WithArgs("failed")
+func generateKey(cfg *CryptoKeyConfig, tag, algo string) (*CryptoKey, error) {
+	pemBytes, err := generateKeyPEM(algo)
+	if err != nil {
+		return nil, err
 	}
+	kb := string(pemBytes)
 	if err := shared.Buffer.Add(tag, kb); err != nil {
 		if err.Error() != "not empty" {
 			return nil, errors.ErrCryptoKeyStoreAutoGenerateFailed.WithArgs(err)
@@ -275,6 +275,115 @@ func TestGetKeysFromConfig(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "load private and public ed25519 keys from file path",
+			config: `
+                crypto key k9738a405e99 sign from file ./../../testdata/edkeys/test_2_pri.pem
+                crypto key k9738a405e99 verify from file ./../../testdata/edkeys/test_2_pub.pem
+            `,
+			keyPair: []int{0, 1},
+			want: map[string]interface{}{
+				"config_count": 2,
+				"key_count":    2,
+				"keys": []string{
+					"0: sign   k9738a405e99: ed25519.PrivateKey",
+					"1: verify k9738a405e99: ed25519.PublicKey",
+				},
+			},
+		},
+		{
+			name: "ed25519 key embedded in environment variable",
+			config: `
+                crypto key cb315f43c868 sign-verify from env JWT_SHARED_SECRET
+            `,
+			env: map[string]string{
+				"JWT_SHARED_SECRET": "file:./../../testdata/edkeys/test_1_pri.pem",
+			},
+			keyPair: []int{0, 0},
+			want: map[string]interface{}{
+				"config_count": 1,
+				"key_count":    1,
+				"keys": []string{
+					"0: sign   cb315f43c868: ed25519.PrivateKey",
+					"0: verify cb315f43c868: ed25519.PublicKey",
+				},
+			},
+		},
+		{
+			name: "load keys from ed25519 directory path",
+			config: `
+                crypto key k9738a405e99 verify from directory ./../../testdata/edkeys
+            `,
+			want: map[string]interface{}{
+				"config_count": 1,
+				"key_count":    4,
+				"keys": []string{
+					"0: sign   test_1_pri: ed25519.PrivateKey",
+					"0: verify test_1_pri: ed25519.PublicKey",
+					"1: sign   test_2_pri: ed25519.PrivateKey",
+					"1: verify test_2_pri: ed25519.PublicKey",
+					"2: verify test_2_pub: ed25519.PublicKey",
+					"3: sign   private: ed25519.PrivateKey",
+					"3: verify private: ed25519.PublicKey",
+				},
+			},
+		},
+		{
+			name: "load private and public rsa-pss keys from file path",
+			config: `
+                crypto key k9738a405e99 sign from file ./../../testdata/rspsskeys/test_2_pri.pem
+                crypto key k9738a405e99 verify from file ./../../testdata/rspsskeys/test_2_pub.pem
+            `,
+			keyPair: []int{0, 1},
+			want: map[string]interface{}{
+				"config_count": 2,
+				"key_count":    2,
+				"keys": []string{
+					"0: sign   k9738a405e99: *rsa.PrivateKey",
+					"1: verify k9738a405e99: *rsa.PublicKey",
+				},
+			},
+		},
+		{
+			name: "rsa-pss key embedded in environment variable",
+			config: `
+                crypto key cb315f43c868 sign-verify from env JWT_SHARED_SECRET
+            `,
+			env: map[string]string{
+				"JWT_SHARED_SECRET": "file:./../../testdata/rspsskeys/test_1_pri.pem",
+			},
+			keyPair: []int{0, 0},
+			want: map[string]interface{}{
+				"config_count": 1,
+				"key_count":    1,
+				"keys": []string{
+					"0: sign   cb315f43c868: *rsa.PrivateKey",
+					"0: verify cb315f43c868: *rsa.PublicKey",
+				},
+			},
+		},
+		{
+			name: "load keys from rsa-pss directory path via env vars",
+			config: `
+                crypto key cb315f43c868 sign-verify from env JWT_SECRET_DIR as directory
+            `,
+			env: map[string]string{
+				"JWT_SECRET_DIR": "./../../testdata/rspsskeys",
+			},
+			want: map[string]interface{}{
+				"config_count": 1,
+				"key_count":    4,
+				"keys": []string{
+					"0: sign   test_1_pri: *rsa.PrivateKey",
+					"0: verify test_1_pri: *rsa.PublicKey",
+					"1: sign   test_2_pri: *rsa.PrivateKey",
+					"1: verify test_2_pri: *rsa.PublicKey",
+					"2: verify test_2_pub: *rsa.PublicKey",
+					"3: sign   private: *rsa.PrivateKey",
+					"3: verify private: *rsa.PublicKey",
+				},
+			},
+		},
 		{
 			name: "load keys from rsa directory path",
 			config: `
@@ -542,6 +651,42 @@ func TestGetKeysFromCryptoKeyConfigs(t *testing.T) {
 			shouldErr: true,
 			err:       fmt.Errorf(`walking directory: lstat foo: no such file or directory`),
 		},
+		{
+			name: "generate ecdsa key",
+			config: &CryptoKeyConfig{
+				ID:        "k1",
+				Usage:     "sign-verify",
+				Source:    "generate",
+				Algorithm: "ecdsa",
+			},
+		},
+		{
+			name: "generate rsa-pss key",
+			config: &CryptoKeyConfig{
+				ID:        "k2",
+				Usage:     "sign-verify",
+				Source:    "generate",
+				Algorithm: "rsapss",
+			},
+		},
+		{
+			name: "generate ed25519 key",
+			config: &CryptoKeyConfig{
+				ID:        "k3",
+				Usage:     "sign-verify",
+				Source:    "generate",
+				Algorithm: "eddsa",
+			},
+		},
+		{
+			name: "generate hmac key",
+			config: &CryptoKeyConfig{
+				Source:    "generate",
+				Algorithm: "hmac",
+			},
+			shouldErr: true,
+			err:       fmt.Errorf(`unsupported algorithm for generate: hmac`),
+		},
 		{
 			name: "bad env without file dir path",
 			config: &CryptoKeyConfig{
@@ -0,0 +1,207 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kms
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+	fileutil "github.com/greenpau/go-authcrunch/pkg/util/file"
+	"golang.org/x/crypto/scrypt"
+)
+
+const keyringVersion = 1
+
+// keyringFile is the on-disk format of the keyring. The entries are
+// encrypted with AES-256-GCM using the key derived from the keyring secret.
+type keyringFile struct {
+	Version    int    `json:"version"`
+	Salt       string `json:"salt"`
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// keyringEntry is a key managed by key rotation.
+type keyringEntry struct {
+	ID            string    `json:"id"`
+	TokenName     string    `json:"token_name"`
+	TokenLifetime int       `json:"token_lifetime"`
+	PrivateKey    string    `json:"private_key"`
+	CreatedAt     time.Time `json:"created_at"`
+	// ExpiresAt is set when the key no longer signs tokens. The key
+	// verifies tokens until then.
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// keyring persists the keys managed by key rotation, so that the keys
+// survive restarts and are shared by several replicas.
+type keyring struct {
+	path   string
+	secret string
+	// salt and key are the cached key derivation output.
+	salt []byte
+	key  []byte
+}
+
+func newKeyring(path, secret string) *keyring {
+	return &keyring{
+		path:   path,
+		secret: secret,
+	}
+}
+
+func (kr *keyring) deriveKey(salt []byte) ([]byte, error) {
+	if kr.key != nil && bytes.Equal(kr.salt, salt) {
+		return kr.key, nil
+	}
+	key, err := scrypt.Key([]byte(kr.secret), salt, 32768, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	kr.salt = salt
+	kr.key = key
+	return key, nil
+}
+
+// load returns the keyring entries. A missing keyring has no entries.
+func (kr *keyring) load() ([]*keyringEntry, error) {
+	b, err := os.ReadFile(kr.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.ErrCryptoKeyStoreKeyringLoad.WithArgs(kr.path, err)
+	}
+
+	f := &keyringFile{}
+	if err := json.Unmarshal(b, f); err != nil {
+		return nil, errors.ErrCryptoKeyStoreKeyringLoad.WithArgs(kr.path, err)
+	}
+	if f.Version != keyringVersion {
+		return nil, errors.ErrCryptoKeyStoreKeyringLoad.WithArgs(kr.path, "unsupported version")
+	}
+
+	var salt, nonce, ciphertext []byte
+	for _, item := range []struct {
+		s string
+		b *[]byte
+	}{
+		{f.Salt, &salt},
+		{f.Nonce, &nonce},
+		{f.Ciphertext, &ciphertext},
+	} {
+		*item.b, err = base64.StdEncoding.DecodeString(item.s)
+		if err != nil {
+			return nil, errors.ErrCryptoKeyStoreKeyringLoad.WithArgs(kr.path, err)
+		}
+	}
+
+	key, err := kr.deriveKey(salt)
+	if err != nil {
+		return nil, errors.ErrCryptoKeyStoreKeyringLoad.WithArgs(kr.path, err)
+	}
+	aead, err := newKeyringCipher(key)
+	if err != nil {
+		return nil, errors.ErrCryptoKeyStoreKeyringLoad.WithArgs(kr.path, err)
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, errors.ErrCryptoKeyStoreKeyringLoad.WithArgs(kr.path, "malformed nonce")
+	}
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, errors.ErrCryptoKeyStoreKeyringDecrypt.WithArgs(kr.path)
+	}
+
+	var entries []*keyringEntry
+	if err := json.Unmarshal(plaintext, &entries); err != nil {
+		return nil, errors.ErrCryptoKeyStoreKeyringLoad.WithArgs(kr.path, err)
+	}
+	return entries, nil
+}
+
+// lock acquires the exclusive lock of the keyring shared by the replicas.
+// The lock is held from the load to the save of the keyring, so that the
+// replicas neither rotate the keys concurrently nor overwrite the keys
+// saved by each other.
+func (kr *keyring) lock() (func() error, error) {
+	if err := os.MkdirAll(filepath.Dir(kr.path), 0700); err != nil {
+		return nil, errors.ErrCryptoKeyStoreKeyringLock.WithArgs(kr.path, err)
+	}
+	unlock, err := fileutil.LockFile(kr.path)
+	if err != nil {
+		return nil, errors.ErrCryptoKeyStoreKeyringLock.WithArgs(kr.path, err)
+	}
+	return unlock, nil
+}
+
+// save encrypts the entries and atomically replaces the keyring.
+func (kr *keyring) save(entries []*keyringEntry) error {
+	plaintext, err := json.Marshal(entries)
+	if err != nil {
+		return errors.ErrCryptoKeyStoreKeyringSave.WithArgs(kr.path, err)
+	}
+
+	salt := kr.salt
+	if salt == nil {
+		salt = make([]byte, 16)
+		if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+			return errors.ErrCryptoKeyStoreKeyringSave.WithArgs(kr.path, err)
+		}
+	}
+	key, err := kr.deriveKey(salt)
+	if err != nil {
+		return errors.ErrCryptoKeyStoreKeyringSave.WithArgs(kr.path, err)
+	}
+	aead, err := newKeyringCipher(key)
+	if err != nil {
+		return errors.ErrCryptoKeyStoreKeyringSave.WithArgs(kr.path, err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return errors.ErrCryptoKeyStoreKeyringSave.WithArgs(kr.path, err)
+	}
+
+	f := &keyringFile{
+		Version:    keyringVersion,
+		Salt:       base64.StdEncoding.EncodeToString(salt),
+		Nonce:      base64.StdEncoding.EncodeToString(nonce),
+		Ciphertext: base64.StdEncoding.EncodeToString(aead.Seal(nil, nonce, plaintext, nil)),
+	}
+	b, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return errors.ErrCryptoKeyStoreKeyringSave.WithArgs(kr.path, err)
+	}
+	if err := fileutil.WriteFileAtomic(kr.path, b, 0600); err != nil {
+		return errors.ErrCryptoKeyStoreKeyringSave.WithArgs(kr.path, err)
+	}
+	return nil
+}
+
+func newKeyringCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -16,6 +16,8 @@ package kms
 
 import (
 	"strings"
+	"sync"
+	"time"
 
 	jwtlib "github.com/golang-jwt/jwt/v4"
 	"github.com/greenpau/go-authcrunch/pkg/errors"
@@ -35,17 +37,29 @@ var (
 // CryptoKeyStore constains keys assembled for a specific purpose, i.e. signing or
 // validation.
 type CryptoKeyStore struct {
+	mu         sync.RWMutex
 	keys       []*CryptoKey
 	signKeys   []*CryptoKey
 	verifyKeys []*CryptoKey
 	logger     *zap.Logger
 	defaults   map[string]interface{}
+	// rotationInterval is the interval at which the signing keys are
+	// replaced with newly generated keys.
+	rotationInterval time.Duration
+	// rotationCheckInterval is the interval at which the keystore
+	// checks whether the keys are due for rotation and synchronizes
+	// them with the keyring.
+	rotationCheckInterval time.Duration
+	rotationHandler       func([]*CryptoKey)
+	rotationExit          chan bool
+	keyring               *keyring
 }
 
 // NewCryptoKeyStore returns a new instance of CryptoKeyStore
 func NewCryptoKeyStore() *CryptoKeyStore {
 	ks := &CryptoKeyStore{}
 	ks.defaults = make(map[string]interface{})
+	ks.rotationCheckInterval = defaultKeyRotationCheckInterval
 	return ks
 }
 
@@ -68,10 +82,25 @@ func (ks *CryptoKeyStore) AddDefaults(m map[string]interface{}) error {
 			ks.defaults[k] = v.(string)
 		case "token_lifetime":
 			ks.defaults[k] = int(v.(float64))
+		case "key_rotation_interval":
+			interval, err := parseKeyRotationInterval(v.(string))
+			if err != nil {
+				return err
+			}
+			ks.defaults[k] = v
+			ks.rotationInterval = interval
 		default:
 			ks.defaults[k] = v
 		}
 	}
+	if v, exists := ks.defaults["keyring_path"]; exists && ks.keyring == nil {
+		fp := v.(string)
+		secret, _ := ks.defaults["keyring_secret"].(string)
+		if secret == "" {
+			return errors.ErrCryptoKeyStoreKeyringSecretEmpty.WithArgs(fp)
+		}
+		ks.keyring = newKeyring(fp, secret)
+	}
 	return nil
 }
 
@@ -96,6 +125,9 @@ func (ks *CryptoKeyStore) AutoGenerate(tag, algo string) error {
 		}
 	}
 
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
 	if len(ks.keys) > 0 {
 		return errors.ErrCryptoKeyStoreAutoGenerateNotAvailable
 	}
@@ -106,26 +138,65 @@ func (ks *CryptoKeyStore) AutoGenerate(tag, algo string) error {
 	}
 
 	key.enableUsage()
+	key.createdAt = time.Now()
 	ks.keys = append(ks.keys, key)
 	ks.signKeys = append(ks.signKeys, key)
 	ks.verifyKeys = append(ks.verifyKeys, key)
 	return nil
 }
 
+// GenerateKey adds auto-generated public-private key pair signing and
+// verifying the tokens with the token name, e.g. OpenID Connect ID tokens
+// when the other keys were auto-generated too.
+func (ks *CryptoKeyStore) GenerateKey(tokenName, algo string) error {
+	pemBytes, err := generateKeyPEM(algo)
+	if err != nil {
+		return err
+	}
+	cfg := &CryptoKeyConfig{
+		ID:            tokenName,
+		Usage:         "sign-verify",
+		TokenName:     tokenName,
+		Source:        "config",
+		TokenLifetime: defaultTokenLifetime,
+		parsed:        true,
+		validated:     true,
+	}
+	if v, exists := ks.defaults["token_lifetime"]; exists {
+		cfg.TokenLifetime = v.(int)
+	}
+	key, err := extractKey(pemBytes, cfg)
+	if err != nil {
+		return err
+	}
+	key.enableUsage()
+	key.createdAt = time.Now()
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	return ks.addKey(key)
+}
+
 // GetKeys returns CryptoKey instances from CryptoKeyStore.
 func (ks *CryptoKeyStore) GetKeys() []*CryptoKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
 	return ks.keys
 }
 
 // GetSignKeys returns CryptoKey instances with key signing capabilities
 // from CryptoKeyStore.
 func (ks *CryptoKeyStore) GetSignKeys() []*CryptoKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
 	return ks.signKeys
 }
 
 // GetVerifyKeys returns CryptoKey instances with key verification capabilities
 // from CryptoKeyStore.
 func (ks *CryptoKeyStore) GetVerifyKeys() []*CryptoKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
 	return ks.verifyKeys
 }
 
@@ -147,6 +218,8 @@ func (ks *CryptoKeyStore) AddKeysWithConfigs(cfgs []*CryptoKeyConfig) error {
 // HasVerifyKeys returns true if CryptoKeyStore has key verification
 // capabilities.
 func (ks *CryptoKeyStore) HasVerifyKeys() error {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
 	if len(ks.verifyKeys) > 0 {
 		return nil
 	}
@@ -156,6 +229,8 @@ func (ks *CryptoKeyStore) HasVerifyKeys() error {
 // HasSignKeys returns true if CryptoKeyStore has key signing
 // capabilities.
 func (ks *CryptoKeyStore) HasSignKeys() error {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
 	if len(ks.signKeys) > 0 {
 		return nil
 	}
@@ -174,9 +249,34 @@ func (ks *CryptoKeyStore) AddKeys(keys []*CryptoKey) error {
 
 // AddKey adds CryptoKey instance to CryptoKeyStore.
 func (ks *CryptoKeyStore) AddKey(k *CryptoKey) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	return ks.addKey(k)
+}
+
+// ReplaceKeys replaces the CryptoKey instances of CryptoKeyStore, e.g.
+// with the keys of another CryptoKeyStore after a key rotation.
+func (ks *CryptoKeyStore) ReplaceKeys(keys []*CryptoKey) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.keys = nil
+	ks.signKeys = nil
+	ks.verifyKeys = nil
+	for _, k := range keys {
+		if err := ks.addKey(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ks *CryptoKeyStore) addKey(k *CryptoKey) error {
 	if k == nil {
 		return errors.ErrCryptoKeyStoreAddKeyNil
 	}
+	if k.createdAt.IsZero() {
+		k.createdAt = time.Now()
+	}
 	if k.Sign != nil {
 		if k.Sign.Capable {
 			ks.signKeys = append(ks.signKeys, k)
@@ -196,16 +296,27 @@ func (ks *CryptoKeyStore) AddKey(k *CryptoKey) error {
 
 // ParseToken parses JWT token and returns User instance.
 func (ks *CryptoKeyStore) ParseToken(ar *requests.AuthorizationRequest) (*user.User, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
 	for _, k := range ks.verifyKeys {
 		if _, exists := reservedTokenNames[ar.Token.Name]; !exists {
 			if ar.Token.Name != k.Verify.Token.Name {
 				continue
 			}
+		} else if k.Verify.Token.Name == IDTokenName {
+			// The ID tokens are not access tokens.
+			continue
 		}
 		parsedToken, err := jwtlib.Parse(ar.Token.Payload, k.ProvideKey)
 		if err != nil && !strings.Contains(err.Error(), "is expired") {
 			continue
 		}
+		if typ, _ := parsedToken.Header["typ"].(string); strings.EqualFold(typ, IDTokenType) && k.Verify.Token.Name != IDTokenName {
+			// The ID tokens are not access tokens, even when the key
+			// signing them verifies access tokens too, e.g. a key of a
+			// remote key set.
+			return nil, errors.ErrCryptoKeyStoreParseTokenIDToken
+		}
 
 		userData := make(map[string]interface{})
 		errData := make(map[string]interface{})
@@ -240,11 +351,15 @@ func (ks *CryptoKeyStore) ParseToken(ar *requests.AuthorizationRequest) (*user.U
 
 // SignToken signs user claims and add signed token to user identity.
 func (ks *CryptoKeyStore) SignToken(tokenName, signMethod interface{}, usr *user.User) error {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
 	for _, k := range ks.signKeys {
 		if tokenName != nil {
 			if tokenName.(string) != k.Sign.Token.Name {
 				continue
 			}
+		} else if k.Sign.Token.Name == IDTokenName {
+			continue
 		}
 		response, err := k.sign(signMethod, usr.AsMap())
 		if err != nil {
@@ -257,13 +372,53 @@ func (ks *CryptoKeyStore) SignToken(tokenName, signMethod interface{}, usr *user
 	return errors.ErrCryptoKeyStoreSignTokenFailed
 }
 
+// SignClaims signs the claims with the first asymmetric signing key of the
+// token name and returns the signed token, e.g. an OpenID Connect ID token.
+// The recipients of the token verify it with the keys published in JWKS,
+// hence the shared secret keys are skipped.
+func (ks *CryptoKeyStore) SignClaims(tokenName string, signMethod interface{}, claims map[string]interface{}) (string, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	k := ks.getAsymmetricSignKey(tokenName)
+	if k == nil {
+		return "", errors.ErrCryptoKeyStoreSignTokenFailed
+	}
+	response, err := k.sign(signMethod, claims)
+	if err != nil {
+		return "", err
+	}
+	return response.(string), nil
+}
+
+// HasAsymmetricSignKey returns true if CryptoKeyStore has a public-private
+// key pair signing the tokens with the token name.
+func (ks *CryptoKeyStore) HasAsymmetricSignKey(tokenName string) bool {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.getAsymmetricSignKey(tokenName) != nil
+}
+
+func (ks *CryptoKeyStore) getAsymmetricSignKey(tokenName string) *CryptoKey {
+	for _, k := range ks.signKeys {
+		if k.Config.Algorithm == "hmac" || k.Sign.Token.Name != tokenName {
+			continue
+		}
+		return k
+	}
+	return nil
+}
+
 // GetTokenLifetime returns lifetime for a signed token.
 func (ks *CryptoKeyStore) GetTokenLifetime(tokenName, signMethod interface{}) int {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
 	for _, k := range ks.signKeys {
 		if tokenName != nil {
 			if tokenName.(string) != k.Sign.Token.Name {
 				continue
 			}
+		} else if k.Sign.Token.Name == IDTokenName {
+			continue
 		}
 		return k.Sign.Token.MaxLifetime
 	}
@@ -310,6 +310,23 @@ func TestCryptoKeyStoreAutoGenerate(t *testing.T) {
 			// shouldErr: true,
 			//err:       fmt.Errorf(`kms: file "foo" is not supported due to extension type`),
 		},
+		{
+			name:      "generate ps512 key pair",
+			tag:       "ps512",
+			algorithm: "PS512",
+		},
+		{
+			name:      "generate eddsa key pair",
+			tag:       "eddsa",
+			algorithm: "EdDSA",
+		},
+		{
+			name:      "generate rs256 key pair",
+			tag:       "rs256",
+			algorithm: "RS256",
+			shouldErr: true,
+			err:       errors.ErrCryptoKeyStoreAutoGenerateAlgo.WithArgs("RS256"),
+		},
 	}
 	for _, tc := range testcases {
 		t.Run(tc.name, func(t *testing.T) {
@@ -320,6 +337,75 @@ func TestCryptoKeyStoreAutoGenerate(t *testing.T) {
 			if tests.EvalErrWithLog(t, err, nil, tc.shouldErr, tc.err, msgs) {
 				return
 			}
+			token := newTestSignedToken(t, ks)
+			tests.EvalObjectsWithLog(t, "token valid", true, isValidTestToken(ks, token), msgs)
+		})
+	}
+}
+
+func TestCryptoKeyStoreGenerateKey(t *testing.T) {
+	var testcases = []struct {
+		name      string
+		tokenName string
+		want      map[string]interface{}
+		shouldErr bool
+		err       error
+	}{
+		{
+			name:      "parse id token as id token",
+			tokenName: IDTokenName,
+			want: map[string]interface{}{
+				"sub": "jsmith",
+			},
+		},
+		{
+			name:      "parse id token as access token",
+			tokenName: "access_token",
+			shouldErr: true,
+			err:       errors.ErrCryptoKeyStoreParseTokenFailed,
+		},
+		{
+			name:      "parse id token as bearer token",
+			tokenName: "bearer",
+			shouldErr: true,
+			err:       errors.ErrCryptoKeyStoreParseTokenFailed,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			ks := NewCryptoKeyStore()
+			if err := ks.AutoGenerate("default", "ES512"); err != nil {
+				t.Fatalf("failed generating access token key: %v", err)
+			}
+			if ks.HasAsymmetricSignKey(IDTokenName) {
+				t.Fatalf("unexpected id token key")
+			}
+			if err := ks.GenerateKey(IDTokenName, "ES512"); err != nil {
+				t.Fatalf("failed generating id token key: %v", err)
+			}
+			if !ks.HasAsymmetricSignKey(IDTokenName) {
+				t.Fatalf("id token key not found")
+			}
+			s, err := ks.SignClaims(IDTokenName, nil, map[string]interface{}{
+				"sub": "jsmith",
+				"exp": time.Now().Add(10 * time.Minute).Unix(),
+			})
+			if err != nil {
+				t.Fatalf("failed signing claims: %v", err)
+			}
+
+			ar := requests.NewAuthorizationRequest()
+			ar.Token.Name = tc.tokenName
+			ar.Token.Payload = s
+			usr, err := ks.ParseToken(ar)
+			if tests.EvalErrWithLog(t, err, "parse token", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			got := map[string]interface{}{
+				"sub": usr.Claims.Subject,
+			}
+			tests.EvalObjectsWithLog(t, "claims", tc.want, got, msgs)
 		})
 	}
 }
@@ -30,19 +30,34 @@ var (
 		"ES256": "ecdsa",
 		"ES384": "ecdsa",
 		"ES512": "ecdsa",
+		"PS256": "rsapss",
+		"PS384": "rsapss",
+		"PS512": "rsapss",
+		"EdDSA": "eddsa",
 	}
 
 	algoMethodMap = map[string][]string{
-		"hmac":  []string{"HS512", "HS384", "HS256"},
-		"rsa":   []string{"RS512", "RS384", "RS256"},
-		"ecdsa": []string{"ES512", "ES384", "ES256"},
+		"hmac":   []string{"HS512", "HS384", "HS256"},
+		"rsa":    []string{"RS512", "RS384", "RS256", "PS512", "PS384", "PS256"},
+		"ecdsa":  []string{"ES512", "ES384", "ES256"},
+		"rsapss": []string{"PS512", "PS384", "PS256"},
+		"eddsa":  []string{"EdDSA"},
 	}
 )
 
 // getSigningMethodAlias returns alias for the provided signing method.
 func getSigningMethodAlias(s string) string {
-	s = strings.ToUpper(s)
-	if v, exists := signingMethods[s]; exists {
+	v, exists := signingMethods[s]
+	if !exists {
+		// The method names are case-insensitive, e.g. EdDSA and EDDSA.
+		for m, alias := range signingMethods {
+			if strings.EqualFold(m, s) {
+				v, exists = alias, true
+				break
+			}
+		}
+	}
+	if exists {
 		arr := strings.SplitN(v, ",", 2)
 		return strings.TrimSpace(arr[0])
 	}
@@ -34,6 +34,12 @@ func TestGetSigningMethodAlias(t *testing.T) {
 		{name: "ES256", want: "ecdsa"},
 		{name: "ES384", want: "ecdsa"},
 		{name: "ES512", want: "ecdsa"},
+		{name: "PS256", want: "rsapss"},
+		{name: "PS384", want: "rsapss"},
+		{name: "PS512", want: "rsapss"},
+		{name: "EdDSA", want: "eddsa"},
+		{name: "EDDSA", want: "eddsa"},
+		{name: "es512", want: "ecdsa"},
 		{name: "TBD", want: "unknown"},
 	}
 	for _, tc := range testcases {
@@ -0,0 +1,536 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kms
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultKeyRotationCheckInterval = time.Minute
+	minKeyRotationInterval          = time.Minute
+	keyRotationSignMethod           = "ES512"
+)
+
+// KeyRotationStatus is the state of the scheduled signing key rotation.
+type KeyRotationStatus struct {
+	Interval     string    `json:"interval,omitempty" xml:"interval,omitempty" yaml:"interval,omitempty"`
+	SigningKeys  []string  `json:"signing_keys,omitempty" xml:"signing_keys,omitempty" yaml:"signing_keys,omitempty"`
+	LastRotation time.Time `json:"last_rotation,omitempty" xml:"last_rotation,omitempty" yaml:"last_rotation,omitempty"`
+	NextRotation time.Time `json:"next_rotation,omitempty" xml:"next_rotation,omitempty" yaml:"next_rotation,omitempty"`
+}
+
+func parseKeyRotationInterval(s string) (time.Duration, error) {
+	interval, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, errors.ErrCryptoKeyStoreKeyRotationInterval.WithArgs(s, err)
+	}
+	if interval < minKeyRotationInterval {
+		return 0, errors.ErrCryptoKeyStoreKeyRotationInterval.WithArgs(s, fmt.Sprintf("must be at least %s", minKeyRotationInterval))
+	}
+	return interval, nil
+}
+
+// SetKeyRotationHandler sets the function receiving the verification keys
+// of CryptoKeyStore whenever the keys change, e.g. the token validators
+// sharing the keys.
+func (ks *CryptoKeyStore) SetKeyRotationHandler(fn func([]*CryptoKey)) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.rotationHandler = fn
+}
+
+// StartKeyRotation synchronizes the keys with the keyring, if any, and
+// starts the scheduled rotation of the signing keys. When the keyring has
+// no signing keys, the keystore generates one and persists it in the
+// keyring.
+func (ks *CryptoKeyStore) StartKeyRotation() error {
+	return ks.startKeyManagement(true)
+}
+
+// StartKeyringSync periodically loads the keys from the keyring. Unlike
+// StartKeyRotation, it never generates keys and never writes to the keyring.
+func (ks *CryptoKeyStore) StartKeyringSync() error {
+	return ks.startKeyManagement(false)
+}
+
+// StopKeyRotation stops the scheduled rotation or keyring synchronization.
+func (ks *CryptoKeyStore) StopKeyRotation() {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if ks.rotationExit != nil {
+		close(ks.rotationExit)
+		ks.rotationExit = nil
+	}
+}
+
+// RotateKeys replaces the signing keys with newly generated keys. The
+// replaced keys verify tokens until the tokens signed by them expire.
+func (ks *CryptoKeyStore) RotateKeys() error {
+	ks.mu.Lock()
+	if ks.keyring != nil {
+		unlock, err := ks.keyring.lock()
+		if err != nil {
+			ks.mu.Unlock()
+			return err
+		}
+		defer unlock()
+		if _, err := ks.syncKeyring(time.Now()); err != nil {
+			ks.mu.Unlock()
+			return err
+		}
+	}
+	if err := ks.rotateKeys(time.Now()); err != nil {
+		ks.mu.Unlock()
+		return err
+	}
+	if ks.keyring != nil {
+		if err := ks.saveKeyring(); err != nil {
+			ks.mu.Unlock()
+			return err
+		}
+	}
+	ks.mu.Unlock()
+	ks.notifyKeyRotation()
+	return nil
+}
+
+// GetKeyRotationStatus returns the state of the scheduled key rotation.
+// It returns nil when the key rotation is disabled.
+func (ks *CryptoKeyStore) GetKeyRotationStatus() *KeyRotationStatus {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	if ks.rotationInterval == 0 {
+		return nil
+	}
+	status := &KeyRotationStatus{
+		Interval: ks.rotationInterval.String(),
+	}
+	for _, k := range ks.signKeys {
+		status.SigningKeys = append(status.SigningKeys, k.Config.ID)
+		if k.createdAt.After(status.LastRotation) {
+			status.LastRotation = k.createdAt
+		}
+	}
+	if !status.LastRotation.IsZero() {
+		status.NextRotation = status.LastRotation.Add(ks.rotationInterval)
+	}
+	return status
+}
+
+func (ks *CryptoKeyStore) startKeyManagement(rotate bool) error {
+	if ks.keyring == nil && (!rotate || ks.rotationInterval == 0) {
+		return nil
+	}
+
+	changed, err := ks.manageKeys(time.Now(), rotate)
+	if err != nil {
+		return err
+	}
+	if changed {
+		ks.notifyKeyRotation()
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if ks.rotationExit != nil {
+		return nil
+	}
+	ks.rotationExit = make(chan bool)
+	go ks.runKeyManagement(ks.rotationExit, rotate)
+	return nil
+}
+
+func (ks *CryptoKeyStore) runKeyManagement(exit chan bool, rotate bool) {
+	ticker := time.NewTicker(ks.rotationCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-exit:
+			return
+		case <-ticker.C:
+			changed, err := ks.manageKeys(time.Now(), rotate)
+			if err != nil && ks.logger != nil {
+				ks.logger.Warn("failed managing keystore keys", zap.Error(err))
+			}
+			if changed {
+				ks.notifyKeyRotation()
+			}
+		}
+	}
+}
+
+// manageKeys synchronizes the keys with the keyring, rotates the signing
+// keys when they are due, and removes the expired keys. It returns true
+// when the keys changed.
+func (ks *CryptoKeyStore) manageKeys(now time.Time, rotate bool) (bool, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	var changed bool
+	if ks.keyring != nil {
+		if rotate {
+			unlock, err := ks.keyring.lock()
+			if err != nil {
+				return false, err
+			}
+			defer unlock()
+		}
+		synced, err := ks.syncKeyring(now)
+		if err != nil {
+			return false, err
+		}
+		changed = synced
+	}
+
+	if rotate && ks.isRotationDue(now) {
+		if err := ks.rotateKeys(now); err != nil {
+			return changed, err
+		}
+		changed = true
+	}
+
+	if ks.pruneKeys(now) {
+		changed = true
+	}
+
+	if rotate && ks.keyring != nil && changed {
+		if err := ks.saveKeyring(); err != nil {
+			return changed, err
+		}
+	}
+	return changed, nil
+}
+
+// isRotationDue returns true when the signing keys are older than the
+// rotation interval, or when the keyring is expected to hold the signing
+// keys but the keys are not from the keyring.
+func (ks *CryptoKeyStore) isRotationDue(now time.Time) bool {
+	if len(ks.signKeys) == 0 {
+		return ks.rotationInterval > 0 || ks.keyring != nil
+	}
+	for _, k := range ks.signKeys {
+		if ks.keyring != nil && !k.rotated {
+			return true
+		}
+		if ks.rotationInterval > 0 && now.Sub(k.createdAt) >= ks.rotationInterval {
+			return true
+		}
+	}
+	return false
+}
+
+// rotateKeys generates a new signing key for each token name and retires
+// the previous signing keys.
+func (ks *CryptoKeyStore) rotateKeys(now time.Time) error {
+	type tokenParams struct {
+		name     string
+		lifetime int
+	}
+	var params []*tokenParams
+	seen := make(map[string]bool)
+	for _, k := range ks.signKeys {
+		if seen[k.Sign.Token.Name] {
+			continue
+		}
+		seen[k.Sign.Token.Name] = true
+		params = append(params, &tokenParams{k.Sign.Token.Name, k.Sign.Token.MaxLifetime})
+	}
+	if len(params) == 0 {
+		p := &tokenParams{defaultTokenName, defaultTokenLifetime}
+		if v, exists := ks.defaults["token_name"]; exists {
+			p.name = v.(string)
+		}
+		if v, exists := ks.defaults["token_lifetime"]; exists {
+			p.lifetime = v.(int)
+		}
+		params = append(params, p)
+	}
+
+	var newKeys []*CryptoKey
+	for _, p := range params {
+		k, err := newRotatedKey(p.name, p.lifetime, now)
+		if err != nil {
+			return errors.ErrCryptoKeyStoreKeyRotationFailed.WithArgs(err)
+		}
+		newKeys = append(newKeys, k)
+	}
+
+	var retiredKeyIDs, newKeyIDs []string
+	for _, k := range ks.signKeys {
+		ks.retireKey(k, now)
+		retiredKeyIDs = append(retiredKeyIDs, k.Config.ID)
+	}
+	ks.signKeys = nil
+	for _, k := range newKeys {
+		ks.addKey(k)
+		newKeyIDs = append(newKeyIDs, k.Config.ID)
+	}
+
+	if ks.logger != nil {
+		ks.logger.Info(
+			"rotated signing keys",
+			zap.Strings("key_ids", newKeyIDs),
+			zap.Strings("retired_key_ids", retiredKeyIDs),
+		)
+	}
+	return nil
+}
+
+// retireKey disables signing with the key. The key verifies tokens until
+// the tokens signed by it expire.
+func (ks *CryptoKeyStore) retireKey(k *CryptoKey, now time.Time) {
+	lifetime := k.Sign.Token.MaxLifetime
+	if lifetime == 0 {
+		lifetime = defaultTokenLifetime
+	}
+	k.Sign.Capable = false
+	k.Sign.Token.Capable = false
+	if k.expiresAt.IsZero() {
+		k.expiresAt = now.Add(time.Duration(lifetime) * time.Second)
+	}
+}
+
+// pruneKeys removes the retired keys whose tokens expired.
+func (ks *CryptoKeyStore) pruneKeys(now time.Time) bool {
+	var keys, signKeys, verifyKeys []*CryptoKey
+	var expiredKeyIDs []string
+	for _, k := range ks.keys {
+		if !k.expiresAt.IsZero() && !now.Before(k.expiresAt) {
+			expiredKeyIDs = append(expiredKeyIDs, k.Config.ID)
+			continue
+		}
+		keys = append(keys, k)
+		if k.Sign.Capable {
+			signKeys = append(signKeys, k)
+		}
+		if k.Verify.Capable {
+			verifyKeys = append(verifyKeys, k)
+		}
+	}
+	if len(expiredKeyIDs) == 0 {
+		return false
+	}
+	ks.keys = keys
+	ks.signKeys = signKeys
+	ks.verifyKeys = verifyKeys
+	if ks.logger != nil {
+		ks.logger.Info("removed expired keys", zap.Strings("key_ids", expiredKeyIDs))
+	}
+	return true
+}
+
+// syncKeyring adds the keys found in the keyring and retires the keys
+// retired by other keystores sharing the keyring. The newest keyring key
+// for each token name becomes the signing key.
+func (ks *CryptoKeyStore) syncKeyring(now time.Time) (bool, error) {
+	entries, err := ks.keyring.load()
+	if err != nil {
+		return false, err
+	}
+
+	var changed bool
+	var addedKeyIDs []string
+	existing := make(map[string]*CryptoKey)
+	for _, k := range ks.keys {
+		if k.rotated {
+			existing[k.Config.ID] = k
+		}
+	}
+	for _, entry := range entries {
+		if !entry.ExpiresAt.IsZero() && !now.Before(entry.ExpiresAt) {
+			continue
+		}
+		if k, exists := existing[entry.ID]; exists {
+			if !entry.ExpiresAt.IsZero() && k.Sign.Capable {
+				k.expiresAt = entry.ExpiresAt
+				ks.retireKey(k, now)
+				changed = true
+			}
+			continue
+		}
+		k, err := newKeyFromKeyringEntry(ks.keyring.path, entry)
+		if err != nil {
+			return false, err
+		}
+		ks.addKey(k)
+		addedKeyIDs = append(addedKeyIDs, k.Config.ID)
+		changed = true
+	}
+
+	// Keep a single signing key per token name, preferring the newest key
+	// from the keyring.
+	signers := make(map[string]*CryptoKey)
+	for _, k := range ks.signKeys {
+		if !k.Sign.Capable {
+			continue
+		}
+		cur, exists := signers[k.Sign.Token.Name]
+		if !exists || (k.rotated && !cur.rotated) || (k.rotated == cur.rotated && k.createdAt.After(cur.createdAt)) {
+			signers[k.Sign.Token.Name] = k
+		}
+	}
+	var signKeys []*CryptoKey
+	for _, k := range ks.signKeys {
+		if !k.Sign.Capable {
+			continue
+		}
+		if signers[k.Sign.Token.Name] != k {
+			ks.retireKey(k, now)
+			changed = true
+			continue
+		}
+		signKeys = append(signKeys, k)
+	}
+	ks.signKeys = signKeys
+
+	if len(addedKeyIDs) > 0 && ks.logger != nil {
+		ks.logger.Info(
+			"loaded keys from keyring",
+			zap.String("keyring_path", ks.keyring.path),
+			zap.Strings("key_ids", addedKeyIDs),
+		)
+	}
+	return changed, nil
+}
+
+// saveKeyring persists the keys managed by key rotation. The keys found
+// in the keyring, but unknown to the keystore, e.g. added by another
+// replica, are preserved.
+func (ks *CryptoKeyStore) saveKeyring() error {
+	entries, err := ks.keyring.load()
+	if err != nil {
+		return err
+	}
+	m := make(map[string]*keyringEntry)
+	for _, entry := range entries {
+		m[entry.ID] = entry
+	}
+	for _, k := range ks.keys {
+		if !k.rotated {
+			continue
+		}
+		entry, err := newKeyringEntry(k)
+		if err != nil {
+			return errors.ErrCryptoKeyStoreKeyringSave.WithArgs(ks.keyring.path, err)
+		}
+		m[entry.ID] = entry
+	}
+
+	now := time.Now()
+	entries = nil
+	for _, entry := range m {
+		if !entry.ExpiresAt.IsZero() && !now.Before(entry.ExpiresAt) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+	})
+	return ks.keyring.save(entries)
+}
+
+func (ks *CryptoKeyStore) notifyKeyRotation() {
+	ks.mu.RLock()
+	fn := ks.rotationHandler
+	keys := ks.verifyKeys
+	ks.mu.RUnlock()
+	if fn != nil {
+		fn(keys)
+	}
+}
+
+func newRotatedKey(tokenName string, tokenLifetime int, now time.Time) (*CryptoKey, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	pemBytes, err := generateKeyPEM(keyRotationSignMethod)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &CryptoKeyConfig{
+		ID:            hex.EncodeToString(b),
+		Usage:         "sign-verify",
+		TokenName:     tokenName,
+		TokenLifetime: tokenLifetime,
+		Source:        "config",
+		parsed:        true,
+		validated:     true,
+	}
+	k, err := extractKey(pemBytes, cfg)
+	if err != nil {
+		return nil, err
+	}
+	k.enableUsage()
+	k.rotated = true
+	k.createdAt = now
+	return k, nil
+}
+
+func newKeyFromKeyringEntry(fp string, entry *keyringEntry) (*CryptoKey, error) {
+	cfg := &CryptoKeyConfig{
+		ID:            entry.ID,
+		Usage:         "sign-verify",
+		TokenName:     entry.TokenName,
+		TokenLifetime: entry.TokenLifetime,
+		Source:        "config",
+		parsed:        true,
+		validated:     true,
+	}
+	k, err := extractKey([]byte(entry.PrivateKey), cfg)
+	if err != nil {
+		return nil, errors.ErrCryptoKeyStoreKeyringEntry.WithArgs(fp, entry.ID, err)
+	}
+	k.enableUsage()
+	k.rotated = true
+	k.createdAt = entry.CreatedAt
+	if !entry.ExpiresAt.IsZero() {
+		k.Sign.Capable = false
+		k.Sign.Token.Capable = false
+		k.expiresAt = entry.ExpiresAt
+	}
+	return k, nil
+}
+
+func newKeyringEntry(k *CryptoKey) (*keyringEntry, error) {
+	pk, ok := k.Sign.Secret.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("key %q has unsupported private key type %T", k.Config.ID, k.Sign.Secret)
+	}
+	der, err := x509.MarshalECPrivateKey(pk)
+	if err != nil {
+		return nil, err
+	}
+	return &keyringEntry{
+		ID:            k.Config.ID,
+		TokenName:     k.Config.TokenName,
+		TokenLifetime: k.Config.TokenLifetime,
+		PrivateKey:    string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})),
+		CreatedAt:     k.createdAt,
+		ExpiresAt:     k.expiresAt,
+	}, nil
+}
@@ -0,0 +1,325 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kms
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/greenpau/go-authcrunch/internal/tests"
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/requests"
+)
+
+func newTestRotationKeyStore(t *testing.T, defaults map[string]interface{}) *CryptoKeyStore {
+	ks := NewCryptoKeyStore()
+	if err := ks.AddDefaults(defaults); err != nil {
+		t.Fatalf("failed adding defaults: %v", err)
+	}
+	if err := ks.AutoGenerate("default", "ES512"); err != nil {
+		t.Fatalf("failed auto-generating keys: %v", err)
+	}
+	return ks
+}
+
+func isValidTestToken(ks *CryptoKeyStore, token string) bool {
+	ar := requests.NewAuthorizationRequest()
+	ar.Token.Name = "access_token"
+	ar.Token.Payload = token
+	usr, err := ks.ParseToken(ar)
+	return err == nil && usr != nil
+}
+
+func getTestSigningKeyIDs(ks *CryptoKeyStore) []string {
+	var ids []string
+	for _, k := range ks.GetSignKeys() {
+		ids = append(ids, k.Config.ID)
+	}
+	return ids
+}
+
+func TestKeyRotation(t *testing.T) {
+	ks := newTestRotationKeyStore(t, map[string]interface{}{
+		"key_rotation_interval": "1h",
+	})
+	var handlerKeys []*CryptoKey
+	ks.SetKeyRotationHandler(func(keys []*CryptoKey) {
+		handlerKeys = keys
+	})
+
+	oldToken := newTestSignedToken(t, ks)
+	if err := ks.RotateKeys(); err != nil {
+		t.Fatalf("failed rotating keys: %v", err)
+	}
+	newToken := newTestSignedToken(t, ks)
+	status := ks.GetKeyRotationStatus()
+
+	got := map[string]interface{}{
+		"sign_key_count":     len(ks.GetSignKeys()),
+		"verify_key_count":   len(ks.GetVerifyKeys()),
+		"jwks_key_count":     len(ks.GetJwksKeySet().Keys),
+		"handler_key_count":  len(handlerKeys),
+		"old_token_valid":    isValidTestToken(ks, oldToken),
+		"new_token_valid":    isValidTestToken(ks, newToken),
+		"status_interval":    status.Interval,
+		"status_signing_key": status.SigningKeys[0] == getTestSigningKeyIDs(ks)[0],
+		"status_next":        status.NextRotation.Sub(status.LastRotation),
+	}
+	want := map[string]interface{}{
+		"sign_key_count":     1,
+		"verify_key_count":   2,
+		"jwks_key_count":     2,
+		"handler_key_count":  2,
+		"old_token_valid":    true,
+		"new_token_valid":    true,
+		"status_interval":    "1h0m0s",
+		"status_signing_key": true,
+		"status_next":        time.Hour,
+	}
+	tests.EvalObjectsWithLog(t, "after rotation", want, got, []string{})
+
+	// The retired key is removed once the tokens signed by it expire.
+	changed, err := ks.manageKeys(time.Now().Add(16*time.Minute), true)
+	if err != nil {
+		t.Fatalf("failed managing keys: %v", err)
+	}
+	got = map[string]interface{}{
+		"changed":           changed,
+		"verify_key_count":  len(ks.GetVerifyKeys()),
+		"handler_key_count": len(handlerKeys),
+		"old_token_valid":   isValidTestToken(ks, oldToken),
+		"new_token_valid":   isValidTestToken(ks, newToken),
+	}
+	want = map[string]interface{}{
+		"changed":           true,
+		"verify_key_count":  1,
+		"handler_key_count": 2,
+		"old_token_valid":   false,
+		"new_token_valid":   true,
+	}
+	tests.EvalObjectsWithLog(t, "after expiry", want, got, []string{})
+
+	// The signing key is rotated when it is older than the interval.
+	changed, err = ks.manageKeys(time.Now().Add(61*time.Minute), true)
+	if err != nil {
+		t.Fatalf("failed managing keys: %v", err)
+	}
+	got = map[string]interface{}{
+		"changed":          changed,
+		"sign_key_count":   len(ks.GetSignKeys()),
+		"verify_key_count": len(ks.GetVerifyKeys()),
+	}
+	want = map[string]interface{}{
+		"changed":          true,
+		"sign_key_count":   1,
+		"verify_key_count": 2,
+	}
+	tests.EvalObjectsWithLog(t, "after interval", want, got, []string{})
+}
+
+func TestKeyRotationKeyring(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "keyring.json")
+	defaults := map[string]interface{}{
+		"key_rotation_interval": "24h",
+		"keyring_path":          fp,
+		"keyring_secret":        "foobar",
+	}
+
+	// The first replica generates a key and persists it in the keyring.
+	ks1 := newTestRotationKeyStore(t, defaults)
+	if err := ks1.StartKeyRotation(); err != nil {
+		t.Fatalf("failed starting key rotation: %v", err)
+	}
+	defer ks1.StopKeyRotation()
+
+	// The second replica adopts the key from the keyring.
+	ks2 := newTestRotationKeyStore(t, defaults)
+	if err := ks2.StartKeyRotation(); err != nil {
+		t.Fatalf("failed starting key rotation: %v", err)
+	}
+	defer ks2.StopKeyRotation()
+
+	token1 := newTestSignedToken(t, ks1)
+	got := map[string]interface{}{
+		"shared_signing_key": strings.Join(getTestSigningKeyIDs(ks1), ",") == strings.Join(getTestSigningKeyIDs(ks2), ","),
+		"token_valid":        isValidTestToken(ks2, token1),
+	}
+	want := map[string]interface{}{
+		"shared_signing_key": true,
+		"token_valid":        true,
+	}
+	tests.EvalObjectsWithLog(t, "shared keyring", want, got, []string{})
+
+	// The rotation by the first replica propagates to the second replica.
+	if err := ks1.RotateKeys(); err != nil {
+		t.Fatalf("failed rotating keys: %v", err)
+	}
+	if _, err := ks2.manageKeys(time.Now(), true); err != nil {
+		t.Fatalf("failed managing keys: %v", err)
+	}
+	token2 := newTestSignedToken(t, ks2)
+	got = map[string]interface{}{
+		"shared_signing_key": strings.Join(getTestSigningKeyIDs(ks1), ",") == strings.Join(getTestSigningKeyIDs(ks2), ","),
+		"sign_key_count":     len(ks2.GetSignKeys()),
+		"old_token_valid":    isValidTestToken(ks2, token1),
+		"new_token_valid":    isValidTestToken(ks1, token2),
+	}
+	want = map[string]interface{}{
+		"shared_signing_key": true,
+		"sign_key_count":     1,
+		"old_token_valid":    true,
+		"new_token_valid":    true,
+	}
+	tests.EvalObjectsWithLog(t, "shared rotation", want, got, []string{})
+
+	// The keys survive restarts.
+	ks3 := newTestRotationKeyStore(t, defaults)
+	if err := ks3.StartKeyringSync(); err != nil {
+		t.Fatalf("failed starting keyring sync: %v", err)
+	}
+	defer ks3.StopKeyRotation()
+	got = map[string]interface{}{
+		"old_token_valid": isValidTestToken(ks3, token1),
+		"new_token_valid": isValidTestToken(ks3, token2),
+	}
+	want = map[string]interface{}{
+		"old_token_valid": true,
+		"new_token_valid": true,
+	}
+	tests.EvalObjectsWithLog(t, "restart", want, got, []string{})
+
+	b, err := os.ReadFile(fp)
+	if err != nil {
+		t.Fatalf("failed reading keyring: %v", err)
+	}
+	if strings.Contains(string(b), "PRIVATE KEY") {
+		t.Fatalf("keyring is not encrypted")
+	}
+
+	ks4 := newTestRotationKeyStore(t, map[string]interface{}{
+		"keyring_path":   fp,
+		"keyring_secret": "barfoo",
+	})
+	err = ks4.StartKeyRotation()
+	tests.EvalErrWithLog(t, err, "wrong secret", true, errors.ErrCryptoKeyStoreKeyringDecrypt.WithArgs(fp), []string{})
+}
+
+func TestKeyRotationKeyringConcurrentStart(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "keyring.json")
+	defaults := map[string]interface{}{
+		"key_rotation_interval": "24h",
+		"keyring_path":          fp,
+		"keyring_secret":        "foobar",
+	}
+
+	// The replicas starting at the same time generate a single key.
+	var keystores []*CryptoKeyStore
+	for i := 0; i < 4; i++ {
+		keystores = append(keystores, newTestRotationKeyStore(t, defaults))
+	}
+	var wg sync.WaitGroup
+	for _, ks := range keystores {
+		wg.Add(1)
+		go func(ks *CryptoKeyStore) {
+			defer wg.Done()
+			if _, err := ks.manageKeys(time.Now(), true); err != nil {
+				t.Errorf("failed managing keys: %v", err)
+			}
+		}(ks)
+	}
+	wg.Wait()
+
+	entries, err := newKeyring(fp, "foobar").load()
+	if err != nil {
+		t.Fatalf("failed loading keyring: %v", err)
+	}
+	signingKeyIDs := make(map[string]bool)
+	for _, ks := range keystores {
+		signingKeyIDs[strings.Join(getTestSigningKeyIDs(ks), ",")] = true
+	}
+	got := map[string]interface{}{
+		"keyring_entry_count": len(entries),
+		"signing_key_count":   len(signingKeyIDs),
+	}
+	want := map[string]interface{}{
+		"keyring_entry_count": 1,
+		"signing_key_count":   1,
+	}
+	tests.EvalObjectsWithLog(t, "concurrent start", want, got, []string{})
+}
+
+func TestParseCryptoKeyStoreRotationConfig(t *testing.T) {
+	testcases := []struct {
+		name      string
+		config    string
+		env       map[string]string
+		want      map[string]interface{}
+		shouldErr bool
+		err       error
+	}{
+		{
+			name: "key rotation with keyring",
+			config: strings.Join([]string{
+				"default key rotation 24h",
+				"default keyring path /var/lib/authp/keyring.json",
+				"default keyring secret env KEYRING_SECRET",
+			}, "\n"),
+			env: map[string]string{
+				"KEYRING_SECRET": "foobar",
+			},
+			want: map[string]interface{}{
+				"key_rotation_interval": "24h",
+				"keyring_path":          "/var/lib/authp/keyring.json",
+				"keyring_secret":        "foobar",
+			},
+		},
+		{
+			name:      "key rotation interval too short",
+			config:    "default key rotation 10s",
+			shouldErr: true,
+			err: errors.ErrCryptoKeyConfigEntryInvalid.WithArgs(
+				"default key rotation 10s",
+				errors.ErrCryptoKeyStoreKeyRotationInterval.WithArgs("10s", "must be at least 1m0s"),
+			),
+		},
+		{
+			name:      "keyring secret in empty environment variable",
+			config:    "default keyring secret env KEYRING_EMPTY_SECRET",
+			shouldErr: true,
+			err: errors.ErrCryptoKeyConfigEntryInvalid.WithArgs(
+				"default keyring secret env KEYRING_EMPTY_SECRET",
+				errors.ErrCryptoKeyConfigEmptyEnvVar.WithArgs("KEYRING_EMPTY_SECRET"),
+			),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+			got, err := ParseCryptoKeyStoreConfig(tc.config)
+			if tests.EvalErrWithLog(t, err, "config", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			tests.EvalObjectsWithLog(t, "config", tc.want, got, msgs)
+		})
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kms
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+)
+
+var (
+	// oidRSASSAPSS is the algorithm identifier of the keys restricted to
+	// RSASSA-PSS signatures, see https://tools.ietf.org/html/rfc4055.
+	oidRSASSAPSS = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}
+	oidMGF1      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 8}
+
+	// rsaPSSHashes are the hash algorithms of RSASSA-PSS parameters and
+	// the token signing methods using them.
+	rsaPSSHashes = []struct {
+		oid    asn1.ObjectIdentifier
+		hash   crypto.Hash
+		method string
+	}{
+		{asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}, crypto.SHA256, "PS256"},
+		{asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}, crypto.SHA384, "PS384"},
+		{asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}, crypto.SHA512, "PS512"},
+	}
+)
+
+// rsaPSSPrivateKey is an RSA private key restricted to RSASSA-PSS
+// signatures. When the key parameters restrict the hash algorithm, the
+// methods hold the only permitted signing method.
+type rsaPSSPrivateKey struct {
+	*rsa.PrivateKey
+	methods []string
+}
+
+// rsaPSSPublicKey is an RSA public key restricted to RSASSA-PSS
+// signatures.
+type rsaPSSPublicKey struct {
+	*rsa.PublicKey
+	methods []string
+}
+
+type pkcs8PrivateKey struct {
+	Version    int
+	Algo       pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+type pkixPublicKey struct {
+	Algo      pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+type rsaPSSParameters struct {
+	Hash         pkix.AlgorithmIdentifier `asn1:"explicit,tag:0,optional"`
+	MGF          pkix.AlgorithmIdentifier `asn1:"explicit,tag:1,optional"`
+	SaltLength   int                      `asn1:"explicit,tag:2,optional,default:20"`
+	TrailerField int                      `asn1:"explicit,tag:3,optional,default:1"`
+}
+
+// parsePKCS8PrivateKey parses PKCS #8 private key. Unlike
+// x509.ParsePKCS8PrivateKey, it supports RSASSA-PSS keys.
+func parsePKCS8PrivateKey(der []byte) (interface{}, error) {
+	var key pkcs8PrivateKey
+	if _, err := asn1.Unmarshal(der, &key); err != nil || !key.Algo.Algorithm.Equal(oidRSASSAPSS) {
+		return x509.ParsePKCS8PrivateKey(der)
+	}
+	methods, err := parseRSAPSSParameters(key.Algo.Parameters)
+	if err != nil {
+		return nil, err
+	}
+	privKey, err := x509.ParsePKCS1PrivateKey(key.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return &rsaPSSPrivateKey{PrivateKey: privKey, methods: methods}, nil
+}
+
+// parsePKIXPublicKey parses PKIX public key. Unlike
+// x509.ParsePKIXPublicKey, it supports RSASSA-PSS keys.
+func parsePKIXPublicKey(der []byte) (interface{}, error) {
+	var key pkixPublicKey
+	if _, err := asn1.Unmarshal(der, &key); err != nil || !key.Algo.Algorithm.Equal(oidRSASSAPSS) {
+		return x509.ParsePKIXPublicKey(der)
+	}
+	methods, err := parseRSAPSSParameters(key.Algo.Parameters)
+	if err != nil {
+		return nil, err
+	}
+	pubKey, err := x509.ParsePKCS1PublicKey(key.PublicKey.RightAlign())
+	if err != nil {
+		return nil, err
+	}
+	return &rsaPSSPublicKey{PublicKey: pubKey, methods: methods}, nil
+}
+
+// parseRSAPSSParameters returns the signing methods permitted by
+// RSASSA-PSS parameters. The keys without parameters permit any method.
+func parseRSAPSSParameters(params asn1.RawValue) ([]string, error) {
+	if len(params.FullBytes) == 0 {
+		return nil, nil
+	}
+	var p rsaPSSParameters
+	if _, err := asn1.Unmarshal(params.FullBytes, &p); err != nil {
+		return nil, errors.ErrCryptoKeyConfigUnsupportedRSAPSSParams.WithArgs(err)
+	}
+	for _, h := range rsaPSSHashes {
+		if !p.Hash.Algorithm.Equal(h.oid) {
+			continue
+		}
+		// The tokens are signed with MGF1 using the same hash algorithm
+		// and the salt length equal to the hash length.
+		if len(p.MGF.Algorithm) > 0 {
+			var mgfHash pkix.AlgorithmIdentifier
+			if !p.MGF.Algorithm.Equal(oidMGF1) {
+				return nil, errors.ErrCryptoKeyConfigUnsupportedRSAPSSParams.WithArgs("mask generation function " + p.MGF.Algorithm.String())
+			}
+			if _, err := asn1.Unmarshal(p.MGF.Parameters.FullBytes, &mgfHash); err != nil || !mgfHash.Algorithm.Equal(h.oid) {
+				return nil, errors.ErrCryptoKeyConfigUnsupportedRSAPSSParams.WithArgs("mask generation function hash mismatch")
+			}
+		}
+		if p.SaltLength > h.hash.Size() {
+			return nil, errors.ErrCryptoKeyConfigUnsupportedRSAPSSParams.WithArgs(fmt.Sprintf("salt length %d", p.SaltLength))
+		}
+		return []string{h.method}, nil
+	}
+	if len(p.Hash.Algorithm) == 0 {
+		return nil, errors.ErrCryptoKeyConfigUnsupportedRSAPSSParams.WithArgs("hash algorithm sha1")
+	}
+	return nil, errors.ErrCryptoKeyConfigUnsupportedRSAPSSParams.WithArgs("hash algorithm " + p.Hash.Algorithm.String())
+}
+
+// marshalRSAPSSPrivateKey converts RSA private key to PKCS #8 RSASSA-PSS
+// private key without parameters.
+func marshalRSAPSSPrivateKey(privKey *rsa.PrivateKey) ([]byte, error) {
+	return asn1.Marshal(pkcs8PrivateKey{
+		Algo: pkix.AlgorithmIdentifier{
+			Algorithm: oidRSASSAPSS,
+		},
+		PrivateKey: x509.MarshalPKCS1PrivateKey(privKey),
+	})
+}
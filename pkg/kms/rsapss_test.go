@@ -0,0 +1,251 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kms
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"strings"
+	"testing"
+
+	jwtlib "github.com/golang-jwt/jwt/v4"
+	"github.com/greenpau/go-authcrunch/internal/tests"
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+)
+
+func TestRSAPSSKeys(t *testing.T) {
+	testcases := []struct {
+		name   string
+		config string
+		// method is the method used to sign and verify a token.
+		method    string
+		want      map[string]interface{}
+		shouldErr bool
+		err       error
+	}{
+		{
+			name:   "unrestricted key signs with ps256",
+			config: `crypto key k1 sign-verify from file ./../../testdata/rspsskeys/test_1_pri.pem`,
+			method: "PS256",
+			want: map[string]interface{}{
+				"methods":        []string{"PS512", "PS384", "PS256"},
+				"default_method": "PS512",
+				"valid":          true,
+			},
+		},
+		{
+			name:   "restricted key signs with ps256",
+			config: `crypto key k1 sign-verify from file ./../../testdata/rspsskeys/test_2_pri.pem`,
+			method: "PS256",
+			want: map[string]interface{}{
+				"methods":        []string{"PS256"},
+				"default_method": "PS256",
+				"valid":          true,
+			},
+		},
+		{
+			name:      "restricted key does not sign with ps512",
+			config:    `crypto key k1 sign-verify from file ./../../testdata/rspsskeys/test_2_pri.pem`,
+			method:    "PS512",
+			shouldErr: true,
+			err:       errors.ErrUnsupportedSigningMethod.WithArgs("PS512"),
+		},
+		{
+			name:      "rsa-pss key does not sign with rs256",
+			config:    `crypto key k1 sign-verify from file ./../../testdata/rspsskeys/test_1_pri.pem`,
+			method:    "RS256",
+			shouldErr: true,
+			err:       errors.ErrUnsupportedSigningMethod.WithArgs("RS256"),
+		},
+		{
+			name:   "pkcs8 rsa key signs with ps256",
+			config: `crypto key k1 sign-verify from file ./../../testdata/rskeys/test_1_pri.pem`,
+			method: "PS256",
+			want: map[string]interface{}{
+				"methods":        []string{"RS512", "RS384", "RS256", "PS512", "PS384", "PS256"},
+				"default_method": "RS512",
+				"valid":          true,
+			},
+		},
+		{
+			name:   "pkcs1 rsa key signs with ps512",
+			config: `crypto key k1 sign-verify from file ./../../testdata/rskeys/test_2_pri.pem`,
+			method: "PS512",
+			want: map[string]interface{}{
+				"methods":        []string{"RS512", "RS384", "RS256", "PS512", "PS384", "PS256"},
+				"default_method": "RS512",
+				"valid":          true,
+			},
+		},
+		{
+			name: "rsa key signs with preferred ps256 method by default",
+			config: strings.Join([]string{
+				`crypto key k1 sign-verify from file ./../../testdata/rskeys/test_2_pri.pem`,
+				`crypto key k1 token method PS256`,
+			}, "\n"),
+			want: map[string]interface{}{
+				"methods":        []string{"RS512", "RS384", "RS256", "PS512", "PS384", "PS256"},
+				"default_method": "PS256",
+				"valid":          true,
+			},
+		},
+		{
+			name: "rsa key with unsupported preferred method",
+			config: strings.Join([]string{
+				`crypto key k1 sign-verify from file ./../../testdata/rskeys/test_2_pri.pem`,
+				`crypto key k1 token method ES256`,
+			}, "\n"),
+			shouldErr: true,
+			err:       errors.ErrCryptoKeyConfigSignMethodUnsupported.WithArgs("k1", "ES256"),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			configs, err := ParseCryptoKeyConfigs(tc.config)
+			if err != nil {
+				t.Fatalf("failed parsing configs: %v", err)
+			}
+			ks := NewCryptoKeyStore()
+			if err := ks.AddKeysWithConfigs(configs); err != nil {
+				tests.EvalErrWithLog(t, err, "add keys", tc.shouldErr, tc.err, msgs)
+				return
+			}
+			usr := newTestUser()
+			var method interface{}
+			if tc.method != "" {
+				method = tc.method
+			}
+			err = ks.SignToken(nil, method, usr)
+			if tests.EvalErrWithLog(t, err, "sign", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			got := map[string]interface{}{
+				"methods":        ks.GetSignKeys()[0].Sign.Token.PreferredMethods,
+				"default_method": ks.GetSignKeys()[0].Sign.Token.DefaultMethod,
+				"valid":          isValidTestToken(ks, usr.Token),
+			}
+			tests.EvalObjectsWithLog(t, "rsa-pss", tc.want, got, msgs)
+		})
+	}
+}
+
+func TestRSAPSSProvideKey(t *testing.T) {
+	ks := newTestSigningKeyStore(t, `crypto key k1 verify from file ./../../testdata/rspsskeys/test_2_pub.pem`)
+	k := ks.GetVerifyKeys()[0]
+	for _, method := range []jwtlib.SigningMethod{jwtlib.SigningMethodPS256, jwtlib.SigningMethodPS512, jwtlib.SigningMethodRS256} {
+		token := &jwtlib.Token{Method: method, Header: map[string]interface{}{"alg": method.Alg()}}
+		_, err := k.ProvideKey(token)
+		switch method.Alg() {
+		case "PS256":
+			tests.EvalErrWithLog(t, err, method.Alg(), false, nil, []string{})
+		case "PS512":
+			tests.EvalErrWithLog(t, err, method.Alg(), true, errors.ErrUnexpectedSigningMethod.WithArgs("PS256", "PS512"), []string{})
+		default:
+			tests.EvalErrWithLog(t, err, method.Alg(), true, errors.ErrUnexpectedSigningMethod.WithArgs("PS", "RS256"), []string{})
+		}
+	}
+}
+
+func newTestAlgorithmIdentifier(t *testing.T, oid asn1.ObjectIdentifier, params interface{}) pkix.AlgorithmIdentifier {
+	id := pkix.AlgorithmIdentifier{Algorithm: oid}
+	if params != nil {
+		b, err := asn1.Marshal(params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id.Parameters.FullBytes = b
+	}
+	return id
+}
+
+func TestParseRSAPSSParameters(t *testing.T) {
+	sha256 := rsaPSSHashes[0].oid
+	testcases := []struct {
+		name      string
+		params    interface{}
+		want      []string
+		shouldErr bool
+		err       error
+	}{
+		{
+			name: "no parameters",
+		},
+		{
+			name: "sha256 hash",
+			params: rsaPSSParameters{
+				Hash:       newTestAlgorithmIdentifier(t, sha256, nil),
+				MGF:        newTestAlgorithmIdentifier(t, oidMGF1, newTestAlgorithmIdentifier(t, sha256, nil)),
+				SaltLength: 32,
+			},
+			want: []string{"PS256"},
+		},
+		{
+			name:      "default sha1 hash",
+			params:    rsaPSSParameters{},
+			shouldErr: true,
+			err:       errors.ErrCryptoKeyConfigUnsupportedRSAPSSParams.WithArgs("hash algorithm sha1"),
+		},
+		{
+			name: "mask generation function hash mismatch",
+			params: rsaPSSParameters{
+				Hash: newTestAlgorithmIdentifier(t, sha256, nil),
+				MGF:  newTestAlgorithmIdentifier(t, oidMGF1, newTestAlgorithmIdentifier(t, rsaPSSHashes[2].oid, nil)),
+			},
+			shouldErr: true,
+			err:       errors.ErrCryptoKeyConfigUnsupportedRSAPSSParams.WithArgs("mask generation function hash mismatch"),
+		},
+		{
+			name: "salt length exceeds hash length",
+			params: rsaPSSParameters{
+				Hash:       newTestAlgorithmIdentifier(t, sha256, nil),
+				SaltLength: 64,
+			},
+			shouldErr: true,
+			err:       errors.ErrCryptoKeyConfigUnsupportedRSAPSSParams.WithArgs("salt length 64"),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			var params asn1.RawValue
+			if tc.params != nil {
+				b, err := asn1.Marshal(tc.params)
+				if err != nil {
+					t.Fatal(err)
+				}
+				params.FullBytes = b
+			}
+			got, err := parseRSAPSSParameters(params)
+			if tests.EvalErrWithLog(t, err, "params", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			tests.EvalObjectsWithLog(t, "methods", tc.want, got, msgs)
+		})
+	}
+}
+
+func TestMarshalRSAPSSPrivateKey(t *testing.T) {
+	pemBytes, err := generateKeyPEM("PS512")
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := extractKey(pemBytes, &CryptoKeyConfig{Usage: "sign-verify"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests.EvalObjects(t, "algorithm", "rsapss", k.Config.Algorithm)
+}
@@ -0,0 +1,259 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvstore
+
+import (
+	"encoding/binary"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"go.etcd.io/bbolt"
+)
+
+var boltBucket = []byte("entries")
+
+// boltLocks serializes the access to a database file by the stores of the
+// same process. The file lock taken on open belongs to the open file, i.e.
+// it blocks the other openings of the file in the process until the
+// timeout, rather than waiting for them.
+var boltLocks = struct {
+	sync.Mutex
+	paths map[string]*sync.RWMutex
+}{paths: make(map[string]*sync.RWMutex)}
+
+// getBoltLock returns the lock of the database file. The path must be
+// absolute and clean, so that the stores of the file share the lock
+// whichever path they were configured with.
+func getBoltLock(path string) *sync.RWMutex {
+	boltLocks.Lock()
+	defer boltLocks.Unlock()
+	mu, exists := boltLocks.paths[path]
+	if !exists {
+		mu = &sync.RWMutex{}
+		boltLocks.paths[path] = mu
+	}
+	return mu
+}
+
+// BoltStore is a Store keeping the entries in an embedded database file.
+// The database is opened for the duration of an operation only, so that
+// several processes on the same host share the file. The reads take a
+// shared lock of the file, and the writes take an exclusive one. The
+// timeout limits the wait for the lock held by other processes.
+//
+// The sharing comes at a cost. Each operation opens, locks and maps the
+// file, and each write syncs the file to disk, i.e. the operations are an
+// order of magnitude slower than on a database kept open. See
+// BenchmarkBoltStore. The store suits the portals with moderate traffic,
+// and the redis driver suits the busy ones.
+type BoltStore struct {
+	path    string
+	timeout time.Duration
+	mu      *sync.RWMutex
+	closed  bool
+}
+
+// NewBoltStore returns an instance of BoltStore. The timeout limits the
+// wait for the database file lock held by other processes.
+func NewBoltStore(path string, timeout time.Duration) (*BoltStore, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, errors.ErrKVStoreOpen.WithArgs(BoltDriver, err)
+	}
+	s := &BoltStore{
+		path:    path,
+		timeout: timeout,
+		mu:      getBoltLock(path),
+	}
+	if err := s.update(func(b *bbolt.Bucket) error { return nil }); err != nil {
+		return nil, errors.ErrKVStoreOpen.WithArgs(BoltDriver, err)
+	}
+	return s, nil
+}
+
+func (s *BoltStore) view(fn func(*bbolt.Bucket) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return errors.ErrKVStoreClosed
+	}
+	db, err := bbolt.Open(s.path, 0600, &bbolt.Options{Timeout: s.timeout, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(boltBucket)
+		if b == nil {
+			return errors.ErrKVStoreKeyNotFound
+		}
+		return fn(b)
+	})
+}
+
+func (s *BoltStore) update(fn func(*bbolt.Bucket) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errors.ErrKVStoreClosed
+	}
+	db, err := bbolt.Open(s.path, 0600, &bbolt.Options{Timeout: s.timeout})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(boltBucket)
+		if err != nil {
+			return err
+		}
+		return fn(b)
+	})
+}
+
+// encodeBoltEntry prepends the expiry time of the entry to its value.
+func encodeBoltEntry(value []byte, ttl time.Duration) []byte {
+	var expiresAt int64
+	if ttl > 0 {
+		expiresAt = getExpiry(ttl).UnixNano()
+	}
+	b := make([]byte, 8+len(value))
+	binary.BigEndian.PutUint64(b, uint64(expiresAt))
+	copy(b[8:], value)
+	return b
+}
+
+func isBoltEntryExpired(b []byte, now time.Time) bool {
+	if len(b) < 8 {
+		return true
+	}
+	expiresAt := int64(binary.BigEndian.Uint64(b))
+	return expiresAt != 0 && now.UnixNano() >= expiresAt
+}
+
+// Get returns the value of the key.
+func (s *BoltStore) Get(key string) ([]byte, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+	// The expired entries are left to Purge, so that the reads do not
+	// take the write lock.
+	var value []byte
+	err := s.view(func(b *bbolt.Bucket) error {
+		v := b.Get([]byte(key))
+		if v == nil || isBoltEntryExpired(v, time.Now()) {
+			return errors.ErrKVStoreKeyNotFound
+		}
+		value = append([]byte(nil), v[8:]...)
+		return nil
+	})
+	if err != nil {
+		if err == errors.ErrKVStoreKeyNotFound || err == errors.ErrKVStoreClosed {
+			return nil, err
+		}
+		return nil, errors.ErrKVStoreOperation.WithArgs("get", err)
+	}
+	return value, nil
+}
+
+// Set stores the value of the key.
+func (s *BoltStore) Set(key string, value []byte, ttl time.Duration) error {
+	if err := validateEntry(key, ttl); err != nil {
+		return err
+	}
+	err := s.update(func(b *bbolt.Bucket) error {
+		return b.Put([]byte(key), encodeBoltEntry(value, ttl))
+	})
+	if err != nil {
+		return errors.ErrKVStoreOperation.WithArgs("set", err)
+	}
+	return nil
+}
+
+// Add stores the value of the key unless the key exists.
+func (s *BoltStore) Add(key string, value []byte, ttl time.Duration) error {
+	if err := validateEntry(key, ttl); err != nil {
+		return err
+	}
+	err := s.update(func(b *bbolt.Bucket) error {
+		if v := b.Get([]byte(key)); v != nil && !isBoltEntryExpired(v, time.Now()) {
+			return errors.ErrKVStoreKeyExists
+		}
+		return b.Put([]byte(key), encodeBoltEntry(value, ttl))
+	})
+	if err != nil {
+		if err == errors.ErrKVStoreKeyExists {
+			return err
+		}
+		return errors.ErrKVStoreOperation.WithArgs("add", err)
+	}
+	return nil
+}
+
+// Delete deletes the key.
+func (s *BoltStore) Delete(key string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	err := s.update(func(b *bbolt.Bucket) error {
+		return b.Delete([]byte(key))
+	})
+	if err != nil {
+		return errors.ErrKVStoreOperation.WithArgs("delete", err)
+	}
+	return nil
+}
+
+// Purge deletes expired entries.
+func (s *BoltStore) Purge() error {
+	now := time.Now()
+	err := s.update(func(b *bbolt.Bucket) error {
+		var keys [][]byte
+		if err := b.ForEach(func(k, v []byte) error {
+			if isBoltEntryExpired(v, now) {
+				keys = append(keys, append([]byte(nil), k...))
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.ErrKVStoreOperation.WithArgs("purge", err)
+	}
+	return nil
+}
+
+// GetDriver returns the name of the store implementation.
+func (s *BoltStore) GetDriver() string {
+	return BoltDriver
+}
+
+// Close closes the store. The database file is open only during the
+// operations of the store, hence closing the store releases no lock.
+func (s *BoltStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
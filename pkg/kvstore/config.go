@@ -0,0 +1,123 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvstore
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"strings"
+
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+)
+
+const (
+	// MemoryDriver keeps the entries in the memory of the process.
+	MemoryDriver = "memory"
+	// BoltDriver keeps the entries in an embedded database file, so that
+	// the entries persist across restarts and are shared by the processes
+	// on the host.
+	BoltDriver = "bolt"
+	// RedisDriver keeps the entries in a server speaking Redis protocol.
+	RedisDriver = "redis"
+
+	defaultTimeout int = 5
+)
+
+// Config is a configuration of the key/value store backing the caches.
+type Config struct {
+	// Driver is the store implementation, i.e. memory, bolt, or redis. The
+	// default is memory.
+	Driver string `json:"driver,omitempty" xml:"driver,omitempty" yaml:"driver,omitempty"`
+	// Path is the path to the database file of the bolt driver.
+	Path string `json:"path,omitempty" xml:"path,omitempty" yaml:"path,omitempty"`
+	// Address is the host:port of the server of the redis driver.
+	Address  string `json:"address,omitempty" xml:"address,omitempty" yaml:"address,omitempty"`
+	Password string `json:"password,omitempty" xml:"password,omitempty" yaml:"password,omitempty"`
+	Database int    `json:"database,omitempty" xml:"database,omitempty" yaml:"database,omitempty"`
+	// TLSEnabled enables TLS for the connections to the server of the
+	// redis driver.
+	TLSEnabled bool `json:"tls_enabled,omitempty" xml:"tls_enabled,omitempty" yaml:"tls_enabled,omitempty"`
+	// TLSServerName is the name of the server in its certificate. The
+	// default is the host of the address.
+	TLSServerName string `json:"tls_server_name,omitempty" xml:"tls_server_name,omitempty" yaml:"tls_server_name,omitempty"`
+	// TLSTrustedAuthorities are the paths to the PEM files of the
+	// certificate authorities trusted to issue the server certificate. The
+	// default is the system pool.
+	TLSTrustedAuthorities []string `json:"tls_trusted_authorities,omitempty" xml:"tls_trusted_authorities,omitempty" yaml:"tls_trusted_authorities,omitempty"`
+	TLSInsecureSkipVerify bool     `json:"tls_insecure_skip_verify,omitempty" xml:"tls_insecure_skip_verify,omitempty" yaml:"tls_insecure_skip_verify,omitempty"`
+	// Prefix is prepended to the keys, e.g. to separate the entries of
+	// several deployments sharing a server.
+	Prefix string `json:"prefix,omitempty" xml:"prefix,omitempty" yaml:"prefix,omitempty"`
+	// Timeout is the timeout (in seconds) for acquiring the database file
+	// lock or for communicating with the server. The default is 5 seconds.
+	Timeout int `json:"timeout,omitempty" xml:"timeout,omitempty" yaml:"timeout,omitempty"`
+}
+
+// Validate validates Config.
+func (cfg *Config) Validate() error {
+	cfg.Driver = strings.ToLower(cfg.Driver)
+	switch cfg.Driver {
+	case "":
+		cfg.Driver = MemoryDriver
+	case MemoryDriver:
+	case BoltDriver:
+		if cfg.Path == "" {
+			return errors.ErrKVStoreConfigPathEmpty.WithArgs(cfg.Driver)
+		}
+	case RedisDriver:
+		if cfg.Address == "" {
+			return errors.ErrKVStoreConfigAddressEmpty.WithArgs(cfg.Driver)
+		}
+		if !cfg.TLSEnabled && (cfg.TLSServerName != "" || len(cfg.TLSTrustedAuthorities) > 0 || cfg.TLSInsecureSkipVerify) {
+			return errors.ErrKVStoreConfigTLSDisabled.WithArgs(cfg.Driver)
+		}
+	default:
+		return errors.ErrKVStoreConfigDriverUnsupported.WithArgs(cfg.Driver)
+	}
+	if cfg.Timeout < 0 {
+		return errors.ErrKVStoreConfigTimeout
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	return nil
+}
+
+// GetTLSConfig returns the TLS configuration for the connections to the
+// server of the redis driver. It returns nil when TLS is disabled.
+func (cfg *Config) GetTLSConfig() (*tls.Config, error) {
+	if !cfg.TLSEnabled {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.TLSServerName,
+		InsecureSkipVerify: cfg.TLSInsecureSkipVerify,
+	}
+	for _, authority := range cfg.TLSTrustedAuthorities {
+		pemCerts, err := os.ReadFile(authority)
+		if err != nil {
+			return nil, errors.ErrKVStoreConfigTLSTrustedAuthority.WithArgs(authority, err)
+		}
+		if tlsConfig.RootCAs == nil {
+			tlsConfig.RootCAs = x509.NewCertPool()
+		}
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pemCerts) {
+			return nil, errors.ErrKVStoreConfigTLSTrustedAuthority.WithArgs(authority, "no certificates found")
+		}
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,127 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvstore
+
+import (
+	"sync"
+	"time"
+
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+)
+
+type memoryEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+func (e *memoryEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+// MemoryStore is a Store keeping the entries in the memory of the process.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+}
+
+// NewMemoryStore returns an instance of MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: make(map[string]*memoryEntry),
+	}
+}
+
+// Get returns the value of the key.
+func (s *MemoryStore) Get(key string) ([]byte, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, exists := s.entries[key]
+	if !exists {
+		return nil, errors.ErrKVStoreKeyNotFound
+	}
+	if entry.expired(time.Now()) {
+		delete(s.entries, key)
+		return nil, errors.ErrKVStoreKeyNotFound
+	}
+	return append([]byte(nil), entry.value...), nil
+}
+
+// Set stores the value of the key.
+func (s *MemoryStore) Set(key string, value []byte, ttl time.Duration) error {
+	if err := validateEntry(key, ttl); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = &memoryEntry{
+		value:     append([]byte(nil), value...),
+		expiresAt: getExpiry(ttl),
+	}
+	return nil
+}
+
+// Add stores the value of the key unless the key exists.
+func (s *MemoryStore) Add(key string, value []byte, ttl time.Duration) error {
+	if err := validateEntry(key, ttl); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entry, exists := s.entries[key]; exists && !entry.expired(time.Now()) {
+		return errors.ErrKVStoreKeyExists
+	}
+	s.entries[key] = &memoryEntry{
+		value:     append([]byte(nil), value...),
+		expiresAt: getExpiry(ttl),
+	}
+	return nil
+}
+
+// Delete deletes the key.
+func (s *MemoryStore) Delete(key string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+// Purge deletes expired entries.
+func (s *MemoryStore) Purge() error {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, entry := range s.entries {
+		if entry.expired(now) {
+			delete(s.entries, key)
+		}
+	}
+	return nil
+}
+
+// GetDriver returns the name of the store implementation.
+func (s *MemoryStore) GetDriver() string {
+	return MemoryDriver
+}
+
+// Close releases the resources held by the store.
+func (s *MemoryStore) Close() error {
+	return nil
+}
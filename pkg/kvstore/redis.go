@@ -0,0 +1,278 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvstore
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+)
+
+const maxRedisIdleConns = 8
+
+// redisError is an error reply of the server.
+type redisError string
+
+func (e redisError) Error() string {
+	return string(e)
+}
+
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// RedisStore is a Store keeping the entries in a server speaking Redis
+// protocol (RESP). The server expires the entries.
+type RedisStore struct {
+	address   string
+	password  string
+	database  int
+	tlsConfig *tls.Config
+	timeout   time.Duration
+
+	mu     sync.Mutex
+	idle   []*redisConn
+	closed bool
+}
+
+// NewRedisStore returns an instance of RedisStore. The server is contacted
+// to check the credentials. When the TLS configuration is not nil, the
+// connections to the server use TLS.
+func NewRedisStore(address, password string, database int, tlsConfig *tls.Config, timeout time.Duration) (*RedisStore, error) {
+	s := &RedisStore{
+		address:   address,
+		password:  password,
+		database:  database,
+		tlsConfig: tlsConfig,
+		timeout:   timeout,
+	}
+	if _, err := s.do("PING"); err != nil {
+		return nil, errors.ErrKVStoreOpen.WithArgs(RedisDriver, err)
+	}
+	return s, nil
+}
+
+func (s *RedisStore) dial() (*redisConn, error) {
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: s.timeout}
+	if s.tlsConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.address, s.tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", s.address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{conn: conn, reader: bufio.NewReader(conn)}
+	if s.password != "" {
+		if _, err := c.do(s.timeout, "AUTH", s.password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if s.database != 0 {
+		if _, err := c.do(s.timeout, "SELECT", strconv.Itoa(s.database)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (s *RedisStore) getConn() (*redisConn, error) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil, errors.ErrKVStoreClosed
+	}
+	if n := len(s.idle); n > 0 {
+		c := s.idle[n-1]
+		s.idle = s.idle[:n-1]
+		s.mu.Unlock()
+		return c, nil
+	}
+	s.mu.Unlock()
+	return s.dial()
+}
+
+func (s *RedisStore) putConn(c *redisConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || len(s.idle) >= maxRedisIdleConns {
+		c.conn.Close()
+		return
+	}
+	s.idle = append(s.idle, c)
+}
+
+// do sends a command to the server and returns the reply. The connection
+// is discarded when the communication fails.
+func (s *RedisStore) do(args ...string) (interface{}, error) {
+	c, err := s.getConn()
+	if err != nil {
+		return nil, err
+	}
+	reply, err := c.do(s.timeout, args...)
+	if err != nil {
+		if _, ok := err.(redisError); !ok {
+			c.conn.Close()
+			return nil, err
+		}
+	}
+	s.putConn(c)
+	return reply, err
+}
+
+func (c *redisConn) do(timeout time.Duration, args ...string) (interface{}, error) {
+	if timeout > 0 {
+		c.conn.SetDeadline(time.Now().Add(timeout))
+	}
+	buf := []byte("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		buf = append(buf, "$"+strconv.Itoa(len(arg))+"\r\n"...)
+		buf = append(buf, arg...)
+		buf = append(buf, "\r\n"...)
+	}
+	if _, err := c.conn.Write(buf); err != nil {
+		return nil, err
+	}
+	return readRedisReply(c.reader)
+}
+
+// readRedisReply reads a reply. The bulk strings are returned as []byte,
+// with nil bulk strings returned as nil.
+func readRedisReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("malformed reply %q", line)
+	}
+	line = line[:len(line)-2]
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("malformed bulk string length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+	return nil, fmt.Errorf("unsupported reply %q", line)
+}
+
+func (s *RedisStore) set(op, key string, value []byte, ttl time.Duration, onlyIfAbsent bool) error {
+	if err := validateEntry(key, ttl); err != nil {
+		return err
+	}
+	args := []string{"SET", key, string(value)}
+	if ttl > 0 {
+		ms := ttl.Milliseconds()
+		if ms < 1 {
+			ms = 1
+		}
+		args = append(args, "PX", strconv.FormatInt(ms, 10))
+	}
+	if onlyIfAbsent {
+		args = append(args, "NX")
+	}
+	reply, err := s.do(args...)
+	if err != nil {
+		return errors.ErrKVStoreOperation.WithArgs(op, err)
+	}
+	if reply == nil {
+		return errors.ErrKVStoreKeyExists
+	}
+	return nil
+}
+
+// Get returns the value of the key.
+func (s *RedisStore) Get(key string) ([]byte, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+	reply, err := s.do("GET", key)
+	if err != nil {
+		return nil, errors.ErrKVStoreOperation.WithArgs("get", err)
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		if reply == nil {
+			return nil, errors.ErrKVStoreKeyNotFound
+		}
+		return nil, errors.ErrKVStoreOperation.WithArgs("get", fmt.Errorf("unexpected reply %v", reply))
+	}
+	return value, nil
+}
+
+// Set stores the value of the key.
+func (s *RedisStore) Set(key string, value []byte, ttl time.Duration) error {
+	return s.set("set", key, value, ttl, false)
+}
+
+// Add stores the value of the key unless the key exists.
+func (s *RedisStore) Add(key string, value []byte, ttl time.Duration) error {
+	return s.set("add", key, value, ttl, true)
+}
+
+// Delete deletes the key.
+func (s *RedisStore) Delete(key string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	if _, err := s.do("DEL", key); err != nil {
+		return errors.ErrKVStoreOperation.WithArgs("delete", err)
+	}
+	return nil
+}
+
+// GetDriver returns the name of the store implementation.
+func (s *RedisStore) GetDriver() string {
+	return RedisDriver
+}
+
+// Close closes the idle connections to the server.
+func (s *RedisStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for _, c := range s.idle {
+		c.conn.Close()
+	}
+	s.idle = nil
+	return nil
+}
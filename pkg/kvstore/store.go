@@ -0,0 +1,172 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvstore
+
+import (
+	"crypto/tls"
+	"time"
+
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+)
+
+// Store is a key/value store with expiring entries. The caches of portal
+// sessions, sandboxes, user registrations and OAuth states keep their
+// entries in a Store, so that the entries are shared by the processes
+// using the same backend.
+type Store interface {
+	// Get returns the value of the key. It returns ErrKVStoreKeyNotFound
+	// when the key does not exist or expired.
+	Get(string) ([]byte, error)
+	// Set stores the value of the key. The entry expires after the
+	// provided ttl, unless the ttl is zero. It returns
+	// ErrKVStoreTTLNegative when the ttl is negative.
+	Set(string, []byte, time.Duration) error
+	// Add stores the value of the key unless the key exists. It returns
+	// ErrKVStoreKeyExists when the key exists, and ErrKVStoreTTLNegative
+	// when the ttl is negative.
+	Add(string, []byte, time.Duration) error
+	// Delete deletes the key. Deleting a non-existing key is not an error.
+	Delete(string) error
+	// GetDriver returns the name of the store implementation.
+	GetDriver() string
+	// Close releases the resources held by the store.
+	Close() error
+}
+
+// Purger is implemented by the stores that do not expire entries on their
+// own. The owners of the store call Purge periodically.
+type Purger interface {
+	Purge() error
+}
+
+// NewStore returns an instance of Store based on the provided
+// configuration. When the configuration is nil, the store keeps the
+// entries in memory.
+func NewStore(cfg *Config) (Store, error) {
+	if cfg == nil {
+		return NewMemoryStore(), nil
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	var store Store
+	var err error
+	timeout := time.Duration(cfg.Timeout) * time.Second
+	switch cfg.Driver {
+	case BoltDriver:
+		store, err = NewBoltStore(cfg.Path, timeout)
+	case RedisDriver:
+		var tlsConfig *tls.Config
+		if tlsConfig, err = cfg.GetTLSConfig(); err != nil {
+			return nil, err
+		}
+		store, err = NewRedisStore(cfg.Address, cfg.Password, cfg.Database, tlsConfig, timeout)
+	default:
+		store = NewMemoryStore()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Prefix != "" {
+		store = WithPrefix(store, cfg.Prefix)
+	}
+	return store, nil
+}
+
+// Purge purges expired entries from the store, if the store requires it.
+func Purge(store Store) error {
+	if p, ok := store.(Purger); ok {
+		return p.Purge()
+	}
+	return nil
+}
+
+func validateKey(key string) error {
+	if key == "" {
+		return errors.ErrKVStoreKeyEmpty
+	}
+	return nil
+}
+
+// validateEntry checks the key and the ttl of the entry being stored.
+func validateEntry(key string, ttl time.Duration) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	if ttl < 0 {
+		return errors.ErrKVStoreTTLNegative
+	}
+	return nil
+}
+
+func getExpiry(ttl time.Duration) time.Time {
+	if ttl == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
+// WithPrefix returns a Store prepending the prefix to the keys of the
+// provided store, e.g. to keep the entries of several caches apart.
+func WithPrefix(store Store, prefix string) Store {
+	return &prefixStore{store: store, prefix: prefix}
+}
+
+// prefixStore prepends a prefix to the keys of the underlying store.
+type prefixStore struct {
+	store  Store
+	prefix string
+}
+
+func (s *prefixStore) Get(key string) ([]byte, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+	return s.store.Get(s.prefix + key)
+}
+
+func (s *prefixStore) Set(key string, value []byte, ttl time.Duration) error {
+	if err := validateEntry(key, ttl); err != nil {
+		return err
+	}
+	return s.store.Set(s.prefix+key, value, ttl)
+}
+
+func (s *prefixStore) Add(key string, value []byte, ttl time.Duration) error {
+	if err := validateEntry(key, ttl); err != nil {
+		return err
+	}
+	return s.store.Add(s.prefix+key, value, ttl)
+}
+
+func (s *prefixStore) Delete(key string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	return s.store.Delete(s.prefix + key)
+}
+
+func (s *prefixStore) GetDriver() string {
+	return s.store.GetDriver()
+}
+
+func (s *prefixStore) Close() error {
+	return s.store.Close()
+}
+
+func (s *prefixStore) Purge() error {
+	return Purge(s.store)
+}
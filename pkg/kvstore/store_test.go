@@ -0,0 +1,525 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvstore
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/greenpau/go-authcrunch/internal/tests"
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+)
+
+// testRedisServer is a local stand-in for a Redis server. It supports the
+// commands issued by RedisStore.
+type testRedisServer struct {
+	listener net.Listener
+	password string
+	mu       sync.Mutex
+	entries  map[string]string
+	expiry   map[string]time.Time
+}
+
+func newTestRedisServer(t *testing.T, password string, tlsConfig *tls.Config) *testRedisServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed starting redis server: %v", err)
+	}
+	if tlsConfig != nil {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+	srv := &testRedisServer{
+		listener: ln,
+		password: password,
+		entries:  make(map[string]string),
+		expiry:   make(map[string]time.Time),
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return srv
+}
+
+// newTestRedisCertificate returns the TLS configuration of the server with
+// a self-signed certificate for 127.0.0.1 and the path to the PEM file
+// with the certificate.
+func newTestRedisCertificate(t *testing.T) (*tls.Config, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed generating key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-1 * time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed creating certificate: %v", err)
+	}
+	fp := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(fp, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("failed writing certificate: %v", err)
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	}
+	return cfg, fp
+}
+
+func (srv *testRedisServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authenticated := srv.password == ""
+	for {
+		args, err := readTestRedisCommand(r)
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(args[0])
+		if !authenticated && cmd != "AUTH" {
+			io.WriteString(conn, "-NOAUTH Authentication required.\r\n")
+			continue
+		}
+		switch cmd {
+		case "AUTH":
+			if args[1] != srv.password {
+				io.WriteString(conn, "-WRONGPASS invalid password\r\n")
+				continue
+			}
+			authenticated = true
+			io.WriteString(conn, "+OK\r\n")
+		case "PING":
+			io.WriteString(conn, "+PONG\r\n")
+		case "SELECT":
+			io.WriteString(conn, "+OK\r\n")
+		case "SET":
+			io.WriteString(conn, srv.set(args[1], args[2], args[3:]))
+		case "GET":
+			io.WriteString(conn, srv.get(args[1]))
+		case "DEL":
+			srv.mu.Lock()
+			delete(srv.entries, args[1])
+			srv.mu.Unlock()
+			io.WriteString(conn, ":1\r\n")
+		default:
+			io.WriteString(conn, "-ERR unknown command\r\n")
+		}
+	}
+}
+
+func (srv *testRedisServer) expire(key string) {
+	if exp, exists := srv.expiry[key]; exists && time.Now().After(exp) {
+		delete(srv.entries, key)
+		delete(srv.expiry, key)
+	}
+}
+
+func (srv *testRedisServer) set(key, value string, opts []string) string {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	srv.expire(key)
+	var ttl time.Duration
+	for i := 0; i < len(opts); i++ {
+		switch strings.ToUpper(opts[i]) {
+		case "NX":
+			if _, exists := srv.entries[key]; exists {
+				return "$-1\r\n"
+			}
+		case "PX":
+			i++
+			ms, _ := strconv.Atoi(opts[i])
+			ttl = time.Duration(ms) * time.Millisecond
+		}
+	}
+	srv.entries[key] = value
+	delete(srv.expiry, key)
+	if ttl > 0 {
+		srv.expiry[key] = time.Now().Add(ttl)
+	}
+	return "+OK\r\n"
+}
+
+func (srv *testRedisServer) get(key string) string {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	srv.expire(key)
+	value, exists := srv.entries[key]
+	if !exists {
+		return "$-1\r\n"
+	}
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+}
+
+func readTestRedisCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	var args []string
+	for i := 0; i < n; i++ {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		b := make([]byte, size+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		args = append(args, string(b[:size]))
+	}
+	return args, nil
+}
+
+func TestStore(t *testing.T) {
+	redisServer := newTestRedisServer(t, "foobar", nil)
+	redisTLSConfig, redisCAFile := newTestRedisCertificate(t)
+	redisTLSServer := newTestRedisServer(t, "foobar", redisTLSConfig)
+	testcases := []struct {
+		name   string
+		config *Config
+	}{
+		{
+			name: "memory store",
+		},
+		{
+			name: "bolt store",
+			config: &Config{
+				Driver: "bolt",
+				Path:   filepath.Join(t.TempDir(), "cache.db"),
+			},
+		},
+		{
+			name: "redis store",
+			config: &Config{
+				Driver:   "redis",
+				Address:  redisServer.listener.Addr().String(),
+				Password: "foobar",
+				Database: 1,
+			},
+		},
+		{
+			name: "redis store with tls",
+			config: &Config{
+				Driver:                "redis",
+				Address:               redisTLSServer.listener.Addr().String(),
+				Password:              "foobar",
+				TLSEnabled:            true,
+				TLSTrustedAuthorities: []string{redisCAFile},
+			},
+		},
+		{
+			name: "memory store with prefix",
+			config: &Config{
+				Prefix: "authp/",
+			},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			store, err := NewStore(tc.config)
+			if err != nil {
+				t.Fatalf("failed creating store: %v", err)
+			}
+			defer store.Close()
+
+			got := make(map[string]interface{})
+			store.Set("foo", []byte("bar"), time.Minute)
+			value, err := store.Get("foo")
+			got["get"] = string(value)
+			got["add_existing"] = store.Add("foo", []byte("baz"), time.Minute)
+			got["add_new"] = store.Add("bar", []byte("baz"), 0)
+			value, _ = store.Get("bar")
+			got["get_added"] = string(value)
+			store.Delete("foo")
+			_, err = store.Get("foo")
+			got["get_deleted"] = err
+			got["delete_missing"] = store.Delete("foo")
+
+			store.Set("baz", []byte("foo"), 50*time.Millisecond)
+			time.Sleep(100 * time.Millisecond)
+			if err := Purge(store); err != nil {
+				t.Fatalf("failed purging store: %v", err)
+			}
+			_, err = store.Get("baz")
+			got["get_expired"] = err
+			got["add_expired"] = store.Add("baz", []byte("bar"), time.Minute)
+			_, err = store.Get("")
+			got["get_empty_key"] = err
+			got["set_negative_ttl"] = store.Set("qux", []byte("foo"), -time.Second)
+			got["add_negative_ttl"] = store.Add("qux", []byte("foo"), -time.Second)
+			_, err = store.Get("qux")
+			got["get_negative_ttl"] = err
+
+			want := map[string]interface{}{
+				"get":              "bar",
+				"add_existing":     errors.ErrKVStoreKeyExists,
+				"add_new":          nil,
+				"get_added":        "baz",
+				"get_deleted":      errors.ErrKVStoreKeyNotFound,
+				"delete_missing":   nil,
+				"get_expired":      errors.ErrKVStoreKeyNotFound,
+				"add_expired":      nil,
+				"get_empty_key":    errors.ErrKVStoreKeyEmpty,
+				"set_negative_ttl": errors.ErrKVStoreTTLNegative,
+				"add_negative_ttl": errors.ErrKVStoreTTLNegative,
+				"get_negative_ttl": errors.ErrKVStoreKeyNotFound,
+			}
+			tests.EvalObjectsWithLog(t, "store", want, got, msgs)
+		})
+	}
+}
+
+func TestSharedBoltStore(t *testing.T) {
+	dir := t.TempDir()
+	fp := filepath.Join(dir, "cache.db")
+	store1, err := NewBoltStore(fp, time.Second)
+	if err != nil {
+		t.Fatalf("failed creating store: %v", err)
+	}
+	// The stores of the file share the lock whichever path they use.
+	store2, err := NewBoltStore(dir+string(filepath.Separator)+"."+string(filepath.Separator)+"cache.db", time.Second)
+	if err != nil {
+		t.Fatalf("failed creating store: %v", err)
+	}
+	if store1.mu != store2.mu {
+		t.Fatalf("stores of %q do not share the lock", fp)
+	}
+	store1.Set("foo", []byte("bar"), time.Minute)
+	value, err := store2.Get("foo")
+	if err != nil {
+		t.Fatalf("failed getting shared entry: %v", err)
+	}
+	got := map[string]interface{}{
+		"get":          string(value),
+		"add_existing": store2.Add("foo", []byte("baz"), time.Minute),
+	}
+	want := map[string]interface{}{
+		"get":          "bar",
+		"add_existing": errors.ErrKVStoreKeyExists,
+	}
+	tests.EvalObjectsWithLog(t, "shared store", want, got, []string{})
+
+	// Closing a store does not affect the other stores of the file.
+	if err := store1.Close(); err != nil {
+		t.Fatalf("failed closing store: %v", err)
+	}
+	if _, err := store2.Get("foo"); err != nil {
+		t.Fatalf("failed getting entry after closing other store: %v", err)
+	}
+	if _, err := store1.Get("foo"); err != errors.ErrKVStoreClosed {
+		t.Fatalf("expected closed store error, got: %v", err)
+	}
+	if err := store2.Close(); err != nil {
+		t.Fatalf("failed closing store: %v", err)
+	}
+	store3, err := NewBoltStore(fp, time.Second)
+	if err != nil {
+		t.Fatalf("failed reopening store: %v", err)
+	}
+	defer store3.Close()
+	if value, err := store3.Get("foo"); err != nil || string(value) != "bar" {
+		t.Fatalf("expected persisted entry, got: %s, %v", value, err)
+	}
+}
+
+// TestBoltStoreAcrossProcesses runs the test binary as another process
+// sharing the database file with the test.
+func TestBoltStoreAcrossProcesses(t *testing.T) {
+	if fp := os.Getenv("KVSTORE_TEST_BOLT_PATH"); fp != "" {
+		store, err := NewBoltStore(fp, 5*time.Second)
+		if err != nil {
+			t.Fatalf("failed creating store in child process: %v", err)
+		}
+		defer store.Close()
+		if value, err := store.Get("foo"); err != nil || string(value) != "bar" {
+			t.Fatalf("expected entry of parent process, got: %s, %v", value, err)
+		}
+		if err := store.Set("bar", []byte("baz"), time.Minute); err != nil {
+			t.Fatalf("failed setting entry in child process: %v", err)
+		}
+		return
+	}
+
+	fp := filepath.Join(t.TempDir(), "cache.db")
+	store, err := NewBoltStore(fp, 5*time.Second)
+	if err != nil {
+		t.Fatalf("failed creating store: %v", err)
+	}
+	defer store.Close()
+	if err := store.Set("foo", []byte("bar"), time.Minute); err != nil {
+		t.Fatalf("failed setting entry: %v", err)
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestBoltStoreAcrossProcesses$")
+	cmd.Env = append(os.Environ(), "KVSTORE_TEST_BOLT_PATH="+fp)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("child process failed: %v\n%s", err, out)
+	}
+	value, err := store.Get("bar")
+	if err != nil || string(value) != "baz" {
+		t.Fatalf("expected entry of child process, got: %s, %v", value, err)
+	}
+}
+
+// BenchmarkBoltStore measures the cost of opening the database file on each
+// operation of the store.
+func BenchmarkBoltStore(b *testing.B) {
+	store, err := NewBoltStore(filepath.Join(b.TempDir(), "cache.db"), time.Second)
+	if err != nil {
+		b.Fatalf("failed creating store: %v", err)
+	}
+	defer store.Close()
+	if err := store.Set("foo", []byte("bar"), time.Minute); err != nil {
+		b.Fatalf("failed setting entry: %v", err)
+	}
+
+	b.Run("get", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := store.Get("foo"); err != nil {
+				b.Fatalf("failed getting entry: %v", err)
+			}
+		}
+	})
+	b.Run("set", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if err := store.Set("foo", []byte("bar"), time.Minute); err != nil {
+				b.Fatalf("failed setting entry: %v", err)
+			}
+		}
+	})
+}
+
+func TestRedisStoreAuthFailure(t *testing.T) {
+	srv := newTestRedisServer(t, "foobar", nil)
+	_, err := NewRedisStore(srv.listener.Addr().String(), "barfoo", 0, nil, time.Second)
+	tests.EvalErrWithLog(t, err, "auth", true,
+		errors.ErrKVStoreOpen.WithArgs(RedisDriver, "WRONGPASS invalid password"), []string{})
+}
+
+func TestRedisStoreUntrustedCertificate(t *testing.T) {
+	tlsConfig, _ := newTestRedisCertificate(t)
+	srv := newTestRedisServer(t, "foobar", tlsConfig)
+	_, err := NewStore(&Config{
+		Driver:     "redis",
+		Address:    srv.listener.Addr().String(),
+		Password:   "foobar",
+		TLSEnabled: true,
+	})
+	if err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Fatalf("expected certificate verification error, got: %v", err)
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	testcases := []struct {
+		name      string
+		config    *Config
+		want      *Config
+		shouldErr bool
+		err       error
+	}{
+		{
+			name:   "default driver",
+			config: &Config{},
+			want:   &Config{Driver: "memory", Timeout: 5},
+		},
+		{
+			name:   "bolt driver",
+			config: &Config{Driver: "BOLT", Path: "/var/lib/authp/cache.db"},
+			want:   &Config{Driver: "bolt", Path: "/var/lib/authp/cache.db", Timeout: 5},
+		},
+		{
+			name:      "bolt driver without path",
+			config:    &Config{Driver: "bolt"},
+			shouldErr: true,
+			err:       errors.ErrKVStoreConfigPathEmpty.WithArgs("bolt"),
+		},
+		{
+			name:      "redis driver without address",
+			config:    &Config{Driver: "redis"},
+			shouldErr: true,
+			err:       errors.ErrKVStoreConfigAddressEmpty.WithArgs("redis"),
+		},
+		{
+			name:      "redis driver with tls options and tls disabled",
+			config:    &Config{Driver: "redis", Address: "127.0.0.1:6379", TLSServerName: "redis.contoso.com"},
+			shouldErr: true,
+			err:       errors.ErrKVStoreConfigTLSDisabled.WithArgs("redis"),
+		},
+		{
+			name:      "unsupported driver",
+			config:    &Config{Driver: "foo"},
+			shouldErr: true,
+			err:       errors.ErrKVStoreConfigDriverUnsupported.WithArgs("foo"),
+		},
+		{
+			name:      "negative timeout",
+			config:    &Config{Timeout: -1},
+			shouldErr: true,
+			err:       errors.ErrKVStoreConfigTimeout,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			err := tc.config.Validate()
+			if tests.EvalErrWithLog(t, err, "config", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			tests.EvalObjectsWithLog(t, "config", tc.want, tc.config, msgs)
+		})
+	}
+}
@@ -64,6 +64,7 @@ func (e *EmailProvider) Validate() error {
 		for k := range e.Templates {
 			switch k {
 			case "password_recovery":
+			case "username_recovery":
 			case "registration_confirmation":
 			case "registration_ready":
 			case "registration_verdict":
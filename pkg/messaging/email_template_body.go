@@ -74,5 +74,44 @@ var EmailTemplateBody = map[string]string{
       <li>Timestamp: {{ .timestamp }}</li>
     </ul>
   </body>
+</html>`,
+	"en/password_recovery": `<html>
+  <body>
+    <p>
+      We received a request to reset the password of your account.
+      Please reset your password by clicking this
+      <a href="{{ .recovery_url }}">link</a>
+      within the next {{ .recovery_lifetime }}. The link can be used once.
+      If you did not request a password reset, please ignore this email.
+    </p>
+
+    <p>The request metadata follows:</p>
+    <ul style="list-style-type: disc">
+      <li>Session ID: {{ .session_id }}</li>
+      <li>Request ID: {{ .request_id }}</li>
+      <li>Username: <code>{{ .username }}</code></li>
+      <li>Email: <code>{{ .email }}</code></li>
+      <li>IP Address: <code>{{ .src_ip }}</code></li>
+      <li>Timestamp: {{ .timestamp }}</li>
+    </ul>
+  </body>
+</html>`,
+	"en/username_recovery": `<html>
+  <body>
+    <p>
+      We received a request to remind you of the username of your account.
+      Your username is <b><code>{{ .username }}</code></b>.
+      If you did not make this request, please ignore this email.
+    </p>
+
+    <p>The request metadata follows:</p>
+    <ul style="list-style-type: disc">
+      <li>Session ID: {{ .session_id }}</li>
+      <li>Request ID: {{ .request_id }}</li>
+      <li>Email: <code>{{ .email }}</code></li>
+      <li>IP Address: <code>{{ .src_ip }}</code></li>
+      <li>Timestamp: {{ .timestamp }}</li>
+    </ul>
+  </body>
 </html>`,
 }
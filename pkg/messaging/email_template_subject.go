@@ -16,6 +16,8 @@ package messaging
 
 // EmailTemplateSubject stores email subject templates.
 var EmailTemplateSubject = map[string]string{
+	"en/password_recovery":         `Password Reset Request`,
+	"en/username_recovery":         `Username Reminder`,
 	"en/registration_confirmation": `Registration Confirmation Required`,
 	"en/registration_ready":        `Review User Registration`,
 	"en/registration_verdict": `{{- if eq .verdict "approved" -}}
@@ -40,6 +40,7 @@ func (e *FileProvider) Validate() error {
 		for k := range e.Templates {
 			switch k {
 			case "password_recovery":
+			case "username_recovery":
 			case "registration_confirmation":
 			case "registration_ready":
 			case "registration_verdict":
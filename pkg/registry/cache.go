@@ -15,10 +15,14 @@
 package registry
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"sync"
 	"time"
+
+	autherrors "github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/kvstore"
 )
 
 const (
@@ -29,6 +33,11 @@ const (
 	defaultRegistrationMaxEntryLifetime int = 3600
 	// The minimum lifetime of a registration lifetime is 15 minutes.
 	minRegistrationMaxEntryLifetime int = 900
+
+	registrationKeyPrefix = "registration/"
+	// The index keys reserve the usernames and email addresses of the
+	// pending registrations.
+	registrationIndexKeyPrefix = "index/"
 )
 
 // RegistrationCacheEntry is an entry in RegistrationCache.
@@ -40,7 +49,16 @@ type RegistrationCacheEntry struct {
 	expired bool
 }
 
-// RegistrationCache contains cached tokens
+// registrationCacheRecord is the serialized form of RegistrationCacheEntry.
+type registrationCacheRecord struct {
+	ID        string            `json:"id"`
+	CreatedAt time.Time         `json:"created_at"`
+	User      map[string]string `json:"user,omitempty"`
+	Expired   bool              `json:"expired,omitempty"`
+}
+
+// RegistrationCache contains cached tokens. The entries are kept in a
+// key/value store, which is in memory unless set with SetStore.
 type RegistrationCache struct {
 	mu sync.RWMutex
 	// The interval (in seconds) at which cache maintenance task are being triggered.
@@ -50,9 +68,7 @@ type RegistrationCache struct {
 	maxEntryLifetime int
 	// If set to true, then the cache is being managed.
 	managed bool
-	// exit channel
-	exit    chan bool
-	Entries map[string]*RegistrationCacheEntry `json:"entries,omitempty" xml:"entries,omitempty" yaml:"entries,omitempty"`
+	store   kvstore.Store
 }
 
 // NewRegistrationCache returns RegistrationCache instance.
@@ -60,11 +76,23 @@ func NewRegistrationCache() *RegistrationCache {
 	return &RegistrationCache{
 		cleanupInternal:  defaultRegistrationCleanupInternal,
 		maxEntryLifetime: defaultRegistrationMaxEntryLifetime,
-		Entries:          make(map[string]*RegistrationCacheEntry),
-		exit:             make(chan bool),
+		store:            kvstore.NewMemoryStore(),
 	}
 }
 
+// SetStore sets the key/value store holding the cache entries.
+func (c *RegistrationCache) SetStore(store kvstore.Store) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.store = store
+}
+
+func (c *RegistrationCache) getStore() kvstore.Store {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.store
+}
+
 // SetCleanupInterval sets cache management interval.
 func (c *RegistrationCache) SetCleanupInterval(i int) error {
 	if i < 1 {
@@ -83,51 +111,31 @@ func (c *RegistrationCache) SetMaxEntryLifetime(i int) error {
 	return nil
 }
 
+// manageRegistrationCache purges expired entries from the stores that do
+// not expire entries on their own.
 func manageRegistrationCache(c *RegistrationCache) {
-	c.managed = true
 	intervals := time.NewTicker(time.Second * time.Duration(c.cleanupInternal))
+	defer intervals.Stop()
 	for range intervals.C {
-		if c == nil {
-			continue
-		}
-		c.mu.Lock()
-		select {
-		case <-c.exit:
-			c.managed = false
-			break
-		default:
-			break
+		c.mu.RLock()
+		managed := c.managed
+		store := c.store
+		c.mu.RUnlock()
+		if !managed {
+			return
 		}
-		if !c.managed {
-			c.mu.Unlock()
-			break
-		}
-		if c.Entries == nil {
-			c.mu.Unlock()
-			continue
-		}
-		deleteList := []string{}
-		for registrationID, entry := range c.Entries {
-			if err := entry.Valid(c.maxEntryLifetime); err != nil {
-				deleteList = append(deleteList, registrationID)
-				continue
-			}
-		}
-		if len(deleteList) > 0 {
-			for _, registrationID := range deleteList {
-				delete(c.Entries, registrationID)
-			}
-		}
-		c.mu.Unlock()
+		kvstore.Purge(store)
 	}
-	return
 }
 
 // Run starts management of RegistrationCache instance.
 func (c *RegistrationCache) Run() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if c.managed {
 		return
 	}
+	c.managed = true
 	go manageRegistrationCache(c)
 }
 
@@ -148,52 +156,96 @@ func (c *RegistrationCache) GetMaxEntryLifetime() int {
 	return c.maxEntryLifetime
 }
 
-// Add adds user to the cache.
-func (c *RegistrationCache) Add(registrationID string, u map[string]string) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.Entries == nil {
-		return errors.New("registration cache is not available")
-	}
+func getRegistrationIndexKey(field, value string) string {
+	return registrationIndexKeyPrefix + field + "/" + value
+}
 
+// Add adds user to the cache. The username and email address must not
+// belong to another pending registration.
+func (c *RegistrationCache) Add(registrationID string, u map[string]string) error {
 	for _, field := range []string{"username", "password", "email"} {
 		if _, exists := u[field]; !exists {
 			return fmt.Errorf("input entry has no %s field", field)
 		}
 	}
 
-	for _, m := range c.Entries {
-		if m.user == nil {
-			continue
-		}
-		for _, field := range []string{"username", "email"} {
-			if m.user[field] == u[field] {
+	store := c.getStore()
+	ttl := time.Duration(c.maxEntryLifetime) * time.Second
+	var reserved []string
+	for _, field := range []string{"username", "email"} {
+		k := getRegistrationIndexKey(field, u[field])
+		if err := store.Add(k, []byte(registrationID), ttl); err != nil {
+			for _, rk := range reserved {
+				store.Delete(rk)
+			}
+			if err == autherrors.ErrKVStoreKeyExists {
 				return fmt.Errorf("a record with this %s already exists", field)
 			}
+			return err
 		}
+		reserved = append(reserved, k)
 	}
 
-	c.Entries[registrationID] = &RegistrationCacheEntry{
-		registrationID: registrationID,
-		createdAt:      time.Now().UTC(),
-		user:           u,
+	if err := c.putEntry(registrationID, time.Now().UTC(), false, u); err != nil {
+		for _, rk := range reserved {
+			store.Delete(rk)
+		}
+		return err
 	}
 	return nil
 }
 
 // Delete removes cached user entry.
 func (c *RegistrationCache) Delete(registrationID string) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.Entries == nil {
-		return errors.New("registration cache is not available")
+	entry, err := c.getEntry(registrationID)
+	if err != nil {
+		return err
+	}
+	store := c.getStore()
+	for _, field := range []string{"username", "email"} {
+		if v, exists := entry.user[field]; exists {
+			store.Delete(getRegistrationIndexKey(field, v))
+		}
 	}
-	_, exists := c.Entries[registrationID]
-	if !exists {
-		return errors.New("cached registration id not found")
+	return store.Delete(registrationKeyPrefix + registrationID)
+}
+
+func (c *RegistrationCache) getEntry(registrationID string) (*RegistrationCacheEntry, error) {
+	b, err := c.getStore().Get(registrationKeyPrefix + registrationID)
+	if err != nil {
+		if err == autherrors.ErrKVStoreKeyNotFound {
+			return nil, errors.New("cached registration id not found")
+		}
+		return nil, err
 	}
-	delete(c.Entries, registrationID)
-	return nil
+	record := &registrationCacheRecord{}
+	if err := json.Unmarshal(b, record); err != nil {
+		return nil, fmt.Errorf("cached registration id error: %s", err)
+	}
+	return &RegistrationCacheEntry{
+		registrationID: record.ID,
+		createdAt:      record.CreatedAt,
+		user:           record.User,
+		expired:        record.Expired,
+	}, nil
+}
+
+// putEntry stores the entry for the remainder of its lifetime.
+func (c *RegistrationCache) putEntry(registrationID string, createdAt time.Time, expired bool, u map[string]string) error {
+	ttl := time.Until(createdAt.Add(time.Duration(c.maxEntryLifetime) * time.Second))
+	if ttl <= 0 {
+		return errors.New("registration cached entry expired")
+	}
+	b, err := json.Marshal(&registrationCacheRecord{
+		ID:        registrationID,
+		CreatedAt: createdAt,
+		User:      u,
+		Expired:   expired,
+	})
+	if err != nil {
+		return err
+	}
+	return c.getStore().Set(registrationKeyPrefix+registrationID, b, ttl)
 }
 
 // Get returns cached user entry.
@@ -201,25 +253,23 @@ func (c *RegistrationCache) Get(registrationID string) (map[string]string, error
 	if err := parseCacheID(registrationID); err != nil {
 		return nil, err
 	}
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	if entry, exists := c.Entries[registrationID]; exists {
-		if err := entry.Valid(c.maxEntryLifetime); err != nil {
-			return nil, err
-		}
-		return entry.user, nil
+	entry, err := c.getEntry(registrationID)
+	if err != nil {
+		return nil, err
+	}
+	if err := entry.Valid(c.maxEntryLifetime); err != nil {
+		return nil, err
 	}
-	return nil, errors.New("cached registration id not found")
+	return entry.user, nil
 }
 
 // Expire expires a particular registration entry.
 func (c *RegistrationCache) Expire(registrationID string) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	if entry, exists := c.Entries[registrationID]; exists {
-		entry.expired = true
+	entry, err := c.getEntry(registrationID)
+	if err != nil {
+		return
 	}
-	return
+	c.putEntry(entry.registrationID, entry.createdAt, true, entry.user)
 }
 
 // Valid checks whether RegistrationCacheEntry is non-expired.
@@ -0,0 +1,106 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/greenpau/go-authcrunch/internal/tests"
+	"github.com/greenpau/go-authcrunch/pkg/util"
+)
+
+func TestRegistrationCache(t *testing.T) {
+	testcases := []struct {
+		name      string
+		entries   []map[string]string
+		deleteIDs []int
+		shouldErr bool
+		err       error
+	}{
+		{
+			name: "add registrations",
+			entries: []map[string]string{
+				{"username": "jsmith", "password": "foobar", "email": "jsmith@localhost.localdomain"},
+				{"username": "greenpau", "password": "foobar", "email": "greenpau@localhost.localdomain"},
+			},
+		},
+		{
+			name: "add registration with duplicate username",
+			entries: []map[string]string{
+				{"username": "jsmith", "password": "foobar", "email": "jsmith@localhost.localdomain"},
+				{"username": "jsmith", "password": "foobar", "email": "smithj@localhost.localdomain"},
+			},
+			shouldErr: true,
+			err:       errors.New("a record with this username already exists"),
+		},
+		{
+			name: "add registration with duplicate email",
+			entries: []map[string]string{
+				{"username": "jsmith", "password": "foobar", "email": "jsmith@localhost.localdomain"},
+				{"username": "smithj", "password": "foobar", "email": "jsmith@localhost.localdomain"},
+			},
+			shouldErr: true,
+			err:       errors.New("a record with this email already exists"),
+		},
+		{
+			name: "add registration after deleting registration with the same username",
+			entries: []map[string]string{
+				{"username": "jsmith", "password": "foobar", "email": "jsmith@localhost.localdomain"},
+				{"username": "jsmith", "password": "foobar", "email": "jsmith@localhost.localdomain"},
+			},
+			deleteIDs: []int{0},
+		},
+		{
+			name: "add registration without password",
+			entries: []map[string]string{
+				{"username": "jsmith", "email": "jsmith@localhost.localdomain"},
+			},
+			shouldErr: true,
+			err:       errors.New("input entry has no password field"),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			c := NewRegistrationCache()
+			var ids []string
+			var err error
+			for i, entry := range tc.entries {
+				id := util.GetRandomStringFromRange(32, 96)
+				if err = c.Add(id, entry); err != nil {
+					break
+				}
+				ids = append(ids, id)
+				for _, j := range tc.deleteIDs {
+					if i == j {
+						if err := c.Delete(id); err != nil {
+							t.Fatalf("failed deleting registration: %v", err)
+						}
+					}
+				}
+			}
+			if tests.EvalErrWithLog(t, err, "registration cache", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			entry, err := c.Get(ids[len(ids)-1])
+			if err != nil {
+				t.Fatalf("failed getting registration: %v", err)
+			}
+			tests.EvalObjectsWithLog(t, "registration cache", tc.entries[len(tc.entries)-1], entry, msgs)
+		})
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"encoding/json"
 	"github.com/greenpau/go-authcrunch/pkg/errors"
 	"github.com/greenpau/go-authcrunch/pkg/identity"
+	"github.com/greenpau/go-authcrunch/pkg/kvstore"
 	"github.com/greenpau/go-authcrunch/pkg/requests"
 	"go.uber.org/zap"
 )
@@ -125,6 +126,11 @@ func (r *LocaUserRegistry) AddRegistrationEntry(s string, entry map[string]strin
 	return r.cache.Add(s, entry)
 }
 
+// SetCacheStore sets the key/value store holding the registration entries.
+func (r *LocaUserRegistry) SetCacheStore(store kvstore.Store) {
+	r.cache.SetStore(kvstore.WithPrefix(store, "registry/"+r.config.Name+"/"))
+}
+
 // GetUsernamePolicyRegex returns username policy regular expression.
 func (r *LocaUserRegistry) GetUsernamePolicyRegex() string {
 	return r.db.GetUsernamePolicyRegex()
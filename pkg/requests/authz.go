@@ -29,6 +29,9 @@ type AuthorizationResponse struct {
 	Authorized bool                   `json:"authorized" xml:"authorized" yaml:"authorized"`
 	Bypassed   bool                   `json:"bypassed,omitempty" xml:"bypassed,omitempty" yaml:"bypassed,omitempty"`
 	Error      error                  `json:"error,omitempty" xml:"error,omitempty" yaml:"error,omitempty"`
+	// Reason is the reason of the access list decision when the access is
+	// denied, e.g. the rule denying it.
+	Reason string `json:"reason,omitempty" xml:"reason,omitempty" yaml:"reason,omitempty"`
 }
 
 // AuthorizationToken holds the token found in an authorization request.
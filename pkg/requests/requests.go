@@ -35,6 +35,9 @@ type Request struct {
 	Flags    Flags       `json:"flags,omitempty" xml:"flags,omitempty" yaml:"flags,omitempty"`
 	Response Response    `json:"response,omitempty" xml:"response,omitempty" yaml:"response,omitempty"`
 	Logger   *zap.Logger `json:"-"`
+
+	// Session holds the session of the user with an identity provider.
+	Session IdentityProviderSession `json:"-" xml:"-" yaml:"-"`
 }
 
 // Response hold the response associated with identity database
@@ -59,6 +62,19 @@ type IdentityTokenCookie struct {
 	Enabled bool   `json:"enabled,omitempty" xml:"enabled,omitempty" yaml:"enabled,omitempty"`
 }
 
+// IdentityProviderSession holds the session of a user with an identity
+// provider.
+type IdentityProviderSession struct {
+	// RefreshToken is the refresh token issued by the identity provider.
+	RefreshToken string `json:"-" xml:"-" yaml:"-"`
+	// NameID is the subject name id asserted by the SAML identity provider.
+	NameID string `json:"-" xml:"-" yaml:"-"`
+	// NameIDFormat is the format of the subject name id.
+	NameIDFormat string `json:"-" xml:"-" yaml:"-"`
+	// SessionIndex is the session index asserted by the SAML identity provider.
+	SessionIndex string `json:"-" xml:"-" yaml:"-"`
+}
+
 // Upstream hold the upstream request handler metadata.
 type Upstream struct {
 	Request     *http.Request `json:"-"`
@@ -95,6 +111,9 @@ type User struct {
 	Roles       []string `json:"roles,omitempty" xml:"roles,omitempty" yaml:"roles,omitempty"`
 	Disabled    bool     `json:"disabled,omitempty" xml:"disabled,omitempty" yaml:"disabled,omitempty"`
 	Challenges  []string `json:"challenges,omitempty" xml:"challenges,omitempty" yaml:"challenges,omitempty"`
+	// PasswordFingerprint identifies the current password of the user. It
+	// binds password reset tokens to the password they were issued for.
+	PasswordFingerprint string `json:"password_fingerprint,omitempty" xml:"password_fingerprint,omitempty" yaml:"password_fingerprint,omitempty"`
 }
 
 // Key holds crypto key attributes.
@@ -0,0 +1,46 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package revocation
+
+import (
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+)
+
+const (
+	defaultSyncInterval int = 30
+	minSyncInterval     int = 1
+)
+
+// Config is a configuration of the token revocation deny list.
+type Config struct {
+	// Path is the path to the file persisting the deny list. When empty,
+	// the deny list is kept in memory only.
+	Path string `json:"path,omitempty" xml:"path,omitempty" yaml:"path,omitempty"`
+	// SyncInterval is the interval (in seconds) at which the deny list is
+	// reloaded from the file, e.g. to pick up the revocations made by other
+	// instances. The default is 30 seconds.
+	SyncInterval int `json:"sync_interval,omitempty" xml:"sync_interval,omitempty" yaml:"sync_interval,omitempty"`
+}
+
+// Validate validates Config.
+func (cfg *Config) Validate() error {
+	if cfg.SyncInterval == 0 {
+		cfg.SyncInterval = defaultSyncInterval
+	}
+	if cfg.SyncInterval < minSyncInterval {
+		return errors.ErrRevocationConfigSyncInterval.WithArgs(minSyncInterval)
+	}
+	return nil
+}
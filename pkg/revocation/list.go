@@ -0,0 +1,425 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package revocation
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/kms"
+	fileutil "github.com/greenpau/go-authcrunch/pkg/util/file"
+	"go.uber.org/zap"
+)
+
+// subjectEntry invalidates the tokens issued to a subject before a point
+// in time.
+type subjectEntry struct {
+	IssuedBefore time.Time `json:"issued_before"`
+	// ExpiresAt is the time after which the tokens issued before the
+	// watermark are expired, and the entry is no longer needed. Zero time
+	// means the entry never expires.
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+// listFile is the on-disk format of the deny list.
+type listFile struct {
+	Tokens   map[string]time.Time     `json:"tokens"`
+	Subjects map[string]*subjectEntry `json:"subjects"`
+}
+
+// List is a deny list of revoked tokens. A token is revoked by its id, i.e.
+// jti claim, or by its subject, i.e. sub claim, when the token was issued
+// before the revocation of the subject. When the list has a file, the
+// revocations are persisted in the file, and the revocations made by other
+// instances sharing the file are picked up periodically.
+type List struct {
+	mu sync.RWMutex
+	// tokens maps token ids to the expiration time of the tokens.
+	tokens       map[string]time.Time
+	subjects     map[string]*subjectEntry
+	path         string
+	syncInterval time.Duration
+	// syncMu serializes the file operations and guards modTime.
+	syncMu  sync.Mutex
+	modTime time.Time
+	exit    chan bool
+	logger  *zap.Logger
+}
+
+// NewList returns an instance of List. When the config is nil, the deny
+// list is kept in memory only.
+func NewList(cfg *Config) (*List, error) {
+	l := &List{
+		tokens:       make(map[string]time.Time),
+		subjects:     make(map[string]*subjectEntry),
+		syncInterval: time.Duration(defaultSyncInterval) * time.Second,
+	}
+	if cfg == nil {
+		return l, nil
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	l.syncInterval = time.Duration(cfg.SyncInterval) * time.Second
+	if cfg.Path == "" {
+		return l, nil
+	}
+	l.path = fileutil.ExpandPath(cfg.Path)
+	if err := l.sync(time.Now()); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// SetLogger sets the logger for the background synchronization.
+func (l *List) SetLogger(logger *zap.Logger) {
+	l.logger = logger
+}
+
+// RevokeToken revokes the token with the provided id. The revocation is
+// kept until the token expires. Zero expiration time keeps the revocation
+// indefinitely.
+func (l *List) RevokeToken(id string, expiresAt time.Time) error {
+	if id == "" {
+		return errors.ErrRevocationTokenIDEmpty
+	}
+	now := time.Now()
+	if !expiresAt.IsZero() && !now.Before(expiresAt) {
+		return nil
+	}
+	l.mu.Lock()
+	if prev, exists := l.tokens[id]; !exists || !isBefore(expiresAt, prev) {
+		l.tokens[id] = expiresAt
+	}
+	l.mu.Unlock()
+	return l.save(now)
+}
+
+// RevokeSubject revokes the tokens issued to the subject before the
+// provided point in time, i.e. a "log out everywhere". The revocation is
+// kept until the provided expiration time, which should be no earlier
+// than the expiration of the last token issued before the watermark.
+// The tokens issued later, e.g. after a new login, remain valid. Since
+// the issue time of a token has a precision of one second, the tokens
+// issued in the same second as the watermark remain valid too.
+func (l *List) RevokeSubject(subject string, issuedBefore, expiresAt time.Time) error {
+	if subject == "" {
+		return errors.ErrRevocationSubjectEmpty
+	}
+	now := time.Now()
+	if !expiresAt.IsZero() && !now.Before(expiresAt) {
+		return nil
+	}
+	l.mu.Lock()
+	l.addSubject(subject, &subjectEntry{
+		IssuedBefore: issuedBefore.UTC().Truncate(time.Second),
+		ExpiresAt:    expiresAt.UTC(),
+	})
+	l.mu.Unlock()
+	return l.save(now)
+}
+
+// IsRevoked returns true when the token with the provided id, subject and
+// issue time (in seconds since epoch) has been revoked. The tokens without
+// issue time are revoked when their subject is revoked.
+func (l *List) IsRevoked(id, subject string, issuedAt int64) bool {
+	now := time.Now()
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if id != "" {
+		if expiresAt, exists := l.tokens[id]; exists && isActive(expiresAt, now) {
+			return true
+		}
+	}
+	if subject != "" {
+		if entry, exists := l.subjects[subject]; exists && isActive(entry.ExpiresAt, now) {
+			if issuedAt == 0 || issuedAt < entry.IssuedBefore.Unix() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CheckToken returns an error when the token has been revoked. The claims
+// of the token are not verified, because the check only ever rejects the
+// token. The tokens which cannot be parsed are left to the keystore.
+func (l *List) CheckToken(token string) error {
+	if l.isEmpty() {
+		return nil
+	}
+	m, err := kms.ParsePayloadFromToken(token)
+	if err != nil {
+		return nil
+	}
+	var id, subject string
+	var issuedAt int64
+	if v, ok := m["jti"].(string); ok {
+		id = v
+	}
+	if v, ok := m["sub"].(string); ok {
+		subject = v
+	}
+	if v, ok := m["iat"].(float64); ok {
+		issuedAt = int64(v)
+	}
+	if l.IsRevoked(id, subject, issuedAt) {
+		return errors.ErrTokenRevoked
+	}
+	return nil
+}
+
+// Start starts the removal of the expired revocations and, when the list
+// has a file, the periodic reload of the file.
+func (l *List) Start() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.exit != nil {
+		return
+	}
+	l.exit = make(chan bool)
+	go l.run(l.exit)
+}
+
+// Stop stops the background management of the list.
+func (l *List) Stop() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.exit != nil {
+		close(l.exit)
+		l.exit = nil
+	}
+}
+
+func (l *List) run(exit chan bool) {
+	ticker := time.NewTicker(l.syncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-exit:
+			return
+		case <-ticker.C:
+			if err := l.sync(time.Now()); err != nil && l.logger != nil {
+				l.logger.Warn("failed synchronizing token revocation list", zap.Error(err))
+			}
+		}
+	}
+}
+
+func (l *List) isEmpty() bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return len(l.tokens) == 0 && len(l.subjects) == 0
+}
+
+// sync removes the expired revocations and merges the revocations found
+// in the file. When the file lacks some of the revocations, e.g. due to
+// a concurrent write by another instance, the file is rewritten.
+func (l *List) sync(now time.Time) error {
+	if l.path == "" {
+		l.mu.Lock()
+		l.prune(now)
+		l.mu.Unlock()
+		return nil
+	}
+
+	l.syncMu.Lock()
+	defer l.syncMu.Unlock()
+	fi, err := os.Stat(l.path)
+	switch {
+	case err == nil:
+		if fi.ModTime().Equal(l.modTime) {
+			l.mu.Lock()
+			l.prune(now)
+			l.mu.Unlock()
+			return nil
+		}
+	case os.IsNotExist(err):
+	default:
+		return errors.ErrRevocationLoad.WithArgs(l.path, err)
+	}
+	return l.merge(now, false)
+}
+
+// save persists the revocations in the file.
+func (l *List) save(now time.Time) error {
+	if l.path == "" {
+		return nil
+	}
+	l.syncMu.Lock()
+	defer l.syncMu.Unlock()
+	return l.merge(now, true)
+}
+
+// merge merges the revocations found in the file with the revocations in
+// memory and writes the result back to the file when the file is stale or
+// when forced. The read, the merge and the write happen under an exclusive
+// lock of the file shared with the other instances, so that the instances
+// do not overwrite the revocations of each other. It must be called with
+// syncMu held.
+func (l *List) merge(now time.Time, force bool) error {
+	if err := os.MkdirAll(filepath.Dir(l.path), 0700); err != nil {
+		return errors.ErrRevocationSave.WithArgs(l.path, err)
+	}
+	unlock, err := fileutil.LockFile(l.path)
+	if err != nil {
+		return errors.ErrRevocationSave.WithArgs(l.path, err)
+	}
+	defer unlock()
+
+	f, modTime, err := l.readFile()
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	for id, expiresAt := range f.Tokens {
+		if prev, exists := l.tokens[id]; !exists || isBefore(prev, expiresAt) {
+			l.tokens[id] = expiresAt
+		}
+	}
+	for subject, entry := range f.Subjects {
+		if entry != nil {
+			l.addSubject(subject, entry)
+		}
+	}
+	l.prune(now)
+	stale := force || l.isStale(f)
+	snapshot := &listFile{
+		Tokens:   make(map[string]time.Time, len(l.tokens)),
+		Subjects: make(map[string]*subjectEntry, len(l.subjects)),
+	}
+	for id, expiresAt := range l.tokens {
+		snapshot.Tokens[id] = expiresAt
+	}
+	for subject, entry := range l.subjects {
+		snapshot.Subjects[subject] = &subjectEntry{IssuedBefore: entry.IssuedBefore, ExpiresAt: entry.ExpiresAt}
+	}
+	l.mu.Unlock()
+
+	if !stale {
+		l.modTime = modTime
+		return nil
+	}
+
+	b, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return errors.ErrRevocationSave.WithArgs(l.path, err)
+	}
+	if err := fileutil.WriteFileAtomic(l.path, b, 0600); err != nil {
+		return errors.ErrRevocationSave.WithArgs(l.path, err)
+	}
+	fi, err := os.Stat(l.path)
+	if err != nil {
+		return errors.ErrRevocationSave.WithArgs(l.path, err)
+	}
+	l.modTime = fi.ModTime()
+	return nil
+}
+
+// readFile returns the contents and the modification time of the file.
+// A missing file has no revocations.
+func (l *List) readFile() (*listFile, time.Time, error) {
+	f := &listFile{}
+	fi, err := os.Stat(l.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return f, time.Time{}, nil
+		}
+		return nil, time.Time{}, errors.ErrRevocationLoad.WithArgs(l.path, err)
+	}
+	b, err := os.ReadFile(l.path)
+	if err != nil {
+		return nil, time.Time{}, errors.ErrRevocationLoad.WithArgs(l.path, err)
+	}
+	if err := json.Unmarshal(b, f); err != nil {
+		return nil, time.Time{}, errors.ErrRevocationLoad.WithArgs(l.path, err)
+	}
+	return f, fi.ModTime(), nil
+}
+
+// isStale returns true when the file lacks some of the revocations in
+// memory. It must be called with mu held.
+func (l *List) isStale(f *listFile) bool {
+	for id, expiresAt := range l.tokens {
+		if v, exists := f.Tokens[id]; !exists || !v.Equal(expiresAt) {
+			return true
+		}
+	}
+	for subject, entry := range l.subjects {
+		v, exists := f.Subjects[subject]
+		if !exists || v == nil || !v.IssuedBefore.Equal(entry.IssuedBefore) || !v.ExpiresAt.Equal(entry.ExpiresAt) {
+			return true
+		}
+	}
+	return false
+}
+
+// addSubject adds the subject revocation, keeping the later watermark and
+// expiration time. It must be called with mu held.
+func (l *List) addSubject(subject string, entry *subjectEntry) {
+	prev, exists := l.subjects[subject]
+	if !exists {
+		l.subjects[subject] = entry
+		return
+	}
+	merged := &subjectEntry{
+		IssuedBefore: prev.IssuedBefore,
+		ExpiresAt:    prev.ExpiresAt,
+	}
+	if merged.IssuedBefore.Before(entry.IssuedBefore) {
+		merged.IssuedBefore = entry.IssuedBefore
+	}
+	if isBefore(merged.ExpiresAt, entry.ExpiresAt) {
+		merged.ExpiresAt = entry.ExpiresAt
+	}
+	l.subjects[subject] = merged
+}
+
+// prune removes the expired revocations. It must be called with mu held.
+func (l *List) prune(now time.Time) {
+	for id, expiresAt := range l.tokens {
+		if !isActive(expiresAt, now) {
+			delete(l.tokens, id)
+		}
+	}
+	for subject, entry := range l.subjects {
+		if !isActive(entry.ExpiresAt, now) {
+			delete(l.subjects, subject)
+		}
+	}
+}
+
+// isActive returns true when the revocation with the provided expiration
+// time is still needed. Zero time never expires.
+func isActive(expiresAt, now time.Time) bool {
+	return expiresAt.IsZero() || now.Before(expiresAt)
+}
+
+// isBefore returns true when the expiration time a is earlier than b.
+// Zero time never expires, i.e. it is later than any other time.
+func isBefore(a, b time.Time) bool {
+	if a.IsZero() {
+		return false
+	}
+	if b.IsZero() {
+		return true
+	}
+	return a.Before(b)
+}
@@ -0,0 +1,300 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package revocation
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/greenpau/go-authcrunch/internal/tests"
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+)
+
+func TestList(t *testing.T) {
+	now := time.Now()
+	iat := now.Add(-10 * time.Minute).Unix()
+
+	testcases := []struct {
+		name   string
+		revoke func(*List) error
+		want   map[string]interface{}
+	}{
+		{
+			name: "empty list",
+			revoke: func(l *List) error {
+				return nil
+			},
+			want: map[string]interface{}{
+				"token":            false,
+				"other_token":      false,
+				"token_without_id": false,
+				"token_later":      false,
+				"token_no_iat":     false,
+			},
+		},
+		{
+			name: "revoke token by id",
+			revoke: func(l *List) error {
+				return l.RevokeToken("a1b2c3", now.Add(time.Hour))
+			},
+			want: map[string]interface{}{
+				"token":            true,
+				"other_token":      false,
+				"token_without_id": false,
+				"token_later":      false,
+				"token_no_iat":     false,
+			},
+		},
+		{
+			name: "revoke expired token by id",
+			revoke: func(l *List) error {
+				return l.RevokeToken("a1b2c3", now.Add(-time.Minute))
+			},
+			want: map[string]interface{}{
+				"token":            false,
+				"other_token":      false,
+				"token_without_id": false,
+				"token_later":      false,
+				"token_no_iat":     false,
+			},
+		},
+		{
+			name: "revoke tokens by subject",
+			revoke: func(l *List) error {
+				return l.RevokeSubject("jsmith", now, now.Add(time.Hour))
+			},
+			want: map[string]interface{}{
+				"token":            true,
+				"other_token":      true,
+				"token_without_id": true,
+				"token_later":      false,
+				"token_no_iat":     true,
+			},
+		},
+		{
+			name: "keep later subject watermark",
+			revoke: func(l *List) error {
+				if err := l.RevokeSubject("jsmith", now, now.Add(time.Hour)); err != nil {
+					return err
+				}
+				return l.RevokeSubject("jsmith", now.Add(-time.Hour), now.Add(time.Hour))
+			},
+			want: map[string]interface{}{
+				"token":            true,
+				"other_token":      true,
+				"token_without_id": true,
+				"token_later":      false,
+				"token_no_iat":     true,
+			},
+		},
+		{
+			name: "revoke tokens by subject with earlier watermark",
+			revoke: func(l *List) error {
+				return l.RevokeSubject("jsmith", now.Add(-time.Hour), now.Add(time.Hour))
+			},
+			want: map[string]interface{}{
+				"token":            false,
+				"other_token":      false,
+				"token_without_id": false,
+				"token_later":      false,
+				"token_no_iat":     true,
+			},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			l, err := NewList(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tc.revoke(l); err != nil {
+				t.Fatalf("failed revoking: %v", err)
+			}
+			got := map[string]interface{}{
+				"token":            l.IsRevoked("a1b2c3", "jsmith", iat),
+				"other_token":      l.IsRevoked("d4e5f6", "jsmith", iat),
+				"token_without_id": l.IsRevoked("", "jsmith", iat),
+				"token_later":      l.IsRevoked("d4e5f6", "jsmith", now.Add(time.Second).Unix()),
+				"token_no_iat":     l.IsRevoked("d4e5f6", "jsmith", 0),
+			}
+			tests.EvalObjectsWithLog(t, "revocation", tc.want, got, msgs)
+		})
+	}
+}
+
+func TestListErrors(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "revocations.json")
+	if err := os.WriteFile(fp, []byte("foobar"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	l, _ := NewList(nil)
+	err := l.RevokeToken("", time.Now().Add(time.Hour))
+	tests.EvalErrWithLog(t, err, "empty token id", true, errors.ErrRevocationTokenIDEmpty, []string{})
+
+	err = l.RevokeSubject("", time.Now(), time.Now().Add(time.Hour))
+	tests.EvalErrWithLog(t, err, "empty subject", true, errors.ErrRevocationSubjectEmpty, []string{})
+
+	_, err = NewList(&Config{SyncInterval: -1})
+	tests.EvalErrWithLog(t, err, "sync interval", true, errors.ErrRevocationConfigSyncInterval.WithArgs(1), []string{})
+
+	_, err = NewList(&Config{Path: fp})
+	if err == nil {
+		t.Fatalf("expected error when loading malformed deny list")
+	}
+}
+
+func TestListPersistence(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "revocations.json")
+	now := time.Now()
+	iat := now.Add(-10 * time.Minute).Unix()
+
+	// Two instances share the deny list file.
+	l1, err := NewList(&Config{Path: fp})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l2, err := NewList(&Config{Path: fp})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l1.RevokeToken("a1b2c3", now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := l1.RevokeToken("x1y2z3", now.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := l2.RevokeSubject("jsmith", now, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The revocations by the second instance are picked up on sync.
+	if err := l1.sync(now); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]interface{}{
+		"l1_token":   l1.IsRevoked("a1b2c3", "", iat),
+		"l1_subject": l1.IsRevoked("", "jsmith", iat),
+		"l2_token":   l2.IsRevoked("a1b2c3", "", iat),
+		"l2_subject": l2.IsRevoked("", "jsmith", iat),
+	}
+	want := map[string]interface{}{
+		"l1_token":   true,
+		"l1_subject": true,
+		"l2_token":   true,
+		"l2_subject": true,
+	}
+	tests.EvalObjectsWithLog(t, "shared deny list", want, got, []string{})
+
+	// The revocations survive restarts, and the expired revocations are
+	// removed.
+	if err := l1.sync(now.Add(2 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	l3, err := NewList(&Config{Path: fp})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = map[string]interface{}{
+		"token":         l3.IsRevoked("a1b2c3", "", iat),
+		"subject":       l3.IsRevoked("", "jsmith", iat),
+		"expired_token": len(l1.tokens),
+	}
+	want = map[string]interface{}{
+		"token":         true,
+		"subject":       true,
+		"expired_token": 1,
+	}
+	tests.EvalObjectsWithLog(t, "restart", want, got, []string{})
+
+	// The revocations lost in the file, e.g. due to a concurrent write, are
+	// written back on sync.
+	if err := os.WriteFile(fp, []byte(`{"tokens":{},"subjects":{}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := l1.sync(now); err != nil {
+		t.Fatal(err)
+	}
+	l4, err := NewList(&Config{Path: fp})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = map[string]interface{}{
+		"token":   l4.IsRevoked("a1b2c3", "", iat),
+		"subject": l4.IsRevoked("", "jsmith", iat),
+	}
+	want = map[string]interface{}{
+		"token":   true,
+		"subject": true,
+	}
+	tests.EvalObjectsWithLog(t, "stale file", want, got, []string{})
+}
+
+func TestListConcurrentWriters(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "revocations.json")
+	now := time.Now()
+	iat := now.Add(-10 * time.Minute).Unix()
+
+	// Several instances revoke tokens at the same time, and none of the
+	// revocations is lost in the shared file.
+	var lists []*List
+	for i := 0; i < 4; i++ {
+		l, err := NewList(&Config{Path: fp})
+		if err != nil {
+			t.Fatal(err)
+		}
+		lists = append(lists, l)
+	}
+
+	var wg sync.WaitGroup
+	errCh := make(chan error, len(lists)*10)
+	for i, l := range lists {
+		wg.Add(1)
+		go func(i int, l *List) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				errCh <- l.RevokeToken(fmt.Sprintf("token-%d-%d", i, j), now.Add(time.Hour))
+			}
+		}(i, l)
+	}
+	wg.Wait()
+	close(errCh)
+	for err := range errCh {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	l, err := NewList(&Config{Path: fp})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var missing []string
+	for i := range lists {
+		for j := 0; j < 10; j++ {
+			id := fmt.Sprintf("token-%d-%d", i, j)
+			if !l.IsRevoked(id, "", iat) {
+				missing = append(missing, id)
+			}
+		}
+	}
+	tests.EvalObjectsWithLog(t, "concurrent writers", []string(nil), missing, []string{})
+}
@@ -0,0 +1,176 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sso
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/crewjam/saml"
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/util"
+)
+
+const (
+	awsSignInURL                = "https://signin.aws.amazon.com/saml"
+	awsAudience                 = "urn:amazon:webservices"
+	awsRoleAttribute            = "https://aws.amazon.com/SAML/Attributes/Role"
+	awsRoleSessionNameAttribute = "https://aws.amazon.com/SAML/Attributes/RoleSessionName"
+	awsSessionDurationAttribute = "https://aws.amazon.com/SAML/Attributes/SessionDuration"
+
+	defaultSessionDuration = 3600
+	minSessionDuration     = 900
+	maxSessionDuration     = 43200
+)
+
+var (
+	roleSessionNameRgx     = regexp.MustCompile(`[^\w+=,.@-]`)
+	roleSessionNameMaxSize = 64
+)
+
+// AssumeRoleParams represents the parameters of AWS role assumption.
+type AssumeRoleParams struct {
+	AccountID string `json:"account_id,omitempty" xml:"account_id,omitempty" yaml:"account_id,omitempty"`
+	RoleName  string `json:"role_name,omitempty" xml:"role_name,omitempty" yaml:"role_name,omitempty"`
+	// SessionName identifies the user in AWS, e.g. email address.
+	SessionName string `json:"session_name,omitempty" xml:"session_name,omitempty" yaml:"session_name,omitempty"`
+}
+
+// Validate validates role assumption parameters.
+func (params *AssumeRoleParams) Validate() error {
+	if params.AccountID == "" {
+		return errors.ErrSingleSignOnProviderAssumeRoleInvalid.WithArgs("empty account id")
+	}
+	if params.RoleName == "" {
+		return errors.ErrSingleSignOnProviderAssumeRoleInvalid.WithArgs("empty role name")
+	}
+	if params.SessionName == "" {
+		return errors.ErrSingleSignOnProviderAssumeRoleInvalid.WithArgs("empty session name")
+	}
+	return nil
+}
+
+// AssumeRole returns an HTML page submitting a signed SAML response for
+// the requested role to AWS sign-in endpoint.
+func (p *Provider) AssumeRole(params *AssumeRoleParams) ([]byte, error) {
+	if p.config.Driver != "aws" {
+		return nil, errors.ErrSingleSignOnProviderRequestUnsupported.WithArgs(p.config.Name, p.config.Driver, "assume role")
+	}
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+
+	samlResponse, err := p.getAssumeRoleResponse(params)
+	if err != nil {
+		return nil, errors.ErrSingleSignOnProviderResponseFailed.WithArgs(err)
+	}
+	return renderPostForm(awsSignInURL, samlResponse, "")
+}
+
+// getAssumeRoleResponse returns base64-encoded signed SAML response.
+func (p *Provider) getAssumeRoleResponse(params *AssumeRoleParams) (string, error) {
+	sessionDuration := p.config.SessionDuration
+	if sessionDuration == 0 {
+		sessionDuration = defaultSessionDuration
+	}
+	samlProviderName := p.config.SAMLProviderName
+	if samlProviderName == "" {
+		samlProviderName = p.config.Name
+	}
+	sessionName := getRoleSessionName(params.SessionName)
+
+	now := timeNow().UTC()
+	expiresAt := now.Add(assertionLifetime)
+	assertionID := "id-" + util.GetRandomString(40)
+
+	assertion := &saml.Assertion{
+		ID:           assertionID,
+		IssueInstant: now,
+		Version:      "2.0",
+		Issuer: saml.Issuer{
+			Format: "urn:oasis:names:tc:SAML:2.0:nameid-format:entity",
+			Value:  p.config.EntityID,
+		},
+		Subject: &saml.Subject{
+			NameID: &saml.NameID{
+				Format: "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent",
+				Value:  params.SessionName,
+			},
+			SubjectConfirmations: []saml.SubjectConfirmation{
+				{
+					Method: "urn:oasis:names:tc:SAML:2.0:cm:bearer",
+					SubjectConfirmationData: &saml.SubjectConfirmationData{
+						NotOnOrAfter: expiresAt,
+						Recipient:    awsSignInURL,
+					},
+				},
+			},
+		},
+		Conditions: &saml.Conditions{
+			NotBefore:    now,
+			NotOnOrAfter: expiresAt,
+			AudienceRestrictions: []saml.AudienceRestriction{
+				{Audience: saml.Audience{Value: awsAudience}},
+			},
+		},
+		AuthnStatements: []saml.AuthnStatement{
+			{
+				AuthnInstant: now,
+				SessionIndex: assertionID,
+				AuthnContext: saml.AuthnContext{
+					AuthnContextClassRef: &saml.AuthnContextClassRef{
+						Value: "urn:oasis:names:tc:SAML:2.0:ac:classes:PasswordProtectedTransport",
+					},
+				},
+			},
+		},
+		AttributeStatements: []saml.AttributeStatement{
+			{
+				Attributes: []saml.Attribute{
+					newStringAttribute(awsRoleAttribute, fmt.Sprintf(
+						"arn:aws:iam::%s:role/%s,arn:aws:iam::%s:saml-provider/%s",
+						params.AccountID, params.RoleName, params.AccountID, samlProviderName,
+					)),
+					newStringAttribute(awsRoleSessionNameAttribute, sessionName),
+					newStringAttribute(awsSessionDurationAttribute, strconv.Itoa(sessionDuration)),
+				},
+			},
+		},
+	}
+
+	// The response is unsolicited, the AWS metadata is not consulted.
+	return p.signResponse(assertion, awsSignInURL, "", &saml.SPSSODescriptor{})
+}
+
+func newStringAttribute(name, value string) saml.Attribute {
+	return saml.Attribute{
+		Name:       name,
+		NameFormat: "urn:oasis:names:tc:SAML:2.0:attrname-format:uri",
+		Values: []saml.AttributeValue{
+			{Type: "xs:string", Value: value},
+		},
+	}
+}
+
+// getRoleSessionName returns the name conforming to the constraints
+// AWS places on role session names.
+func getRoleSessionName(s string) string {
+	s = roleSessionNameRgx.ReplaceAllString(s, "-")
+	if len(s) > roleSessionNameMaxSize {
+		s = s[:roleSessionNameMaxSize]
+	}
+	return s
+}
@@ -0,0 +1,204 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sso
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"html"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/greenpau/go-authcrunch/internal/tests"
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+	logutil "github.com/greenpau/go-authcrunch/pkg/util/log"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+func TestAssumeRole(t *testing.T) {
+	now := time.Date(2023, time.January, 2, 3, 4, 5, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	testcases := []struct {
+		name      string
+		config    *SingleSignOnProviderConfig
+		params    *AssumeRoleParams
+		want      map[string]interface{}
+		shouldErr bool
+		err       error
+	}{
+		{
+			name: "test assume role with defaults",
+			config: &SingleSignOnProviderConfig{
+				Name:           "aws",
+				Driver:         "aws",
+				EntityID:       "caddy-authp-idp",
+				PrivateKeyPath: "../../testdata/sso/authp_saml.key",
+				CertPath:       "../../testdata/sso/authp_saml.crt",
+				Locations:      []string{"https://localhost/apps/sso/aws"},
+			},
+			params: &AssumeRoleParams{
+				AccountID:   "123456789012",
+				RoleName:    "Administrator",
+				SessionName: "jsmith@contoso.com",
+			},
+			want: map[string]interface{}{
+				"action":          "https://signin.aws.amazon.com/saml",
+				"issuer":          "caddy-authp-idp",
+				"destination":     "https://signin.aws.amazon.com/saml",
+				"audience":        "urn:amazon:webservices",
+				"recipient":       "https://signin.aws.amazon.com/saml",
+				"name_id":         "jsmith@contoso.com",
+				"not_on_or_after": "2023-01-02T03:09:05Z",
+				"role":            "arn:aws:iam::123456789012:role/Administrator,arn:aws:iam::123456789012:saml-provider/aws",
+				"session_name":    "jsmith@contoso.com",
+				"duration":        "3600",
+			},
+		},
+		{
+			name: "test assume role with custom saml provider and session duration",
+			config: &SingleSignOnProviderConfig{
+				Name:             "aws",
+				Driver:           "aws",
+				EntityID:         "urn:authp:sso",
+				PrivateKeyPath:   "../../testdata/sso/authp_saml.key",
+				CertPath:         "../../testdata/sso/authp_saml.crt",
+				Locations:        []string{"https://localhost/apps/sso/aws"},
+				SAMLProviderName: "AuthPortal",
+				SessionDuration:  7200,
+			},
+			params: &AssumeRoleParams{
+				AccountID:   "123456789012",
+				RoleName:    "ReadOnly",
+				SessionName: "John Smith <jsmith>",
+			},
+			want: map[string]interface{}{
+				"action":          "https://signin.aws.amazon.com/saml",
+				"issuer":          "urn:authp:sso",
+				"destination":     "https://signin.aws.amazon.com/saml",
+				"audience":        "urn:amazon:webservices",
+				"recipient":       "https://signin.aws.amazon.com/saml",
+				"name_id":         "John Smith <jsmith>",
+				"not_on_or_after": "2023-01-02T03:09:05Z",
+				"role":            "arn:aws:iam::123456789012:role/ReadOnly,arn:aws:iam::123456789012:saml-provider/AuthPortal",
+				"session_name":    "John-Smith--jsmith-",
+				"duration":        "7200",
+			},
+		},
+		{
+			name: "test assume role without account id",
+			config: &SingleSignOnProviderConfig{
+				Name:           "aws",
+				Driver:         "aws",
+				EntityID:       "caddy-authp-idp",
+				PrivateKeyPath: "../../testdata/sso/authp_saml.key",
+				CertPath:       "../../testdata/sso/authp_saml.crt",
+				Locations:      []string{"https://localhost/apps/sso/aws"},
+			},
+			params: &AssumeRoleParams{
+				RoleName:    "Administrator",
+				SessionName: "jsmith@contoso.com",
+			},
+			shouldErr: true,
+			err:       errors.ErrSingleSignOnProviderAssumeRoleInvalid.WithArgs("empty account id"),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			p, err := NewSingleSignOnProvider(tc.config, logutil.NewLogger())
+			if err != nil {
+				t.Fatalf("failed creating provider: %v", err)
+			}
+
+			body, err := p.AssumeRole(tc.params)
+			if tests.EvalErrWithLog(t, err, "assume role", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+
+			got, err := parseTestAssumeRoleForm(body, now)
+			if err != nil {
+				t.Fatalf("failed parsing response: %v", err)
+			}
+			tests.EvalObjectsWithLog(t, "assume role", tc.want, got, msgs)
+		})
+	}
+}
+
+// parseTestAssumeRoleForm validates the signatures of the response and its
+// assertion and returns the values consumed by AWS.
+func parseTestAssumeRoleForm(body []byte, now time.Time) (map[string]interface{}, error) {
+	m := regexp.MustCompile(`action="([^"]+)"[\s\S]*name="SAMLResponse" value="([^"]+)"`).FindSubmatch(body)
+	if m == nil {
+		return nil, fmt.Errorf("form not found: %s", body)
+	}
+	b, err := base64.StdEncoding.DecodeString(html.UnescapeString(string(m[2])))
+	if err != nil {
+		return nil, err
+	}
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(b); err != nil {
+		return nil, err
+	}
+	certBytes, err := os.ReadFile("../../testdata/sso/authp_saml.crt")
+	if err != nil {
+		return nil, err
+	}
+	certBlock, _ := pem.Decode(certBytes)
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	validator := dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{
+		Roots: []*x509.Certificate{cert},
+	})
+	// The test certificate is expired, the signature is validated at the
+	// time of issue.
+	validator.Clock = dsig.NewFakeClockAt(now)
+
+	response, err := validator.Validate(doc.Root())
+	if err != nil {
+		return nil, fmt.Errorf("response signature: %v", err)
+	}
+	assertion, err := validator.Validate(response.FindElement("./Assertion"))
+	if err != nil {
+		return nil, fmt.Errorf("assertion signature: %v", err)
+	}
+
+	attrs := map[string]string{}
+	for _, attr := range assertion.FindElements("./AttributeStatement/Attribute") {
+		attrs[attr.SelectAttrValue("Name", "")] = attr.FindElement("./AttributeValue").Text()
+	}
+
+	return map[string]interface{}{
+		"action":          string(m[1]),
+		"issuer":          response.FindElement("./Issuer").Text(),
+		"destination":     response.SelectAttrValue("Destination", ""),
+		"audience":        assertion.FindElement("./Conditions/AudienceRestriction/Audience").Text(),
+		"recipient":       assertion.FindElement("./Subject/SubjectConfirmation/SubjectConfirmationData").SelectAttrValue("Recipient", ""),
+		"name_id":         assertion.FindElement("./Subject/NameID").Text(),
+		"not_on_or_after": assertion.FindElement("./Conditions").SelectAttrValue("NotOnOrAfter", ""),
+		"role":            attrs[awsRoleAttribute],
+		"session_name":    attrs[awsRoleSessionNameAttribute],
+		"duration":        attrs[awsSessionDurationAttribute],
+	}, nil
+}
@@ -0,0 +1,260 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sso
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/crewjam/saml"
+	"github.com/greenpau/go-authcrunch/internal/samlbinding"
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/kvstore"
+	"github.com/greenpau/go-authcrunch/pkg/util"
+)
+
+const (
+	maxAuthnRequestAge = 5 * time.Minute
+	maxClockSkew       = time.Minute
+
+	// authnRequestLifetime is the time the user has to log in before the
+	// saved authentication request expires.
+	authnRequestLifetime  = 15 * time.Minute
+	authnRequestKeyPrefix = "authn_request/"
+	// authnRequestUsedKeyPrefix is the prefix of the markers of the loaded
+	// authentication requests.
+	authnRequestUsedKeyPrefix = "authn_request_used/"
+)
+
+// AuthnRequest represents a validated authentication request of a service
+// provider. The request has no ID when the login is initiated by the portal.
+type AuthnRequest struct {
+	ID                  string `json:"id,omitempty" xml:"id,omitempty" yaml:"id,omitempty"`
+	ServiceProviderName string `json:"service_provider_name,omitempty" xml:"service_provider_name,omitempty" yaml:"service_provider_name,omitempty"`
+	AcsURL              string `json:"acs_url,omitempty" xml:"acs_url,omitempty" yaml:"acs_url,omitempty"`
+	NameIDFormat        string `json:"name_id_format,omitempty" xml:"name_id_format,omitempty" yaml:"name_id_format,omitempty"`
+	RelayState          string `json:"relay_state,omitempty" xml:"relay_state,omitempty" yaml:"relay_state,omitempty"`
+}
+
+type authnRequestCacheEntry struct {
+	Request   *AuthnRequest `json:"request"`
+	ExpiresAt time.Time     `json:"expires_at"`
+}
+
+// authnRequestCache holds the authentication requests received before
+// the users logged in. The entries are kept in a key/value store, which is
+// in memory unless set with setStore.
+type authnRequestCache struct {
+	mu    sync.RWMutex
+	store kvstore.Store
+}
+
+func newAuthnRequestCache() *authnRequestCache {
+	return &authnRequestCache{
+		store: kvstore.NewMemoryStore(),
+	}
+}
+
+func (c *authnRequestCache) setStore(store kvstore.Store) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.store = store
+}
+
+func (c *authnRequestCache) getStore() kvstore.Store {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.store
+}
+
+func (c *authnRequestCache) add(req *AuthnRequest) (string, error) {
+	b, err := json.Marshal(&authnRequestCacheEntry{
+		Request:   req,
+		ExpiresAt: timeNow().Add(authnRequestLifetime),
+	})
+	if err != nil {
+		return "", err
+	}
+	k := util.GetRandomString(32)
+	if err := c.getStore().Set(authnRequestKeyPrefix+k, b, authnRequestLifetime); err != nil {
+		return "", err
+	}
+	return k, nil
+}
+
+// get returns the saved authentication request and removes it, i.e. the
+// request is loaded once. The used marker is added atomically, so that a
+// single one of the instances sharing the store loads the request.
+func (c *authnRequestCache) get(k string) (*AuthnRequest, error) {
+	if k == "" {
+		return nil, errors.ErrSingleSignOnProviderAuthnRequestNotFound
+	}
+	store := c.getStore()
+	b, err := store.Get(authnRequestKeyPrefix + k)
+	if err != nil {
+		return nil, errors.ErrSingleSignOnProviderAuthnRequestNotFound
+	}
+	if err := store.Add(authnRequestUsedKeyPrefix+k, []byte{1}, authnRequestLifetime); err != nil {
+		return nil, errors.ErrSingleSignOnProviderAuthnRequestNotFound
+	}
+	store.Delete(authnRequestKeyPrefix + k)
+	entry := &authnRequestCacheEntry{}
+	if err := json.Unmarshal(b, entry); err != nil || entry.Request == nil {
+		return nil, errors.ErrSingleSignOnProviderAuthnRequestNotFound
+	}
+	if timeNow().After(entry.ExpiresAt) {
+		return nil, errors.ErrSingleSignOnProviderAuthnRequestNotFound
+	}
+	return entry.Request, nil
+}
+
+// SaveAuthnRequest saves the authentication request while the user logs in
+// and returns the key to load it with.
+func (p *Provider) SaveAuthnRequest(req *AuthnRequest) (string, error) {
+	return p.authnRequests.add(req)
+}
+
+// LoadAuthnRequest returns previously saved authentication request.
+func (p *Provider) LoadAuthnRequest(k string) (*AuthnRequest, error) {
+	return p.authnRequests.get(k)
+}
+
+// SetCacheStore sets the key/value store holding the authentication
+// requests, e.g. a store shared by several instances.
+func (p *Provider) SetCacheStore(store kvstore.Store) {
+	p.authnRequests.setStore(kvstore.WithPrefix(store, "sso/"+p.config.Name+"/"))
+}
+
+// NewAuthnRequest returns the request for the login to the service provider
+// initiated by the portal.
+func (p *Provider) NewAuthnRequest(name, relayState string) (*AuthnRequest, error) {
+	if p.config.Driver != "generic" {
+		return nil, errors.ErrSingleSignOnProviderRequestUnsupported.WithArgs(p.config.Name, p.config.Driver, "login")
+	}
+	sp, exists := p.serviceProviders[name]
+	if !exists {
+		return nil, errors.ErrSingleSignOnProviderServiceProviderNotFound.WithArgs(name)
+	}
+	if relayState == "" {
+		relayState = sp.config.RelayState
+	}
+	return &AuthnRequest{
+		ServiceProviderName: name,
+		AcsURL:              sp.getDefaultACSEndpoint().Location,
+		RelayState:          relayState,
+	}, nil
+}
+
+// ParseAuthnRequest parses and validates the authentication request of a
+// service provider received via HTTP-Redirect or HTTP-POST binding.
+func (p *Provider) ParseAuthnRequest(r *http.Request) (*AuthnRequest, error) {
+	if p.config.Driver != "generic" {
+		return nil, errors.ErrSingleSignOnProviderRequestUnsupported.WithArgs(p.config.Name, p.config.Driver, "authn")
+	}
+
+	msg, err := samlbinding.Decode(r, "SAMLRequest")
+	if err != nil {
+		return nil, errors.ErrSingleSignOnProviderAuthnRequestInvalid.WithArgs(err)
+	}
+
+	authnReq := &saml.AuthnRequest{}
+	if err := xml.Unmarshal(msg.Data, authnReq); err != nil {
+		return nil, errors.ErrSingleSignOnProviderAuthnRequestInvalid.WithArgs(err)
+	}
+	if authnReq.Issuer == nil || authnReq.Issuer.Value == "" {
+		return nil, errors.ErrSingleSignOnProviderAuthnRequestInvalid.WithArgs("empty issuer")
+	}
+	sp := p.getServiceProviderByEntityID(authnReq.Issuer.Value)
+	if sp == nil {
+		return nil, errors.ErrSingleSignOnProviderAuthnRequestInvalid.WithArgs(
+			fmt.Sprintf("unknown service provider %q", authnReq.Issuer.Value))
+	}
+
+	// The signature is verified once the issuer of the request is known.
+	if msg.IsSigned() {
+		el, err := msg.Verify(sp.certs, timeNow())
+		if err != nil {
+			return nil, errors.ErrSingleSignOnProviderAuthnRequestInvalid.WithArgs(err)
+		}
+		// Only the signed content is trusted.
+		signedDoc := etree.NewDocument()
+		signedDoc.SetRoot(el)
+		signedBytes, err := signedDoc.WriteToBytes()
+		if err != nil {
+			return nil, errors.ErrSingleSignOnProviderAuthnRequestInvalid.WithArgs(err)
+		}
+		authnReq = &saml.AuthnRequest{}
+		if err := xml.Unmarshal(signedBytes, authnReq); err != nil {
+			return nil, errors.ErrSingleSignOnProviderAuthnRequestInvalid.WithArgs(err)
+		}
+	} else if sp.requireSignedRequests() {
+		return nil, errors.ErrSingleSignOnProviderAuthnRequestInvalid.WithArgs("unsigned request")
+	}
+
+	if authnReq.Version != "2.0" {
+		return nil, errors.ErrSingleSignOnProviderAuthnRequestInvalid.WithArgs(
+			fmt.Sprintf("unsupported version %q", authnReq.Version))
+	}
+	now := timeNow()
+	if authnReq.IssueInstant.Add(maxAuthnRequestAge).Before(now) {
+		return nil, errors.ErrSingleSignOnProviderAuthnRequestInvalid.WithArgs("expired request")
+	}
+	if authnReq.IssueInstant.After(now.Add(maxClockSkew)) {
+		return nil, errors.ErrSingleSignOnProviderAuthnRequestInvalid.WithArgs("request issued in the future")
+	}
+	if authnReq.Destination != "" && !p.isLocation(authnReq.Destination) {
+		return nil, errors.ErrSingleSignOnProviderAuthnRequestInvalid.WithArgs(
+			fmt.Sprintf("unexpected destination %q", authnReq.Destination))
+	}
+
+	endpoint := sp.getACSEndpoint(authnReq.AssertionConsumerServiceIndex, authnReq.AssertionConsumerServiceURL)
+	if endpoint == nil {
+		return nil, errors.ErrSingleSignOnProviderAuthnRequestInvalid.WithArgs("assertion consumer service not found")
+	}
+
+	req := &AuthnRequest{
+		ID:                  authnReq.ID,
+		ServiceProviderName: sp.config.Name,
+		AcsURL:              endpoint.Location,
+		RelayState:          msg.RelayState,
+	}
+	if authnReq.NameIDPolicy != nil && authnReq.NameIDPolicy.Format != nil {
+		req.NameIDFormat = *authnReq.NameIDPolicy.Format
+	}
+	return req, nil
+}
+
+func (p *Provider) getServiceProviderByEntityID(entityID string) *serviceProvider {
+	for _, sp := range p.serviceProviders {
+		if sp.entityID == entityID {
+			return sp
+		}
+	}
+	return nil
+}
+
+func (p *Provider) isLocation(s string) bool {
+	for _, location := range p.config.Locations {
+		if location == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,435 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sso
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/greenpau/go-authcrunch/internal/tests"
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/kvstore"
+	logutil "github.com/greenpau/go-authcrunch/pkg/util/log"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+var testUserData = map[string]interface{}{
+	"sub":   "jsmith",
+	"email": "jsmith@contoso.com",
+	"name":  "John Smith",
+	"roles": []interface{}{"authp/admin", "authp/user"},
+}
+
+func newTestGenericProvider(t *testing.T) SingleSignOnProvider {
+	cfg := &SingleSignOnProviderConfig{
+		Name:           "corp",
+		Driver:         "generic",
+		EntityID:       "https://auth.contoso.com/apps/sso/corp/metadata.xml",
+		PrivateKeyPath: "../../testdata/sso/authp_saml.key",
+		CertPath:       "../../testdata/sso/authp_saml.crt",
+		Locations:      []string{"https://auth.contoso.com/apps/sso/corp/saml"},
+		ServiceProviders: []*ServiceProviderConfig{
+			{
+				Name:         "grafana",
+				MetadataPath: "../../testdata/sso/grafana_sp_metadata.xml",
+				Attributes: map[string]string{
+					"email":       "email",
+					"displayName": "name",
+					"groups":      "roles",
+				},
+			},
+			{
+				Name:         "jenkins",
+				EntityID:     "jenkins",
+				AcsURL:       "https://jenkins.contoso.com/securityRealm/finishLogin",
+				NameIDFormat: "persistent",
+				RelayState:   "/manage",
+				AllowedRoles: []string{"authp/admin"},
+			},
+		},
+	}
+	p, err := NewSingleSignOnProvider(cfg, logutil.NewLogger())
+	if err != nil {
+		t.Fatalf("failed creating provider: %v", err)
+	}
+	return p
+}
+
+// newTestServiceProvider returns the service provider sending requests to
+// and consuming responses of the portal.
+func newTestServiceProvider(t *testing.T, p SingleSignOnProvider, entityID, acsURL, signatureMethod string) *saml.ServiceProvider {
+	b, err := p.GetMetadata()
+	if err != nil {
+		t.Fatalf("failed getting metadata: %v", err)
+	}
+	idpMetadata := &saml.EntityDescriptor{}
+	if err := xml.Unmarshal(b, idpMetadata); err != nil {
+		t.Fatalf("failed parsing metadata: %v", err)
+	}
+
+	certBytes, err := os.ReadFile("../../testdata/sso/grafana_sp.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	certBlock, _ := pem.Decode(certBytes)
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyBytes, err := os.ReadFile("../../testdata/sso/grafana_sp.key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyBlock, _ := pem.Decode(keyBytes)
+	key, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, _ := url.Parse(acsURL)
+	return &saml.ServiceProvider{
+		EntityID:          entityID,
+		Key:               key.(*rsa.PrivateKey),
+		Certificate:       cert,
+		AcsURL:            *u,
+		IDPMetadata:       idpMetadata,
+		SignatureMethod:   signatureMethod,
+		AuthnNameIDFormat: saml.EmailAddressNameIDFormat,
+		AllowIDPInitiated: true,
+	}
+}
+
+// parseTestSignOnForm submits the form returned by the portal to the service
+// provider and returns the values of the accepted assertion.
+func parseTestSignOnForm(sp *saml.ServiceProvider, body []byte, requestIDs []string) (map[string]interface{}, error) {
+	m := regexp.MustCompile(`action="([^"]+)"[\s\S]*name="SAMLResponse" value="([^"]+)"`).FindSubmatch(body)
+	if m == nil {
+		return nil, fmt.Errorf("form not found: %s", body)
+	}
+	form := url.Values{}
+	form.Set("SAMLResponse", html.UnescapeString(string(m[2])))
+	r := httptest.NewRequest(http.MethodPost, sp.AcsURL.String(), strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+
+	assertion, err := sp.ParseResponse(r, requestIDs)
+	if err != nil {
+		if ire, ok := err.(*saml.InvalidResponseError); ok {
+			return nil, ire.PrivateErr
+		}
+		return nil, err
+	}
+
+	got := map[string]interface{}{
+		"action":         html.UnescapeString(string(m[1])),
+		"name_id":        assertion.Subject.NameID.Value,
+		"name_id_format": assertion.Subject.NameID.Format,
+	}
+	if rm := regexp.MustCompile(`name="RelayState" value="([^"]+)"`).FindSubmatch(body); rm != nil {
+		got["relay_state"] = html.UnescapeString(string(rm[1]))
+	}
+	for _, stmt := range assertion.AttributeStatements {
+		for _, attr := range stmt.Attributes {
+			var values []string
+			for _, v := range attr.Values {
+				values = append(values, v.Value)
+			}
+			sort.Strings(values)
+			got["attr_"+attr.Name] = strings.Join(values, ",")
+		}
+	}
+	return got, nil
+}
+
+func TestServiceProviderSignOn(t *testing.T) {
+	// The test identity provider certificate expires in 2025.
+	now := time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	saml.TimeNow = func() time.Time { return now }
+	saml.Clock = dsig.NewFakeClockAt(now)
+	defer func() {
+		timeNow = time.Now
+		saml.TimeNow = time.Now
+		saml.Clock = nil
+	}()
+
+	grafanaEntityID := "https://grafana.contoso.com/saml/metadata"
+	grafanaACSURL := "https://grafana.contoso.com/saml/acs"
+	jenkinsACSURL := "https://jenkins.contoso.com/securityRealm/finishLogin"
+
+	testcases := []struct {
+		name string
+		// request returns the request sent by the service provider and its id.
+		request func(*testing.T, *saml.ServiceProvider) (*http.Request, string)
+		// login is the service provider logged in to by the portal.
+		login string
+		// data is the user data, testUserData by default.
+		data            map[string]interface{}
+		entityID        string
+		acsURL          string
+		signatureMethod string
+		want            map[string]interface{}
+		shouldErr       bool
+		err             error
+	}{
+		{
+			name:            "test signed request with redirect binding",
+			entityID:        grafanaEntityID,
+			acsURL:          grafanaACSURL,
+			signatureMethod: dsig.RSASHA256SignatureMethod,
+			request: func(t *testing.T, sp *saml.ServiceProvider) (*http.Request, string) {
+				u, err := sp.MakeRedirectAuthenticationRequest("/dashboards")
+				if err != nil {
+					t.Fatal(err)
+				}
+				return httptest.NewRequest(http.MethodGet, u.String(), nil), getTestAuthnRequestID(t, u)
+			},
+			want: map[string]interface{}{
+				"action":            grafanaACSURL,
+				"name_id":           "jsmith@contoso.com",
+				"name_id_format":    "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress",
+				"relay_state":       "/dashboards",
+				"attr_email":        "jsmith@contoso.com",
+				"attr_displayName":  "John Smith",
+				"attr_groups":       "authp/admin,authp/user",
+				"service_provider":  "grafana",
+				"in_response_to_id": true,
+			},
+		},
+		{
+			name:            "test signed request with post binding",
+			entityID:        grafanaEntityID,
+			acsURL:          grafanaACSURL,
+			signatureMethod: dsig.RSASHA256SignatureMethod,
+			request: func(t *testing.T, sp *saml.ServiceProvider) (*http.Request, string) {
+				req, err := sp.MakeAuthenticationRequest(sp.GetSSOBindingLocation(saml.HTTPPostBinding), saml.HTTPPostBinding, saml.HTTPPostBinding)
+				if err != nil {
+					t.Fatal(err)
+				}
+				m := regexp.MustCompile(`name="SAMLRequest" value="([^"]+)"`).FindSubmatch(req.Post(""))
+				form := url.Values{}
+				form.Set("SAMLRequest", html.UnescapeString(string(m[1])))
+				r := httptest.NewRequest(http.MethodPost, req.Destination, strings.NewReader(form.Encode()))
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				return r, req.ID
+			},
+			want: map[string]interface{}{
+				"action":            grafanaACSURL,
+				"name_id":           "jsmith@contoso.com",
+				"name_id_format":    "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress",
+				"attr_email":        "jsmith@contoso.com",
+				"attr_displayName":  "John Smith",
+				"attr_groups":       "authp/admin,authp/user",
+				"service_provider":  "grafana",
+				"in_response_to_id": true,
+			},
+		},
+		{
+			name:     "test unsigned request of service provider requiring signatures",
+			entityID: grafanaEntityID,
+			acsURL:   grafanaACSURL,
+			request: func(t *testing.T, sp *saml.ServiceProvider) (*http.Request, string) {
+				u, err := sp.MakeRedirectAuthenticationRequest("")
+				if err != nil {
+					t.Fatal(err)
+				}
+				return httptest.NewRequest(http.MethodGet, u.String(), nil), ""
+			},
+			shouldErr: true,
+			err:       errors.ErrSingleSignOnProviderAuthnRequestInvalid.WithArgs("unsigned request"),
+		},
+		{
+			name:            "test request with tampered relay state",
+			entityID:        grafanaEntityID,
+			acsURL:          grafanaACSURL,
+			signatureMethod: dsig.RSASHA256SignatureMethod,
+			request: func(t *testing.T, sp *saml.ServiceProvider) (*http.Request, string) {
+				u, err := sp.MakeRedirectAuthenticationRequest("/dashboards")
+				if err != nil {
+					t.Fatal(err)
+				}
+				u.RawQuery = strings.Replace(u.RawQuery, "RelayState=/dashboards", "RelayState=/admin", 1)
+				return httptest.NewRequest(http.MethodGet, u.String(), nil), ""
+			},
+			shouldErr: true,
+			err:       errors.ErrSingleSignOnProviderAuthnRequestInvalid.WithArgs("signature verification failed"),
+		},
+		{
+			name:            "test request of unknown service provider",
+			entityID:        "https://gitlab.contoso.com",
+			acsURL:          "https://gitlab.contoso.com/users/auth/saml/callback",
+			signatureMethod: dsig.RSASHA256SignatureMethod,
+			request: func(t *testing.T, sp *saml.ServiceProvider) (*http.Request, string) {
+				u, err := sp.MakeRedirectAuthenticationRequest("")
+				if err != nil {
+					t.Fatal(err)
+				}
+				return httptest.NewRequest(http.MethodGet, u.String(), nil), ""
+			},
+			shouldErr: true,
+			err:       errors.ErrSingleSignOnProviderAuthnRequestInvalid.WithArgs(`unknown service provider "https://gitlab.contoso.com"`),
+		},
+		{
+			name:     "test login initiated by portal",
+			login:    "jenkins",
+			entityID: "jenkins",
+			acsURL:   jenkinsACSURL,
+			want: map[string]interface{}{
+				"action":           jenkinsACSURL,
+				"name_id":          "jsmith",
+				"name_id_format":   "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent",
+				"relay_state":      "/manage",
+				"attr_email":       "jsmith@contoso.com",
+				"attr_name":        "John Smith",
+				"attr_roles":       "authp/admin,authp/user",
+				"service_provider": "jenkins",
+			},
+		},
+		{
+			name:     "test login of user without allowed role",
+			login:    "jenkins",
+			entityID: "jenkins",
+			acsURL:   jenkinsACSURL,
+			data: map[string]interface{}{
+				"sub":   "bjones",
+				"email": "bjones@contoso.com",
+				"roles": []interface{}{"authp/user"},
+			},
+			shouldErr: true,
+			err:       errors.ErrSingleSignOnProviderServiceProviderForbidden.WithArgs("jenkins"),
+		},
+		{
+			name:      "test login to unknown service provider",
+			login:     "gitlab",
+			shouldErr: true,
+			err:       errors.ErrSingleSignOnProviderServiceProviderNotFound.WithArgs("gitlab"),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			p := newTestGenericProvider(t)
+			sp := newTestServiceProvider(t, p, tc.entityID, tc.acsURL, tc.signatureMethod)
+
+			var req *AuthnRequest
+			var requestIDs []string
+			var err error
+			if tc.login != "" {
+				req, err = p.NewAuthnRequest(tc.login, "")
+			} else {
+				r, requestID := tc.request(t, sp)
+				requestIDs = append(requestIDs, requestID)
+				req, err = p.ParseAuthnRequest(r)
+			}
+			var body []byte
+			if err == nil {
+				data := tc.data
+				if data == nil {
+					data = testUserData
+				}
+				body, err = p.SignOn(req, data)
+			}
+			if tests.EvalErrWithLog(t, err, "sign on", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			got, err := parseTestSignOnForm(sp, body, requestIDs)
+			if err != nil {
+				t.Fatalf("service provider rejected response: %v", err)
+			}
+			got["service_provider"] = req.ServiceProviderName
+			if req.ID != "" {
+				got["in_response_to_id"] = req.ID == requestIDs[0]
+			}
+			tests.EvalObjectsWithLog(t, "sign on", tc.want, got, msgs)
+		})
+	}
+}
+
+func TestSaveAuthnRequest(t *testing.T) {
+	p := newTestGenericProvider(t)
+	req, err := p.NewAuthnRequest("jenkins", "/job/build")
+	if err != nil {
+		t.Fatalf("failed creating request: %v", err)
+	}
+	k, err := p.SaveAuthnRequest(req)
+	if err != nil {
+		t.Fatalf("failed saving request: %v", err)
+	}
+
+	got, err := p.LoadAuthnRequest(k)
+	if err != nil {
+		t.Fatalf("failed loading request: %v", err)
+	}
+	tests.EvalObjectsWithLog(t, "saved request", req, got, []string{})
+
+	// The request is loaded once.
+	_, err = p.LoadAuthnRequest(k)
+	tests.EvalErrWithLog(t, err, "reused request", true, errors.ErrSingleSignOnProviderAuthnRequestNotFound, []string{})
+
+	// The request saved by one instance is loaded by another one sharing
+	// the store.
+	store := kvstore.NewMemoryStore()
+	p.(*Provider).SetCacheStore(store)
+	k, err = p.SaveAuthnRequest(req)
+	if err != nil {
+		t.Fatalf("failed saving request: %v", err)
+	}
+	other := newTestGenericProvider(t)
+	other.(*Provider).SetCacheStore(store)
+	got, err = other.LoadAuthnRequest(k)
+	if err != nil {
+		t.Fatalf("failed loading shared request: %v", err)
+	}
+	tests.EvalObjectsWithLog(t, "shared request", req, got, []string{})
+	_, err = p.LoadAuthnRequest(k)
+	tests.EvalErrWithLog(t, err, "shared reused request", true, errors.ErrSingleSignOnProviderAuthnRequestNotFound, []string{})
+
+	k, err = p.SaveAuthnRequest(req)
+	if err != nil {
+		t.Fatalf("failed saving request: %v", err)
+	}
+	timeNow = func() time.Time { return time.Now().Add(authnRequestLifetime + time.Minute) }
+	defer func() { timeNow = time.Now }()
+	_, err = p.LoadAuthnRequest(k)
+	tests.EvalErrWithLog(t, err, "expired request", true, errors.ErrSingleSignOnProviderAuthnRequestNotFound, []string{})
+}
+
+func getTestAuthnRequestID(t *testing.T, u *url.URL) string {
+	req, err := saml.NewIdpAuthnRequest(&saml.IdentityProvider{}, httptest.NewRequest(http.MethodGet, u.String(), nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	authnReq := &saml.AuthnRequest{}
+	if err := xml.Unmarshal(req.RequestBuffer, authnReq); err != nil {
+		t.Fatal(err)
+	}
+	return authnReq.ID
+}
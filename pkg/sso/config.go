@@ -18,6 +18,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"strings"
 )
 
 // SingleSignOnProviderConfig represents an identity provider configuration.
@@ -28,13 +29,51 @@ type SingleSignOnProviderConfig struct {
 	Locations      []string `json:"locations,omitempty" xml:"locations,omitempty" yaml:"locations,omitempty"`
 	PrivateKeyPath string   `json:"private_key_path,omitempty" xml:"private_key_path,omitempty" yaml:"private_key_path,omitempty"`
 	CertPath       string   `json:"cert_path,omitempty" xml:"cert_path,omitempty" yaml:"cert_path,omitempty"`
+	// SAMLProviderName is the name of the SAML provider in AWS IAM. It defaults
+	// to the name of the provider.
+	SAMLProviderName string `json:"saml_provider_name,omitempty" xml:"saml_provider_name,omitempty" yaml:"saml_provider_name,omitempty"`
+	// SessionDuration is the lifetime of AWS console sessions, in seconds.
+	SessionDuration int `json:"session_duration,omitempty" xml:"session_duration,omitempty" yaml:"session_duration,omitempty"`
+	// ServiceProviders are the SAML service providers served by the generic driver.
+	ServiceProviders []*ServiceProviderConfig `json:"service_providers,omitempty" xml:"service_providers,omitempty" yaml:"service_providers,omitempty"`
+}
+
+// ServiceProviderConfig represents a SAML service provider configuration.
+type ServiceProviderConfig struct {
+	// Name identifies the service provider in portal URLs.
+	Name string `json:"name,omitempty" xml:"name,omitempty" yaml:"name,omitempty"`
+	// EntityID is the entity id of the service provider. It defaults to the
+	// entity id in the metadata of the service provider.
+	EntityID string `json:"entity_id,omitempty" xml:"entity_id,omitempty" yaml:"entity_id,omitempty"`
+	// MetadataPath is the path to the metadata of the service provider.
+	MetadataPath string `json:"metadata_path,omitempty" xml:"metadata_path,omitempty" yaml:"metadata_path,omitempty"`
+	// AcsURL is the assertion consumer service URL of the service provider
+	// without metadata.
+	AcsURL string `json:"acs_url,omitempty" xml:"acs_url,omitempty" yaml:"acs_url,omitempty"`
+	// CertPath is the path to the request signing certificate of the service
+	// provider without metadata.
+	CertPath string `json:"cert_path,omitempty" xml:"cert_path,omitempty" yaml:"cert_path,omitempty"`
+	// NameIDFormat is the format of the subject name id, i.e. email,
+	// persistent, transient, or unspecified.
+	NameIDFormat string `json:"name_id_format,omitempty" xml:"name_id_format,omitempty" yaml:"name_id_format,omitempty"`
+	// NameIDClaim is the user claim holding the subject name id.
+	NameIDClaim string `json:"name_id_claim,omitempty" xml:"name_id_claim,omitempty" yaml:"name_id_claim,omitempty"`
+	// Attributes maps assertion attribute names to user claims.
+	Attributes map[string]string `json:"attributes,omitempty" xml:"attributes,omitempty" yaml:"attributes,omitempty"`
+	// RelayState is the relay state of identity provider initiated logins.
+	RelayState string `json:"relay_state,omitempty" xml:"relay_state,omitempty" yaml:"relay_state,omitempty"`
+	// RequireSignedRequests rejects unsigned authentication requests.
+	RequireSignedRequests bool `json:"require_signed_requests,omitempty" xml:"require_signed_requests,omitempty" yaml:"require_signed_requests,omitempty"`
+	// AllowedRoles are the roles of the users allowed to log in to the
+	// service provider. Any user is allowed when empty.
+	AllowedRoles []string `json:"allowed_roles,omitempty" xml:"allowed_roles,omitempty" yaml:"allowed_roles,omitempty"`
 }
 
 // NewSingleSignOnProviderConfig returns SingleSignOnProviderConfig instance.
 func NewSingleSignOnProviderConfig(data map[string]interface{}) (*SingleSignOnProviderConfig, error) {
 
 	requiredFields := []string{"name", "entity_id", "locations", "private_key_path", "cert_path"}
-	optionalFields := []string{"driver"}
+	optionalFields := []string{"driver", "saml_provider_name", "session_duration", "service_providers"}
 
 	if err := validateFields(data, requiredFields, optionalFields); err != nil {
 		return nil, errors.ErrSingleSignOnProviderConfigInvalid.WithArgs("input data error", err)
@@ -68,8 +107,27 @@ func (cfg *SingleSignOnProviderConfig) Validate() error {
 	if len(cfg.Locations) < 1 {
 		return errors.ErrSingleSignOnProviderConfigInvalid.WithArgs("misconfiguration", "empty locations")
 	}
+	if cfg.SessionDuration != 0 && (cfg.SessionDuration < minSessionDuration || cfg.SessionDuration > maxSessionDuration) {
+		return errors.ErrSingleSignOnProviderConfigInvalid.WithArgs("misconfiguration",
+			fmt.Sprintf("session duration must be between %d and %d seconds", minSessionDuration, maxSessionDuration))
+	}
 	switch cfg.Driver {
 	case "aws":
+	case "generic":
+		if len(cfg.ServiceProviders) < 1 {
+			return errors.ErrSingleSignOnProviderConfigInvalid.WithArgs("misconfiguration", "empty service providers")
+		}
+		names := make(map[string]bool)
+		for _, sp := range cfg.ServiceProviders {
+			if err := sp.Validate(); err != nil {
+				return errors.ErrSingleSignOnProviderConfigInvalid.WithArgs("misconfiguration", err)
+			}
+			if names[sp.Name] {
+				return errors.ErrSingleSignOnProviderConfigInvalid.WithArgs("misconfiguration",
+					fmt.Sprintf("duplicate service provider %q", sp.Name))
+			}
+			names[sp.Name] = true
+		}
 	case "":
 		return errors.ErrSingleSignOnProviderConfigInvalid.WithArgs("misconfiguration", "empty driver name")
 	default:
@@ -78,6 +136,35 @@ func (cfg *SingleSignOnProviderConfig) Validate() error {
 	return nil
 }
 
+// Validate validates service provider config.
+func (cfg *ServiceProviderConfig) Validate() error {
+	if cfg.Name == "" {
+		return fmt.Errorf("empty service provider name")
+	}
+	if strings.ContainsAny(cfg.Name, "/?# ") {
+		return fmt.Errorf("service provider %q name contains reserved characters", cfg.Name)
+	}
+	if cfg.MetadataPath == "" {
+		if cfg.EntityID == "" {
+			return fmt.Errorf("service provider %q has neither metadata path nor entity id", cfg.Name)
+		}
+		if cfg.AcsURL == "" {
+			return fmt.Errorf("service provider %q has neither metadata path nor acs url", cfg.Name)
+		}
+	}
+	if cfg.NameIDFormat != "" {
+		if _, err := getNameIDFormat(cfg.NameIDFormat); err != nil {
+			return fmt.Errorf("service provider %q: %v", cfg.Name, err)
+		}
+	}
+	for _, role := range cfg.AllowedRoles {
+		if strings.TrimSpace(role) == "" {
+			return fmt.Errorf("service provider %q has empty allowed role", cfg.Name)
+		}
+	}
+	return nil
+}
+
 func validateFields(m map[string]interface{}, requiredFields, optionalFields []string) error {
 	if m == nil || len(m) == 0 {
 		return fmt.Errorf("empty identity provider parameters")
@@ -99,6 +99,138 @@ func TestNewSingleSignOnProviderConfig(t *testing.T) {
 			shouldErr: true,
 			err:       errors.ErrSingleSignOnProviderConfigInvalid.WithArgs("misconfiguration", "unsupported driver name"),
 		},
+		{
+			name: "test generic sso provider",
+			input: map[string]interface{}{
+				"name":             "corp",
+				"driver":           "generic",
+				"entity_id":        "caddy-authp-idp",
+				"private_key_path": "../../testdata/sso/authp_saml.key",
+				"cert_path":        "../../testdata/sso/authp_saml.crt",
+				"locations": []string{
+					"https://localhost/apps/sso/corp/saml",
+				},
+				"service_providers": []map[string]interface{}{
+					{
+						"name":           "jenkins",
+						"entity_id":      "jenkins",
+						"acs_url":        "https://jenkins.contoso.com/securityRealm/finishLogin",
+						"name_id_format": "persistent",
+						"attributes": map[string]string{
+							"email": "email",
+						},
+					},
+				},
+			},
+			want: `{
+				"name":             "corp",
+				"driver":           "generic",
+				"entity_id":        "caddy-authp-idp",
+				"private_key_path": "../../testdata/sso/authp_saml.key",
+				"cert_path":        "../../testdata/sso/authp_saml.crt",
+				"locations": [
+					"https://localhost/apps/sso/corp/saml"
+				],
+				"service_providers": [
+					{
+						"name":           "jenkins",
+						"entity_id":      "jenkins",
+						"acs_url":        "https://jenkins.contoso.com/securityRealm/finishLogin",
+						"name_id_format": "persistent",
+						"attributes": {
+							"email": "email"
+						}
+					}
+				]
+			}`,
+		},
+		{
+			name: "test generic sso provider without service providers error",
+			input: map[string]interface{}{
+				"name":             "corp",
+				"driver":           "generic",
+				"entity_id":        "caddy-authp-idp",
+				"private_key_path": "../../testdata/sso/authp_saml.key",
+				"cert_path":        "../../testdata/sso/authp_saml.crt",
+				"locations": []string{
+					"https://localhost/apps/sso/corp/saml",
+				},
+			},
+			shouldErr: true,
+			err:       errors.ErrSingleSignOnProviderConfigInvalid.WithArgs("misconfiguration", "empty service providers"),
+		},
+		{
+			name: "test generic sso provider with unsupported name id format error",
+			input: map[string]interface{}{
+				"name":             "corp",
+				"driver":           "generic",
+				"entity_id":        "caddy-authp-idp",
+				"private_key_path": "../../testdata/sso/authp_saml.key",
+				"cert_path":        "../../testdata/sso/authp_saml.crt",
+				"locations": []string{
+					"https://localhost/apps/sso/corp/saml",
+				},
+				"service_providers": []map[string]interface{}{
+					{
+						"name":           "jenkins",
+						"entity_id":      "jenkins",
+						"acs_url":        "https://jenkins.contoso.com/securityRealm/finishLogin",
+						"name_id_format": "kerberos",
+					},
+				},
+			},
+			shouldErr: true,
+			err: errors.ErrSingleSignOnProviderConfigInvalid.WithArgs(
+				"misconfiguration",
+				fmt.Errorf(`service provider "jenkins": unsupported name id format "kerberos"`),
+			),
+		},
+		{
+			name: "test generic sso provider with empty allowed role error",
+			input: map[string]interface{}{
+				"name":             "corp",
+				"driver":           "generic",
+				"entity_id":        "caddy-authp-idp",
+				"private_key_path": "../../testdata/sso/authp_saml.key",
+				"cert_path":        "../../testdata/sso/authp_saml.crt",
+				"locations": []string{
+					"https://localhost/apps/sso/corp/saml",
+				},
+				"service_providers": []map[string]interface{}{
+					{
+						"name":          "jenkins",
+						"entity_id":     "jenkins",
+						"acs_url":       "https://jenkins.contoso.com/securityRealm/finishLogin",
+						"allowed_roles": []string{"authp/admin", " "},
+					},
+				},
+			},
+			shouldErr: true,
+			err: errors.ErrSingleSignOnProviderConfigInvalid.WithArgs(
+				"misconfiguration",
+				fmt.Errorf(`service provider "jenkins" has empty allowed role`),
+			),
+		},
+		{
+			name: "test session duration out of range error",
+			input: map[string]interface{}{
+				"name":             "aws",
+				"driver":           "aws",
+				"entity_id":        "caddy-authp-idp",
+				"private_key_path": "../../testdata/sso/authp_saml.key",
+				"cert_path":        "../../testdata/sso/authp_saml.crt",
+				"session_duration": 60,
+				"locations": []string{
+					"https://localhost/sso/aws",
+					"https://127.0.0.1/sso/aws",
+				},
+			},
+			shouldErr: true,
+			err: errors.ErrSingleSignOnProviderConfigInvalid.WithArgs(
+				"misconfiguration",
+				"session duration must be between 900 and 43200 seconds",
+			),
+		},
 		{
 			name: "test empty provider name error",
 			input: map[string]interface{}{
@@ -98,14 +98,21 @@ func (p *Provider) GetMetadata() ([]byte, error) {
 		},
 	}
 
+	bindings := []string{"urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"}
+	if p.config.Driver == "generic" {
+		bindings = append(bindings, "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect")
+	}
+
 	for _, location := range p.config.Locations {
-		svc := SingleSignOnService{
-			Service: Service{
-				Binding:  "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST",
-				Location: location,
-			},
+		for _, binding := range bindings {
+			svc := SingleSignOnService{
+				Service: Service{
+					Binding:  binding,
+					Location: location,
+				},
+			}
+			entity.IDPSSODescriptor.SingleSignOnService = append(entity.IDPSSODescriptor.SingleSignOnService, svc)
 		}
-		entity.IDPSSODescriptor.SingleSignOnService = append(entity.IDPSSODescriptor.SingleSignOnService, svc)
 	}
 
 	var b bytes.Buffer
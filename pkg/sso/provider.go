@@ -15,12 +15,14 @@
 package sso
 
 import (
+	"crypto"
 	"crypto/x509"
 	"encoding/json"
 	"encoding/pem"
 	"github.com/greenpau/go-authcrunch/pkg/errors"
 	fileutil "github.com/greenpau/go-authcrunch/pkg/util/file"
 	"go.uber.org/zap"
+	"net/http"
 )
 
 // SingleSignOnProvider represents sso provider interface.
@@ -31,6 +33,13 @@ type SingleSignOnProvider interface {
 	Configure() error
 	Configured() bool
 	GetMetadata() ([]byte, error)
+	AssumeRole(*AssumeRoleParams) ([]byte, error)
+	GetServiceProviders() []string
+	ParseAuthnRequest(*http.Request) (*AuthnRequest, error)
+	NewAuthnRequest(string, string) (*AuthnRequest, error)
+	SaveAuthnRequest(*AuthnRequest) (string, error)
+	LoadAuthnRequest(string) (*AuthnRequest, error)
+	SignOn(*AuthnRequest, map[string]interface{}) ([]byte, error)
 }
 
 // Provider represents sso provider.
@@ -41,6 +50,10 @@ type Provider struct {
 	cert       *x509.Certificate
 	privateKey any
 	metadata   []byte
+	// serviceProviders are the service providers of the generic driver.
+	serviceProviders     map[string]*serviceProvider
+	serviceProviderNames []string
+	authnRequests        *authnRequestCache
 }
 
 // GetName return the name associated with sso provider.
@@ -72,6 +85,11 @@ func (p *Provider) Configure() error {
 	return nil
 }
 
+// GetServiceProviders returns the names of the service providers.
+func (p *Provider) GetServiceProviders() []string {
+	return p.serviceProviderNames
+}
+
 // NewSingleSignOnProvider returns SingleSignOnProvider instance.
 func NewSingleSignOnProvider(cfg *SingleSignOnProviderConfig, logger *zap.Logger) (SingleSignOnProvider, error) {
 	var p SingleSignOnProvider
@@ -111,11 +129,30 @@ func NewSingleSignOnProvider(cfg *SingleSignOnProviderConfig, logger *zap.Logger
 		return nil, errors.ErrSingleSignOnProviderConfigInvalid.WithArgs("private key parse error", err)
 	}
 
+	signer, ok := pk.(crypto.Signer)
+	if !ok {
+		return nil, errors.ErrSingleSignOnProviderConfigInvalid.WithArgs("private key error", "private key is not a signer")
+	}
+	if _, err := getSignatureMethod(signer); err != nil {
+		return nil, errors.ErrSingleSignOnProviderConfigInvalid.WithArgs("private key error", err)
+	}
+
 	prv := &Provider{
-		config:     cfg,
-		logger:     logger,
-		cert:       cert,
-		privateKey: pk,
+		config:           cfg,
+		logger:           logger,
+		cert:             cert,
+		privateKey:       pk,
+		serviceProviders: make(map[string]*serviceProvider),
+		authnRequests:    newAuthnRequestCache(),
+	}
+
+	for _, spCfg := range cfg.ServiceProviders {
+		sp, err := newServiceProvider(spCfg)
+		if err != nil {
+			return nil, err
+		}
+		prv.serviceProviders[spCfg.Name] = sp
+		prv.serviceProviderNames = append(prv.serviceProviderNames, spCfg.Name)
 	}
 
 	p = prv
@@ -37,6 +37,10 @@ const (
 	AssumeRoleRequest
 	// MenuRequest represents role selection request type.
 	MenuRequest
+	// SignOnRequest represents authentication request of a service provider.
+	SignOnRequest
+	// LoginRequest represents login to a service provider initiated by the portal.
+	LoginRequest
 )
 
 // Request represents sso provider request.
@@ -78,6 +82,21 @@ func ParseRequestURL(r *http.Request) (*Request, error) {
 		return req, nil
 	}
 
+	if strings.HasPrefix(parts[1], "login/") {
+		params := strings.TrimPrefix(parts[1], "login/")
+		if params == "" || strings.Contains(params, "/") {
+			return nil, errors.ErrSingleSignOnProviderRequestMalformed
+		}
+		req.Params = params
+		req.Kind = LoginRequest
+		return req, nil
+	}
+
+	if parts[1] == "saml" {
+		req.Kind = SignOnRequest
+		return req, nil
+	}
+
 	if parts[1] == "metadata.xml" {
 		req.Kind = MetadataRequest
 		return req, nil
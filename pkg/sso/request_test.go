@@ -82,6 +82,44 @@ func TestParseRequestURL(t *testing.T) {
 			shouldErr: true,
 			err:       errors.ErrSingleSignOnProviderRequestMalformed,
 		},
+		{
+			name: "test service provider authn request",
+			input: &http.Request{
+				Method: "POST",
+				URL: &url.URL{
+					Path: "/apps/sso/corp/saml",
+				},
+			},
+			want: &Request{
+				ProviderName: "corp",
+				Kind:         SignOnRequest,
+			},
+		},
+		{
+			name: "test service provider login request",
+			input: &http.Request{
+				Method: "GET",
+				URL: &url.URL{
+					Path: "/apps/sso/corp/login/grafana",
+				},
+			},
+			want: &Request{
+				ProviderName: "corp",
+				Kind:         LoginRequest,
+				Params:       "grafana",
+			},
+		},
+		{
+			name: "test malformed service provider login request",
+			input: &http.Request{
+				Method: "GET",
+				URL: &url.URL{
+					Path: "/apps/sso/corp/login/",
+				},
+			},
+			shouldErr: true,
+			err:       errors.ErrSingleSignOnProviderRequestMalformed,
+		},
 		{
 			name: "test malformed request",
 			input: &http.Request{
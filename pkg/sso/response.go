@@ -0,0 +1,189 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sso
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"fmt"
+	"html/template"
+	"net/url"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/util"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// assertionLifetime is the time the service provider has to consume the
+// response.
+const assertionLifetime = 5 * time.Minute
+
+var (
+	timeNow = time.Now
+
+	postFormTemplate = template.Must(template.New("sso-post-form").Parse(`<!DOCTYPE html>` +
+		`<html><body>` +
+		`<form method="post" action="{{.URL}}" id="SAMLResponseForm">` +
+		`<input type="hidden" name="SAMLResponse" value="{{.SAMLResponse}}" />` +
+		`{{if .RelayState}}<input type="hidden" name="RelayState" value="{{.RelayState}}" />{{end}}` +
+		`<noscript><input type="submit" value="Continue" /></noscript>` +
+		`</form>` +
+		`<script>document.getElementById('SAMLResponseForm').submit();</script>` +
+		`</body></html>`))
+)
+
+// SignOn returns an HTML page submitting a signed SAML response for the
+// user to the assertion consumer service of the service provider.
+func (p *Provider) SignOn(req *AuthnRequest, data map[string]interface{}) ([]byte, error) {
+	if p.config.Driver != "generic" {
+		return nil, errors.ErrSingleSignOnProviderRequestUnsupported.WithArgs(p.config.Name, p.config.Driver, "sign-on")
+	}
+	sp, exists := p.serviceProviders[req.ServiceProviderName]
+	if !exists {
+		return nil, errors.ErrSingleSignOnProviderServiceProviderNotFound.WithArgs(req.ServiceProviderName)
+	}
+	if !sp.isAllowed(data) {
+		return nil, errors.ErrSingleSignOnProviderServiceProviderForbidden.WithArgs(req.ServiceProviderName)
+	}
+
+	nameID, err := sp.getNameID(req.NameIDFormat, data)
+	if err != nil {
+		return nil, err
+	}
+
+	now := timeNow().UTC()
+	expiresAt := now.Add(assertionLifetime)
+	assertionID := "id-" + util.GetRandomString(40)
+
+	assertion := &saml.Assertion{
+		ID:           assertionID,
+		IssueInstant: now,
+		Version:      "2.0",
+		Issuer: saml.Issuer{
+			Format: "urn:oasis:names:tc:SAML:2.0:nameid-format:entity",
+			Value:  p.config.EntityID,
+		},
+		Subject: &saml.Subject{
+			NameID: nameID,
+			SubjectConfirmations: []saml.SubjectConfirmation{
+				{
+					Method: "urn:oasis:names:tc:SAML:2.0:cm:bearer",
+					SubjectConfirmationData: &saml.SubjectConfirmationData{
+						InResponseTo: req.ID,
+						NotOnOrAfter: expiresAt,
+						Recipient:    req.AcsURL,
+					},
+				},
+			},
+		},
+		Conditions: &saml.Conditions{
+			NotBefore:    now,
+			NotOnOrAfter: expiresAt,
+			AudienceRestrictions: []saml.AudienceRestriction{
+				{Audience: saml.Audience{Value: sp.entityID}},
+			},
+		},
+		AuthnStatements: []saml.AuthnStatement{
+			{
+				AuthnInstant: now,
+				SessionIndex: assertionID,
+				AuthnContext: saml.AuthnContext{
+					AuthnContextClassRef: &saml.AuthnContextClassRef{
+						Value: "urn:oasis:names:tc:SAML:2.0:ac:classes:PasswordProtectedTransport",
+					},
+				},
+			},
+		},
+	}
+	if attrs := sp.getAttributes(data); len(attrs) > 0 {
+		assertion.AttributeStatements = []saml.AttributeStatement{{Attributes: attrs}}
+	}
+
+	samlResponse, err := p.signResponse(assertion, req.AcsURL, req.ID, sp.descriptor)
+	if err != nil {
+		return nil, errors.ErrSingleSignOnProviderResponseFailed.WithArgs(err)
+	}
+	return renderPostForm(req.AcsURL, samlResponse, req.RelayState)
+}
+
+// signResponse signs the assertion and returns base64-encoded signed SAML
+// response. The assertion is encrypted when the service provider publishes
+// an encryption certificate.
+func (p *Provider) signResponse(assertion *saml.Assertion, acsURL, inResponseTo string, descriptor *saml.SPSSODescriptor) (string, error) {
+	signer, ok := p.privateKey.(crypto.Signer)
+	if !ok {
+		return "", fmt.Errorf("private key is not a signer")
+	}
+	signatureMethod, err := getSignatureMethod(signer)
+	if err != nil {
+		return "", err
+	}
+	issuer, err := url.Parse(p.config.EntityID)
+	if err != nil {
+		return "", err
+	}
+
+	req := &saml.IdpAuthnRequest{
+		IDP: &saml.IdentityProvider{
+			Signer:          signer,
+			Certificate:     p.cert,
+			MetadataURL:     *issuer,
+			SignatureMethod: signatureMethod,
+		},
+		Request: saml.AuthnRequest{
+			ID: inResponseTo,
+		},
+		SPSSODescriptor: descriptor,
+		ACSEndpoint: &saml.IndexedEndpoint{
+			Binding:  saml.HTTPPostBinding,
+			Location: acsURL,
+		},
+		Now:       assertion.IssueInstant,
+		Assertion: assertion,
+	}
+
+	form, err := req.PostBinding()
+	if err != nil {
+		return "", err
+	}
+	return form.SAMLResponse, nil
+}
+
+func renderPostForm(acsURL, samlResponse, relayState string) ([]byte, error) {
+	var b bytes.Buffer
+	form := map[string]string{
+		"URL":          acsURL,
+		"SAMLResponse": samlResponse,
+		"RelayState":   relayState,
+	}
+	if err := postFormTemplate.Execute(&b, form); err != nil {
+		return nil, errors.ErrSingleSignOnProviderResponseFailed.WithArgs(err)
+	}
+	return b.Bytes(), nil
+}
+
+func getSignatureMethod(signer crypto.Signer) (string, error) {
+	switch signer.(type) {
+	case *rsa.PrivateKey:
+		return dsig.RSASHA256SignatureMethod, nil
+	case *ecdsa.PrivateKey:
+		return dsig.ECDSASHA256SignatureMethod, nil
+	}
+	return "", fmt.Errorf("unsupported private key type %T", signer)
+}
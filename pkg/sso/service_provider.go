@@ -0,0 +1,310 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sso
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/crewjam/saml"
+	"github.com/greenpau/go-authcrunch/pkg/errors"
+	"github.com/greenpau/go-authcrunch/pkg/util"
+	fileutil "github.com/greenpau/go-authcrunch/pkg/util/file"
+)
+
+var (
+	nameIDFormats = map[string]string{
+		"email":       "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress",
+		"persistent":  "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent",
+		"transient":   "urn:oasis:names:tc:SAML:2.0:nameid-format:transient",
+		"unspecified": "urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified",
+	}
+
+	nameIDClaims = map[string]string{
+		"email":       "email",
+		"persistent":  "sub",
+		"unspecified": "sub",
+	}
+
+	defaultAttributes = map[string]string{
+		"email": "email",
+		"name":  "name",
+		"roles": "roles",
+	}
+
+	whitespaceRgx = regexp.MustCompile(`\s+`)
+)
+
+// serviceProvider is a SAML service provider served by the generic driver.
+type serviceProvider struct {
+	config     *ServiceProviderConfig
+	entityID   string
+	descriptor *saml.SPSSODescriptor
+	certs      []*x509.Certificate
+}
+
+func newServiceProvider(cfg *ServiceProviderConfig) (*serviceProvider, error) {
+	sp := &serviceProvider{
+		config:   cfg,
+		entityID: cfg.EntityID,
+	}
+
+	if cfg.MetadataPath != "" {
+		b, err := fileutil.ReadFileBytes(cfg.MetadataPath)
+		if err != nil {
+			return nil, errors.ErrSingleSignOnProviderServiceProviderLoad.WithArgs(cfg.Name, err)
+		}
+		entity := &saml.EntityDescriptor{}
+		if err := xml.Unmarshal(b, entity); err != nil {
+			return nil, errors.ErrSingleSignOnProviderServiceProviderLoad.WithArgs(cfg.Name, err)
+		}
+		if len(entity.SPSSODescriptors) < 1 {
+			return nil, errors.ErrSingleSignOnProviderServiceProviderLoad.WithArgs(cfg.Name, "metadata has no SPSSODescriptor")
+		}
+		if sp.entityID == "" {
+			sp.entityID = entity.EntityID
+		}
+		if sp.entityID != entity.EntityID {
+			return nil, errors.ErrSingleSignOnProviderServiceProviderLoad.WithArgs(cfg.Name,
+				fmt.Sprintf("entity id %q does not match metadata entity id %q", sp.entityID, entity.EntityID))
+		}
+		sp.descriptor = &entity.SPSSODescriptors[0]
+		for _, kd := range sp.descriptor.KeyDescriptors {
+			if kd.Use != "" && kd.Use != "signing" {
+				continue
+			}
+			for _, data := range kd.KeyInfo.X509Data.X509Certificates {
+				b, err := base64.StdEncoding.DecodeString(whitespaceRgx.ReplaceAllString(data.Data, ""))
+				if err != nil {
+					return nil, errors.ErrSingleSignOnProviderServiceProviderLoad.WithArgs(cfg.Name, err)
+				}
+				cert, err := x509.ParseCertificate(b)
+				if err != nil {
+					return nil, errors.ErrSingleSignOnProviderServiceProviderLoad.WithArgs(cfg.Name, err)
+				}
+				sp.certs = append(sp.certs, cert)
+			}
+		}
+	} else {
+		sp.descriptor = &saml.SPSSODescriptor{}
+	}
+
+	if cfg.AcsURL != "" {
+		sp.descriptor.AssertionConsumerServices = append([]saml.IndexedEndpoint{
+			{
+				Binding:  saml.HTTPPostBinding,
+				Location: cfg.AcsURL,
+			},
+		}, sp.descriptor.AssertionConsumerServices...)
+	}
+
+	if cfg.CertPath != "" {
+		b, err := fileutil.ReadFileBytes(cfg.CertPath)
+		if err != nil {
+			return nil, errors.ErrSingleSignOnProviderServiceProviderLoad.WithArgs(cfg.Name, err)
+		}
+		block, _ := pem.Decode(b)
+		if block == nil || block.Type != "CERTIFICATE" {
+			return nil, errors.ErrSingleSignOnProviderServiceProviderLoad.WithArgs(cfg.Name, "cert is not PEM encoded certificate")
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.ErrSingleSignOnProviderServiceProviderLoad.WithArgs(cfg.Name, err)
+		}
+		sp.certs = append(sp.certs, cert)
+	}
+
+	if sp.getDefaultACSEndpoint() == nil {
+		return nil, errors.ErrSingleSignOnProviderServiceProviderLoad.WithArgs(cfg.Name, "no assertion consumer service with HTTP-POST binding")
+	}
+	return sp, nil
+}
+
+// requireSignedRequests returns true when the authentication requests of
+// the service provider must be signed.
+func (sp *serviceProvider) requireSignedRequests() bool {
+	if sp.config.RequireSignedRequests {
+		return true
+	}
+	return sp.descriptor.AuthnRequestsSigned != nil && *sp.descriptor.AuthnRequestsSigned
+}
+
+// getACSEndpoint returns the assertion consumer service with HTTP-POST
+// binding matching the requested index or location.
+func (sp *serviceProvider) getACSEndpoint(index, location string) *saml.IndexedEndpoint {
+	if index == "" && location == "" {
+		return sp.getDefaultACSEndpoint()
+	}
+	for i, endpoint := range sp.descriptor.AssertionConsumerServices {
+		if endpoint.Binding != saml.HTTPPostBinding {
+			continue
+		}
+		if index != "" && fmt.Sprintf("%d", endpoint.Index) != index {
+			continue
+		}
+		if location != "" && endpoint.Location != location {
+			continue
+		}
+		return &sp.descriptor.AssertionConsumerServices[i]
+	}
+	return nil
+}
+
+func (sp *serviceProvider) getDefaultACSEndpoint() *saml.IndexedEndpoint {
+	var endpoint *saml.IndexedEndpoint
+	for i, e := range sp.descriptor.AssertionConsumerServices {
+		if e.Binding != saml.HTTPPostBinding {
+			continue
+		}
+		if e.IsDefault != nil && *e.IsDefault {
+			return &sp.descriptor.AssertionConsumerServices[i]
+		}
+		if endpoint == nil {
+			endpoint = &sp.descriptor.AssertionConsumerServices[i]
+		}
+	}
+	return endpoint
+}
+
+// isAllowed returns true when the user has one of the roles allowed to log
+// in to the service provider.
+func (sp *serviceProvider) isAllowed(data map[string]interface{}) bool {
+	if len(sp.config.AllowedRoles) == 0 {
+		return true
+	}
+	for _, role := range getClaimValues(data, "roles") {
+		for _, allowedRole := range sp.config.AllowedRoles {
+			if role == allowedRole {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getNameID returns the subject name id of the user. The format requested
+// by the service provider applies when the configuration has none.
+func (sp *serviceProvider) getNameID(requestedFormat string, data map[string]interface{}) (*saml.NameID, error) {
+	k := sp.config.NameIDFormat
+	if k == "" {
+		k = "email"
+		if requestedFormat != "" && requestedFormat != nameIDFormats["unspecified"] {
+			if _, err := getNameIDFormat(requestedFormat); err == nil {
+				k = requestedFormat
+			}
+		}
+	}
+	format, _ := getNameIDFormat(k)
+
+	nameID := &saml.NameID{
+		Format:          format,
+		SPNameQualifier: sp.entityID,
+	}
+	if format == nameIDFormats["transient"] && sp.config.NameIDClaim == "" {
+		nameID.Value = "id-" + util.GetRandomString(40)
+		return nameID, nil
+	}
+
+	claim := sp.config.NameIDClaim
+	if claim == "" {
+		for short, urn := range nameIDFormats {
+			if urn == format {
+				claim = nameIDClaims[short]
+			}
+		}
+	}
+	values := getClaimValues(data, claim)
+	if len(values) < 1 || values[0] == "" {
+		return nil, errors.ErrSingleSignOnProviderNameIDNotFound.WithArgs(claim)
+	}
+	nameID.Value = values[0]
+	return nameID, nil
+}
+
+// getAttributes returns the assertion attributes mapped from user claims.
+func (sp *serviceProvider) getAttributes(data map[string]interface{}) []saml.Attribute {
+	mappings := sp.config.Attributes
+	if len(mappings) == 0 {
+		mappings = defaultAttributes
+	}
+	var names []string
+	for name := range mappings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var attrs []saml.Attribute
+	for _, name := range names {
+		values := getClaimValues(data, mappings[name])
+		if len(values) == 0 {
+			continue
+		}
+		attr := saml.Attribute{
+			Name:       name,
+			NameFormat: "urn:oasis:names:tc:SAML:2.0:attrname-format:basic",
+		}
+		if strings.Contains(name, ":") {
+			attr.NameFormat = "urn:oasis:names:tc:SAML:2.0:attrname-format:uri"
+		}
+		for _, v := range values {
+			attr.Values = append(attr.Values, saml.AttributeValue{Type: "xs:string", Value: v})
+		}
+		attrs = append(attrs, attr)
+	}
+	return attrs
+}
+
+// getNameIDFormat returns the URN of the name id format referenced by its
+// short name or URN.
+func getNameIDFormat(s string) (string, error) {
+	if format, exists := nameIDFormats[s]; exists {
+		return format, nil
+	}
+	for _, format := range nameIDFormats {
+		if format == s {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported name id format %q", s)
+}
+
+func getClaimValues(data map[string]interface{}, claim string) []string {
+	v, exists := data[claim]
+	if !exists {
+		return nil
+	}
+	var values []string
+	switch val := v.(type) {
+	case string:
+		if val != "" {
+			values = append(values, val)
+		}
+	case []string:
+		values = append(values, val...)
+	case []interface{}:
+		for _, entry := range val {
+			values = append(values, fmt.Sprint(entry))
+		}
+	default:
+		values = append(values, fmt.Sprint(val))
+	}
+	return values
+}
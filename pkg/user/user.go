@@ -193,6 +193,8 @@ func (u *User) AsMap() map[string]interface{} {
 }
 
 // GetData return user claim felds and their values for the evaluation by an ACL.
+// The data includes the exp, iat and nbf claims, in seconds since the epoch,
+// and the custom claims of the token.
 func (u *User) GetData() map[string]interface{} {
 	return u.tkv
 }
@@ -260,18 +262,21 @@ func (u *User) BuildRequestIdentity(s string) map[string]interface{} {
 // SetExpiresAtClaim sets ExpiresAt claim.
 func (u *User) SetExpiresAtClaim(i int64) {
 	u.Claims.ExpiresAt = i
+	u.tkv["exp"] = i
 	u.mkv["exp"] = i
 }
 
 // SetIssuedAtClaim sets IssuedAt claim.
 func (u *User) SetIssuedAtClaim(i int64) {
 	u.Claims.IssuedAt = i
+	u.tkv["iat"] = i
 	u.mkv["iat"] = i
 }
 
 // SetNotBeforeClaim sets NotBefore claim.
 func (u *User) SetNotBeforeClaim(i int64) {
 	u.Claims.NotBefore = i
+	u.tkv["nbf"] = i
 	u.mkv["nbf"] = i
 }
 
@@ -438,6 +443,9 @@ func NewCheckpoint(s string) (*Checkpoint, error) {
 	case "password":
 		c.Name = "Authenticate with password"
 		c.Type = "password"
+	case "password_change":
+		c.Name = "Change expired password"
+		c.Type = "password_change"
 	//case "consent":
 	//	c.Name = "Acceptance and consent"
 	//	c.Type = "consent"
@@ -500,7 +508,7 @@ func (c *Claims) unpackAudience(k string, v interface{}, mkv, tkv map[string]int
 	return nil
 }
 
-func (c *Claims) unpackExpiresAt(k string, v interface{}, mkv map[string]interface{}) error {
+func (c *Claims) unpackExpiresAt(k string, v interface{}, mkv, tkv map[string]interface{}) error {
 	switch exp := v.(type) {
 	case float64:
 		c.ExpiresAt = int64(exp)
@@ -514,6 +522,7 @@ func (c *Claims) unpackExpiresAt(k string, v interface{}, mkv map[string]interfa
 	default:
 		return errors.ErrInvalidClaimExpiresAt.WithArgs(v)
 	}
+	tkv[k] = c.ExpiresAt
 	mkv[k] = c.ExpiresAt
 	return nil
 }
@@ -530,7 +539,7 @@ func (c *Claims) unpackID(k string, v interface{}, mkv, tkv map[string]interface
 	return nil
 }
 
-func (c *Claims) unpackIssuedAt(k string, v interface{}, mkv map[string]interface{}) error {
+func (c *Claims) unpackIssuedAt(k string, v interface{}, mkv, tkv map[string]interface{}) error {
 	switch exp := v.(type) {
 	case float64:
 		c.IssuedAt = int64(exp)
@@ -544,6 +553,7 @@ func (c *Claims) unpackIssuedAt(k string, v interface{}, mkv map[string]interfac
 	default:
 		return errors.ErrInvalidClaimIssuedAt.WithArgs(v)
 	}
+	tkv[k] = c.IssuedAt
 	mkv[k] = c.IssuedAt
 	return nil
 }
@@ -560,7 +570,7 @@ func (c *Claims) unpackIssuer(k string, v interface{}, mkv, tkv map[string]inter
 	return nil
 }
 
-func (c *Claims) unpackNotBefore(k string, v interface{}, mkv map[string]interface{}) error {
+func (c *Claims) unpackNotBefore(k string, v interface{}, mkv, tkv map[string]interface{}) error {
 	switch exp := v.(type) {
 	case float64:
 		c.NotBefore = int64(exp)
@@ -574,6 +584,7 @@ func (c *Claims) unpackNotBefore(k string, v interface{}, mkv map[string]interfa
 	default:
 		return errors.ErrInvalidClaimNotBefore.WithArgs(v)
 	}
+	tkv[k] = c.NotBefore
 	mkv[k] = c.NotBefore
 	return nil
 }
@@ -887,7 +898,7 @@ func NewUser(data interface{}) (*User, error) {
 				return nil, err
 			}
 		case "exp":
-			if err := c.unpackExpiresAt(k, v, mkv); err != nil {
+			if err := c.unpackExpiresAt(k, v, mkv, tkv); err != nil {
 				return nil, err
 			}
 		case "jti":
@@ -895,7 +906,7 @@ func NewUser(data interface{}) (*User, error) {
 				return nil, err
 			}
 		case "iat":
-			if err := c.unpackIssuedAt(k, v, mkv); err != nil {
+			if err := c.unpackIssuedAt(k, v, mkv, tkv); err != nil {
 				return nil, err
 			}
 		case "iss":
@@ -903,7 +914,7 @@ func NewUser(data interface{}) (*User, error) {
 				return nil, err
 			}
 		case "nbf":
-			if err := c.unpackNotBefore(k, v, mkv); err != nil {
+			if err := c.unpackNotBefore(k, v, mkv, tkv); err != nil {
 				return nil, err
 			}
 		case "sub":
@@ -968,6 +979,12 @@ func NewUser(data interface{}) (*User, error) {
 				c.custom = make(map[string]interface{})
 			}
 			c.custom[k] = v
+			// The custom claims are available to the ACLs, except for the
+			// ones named after the fields the portal adds to the input of
+			// the ACLs, i.e. the time of the evaluation and the request data.
+			if k != "now" && !strings.HasPrefix(k, "request.") {
+				tkv[k] = v
+			}
 			mkv[k] = v
 		}
 	}
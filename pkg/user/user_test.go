@@ -475,3 +475,25 @@ func TestNewClaimsFromMap(t *testing.T) {
 		})
 	}
 }
+
+func TestUserDataCustomClaims(t *testing.T) {
+	usr, err := NewUser([]byte(`{"sub": "jsmith", "iat": 1646222400, "level": 3, "now": 1646222400, "request.addr": "10.0.0.1"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := usr.GetData()
+	got := map[string]interface{}{
+		"iat":   data["iat"],
+		"level": data["level"],
+	}
+	for _, k := range []string{"now", "request.addr"} {
+		if _, exists := data[k]; exists {
+			got[k] = data[k]
+		}
+	}
+	want := map[string]interface{}{
+		"iat":   int64(1646222400),
+		"level": float64(3),
+	}
+	tests.EvalObjectsWithLog(t, "data", want, got, []string{})
+}
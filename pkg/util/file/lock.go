@@ -0,0 +1,27 @@
+// Copyright 2022 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+// LockFile acquires an exclusive advisory lock on the lock file of the
+// provided path, i.e. <fp>.lock, and blocks until the lock is acquired.
+// The lock file is separate from the file, because the file is replaced by
+// atomic renames. The returned function releases the lock.
+func LockFile(fp string) (func() error, error) {
+	fp, err := expandHomePath(fp)
+	if err != nil {
+		return nil, err
+	}
+	return lockFile(fp + ".lock")
+}
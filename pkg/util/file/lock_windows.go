@@ -12,26 +12,29 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package authn
+//go:build windows
 
-import (
-	"context"
-	"encoding/json"
+package file
 
-	// "github.com/greenpau/go-authcrunch/pkg/identity"
-	"net/http"
-	"time"
+import (
+	"os"
 
-	"github.com/greenpau/go-authcrunch/pkg/requests"
-	"github.com/greenpau/go-authcrunch/pkg/user"
+	"golang.org/x/sys/windows"
 )
 
-func (p *Portal) handleAPIListUsers(_ context.Context, w http.ResponseWriter, _ *http.Request, rr *requests.Request, _ *user.User) error {
-	rr.Response.Code = http.StatusOK
-	resp := make(map[string]interface{})
-	resp["timestamp"] = time.Now().UTC().Format(time.RFC3339Nano)
-	respBytes, _ := json.Marshal(resp)
-	w.WriteHeader(rr.Response.Code)
-	w.Write(respBytes)
-	return nil
+func lockFile(fp string) (func() error, error) {
+	f, err := os.OpenFile(fp, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	h := windows.Handle(f.Fd())
+	ol := &windows.Overlapped{}
+	if err := windows.LockFileEx(h, windows.LOCKFILE_EXCLUSIVE_LOCK, 0, 1, 0, ol); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() error {
+		defer f.Close()
+		return windows.UnlockFileEx(h, 0, 1, 0, ol)
+	}, nil
 }
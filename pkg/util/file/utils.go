@@ -115,3 +115,45 @@ func ExpandPath(s string) string {
 	}
 	return p
 }
+
+// WriteFileAtomic writes data to a temporary file in the directory of the
+// file, flushes it to stable storage, and renames it over the file. A crash
+// leaves either the old or the new contents of the file, and the readers
+// never see a partial write.
+func WriteFileAtomic(fp string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(fp)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, "."+filepath.Base(fp)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, fp); err != nil {
+		return err
+	}
+
+	// Persist the rename by syncing the directory. Some platforms do not
+	// support syncing directories, hence the error is not fatal.
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
@@ -24,7 +24,9 @@ import (
 	"github.com/greenpau/go-authcrunch/pkg/errors"
 	"github.com/greenpau/go-authcrunch/pkg/idp"
 	"github.com/greenpau/go-authcrunch/pkg/ids"
+	"github.com/greenpau/go-authcrunch/pkg/kvstore"
 	"github.com/greenpau/go-authcrunch/pkg/registry"
+	"github.com/greenpau/go-authcrunch/pkg/revocation"
 	"github.com/greenpau/go-authcrunch/pkg/sso"
 	"go.uber.org/zap"
 )
@@ -47,10 +49,24 @@ type Server struct {
 	identityProviders []idp.IdentityProvider
 	ssoProviders      []sso.SingleSignOnProvider
 	userRegistries    []registry.UserRegistry
+	revocationList    *revocation.List
+	cacheStore        kvstore.Store
 	nameRefs          refMap
 	logger            *zap.Logger
 }
 
+// cacheStoreSetter is implemented by the components keeping their cache
+// entries in a key/value store.
+type cacheStoreSetter interface {
+	SetCacheStore(kvstore.Store)
+}
+
+// stopper is implemented by the components running in the background, e.g.
+// the identity stores watching their database files.
+type stopper interface {
+	Stop()
+}
+
 func newRefMap() refMap {
 	return refMap{
 		portals:           make(map[string]*authn.Portal),
@@ -75,6 +91,12 @@ func NewServer(config *Config, logger *zap.Logger) (*Server, error) {
 		nameRefs:  newRefMap(),
 	}
 
+	cacheStore, err := kvstore.NewStore(config.Cache)
+	if err != nil {
+		return nil, errors.ErrNewServer.WithArgs("failed initializing cache store", err)
+	}
+	srv.cacheStore = cacheStore
+
 	for _, cfg := range config.IdentityProviders {
 		provider, err := idp.NewIdentityProvider(cfg, logger)
 		if err != nil {
@@ -86,6 +108,9 @@ func NewServer(config *Config, logger *zap.Logger) (*Server, error) {
 		if err := provider.Configure(); err != nil {
 			return nil, errors.ErrNewServer.WithArgs("failed configuring identity provider", err)
 		}
+		if s, ok := provider.(cacheStoreSetter); ok {
+			s.SetCacheStore(srv.cacheStore)
+		}
 		srv.nameRefs.identityProviders[provider.GetName()] = provider
 		srv.identityProviders = append(srv.identityProviders, provider)
 	}
@@ -116,6 +141,9 @@ func NewServer(config *Config, logger *zap.Logger) (*Server, error) {
 		if err := provider.Configure(); err != nil {
 			return nil, errors.ErrNewServer.WithArgs("failed configuring sso provider", err)
 		}
+		if s, ok := provider.(cacheStoreSetter); ok {
+			s.SetCacheStore(srv.cacheStore)
+		}
 		srv.nameRefs.ssoProviders[provider.GetName()] = provider
 		srv.ssoProviders = append(srv.ssoProviders, provider)
 	}
@@ -128,10 +156,20 @@ func NewServer(config *Config, logger *zap.Logger) (*Server, error) {
 		if _, exists := srv.nameRefs.userRegistries[userRegistry.GetName()]; exists {
 			return nil, errors.ErrNewServer.WithArgs("duplicate user registry name", userRegistry.GetName())
 		}
+		if s, ok := userRegistry.(cacheStoreSetter); ok {
+			s.SetCacheStore(srv.cacheStore)
+		}
 		srv.nameRefs.userRegistries[userRegistry.GetName()] = userRegistry
 		srv.userRegistries = append(srv.userRegistries, userRegistry)
 	}
 
+	revocationList, err := revocation.NewList(config.TokenRevocation)
+	if err != nil {
+		return nil, errors.ErrNewServer.WithArgs("failed initializing token revocation list", err)
+	}
+	revocationList.SetLogger(logger)
+	srv.revocationList = revocationList
+
 	for _, cfg := range config.AuthenticationPortals {
 		params := authn.PortalParameters{
 			Config:                cfg,
@@ -150,6 +188,8 @@ func NewServer(config *Config, logger *zap.Logger) (*Server, error) {
 			return nil, errors.ErrNewServer.WithArgs("duplicate authentication portal name", cfg.Name)
 		}
 
+		portal.SetRevocationList(srv.revocationList)
+		portal.SetCacheStore(srv.cacheStore)
 		srv.nameRefs.portals[cfg.Name] = portal
 		srv.portals = append(srv.portals, portal)
 		authenticators = append(authenticators, portal)
@@ -164,6 +204,7 @@ func NewServer(config *Config, logger *zap.Logger) (*Server, error) {
 		if _, exists := srv.nameRefs.gatekeepers[cfg.Name]; exists {
 			return nil, errors.ErrNewServer.WithArgs("duplicate authorization policy name", cfg.Name)
 		}
+		gatekeeper.SetRevocationList(srv.revocationList)
 		srv.nameRefs.gatekeepers[cfg.Name] = gatekeeper
 		srv.gatekeepers = append(srv.gatekeepers, gatekeeper)
 	}
@@ -186,9 +227,20 @@ func NewServer(config *Config, logger *zap.Logger) (*Server, error) {
 		}
 	}
 
+	srv.revocationList.Start()
 	return srv, nil
 }
 
+// Stop stops the background work of the identity stores of Server. The
+// server is not used afterwards, e.g. when its configuration is replaced.
+func (srv *Server) Stop() {
+	for _, store := range srv.identityStores {
+		if st, ok := store.(stopper); ok {
+			st.Stop()
+		}
+	}
+}
+
 // GetConfig returns Server configuration.
 func (srv *Server) GetConfig() map[string]interface{} {
 	var m map[string]interface{}
@@ -205,6 +257,18 @@ func (srv *Server) GetPortalByName(s string) (*authn.Portal, error) {
 	return nil, fmt.Errorf("portal not found")
 }
 
+// GetRevocationList returns the token revocation deny list shared by
+// portals and gatekeepers.
+func (srv *Server) GetRevocationList() *revocation.List {
+	return srv.revocationList
+}
+
+// GetCacheStore returns the key/value store shared by the caches of
+// portals, identity providers, and user registries.
+func (srv *Server) GetCacheStore() kvstore.Store {
+	return srv.cacheStore
+}
+
 // GetGatekeeperByName returns an instance of authz.Gatekeeper based on its name.
 func (srv *Server) GetGatekeeperByName(s string) (*authz.Gatekeeper, error) {
 	if gatekeeper, exists := srv.nameRefs.gatekeepers[s]; exists {